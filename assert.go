@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrInvalidAssertion indicates a document's assertion section could not be parsed.
+	ErrInvalidAssertion = errors.New("invalid assertion")
+	// ErrAssertionFailed indicates the merged result violated a document's assertion.
+	ErrAssertionFailed = errors.New("assertion failed")
+)
+
+// AssertionFailure describes an assertion that did not hold for the merged result.
+type AssertionFailure struct {
+	// DocIndex is the index of the document that made the assertion.
+	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
+	// Path is the asserted path, as written.
+	Path string
+	// Message is the assertion's message, or a description of the mismatch if it has none.
+	Message string
+}
+
+func (f AssertionFailure) String() string {
+	return fmt.Sprintf("document %d%s: %s: %s", f.DocIndex, nameSuffix(f.DocName), f.Path, f.Message)
+}
+
+// AssertionError is returned when the merged result violates assertions made
+// by the merged documents. See [Options.AssertKey].
+type AssertionError struct {
+	// Failures lists every assertion that did not hold, in document order.
+	Failures []AssertionFailure
+}
+
+func (e *AssertionError) Error() string {
+	messages := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		messages[i] = f.String()
+	}
+	return fmt.Sprintf("%d assertion(s) failed: %s", len(e.Failures), strings.Join(messages, "; "))
+}
+
+func (e *AssertionError) Is(target error) bool {
+	return target == ErrAssertionFailed
+}
+
+// assertion is a single parsed assertion from a document.
+type assertion struct {
+	docIndex  int
+	path      string
+	steps     []pathStep
+	equals    any
+	hasEquals bool
+	exists    bool
+	message   string
+}
+
+// extractAssertions removes the assertion section from a top-level document map
+// and parses it. The document is returned unchanged if it has no such section.
+func (m *UntypedMerger) extractAssertions(doc any) (any, []assertion, error) {
+	key := m.opts.AssertKey
+	mp, ok := doc.(map[string]any)
+	if key == "" || !ok {
+		return doc, nil, nil
+	}
+	section, exists := mp[key]
+	if !exists {
+		return doc, nil, nil
+	}
+
+	stripped := make(map[string]any, len(mp)-1)
+	for k, v := range mp {
+		if k != key {
+			stripped[k] = v
+		}
+	}
+
+	specs, ok := asList(section)
+	if !ok {
+		specs = []any{section}
+	}
+	assertions := make([]assertion, len(specs))
+	for i, spec := range specs {
+		a, err := parseAssertion(spec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: document %d: %s[%d]: %w", ErrInvalidAssertion, m.index, key, i, err)
+		}
+		a.docIndex = m.index
+		assertions[i] = a
+	}
+	return stripped, assertions, nil
+}
+
+// parseAssertion parses an assertion map with a "path" and optional "equals",
+// "exists", and "message" fields.
+func parseAssertion(spec any) (assertion, error) {
+	mp, ok := spec.(map[string]any)
+	if !ok {
+		return assertion{}, fmt.Errorf("expected a map, got %T", spec)
+	}
+	a := assertion{exists: true}
+	for _, k := range sortedKeys(mp) {
+		v := mp[k]
+		switch k {
+		case "path", "message":
+			s, ok := v.(string)
+			if !ok {
+				return assertion{}, fmt.Errorf("%q must be a string", k)
+			}
+			if k == "path" {
+				a.path = s
+			} else {
+				a.message = s
+			}
+		case "equals":
+			a.equals, a.hasEquals = v, true
+		case "exists":
+			b, ok := v.(bool)
+			if !ok {
+				return assertion{}, errors.New(`"exists" must be a boolean`)
+			}
+			a.exists = b
+		default:
+			return assertion{}, fmt.Errorf("unknown field %q", k)
+		}
+	}
+	if a.path == "" {
+		return assertion{}, errors.New(`"path" is required`)
+	}
+	if a.hasEquals && !a.exists {
+		return assertion{}, errors.New(`"equals" cannot be combined with "exists: false"`)
+	}
+	steps, err := parsePath(a.path)
+	if err != nil {
+		return assertion{}, err
+	}
+	a.steps = steps
+	return a, nil
+}
+
+// checkAssertions returns an [*AssertionError] if any assertion fails for result.
+func checkAssertions(result any, assertions []assertion) error {
+	var failures []AssertionFailure
+	for _, a := range assertions {
+		value, found := lookupSteps(result, a.steps)
+		var mismatch string
+		switch {
+		case !a.exists && found:
+			mismatch = fmt.Sprintf("expected no value, got %v", value)
+		case a.exists && !found:
+			mismatch = "expected a value, got none"
+		case a.hasEquals && !equalValues(value, a.equals):
+			mismatch = fmt.Sprintf("expected %v, got %v", a.equals, value)
+		default:
+			continue
+		}
+		if a.message != "" {
+			mismatch = a.message
+		}
+		failures = append(failures, AssertionFailure{DocIndex: a.docIndex, Path: a.path, Message: mismatch})
+	}
+	if len(failures) > 0 {
+		return &AssertionError{Failures: failures}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestAssertKey(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}, AssertKey: "_assert"}
+	base := []byte(`
+services:
+  - name: web
+    port: 8080
+`)
+
+	tests := []struct {
+		name     string
+		overlay  string
+		failures []keymerge.AssertionFailure
+	}{
+		{
+			name: "passing",
+			overlay: `
+_assert:
+  - path: services[name=web].port
+    equals: 8080
+  - path: services[name=web].debug
+    exists: false
+  - path: services[name=api]
+services:
+  - name: api
+    port: 9090
+`,
+		},
+		{
+			name: "single assertion",
+			overlay: `
+_assert: {path: "services[name=web].port", equals: 8080}
+`,
+		},
+		{
+			name: "failing",
+			overlay: `
+_assert:
+  - path: services[name=web].port
+    equals: 8080
+  - path: services[name=web].port
+    equals: 80
+    message: web must listen on port 80
+  - path: services[name=api]
+  - path: services[name=web]
+    exists: false
+`,
+			failures: []keymerge.AssertionFailure{
+				{DocIndex: 1, Path: "services[name=web].port", Message: "web must listen on port 80"},
+				{DocIndex: 1, Path: "services[name=api]", Message: "expected a value, got none"},
+				{DocIndex: 1, Path: "services[name=web]", Message: "expected no value, got map[name:web port:8080]"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := keymerge.Merge(opts, yaml.Unmarshal, yaml.Marshal, base, []byte(tt.overlay))
+			if tt.failures == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				var doc map[string]any
+				if err := yaml.Unmarshal(result, &doc); err != nil {
+					t.Fatal(err)
+				}
+				if _, exists := doc["_assert"]; exists {
+					t.Error("assertions should be stripped from the result")
+				}
+				return
+			}
+			var assertErr *keymerge.AssertionError
+			if !errors.As(err, &assertErr) || !errors.Is(err, keymerge.ErrAssertionFailed) {
+				t.Fatalf("expected AssertionError, got %v", err)
+			}
+			if !reflect.DeepEqual(assertErr.Failures, tt.failures) {
+				t.Errorf("got %+v, want %+v", assertErr.Failures, tt.failures)
+			}
+		})
+	}
+}
+
+func TestAssertKey_LaterDocuments(t *testing.T) {
+	// Assertions are checked against the final result, not the result so far.
+	opts := keymerge.Options{AssertKey: "_assert"}
+	docs := []any{
+		map[string]any{"_assert": map[string]any{"path": "log", "equals": "warn"}, "log": "info"},
+		map[string]any{"log": "warn"},
+	}
+	result, err := keymerge.MergeUnstructured(opts, docs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, map[string]any{"log": "warn"}) {
+		t.Errorf("unexpected result %v", result)
+	}
+
+	// Without AssertKey, the section is ordinary data.
+	result, err = keymerge.MergeUnstructured(keymerge.Options{}, docs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := result.(map[string]any)["_assert"]; !exists {
+		t.Error("expected _assert to be kept when AssertKey is empty")
+	}
+}
+
+func TestAssertKey_Invalid(t *testing.T) {
+	opts := keymerge.Options{AssertKey: "_assert"}
+	for _, section := range []any{
+		"not a map",
+		map[string]any{"equals": 1},
+		map[string]any{"path": 1},
+		map[string]any{"path": "a", "exists": "yes"},
+		map[string]any{"path": "a", "exists": false, "equals": 1},
+		map[string]any{"path": "a", "expect": 1},
+		map[string]any{"path": "a["},
+	} {
+		_, err := keymerge.MergeUnstructured(opts, map[string]any{"_assert": section})
+		if !errors.Is(err, keymerge.ErrInvalidAssertion) {
+			t.Errorf("%v: expected ErrInvalidAssertion, got %v", section, err)
+		}
+	}
+}
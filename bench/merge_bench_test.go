@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/goccy/go-yaml"
+
 	"github.com/sam-fredrickson/keymerge"
 )
 
@@ -453,3 +455,34 @@ func BenchmarkUntyped_Large(b *testing.B) {
 		_, _ = keymerge.MergeUnstructured(opts, docs...)
 	}
 }
+
+// BenchmarkMergeTyped_Small merges Go values directly.
+func BenchmarkMergeTyped_Small(b *testing.B) {
+	merger, _ := keymerge.NewMerger[TypedConfig](keymerge.Options{}, nil, nil)
+	base := TypedConfig{Users: []User{{ID: 1, Name: "alice"}, {ID: 2, Name: "bob"}}}
+	overlay := TypedConfig{Users: []User{{ID: 1, Role: "admin"}}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = merger.MergeTyped(base, overlay)
+	}
+}
+
+// BenchmarkMergeTypedRoundTrip_Small merges the same Go values by marshaling
+// them, as programs holding typed configs had to before MergeTyped.
+func BenchmarkMergeTypedRoundTrip_Small(b *testing.B) {
+	merger, _ := keymerge.NewMerger[TypedConfig](keymerge.Options{}, yaml.Unmarshal, yaml.Marshal)
+	base := TypedConfig{Users: []User{{ID: 1, Name: "alice"}, {ID: 2, Name: "bob"}}}
+	overlay := TypedConfig{Users: []User{{ID: 1, Role: "admin"}}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		baseDoc, _ := yaml.Marshal(base)
+		overlayDoc, _ := yaml.Marshal(overlay)
+		merged, _ := merger.Merge(baseDoc, overlayDoc)
+		var result TypedConfig
+		_ = yaml.Unmarshal(merged, &result)
+	}
+}
@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/printer"
+	"github.com/goccy/go-yaml/token"
+)
+
+// minAnchorValues is how many scalar values a map or list must hold to be
+// worth an anchor; smaller ones are about as short as the alias.
+const minAnchorValues = 2
+
+// marshalAnchored marshals doc as YAML, like format.Marshal, but writes maps
+// and lists that occur more than once as an anchor at their first occurrence
+// and aliases to it at the others (see -yaml-anchors).
+func marshalAnchored(doc any) ([]byte, error) {
+	node, err := yaml.ValueToNode(encodeFor(doc, "yaml"))
+	if err != nil {
+		return nil, err
+	}
+	a := anchorer{
+		keys:    make(map[ast.Node]string),
+		counts:  make(map[string]int),
+		anchors: make(map[string]*pendingAnchor),
+		names:   make(map[string]bool),
+	}
+	a.count(node)
+	a.rewrite(node)
+	for _, anchor := range a.anchors {
+		// Repeats inside an aliased value are written only once
+		if anchor.node.Name == nil {
+			anchor.set(anchor.node.Value)
+		}
+	}
+	var p printer.Printer
+	return p.PrintNode(node), nil
+}
+
+// anchorer replaces repeated maps and lists in a YAML AST with aliases.
+type anchorer struct {
+	// keys describes the content of each map and list worth an anchor.
+	keys map[ast.Node]string
+	// counts is how often each map or list occurs, by content.
+	counts map[string]int
+	// anchors holds the first occurrence of each repeated value, by content.
+	anchors map[string]*pendingAnchor
+	// names holds the anchor names in use.
+	names map[string]bool
+}
+
+// pendingAnchor is the first occurrence of a repeated value, which is named
+// when the first alias to it is written.
+type pendingAnchor struct {
+	node *ast.AnchorNode
+	hint string
+	// set replaces the anchor in its parent, to unwrap it if never aliased.
+	set func(ast.Node)
+}
+
+// count records the maps and lists under node, returning node's content key
+// and how many scalar values it holds.
+func (a *anchorer) count(node ast.Node) (string, int) {
+	var b strings.Builder
+	values := 0
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		b.WriteString("{")
+		for _, item := range n.Values {
+			key, size := a.count(item.Value)
+			fmt.Fprintf(&b, "%s:%s,", item.Key.String(), key)
+			values += size
+		}
+		b.WriteString("}")
+	case *ast.SequenceNode:
+		b.WriteString("[")
+		for _, item := range n.Values {
+			key, size := a.count(item)
+			b.WriteString(key + ",")
+			values += size
+		}
+		b.WriteString("]")
+	default:
+		return fmt.Sprintf("%T(%s)", node, node.String()), 1
+	}
+	if values >= minAnchorValues {
+		a.keys[node] = b.String()
+		a.counts[b.String()]++
+	}
+	return b.String(), values
+}
+
+// rewrite replaces the values under node that occur more than once, anchoring
+// the first occurrence of each and aliasing the rest. Values are visited in
+// document order, so each anchor comes before its aliases.
+func (a *anchorer) rewrite(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		for _, item := range n.Values {
+			a.replace(item.Value, item.Key.String(), func(v ast.Node) { item.Value = v })
+		}
+	case *ast.SequenceNode:
+		for i, item := range n.Values {
+			a.replace(item, "item", func(v ast.Node) { n.Values[i] = v })
+		}
+	}
+}
+
+// replace calls set with an anchor or alias for value if it occurs more than
+// once, naming the anchor after hint. Otherwise it rewrites value's contents.
+func (a *anchorer) replace(value ast.Node, hint string, set func(ast.Node)) {
+	key, ok := a.keys[value]
+	if !ok || a.counts[key] < 2 {
+		a.rewrite(value)
+		return
+	}
+	pos := value.GetToken().Position
+	if anchor, ok := a.anchors[key]; ok {
+		if anchor.node.Name == nil {
+			name := a.name(anchor.hint)
+			anchor.node.Name = ast.String(token.New(name, name, anchor.node.Start.Position))
+		}
+		alias := ast.Alias(token.New("*", "*", pos))
+		alias.Value = ast.String(token.New(anchor.node.Name.String(), anchor.node.Name.String(), pos))
+		set(alias)
+		return
+	}
+	a.rewrite(value)
+	anchor := ast.Anchor(token.New("&", "&", pos))
+	anchor.Value = value
+	a.anchors[key] = &pendingAnchor{node: anchor, hint: hint, set: set}
+	set(anchor)
+}
+
+// unsafeAnchorChars matches runs of characters left out of anchor names, which
+// are kept to ones that need no thought in any YAML parser.
+var unsafeAnchorChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// name returns an unused anchor name based on hint.
+func (a *anchorer) name(hint string) string {
+	base := strings.Trim(unsafeAnchorChars.ReplaceAllString(hint, "_"), "_")
+	if base == "" {
+		base = "item"
+	}
+	name := base
+	for i := 2; a.names[name]; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	a.names[name] = true
+	return name
+}
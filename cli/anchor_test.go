@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestMarshalAnchored(t *testing.T) {
+	limits := map[string]any{"cpu": 1, "memory": "2Gi"}
+	doc := map[string]any{
+		"api":    map[string]any{"limits": limits, "ports": []any{80, 443}},
+		"web":    map[string]any{"limits": map[string]any{"cpu": 1, "memory": "2Gi"}, "ports": []any{80, 443}},
+		"jobs":   []any{map[string]any{"cpu": 1, "memory": "2Gi"}},
+		"single": map[string]any{"cpu": 2},
+		"other":  map[string]any{"cpu": 2},
+	}
+	encoded, err := marshalAnchored(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `api: &api
+  limits: &limits
+    cpu: 1
+    memory: 2Gi
+  ports:
+  - 80
+  - 443
+jobs:
+- *limits
+other:
+  cpu: 2
+single:
+  cpu: 2
+web: *api
+`
+	if string(encoded) != want {
+		t.Errorf("got\n%s\nwant\n%s", encoded, want)
+	}
+
+	var decoded map[string]any
+	if err := yaml.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	plain, _ := yaml.Marshal(doc)
+	var expected map[string]any
+	if err := yaml.Unmarshal(plain, &expected); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("anchored output decodes to %v, want %v", decoded, expected)
+	}
+}
+
+func TestMarshalAnchored_Names(t *testing.T) {
+	doc := []any{
+		map[string]any{"x.y z": []any{"a", "b"}, "ports": []any{1, 2}},
+		map[string]any{"x.y z": []any{"c", "d"}, "ports": []any{3, 4}},
+		map[string]any{"ports": []any{"a", "b"}, "x.y z": []any{1, 2}},
+		map[string]any{"ports": []any{"c", "d"}, "x.y z": []any{3, 4}},
+	}
+	encoded, err := marshalAnchored(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"&ports", "&x_y_z", "&ports2", "&x_y_z2", "*ports", "*x_y_z", "*ports2", "*x_y_z2"} {
+		if !strings.Contains(string(encoded), want) {
+			t.Errorf("expected %s in\n%s", want, encoded)
+		}
+	}
+}
+
+func TestRunYAMLAnchors(t *testing.T) {
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", "a:\n  env: [X, Y]\n",
+		"overlay.json", `{"b": {"env": ["X", "Y"]}}`,
+	)
+	var output bytes.Buffer
+	cfg := runConfig{files: files, yamlAnchors: true}
+	if err := cfg.run(context.Background(), &output); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "a: &a\n  env:\n  - X\n  - \"Y\"\nb: *a\n" {
+		t.Errorf("unexpected output %q", output.String())
+	}
+
+	cfg = runConfig{files: files, outputFormat: "json", yamlAnchors: true}
+	if err := cfg.run(context.Background(), &output); err == nil || !strings.Contains(err.Error(), "-yaml-anchors") {
+		t.Errorf("expected -yaml-anchors error for JSON output, got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// runCompareArtifact implements "cfgmerge compare-artifact", which merges files
+// and reports how the result differs from a previously merged artifact.
+func runCompareArtifact(_ context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("compare-artifact", flag.ContinueOnError)
+	var merge mergeFlags
+	var asJSON, asMarkdown bool
+	merge.register(fs)
+	fs.BoolVar(&asJSON, "json", false, "write the changelog as JSON")
+	fs.BoolVar(&asMarkdown, "markdown", false, "write the changelog as a Markdown list, e.g. for release notes")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: cfgmerge compare-artifact [flags] ARTIFACT FILE...\n\n")
+		fmt.Fprintf(out, "Merges the files left-to-right and reports the paths that were added,\n")
+		fmt.Fprintf(out, "removed, or changed compared to ARTIFACT, a previously merged result.\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if asJSON && asMarkdown {
+		return errors.New("-json and -markdown are mutually exclusive")
+	}
+	files := fs.Args()
+	if len(files) < 2 {
+		return errors.New("expected an artifact and at least one file to merge")
+	}
+
+	docs, _, err := loadDocuments(files, merge.yaml)
+	if err != nil {
+		return err
+	}
+
+	log, err := buildChangelog(merge.options(), docs[0], docs[1:])
+	if err != nil {
+		return err
+	}
+
+	return log.render(stdout, asJSON, asMarkdown)
+}
+
+// changelog is the result of "cfgmerge compare-artifact".
+type changelog struct {
+	Added   []changedValue `json:"added"`
+	Removed []changedValue `json:"removed"`
+	Changed []changedValue `json:"changed"`
+}
+
+// changedValue is a path whose value differs between the artifact and the merged result.
+type changedValue struct {
+	Path string `json:"path"`
+	// Old is the artifact's value (omitted for additions).
+	Old any `json:"old,omitempty"`
+	// New is the merged value (omitted for removals).
+	New any `json:"new,omitempty"`
+}
+
+// buildChangelog merges docs and compares the result against the artifact.
+func buildChangelog(opts keymerge.Options, artifact any, docs []any) (*changelog, error) {
+	merger, err := keymerge.NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := merger.MergeUnstructured(docs...)
+	if err != nil {
+		return nil, fmt.Errorf("merge failed: %w", err)
+	}
+	changes, err := merger.Compare(artifact, merged)
+	if err != nil {
+		return nil, err
+	}
+	return newChangelog(changes), nil
+}
+
+// newChangelog groups changes by kind.
+func newChangelog(changes []keymerge.Change) *changelog {
+	log := &changelog{Added: []changedValue{}, Removed: []changedValue{}, Changed: []changedValue{}}
+	for _, change := range changes {
+		value := changedValue{Path: change.Path, Old: change.Old, New: change.New}
+		switch change.Kind {
+		case keymerge.ChangeAdded:
+			log.Added = append(log.Added, value)
+		case keymerge.ChangeRemoved:
+			log.Removed = append(log.Removed, value)
+		default:
+			log.Changed = append(log.Changed, value)
+		}
+	}
+	return log
+}
+
+// render writes the changelog as JSON, Markdown, or text.
+func (c *changelog) render(w io.Writer, asJSON, asMarkdown bool) error {
+	switch {
+	case asJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	case asMarkdown:
+		return c.writeMarkdown(w)
+	default:
+		return c.write(w)
+	}
+}
+
+// changelogSection is a titled group of changes and how to render each one.
+type changelogSection struct {
+	title  string
+	values []changedValue
+	format func(changedValue) string
+}
+
+// write renders the changelog as human-readable text.
+func (c *changelog) write(w io.Writer) error {
+	sections := []changelogSection{
+		{"Added", c.Added, func(v changedValue) string { return fmt.Sprintf("  + %s: %v", v.Path, v.New) }},
+		{"Removed", c.Removed, func(v changedValue) string { return fmt.Sprintf("  - %s: %v", v.Path, v.Old) }},
+		{"Changed", c.Changed, func(v changedValue) string { return fmt.Sprintf("  ~ %s: %v -> %v", v.Path, v.Old, v.New) }},
+	}
+	for _, section := range sections {
+		if _, err := fmt.Fprintf(w, "%s (%d):\n", section.title, len(section.values)); err != nil {
+			return err
+		}
+		for _, v := range section.values {
+			if _, err := fmt.Fprintln(w, section.format(v)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeMarkdown renders the changelog as Markdown, omitting empty sections.
+func (c *changelog) writeMarkdown(w io.Writer) error {
+	if len(c.Added)+len(c.Removed)+len(c.Changed) == 0 {
+		_, err := fmt.Fprintln(w, "No configuration changes.")
+		return err
+	}
+	sections := []changelogSection{
+		{"Added", c.Added, func(v changedValue) string { return fmt.Sprintf("- `%s`: `%v`", v.Path, v.New) }},
+		{"Removed", c.Removed, func(v changedValue) string { return fmt.Sprintf("- `%s` (was `%v`)", v.Path, v.Old) }},
+		{"Changed", c.Changed, func(v changedValue) string { return fmt.Sprintf("- `%s`: `%v` → `%v`", v.Path, v.Old, v.New) }},
+	}
+	first := true
+	for _, section := range sections {
+		if len(section.values) == 0 {
+			continue
+		}
+		if !first {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		first = false
+		if _, err := fmt.Fprintf(w, "### %s\n\n", section.title); err != nil {
+			return err
+		}
+		for _, v := range section.values {
+			if _, err := fmt.Fprintln(w, section.format(v)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
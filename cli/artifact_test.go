@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func artifactFixture(t *testing.T) []string {
+	t.Helper()
+	return writeFiles(t, t.TempDir(),
+		"previous.yaml", "log: info\nservices:\n  - name: web\n    port: 80\n  - name: db\n    port: 5432\n",
+		"base.yaml", "log: info\nservices:\n  - name: web\n    port: 80\n",
+		"prod.yaml", "services:\n  - name: web\n    port: 8080\n  - name: cache\n    port: 6379\n",
+	)
+}
+
+func TestRunCompareArtifact(t *testing.T) {
+	files := artifactFixture(t)
+
+	var out bytes.Buffer
+	if err := runCompareArtifact(context.Background(), files, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := "Added (1):\n" +
+		"  + services[name=cache]: map[name:cache port:6379]\n" +
+		"Removed (1):\n" +
+		"  - services[name=db]: map[name:db port:5432]\n" +
+		"Changed (1):\n" +
+		"  ~ services[name=web].port: 80 -> 8080\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestRunCompareArtifact_Markdown(t *testing.T) {
+	files := artifactFixture(t)
+
+	var out bytes.Buffer
+	if err := runCompareArtifact(context.Background(), append([]string{"-markdown"}, files...), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := "### Added\n\n- `services[name=cache]`: `map[name:cache port:6379]`\n\n" +
+		"### Removed\n\n- `services[name=db]` (was `map[name:db port:5432]`)\n\n" +
+		"### Changed\n\n- `services[name=web].port`: `80` → `8080`\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := runCompareArtifact(context.Background(), []string{"-markdown", files[1], files[1]}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "No configuration changes.\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestRunCompareArtifact_JSON(t *testing.T) {
+	files := artifactFixture(t)
+
+	var out bytes.Buffer
+	if err := runCompareArtifact(context.Background(), append([]string{"-json"}, files...), &out); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string][]map[string]any
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]map[string]any{
+		"added":   {{"path": "services[name=cache]", "new": map[string]any{"name": "cache", "port": float64(6379)}}},
+		"removed": {{"path": "services[name=db]", "old": map[string]any{"name": "db", "port": float64(5432)}}},
+		"changed": {{"path": "services[name=web].port", "old": float64(80), "new": float64(8080)}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestRunCompareArtifact_Errors(t *testing.T) {
+	files := artifactFixture(t)
+	for _, args := range [][]string{
+		{files[0]},
+		{"-json", "-markdown", files[0], files[1]},
+		{files[0], "missing.yaml"},
+	} {
+		if err := runCompareArtifact(context.Background(), args, &bytes.Buffer{}); err == nil {
+			t.Errorf("%v: expected error", args)
+		}
+	}
+}
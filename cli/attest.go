@@ -0,0 +1,217 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const (
+	// statementType is the in-toto Statement version written by cfgmerge.
+	statementType = "https://in-toto.io/Statement/v1"
+	// provenancePredicateType is the SLSA provenance version of the predicate.
+	provenancePredicateType = "https://slsa.dev/provenance/v1"
+	// buildType identifies how to interpret the provenance's parameters.
+	buildType = "https://github.com/sam-fredrickson/keymerge/cmd/cfgmerge@v1"
+	// builderID identifies cfgmerge as the builder.
+	builderID = "https://github.com/sam-fredrickson/keymerge/cmd/cfgmerge"
+	// dssePayloadType is the DSSE payload type of an in-toto statement.
+	dssePayloadType = "application/vnd.in-toto+json"
+)
+
+// attestation configures writing a provenance attestation for the merged output.
+type attestation struct {
+	// path is where the attestation is written.
+	path string
+	// subject is the name recorded for the merged output, usually its file path.
+	subject string
+	// signer, if set, signs the statement and wraps it in a DSSE envelope.
+	signer crypto.Signer
+}
+
+// statement is an in-toto Statement with a SLSA provenance predicate.
+type statement struct {
+	Type          string               `json:"_type"`
+	Subject       []resourceDescriptor `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     provenance           `json:"predicate"`
+}
+
+// resourceDescriptor identifies an artifact by name and digest.
+type resourceDescriptor struct {
+	Name   string            `json:"name,omitempty"`
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest"`
+}
+
+type provenance struct {
+	BuildDefinition buildDefinition `json:"buildDefinition"`
+	RunDetails      runDetails      `json:"runDetails"`
+}
+
+type buildDefinition struct {
+	BuildType            string               `json:"buildType"`
+	ExternalParameters   map[string]any       `json:"externalParameters"`
+	ResolvedDependencies []resourceDescriptor `json:"resolvedDependencies"`
+}
+
+type runDetails struct {
+	Builder builder `json:"builder"`
+}
+
+type builder struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+// envelope is a DSSE envelope carrying a signed statement.
+type envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"`
+	Signatures  []signature `json:"signatures"`
+}
+
+type signature struct {
+	KeyID string `json:"keyid,omitempty"`
+	Sig   string `json:"sig"`
+}
+
+// write records the inputs, options, and output digest as an attestation.
+// The output is deterministic for the same inputs so attestations can be diffed;
+// in particular, no timestamps are recorded.
+func (a *attestation) write(inputs []input, params map[string]any, output []byte) error {
+	encoded, err := a.encode(inputs, params, output)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(a.path, encoded, 0o644); err != nil {
+		return fmt.Errorf("failed to write attestation: %w", err)
+	}
+	return nil
+}
+
+// encode returns the attestation written by write as indented JSON.
+func (a *attestation) encode(inputs []input, params map[string]any, output []byte) ([]byte, error) {
+	doc, err := a.document(inputs, params, output)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode attestation: %w", err)
+	}
+	return append(encoded, '\n'), nil
+}
+
+// document returns the attestation's statement, or its DSSE envelope if
+// a.signer is set.
+func (a *attestation) document(inputs []input, params map[string]any, output []byte) (any, error) {
+	stmt := statement{
+		Type:          statementType,
+		Subject:       []resourceDescriptor{{Name: a.subject, Digest: sha256Digest(output)}},
+		PredicateType: provenancePredicateType,
+		Predicate: provenance{
+			BuildDefinition: buildDefinition{
+				BuildType:            buildType,
+				ExternalParameters:   params,
+				ResolvedDependencies: make([]resourceDescriptor, len(inputs)),
+			},
+			RunDetails: runDetails{
+				Builder: builder{ID: builderID, Version: map[string]string{"cfgmerge": version}},
+			},
+		},
+	}
+	for i, in := range inputs {
+		stmt.Predicate.BuildDefinition.ResolvedDependencies[i] = resourceDescriptor{
+			URI:    in.file,
+			Digest: sha256Digest(in.contents),
+		}
+	}
+
+	payload, err := json.Marshal(stmt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode attestation: %w", err)
+	}
+
+	if a.signer != nil {
+		return signStatement(a.signer, payload)
+	}
+	return stmt, nil
+}
+
+func sha256Digest(data []byte) map[string]string {
+	sum := sha256.Sum256(data)
+	return map[string]string{"sha256": hex.EncodeToString(sum[:])}
+}
+
+// signStatement signs an encoded statement and wraps it in a DSSE envelope.
+// The key ID is the hex SHA-256 of the signer's PKIX-encoded public key.
+func signStatement(signer crypto.Signer, payload []byte) (*envelope, error) {
+	message := preAuthEncoding(dssePayloadType, payload)
+
+	var sig []byte
+	var err error
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		sig, err = signer.Sign(rand.Reader, message, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(message)
+		sig, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign attestation: %w", err)
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+	keyID := sha256.Sum256(publicKey)
+
+	return &envelope{
+		PayloadType: dssePayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures: []signature{{
+			KeyID: hex.EncodeToString(keyID[:]),
+			Sig:   base64.StdEncoding.EncodeToString(sig),
+		}},
+	}, nil
+}
+
+// preAuthEncoding returns the DSSE pre-authentication encoding (PAE) that is signed.
+func preAuthEncoding(payloadType string, payload []byte) []byte {
+	pae := "DSSEv1 " + strconv.Itoa(len(payloadType)) + " " + payloadType + " " + strconv.Itoa(len(payload)) + " "
+	return append([]byte(pae), payload...)
+}
+
+// loadSigningKey reads a PEM-encoded PKCS #8 private key (Ed25519, ECDSA, or RSA).
+func loadSigningKey(file string) (crypto.Signer, error) {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", file)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New(file + ": key cannot sign")
+	}
+	return signer, nil
+}
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeKey writes key as a PEM-encoded PKCS #8 file and returns its path.
+func writeKey(t *testing.T, key any) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func attestFixture(t *testing.T) (files []string, attestPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	files = writeFiles(t, dir, "base.yaml", "a: 1\n", "prod.json", `{"b": 2}`)
+	return files, filepath.Join(dir, "attestation.json")
+}
+
+func TestRunAttestation(t *testing.T) {
+	files, attestPath := attestFixture(t)
+
+	var output bytes.Buffer
+	cfg := runConfig{files: files, attest: &attestation{path: attestPath, subject: "config.yaml"}}
+	if err := cfg.run(context.Background(), &output); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := os.ReadFile(attestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stmt statement
+	if err := json.Unmarshal(contents, &stmt); err != nil {
+		t.Fatal(err)
+	}
+
+	if stmt.Type != statementType || stmt.PredicateType != provenancePredicateType {
+		t.Errorf("unexpected statement types: %s, %s", stmt.Type, stmt.PredicateType)
+	}
+	if stmt.Subject[0].Name != "config.yaml" || stmt.Subject[0].Digest["sha256"] != hexSHA256(output.Bytes()) {
+		t.Errorf("unexpected subject: %+v", stmt.Subject)
+	}
+	deps := stmt.Predicate.BuildDefinition.ResolvedDependencies
+	if len(deps) != 2 {
+		t.Fatalf("expected 2 dependencies, got %+v", deps)
+	}
+	for i, dep := range deps {
+		raw, _ := os.ReadFile(files[i])
+		if dep.URI != files[i] || dep.Digest["sha256"] != hexSHA256(raw) {
+			t.Errorf("unexpected dependency %d: %+v", i, dep)
+		}
+	}
+	params := stmt.Predicate.BuildDefinition.ExternalParameters
+	if params["scalar"] != "concat" || params["dupe"] != "unique" || params["format"] != "yaml" {
+		t.Errorf("unexpected parameters: %v", params)
+	}
+}
+
+func TestRunAttestation_Signed(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, key := range map[string]crypto.Signer{"ed25519": edKey, "ecdsa": ecKey} {
+		t.Run(name, func(t *testing.T) {
+			files, attestPath := attestFixture(t)
+			signer, err := loadSigningKey(writeKey(t, key))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := runConfig{files: files, attest: &attestation{path: attestPath, subject: "-", signer: signer}}
+			if err := cfg.run(context.Background(), &bytes.Buffer{}); err != nil {
+				t.Fatal(err)
+			}
+
+			contents, err := os.ReadFile(attestPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var env envelope
+			if err := json.Unmarshal(contents, &env); err != nil {
+				t.Fatal(err)
+			}
+			payload, err := base64.StdEncoding.DecodeString(env.Payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig, err := base64.StdEncoding.DecodeString(env.Signatures[0].Sig)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			message := preAuthEncoding(env.PayloadType, payload)
+			var valid bool
+			switch pub := signer.Public().(type) {
+			case ed25519.PublicKey:
+				valid = ed25519.Verify(pub, message, sig)
+			case *ecdsa.PublicKey:
+				digest := sha256.Sum256(message)
+				valid = ecdsa.VerifyASN1(pub, digest[:], sig)
+			}
+			if !valid {
+				t.Fatal("signature does not verify")
+			}
+
+			var stmt statement
+			if err := json.Unmarshal(payload, &stmt); err != nil || stmt.Type != statementType {
+				t.Fatalf("payload is not a statement: %v", err)
+			}
+		})
+	}
+}
+
+func TestPreAuthEncoding(t *testing.T) {
+	// Example from the DSSE protocol specification.
+	got := string(preAuthEncoding("http://example.com/HelloWorld", []byte("hello world")))
+	if got != "DSSEv1 29 http://example.com/HelloWorld 11 hello world" {
+		t.Fatalf("unexpected PAE: %q", got)
+	}
+}
+
+func TestLoadSigningKey_Errors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := loadSigningKey(filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("expected error for missing key")
+	}
+
+	notPEM := writeFiles(t, dir, "key.txt", "not a key")
+	if _, err := loadSigningKey(notPEM[0]); err == nil {
+		t.Error("expected error for non-PEM key")
+	}
+
+	badDER := filepath.Join(dir, "bad.pem")
+	_ = os.WriteFile(badDER, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("junk")}), 0o600)
+	if _, err := loadSigningKey(badDER); err == nil {
+		t.Error("expected error for invalid key data")
+	}
+
+	ecdhKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSigningKey(writeKey(t, ecdhKey)); err == nil {
+		t.Error("expected error for key that cannot sign")
+	}
+}
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// runBisect implements "cfgmerge bisect", which finds the file that introduced
+// a value into the merged result.
+func runBisect(_ context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("bisect", flag.ContinueOnError)
+	var merge mergeFlags
+	var path, value string
+	merge.register(fs)
+	fs.StringVar(&path, "path", "", `path to inspect, e.g. "services[name=web].port" (required)`)
+	fs.StringVar(&value, "value", "", "value to search for (defaults to the final merged value)")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: cfgmerge bisect -path PATH [-value VALUE] [flags] FILE...\n\n")
+		fmt.Fprintf(out, "Binary-searches the files (merged left-to-right) for the first one after which\n")
+		fmt.Fprintf(out, "PATH holds VALUE. Assumes that once the value appears it is not changed away\n")
+		fmt.Fprintf(out, "and back by later files.\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if path == "" {
+		return errors.New("-path is required")
+	}
+	files := fs.Args()
+	if len(files) == 0 {
+		return errors.New("no files to merge")
+	}
+	valueSet := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "value" {
+			valueSet = true
+		}
+	})
+
+	docs, _, err := loadDocuments(files, merge.yaml)
+	if err != nil {
+		return err
+	}
+
+	// Assertions describe the fully merged result, not the prefixes bisect merges.
+	opts := merge.options()
+	opts.AssertKey = ""
+
+	result, err := bisect(opts, docs, path, value, valueSet)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(stdout, "%s = %s\nintroduced by %s (document %d)\n",
+		path, result.value, files[result.index], result.index)
+	return err
+}
+
+// bisectResult identifies the document that introduced a value.
+type bisectResult struct {
+	index int    // index of the introducing document
+	value string // formatted value that was searched for
+}
+
+// bisect finds the smallest n such that merging docs[:n+1] yields want at path.
+// If wantSet is false, the value of the fully merged result is used.
+//
+// Values are compared by their [fmt.Sprint] formatting so that a value typed on
+// the command line matches numbers and booleans from any input format.
+func bisect(opts keymerge.Options, docs []any, path, want string, wantSet bool) (bisectResult, error) {
+	// holds reports whether the merge of docs[:n+1] has the wanted value at path.
+	holds := func(n int) (bool, error) {
+		merged, err := keymerge.MergeUnstructured(opts, docs[:n+1]...)
+		if err != nil {
+			return false, fmt.Errorf("merge failed while processing document %d: %w", n, err)
+		}
+		value, found, err := keymerge.Lookup(merged, path)
+		if err != nil {
+			return false, err
+		}
+		if !found {
+			return false, nil
+		}
+		if !wantSet {
+			want = fmt.Sprint(value)
+			wantSet = true
+		}
+		return fmt.Sprint(value) == want, nil
+	}
+
+	last := len(docs) - 1
+	found, err := holds(last)
+	if err != nil {
+		return bisectResult{}, err
+	}
+	if !found {
+		if !wantSet {
+			return bisectResult{}, fmt.Errorf("path %s not found in merged result", path)
+		}
+		return bisectResult{}, fmt.Errorf("merged result does not have %s = %s", path, want)
+	}
+
+	// Invariant: holds(hi) is true; holds(n) is false for every n < lo.
+	lo, hi := 0, last
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		ok, err := holds(mid)
+		if err != nil {
+			return bisectResult{}, err
+		}
+		if ok {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	return bisectResult{index: lo, value: want}, nil
+}
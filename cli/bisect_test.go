@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes each name/content pair into dir and returns the paths in order.
+func writeFiles(t *testing.T, dir string, files ...string) []string {
+	t.Helper()
+	var paths []string
+	for i := 0; i+1 < len(files); i += 2 {
+		path := filepath.Join(dir, files[i])
+		if err := os.WriteFile(path, []byte(files[i+1]), 0o600); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func bisectFixture(t *testing.T) []string {
+	t.Helper()
+	return writeFiles(t, t.TempDir(),
+		"base.yaml", "services:\n  - name: web\n    port: 80\nlog: info\n",
+		"team.yaml", "log: debug\n",
+		"prod.json", `{"services": [{"name": "web", "port": 8080}]}`,
+		"region.yaml", "services:\n  - name: web\n    replicas: 3\n",
+		"final.toml", "log = \"warn\"\n",
+	)
+}
+
+func TestBisect(t *testing.T) {
+	files := bisectFixture(t)
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "final value",
+			args:     []string{"-path", "services[name=web].port"},
+			expected: "introduced by " + files[2] + " (document 2)",
+		},
+		{
+			name:     "explicit value",
+			args:     []string{"-path", "services[name=web].port", "-value", "8080"},
+			expected: "introduced by " + files[2] + " (document 2)",
+		},
+		{
+			name:     "value from base",
+			args:     []string{"-path", "services[name=web].name"},
+			expected: "introduced by " + files[0] + " (document 0)",
+		},
+		{
+			name:     "value from last file",
+			args:     []string{"-path", "log", "-value", "warn"},
+			expected: "introduced by " + files[4] + " (document 4)",
+		},
+		{
+			name:     "added field",
+			args:     []string{"-path", "services[0].replicas"},
+			expected: "introduced by " + files[3] + " (document 3)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := runBisect(context.Background(), append(tt.args, files...), &out); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out.String(), tt.expected) {
+				t.Fatalf("expected output to contain %q, got:\n%s", tt.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestBisect_Errors(t *testing.T) {
+	files := bisectFixture(t)
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"missing path", files, "-path is required"},
+		{"no files", []string{"-path", "log"}, "no files"},
+		{"path not found", append([]string{"-path", "missing"}, files...), "not found"},
+		{"value never set", append([]string{"-path", "log", "-value", "trace"}, files...), "does not have"},
+		{"invalid path", append([]string{"-path", "log["}, files...), "invalid path"},
+		{"unreadable file", []string{"-path", "log", "missing.yaml"}, "failed to read"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := runBisect(context.Background(), tt.args, &out)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
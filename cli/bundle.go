@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// bundleFormat is the format of a bundle written by -bundle.
+type bundleFormat string
+
+var validBundleFormats = map[string]bundleFormat{
+	"":     bundleFormat(""),
+	"tar":  bundleFormat("tar"),
+	"yaml": bundleFormat("yaml"),
+}
+
+func (b *bundleFormat) String() string {
+	return string(*b)
+}
+
+func (b *bundleFormat) Set(value string) error {
+	value = strings.ToLower(value)
+	bundle, ok := validBundleFormats[value]
+	if !ok {
+		return fmt.Errorf("invalid bundle format %q", value)
+	}
+	*b = bundle
+	return nil
+}
+
+// Names of the artifacts of a bundle, besides the merged result.
+const (
+	bundleReport     = "report.json"
+	bundleProvenance = "provenance.json"
+	bundleDigests    = "SHA256SUMS"
+)
+
+// bundleEntry is an artifact of a bundle.
+type bundleEntry struct {
+	name string
+	// doc is the artifact's value, embedded in YAML bundles.
+	doc any
+	// contents is the artifact as a file, stored in tarballs and digested.
+	contents []byte
+}
+
+// bundleDocument is a document of a YAML bundle.
+type bundleDocument struct {
+	Name    string `json:"name"`
+	Content any    `json:"content"`
+}
+
+// bundleOutput encodes merged together with the report of the merge, its
+// provenance attestation, and the SHA-256 digests of the three as a bundle.
+// A tarball holds them as files; a YAML bundle holds a document for each,
+// naming the file it stands for. Either way, the digests are of the files,
+// and the merged result's file is what cfgmerge writes without -bundle. Nothing
+// records the time, so the same inputs always produce the same bundle.
+func (c *runConfig) bundleOutput(inputs []input, merged any, outputFormat format) ([]byte, error) {
+	encoded, err := c.marshal(merged, outputFormat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result as %s: %w", outputFormat, err)
+	}
+	name := "merged." + string(outputFormat)
+	entries := []bundleEntry{{name: name, doc: merged, contents: encoded}}
+
+	docs := make([]any, len(inputs))
+	for i, in := range inputs {
+		docs[i] = in.doc
+	}
+	rep, err := buildReport(c.merge.options(), c.files, docs, nil)
+	if err != nil {
+		return nil, err
+	}
+	if entries, err = appendJSONEntry(entries, bundleReport, rep); err != nil {
+		return nil, err
+	}
+
+	// c.attest only carries the -attest-key signer here
+	attest := &attestation{subject: name}
+	if c.attest != nil {
+		attest.signer = c.attest.signer
+	}
+	stmt, err := attest.document(inputs, c.merge.parameters(outputFormat), encoded)
+	if err != nil {
+		return nil, err
+	}
+	if entries, err = appendJSONEntry(entries, bundleProvenance, stmt); err != nil {
+		return nil, err
+	}
+
+	digests := make(map[string]string, len(entries))
+	var sums strings.Builder
+	for _, entry := range entries {
+		digests[entry.name] = sha256Digest(entry.contents)["sha256"]
+		fmt.Fprintf(&sums, "%s  %s\n", digests[entry.name], entry.name)
+	}
+	entries = append(entries, bundleEntry{name: bundleDigests, doc: digests, contents: []byte(sums.String())})
+
+	var bundle []byte
+	switch c.bundle {
+	case "tar":
+		bundle, err = tarBundle(entries)
+	case "yaml":
+		bundle, err = yamlBundle(entries)
+	default:
+		err = fmt.Errorf("invalid bundle format %q", c.bundle)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+	bundle, err = c.compression.compress(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress output: %w", err)
+	}
+	return bundle, nil
+}
+
+// appendJSONEntry appends doc to entries as a JSON file.
+func appendJSONEntry(entries []bundleEntry, name string, doc any) ([]bundleEntry, error) {
+	contents, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	return append(entries, bundleEntry{name: name, doc: doc, contents: append(contents, '\n')}), nil
+}
+
+// tarBundle writes entries as the files of a tarball.
+func tarBundle(entries []bundleEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:    entry.name,
+			Mode:    0o644,
+			Size:    int64(len(entry.contents)),
+			ModTime: time.Unix(0, 0),
+			Format:  tar.FormatPAX,
+		}
+		if err := w.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(entry.contents); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlBundle writes entries as a YAML stream of bundleDocuments.
+func yamlBundle(entries []bundleEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, entry := range entries {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		encoded, err := yaml.Marshal(bundleDocument{Name: entry.name, Content: encodeFor(entry.doc, "yaml")})
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(encoded)
+	}
+	return buf.Bytes(), nil
+}
+
+// checkBundleFlags checks that -bundle is used without the flags for other
+// kinds of output, which the bundle replaces or cannot hold.
+func checkBundleFlags(bundle bundleFormat, splitByKey bool, identity primaryKeys, attestPath string) error {
+	switch {
+	case bundle == "":
+		return nil
+	case splitByKey:
+		return errors.New("-bundle and -split-by-key are mutually exclusive")
+	case len(identity) > 0:
+		return errors.New("-bundle does not support -identity")
+	case attestPath != "":
+		return errors.New("-bundle includes the attestation, so it does not support -attest; use -attest-key to sign it")
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestRunBundle_Tar(t *testing.T) {
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", "name: demo\nport: 80\n",
+		"prod.yaml", "port: 8080\n",
+	)
+	var output bytes.Buffer
+	cfg := runConfig{files: files, bundle: "tar", compression: gzipCompression}
+	if err := cfg.run(context.Background(), &output); err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(&output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := make(map[string]string)
+	var names []string
+	r := tar.NewReader(gz)
+	for {
+		header, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+		contents[header.Name] = string(data)
+	}
+	if got := strings.Join(names, ","); got != "merged.yaml,report.json,provenance.json,SHA256SUMS" {
+		t.Fatalf("unexpected files %s", got)
+	}
+	if got := contents["merged.yaml"]; got != "name: demo\nport: 8080\n" {
+		t.Errorf("unexpected merged result %q", got)
+	}
+	if !strings.Contains(contents["report.json"], `"path": "port"`) {
+		t.Errorf("expected the report to list port as overridden, got %s", contents["report.json"])
+	}
+
+	var stmt statement
+	if err := json.Unmarshal([]byte(contents["provenance.json"]), &stmt); err != nil {
+		t.Fatal(err)
+	}
+	if subject := stmt.Subject[0]; subject.Name != "merged.yaml" || subject.Digest["sha256"] != sha256Digest([]byte(contents["merged.yaml"]))["sha256"] {
+		t.Errorf("unexpected subject %+v", subject)
+	}
+	var sums strings.Builder
+	for _, name := range names[:3] {
+		fmt.Fprintf(&sums, "%s  %s\n", sha256Digest([]byte(contents[name]))["sha256"], name)
+	}
+	if contents["SHA256SUMS"] != sums.String() {
+		t.Errorf("got digests %q, want %q", contents["SHA256SUMS"], sums.String())
+	}
+
+	// Bundles are reproducible.
+	cfg.compression = noCompression
+	var first, second bytes.Buffer
+	if err := cfg.run(context.Background(), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.run(context.Background(), &second); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Error("expected the same inputs to produce the same bundle")
+	}
+}
+
+func TestRunBundle_YAML(t *testing.T) {
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", "name: demo\nport: 80\n",
+		"prod.yaml", "port: 8080\n",
+	)
+	var output bytes.Buffer
+	cfg := runConfig{files: files, bundle: "yaml", outputFormat: "json"}
+	if err := cfg.run(context.Background(), &output); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := yaml.NewDecoder(&output)
+	var docs []bundleDocument
+	for {
+		var doc bundleDocument
+		if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, doc)
+	}
+	if len(docs) != 4 {
+		t.Fatalf("expected 4 documents, got %d", len(docs))
+	}
+	for i, name := range []string{"merged.json", "report.json", "provenance.json", "SHA256SUMS"} {
+		if docs[i].Name != name {
+			t.Errorf("document %d: got name %q, want %q", i, docs[i].Name, name)
+		}
+	}
+	merged, ok := docs[0].Content.(map[string]any)
+	if !ok || merged["name"] != "demo" || merged["port"] != uint64(8080) {
+		t.Errorf("unexpected merged result %#v", docs[0].Content)
+	}
+	encoded := "{\n  \"name\": \"demo\",\n  \"port\": 8080\n}"
+	digests, ok := docs[3].Content.(map[string]any)
+	if !ok || digests["merged.json"] != sha256Digest([]byte(encoded))["sha256"] {
+		t.Errorf("unexpected digests %#v", docs[3].Content)
+	}
+}
+
+func TestCheckBundleFlags(t *testing.T) {
+	for _, tt := range []struct {
+		split    bool
+		identity primaryKeys
+		attest   string
+	}{
+		{split: true},
+		{identity: primaryKeys{"kind"}},
+		{attest: "config.intoto.json"},
+	} {
+		if err := checkBundleFlags("tar", tt.split, tt.identity, tt.attest); err == nil {
+			t.Errorf("expected %+v to fail", tt)
+		}
+		if err := checkBundleFlags("", tt.split, tt.identity, tt.attest); err != nil {
+			t.Errorf("expected %+v without -bundle to pass, got %v", tt, err)
+		}
+	}
+	var bundle bundleFormat
+	if err := bundle.Set("zip"); err == nil {
+		t.Error("expected an unknown bundle format to fail")
+	}
+}
@@ -0,0 +1,935 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package cli implements the cfgmerge command, so that other Go programs can
+// run it in process with [Invoke] instead of executing the binary.
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// Config describes one invocation of cfgmerge.
+type Config struct {
+	// Args are the command-line arguments after the program name, as cfgmerge
+	// takes them, e.g. {"-out", "config.yaml", "base.yaml", "prod.yaml"} or
+	// {"report", "base.yaml", "prod.yaml"}.
+	Args []string
+	// Stdout receives the output if there is no -out flag, and the output of
+	// commands. Defaults to os.Stdout.
+	Stdout io.Writer
+	// Stderr receives usage messages, warnings, and progress reports. Defaults
+	// to os.Stderr.
+	Stderr io.Writer
+	// Program is the name shown in usage messages. Defaults to "cfgmerge".
+	Program string
+}
+
+// version is the cfgmerge version, set when building releases.
+var version = "dev"
+
+// commands maps subcommand names to their implementations. Each receives the
+// arguments following the subcommand name and writes its report to stdout.
+var commands = map[string]func(ctx context.Context, args []string, stdout io.Writer) error{
+	"bisect":           runBisect,
+	"compare-artifact": runCompareArtifact,
+	"conformance":      runConformance,
+	"daemon":           runDaemon,
+	"drift":            runDrift,
+	"export":           runExport,
+	"graph":            runGraph,
+	"import-kustomize": runImportKustomize,
+	"lsp":              runLSP,
+	"matrix":           runMatrix,
+	"minimize":         runMinimize,
+	"replay":           runReplay,
+	"report":           runReport,
+	"serve":            runServe,
+	"split":            runSplit,
+	"test":             runTest,
+	"tui":              runTUI,
+}
+
+// Invoke runs cfgmerge with config's arguments exactly as the command line
+// would: it parses the flags, detects the input formats, merges, and writes
+// the output, or runs the command named by the first argument. It returns an
+// error where cfgmerge would exit with a failure status, prefixed by the name
+// of the command if there is one, and flag.ErrHelp if -h was given. Canceling
+// ctx stops commands that run until interrupted, such as daemon, and queries
+// to an OPA server.
+//
+// The lsp and tui commands read the process's standard input.
+func Invoke(ctx context.Context, config Config) error {
+	if config.Stdout == nil {
+		config.Stdout = os.Stdout
+	}
+	if config.Stderr == nil {
+		config.Stderr = os.Stderr
+	}
+	if config.Program == "" {
+		config.Program = "cfgmerge"
+	}
+	program := config.Program
+	if len(config.Args) > 0 {
+		if command, ok := commands[config.Args[0]]; ok {
+			if err := command(ctx, config.Args[1:], config.Stdout); err != nil {
+				return fmt.Errorf("%s: %w", config.Args[0], err)
+			}
+			return nil
+		}
+	}
+
+	fs := flag.NewFlagSet(program, flag.ContinueOnError)
+	fs.SetOutput(config.Stderr)
+	cfg := runConfig{stderr: config.Stderr}
+	var outputPath, policyPath, rulesPath, schemaPath, k8sSchemaPath, opaURL, attestPath, attestKey string
+	var opaTimeout time.Duration
+	var showVersion, gzipped, zstded, splitByKey bool
+
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: %s [flags] FILE...\n", program)
+		fmt.Fprintf(out, "       %s COMMAND [flags] FILE...\n\n", program)
+		fmt.Fprintf(out, "Merges configuration files (YAML, JSON, TOML) with intelligent list handling.\n")
+		fmt.Fprintf(out, "Items in lists are matched by primary key fields and deep-merged.\n\n")
+		fmt.Fprintf(out, "Example:\n")
+		fmt.Fprintf(out, "  # merge env-specific overlay into common base\n")
+		fmt.Fprintf(out, "  %s -out config.yaml base.yaml env.yaml\n\n", program)
+		fmt.Fprintf(out, "  # merge general prod overlay and env-specific overlay into common base\n")
+		fmt.Fprintf(out, "  %s -out config.yaml base.yaml prod.yaml env.yaml\n\n", program)
+		fmt.Fprintf(out, "Commands:\n")
+		fmt.Fprintf(out, "  bisect            find which file introduced a merged value\n")
+		fmt.Fprintf(out, "  compare-artifact  list changes versus a previously merged artifact\n")
+		fmt.Fprintf(out, "  conformance       check an implementation against the conformance suite\n")
+		fmt.Fprintf(out, "  daemon            keep the outputs of a manifest of merges up to date\n")
+		fmt.Fprintf(out, "  drift             list differences between two overlay stacks on one base\n")
+		fmt.Fprintf(out, "  export            convert a base and overlays into kustomize patches or Helm values\n")
+		fmt.Fprintf(out, "  graph             draw which paths each file changes and where overlays conflict\n")
+		fmt.Fprintf(out, "  import-kustomize  convert a kustomization into overlays and a daemon manifest\n")
+		fmt.Fprintf(out, "  lsp               serve the Language Server Protocol for editing a merge stack\n")
+		fmt.Fprintf(out, "  matrix            show the merged value of paths in every environment\n")
+		fmt.Fprintf(out, "  minimize          rewrite an overlay as the smallest one with the same effect\n")
+		fmt.Fprintf(out, "  replay            check a corpus of recorded merges for regressions\n")
+		fmt.Fprintf(out, "  report            list overridden base values and redundant overlay values\n")
+		fmt.Fprintf(out, "  serve             serve a page previewing merges of pasted documents, with permalinks\n")
+		fmt.Fprintf(out, "  split             split an overlay into files by top-level key or path groups\n")
+		fmt.Fprintf(out, "  test              run YAML suites of merge cases, with JUnit XML output\n")
+		fmt.Fprintf(out, "  tui               browse the merged result with provenance and changes\n\n")
+		fmt.Fprintf(out, "Run '%s COMMAND -h' for command-specific flags.\n\n", program)
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+
+	cfg.merge.register(fs)
+	fs.StringVar(&outputPath, "out", "", "output file path (defaults to stdout)")
+	fs.Var(&cfg.labels, "label", `name FILE's document NAME in errors and progress reports instead of by its path, e.g. "prod overlay=prod.yaml" (repeatable)`)
+	fs.Var(&cfg.wrap, "wrap", "wrap FILE's document under KEY if the documents' roots differ in kind, e.g. items=list.json (repeatable)")
+	fs.Var(&cfg.identity, "identity", "comma-separated paths identifying documents, e.g. kind,metadata.name, to merge multi-document YAML streams")
+	fs.BoolVar(&splitByKey, "split-by-key", false, "write each top-level key to its own file in -out-dir instead of a single output")
+	fs.StringVar(&cfg.splitDir, "out-dir", "", "output directory for -split-by-key")
+	fs.Var(&cfg.outputFormat, "format", `output format [json, yaml, toml] (defaults to first file's format)`)
+	fs.Var(&cfg.newline, "newline", `line ending of the output [lf, crlf] (default "lf")`)
+	fs.Var(&cfg.encoding, "encoding", `character encoding of the output [utf-8, utf-8-bom, utf-16le, utf-16be] (default "utf-8")`)
+	fs.BoolVar(&gzipped, "gzip", false, "gzip-compress the output")
+	fs.BoolVar(&zstded, "zstd", false, "zstd-compress the output")
+	fs.BoolVar(&cfg.preserveOrder, "preserve-order", false, "keep the base's key order, with keys overlays add after it, in YAML and JSON output")
+	fs.BoolVar(&cfg.exactNumbers, "exact-numbers", false, "keep every digit of decimal numbers in YAML and JSON inputs, e.g. 0.1 or 19-digit quotas, instead of reading them as float64")
+	fs.BoolVar(&cfg.yamlAnchors, "yaml-anchors", false, "write maps and lists that occur more than once in YAML output as an anchor and aliases to it")
+	fs.StringVar(&rulesPath, "rules", "", "YAML, JSON, or TOML file of per-path merge rules, such as primary keys and list modes")
+	fs.StringVar(&schemaPath, "schema", "", "JSON Schema file whose x-keymerge- keywords give per-path merge rules")
+	fs.StringVar(&k8sSchemaPath, "k8s-schema", "", "Kubernetes OpenAPI file whose patch merge keys and list types give the merge rules of each manifest's kind")
+	fs.StringVar(&policyPath, "policy", "", "policy rules file to check the merged result against")
+	fs.StringVar(&opaURL, "opa", "", "OPA data API URL to query with the merged result, e.g. http://localhost:8181/v1/data/config/deny")
+	fs.DurationVar(&opaTimeout, "opa-timeout", 10*time.Second, "timeout for the OPA query")
+	fs.StringVar(&attestPath, "attest", "", "write an in-toto provenance attestation for the output to this file")
+	fs.StringVar(&attestKey, "attest-key", "", "PEM-encoded PKCS #8 private key to sign the attestation with")
+	fs.Var(&cfg.bundle, "bundle", "write the output with its report, provenance, and digests as a bundle [tar, yaml]")
+	fs.BoolVar(&cfg.sandbox, "sandbox", false, "limit the size and depth of inputs and the merge time, and reject YAML aliases, for merging untrusted files")
+	fs.IntVar(&cfg.progress, "progress", 0, "report progress to stderr every N merged values (0 disables)")
+	fs.BoolVar(&showVersion, "version", false, "show version and exit")
+	if err := fs.Parse(config.Args); err != nil {
+		return err
+	}
+
+	if showVersion {
+		_, err := fmt.Fprintln(config.Stdout, version)
+		return err
+	}
+
+	var err error
+	if cfg.compression, err = compressionFlags(gzipped, zstded); err != nil {
+		return err
+	}
+	if err := checkSplitFlags(splitByKey, cfg.splitDir, outputPath, attestPath); err != nil {
+		return err
+	}
+	if err := checkBundleFlags(cfg.bundle, splitByKey, cfg.identity, attestPath); err != nil {
+		return err
+	}
+
+	switch {
+	case rulesPath != "" && schemaPath != "":
+		return errors.New("-rules and -schema are mutually exclusive")
+	case rulesPath != "":
+		if cfg.rules, err = loadRules(rulesPath, keymerge.LoadRules); err != nil {
+			return err
+		}
+	case schemaPath != "":
+		if cfg.rules, err = loadRules(schemaPath, keymerge.LoadSchemaRules); err != nil {
+			return err
+		}
+	}
+	if k8sSchemaPath != "" {
+		if cfg.k8s, err = loadKubernetesSchema(k8sSchemaPath); err != nil {
+			return err
+		}
+	}
+	if policyPath != "" {
+		policy, err := loadPolicy(policyPath)
+		if err != nil {
+			return err
+		}
+		cfg.policy = policy
+	}
+	if opaURL != "" {
+		cfg.opa = newOPAClient(opaURL, opaTimeout)
+	}
+	if attestPath != "" || cfg.bundle != "" && attestKey != "" {
+		cfg.attest = &attestation{path: attestPath, subject: outputPath}
+		if outputPath == "" {
+			cfg.attest.subject = "-"
+		}
+		if attestKey != "" {
+			signer, err := loadSigningKey(attestKey)
+			if err != nil {
+				return err
+			}
+			cfg.attest.signer = signer
+		}
+	} else if attestKey != "" {
+		return errors.New("-attest-key requires -attest or -bundle")
+	}
+
+	cfg.files = fs.Args()
+	var output io.Writer
+	if outputPath != "" {
+		f, err := os.Create(outputPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		output = f
+	} else {
+		output = config.Stdout
+	}
+
+	return cfg.run(ctx, output)
+}
+
+// Run merges files and writes the result to output in outputFormat
+// (defaulting to the first file's format).
+func Run(
+	keys primaryKeys,
+	scalar scalarMode,
+	dupe dupeMode,
+	deleteMarker string,
+	files []string,
+	outputFormat format,
+	output io.Writer,
+) error {
+	cfg := runConfig{
+		merge:        mergeFlags{keys: keys, scalar: scalar, dupe: dupe, deleteMarker: deleteMarker},
+		files:        files,
+		outputFormat: outputFormat,
+	}
+	return cfg.run(context.Background(), output)
+}
+
+// runConfig holds everything the default merge command needs.
+type runConfig struct {
+	merge        mergeFlags
+	files        []string
+	outputFormat format
+	// identity, if set, merges YAML streams, matching documents by these paths.
+	identity primaryKeys
+	// wrap puts documents under keys when the documents' roots differ in kind.
+	wrap wrapFlags
+	// labels names documents in errors and progress reports by file.
+	labels labelFlags
+	// preserveOrder keeps the key order of the inputs in the output.
+	preserveOrder bool
+	// exactNumbers reads decimal numbers as json.Number instead of float64.
+	exactNumbers bool
+	// yamlAnchors writes repeated maps and lists in YAML output as aliases.
+	yamlAnchors bool
+	// newline and encoding are the line ending and character encoding of the output.
+	newline  newline
+	encoding textEncoding
+	// compression compresses the output.
+	compression compression
+	// splitDir, if set, receives a file for each top-level key instead of the output.
+	splitDir string
+	// rules, if set, holds per-path merge directives from a -rules file.
+	rules keymerge.MetadataTree
+	// k8s, if set, gives the merge rules of Kubernetes manifests by their kind,
+	// taking precedence over rules.
+	k8s *keymerge.KubernetesSchema
+	// policy, if set, is checked against the merged result before it is written.
+	policy *keymerge.Policy
+	// opa, if set, is queried with the merged result before it is written.
+	opa *opaClient
+	// attest, if set, records the provenance of the output.
+	attest *attestation
+	// bundle, if set, writes the output with its report, provenance, and digests.
+	bundle bundleFormat
+	// sandbox applies keymerge.SandboxLimits and rejects risky inputs before parsing them.
+	sandbox bool
+	// progress, if positive, is how many merged values pass between progress reports.
+	progress int
+	// stderr receives warnings and progress reports; nil discards them.
+	stderr io.Writer
+}
+
+func (c *runConfig) run(ctx context.Context, output io.Writer) error {
+	if len(c.files) == 0 {
+		return fmt.Errorf("no files to merge")
+	}
+	opts := c.merge.options()
+
+	limits := keymerge.Limits{}
+	if c.sandbox {
+		limits = keymerge.SandboxLimits()
+		if err := checkUntrusted(c.files, limits.MaxBytes); err != nil {
+			return err
+		}
+	}
+
+	var inputs []input
+	var docs []any
+	var streams [][]any
+	var err error
+	if len(c.identity) > 0 && len(c.wrap) > 0 {
+		return fmt.Errorf("-wrap does not support -identity")
+	}
+	if c.exactNumbers && (len(c.identity) > 0 || c.preserveOrder) {
+		return fmt.Errorf("-exact-numbers does not support -identity or -preserve-order")
+	}
+	if len(c.identity) > 0 {
+		if inputs, streams, err = readStreams(c.files, c.merge.yaml, c.preserveOrder); err != nil {
+			return err
+		}
+	} else {
+		if inputs, err = readInputs(c.files, c.merge.yaml); err != nil {
+			return err
+		}
+		docs = make([]any, len(inputs))
+		for i, in := range inputs {
+			docs[i] = in.doc
+			if c.preserveOrder {
+				if docs[i], err = unmarshalOrdered(in, c.merge.yaml); err != nil {
+					return fmt.Errorf("failed to read %s: %w", in.file, err)
+				}
+			}
+			if c.exactNumbers {
+				if docs[i], err = unmarshalExact(in, c.merge.yaml); err != nil {
+					return fmt.Errorf("failed to read %s: %w", in.file, err)
+				}
+			}
+		}
+		if err := c.wrapRoots(inputs, docs); err != nil {
+			return err
+		}
+	}
+	outputFormat := c.outputFormat
+	if outputFormat == "" {
+		outputFormat = inputs[0].format
+	}
+	if len(c.identity) > 0 && (outputFormat != "yaml" || c.splitDir != "") {
+		return fmt.Errorf("-identity writes a YAML stream, so it requires YAML output without -split-by-key")
+	}
+	if c.yamlAnchors && outputFormat != "yaml" {
+		return fmt.Errorf("-yaml-anchors requires YAML output")
+	}
+
+	merger, err := keymerge.NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		return err
+	}
+	merger.SetMetadata(c.rules)
+	merger.SetDocumentNames(c.labels.names(c.files)...)
+	if c.k8s != nil {
+		merger.SetStreamMetadata(c.k8s.MetadataFor)
+		if len(docs) > 0 {
+			if tree := c.k8s.MetadataFor(docs[0]); !tree.IsZero() {
+				merger.SetMetadata(tree)
+			}
+		}
+	}
+	if err := merger.SetLimits(limits); err != nil {
+		return err
+	}
+	if c.progress > 0 && c.stderr != nil {
+		merger.SetProgress(c.progress, func(p keymerge.Progress) {
+			at := ""
+			if len(p.Path) > 0 {
+				at = " at " + strings.Join(p.Path, ".")
+			}
+			_, _ = fmt.Fprintf(c.stderr, "progress: merged %d values, %s%s\n", p.Values, p.DocName, at)
+		})
+	}
+	// merged holds one document, or any number when merging streams
+	var merged []any
+	if len(c.identity) > 0 {
+		merged, err = merger.MergeStreams(c.identity, streams...)
+	} else {
+		var doc any
+		doc, err = merger.MergeUnstructured(docs...)
+		merged = []any{doc}
+	}
+	if err != nil {
+		return fmt.Errorf("merge failed while processing files %v: %w", c.files, err)
+	}
+	// Checks read plain maps; only the output needs the key order
+	plain := make([]any, len(merged))
+	for i, doc := range merged {
+		plain[i] = keymerge.Unordered(doc)
+	}
+
+	for _, doc := range plain {
+		if c.policy != nil {
+			if err := c.checkPolicy(doc); err != nil {
+				return err
+			}
+		}
+		if c.opa != nil {
+			if err := c.opa.check(ctx, doc); err != nil {
+				return err
+			}
+		}
+	}
+
+	var marshaled []byte
+	if c.splitDir != "" {
+		if err := c.writeSplit(merged[0], outputFormat); err != nil {
+			return err
+		}
+	} else if c.bundle != "" {
+		bundle, err := c.bundleOutput(inputs, merged[0], outputFormat)
+		if err != nil {
+			return err
+		}
+		if _, err = output.Write(bundle); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	} else {
+		if marshaled, err = c.encode(merged, outputFormat); err != nil {
+			return err
+		}
+		if _, err = output.Write(marshaled); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+	var paths []string
+	for _, doc := range plain {
+		paths = append(paths, merger.UnresolvedConflicts(doc)...)
+	}
+	if len(paths) > 0 {
+		return fmt.Errorf("%d conflict(s) marked under %q at %s; resolve them and merge again",
+			len(paths), conflictMarkerKey, strings.Join(paths, ", "))
+	}
+
+	if c.attest != nil && c.bundle == "" {
+		return c.attest.write(inputs, c.merge.parameters(outputFormat), marshaled)
+	}
+	return nil
+}
+
+// encode marshals docs in outputFormat, separated as a YAML stream if there
+// are several, converts them to the output's line ending and encoding, and
+// compresses them.
+func (c *runConfig) encode(docs []any, outputFormat format) ([]byte, error) {
+	var marshaled []byte
+	for i, doc := range docs {
+		encoded, err := c.marshal(doc, outputFormat)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal result as %s: %w", outputFormat, err)
+		}
+		if i > 0 {
+			marshaled = append(marshaled, "---\n"...)
+		}
+		marshaled = append(marshaled, encoded...)
+	}
+	marshaled = encodeText(marshaled, c.newline, c.encoding)
+	marshaled, err := c.compression.compress(marshaled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress output: %w", err)
+	}
+	return marshaled, nil
+}
+
+// marshal marshals doc in outputFormat, with anchors for repeated values if
+// -yaml-anchors is set.
+func (c *runConfig) marshal(doc any, outputFormat format) ([]byte, error) {
+	if c.yamlAnchors && outputFormat == "yaml" {
+		return marshalAnchored(doc)
+	}
+	return outputFormat.Marshal(doc)
+}
+
+// checkPolicy reports policy warnings to stderr and fails on policy errors.
+func (c *runConfig) checkPolicy(merged any) error {
+	if c.stderr != nil {
+		for _, v := range c.policy.Check(merged) {
+			if v.Severity == keymerge.SeverityWarning {
+				_, _ = fmt.Fprintln(c.stderr, v)
+			}
+		}
+	}
+	return c.policy.Enforce(merged)
+}
+
+// loadPolicy reads and parses a policy rules file.
+func loadPolicy(file string) (*keymerge.Policy, error) {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+	policy, err := keymerge.ParsePolicy(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return policy, nil
+}
+
+// loadRules reads a rules file for -rules, or a schema for -schema, with load,
+// in the format given by its extension.
+func loadRules(
+	file string,
+	load func(io.Reader, func([]byte, any) error) (*keymerge.RuleSet, error),
+) (keymerge.MetadataTree, error) {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return keymerge.MetadataTree{}, fmt.Errorf("failed to read rules: %w", err)
+	}
+	rules, err := load(bytes.NewReader(contents), func(data []byte, out any) error {
+		_, err := unmarshalBytes(file, data, out, "")
+		return err
+	})
+	if err != nil {
+		return keymerge.MetadataTree{}, fmt.Errorf("%s: %w", file, err)
+	}
+	return rules.Build()
+}
+
+// loadKubernetesSchema reads a Kubernetes OpenAPI document for -k8s-schema, in
+// the format given by its extension.
+func loadKubernetesSchema(file string) (*keymerge.KubernetesSchema, error) {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Kubernetes schema: %w", err)
+	}
+	schema, err := keymerge.LoadKubernetesSchema(bytes.NewReader(contents), func(data []byte, out any) error {
+		_, err := unmarshalBytes(file, data, out, "")
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return schema, nil
+}
+
+// mergeFlags holds the flags shared by every command that merges documents.
+type mergeFlags struct {
+	keys         primaryKeys
+	scalar       scalarMode
+	dupe         dupeMode
+	preset       preset
+	deleteMarker string
+	moveMarker   string
+	assertKey    string
+	conflicts    conflictMode
+	nulls        nullMode
+	yaml         yamlVersion
+}
+
+// register defines the merge flags on fs.
+func (f *mergeFlags) register(fs *flag.FlagSet) {
+	fs.Var(&f.keys, "keys", `comma-separated list of primary keys (default "name,id")`)
+	fs.Var(&f.scalar, "scalar", `scalar list mode [concat, dedup, replace] (default "concat")`)
+	fs.Var(&f.dupe, "dupe", `list dupe mode [unique, consolidate] (default "unique")`)
+	fs.Var(&f.preset, "preset", `primary keys and list modes for a kind of document [kubernetes, compose, github-actions, feature-flags] (default "none")`)
+	fs.StringVar(&f.deleteMarker, "delete-marker", "_delete", "deletion marker key")
+	fs.StringVar(&f.moveMarker, "move-marker", "_move_to", "key of list items holding the path of a list to move them to (empty disables)")
+	fs.StringVar(&f.assertKey, "assert-key", "_assert", "top-level key of assertions about the merged result (empty disables)")
+	fs.Var(&f.conflicts, "conflicts", `what to do when an overlay replaces a scalar value [override, strict, mark] (default "override")`)
+	fs.Var(&f.nulls, "nulls", `what an overlay's null value does [keep, delete] (default "keep")`)
+	fs.Var(&f.yaml, "yaml-version", `read yes/no/on/off and numbers like 0777 in YAML files as YAML [1.1, 1.2] does (default: yes/no strings, 0777 octal)`)
+}
+
+// options converts the flags to merge options, applying the default primary keys
+// unless a preset supplies them.
+func (f *mergeFlags) options() keymerge.Options {
+	keys := f.keys.Keys()
+	if len(keys) == 0 && f.preset.Preset() == keymerge.PresetNone {
+		keys = []string{"name", "id"}
+	}
+	opts := keymerge.Options{
+		Preset:          f.preset.Preset(),
+		PrimaryKeyNames: keys,
+		DeleteMarkerKey: f.deleteMarker,
+		MoveMarkerKey:   f.moveMarker,
+		ScalarMode:      f.scalar.Mode(),
+		DupeMode:        f.dupe.Mode(),
+		AssertKey:       f.assertKey,
+		ConflictMode:    f.conflicts.Mode(),
+		NullMode:        f.nulls.Mode(),
+	}
+	if opts.ConflictMode == keymerge.ConflictMark {
+		opts.ConflictMarkerKey = conflictMarkerKey
+	}
+	return opts
+}
+
+// conflictMarkerKey is the field name of the conflict markers written by -conflicts mark.
+const conflictMarkerKey = "_conflict"
+
+// parameters describes the merge options for provenance records,
+// using the same names and values as the command-line flags.
+func (f *mergeFlags) parameters(outputFormat format) map[string]any {
+	opts := f.options()
+	scalar := map[keymerge.ScalarMode]string{
+		keymerge.ScalarConcat:  "concat",
+		keymerge.ScalarDedup:   "dedup",
+		keymerge.ScalarReplace: "replace",
+	}[opts.ScalarMode]
+	dupe := map[keymerge.DupeMode]string{
+		keymerge.DupeUnique:      "unique",
+		keymerge.DupeConsolidate: "consolidate",
+	}[opts.DupeMode]
+	conflicts := map[keymerge.ConflictMode]string{
+		keymerge.ConflictOverride: "override",
+		keymerge.ConflictStrict:   "strict",
+		keymerge.ConflictMark:     "mark",
+	}[opts.ConflictMode]
+	parameters := map[string]any{
+		"keys":          opts.PrimaryKeyNames,
+		"scalar":        scalar,
+		"dupe":          dupe,
+		"delete-marker": opts.DeleteMarkerKey,
+		"move-marker":   opts.MoveMarkerKey,
+		"assert-key":    opts.AssertKey,
+		"conflicts":     conflicts,
+		"format":        string(outputFormat),
+	}
+	if opts.NullMode == keymerge.NullDelete {
+		parameters["nulls"] = "delete"
+	}
+	if f.yaml != "" {
+		parameters["yaml-version"] = string(f.yaml)
+	}
+	if opts.Preset != keymerge.PresetNone {
+		name, _ := opts.Preset.MarshalText()
+		parameters["preset"] = string(name)
+	}
+	return parameters
+}
+
+// loadDocuments reads and unmarshals every file, returning the documents and
+// the format of the first file.
+func loadDocuments(files []string, version yamlVersion) ([]any, format, error) {
+	inputs, err := readInputs(files, version)
+	if err != nil {
+		return nil, "", err
+	}
+	docs := make([]any, len(inputs))
+	for i, in := range inputs {
+		docs[i] = in.doc
+	}
+	return docs, inputs[0].format, nil
+}
+
+// input is a file that was read and unmarshaled.
+type input struct {
+	file     string
+	contents []byte
+	format   format
+	doc      any
+}
+
+// readInputs reads and unmarshals every file, keeping the raw contents so that
+// callers can record exactly what was merged. files must not be empty.
+func readInputs(files []string, version yamlVersion) ([]input, error) {
+	inputs := make([]input, 0, len(files))
+	for _, file := range files {
+		in := input{file: file}
+		var err error
+		in.contents, err = os.ReadFile(file)
+		if err == nil {
+			in.format, err = unmarshalBytes(file, in.contents, &in.doc, version)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		inputs = append(inputs, in)
+	}
+	return inputs, nil
+}
+
+// unmarshalBytes unmarshals contents in the format given by the file's extension.
+// Compressed contents are decompressed first, see uncompressedName, and text
+// is decoded as by decodeText.
+func unmarshalBytes(file string, contents []byte, out any, version yamlVersion) (format, error) {
+	var f format
+
+	extension := filepath.Ext(uncompressedName(file))
+	extension = strings.ToLower(extension)
+	var unmarshal func([]byte, any) error
+	switch extension {
+	case ".yaml", ".yml":
+		f = validFormats["yaml"]
+		unmarshal = func(contents []byte, out any) error {
+			return unmarshalYAML(contents, out, version)
+		}
+	case ".json":
+		f = validFormats["json"]
+		unmarshal = json.Unmarshal
+	case ".toml":
+		f = validFormats["toml"]
+		unmarshal = toml.Unmarshal
+	}
+	if unmarshal == nil {
+		return f, fmt.Errorf("unsupported file format: %s", extension)
+	}
+
+	contents, err := readContents(contents)
+	if err != nil {
+		return f, err
+	}
+	err = unmarshal(contents, out)
+	if err != nil {
+		return f, err
+	}
+
+	return f, nil
+}
+
+type primaryKeys []string
+
+func (c *primaryKeys) String() string {
+	return strings.Join(*c, ",")
+}
+
+func (c *primaryKeys) Set(value string) error {
+	*c = append(*c, strings.Split(value, ",")...)
+	return nil
+}
+
+func (c *primaryKeys) Keys() []string {
+	return *c
+}
+
+type scalarMode keymerge.ScalarMode
+
+func (s *scalarMode) String() string {
+	mode := keymerge.ScalarMode(*s)
+	return mode.String()
+}
+
+func (s *scalarMode) Set(value string) error {
+	mode, err := keymerge.ParseScalarMode(value)
+	if err != nil {
+		return err
+	}
+	*s = scalarMode(mode)
+	return nil
+}
+
+func (s *scalarMode) Mode() keymerge.ScalarMode {
+	return keymerge.ScalarMode(*s)
+}
+
+// labelFlags maps files to the names -label gives their documents.
+type labelFlags map[string]string
+
+func (l *labelFlags) String() string {
+	specs := make([]string, 0, len(*l))
+	for _, file := range slices.Sorted(maps.Keys(*l)) {
+		specs = append(specs, (*l)[file]+"="+file)
+	}
+	return strings.Join(specs, ",")
+}
+
+func (l *labelFlags) Set(value string) error {
+	name, file, ok := strings.Cut(value, "=")
+	if !ok || name == "" || file == "" {
+		return fmt.Errorf("invalid label %q (must be NAME=FILE)", value)
+	}
+	if *l == nil {
+		*l = make(labelFlags)
+	}
+	(*l)[file] = name
+	return nil
+}
+
+// names returns the name of each file's document: its label, or its path.
+func (l labelFlags) names(files []string) []string {
+	names := make([]string, len(files))
+	for i, file := range files {
+		if names[i] = l[file]; names[i] == "" {
+			names[i] = file
+		}
+	}
+	return names
+}
+
+type preset keymerge.Preset
+
+func (p *preset) String() string {
+	name, _ := keymerge.Preset(*p).MarshalText()
+	return string(name)
+}
+
+func (p *preset) Set(value string) error {
+	parsed, err := keymerge.ParsePreset(value)
+	if err != nil {
+		return err
+	}
+	*p = preset(parsed)
+	return nil
+}
+
+func (p *preset) Preset() keymerge.Preset {
+	return keymerge.Preset(*p)
+}
+
+type conflictMode keymerge.ConflictMode
+
+func (c *conflictMode) String() string {
+	mode := keymerge.ConflictMode(*c)
+	return mode.String()
+}
+
+func (c *conflictMode) Set(value string) error {
+	var mode keymerge.ConflictMode
+	switch value {
+	case "", "override":
+		break
+	case "strict":
+		mode = keymerge.ConflictStrict
+	case "mark":
+		mode = keymerge.ConflictMark
+	default:
+		return fmt.Errorf("conflict mode %q is invalid", value)
+	}
+	*c = conflictMode(mode)
+	return nil
+}
+
+func (c *conflictMode) Mode() keymerge.ConflictMode {
+	return keymerge.ConflictMode(*c)
+}
+
+type nullMode keymerge.NullMode
+
+func (n *nullMode) String() string {
+	mode := keymerge.NullMode(*n)
+	return mode.String()
+}
+
+func (n *nullMode) Set(value string) error {
+	var mode keymerge.NullMode
+	switch value {
+	case "", "keep":
+		break
+	case "delete":
+		mode = keymerge.NullDelete
+	default:
+		return fmt.Errorf("null mode %q is invalid", value)
+	}
+	*n = nullMode(mode)
+	return nil
+}
+
+func (n *nullMode) Mode() keymerge.NullMode {
+	return keymerge.NullMode(*n)
+}
+
+type dupeMode keymerge.DupeMode
+
+func (d *dupeMode) String() string {
+	mode := keymerge.DupeMode(*d)
+	return mode.String()
+}
+
+func (d *dupeMode) Set(value string) error {
+	mode, err := keymerge.ParseDupeMode(value)
+	if err != nil {
+		return err
+	}
+	*d = dupeMode(mode)
+	return nil
+}
+
+func (d *dupeMode) Mode() keymerge.DupeMode {
+	return keymerge.DupeMode(*d)
+}
+
+type format string
+
+var validFormats = map[string]format{
+	"":     format(""),
+	"json": format("json"),
+	"yaml": format("yaml"),
+	"toml": format("toml"),
+}
+
+func (f *format) String() string {
+	return string(*f)
+}
+
+func (f *format) Set(value string) error {
+	value = strings.ToLower(value)
+	format, ok := validFormats[value]
+	if !ok {
+		return fmt.Errorf("invalid format %q", value)
+	}
+	*f = format
+	return nil
+}
+
+// tomlRootKey holds a result that is not a map, such as a list of rules, in
+// TOML output, since a TOML document is always a table.
+const tomlRootKey = "items"
+
+func (f *format) Marshal(doc any) ([]byte, error) {
+	doc = encodeFor(doc, *f)
+	switch *f {
+	case "json":
+		return json.MarshalIndent(doc, "", "  ")
+	case "yaml":
+		return yaml.Marshal(doc)
+	case "toml":
+		if _, ok := doc.(map[string]any); !ok && doc != nil {
+			doc = map[string]any{tomlRootKey: doc}
+		}
+		return toml.Marshal(doc)
+	default:
+		return nil, fmt.Errorf("invalid format %q", *f)
+	}
+}
@@ -0,0 +1,688 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+//go:embed testfiles
+var testfiles embed.FS
+
+// writeEmbeddedFile creates a temporary file with content from the embedded filesystem.
+func writeEmbeddedFile(t *testing.T, tmpDir, embeddedPath string) string {
+	t.Helper()
+	content, err := fs.ReadFile(testfiles, embeddedPath)
+	if err != nil {
+		t.Fatalf("failed to read embedded file %s: %v", embeddedPath, err)
+	}
+
+	filename := filepath.Base(embeddedPath)
+	tmpFile := filepath.Join(tmpDir, filename)
+	if err := os.WriteFile(tmpFile, content, 0o600); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+	return tmpFile
+}
+
+func TestInvoke(t *testing.T) {
+	dir := t.TempDir()
+	files := writeFiles(t, dir, "base.yaml", "port: 80\nhost: example.com\n", "overlay.json", `{"host": "example.org"}`)
+
+	var stdout, stderr bytes.Buffer
+	config := Config{Args: append([]string{"-format", "json"}, files...), Stdout: &stdout, Stderr: &stderr}
+	if err := Invoke(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "{\n  \"host\": \"example.org\",\n  \"port\": 80\n}" {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+
+	// -out writes to the file instead
+	out := filepath.Join(dir, "out.yaml")
+	stdout.Reset()
+	config.Args = append([]string{"-out", out}, files...)
+	if err := Invoke(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if written, _ := os.ReadFile(out); string(written) != "host: example.org\nport: 80\n" || stdout.Len() > 0 {
+		t.Errorf("unexpected output file %q, stdout %q", written, stdout.String())
+	}
+
+	// Commands' errors name the command
+	config.Args = []string{"minimize", files[0]}
+	if err := Invoke(context.Background(), config); err == nil || !strings.HasPrefix(err.Error(), "minimize: ") {
+		t.Errorf("expected minimize error, got %v", err)
+	}
+
+	stderr.Reset()
+	config.Args, config.Program = []string{"-h"}, "mytool"
+	if err := Invoke(context.Background(), config); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("expected flag.ErrHelp, got %v", err)
+	}
+	if !strings.HasPrefix(stderr.String(), "usage: mytool [flags] FILE...") {
+		t.Errorf("expected usage on stderr, got %q", stderr.String())
+	}
+
+	config.Args = []string{"-no-such-flag"}
+	if err := Invoke(context.Background(), config); err == nil {
+		t.Error("expected error for unknown flag")
+	}
+}
+
+func TestInvoke_Canceled(t *testing.T) {
+	dir := t.TempDir()
+	files := writeFiles(t, dir,
+		"base.yaml", "port: 80\n",
+		"groups.yaml", "groups:\n  - name: web\n    inputs: [base.yaml]\n    output: web.yaml\n",
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	config := Config{Args: []string{"daemon", "-manifest", files[1]}, Stdout: &bytes.Buffer{}}
+	if err := Invoke(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	if written, _ := os.ReadFile(filepath.Join(dir, "web.yaml")); string(written) != "port: 80\n" {
+		t.Errorf("expected the daemon to merge once before stopping, got %q", written)
+	}
+}
+
+func TestRunMergeFormats(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "cfgmerge-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Write all embedded files to temp directory
+	baseYAML := writeEmbeddedFile(t, tmpDir, "testfiles/base.yaml")
+	baseJSON := writeEmbeddedFile(t, tmpDir, "testfiles/base.json")
+	baseTOML := writeEmbeddedFile(t, tmpDir, "testfiles/base.toml")
+
+	overlayYAML := writeEmbeddedFile(t, tmpDir, "testfiles/overlay.yaml")
+	overlayJSON := writeEmbeddedFile(t, tmpDir, "testfiles/overlay.json")
+	overlayTOML := writeEmbeddedFile(t, tmpDir, "testfiles/overlay.toml")
+
+	// Read expected result (from YAML merge, applicable to all YAML-based test cases)
+	expectedContent, err := fs.ReadFile(testfiles, "testfiles/expected.json")
+	if err != nil {
+		t.Fatalf("failed to read expected.json: %v", err)
+	}
+
+	var expected map[string]any
+	if err := json.Unmarshal(expectedContent, &expected); err != nil {
+		t.Fatalf("failed to unmarshal expected.json: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		baseFile     string
+		overlayFile  string
+		outputFormat format
+	}{
+		// Same-format tests
+		{"yaml to yaml", baseYAML, overlayYAML, "yaml"},
+		{"yaml to json", baseYAML, overlayYAML, "json"},
+		{"yaml to toml", baseYAML, overlayYAML, "toml"},
+		{"json to yaml", baseJSON, overlayJSON, "yaml"},
+		{"json to json", baseJSON, overlayJSON, "json"},
+		{"json to toml", baseJSON, overlayJSON, "toml"},
+		{"toml to yaml", baseTOML, overlayTOML, "yaml"},
+		{"toml to json", baseTOML, overlayTOML, "json"},
+		{"toml to toml", baseTOML, overlayTOML, "toml"},
+
+		// Cross-format merge tests (mix different input formats)
+		{"yaml base, json overlay to yaml", baseYAML, overlayJSON, "yaml"},
+		{"json base, yaml overlay to json", baseJSON, overlayYAML, "json"},
+		{"yaml base, toml overlay to toml", baseYAML, overlayTOML, "toml"},
+		{"toml base, json overlay to json", baseTOML, overlayJSON, "json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			err := Run(nil, 0, 0, "_delete", []string{tt.baseFile, tt.overlayFile}, tt.outputFormat, &output)
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			var result map[string]any
+			switch tt.outputFormat {
+			case "json":
+				if err := json.Unmarshal(output.Bytes(), &result); err != nil {
+					t.Fatalf("failed to unmarshal result as JSON: %v", err)
+				}
+			case "yaml":
+				if err := yaml.Unmarshal(output.Bytes(), &result); err != nil {
+					t.Fatalf("failed to unmarshal result as YAML: %v", err)
+				}
+			case "toml":
+				if err := toml.Unmarshal(output.Bytes(), &result); err != nil {
+					t.Fatalf("failed to unmarshal result as TOML: %v", err)
+				}
+			}
+
+			// Normalize types by marshaling to JSON and back so comparisons are consistent
+			// across different format unmarshalers (YAML, JSON, TOML produce different types).
+			resultJSON, err := json.Marshal(result)
+			if err != nil {
+				t.Fatalf("failed to marshal result: %v", err)
+			}
+			var normalized map[string]any
+			if err := json.Unmarshal(resultJSON, &normalized); err != nil {
+				t.Fatalf("failed to unmarshal normalized result: %v", err)
+			}
+
+			if !reflect.DeepEqual(normalized, expected) {
+				t.Errorf("result does not match expected.\nGot: %#v\nExpected: %#v", normalized, expected)
+			}
+		})
+	}
+}
+
+func TestRunMissingFiles(t *testing.T) {
+	var output bytes.Buffer
+	err := Run(nil, 0, 0, "_delete", []string{}, "", &output)
+	if err == nil {
+		t.Errorf("expected error for missing files, got nil")
+	}
+	if !strings.Contains(err.Error(), "no files") {
+		t.Errorf("expected 'no files' error, got: %v", err)
+	}
+}
+
+func TestRunFileNotFound(t *testing.T) {
+	var output bytes.Buffer
+	err := Run(nil, 0, 0, "_delete", []string{"nonexistent.yaml"}, "", &output)
+	if err == nil {
+		t.Errorf("expected error for missing file, got nil")
+	}
+}
+
+func TestRunUnknownFormat(t *testing.T) {
+	// Create a temporary directory and file with unknown extension
+	tmpDir, err := os.MkdirTemp("", "cfgmerge-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpFile := filepath.Join(tmpDir, "test.unknown")
+	if err := os.WriteFile(tmpFile, []byte("key: value"), 0o600); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+
+	var output bytes.Buffer
+	err = Run(nil, 0, 0, "_delete", []string{tmpFile}, "", &output)
+	if err == nil {
+		t.Errorf("expected error for unknown format, got nil")
+	}
+}
+
+func TestRunPolicy(t *testing.T) {
+	dir := t.TempDir()
+	files := writeFiles(t, dir,
+		"base.yaml", "services:\n  - name: web\n    port: 8080\n",
+		"overlay.yaml", "services:\n  - name: web\n    port: 80\n",
+		"policy.rules", "services[*].port < 1024 -> error: privileged port\nservices[*].replicas missing -> warning\n",
+	)
+	policy, err := loadPolicy(files[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output, stderr bytes.Buffer
+	cfg := runConfig{files: files[:1], outputFormat: "json", policy: policy, stderr: &stderr}
+	if err := cfg.run(context.Background(), &output); err != nil {
+		t.Fatalf("base alone should satisfy the policy: %v", err)
+	}
+	if stderr.String() != "warning at services[0].replicas: services[*].replicas missing\n" {
+		t.Errorf("unexpected warnings: %q", stderr.String())
+	}
+
+	output.Reset()
+	cfg.files = files[:2]
+	err = cfg.run(context.Background(), &output)
+	if !errors.Is(err, keymerge.ErrPolicyViolation) {
+		t.Fatalf("expected policy violation, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "error at services[0].port: privileged port") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if output.Len() != 0 {
+		t.Errorf("expected no output on policy failure, got %q", output.String())
+	}
+}
+
+func TestRunAssertions(t *testing.T) {
+	dir := t.TempDir()
+	files := writeFiles(t, dir,
+		"base.yaml", "web:\n  port: 8080\n",
+		"overlay.yaml", "_assert:\n  path: web.port\n  equals: 8080\nweb:\n  replicas: 2\n",
+		"bad.yaml", "_assert:\n  path: web.port\n  equals: 80\n",
+	)
+
+	var output bytes.Buffer
+	cfg := runConfig{merge: mergeFlags{assertKey: "_assert"}, files: files[:2], outputFormat: "yaml"}
+	if err := cfg.run(context.Background(), &output); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "web:\n  port: 8080\n  replicas: 2\n" {
+		t.Errorf("unexpected output %q", output.String())
+	}
+
+	output.Reset()
+	cfg.files = []string{files[0], files[2]}
+	err := cfg.run(context.Background(), &output)
+	if !errors.Is(err, keymerge.ErrAssertionFailed) {
+		t.Fatalf("expected assertion failure, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "document 1 ("+files[2]+"): web.port: expected 80, got 8080") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRunNulls(t *testing.T) {
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", "web:\n  port: 8080\n  debug: true\n",
+		"overlay.yaml", "web:\n  debug: null\n",
+	)
+	var stdout bytes.Buffer
+	config := Config{Args: files, Stdout: &stdout}
+	if err := Invoke(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if want := "web:\n  debug: true\n  port: 8080\n"; stdout.String() != want {
+		t.Errorf("got %q, want %q", stdout.String(), want)
+	}
+
+	stdout.Reset()
+	config.Args = append([]string{"-nulls", "delete"}, files...)
+	if err := Invoke(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if want := "web:\n  port: 8080\n"; stdout.String() != want {
+		t.Errorf("got %q, want %q", stdout.String(), want)
+	}
+
+	config.Args = append([]string{"-nulls", "ignore"}, files...)
+	if err := Invoke(context.Background(), config); err == nil {
+		t.Error("expected error for unknown null mode")
+	}
+}
+
+func TestRunConflicts(t *testing.T) {
+	dir := t.TempDir()
+	files := writeFiles(t, dir,
+		"base.yaml", "web:\n  port: 8080\n",
+		"overlay.yaml", "web:\n  port: 9090\n",
+	)
+
+	var output bytes.Buffer
+	cfg := runConfig{merge: mergeFlags{conflicts: conflictMode(keymerge.ConflictStrict)}, files: files, outputFormat: "yaml"}
+	err := cfg.run(context.Background(), &output)
+	if !errors.Is(err, keymerge.ErrConflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "web.port in document 1 ("+files[1]+"): 9090 would replace 8080") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Marked conflicts are written out, and still fail the merge.
+	output.Reset()
+	cfg.merge.conflicts = conflictMode(keymerge.ConflictMark)
+	err = cfg.run(context.Background(), &output)
+	if err == nil || err.Error() != `1 conflict(s) marked under "_conflict" at web.port; resolve them and merge again` {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if output.String() != "web:\n  port:\n    _conflict:\n    - 8080\n    - 9090\n" {
+		t.Errorf("unexpected output %q", output.String())
+	}
+}
+
+func TestRunProgress(t *testing.T) {
+	dir := t.TempDir()
+	files := writeFiles(t, dir,
+		"base.yaml", "a:\n  b: 1\n",
+		"overlay.yaml", "a:\n  b: 2\n",
+	)
+
+	var output, stderr bytes.Buffer
+	cfg := runConfig{files: files, outputFormat: "yaml", progress: 2, stderr: &stderr}
+	if err := cfg.run(context.Background(), &output); err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("progress: merged 2 values, %s\nprogress: merged 4 values, %s at a.b\n", files[1], files[1])
+	if stderr.String() != want {
+		t.Errorf("got %q, want %q", stderr.String(), want)
+	}
+	if output.String() != "a:\n  b: 2\n" {
+		t.Errorf("unexpected output %q", output.String())
+	}
+}
+
+func TestRunRules(t *testing.T) {
+	dir := t.TempDir()
+	files := writeFiles(t, dir,
+		"rules.toml", "[endpoints]\nkeys = [\"region\", \"name\"]\n\n[\"endpoints[*].tags\"]\nmode = \"dedup\"\n",
+		"base.yaml", "endpoints:\n  - {region: us, name: api, tags: [a]}\n  - {region: eu, name: api, tags: [a]}\n",
+		"overlay.json", `{"endpoints": [{"region": "eu", "name": "api", "tags": ["a", "b"]}]}`,
+	)
+
+	var stdout, stderr bytes.Buffer
+	config := Config{Args: append([]string{"-rules", files[0], "-format", "json"}, files[1:]...), Stdout: &stdout, Stderr: &stderr}
+	if err := Invoke(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"endpoints": []any{
+		map[string]any{"region": "us", "name": "api", "tags": []any{"a"}},
+		map[string]any{"region": "eu", "name": "api", "tags": []any{"a", "b"}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	bad := writeFiles(t, dir, "bad.yaml", "endpoints: {keys: region}\n")
+	if _, err := loadRules(bad[0], keymerge.LoadRules); !errors.Is(err, keymerge.ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions, got %v", err)
+	}
+	if _, err := loadRules(filepath.Join(dir, "missing.yaml"), keymerge.LoadRules); err == nil {
+		t.Error("expected error for missing rules file")
+	}
+
+	// A schema gives the same rules.
+	schema := writeFiles(t, dir, "schema.json", `{"properties": {"endpoints": {"type": "array",
+		"x-keymerge-keys": ["region", "name"], "items": {"properties": {"tags": {"x-keymerge-mode": "dedup"}}}}}}`)
+	stdout.Reset()
+	config.Args = append([]string{"-schema", schema[0], "-format", "json"}, files[1:]...)
+	if err := Invoke(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	config.Args = append([]string{"-schema", schema[0], "-rules", files[0]}, files[1:]...)
+	if err := Invoke(context.Background(), config); err == nil {
+		t.Error("expected error combining -rules and -schema")
+	}
+}
+
+func TestRunKubernetesSchema(t *testing.T) {
+	dir := t.TempDir()
+	files := writeFiles(t, dir,
+		"swagger.json", `{"definitions": {
+			"io.k8s.api.core.v1.Pod": {
+				"properties": {"spec": {"properties": {"containers": {
+					"type": "array",
+					"items": {"properties": {"args": {"type": "array", "items": {"type": "string"}}}},
+					"x-kubernetes-patch-merge-key": "name",
+					"x-kubernetes-patch-strategy": "merge"
+				}}}},
+				"x-kubernetes-group-version-kind": [{"group": "", "kind": "Pod", "version": "v1"}]
+			}
+		}}`,
+		"base.yaml", "apiVersion: v1\nkind: Pod\nmetadata: {name: web}\nspec:\n  containers:\n  - {name: app, args: [-v, -port=80]}\n",
+		"overlay.yaml", "apiVersion: v1\nkind: Pod\nmetadata: {name: web}\nspec:\n  containers:\n  - {name: app, args: [-port=8080]}\n",
+	)
+	want := "apiVersion: v1\nkind: Pod\nmetadata:\n  name: web\nspec:\n  containers:\n  - args:\n    - -port=8080\n    name: app\n"
+	for _, identity := range [][]string{nil, {"-identity", "kind,metadata.name"}} {
+		var stdout bytes.Buffer
+		args := append(append([]string{"-k8s-schema", files[0]}, identity...), files[1:]...)
+		if err := Invoke(context.Background(), Config{Args: args, Stdout: &stdout}); err != nil {
+			t.Fatal(err)
+		}
+		if got := stdout.String(); got != want {
+			t.Errorf("with %v: got %q, want %q", identity, got, want)
+		}
+	}
+
+	bad := writeFiles(t, dir, "bad.json", `{"openapi": "3.0.0"}`)
+	if _, err := loadKubernetesSchema(bad[0]); !errors.Is(err, keymerge.ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions, got %v", err)
+	}
+}
+
+func TestRunPreset(t *testing.T) {
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", "services:\n  web:\n    command: [serve, --debug]\n    ports: [\"80:80\"]\n",
+		"overlay.yaml", "services:\n  web:\n    command: [serve]\n    ports: [\"80:80\", \"443:443\"]\n",
+	)
+	var stdout bytes.Buffer
+	config := Config{Args: append([]string{"-preset", "compose"}, files...), Stdout: &stdout}
+	if err := Invoke(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	want := "services:\n  web:\n    command:\n    - serve\n    ports:\n    - 80:80\n    - 443:443\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	config.Args = append([]string{"-preset", "helm"}, files...)
+	if err := Invoke(context.Background(), config); err == nil {
+		t.Error("expected error for unknown preset")
+	}
+}
+
+func TestLoadPolicyErrors(t *testing.T) {
+	if _, err := loadPolicy(filepath.Join(t.TempDir(), "missing.rules")); err == nil {
+		t.Error("expected error for missing policy file")
+	}
+	files := writeFiles(t, t.TempDir(), "bad.rules", "port < 1024\n")
+	if _, err := loadPolicy(files[0]); !errors.Is(err, keymerge.ErrInvalidPolicy) {
+		t.Errorf("expected ErrInvalidPolicy, got %v", err)
+	}
+}
+
+func TestPrimaryKeysFlag(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name:     "single key",
+			input:    "name",
+			expected: []string{"name"},
+		},
+		{
+			name:     "multiple keys",
+			input:    "name,id",
+			expected: []string{"name", "id"},
+		},
+		{
+			name:     "multiple calls",
+			input:    "name",
+			expected: []string{"name"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pk primaryKeys
+			if err := pk.Set(tt.input); err != nil {
+				t.Fatalf("unexpected error from Set: %v", err)
+			}
+			keys := pk.Keys()
+			if len(keys) != len(tt.expected) {
+				t.Errorf("expected %d keys, got %d", len(tt.expected), len(keys))
+			}
+			for i, k := range keys {
+				if k != tt.expected[i] {
+					t.Errorf("expected key[%d] = %s, got %s", i, tt.expected[i], k)
+				}
+			}
+		})
+	}
+}
+
+func TestScalarModeFlag(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		valid bool
+	}{
+		{"concat", "concat", true},
+		{"dedup", "dedup", true},
+		{"replace", "replace", true},
+		{"empty", "", true},
+		{"invalid", "invalid_mode", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sm scalarMode
+			err := sm.Set(tt.input)
+			if (err == nil) != tt.valid {
+				t.Errorf("expected valid=%v, got error=%v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestConflictModeFlag(t *testing.T) {
+	tests := []struct {
+		input string
+		want  keymerge.ConflictMode
+		valid bool
+	}{
+		{"override", keymerge.ConflictOverride, true},
+		{"strict", keymerge.ConflictStrict, true},
+		{"mark", keymerge.ConflictMark, true},
+		{"", keymerge.ConflictOverride, true},
+		{"invalid", keymerge.ConflictOverride, false},
+	}
+
+	for _, tt := range tests {
+		var cm conflictMode
+		err := cm.Set(tt.input)
+		if (err == nil) != tt.valid {
+			t.Errorf("%q: expected valid=%v, got error=%v", tt.input, tt.valid, err)
+		}
+		if cm.Mode() != tt.want {
+			t.Errorf("%q: got mode %v, want %v", tt.input, cm.Mode(), tt.want)
+		}
+	}
+}
+
+func TestDupeModeFlag(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		valid bool
+	}{
+		{"unique", "unique", true},
+		{"consolidate", "consolidate", true},
+		{"empty", "", true},
+		{"invalid", "invalid_mode", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dm dupeMode
+			err := dm.Set(tt.input)
+			if (err == nil) != tt.valid {
+				t.Errorf("expected valid=%v, got error=%v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestFormatFlag(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		valid bool
+	}{
+		{"json", "json", true},
+		{"yaml", "yaml", true},
+		{"toml", "toml", true},
+		{"empty", "", true},
+		{"invalid", "xml", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fmt format
+			err := fmt.Set(tt.input)
+			if (err == nil) != tt.valid {
+				t.Errorf("expected valid=%v, got error=%v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestTOMLMarshalNonMapRoot(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "cfgmerge-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Create two JSON files with top-level arrays
+	// When merged, the result will be a top-level array, which TOML cannot
+	// represent, so it is written as an array of tables under "items"
+	baseFile := filepath.Join(tmpDir, "base.json")
+	overlayFile := filepath.Join(tmpDir, "overlay.json")
+
+	if err := os.WriteFile(baseFile, []byte(`[{"name":"a","value":1},{"name":"b","value":2}]`), 0o600); err != nil {
+		t.Fatalf("failed to write base.json: %v", err)
+	}
+	if err := os.WriteFile(overlayFile, []byte(`[{"name":"b","_delete":true},{"name":"c","value":3}]`), 0o600); err != nil {
+		t.Fatalf("failed to write overlay.json: %v", err)
+	}
+
+	var output bytes.Buffer
+	err = Run(primaryKeys{"name"}, 0, 0, "_delete", []string{baseFile, overlayFile}, "toml", &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[[items]]\n  name = \"a\"\n  value = 1.0\n\n[[items]]\n  name = \"c\"\n  value = 3.0\n"
+	if output.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", output.String(), want)
+	}
+}
+
+func TestRunLabels(t *testing.T) {
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", "web:\n  port: 8080\n",
+		"overlay.yaml", "web:\n  port: 9090\n",
+	)
+	config := Config{Args: append([]string{"-conflicts", "strict", "-label", "prod overlay=" + files[1]}, files...), Stdout: &bytes.Buffer{}}
+	err := Invoke(context.Background(), config)
+	if !errors.Is(err, keymerge.ErrConflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "in document 1 (prod overlay):") {
+		t.Errorf("expected the label in the error, got %v", err)
+	}
+
+	config.Args = append([]string{"-label", "prod overlay"}, files...)
+	if err := Invoke(context.Background(), config); err == nil || !strings.Contains(err.Error(), "NAME=FILE") {
+		t.Errorf("expected error for invalid label, got %v", err)
+	}
+}
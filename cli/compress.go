@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compression is a compression format for output.
+type compression string
+
+const (
+	noCompression   compression = ""
+	gzipCompression compression = "gzip"
+	zstdCompression compression = "zstd"
+)
+
+// Magic numbers at the start of compressed inputs.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// compressionFlags returns the compression selected by the -gzip and -zstd
+// flags, which are mutually exclusive.
+func compressionFlags(gzipped, zstded bool) (compression, error) {
+	switch {
+	case gzipped && zstded:
+		return noCompression, errors.New("-gzip and -zstd are mutually exclusive")
+	case gzipped:
+		return gzipCompression, nil
+	case zstded:
+		return zstdCompression, nil
+	default:
+		return noCompression, nil
+	}
+}
+
+// compress returns data compressed in c.
+func (c compression) compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch c {
+	case noCompression:
+		return data, nil
+	case gzipCompression:
+		w = gzip.NewWriter(&buf)
+	case zstdCompression:
+		var err error
+		if w, err = zstd.NewWriter(&buf); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// extension returns the file extension of files compressed in c.
+func (c compression) extension() string {
+	switch c {
+	case gzipCompression:
+		return ".gz"
+	case zstdCompression:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// decompressReader returns a reader of r's contents, decompressing them if
+// they start with the magic number of gzip or zstd.
+func decompressReader(r io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(r)
+	magic, _ := buffered.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(buffered)
+	case bytes.HasPrefix(magic, zstdMagic):
+		decoder, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return io.NopCloser(buffered), nil
+	}
+}
+
+// decompress returns contents decompressed if they are gzip or zstd data, and
+// unchanged otherwise.
+func decompress(contents []byte) ([]byte, error) {
+	if !bytes.HasPrefix(contents, gzipMagic) && !bytes.HasPrefix(contents, zstdMagic) {
+		return contents, nil
+	}
+	r, err := decompressReader(bytes.NewReader(contents))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// uncompressedName returns file without a .gz or .zst extension, so that the
+// format of a compressed file is that of its name before compression.
+func uncompressedName(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".gz", ".zst":
+		return strings.TrimSuffix(file, filepath.Ext(file))
+	default:
+		return file
+	}
+}
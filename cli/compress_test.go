@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestRunCompression(t *testing.T) {
+	dir := t.TempDir()
+	files := writeFiles(t, dir, "base.yaml", "port: 80\nhost: example.com\n", "overlay.yaml", "port: 8080\n")
+
+	// Compressed inputs are read transparently, their format given by the
+	// extension before .gz or .zst.
+	for _, c := range []compression{gzipCompression, zstdCompression} {
+		compressed, err := c.compress([]byte("port: 80\nhost: example.com\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(dir, "base.yaml"+map[compression]string{gzipCompression: ".gz", zstdCompression: ".zst"}[c])
+		if err := os.WriteFile(file, compressed, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		var output bytes.Buffer
+		cfg := runConfig{files: []string{file, files[1]}, compression: c}
+		if err := cfg.run(context.Background(), &output); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(output.Bytes(), gzipMagic) && !bytes.HasPrefix(output.Bytes(), zstdMagic) {
+			t.Errorf("%s: expected compressed output, got %q", c, output.String())
+		}
+		decompressed, err := decompress(output.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "host: example.com\nport: 8080\n"; string(decompressed) != want {
+			t.Errorf("%s: got %q, want %q", c, decompressed, want)
+		}
+
+		// The sandbox checks inputs once decompressed.
+		cfg = runConfig{files: []string{file}, sandbox: true}
+		if err := cfg.run(context.Background(), &output); err != nil {
+			t.Errorf("%s: unexpected sandbox error: %v", c, err)
+		}
+	}
+
+	if _, err := compressionFlags(true, true); err == nil {
+		t.Error("expected -gzip with -zstd to fail")
+	}
+}
+
+func TestCheckUntrusted_CompressedAliases(t *testing.T) {
+	compressed, err := gzipCompression.compress([]byte("a: &a [1]\nb: *a\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "bomb.yml.gz")
+	if err := os.WriteFile(file, compressed, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkUntrusted([]string{file}, keymerge.SandboxLimits().MaxBytes); err == nil || !strings.Contains(err.Error(), "aliases") {
+		t.Errorf("expected aliases to be rejected, got %v", err)
+	}
+
+	// A small file that decompresses beyond the limit is rejected.
+	large, err := gzipCompression.compress(bytes.Repeat([]byte("# padding\n"), 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, large, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkUntrusted([]string{file}, 1000); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("expected the decompressed size to be limited, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sam-fredrickson/keymerge/conformance"
+)
+
+// runConformance implements "cfgmerge conformance", which runs the
+// conformance suite against keymerge or another implementation.
+func runConformance(_ context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("conformance", flag.ContinueOnError)
+	var vectorsDir, command string
+	var asJSON bool
+	fs.StringVar(&vectorsDir, "vectors", "", "directory of vector files to run instead of the published suite")
+	fs.StringVar(&command, "exec", "", "command line of an implementation to test instead of keymerge")
+	fs.BoolVar(&asJSON, "json", false, "write the results as JSON")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: cfgmerge conformance [flags]\n\n")
+		fmt.Fprintf(out, "Runs the conformance suite, merging each vector's documents and comparing\n")
+		fmt.Fprintf(out, "the result with the expected one. With -exec, each vector is merged by the\n")
+		fmt.Fprintf(out, "command instead: it reads {\"options\": ..., \"documents\": [...]} from stdin\n")
+		fmt.Fprintf(out, "and writes {\"result\": ...} or {\"error\": CATEGORY, \"message\": ...} to stdout.\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	var vectors []conformance.Vector
+	var err error
+	if vectorsDir != "" {
+		vectors, err = conformance.Load(os.DirFS(vectorsDir), ".")
+	} else {
+		vectors, err = conformance.Vectors()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load vectors: %w", err)
+	}
+
+	impl := conformance.Implementation(conformance.Reference)
+	if command != "" {
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			return fmt.Errorf("-exec requires a command")
+		}
+		impl = conformance.Exec(fields[0], fields[1:]...)
+	}
+
+	results := conformance.Run(vectors, impl)
+	if asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	} else {
+		for _, result := range results {
+			if err := writeConformanceResult(stdout, result); err != nil {
+				return err
+			}
+		}
+	}
+	if failed := conformance.Failed(results); len(failed) > 0 {
+		return fmt.Errorf("%d of %d vectors failed", len(failed), len(results))
+	}
+	if !asJSON {
+		_, err := fmt.Fprintf(stdout, "%d vectors passed\n", len(results))
+		return err
+	}
+	return nil
+}
+
+// writeConformanceResult writes a line for result, with what the
+// implementation returned if the vector failed.
+func writeConformanceResult(w io.Writer, result conformance.Result) error {
+	if result.Passed {
+		_, err := fmt.Fprintf(w, "PASS %s\n", result.Vector)
+		return err
+	}
+	got := result.Err
+	if got == "" {
+		encoded, err := json.Marshal(result.Got)
+		if err != nil {
+			return err
+		}
+		got = string(encoded)
+	}
+	_, err := fmt.Fprintf(w, "FAIL %s: got %s\n", result.Vector, got)
+	return err
+}
@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRunConformance(t *testing.T) {
+	var output bytes.Buffer
+	if err := runConformance(context.Background(), nil, &output); err != nil {
+		t.Fatalf("%v\n%s", err, output.String())
+	}
+	if !strings.Contains(output.String(), "PASS maps/deep-merge\n") || !strings.HasSuffix(output.String(), " vectors passed\n") {
+		t.Errorf("unexpected output %q", output.String())
+	}
+}
+
+func TestRunConformance_Failures(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "vectors.json", `[
+		{"name": "passes", "options": {}, "documents": [{"a": 1}, {"a": 2}], "expected": {"a": 2}},
+		{"name": "fails", "options": {}, "documents": [{"a": 1}, {"a": 2}], "expected": {"a": 1}},
+		{"name": "errors", "options": {"conflictMode": "strict"}, "documents": [{"a": 1}, {"a": 2}], "expected": {"a": 2}}
+	]`)
+
+	var output bytes.Buffer
+	err := runConformance(context.Background(), []string{"-vectors", dir}, &output)
+	if err == nil || err.Error() != "2 of 3 vectors failed" {
+		t.Errorf("unexpected error %v", err)
+	}
+	expected := "PASS passes\nFAIL fails: got {\"a\":2}\nFAIL errors: got conflicting value"
+	if !strings.HasPrefix(output.String(), expected) {
+		t.Errorf("got %q, want prefix %q", output.String(), expected)
+	}
+
+	output.Reset()
+	if err := runConformance(context.Background(), []string{"-json", "-vectors", dir}, &output); err == nil {
+		t.Error("expected failures")
+	}
+	var results []struct {
+		Vector string `json:"vector"`
+		Passed bool   `json:"passed"`
+	}
+	if err := json.Unmarshal(output.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || !results[0].Passed || results[1].Passed {
+		t.Errorf("unexpected results %+v", results)
+	}
+
+	if err := runConformance(context.Background(), []string{"-exec", "false"}, &bytes.Buffer{}); err == nil {
+		t.Error("expected a failing implementation to fail")
+	}
+}
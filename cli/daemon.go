@@ -0,0 +1,401 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// runDaemon implements "cfgmerge daemon", which keeps the outputs of a manifest
+// of merge groups up to date as their inputs change.
+func runDaemon(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	var merge mergeFlags
+	var manifestPath, listen, statusConfigMap string
+	var interval, debounce time.Duration
+	var kube bool
+	merge.register(fs)
+	fs.StringVar(&manifestPath, "manifest", "", "manifest file listing the groups to merge")
+	fs.DurationVar(&interval, "interval", time.Second, "how often to check inputs for changes")
+	fs.DurationVar(&debounce, "debounce", 500*time.Millisecond, "how long inputs must be unchanged before merging")
+	fs.StringVar(&listen, "listen", "", "address to serve /healthz and /metrics on, e.g. :9090 (empty disables)")
+	fs.BoolVar(&kube, "k8s", false, "when running in a Kubernetes pod, emit an Event on the pod for each merge")
+	fs.StringVar(&statusConfigMap, "k8s-status-configmap", "", "with -k8s, also record each group's status in this ConfigMap")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: cfgmerge daemon -manifest FILE [flags]\n\n")
+		fmt.Fprintf(out, "Merges every group in the manifest, then watches their inputs and merges a\n")
+		fmt.Fprintf(out, "group again when its inputs change. Outputs are replaced atomically. Runs\n")
+		fmt.Fprintf(out, "until interrupted.\n\n")
+		fmt.Fprintf(out, "The manifest is YAML; relative paths are relative to the manifest:\n\n")
+		fmt.Fprintf(out, "  groups:\n")
+		fmt.Fprintf(out, "    - name: web\n")
+		fmt.Fprintf(out, "      inputs: [base.yaml, web.yaml]\n")
+		fmt.Fprintf(out, "      output: rendered/web.yaml\n")
+		fmt.Fprintf(out, "      format: yaml  # optional, defaults to the first input's format\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if manifestPath == "" || fs.NArg() > 0 {
+		return errors.New("expected -manifest FILE and no arguments")
+	}
+	if interval <= 0 || debounce < 0 {
+		return errors.New("-interval must be positive and -debounce must not be negative")
+	}
+	if statusConfigMap != "" && !kube {
+		return errors.New("-k8s-status-configmap requires -k8s")
+	}
+
+	groups, err := loadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	d := &daemon{opts: merge.options(), yaml: merge.yaml, debounce: debounce, log: stdout}
+	for _, g := range groups {
+		d.groups = append(d.groups, &groupState{group: g})
+	}
+	if kube {
+		if statusConfigMap != "" {
+			for _, g := range groups {
+				if !validConfigMapKey(g.Name) {
+					return fmt.Errorf("group %q cannot be a ConfigMap key; use letters, digits, '-', '_', and '.'", g.Name)
+				}
+			}
+		}
+		if d.kube, err = newInClusterReporter(statusConfigMap); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	d.ctx = ctx
+
+	if listen != "" {
+		listener, err := net.Listen("tcp", listen)
+		if err != nil {
+			return err
+		}
+		server := &http.Server{Handler: d.handler(), ReadHeaderTimeout: 10 * time.Second}
+		go func() { _ = server.Serve(listener) }()
+		defer func() { _ = server.Close() }()
+	}
+
+	d.poll(time.Now())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			d.poll(now)
+		}
+	}
+}
+
+// mergeGroup is a set of inputs merged into one output.
+type mergeGroup struct {
+	Name   string   `yaml:"name"`
+	Inputs []string `yaml:"inputs"`
+	Output string   `yaml:"output"`
+	Format format   `yaml:"format,omitempty"`
+}
+
+// loadManifest reads the groups of a daemon manifest, resolving their paths
+// relative to the manifest's directory.
+func loadManifest(file string) ([]mergeGroup, error) {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var manifest struct {
+		Groups []mergeGroup `yaml:"groups"`
+	}
+	if err := yaml.UnmarshalWithOptions(contents, &manifest, yaml.Strict()); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(manifest.Groups) == 0 {
+		return nil, fmt.Errorf("%s: no groups", file)
+	}
+
+	dir := filepath.Dir(file)
+	resolve := func(path string) string {
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	names := make(map[string]bool, len(manifest.Groups))
+	for i := range manifest.Groups {
+		g := &manifest.Groups[i]
+		switch {
+		case g.Name == "":
+			return nil, fmt.Errorf("%s: group %d has no name", file, i)
+		case names[g.Name]:
+			return nil, fmt.Errorf("%s: duplicate group %q", file, g.Name)
+		case len(g.Inputs) == 0 || g.Output == "":
+			return nil, fmt.Errorf("%s: group %q needs inputs and an output", file, g.Name)
+		}
+		if _, ok := validFormats[string(g.Format)]; !ok {
+			return nil, fmt.Errorf("%s: group %q has invalid format %q", file, g.Name, g.Format)
+		}
+		names[g.Name] = true
+		for j, input := range g.Inputs {
+			g.Inputs[j] = resolve(input)
+		}
+		g.Output = resolve(g.Output)
+	}
+	return manifest.Groups, nil
+}
+
+// daemon merges groups whose inputs have changed.
+type daemon struct {
+	opts     keymerge.Options
+	yaml     yamlVersion
+	debounce time.Duration
+	log      io.Writer
+	kube     *kubeReporter   // reports merges to Kubernetes (nil if disabled)
+	ctx      context.Context // cancels Kubernetes API requests (nil for background)
+
+	mu     sync.Mutex // guards groups' status, which the HTTP handlers read
+	groups []*groupState
+}
+
+// groupState tracks a group's inputs and merge status.
+type groupState struct {
+	group   mergeGroup
+	stamps  []fileStamp // inputs as of the last check (nil before the first)
+	pending time.Time   // when inputs last changed, if not merged since
+
+	merges      int       // successful merges
+	failures    int       // failed merges
+	lastSuccess time.Time // time of the last successful merge
+	lastErr     error     // error of the last merge (nil if it succeeded)
+}
+
+// fileStamp identifies a version of a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+func stampFiles(files []string) []fileStamp {
+	stamps := make([]fileStamp, len(files))
+	for i, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			stamps[i] = fileStamp{modTime: info.ModTime(), size: info.Size(), exists: true}
+		}
+	}
+	return stamps
+}
+
+// poll checks every group's inputs and merges the groups whose inputs changed
+// at least the debounce interval ago. Every group is merged on the first poll.
+func (d *daemon) poll(now time.Time) {
+	for _, s := range d.groups {
+		stamps := stampFiles(s.group.Inputs)
+		switch {
+		case s.stamps == nil:
+			s.pending = now.Add(-d.debounce)
+		case !equalStamps(stamps, s.stamps):
+			s.pending = now
+		}
+		s.stamps = stamps
+		if s.pending.IsZero() || now.Sub(s.pending) < d.debounce {
+			continue
+		}
+		s.pending = time.Time{}
+		err := mergeGroupFiles(d.opts, d.yaml, s.group)
+
+		d.mu.Lock()
+		s.lastErr = err
+		if err != nil {
+			s.failures++
+		} else {
+			s.merges++
+			s.lastSuccess = now
+		}
+		status := s.status()
+		d.mu.Unlock()
+
+		if err != nil {
+			_, _ = fmt.Fprintf(d.log, "%s: %v\n", s.group.Name, err)
+		} else {
+			_, _ = fmt.Fprintf(d.log, "%s: wrote %s\n", s.group.Name, s.group.Output)
+		}
+		if d.kube != nil {
+			ctx := d.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			// Reporting is best effort; the merge result stands either way
+			if err := d.kube.report(ctx, status, err); err != nil {
+				_, _ = fmt.Fprintf(d.log, "%s: failed to report to Kubernetes: %v\n", s.group.Name, err)
+			}
+		}
+	}
+}
+
+func equalStamps(a, b []fileStamp) bool {
+	for i := range a {
+		if a[i].exists != b[i].exists || a[i].size != b[i].size || !a[i].modTime.Equal(b[i].modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeGroupFiles merges a group's inputs and atomically replaces its output.
+func mergeGroupFiles(opts keymerge.Options, version yamlVersion, g mergeGroup) error {
+	docs, inputFormat, err := loadDocuments(g.Inputs, version)
+	if err != nil {
+		return err
+	}
+	merged, err := keymerge.MergeUnstructured(opts, docs...)
+	if err != nil {
+		return fmt.Errorf("merge failed: %w", err)
+	}
+	outputFormat := g.Format
+	if outputFormat == "" {
+		outputFormat = inputFormat
+	}
+	marshaled, err := outputFormat.Marshal(merged)
+	if err != nil {
+		return fmt.Errorf("failed to marshal result as %s: %w", outputFormat, err)
+	}
+	return writeAtomic(g.Output, marshaled)
+}
+
+// writeAtomic replaces file with data such that readers see either the old or
+// the new contents, by writing a temporary file and renaming it.
+func writeAtomic(file string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// groupStatus is a group's entry in the /healthz response and status ConfigMap.
+type groupStatus struct {
+	Name        string     `json:"name"`
+	Output      string     `json:"output"`
+	Healthy     bool       `json:"healthy"`
+	Merges      int        `json:"merges"`
+	Failures    int        `json:"failures"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// status returns the group's status for reports.
+func (s *groupState) status() groupStatus {
+	status := groupStatus{
+		Name:     s.group.Name,
+		Output:   s.group.Output,
+		Healthy:  s.merges > 0 && s.lastErr == nil,
+		Merges:   s.merges,
+		Failures: s.failures,
+	}
+	if !s.lastSuccess.IsZero() {
+		lastSuccess := s.lastSuccess
+		status.LastSuccess = &lastSuccess
+	}
+	if s.lastErr != nil {
+		status.Error = s.lastErr.Error()
+	}
+	return status
+}
+
+// handler serves /healthz, which reports each group's status and fails unless
+// every group's last merge succeeded, and Prometheus metrics on /metrics.
+func (d *daemon) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		d.mu.Lock()
+		statuses := make([]groupStatus, len(d.groups))
+		healthy := true
+		for i, s := range d.groups {
+			statuses[i] = s.status()
+			healthy = healthy && statuses[i].Healthy
+		}
+		d.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"healthy": healthy, "groups": statuses})
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metrics := []struct {
+			name, kind, help string
+			value            func(*groupState) float64
+		}{
+			{"cfgmerge_merges_total", "counter", "Successful merges of the group.",
+				func(s *groupState) float64 { return float64(s.merges) }},
+			{"cfgmerge_merge_failures_total", "counter", "Failed merges of the group.",
+				func(s *groupState) float64 { return float64(s.failures) }},
+			{"cfgmerge_last_success_timestamp_seconds", "gauge", "Unix time of the group's last successful merge.",
+				func(s *groupState) float64 {
+					if s.lastSuccess.IsZero() {
+						return 0
+					}
+					return float64(s.lastSuccess.UnixNano()) / 1e9
+				}},
+			{"cfgmerge_healthy", "gauge", "Whether the group's last merge succeeded.",
+				func(s *groupState) float64 {
+					if s.merges > 0 && s.lastErr == nil {
+						return 1
+					}
+					return 0
+				}},
+		}
+		for _, metric := range metrics {
+			_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.kind)
+			for _, s := range d.groups {
+				_, _ = fmt.Fprintf(w, "%s{group=%q} %g\n", metric.name, s.group.Name, metric.value(s))
+			}
+		}
+	})
+	return mux
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestDaemonPoll(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "out"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := writeFiles(t, dir,
+		"base.yaml", "log: info\nport: 80\n",
+		"web.yaml", "port: 8080\n",
+		"groups.yaml", "groups:\n"+
+			"  - name: web\n    inputs: [base.yaml, web.yaml]\n    output: out/web.yaml\n"+
+			"  - name: web-json\n    inputs: [base.yaml, web.yaml]\n    output: out/web.json\n    format: json\n",
+	)
+	groups, err := loadManifest(files[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log bytes.Buffer
+	d := &daemon{opts: keymerge.Options{}, debounce: time.Second, log: &log}
+	for _, g := range groups {
+		d.groups = append(d.groups, &groupState{group: g})
+	}
+	readOutput := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, "out", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// Every group is merged on the first poll.
+	start := time.Now()
+	d.poll(start)
+	if got := readOutput("web.yaml"); got != "log: info\nport: 8080\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+	if got := readOutput("web.json"); !strings.Contains(got, `"port": 8080`) {
+		t.Errorf("unexpected output %q", got)
+	}
+
+	// Changes are merged once the inputs have settled.
+	writeFiles(t, dir, "web.yaml", "port: 9090\nlog: debug\n")
+	d.poll(start.Add(time.Second))
+	d.poll(start.Add(1500 * time.Millisecond))
+	if got := readOutput("web.yaml"); got != "log: info\nport: 8080\n" {
+		t.Errorf("merged before debounce: %q", got)
+	}
+	d.poll(start.Add(2 * time.Second))
+	if got := readOutput("web.yaml"); got != "log: debug\nport: 9090\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+
+	server := httptest.NewServer(d.handler())
+	defer server.Close()
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var body bytes.Buffer
+		if _, err := body.ReadFrom(resp.Body); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, body.String()
+	}
+	if status, body := get("/healthz"); status != http.StatusOK || !strings.Contains(body, `"healthy":true`) {
+		t.Errorf("unexpected health %d %s", status, body)
+	}
+	_, metrics := get("/metrics")
+	if !strings.Contains(metrics, `cfgmerge_merges_total{group="web"} 2`) {
+		t.Errorf("unexpected metrics:\n%s", metrics)
+	}
+
+	// A failed merge keeps the previous output and reports unhealthy.
+	writeFiles(t, dir, "web.yaml", "port: [unclosed\n")
+	d.poll(start.Add(3 * time.Second))
+	d.poll(start.Add(4 * time.Second))
+	if got := readOutput("web.yaml"); got != "log: debug\nport: 9090\n" {
+		t.Errorf("output replaced after failure: %q", got)
+	}
+	if status, body := get("/healthz"); status != http.StatusServiceUnavailable || !strings.Contains(body, `"error"`) {
+		t.Errorf("unexpected health %d %s", status, body)
+	}
+	_, metrics = get("/metrics")
+	if !strings.Contains(metrics, `cfgmerge_merge_failures_total{group="web"} 1`) {
+		t.Errorf("unexpected metrics:\n%s", metrics)
+	}
+	if !strings.Contains(log.String(), "web: ") {
+		t.Errorf("failure not logged: %q", log.String())
+	}
+}
+
+func TestLoadManifest_Errors(t *testing.T) {
+	for name, manifest := range map[string]string{
+		"no groups":  "groups: []\n",
+		"no name":    "groups:\n  - inputs: [a.yaml]\n    output: b.yaml\n",
+		"no output":  "groups:\n  - name: a\n    inputs: [a.yaml]\n",
+		"duplicate":  "groups:\n  - {name: a, inputs: [a.yaml], output: b.yaml}\n  - {name: a, inputs: [a.yaml], output: c.yaml}\n",
+		"bad format": "groups:\n  - {name: a, inputs: [a.yaml], output: b.yaml, format: ini}\n",
+		"unknown":    "groups:\n  - {name: a, inputs: [a.yaml], output: b.yaml, extra: 1}\n",
+	} {
+		files := writeFiles(t, t.TempDir(), "groups.yaml", manifest)
+		if _, err := loadManifest(files[0]); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if err := runDaemon(context.Background(), nil, &bytes.Buffer{}); err == nil {
+		t.Error("expected error without -manifest")
+	}
+}
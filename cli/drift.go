@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// runDrift implements "cfgmerge drift", which merges two overlay stacks onto the
+// same base and reports how the results differ.
+func runDrift(_ context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("drift", flag.ContinueOnError)
+	var merge mergeFlags
+	var asJSON, asMarkdown bool
+	merge.register(fs)
+	fs.BoolVar(&asJSON, "json", false, "write the report as JSON")
+	fs.BoolVar(&asMarkdown, "markdown", false, "write the report as a Markdown list")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: cfgmerge drift [flags] BASE LEFT... -- RIGHT...\n\n")
+		fmt.Fprintf(out, "Merges the LEFT overlays and the RIGHT overlays onto BASE separately and\n")
+		fmt.Fprintf(out, "reports the paths that RIGHT adds, removes, or changes compared to LEFT,\n")
+		fmt.Fprintf(out, "e.g. to find drift between staging and production.\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if asJSON && asMarkdown {
+		return errors.New("-json and -markdown are mutually exclusive")
+	}
+
+	files := fs.Args()
+	sep := slices.Index(files, "--")
+	if sep < 1 {
+		return errors.New("expected BASE LEFT... -- RIGHT...")
+	}
+	base, left, right := files[0], files[1:sep], files[sep+1:]
+
+	leftDocs, _, err := loadDocuments(append([]string{base}, left...), merge.yaml)
+	if err != nil {
+		return err
+	}
+	rightDocs, _, err := loadDocuments(append([]string{base}, right...), merge.yaml)
+	if err != nil {
+		return err
+	}
+
+	log, err := buildDrift(merge.options(), leftDocs, rightDocs)
+	if err != nil {
+		return err
+	}
+	return log.render(stdout, asJSON, asMarkdown)
+}
+
+// buildDrift merges both document stacks and compares the right result against the left.
+func buildDrift(opts keymerge.Options, left, right []any) (*changelog, error) {
+	merger, err := keymerge.NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	leftMerged, err := merger.MergeUnstructured(left...)
+	if err != nil {
+		return nil, fmt.Errorf("merge of left stack failed: %w", err)
+	}
+	rightMerged, err := merger.MergeUnstructured(right...)
+	if err != nil {
+		return nil, fmt.Errorf("merge of right stack failed: %w", err)
+	}
+	changes, err := merger.Compare(leftMerged, rightMerged)
+	if err != nil {
+		return nil, err
+	}
+	return newChangelog(changes), nil
+}
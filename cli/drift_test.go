@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestRunDrift(t *testing.T) {
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", "log: info\nservices:\n  - name: web\n    port: 80\n    replicas: 1\n",
+		"staging.yaml", "log: debug\nservices:\n  - name: web\n    replicas: 2\n",
+		"prod.yaml", "services:\n  - name: web\n    replicas: 10\n  - name: cache\n    port: 6379\n",
+		"prod-us.yaml", "region: us\n",
+	)
+	base, staging, prod, prodUS := files[0], files[1], files[2], files[3]
+
+	var out bytes.Buffer
+	if err := runDrift(context.Background(), []string{base, staging, "--", prod, prodUS}, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := "Added (2):\n" +
+		"  + region: us\n" +
+		"  + services[name=cache]: map[name:cache port:6379]\n" +
+		"Removed (0):\n" +
+		"Changed (2):\n" +
+		"  ~ log: debug -> info\n" +
+		"  ~ services[name=web].replicas: 2 -> 10\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	// Either stack may be empty, comparing against the base alone.
+	out.Reset()
+	if err := runDrift(context.Background(), []string{"-markdown", base, "--", base}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "No configuration changes.\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestRunDrift_Errors(t *testing.T) {
+	files := writeFiles(t, t.TempDir(), "base.yaml", "a: 1\n")
+	for _, args := range [][]string{
+		{files[0]},
+		{"--", files[0]},
+		{"-json", "-markdown", files[0], "--"},
+		{files[0], "missing.yaml", "--"},
+		{files[0], "--", "missing.yaml"},
+	} {
+		if err := runDrift(context.Background(), args, &bytes.Buffer{}); err == nil {
+			t.Errorf("%v: expected error", args)
+		}
+	}
+}
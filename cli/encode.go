@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// yamlBinary is binary data, which marshals to YAML as a !!binary scalar.
+type yamlBinary []byte
+
+func (b yamlBinary) MarshalYAML() ([]byte, error) {
+	return []byte("!!binary " + base64.StdEncoding.EncodeToString(b)), nil
+}
+
+// encodeFor returns a copy of doc with values f cannot marshal as they are
+// replaced by ones it can:
+//
+//   - Byte slices, which YAML !!binary scalars unmarshal to, become !!binary
+//     scalars in YAML and base64 strings in TOML. JSON already encodes byte
+//     slices as base64 strings, and would otherwise marshal them unchanged.
+//   - Ordered maps (see -preserve-order) become yaml.MapSlice in YAML and plain
+//     maps in TOML, whose encoder sorts keys. JSON marshals them in order.
+//   - Exact numbers (see -exact-numbers) become plain scalars in YAML, which
+//     would otherwise quote them. JSON writes them as they are, and TOML as
+//     64-bit integers or floats, failing if they don't fit.
+func encodeFor(doc any, f format) any {
+	switch v := doc.(type) {
+	case map[string]any:
+		encoded := make(map[string]any, len(v))
+		for key, value := range v {
+			encoded[key] = encodeFor(value, f)
+		}
+		return encoded
+	case *keymerge.OrderedMap:
+		switch f {
+		case "yaml":
+			encoded := make(yaml.MapSlice, 0, len(v.Keys))
+			for _, key := range v.Keys {
+				encoded = append(encoded, yaml.MapItem{Key: key, Value: encodeFor(v.Values[key], f)})
+			}
+			return encoded
+		case "toml":
+			return encodeFor(keymerge.Unordered(v), f)
+		}
+		encoded := &keymerge.OrderedMap{Keys: v.Keys, Values: make(map[string]any, len(v.Values))}
+		for key, value := range v.Values {
+			encoded.Values[key] = encodeFor(value, f)
+		}
+		return encoded
+	case []any:
+		encoded := make([]any, len(v))
+		for i, value := range v {
+			encoded[i] = encodeFor(value, f)
+		}
+		return encoded
+	case json.Number:
+		switch f {
+		case "yaml":
+			return yamlNumber(v)
+		case "toml":
+			return tomlNumber(v)
+		}
+	case []byte:
+		switch f {
+		case "yaml":
+			return yamlBinary(v)
+		case "toml":
+			return base64.StdEncoding.EncodeToString(v)
+		}
+	}
+	return doc
+}
@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRunBinary(t *testing.T) {
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", "name: app\ncert: !!binary aGVsbG8=\n",
+		"overlay.yaml", "keys:\n  - !!binary |\n    d29y\n    bGQ=\n",
+	)
+	for format, want := range map[string]string{
+		"yaml": "cert: !!binary aGVsbG8=\nkeys:\n- !!binary d29ybGQ=\nname: app\n",
+		"json": "{\n  \"cert\": \"aGVsbG8=\",\n  \"keys\": [\n    \"d29ybGQ=\"\n  ],\n  \"name\": \"app\"\n}",
+		"toml": "cert = \"aGVsbG8=\"\nkeys = [\"d29ybGQ=\"]\nname = \"app\"\n",
+	} {
+		var output, stderr bytes.Buffer
+		cfg := runConfig{files: files, stderr: &stderr}
+		if err := cfg.outputFormat.Set(format); err != nil {
+			t.Fatal(err)
+		}
+		if err := cfg.run(context.Background(), &output); err != nil {
+			t.Fatal(err)
+		}
+		if output.String() != want {
+			t.Errorf("%s: got %q, want %q", format, output.String(), want)
+		}
+	}
+
+	// YAML output reads back as the same binary data.
+	var doc any
+	if err := unmarshalYAML([]byte("cert: !!binary aGVsbG8=\n"), &doc, ""); err != nil {
+		t.Fatal(err)
+	}
+	yamlFormat := validFormats["yaml"]
+	encoded, err := yamlFormat.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded any
+	if err := unmarshalYAML(encoded, &decoded, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, doc) {
+		t.Errorf("got %#v, want %#v", decoded, doc)
+	}
+}
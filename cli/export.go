@@ -0,0 +1,385 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// runExport implements "cfgmerge export", which converts a base and overlays
+// into kustomize patches or Helm values layers.
+func runExport(_ context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	var merge mergeFlags
+	var to, outDir string
+	merge.register(fs)
+	fs.StringVar(&to, "to", "", "tool to export to [kustomize, helm] (required)")
+	fs.StringVar(&outDir, "out-dir", "", "directory to write the files to (required)")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: cfgmerge export -to TOOL -out-dir DIR [flags] BASE OVERLAY...\n\n")
+		fmt.Fprintf(out, "Converts BASE and OVERLAYs into files for another tool in -out-dir:\n\n")
+		fmt.Fprintf(out, "  kustomize  BASE's resources in base/, and each OVERLAY as a strategic\n")
+		fmt.Fprintf(out, "             merge patch of the kustomization in overlay/\n")
+		fmt.Fprintf(out, "  helm       BASE as values.yaml, and each OVERLAY as a values-NAME.yaml\n")
+		fmt.Fprintf(out, "             layer for 'helm -f values.yaml -f values-NAME.yaml ...'\n\n")
+		fmt.Fprintf(out, "Prints the files written, and a warning for each construct whose keymerge\n")
+		fmt.Fprintf(out, "semantics the tool does not share.\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return errors.New("expected BASE and at least one OVERLAY")
+	}
+	if outDir == "" {
+		return errors.New("-out-dir is required")
+	}
+	names := make([]string, fs.NArg())
+	for i, file := range fs.Args() {
+		names[i] = strings.TrimSuffix(filepath.Base(uncompressedName(file)), filepath.Ext(uncompressedName(file)))
+		if j := slices.Index(names[:i], names[i]); j >= 0 {
+			return fmt.Errorf("%s and %s have the same name", fs.Arg(j), file)
+		}
+	}
+
+	e := &exporter{opts: merge.options()}
+	var files map[string][]byte
+	var err error
+	switch to {
+	case "kustomize":
+		_, streams, readErr := readStreams(fs.Args(), merge.yaml, false)
+		if readErr != nil {
+			return readErr
+		}
+		files, err = e.kustomize(fs.Args(), names, streams)
+	case "helm":
+		docs, _, readErr := loadDocuments(fs.Args(), merge.yaml)
+		if readErr != nil {
+			return readErr
+		}
+		files, err = e.helm(fs.Args(), names, docs)
+	default:
+		return fmt.Errorf("invalid -to %q (must be kustomize or helm)", to)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		file := filepath.Join(outDir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+		if err := writeAtomic(file, files[name]); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(stdout, file); err != nil {
+			return err
+		}
+	}
+	for _, warning := range e.warnings {
+		if _, err := fmt.Fprintf(stdout, "warning: %s\n", warning); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exporter converts merge stacks, collecting warnings about what does not
+// translate.
+type exporter struct {
+	opts     keymerge.Options
+	warnings []string
+}
+
+func (e *exporter) warn(format string, args ...any) {
+	e.warnings = append(e.warnings, fmt.Sprintf(format, args...))
+}
+
+// strategicMergeKeys are the keys strategic merge patches match the items of
+// common Kubernetes lists by, such as containers, ports, and volume mounts.
+var strategicMergeKeys = []string{"name", "containerPort", "mountPath"}
+
+// kustomize converts streams of Kubernetes resources into a kustomize base
+// and an overlay with one strategic merge patch file per overlay.
+func (e *exporter) kustomize(files, names []string, streams [][]any) (map[string][]byte, error) {
+	resources := make(map[string]map[string]any)
+	var base []any
+	for _, doc := range streams[0] {
+		resource, id, err := kubeResource(doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", files[0], err)
+		}
+		resources[id] = resource
+		base = append(base, resource)
+	}
+	result := map[string][]byte{
+		"base/kustomization.yaml": []byte("resources:\n- resources.yaml\n"),
+	}
+	var err error
+	if result["base/resources.yaml"], err = marshalYAMLStream(base); err != nil {
+		return nil, err
+	}
+
+	var created, patchFiles []string
+	var added []any
+	for i, stream := range streams[1:] {
+		file := files[i+1]
+		var patches []any
+		for _, doc := range stream {
+			overlay, id, err := kubeResource(doc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			resource, exists := resources[id]
+			if !exists {
+				// A new resource rather than a patch
+				merged, err := keymerge.MergeUnstructured(e.opts, map[string]any{}, overlay)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", file, err)
+				}
+				resources[id] = merged.(map[string]any)
+				added = append(added, merged)
+				continue
+			}
+			patch := e.strategicPatch(fmt.Sprintf("%s: %s", file, id), "", overlay).(map[string]any)
+			for _, field := range []string{"apiVersion", "kind"} {
+				if patch[field] == nil {
+					patch[field] = resource[field]
+				}
+			}
+			merged, err := keymerge.MergeUnstructured(e.opts, resource, overlay)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			resources[id] = merged.(map[string]any)
+			patches = append(patches, patch)
+		}
+		if len(patches) == 0 {
+			continue
+		}
+		name := names[i+1] + ".yaml"
+		if result["overlay/"+name], err = marshalYAMLStream(patches); err != nil {
+			return nil, err
+		}
+		patchFiles = append(patchFiles, name)
+	}
+	if len(added) > 0 {
+		created = append(created, "resources.yaml")
+		if result["overlay/resources.yaml"], err = marshalYAMLStream(added); err != nil {
+			return nil, err
+		}
+	}
+
+	kustomization := map[string]any{"resources": append([]string{"../base"}, created...)}
+	if len(patchFiles) > 0 {
+		kustomization["patchesStrategicMerge"] = patchFiles
+	}
+	if result["overlay/kustomization.yaml"], err = yaml.Marshal(kustomization); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// kubeResource returns a document as a Kubernetes resource with its identity.
+func kubeResource(doc any) (map[string]any, string, error) {
+	resource, ok := doc.(map[string]any)
+	if !ok {
+		return nil, "", fmt.Errorf("expected resources, found a document of type %T", doc)
+	}
+	id, err := resourceID(resource)
+	if err != nil {
+		return nil, "", err
+	}
+	return resource, id, nil
+}
+
+// strategicPatch converts an overlay value to a strategic merge patch: delete
+// markers become null values and $patch: delete, and assertions and move
+// markers are dropped. It warns about those, and about lists that strategic
+// merge would merge differently.
+func (e *exporter) strategicPatch(source, path string, value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			item := v[key]
+			childPath := strings.TrimPrefix(path+"."+key, ".")
+			switch {
+			case path == "" && key == e.opts.AssertKey && e.opts.AssertKey != "":
+				e.warn("%s: assertions are not checked by kustomize", source)
+			case e.deletes(item):
+				result[key] = nil
+			default:
+				result[key] = e.strategicPatch(source, childPath, item)
+			}
+		}
+		return result
+	case []any:
+		if !slices.ContainsFunc(v, isMapValue) {
+			if e.opts.ScalarMode != keymerge.ScalarReplace {
+				e.warn("%s: %s: strategic merge replaces lists of scalars instead of adding to them", source, path)
+			}
+			return v
+		}
+		result := make([]any, len(v))
+		for i, item := range v {
+			mp, ok := item.(map[string]any)
+			if !ok {
+				e.warn("%s: %s: strategic merge cannot match scalars among list items", source, path)
+				result[i] = item
+				continue
+			}
+			key := slices.IndexFunc(e.opts.PrimaryKeyNames, func(k string) bool { return mp[k] != nil })
+			switch {
+			case key < 0:
+				e.warn("%s: %s[%d]: item without a primary key is appended by keymerge", source, path, i)
+			case !slices.Contains(strategicMergeKeys, e.opts.PrimaryKeyNames[key]):
+				e.warn("%s: %s: items are matched by %s, which strategic merge does not use", source, path, e.opts.PrimaryKeyNames[key])
+			}
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			if key >= 0 {
+				itemPath = fmt.Sprintf("%s[%s=%v]", path, e.opts.PrimaryKeyNames[key], mp[e.opts.PrimaryKeyNames[key]])
+			}
+			if e.opts.MoveMarkerKey != "" && mp[e.opts.MoveMarkerKey] != nil {
+				e.warn("%s: %s: moving items between lists is not supported by strategic merge", source, itemPath)
+				mp = maps.Clone(mp)
+				delete(mp, e.opts.MoveMarkerKey)
+			}
+			if e.deletes(mp) {
+				patch := make(map[string]any, len(mp))
+				for k, value := range mp {
+					if k != e.opts.DeleteMarkerKey {
+						patch[k] = value
+					}
+				}
+				patch["$patch"] = "delete"
+				result[i] = patch
+				continue
+			}
+			result[i] = e.strategicPatch(source, itemPath, mp)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// deletes reports whether value is marked for deletion.
+func (e *exporter) deletes(value any) bool {
+	mp, ok := value.(map[string]any)
+	return ok && e.opts.DeleteMarkerKey != "" && mp[e.opts.DeleteMarkerKey] == true
+}
+
+func isMapValue(value any) bool {
+	_, ok := value.(map[string]any)
+	return ok
+}
+
+// helm converts a base and overlays into Helm values files. Since Helm
+// replaces lists where keymerge merges them, each layer is computed from the
+// merged results rather than converted from the overlay: it sets what changed
+// and nulls what was removed, with changed lists in full.
+func (e *exporter) helm(files, names []string, docs []any) (map[string][]byte, error) {
+	for i, doc := range docs {
+		if _, ok := doc.(map[string]any); !ok {
+			return nil, fmt.Errorf("%s: Helm values must be a map, not %T", files[i], doc)
+		}
+	}
+	merger, err := keymerge.NewUntypedMerger(e.opts, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]byte)
+	before, err := merger.MergeUnstructured(docs[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", files[0], err)
+	}
+	if result["values.yaml"], err = yaml.Marshal(before); err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(docs); i++ {
+		if e.opts.AssertKey != "" && docs[i].(map[string]any)[e.opts.AssertKey] != nil {
+			e.warn("%s: assertions are not checked by Helm", files[i])
+		}
+		after, err := merger.MergeUnstructured(docs[:i+1]...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", files[i], err)
+		}
+		layer := e.helmLayer(files[i], "", before.(map[string]any), after.(map[string]any))
+		if result["values-"+names[i]+".yaml"], err = yaml.Marshal(layer); err != nil {
+			return nil, err
+		}
+		before = after
+	}
+	return result, nil
+}
+
+// helmLayer returns the values that turn before into after when Helm merges
+// them: changed values, with maps merged recursively and lists in full, and
+// null for removed keys.
+func (e *exporter) helmLayer(source, path string, before, after map[string]any) map[string]any {
+	layer := make(map[string]any)
+	for _, key := range slices.Sorted(maps.Keys(before)) {
+		if _, ok := after[key]; !ok {
+			layer[key] = nil
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(after)) {
+		value := after[key]
+		old, existed := before[key]
+		if existed && reflect.DeepEqual(old, value) {
+			continue
+		}
+		childPath := strings.TrimPrefix(path+"."+key, ".")
+		oldMap, oldOK := old.(map[string]any)
+		newMap, newOK := value.(map[string]any)
+		switch {
+		case oldOK && newOK:
+			layer[key] = e.helmLayer(source, childPath, oldMap, newMap)
+		case value == nil:
+			e.warn("%s: %s: Helm deletes keys set to null", source, childPath)
+			layer[key] = nil
+		default:
+			if _, ok := value.([]any); ok && existed {
+				e.warn("%s: %s: Helm replaces lists, so the layer holds the whole merged list", source, childPath)
+			}
+			layer[key] = value
+		}
+	}
+	return layer
+}
+
+// marshalYAMLStream marshals documents as a multi-document YAML stream.
+func marshalYAMLStream(docs []any) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, doc := range docs {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		marshaled, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(marshaled)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestRunExport_Kustomize(t *testing.T) {
+	dir := t.TempDir()
+	files := writeFiles(t, dir,
+		"base.yaml", `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: web:v1
+          args: [--serve]
+        - name: debug
+          image: busybox
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  labels:
+    tier: frontend
+`,
+		"prod.yaml", `kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: web:v2
+          args: [--prod]
+        - name: debug
+          _delete: true
+---
+kind: Service
+metadata:
+  name: web
+  labels:
+    tier:
+      _delete: true
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: extra
+data:
+  key: value
+`)
+	outDir := filepath.Join(dir, "out")
+	var out bytes.Buffer
+	if err := runExport(context.Background(), []string{"-to", "kustomize", "-out-dir", outDir, files[0], files[1]}, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(outDir, "base/kustomization.yaml"),
+		filepath.Join(outDir, "base/resources.yaml"),
+		filepath.Join(outDir, "overlay/kustomization.yaml"),
+		filepath.Join(outDir, "overlay/prod.yaml"),
+		filepath.Join(outDir, "overlay/resources.yaml"),
+		"warning: " + files[1] + ": deployment-web: spec.template.spec.containers[name=app].args: strategic merge replaces lists of scalars instead of adding to them",
+	}
+	if got := strings.Split(strings.TrimSpace(out.String()), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	contents, err := os.ReadFile(filepath.Join(outDir, "overlay/prod.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	patches, err := unmarshalYAMLStream(contents, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPatches := []any{
+		map[string]any{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]any{"name": "web"},
+			"spec": map[string]any{"template": map[string]any{"spec": map[string]any{"containers": []any{
+				map[string]any{"name": "app", "image": "web:v2", "args": []any{"--prod"}},
+				map[string]any{"name": "debug", "$patch": "delete"},
+			}}}},
+		},
+		map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]any{"name": "web", "labels": map[string]any{"tier": nil}},
+		},
+	}
+	if !reflect.DeepEqual(patches, wantPatches) {
+		t.Errorf("got %v, want %v", patches, wantPatches)
+	}
+	contents, err = os.ReadFile(filepath.Join(outDir, "overlay/kustomization.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "patchesStrategicMerge:\n- prod.yaml\nresources:\n- ../base\n- resources.yaml\n" {
+		t.Errorf("unexpected kustomization %q", contents)
+	}
+}
+
+func TestRunExport_Helm(t *testing.T) {
+	dir := t.TempDir()
+	files := writeFiles(t, dir,
+		"values.yaml", "image: web:v1\nservices:\n  - name: web\n    port: 80\nresources:\n  cpu: 1\n  memory: 1Gi\n",
+		"prod.yaml", "image: web:v2\nservices:\n  - name: web\n    port: 8080\nresources:\n  memory:\n    _delete: true\n",
+		"canary.yaml", "image: web:v3\n")
+	outDir := filepath.Join(dir, "out")
+	var out bytes.Buffer
+	if err := runExport(context.Background(), append([]string{"-to", "helm", "-out-dir", outDir}, files...), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "warning: "+files[1]+": services: Helm replaces lists") {
+		t.Errorf("expected list warning, got %q", out.String())
+	}
+
+	want := map[string]any{
+		"values.yaml":        map[string]any{"image": "web:v1", "services": []any{map[string]any{"name": "web", "port": uint64(80)}}, "resources": map[string]any{"cpu": uint64(1), "memory": "1Gi"}},
+		"values-prod.yaml":   map[string]any{"image": "web:v2", "services": []any{map[string]any{"name": "web", "port": uint64(8080)}}, "resources": map[string]any{"memory": nil}},
+		"values-canary.yaml": map[string]any{"image": "web:v3"},
+	}
+	for name, values := range want {
+		contents, err := os.ReadFile(filepath.Join(outDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got any
+		if err := yaml.Unmarshal(contents, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, values) {
+			t.Errorf("%s: got %v, want %v", name, got, values)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"-to", "helm", files[0]},
+		{"-to", "chef", "-out-dir", outDir, files[0], files[1]},
+		{"-to", "helm", "-out-dir", outDir, files[1], filepath.Join(dir, "sub", "prod.yaml")},
+	} {
+		if err := runExport(context.Background(), args, &out); err == nil {
+			t.Errorf("%q: expected error", args)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// runGraph implements "cfgmerge graph", which draws which top-level paths each
+// file changes and where overlays override each other.
+func runGraph(_ context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("graph", flag.ContinueOnError)
+	var merge mergeFlags
+	var outputFormat string
+	merge.register(fs)
+	fs.StringVar(&outputFormat, "o", "dot", "graph format [dot, mermaid]")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: cfgmerge graph [flags] FILE...\n\n")
+		fmt.Fprintf(out, "Merges the files and writes a graph linking each file to the top-level paths\n")
+		fmt.Fprintf(out, "it changes, and those paths to conflicts: values that one overlay sets and a\n")
+		fmt.Fprintf(out, "later overlay changes again. Render it with Graphviz or Mermaid.\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if outputFormat != "dot" && outputFormat != "mermaid" {
+		return fmt.Errorf("unknown graph format %q", outputFormat)
+	}
+	if fs.NArg() == 0 {
+		return errors.New("no files to merge")
+	}
+
+	docs, _, err := loadDocuments(fs.Args(), merge.yaml)
+	if err != nil {
+		return err
+	}
+	trace, err := keymerge.Trace(merge.options(), docs...)
+	if err != nil {
+		return fmt.Errorf("merge failed: %w", err)
+	}
+
+	g := buildGraph(fs.Args(), trace)
+	if outputFormat == "mermaid" {
+		return g.writeMermaid(stdout)
+	}
+	return g.writeDOT(stdout)
+}
+
+// mergeGraph links files to the top-level paths they change, and those paths to conflicts.
+type mergeGraph struct {
+	files []string
+	// paths are the top-level paths changed by any file, sorted.
+	paths []string
+	// touches counts the changes each file made beneath each top-level path.
+	touches []touch
+	// conflicts are values set by one overlay and changed by a later one.
+	conflicts []conflict
+}
+
+type touch struct {
+	file, path, changes int
+}
+
+type conflict struct {
+	path             string
+	topLevel         int
+	setBy, changedBy int
+}
+
+func buildGraph(files []string, trace *keymerge.MergeTrace) *mergeGraph {
+	g := &mergeGraph{files: files}
+	counts := make([]map[string]int, len(trace.Steps))
+	for i, step := range trace.Steps {
+		counts[i] = map[string]int{}
+		for _, change := range step.Changes {
+			top := topLevelPath(change.Path)
+			if counts[i][top] == 0 && !slices.Contains(g.paths, top) {
+				g.paths = append(g.paths, top)
+			}
+			counts[i][top]++
+		}
+	}
+	slices.Sort(g.paths)
+
+	for i := range trace.Steps {
+		for p, top := range g.paths {
+			if n := counts[i][top]; n > 0 {
+				g.touches = append(g.touches, touch{file: i, path: p, changes: n})
+			}
+		}
+	}
+
+	// A change conflicts if the last earlier file to touch the same value is an
+	// overlay; overriding the base is what overlays are for.
+	for i := 2; i < len(trace.Steps); i++ {
+		for _, change := range trace.Steps[i].Changes {
+			setter := lastSetter(trace.Steps[:i], change.Path)
+			if setter < 1 {
+				continue
+			}
+			top, _ := slices.BinarySearch(g.paths, topLevelPath(change.Path))
+			g.conflicts = append(g.conflicts, conflict{path: change.Path, topLevel: top, setBy: setter, changedBy: i})
+		}
+	}
+	return g
+}
+
+// lastSetter returns the index of the last step that changed path, one of its
+// ancestors, or anything beneath it, or -1 if none did.
+func lastSetter(steps []keymerge.TraceStep, path string) int {
+	for j := len(steps) - 1; j >= 0; j-- {
+		for _, change := range steps[j].Changes {
+			if pathWithin(path, change.Path) || pathWithin(change.Path, path) {
+				return steps[j].DocIndex
+			}
+		}
+	}
+	return -1
+}
+
+// topLevelPath returns the first step of a path expression: a field name, a
+// quoted field, or a list position or selector.
+func topLevelPath(path string) string {
+	if strings.HasPrefix(path, `["`) {
+		// Quoted field; skip escaped quotes inside it.
+		for i := 2; i < len(path); i++ {
+			switch path[i] {
+			case '\\':
+				i++
+			case '"':
+				return path[:min(i+2, len(path))]
+			}
+		}
+		return path
+	}
+	if strings.HasPrefix(path, "[") {
+		if end := strings.IndexByte(path, ']'); end >= 0 {
+			return path[:end+1]
+		}
+		return path
+	}
+	if end := strings.IndexAny(path, ".["); end >= 0 {
+		return path[:end]
+	}
+	return path
+}
+
+func (g *mergeGraph) writeDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph merge {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n")
+	for i, file := range g.files {
+		fmt.Fprintf(&b, "  doc%d [label=%s];\n", i, dotQuote(filepath.Base(file)))
+	}
+	for p, path := range g.paths {
+		fmt.Fprintf(&b, "  path%d [label=%s, shape=ellipse];\n", p, dotQuote(path))
+	}
+	for c, con := range g.conflicts {
+		fmt.Fprintf(&b, "  conflict%d [label=%s, shape=octagon, color=red];\n", c, dotQuote(g.conflictLabel(con)))
+	}
+	for _, t := range g.touches {
+		fmt.Fprintf(&b, "  doc%d -> path%d [label=\"%d\"];\n", t.file, t.path, t.changes)
+	}
+	for c, con := range g.conflicts {
+		fmt.Fprintf(&b, "  path%d -> conflict%d [color=red];\n", con.topLevel, c)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (g *mergeGraph) writeMermaid(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for i, file := range g.files {
+		fmt.Fprintf(&b, "  doc%d[%s]\n", i, mermaidQuote(filepath.Base(file)))
+	}
+	for p, path := range g.paths {
+		fmt.Fprintf(&b, "  path%d([%s])\n", p, mermaidQuote(path))
+	}
+	for c, con := range g.conflicts {
+		fmt.Fprintf(&b, "  conflict%d{{%s}}\n", c, mermaidQuote(g.conflictLabel(con)))
+	}
+	for _, t := range g.touches {
+		fmt.Fprintf(&b, "  doc%d -->|%d| path%d\n", t.file, t.changes, t.path)
+	}
+	for c, con := range g.conflicts {
+		fmt.Fprintf(&b, "  path%d --> conflict%d\n", con.topLevel, c)
+	}
+	if len(g.conflicts) > 0 {
+		b.WriteString("  classDef conflict stroke:#d00,color:#d00\n")
+		for c := range g.conflicts {
+			fmt.Fprintf(&b, "  class conflict%d conflict\n", c)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// conflictLabel names the conflicting value and the overlays involved.
+func (g *mergeGraph) conflictLabel(c conflict) string {
+	return fmt.Sprintf("%s: %s overridden by %s", c.path,
+		filepath.Base(g.files[c.setBy]), filepath.Base(g.files[c.changedBy]))
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func graphFixture(t *testing.T) []string {
+	t.Helper()
+	return writeFiles(t, t.TempDir(),
+		"base.yaml", "log: info\nservices:\n  - name: web\n    port: 80\n",
+		"team.yaml", "log: debug\nservices:\n  - name: web\n    port: 8080\n",
+		"prod.yaml", "region: us\nservices:\n  - name: web\n    port: 443\n",
+	)
+}
+
+func TestRunGraph_DOT(t *testing.T) {
+	var out bytes.Buffer
+	if err := runGraph(context.Background(), graphFixture(t), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph merge {
+  rankdir=LR;
+  node [shape=box];
+  doc0 [label="base.yaml"];
+  doc1 [label="team.yaml"];
+  doc2 [label="prod.yaml"];
+  path0 [label="log", shape=ellipse];
+  path1 [label="region", shape=ellipse];
+  path2 [label="services", shape=ellipse];
+  conflict0 [label="services[name=web].port: team.yaml overridden by prod.yaml", shape=octagon, color=red];
+  doc0 -> path0 [label="1"];
+  doc0 -> path2 [label="1"];
+  doc1 -> path0 [label="1"];
+  doc1 -> path2 [label="1"];
+  doc2 -> path1 [label="1"];
+  doc2 -> path2 [label="1"];
+  path2 -> conflict0 [color=red];
+}
+`
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestRunGraph_Mermaid(t *testing.T) {
+	var out bytes.Buffer
+	if err := runGraph(context.Background(), append([]string{"-o", "mermaid"}, graphFixture(t)...), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := `flowchart LR
+  doc0["base.yaml"]
+  doc1["team.yaml"]
+  doc2["prod.yaml"]
+  path0(["log"])
+  path1(["region"])
+  path2(["services"])
+  conflict0{{"services[name=web].port: team.yaml overridden by prod.yaml"}}
+  doc0 -->|1| path0
+  doc0 -->|1| path2
+  doc1 -->|1| path0
+  doc1 -->|1| path2
+  doc2 -->|1| path1
+  doc2 -->|1| path2
+  path2 --> conflict0
+  classDef conflict stroke:#d00,color:#d00
+  class conflict0 conflict
+`
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestRunGraph_Errors(t *testing.T) {
+	files := graphFixture(t)
+	for _, args := range [][]string{
+		nil,
+		{"-o", "svg", files[0]},
+		{"missing.yaml"},
+	} {
+		if err := runGraph(context.Background(), args, &bytes.Buffer{}); err == nil {
+			t.Errorf("%v: expected error", args)
+		}
+	}
+}
+
+func TestTopLevelPath(t *testing.T) {
+	tests := map[string]string{
+		"services":                "services",
+		"services[name=web].port": "services",
+		"a.b":                     "a",
+		`["a.b"].c`:               `["a.b"]`,
+		`["a\"]"][0]`:             `["a\"]"]`,
+		"[2].name":                "[2]",
+	}
+	for path, want := range tests {
+		if got := topLevelPath(path); got != want {
+			t.Errorf("%q: expected %q, got %q", path, want, got)
+		}
+	}
+}
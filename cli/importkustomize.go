@@ -0,0 +1,582 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// kustomizeOptions make keymerge merge like a strategic merge patch for
+// common resources: containers, env, and volumes match by name, ports by
+// containerPort, mounts by mountPath, and lists of scalars such as args are
+// replaced. kustomizeMergeFlags are the same options as cfgmerge flags.
+var kustomizeOptions = keymerge.Options{
+	PrimaryKeyNames: []string{"name", "containerPort", "mountPath"},
+	ScalarMode:      keymerge.ScalarReplace,
+	DeleteMarkerKey: "_delete",
+}
+
+const kustomizeMergeFlags = "-keys name,containerPort,mountPath -scalar replace"
+
+// runImportKustomize implements "cfgmerge import-kustomize", which converts a
+// kustomization's strategic merge patches and ConfigMap generators into
+// overlays and a daemon manifest.
+func runImportKustomize(_ context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("import-kustomize", flag.ContinueOnError)
+	var version yamlVersion
+	var outDir string
+	fs.StringVar(&outDir, "out-dir", "", "directory to write the files to (required)")
+	fs.Var(&version, "yaml-version", `read yes/no/on/off and numbers like 0777 in YAML files as YAML [1.1, 1.2] does (default: yes/no strings, 0777 octal)`)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: cfgmerge import-kustomize -out-dir DIR OVERLAY_DIR\n\n")
+		fmt.Fprintf(out, "Converts the kustomization in OVERLAY_DIR into files in -out-dir: each\n")
+		fmt.Fprintf(out, "resource of its bases in base/, its patchesStrategicMerge and\n")
+		fmt.Fprintf(out, "configMapGenerator entries as overlays in overlay/, and a groups.yaml\n")
+		fmt.Fprintf(out, "manifest for 'cfgmerge daemon' rendering each resource to rendered/.\n")
+		fmt.Fprintf(out, "Patches within the bases are applied. Prints the files written and what\n")
+		fmt.Fprintf(out, "could not be converted.\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected one OVERLAY_DIR")
+	}
+	if outDir == "" {
+		return errors.New("-out-dir is required")
+	}
+
+	k := &kustomizeImport{version: version, opts: kustomizeOptions, visiting: make(map[string]bool)}
+	layer, err := k.readLayer(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	files, err := k.convert(layer, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		file := filepath.Join(outDir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+		if err := writeAtomic(file, files[name]); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(stdout, file); err != nil {
+			return err
+		}
+	}
+	// The daemon writes outputs to existing directories only
+	if err := os.MkdirAll(filepath.Join(outDir, "rendered"), 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	for _, note := range k.notes {
+		if _, err := fmt.Fprintf(stdout, "skipped: %s\n", note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// kustomization holds the fields of a kustomization file that can be imported.
+type kustomization struct {
+	Resources             []string             `yaml:"resources"`
+	Bases                 []string             `yaml:"bases"`
+	PatchesStrategicMerge []string             `yaml:"patchesStrategicMerge"`
+	Patches               []kustomizePatch     `yaml:"patches"`
+	ConfigMapGenerator    []kustomizeConfigMap `yaml:"configMapGenerator"`
+}
+
+// importedKustomizeFields are the top-level fields of a kustomization that are
+// imported, or safely ignored.
+var importedKustomizeFields = []string{
+	"apiVersion", "kind", "resources", "bases", "patchesStrategicMerge",
+	"patches", "configMapGenerator", "generatorOptions",
+}
+
+// kustomizePatch is an entry of a kustomization's patches.
+type kustomizePatch struct {
+	Path   string         `yaml:"path"`
+	Patch  string         `yaml:"patch"`
+	Target map[string]any `yaml:"target"`
+}
+
+// kustomizeConfigMap is an entry of a kustomization's configMapGenerator.
+type kustomizeConfigMap struct {
+	Name      string   `yaml:"name"`
+	Namespace string   `yaml:"namespace"`
+	Behavior  string   `yaml:"behavior"`
+	Files     []string `yaml:"files"`
+	Literals  []string `yaml:"literals"`
+	Envs      []string `yaml:"envs"`
+	Env       string   `yaml:"env"`
+}
+
+// kustomizeLayer is what a kustomization contributes: the resources it lists
+// or generates, and the overlays it converted its patches to.
+type kustomizeLayer struct {
+	resources []map[string]any
+	overlays  []kustomizeOverlay
+}
+
+// kustomizeOverlay is a patch converted to a keymerge overlay.
+type kustomizeOverlay struct {
+	id     string
+	source string // where the patch came from, for notes
+	doc    map[string]any
+	// replaceData marks a ConfigMap generated with behavior: replace, whose
+	// overlay must delete the data keys it does not set.
+	replaceData bool
+}
+
+// kustomizeImport reads kustomizations and converts them.
+type kustomizeImport struct {
+	version  yamlVersion
+	opts     keymerge.Options
+	visiting map[string]bool // directories being read, to detect cycles
+	notes    []string        // what could not be converted
+}
+
+// kustomizationFileNames are the names kustomize looks for in a directory.
+var kustomizationFileNames = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// readLayer reads the kustomization in dir. The resources of its bases are
+// read recursively, with their own overlays applied, while dir's overlays are
+// returned unapplied.
+func (k *kustomizeImport) readLayer(dir string) (kustomizeLayer, error) {
+	var layer kustomizeLayer
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return layer, err
+	}
+	if k.visiting[abs] {
+		return layer, fmt.Errorf("%s: kustomization refers to itself", dir)
+	}
+	k.visiting[abs] = true
+	defer delete(k.visiting, abs)
+
+	var file string
+	var contents []byte
+	for _, name := range kustomizationFileNames {
+		file = filepath.Join(dir, name)
+		if contents, err = os.ReadFile(file); err == nil || !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return layer, fmt.Errorf("%s: no kustomization.yaml", dir)
+		}
+		return layer, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	var kust kustomization
+	var fields map[string]any
+	if err := yaml.Unmarshal(contents, &kust); err != nil {
+		return layer, fmt.Errorf("%s: %w", file, err)
+	}
+	if err := yaml.Unmarshal(contents, &fields); err != nil {
+		return layer, fmt.Errorf("%s: %w", file, err)
+	}
+	for _, field := range slices.Sorted(maps.Keys(fields)) {
+		if !slices.Contains(importedKustomizeFields, field) {
+			k.notes = append(k.notes, fmt.Sprintf("%s: %s is not supported", file, field))
+		}
+	}
+
+	for _, resource := range append(kust.Bases, kust.Resources...) {
+		if strings.Contains(resource, "://") || strings.HasPrefix(resource, "github.com/") {
+			k.notes = append(k.notes, fmt.Sprintf("%s: remote resource %s is not supported", file, resource))
+			continue
+		}
+		path := filepath.Join(dir, resource)
+		info, err := os.Stat(path)
+		if err != nil {
+			return layer, fmt.Errorf("%s: %w", file, err)
+		}
+		if !info.IsDir() {
+			docs, err := k.readDocuments(path)
+			if err != nil {
+				return layer, err
+			}
+			layer.resources = append(layer.resources, docs...)
+			continue
+		}
+		base, err := k.readLayer(path)
+		if err != nil {
+			return layer, err
+		}
+		resources, err := k.apply(base)
+		if err != nil {
+			return layer, err
+		}
+		layer.resources = append(layer.resources, resources...)
+	}
+
+	for _, generator := range kust.ConfigMapGenerator {
+		doc, err := k.generateConfigMap(dir, generator)
+		if err != nil {
+			return layer, fmt.Errorf("%s: configMapGenerator %s: %w", file, generator.Name, err)
+		}
+		switch generator.Behavior {
+		case "", "create":
+			layer.resources = append(layer.resources, doc)
+		case "merge", "replace":
+			id, _ := resourceID(doc)
+			layer.overlays = append(layer.overlays, kustomizeOverlay{
+				id:          id,
+				source:      file + ": configMapGenerator " + generator.Name,
+				doc:         doc,
+				replaceData: generator.Behavior == "replace",
+			})
+		default:
+			return layer, fmt.Errorf("%s: configMapGenerator %s has invalid behavior %q", file, generator.Name, generator.Behavior)
+		}
+	}
+
+	var patches []kustomizePatch
+	for _, patch := range kust.PatchesStrategicMerge {
+		if strings.Contains(patch, "\n") {
+			patches = append(patches, kustomizePatch{Patch: patch})
+		} else {
+			patches = append(patches, kustomizePatch{Path: patch})
+		}
+	}
+	patches = append(patches, kust.Patches...)
+	for i, patch := range patches {
+		source := fmt.Sprintf("%s: patch %d", file, i+1)
+		if patch.Path != "" {
+			source = filepath.Join(dir, patch.Path)
+		}
+		if patch.Target != nil {
+			k.notes = append(k.notes, source+": patches with a target are not supported")
+			continue
+		}
+		docs, err := k.readPatch(dir, patch)
+		if err != nil {
+			return layer, fmt.Errorf("%s: %w", source, err)
+		}
+		for _, doc := range docs {
+			overlay, err := convertPatch(doc, k.opts.DeleteMarkerKey)
+			if err != nil {
+				k.notes = append(k.notes, fmt.Sprintf("%s: %v", source, err))
+				continue
+			}
+			id, err := resourceID(overlay)
+			if err != nil {
+				return layer, fmt.Errorf("%s: %w", source, err)
+			}
+			layer.overlays = append(layer.overlays, kustomizeOverlay{id: id, source: source, doc: overlay})
+		}
+	}
+
+	ids := make(map[string]bool, len(layer.resources))
+	for _, resource := range layer.resources {
+		id, err := resourceID(resource)
+		if err != nil {
+			return layer, fmt.Errorf("%s: %w", file, err)
+		}
+		if ids[id] {
+			return layer, fmt.Errorf("%s: resource %s is listed twice", file, id)
+		}
+		ids[id] = true
+	}
+	for i := range layer.overlays {
+		if layer.overlays[i].replaceData {
+			layer.overlays[i].doc = k.replacingData(layer.overlays[i].doc, layer.resources)
+		}
+	}
+	return layer, nil
+}
+
+// readDocuments reads the documents of a YAML file, which must be maps.
+func (k *kustomizeImport) readDocuments(file string) ([]map[string]any, error) {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	docs, err := unmarshalYAMLStream(contents, k.version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	resources := make([]map[string]any, 0, len(docs))
+	for _, doc := range docs {
+		resource, ok := doc.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected resources, found a document of type %T", file, doc)
+		}
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+// readPatch returns the documents of a patch, from its file or inline.
+func (k *kustomizeImport) readPatch(dir string, patch kustomizePatch) ([]any, error) {
+	if patch.Path == "" {
+		return unmarshalYAMLStream([]byte(patch.Patch), k.version)
+	}
+	file := filepath.Join(dir, patch.Path)
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	return unmarshalYAMLStream(contents, k.version)
+}
+
+// apply merges a layer's overlays into its resources.
+func (k *kustomizeImport) apply(layer kustomizeLayer) ([]map[string]any, error) {
+	resources := slices.Clone(layer.resources)
+	for _, overlay := range layer.overlays {
+		i := slices.IndexFunc(resources, func(resource map[string]any) bool {
+			id, _ := resourceID(resource)
+			return id == overlay.id
+		})
+		if i < 0 {
+			k.notes = append(k.notes, fmt.Sprintf("%s: no resource %s to patch", overlay.source, overlay.id))
+			continue
+		}
+		merged, err := keymerge.MergeUnstructured(k.opts, resources[i], overlay.doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", overlay.source, err)
+		}
+		resources[i] = merged.(map[string]any)
+	}
+	return resources, nil
+}
+
+// convert returns the files of a layer by path: a base file for each resource,
+// an overlay file for each of its overlays, and the manifest merging them.
+func (k *kustomizeImport) convert(layer kustomizeLayer, dir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	var groups []mergeGroup
+	for _, resource := range layer.resources {
+		id, _ := resourceID(resource)
+		base := "base/" + id + ".yaml"
+		marshaled, err := yaml.Marshal(resource)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", id, err)
+		}
+		files[base] = marshaled
+		groups = append(groups, mergeGroup{Name: id, Inputs: []string{base}, Output: "rendered/" + id + ".yaml"})
+	}
+	for _, overlay := range layer.overlays {
+		i := slices.IndexFunc(groups, func(g mergeGroup) bool { return g.Name == overlay.id })
+		if i < 0 {
+			k.notes = append(k.notes, fmt.Sprintf("%s: no resource %s to patch", overlay.source, overlay.id))
+			continue
+		}
+		name := "overlay/" + overlay.id + ".yaml"
+		if n := len(groups[i].Inputs); n > 1 {
+			name = fmt.Sprintf("overlay/%s.%d.yaml", overlay.id, n)
+		}
+		marshaled, err := yaml.Marshal(overlay.doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", overlay.source, err)
+		}
+		files[name] = marshaled
+		groups[i].Inputs = append(groups[i].Inputs, name)
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("%s: no resources to import", dir)
+	}
+
+	manifest, err := yaml.Marshal(map[string]any{"groups": groups})
+	if err != nil {
+		return nil, err
+	}
+	header := fmt.Sprintf("# Imported from %s by cfgmerge import-kustomize. Render with:\n", dir) +
+		"#   cfgmerge daemon -manifest groups.yaml " + kustomizeMergeFlags + "\n"
+	files["groups.yaml"] = append([]byte(header), manifest...)
+	return files, nil
+}
+
+// generateConfigMap returns the ConfigMap a configMapGenerator entry generates,
+// without the hash suffix kustomize adds to its name.
+func (k *kustomizeImport) generateConfigMap(dir string, generator kustomizeConfigMap) (map[string]any, error) {
+	if generator.Name == "" {
+		return nil, errors.New("no name")
+	}
+	data := make(map[string]any)
+	envs := generator.Envs
+	if generator.Env != "" {
+		envs = append(envs, generator.Env)
+	}
+	for _, env := range envs {
+		contents, err := os.ReadFile(filepath.Join(dir, env))
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(contents), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("%s: invalid line %q (must be KEY=VALUE)", env, line)
+			}
+			data[key] = value
+		}
+	}
+	for _, spec := range generator.Files {
+		key, path, ok := strings.Cut(spec, "=")
+		if !ok {
+			key, path = filepath.Base(spec), spec
+		}
+		contents, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			return nil, err
+		}
+		data[key] = string(contents)
+	}
+	for _, literal := range generator.Literals {
+		key, value, ok := strings.Cut(literal, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid literal %q (must be KEY=VALUE)", literal)
+		}
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		data[key] = value
+	}
+
+	metadata := map[string]any{"name": generator.Name}
+	if generator.Namespace != "" {
+		metadata["namespace"] = generator.Namespace
+	}
+	return map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   metadata,
+		"data":       data,
+	}, nil
+}
+
+// replacingData returns a copy of a ConfigMap overlay that also deletes the
+// data keys of its resource that it does not set.
+func (k *kustomizeImport) replacingData(overlay map[string]any, resources []map[string]any) map[string]any {
+	id, _ := resourceID(overlay)
+	i := slices.IndexFunc(resources, func(resource map[string]any) bool {
+		other, _ := resourceID(resource)
+		return other == id
+	})
+	if i < 0 {
+		return overlay
+	}
+	result := maps.Clone(overlay)
+	data := maps.Clone(overlay["data"].(map[string]any))
+	existing, _ := resources[i]["data"].(map[string]any)
+	for key := range existing {
+		if _, ok := data[key]; !ok {
+			data[key] = map[string]any{k.opts.DeleteMarkerKey: true}
+		}
+	}
+	result["data"] = data
+	if binary, ok := resources[i]["binaryData"].(map[string]any); ok {
+		deleted := make(map[string]any, len(binary))
+		for key := range binary {
+			deleted[key] = map[string]any{k.opts.DeleteMarkerKey: true}
+		}
+		result["binaryData"] = deleted
+	}
+	return result
+}
+
+// resourceID identifies a Kubernetes resource by kind, namespace, and name, in
+// a form usable as a file name.
+func resourceID(resource map[string]any) (string, error) {
+	kind, _ := resource["kind"].(string)
+	metadata, _ := resource["metadata"].(map[string]any)
+	name, _ := metadata["name"].(string)
+	if kind == "" || name == "" {
+		return "", errors.New("resource without kind or metadata.name")
+	}
+	id := strings.ToLower(kind) + "-" + name
+	if namespace, _ := metadata["namespace"].(string); namespace != "" {
+		id = strings.ToLower(kind) + "-" + namespace + "-" + name
+	}
+	if !validFileName(id) {
+		return "", fmt.Errorf("resource %s cannot be a file name", id)
+	}
+	return id, nil
+}
+
+// convertPatch converts a strategic merge patch to a keymerge overlay: null
+// values and $patch: delete become delete markers, and $setElementOrder
+// directives are dropped. Other directives are an error.
+func convertPatch(patch any, deleteMarker string) (map[string]any, error) {
+	doc, ok := patch.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("JSON patches and documents of type %T are not supported", patch)
+	}
+	if doc["$patch"] != nil {
+		return nil, errors.New("$patch directives on whole resources are not supported")
+	}
+	converted, err := convertPatchValue(doc, deleteMarker)
+	if err != nil {
+		return nil, err
+	}
+	return converted.(map[string]any), nil
+}
+
+func convertPatchValue(value any, deleteMarker string) (any, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			switch {
+			case strings.HasPrefix(key, "$setElementOrder/"):
+				continue
+			case key == "$patch":
+				switch item {
+				case "delete":
+					result[deleteMarker] = true
+				case "merge":
+				default:
+					return nil, fmt.Errorf("$patch: %v is not supported", item)
+				}
+				continue
+			case strings.HasPrefix(key, "$"):
+				return nil, fmt.Errorf("%s is not supported", key)
+			case item == nil:
+				result[key] = map[string]any{deleteMarker: true}
+				continue
+			}
+			converted, err := convertPatchValue(item, deleteMarker)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			result[key] = converted
+		}
+		return result, nil
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			converted, err := convertPatchValue(item, deleteMarker)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			result[i] = converted
+		}
+		return result, nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestRunImportKustomize(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"base", "staging", "prod"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFiles(t, filepath.Join(dir, "base"),
+		"kustomization.yaml", "resources:\n  - web.yaml\nconfigMapGenerator:\n  - name: web-config\n    literals: [LOG=info, MODE=fast]\n",
+		"web.yaml", `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+        - name: app
+          image: web:v1
+          args: [--serve]
+        - name: debug
+          image: busybox
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+    - port: 80
+`)
+	writeFiles(t, filepath.Join(dir, "staging"),
+		"kustomization.yaml", "resources: [../base]\npatchesStrategicMerge: [replicas.yaml]\n",
+		"replicas.yaml", "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 2\n")
+	writeFiles(t, filepath.Join(dir, "prod"),
+		"kustomization.yaml", `resources: [../staging]
+namePrefix: prod-
+patchesStrategicMerge: [web.yaml]
+patches:
+  - path: json.yaml
+    target: {kind: Service}
+configMapGenerator:
+  - name: web-config
+    behavior: replace
+    literals: [LOG=warn]
+`,
+		"web.yaml", `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: web:v2
+          args: [--serve, --prod]
+        - name: debug
+          $patch: delete
+`,
+		"json.yaml", "- op: replace\n  path: /spec/ports/0/port\n  value: 8080\n")
+
+	outDir := filepath.Join(dir, "out")
+	var out bytes.Buffer
+	if err := runImportKustomize(context.Background(), []string{"-out-dir", outDir, filepath.Join(dir, "prod")}, &out); err != nil {
+		t.Fatal(err)
+	}
+	var written []string
+	for _, name := range []string{
+		"base/configmap-web-config.yaml", "base/deployment-web.yaml", "base/service-web.yaml",
+		"groups.yaml", "overlay/configmap-web-config.yaml", "overlay/deployment-web.yaml",
+	} {
+		written = append(written, filepath.Join(outDir, name))
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(written)+2 || !reflect.DeepEqual(lines[:len(written)], written) {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+	if !strings.Contains(lines[len(written)], "namePrefix is not supported") ||
+		!strings.Contains(lines[len(written)+1], "patches with a target are not supported") {
+		t.Errorf("unexpected notes %q", lines[len(written):])
+	}
+
+	// The base includes the staging patch; prod's patch is an overlay.
+	groups, err := loadManifest(filepath.Join(outDir, "groups.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered := make(map[string]any)
+	for _, g := range groups {
+		if err := mergeGroupFiles(kustomizeOptions, "", g); err != nil {
+			t.Fatal(err)
+		}
+		contents, err := os.ReadFile(g.Output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc any
+		if err := yaml.Unmarshal(contents, &doc); err != nil {
+			t.Fatal(err)
+		}
+		rendered[g.Name] = doc
+	}
+	want := map[string]any{
+		"configmap-web-config": map[string]any{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]any{"name": "web-config"},
+			"data":       map[string]any{"LOG": "warn"},
+		},
+		"deployment-web": map[string]any{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]any{"name": "web"},
+			"spec": map[string]any{
+				"replicas": uint64(2),
+				"template": map[string]any{"spec": map[string]any{"containers": []any{
+					map[string]any{"name": "app", "image": "web:v2", "args": []any{"--serve", "--prod"}},
+				}}},
+			},
+		},
+		"service-web": map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]any{"name": "web"},
+			"spec":       map[string]any{"ports": []any{map[string]any{"port": uint64(80)}}},
+		},
+	}
+	if !reflect.DeepEqual(rendered, want) {
+		t.Errorf("got %v, want %v", rendered, want)
+	}
+
+	if err := runImportKustomize(context.Background(), []string{"-out-dir", outDir, dir}, &out); err == nil ||
+		!strings.Contains(err.Error(), "no kustomization.yaml") {
+		t.Errorf("expected missing kustomization error, got %v", err)
+	}
+}
+
+func TestConvertPatch(t *testing.T) {
+	patch := map[string]any{
+		"kind":     "Deployment",
+		"metadata": map[string]any{"name": "web", "annotations": map[string]any{"old": nil}},
+		"spec": map[string]any{
+			"$setElementOrder/volumes": []any{map[string]any{"name": "data"}},
+			"volumes":                  []any{map[string]any{"name": "cache", "$patch": "delete"}},
+			"selector":                 map[string]any{"$patch": "delete"},
+		},
+	}
+	got, err := convertPatch(patch, "_delete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"kind":     "Deployment",
+		"metadata": map[string]any{"name": "web", "annotations": map[string]any{"old": map[string]any{"_delete": true}}},
+		"spec": map[string]any{
+			"volumes":  []any{map[string]any{"name": "cache", "_delete": true}},
+			"selector": map[string]any{"_delete": true},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, unsupported := range []any{
+		[]any{map[string]any{"op": "remove"}},
+		map[string]any{"kind": "Deployment", "$patch": "delete"},
+		map[string]any{"spec": map[string]any{"$patch": "replace"}},
+		map[string]any{"spec": map[string]any{"$retainKeys": []any{"type"}}},
+	} {
+		if _, err := convertPatch(unsupported, "_delete"); err == nil {
+			t.Errorf("expected error converting %v", unsupported)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir holds the credentials Kubernetes mounts into pods.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeReporter reports merge results to the Kubernetes API as Events on the
+// daemon's pod and, optionally, as entries of a status ConfigMap.
+type kubeReporter struct {
+	client    *http.Client
+	server    string // API server URL
+	token     string // bearer token
+	namespace string
+	pod       string // name of the pod the Events are about
+	configMap string // name of the status ConfigMap (empty disables)
+	now       func() time.Time
+}
+
+// newInClusterReporter configures a kubeReporter from the service account and
+// environment Kubernetes provides to pods. The pod name is read from POD_NAME,
+// falling back to the hostname, which Kubernetes sets to the pod name.
+func newInClusterReporter(configMap string) (*kubeReporter, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are unset")
+	}
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+	namespace, err := os.ReadFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account namespace: %w", err)
+	}
+	caCert, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account CA certificate: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("service account CA certificate contains no certificates")
+	}
+	pod := os.Getenv("POD_NAME")
+	if pod == "" {
+		if pod, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("failed to determine pod name: %w", err)
+		}
+	}
+	return &kubeReporter{
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}},
+		},
+		server:    "https://" + net.JoinHostPort(host, port),
+		token:     strings.TrimSpace(string(token)),
+		namespace: strings.TrimSpace(string(namespace)),
+		pod:       pod,
+		configMap: configMap,
+		now:       time.Now,
+	}, nil
+}
+
+// report records the result of merging a group: a Normal "Merged" or Warning
+// "MergeFailed" Event, and the group's status in the status ConfigMap.
+func (k *kubeReporter) report(ctx context.Context, status groupStatus, mergeErr error) error {
+	now := k.now().UTC().Format(time.RFC3339)
+	eventType, reason, message := "Normal", "Merged", fmt.Sprintf("group %s: wrote %s", status.Name, status.Output)
+	if mergeErr != nil {
+		eventType, reason, message = "Warning", "MergeFailed", fmt.Sprintf("group %s: %v", status.Name, mergeErr)
+	}
+	event := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Event",
+		"metadata":   map[string]any{"generateName": "cfgmerge-", "namespace": k.namespace},
+		"involvedObject": map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"name":       k.pod,
+			"namespace":  k.namespace,
+		},
+		"type":           eventType,
+		"reason":         reason,
+		"message":        message,
+		"source":         map[string]any{"component": "cfgmerge"},
+		"firstTimestamp": now,
+		"lastTimestamp":  now,
+		"count":          1,
+	}
+	eventErr := k.do(ctx, http.MethodPost, "events", "application/json", event)
+	if k.configMap == "" {
+		return eventErr
+	}
+	return errors.Join(eventErr, k.updateStatus(ctx, status))
+}
+
+// updateStatus stores a group's status as JSON under the group's name in the
+// status ConfigMap, creating the ConfigMap if it does not exist.
+func (k *kubeReporter) updateStatus(ctx context.Context, status groupStatus) error {
+	encoded, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	data := map[string]any{status.Name: string(encoded)}
+	err = k.do(ctx, http.MethodPatch, "configmaps/"+url.PathEscape(k.configMap),
+		"application/merge-patch+json", map[string]any{"data": data})
+	var apiErr *kubeAPIError
+	if !errors.As(err, &apiErr) || apiErr.status != http.StatusNotFound {
+		return err
+	}
+	return k.do(ctx, http.MethodPost, "configmaps", "application/json", map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]any{"name": k.configMap, "namespace": k.namespace},
+		"data":       data,
+	})
+}
+
+// validConfigMapKey reports whether key can be a key of a ConfigMap's data.
+func validConfigMapKey(key string) bool {
+	if key == "" || len(key) > 253 || key == "." || key == ".." {
+		return false
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// kubeAPIError is an unsuccessful response from the Kubernetes API.
+type kubeAPIError struct {
+	method, resource string
+	status           int
+	body             string
+}
+
+func (e *kubeAPIError) Error() string {
+	return fmt.Sprintf("kubernetes API %s %s: %d %s: %s",
+		e.method, e.resource, e.status, http.StatusText(e.status), e.body)
+}
+
+// do sends body to a resource of the reporter's namespace.
+func (k *kubeReporter) do(ctx context.Context, method, resource, contentType string, body any) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/api/v1/namespaces/%s/%s", k.server, url.PathEscape(k.namespace), resource)
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	if k.token != "" {
+		req.Header.Set("Authorization", "Bearer "+k.token)
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &kubeAPIError{method: method, resource: resource, status: resp.StatusCode, body: strings.TrimSpace(string(message))}
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,181 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// fakeKubeAPI records requests and serves a single ConfigMap.
+type fakeKubeAPI struct {
+	mu        sync.Mutex
+	requests  []string
+	events    []map[string]any
+	configMap map[string]any // nil until created
+}
+
+func (f *fakeKubeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	var obj map[string]any
+	if err := json.Unmarshal(body, &obj); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch r.Method + " " + r.URL.Path {
+	case "POST /api/v1/namespaces/apps/events":
+		f.events = append(f.events, obj)
+		w.WriteHeader(http.StatusCreated)
+	case "POST /api/v1/namespaces/apps/configmaps":
+		f.configMap = obj
+		w.WriteHeader(http.StatusCreated)
+	case "PATCH /api/v1/namespaces/apps/configmaps/status":
+		if f.configMap == nil {
+			http.Error(w, `{"reason":"NotFound"}`, http.StatusNotFound)
+			return
+		}
+		merged, err := keymerge.MergeJSONMergePatch(keymerge.Options{}, f.configMap, obj)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.configMap = merged.(map[string]any)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestDaemonKubeReporting(t *testing.T) {
+	api := &fakeKubeAPI{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	dir := t.TempDir()
+	files := writeFiles(t, dir,
+		"base.yaml", "port: 80\n",
+		"web.yaml", "port: 8080\n",
+		"groups.yaml", "groups:\n  - {name: web, inputs: [base.yaml, web.yaml], output: web.out.yaml}\n",
+	)
+	groups, err := loadManifest(files[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log bytes.Buffer
+	now := time.Date(2025, 12, 1, 12, 0, 0, 0, time.UTC)
+	d := &daemon{
+		debounce: 0,
+		log:      &log,
+		groups:   []*groupState{{group: groups[0]}},
+		kube: &kubeReporter{
+			client:    server.Client(),
+			server:    server.URL,
+			token:     "secret",
+			namespace: "apps",
+			pod:       "renderer-0",
+			configMap: "status",
+			now:       func() time.Time { return now },
+		},
+	}
+
+	d.poll(now)
+	writeFiles(t, dir, "web.yaml", "port: [unclosed\n")
+	d.poll(now.Add(time.Second))
+
+	if log.Len() == 0 || strings.Contains(log.String(), "failed to report") {
+		t.Errorf("unexpected log %q", log.String())
+	}
+	want := []string{
+		"POST /api/v1/namespaces/apps/events",
+		"PATCH /api/v1/namespaces/apps/configmaps/status",
+		"POST /api/v1/namespaces/apps/configmaps",
+		"POST /api/v1/namespaces/apps/events",
+		"PATCH /api/v1/namespaces/apps/configmaps/status",
+	}
+	if strings.Join(api.requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected requests:\n%s", strings.Join(api.requests, "\n"))
+	}
+
+	if len(api.events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(api.events))
+	}
+	for i, want := range []struct{ kind, reason string }{{"Normal", "Merged"}, {"Warning", "MergeFailed"}} {
+		event := api.events[i]
+		if event["type"] != want.kind || event["reason"] != want.reason {
+			t.Errorf("event %d: unexpected %v %v", i, event["type"], event["reason"])
+		}
+		if involved := event["involvedObject"].(map[string]any); involved["name"] != "renderer-0" || involved["kind"] != "Pod" {
+			t.Errorf("event %d: unexpected involved object %v", i, involved)
+		}
+	}
+
+	var status groupStatus
+	data := api.configMap["data"].(map[string]any)
+	if err := json.Unmarshal([]byte(data["web"].(string)), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Healthy || status.Merges != 1 || status.Failures != 1 || status.Error == "" {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if output, err := os.ReadFile(filepath.Join(dir, "web.out.yaml")); err != nil || string(output) != "port: 8080\n" {
+		t.Errorf("unexpected output %q, %v", output, err)
+	}
+}
+
+func TestDaemonKubeReporting_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", "port: 80\n",
+		"groups.yaml", "groups:\n  - {name: web, inputs: [base.yaml], output: web.out.yaml}\n",
+	)
+	groups, err := loadManifest(files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log bytes.Buffer
+	d := &daemon{
+		log:    &log,
+		groups: []*groupState{{group: groups[0]}},
+		kube:   &kubeReporter{client: server.Client(), server: server.URL, namespace: "apps", now: time.Now},
+	}
+	d.poll(time.Now())
+
+	// A failed report is logged without failing the merge.
+	if !strings.Contains(log.String(), "failed to report to Kubernetes") || !strings.Contains(log.String(), "403") {
+		t.Errorf("unexpected log %q", log.String())
+	}
+	if d.groups[0].merges != 1 {
+		t.Errorf("expected the merge to succeed")
+	}
+
+	if err := runDaemon(context.Background(), []string{"-manifest", files[1], "-k8s-status-configmap", "status"}, &log); err == nil {
+		t.Error("expected -k8s-status-configmap without -k8s to fail")
+	}
+	for key, valid := range map[string]bool{"web": true, "web-1.prod_a": true, "": false, "..": false, "a/b": false} {
+		if validConfigMapKey(key) != valid {
+			t.Errorf("validConfigMapKey(%q) != %v", key, valid)
+		}
+	}
+}
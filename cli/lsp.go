@@ -0,0 +1,614 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/goccy/go-yaml/token"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// runLSP implements "cfgmerge lsp", a Language Server Protocol server over stdio
+// for editing the files of a merge stack.
+func runLSP(_ context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	var merge mergeFlags
+	merge.register(fs)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: cfgmerge lsp [flags] FILE...\n\n")
+		fmt.Fprintf(out, "Serves the Language Server Protocol on stdin and stdout for the files of a\n")
+		fmt.Fprintf(out, "merge stack, given in merge order. Editors get the merged value of the key\n")
+		fmt.Fprintf(out, "under the cursor on hover, jump to the file that set it with go-to-definition,\n")
+		fmt.Fprintf(out, "and see merge errors such as duplicate primary keys as diagnostics.\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("no files to merge")
+	}
+
+	server, err := newLSPServer(merge.options(), fs.Args(), stdout)
+	if err != nil {
+		return err
+	}
+	server.yaml = merge.yaml
+	return server.serve(os.Stdin)
+}
+
+// JSON-RPC error codes used by the server.
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// rpcRequest is an incoming JSON-RPC request or notification (which has no ID).
+type rpcRequest struct {
+	ID     *json.RawMessage `json:"id"`
+	Method string           `json:"method"`
+	Params json.RawMessage  `json:"params"`
+}
+
+type rpcResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  any              `json:"result"`
+}
+
+type rpcErrorResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Error   rpcError         `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+// LSP protocol types, limited to the fields the server uses.
+type (
+	lspPosition struct {
+		Line      int `json:"line"`
+		Character int `json:"character"`
+	}
+	lspRange struct {
+		Start lspPosition `json:"start"`
+		End   lspPosition `json:"end"`
+	}
+	lspLocation struct {
+		URI   string   `json:"uri"`
+		Range lspRange `json:"range"`
+	}
+	lspTextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	}
+	lspPositionParams struct {
+		TextDocument lspTextDocument `json:"textDocument"`
+		Position     lspPosition     `json:"position"`
+	}
+	lspDidOpenParams struct {
+		TextDocument lspTextDocument `json:"textDocument"`
+	}
+	lspDidChangeParams struct {
+		TextDocument   lspTextDocument `json:"textDocument"`
+		ContentChanges []struct {
+			Text string `json:"text"`
+		} `json:"contentChanges"`
+	}
+	lspHover struct {
+		Contents lspMarkup `json:"contents"`
+		Range    lspRange  `json:"range"`
+	}
+	lspMarkup struct {
+		Kind  string `json:"kind"`
+		Value string `json:"value"`
+	}
+	lspDiagnostic struct {
+		Range    lspRange `json:"range"`
+		Severity int      `json:"severity"`
+		Source   string   `json:"source"`
+		Message  string   `json:"message"`
+	}
+	lspPublishDiagnosticsParams struct {
+		URI         string          `json:"uri"`
+		Diagnostics []lspDiagnostic `json:"diagnostics"`
+	}
+)
+
+// lspSeverityError is the LSP diagnostic severity for errors.
+const lspSeverityError = 1
+
+// lspServer answers editor requests about the files of a merge stack.
+// It handles one message at a time, so it needs no locking.
+type lspServer struct {
+	opts  keymerge.Options
+	yaml  yamlVersion
+	files []string // absolute paths, in merge order
+	// open holds the editor's contents of open files, which may be unsaved.
+	open map[string][]byte
+	out  io.Writer
+}
+
+func newLSPServer(opts keymerge.Options, files []string, out io.Writer) (*lspServer, error) {
+	s := &lspServer{opts: opts, open: map[string][]byte{}, out: out}
+	for _, file := range files {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		s.files = append(s.files, abs)
+	}
+	return s, nil
+}
+
+// serve handles messages from r until the client sends "exit" or closes the stream.
+func (s *lspServer) serve(r io.Reader) error {
+	reader := textproto.NewReader(bufio.NewReader(r))
+	for {
+		header, err := reader.ReadMIMEHeader()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil || length < 0 {
+			return fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader.R, body); err != nil {
+			return err
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			if err := s.send(rpcErrorResponse{JSONRPC: "2.0", Error: rpcError{Code: rpcParseError, Message: err.Error()}}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		if err := s.handle(req); err != nil {
+			return err
+		}
+	}
+}
+
+// handle dispatches a request or notification and sends any response.
+func (s *lspServer) handle(req rpcRequest) error {
+	var result any
+	var err error
+	switch req.Method {
+	case "initialize":
+		result = map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":   1, // full document sync
+				"hoverProvider":      true,
+				"definitionProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "cfgmerge", "version": version},
+		}
+	case "shutdown":
+		result = nil
+	case "textDocument/didOpen":
+		var params lspDidOpenParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			s.open[uriToPath(params.TextDocument.URI)] = []byte(params.TextDocument.Text)
+			return s.publishDiagnostics()
+		}
+	case "textDocument/didChange":
+		var params lspDidChangeParams
+		if err = json.Unmarshal(req.Params, &params); err == nil && len(params.ContentChanges) > 0 {
+			last := params.ContentChanges[len(params.ContentChanges)-1]
+			s.open[uriToPath(params.TextDocument.URI)] = []byte(last.Text)
+			return s.publishDiagnostics()
+		}
+	case "textDocument/didClose":
+		var params lspDidOpenParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			delete(s.open, uriToPath(params.TextDocument.URI))
+			return s.publishDiagnostics()
+		}
+	case "textDocument/hover":
+		var params lspPositionParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			result = s.hover(params)
+		}
+	case "textDocument/definition":
+		var params lspPositionParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			result = s.definition(params)
+		}
+	default:
+		if req.ID == nil {
+			return nil // ignore unsupported notifications
+		}
+		return s.send(rpcErrorResponse{JSONRPC: "2.0", ID: req.ID,
+			Error: rpcError{Code: rpcMethodNotFound, Message: "method not supported: " + req.Method}})
+	}
+
+	if req.ID == nil {
+		return nil
+	}
+	if err != nil {
+		return s.send(rpcErrorResponse{JSONRPC: "2.0", ID: req.ID,
+			Error: rpcError{Code: rpcInvalidParams, Message: err.Error()}})
+	}
+	return s.send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result})
+}
+
+// send writes a message with its Content-Length header.
+func (s *lspServer) send(msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+// stack is the merge stack as currently seen by the editor.
+type stack struct {
+	contents [][]byte
+	docs     []any
+	merger   *keymerge.UntypedMerger
+	trace    *keymerge.MergeTrace
+}
+
+// load reads and merges every file, preferring the editor's contents of open files.
+// The returned error identifies the file that failed, if any.
+func (s *lspServer) load() (*stack, int, error) {
+	st := &stack{contents: make([][]byte, len(s.files)), docs: make([]any, len(s.files))}
+	for i, file := range s.files {
+		contents, ok := s.open[file]
+		if !ok {
+			var err error
+			if contents, err = os.ReadFile(file); err != nil {
+				return nil, i, err
+			}
+		}
+		st.contents[i] = contents
+		if _, err := unmarshalBytes(file, contents, &st.docs[i], s.yaml); err != nil {
+			return nil, i, err
+		}
+	}
+
+	merger, err := keymerge.NewUntypedMerger(s.opts, nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	st.merger = merger
+	st.trace, err = merger.Trace(st.docs...)
+	if err != nil {
+		return nil, -1, err
+	}
+	return st, -1, nil
+}
+
+// publishDiagnostics reports the merge error, if any, against the file and
+// position it concerns, and clears diagnostics of every other file.
+func (s *lspServer) publishDiagnostics() error {
+	diagnostics := make([][]lspDiagnostic, len(s.files))
+	if _, fileIndex, err := s.load(); err != nil {
+		path, docIndex := errorLocation(err)
+		if fileIndex >= 0 {
+			docIndex = fileIndex
+		}
+		if docIndex < 0 || docIndex >= len(s.files) {
+			docIndex = 0
+		}
+		rng := lspRange{}
+		if path != "" {
+			if contents, err := s.read(docIndex); err == nil {
+				if node, ok := findNode(contents, path); ok {
+					rng = node.rng
+				}
+			}
+		}
+		diagnostics[docIndex] = []lspDiagnostic{{Range: rng, Severity: lspSeverityError, Source: "cfgmerge", Message: err.Error()}}
+	}
+
+	for i, file := range s.files {
+		params := lspPublishDiagnosticsParams{URI: pathToURI(file), Diagnostics: diagnostics[i]}
+		if params.Diagnostics == nil {
+			params.Diagnostics = []lspDiagnostic{}
+		}
+		if err := s.send(rpcNotification{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics", Params: params}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read returns the editor's or the file system's contents of a stack file.
+func (s *lspServer) read(i int) ([]byte, error) {
+	if contents, ok := s.open[s.files[i]]; ok {
+		return contents, nil
+	}
+	return os.ReadFile(s.files[i])
+}
+
+// errorLocation extracts the document index and position-only path of merge
+// errors that have them. The document index is -1 if unknown.
+func errorLocation(err error) (path string, docIndex int) {
+	// The paths of key errors end with the offending item's position.
+	var dupErr *keymerge.DuplicatePrimaryKeyError
+	if errors.As(err, &dupErr) {
+		return namesToPath(dupErr.Path), dupErr.DocIndex
+	}
+	var keyErr *keymerge.NonComparablePrimaryKeyError
+	if errors.As(err, &keyErr) {
+		return namesToPath(keyErr.Path), keyErr.DocIndex
+	}
+	var limitErr *keymerge.LimitError
+	if errors.As(err, &limitErr) {
+		return namesToPath(limitErr.Path), limitErr.DocIndex
+	}
+	return "", -1
+}
+
+// namesToPath converts a merger's error path to a path expression, treating
+// numeric names as list positions.
+func namesToPath(names []string) string {
+	var b strings.Builder
+	for _, name := range names {
+		if _, err := strconv.Atoi(name); err == nil {
+			b.WriteString("[" + name + "]")
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(name)
+	}
+	return b.String()
+}
+
+// hover returns the merged value of the key under the cursor and the file that set it.
+func (s *lspServer) hover(params lspPositionParams) any {
+	index, node, st := s.nodeAt(params)
+	if st == nil {
+		return nil
+	}
+	canonical, err := st.merger.CanonicalPath(st.docs[index], node.path)
+	if err != nil {
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s**", canonical)
+	value, found, err := keymerge.Lookup(st.trace.Result, canonical)
+	if err != nil {
+		return nil
+	}
+	if !found {
+		b.WriteString("\n\nNot present in the merged result.")
+	} else {
+		encoded, err := yaml.Marshal(encodeFor(value, "yaml"))
+		if err != nil {
+			return nil
+		}
+		fmt.Fprintf(&b, "\n\n```yaml\n%s```", encoded)
+		if source, err := st.trace.Source(canonical); err == nil && source >= 0 {
+			fmt.Fprintf(&b, "\n\nSet by `%s`", filepath.Base(s.files[source]))
+		}
+	}
+	return lspHover{Contents: lspMarkup{Kind: "markdown", Value: b.String()}, Range: node.rng}
+}
+
+// definition returns where the last file that changed the value under the cursor sets it.
+func (s *lspServer) definition(params lspPositionParams) any {
+	index, node, st := s.nodeAt(params)
+	if st == nil {
+		return nil
+	}
+	canonical, err := st.merger.CanonicalPath(st.docs[index], node.path)
+	if err != nil {
+		return nil
+	}
+	source, err := st.trace.Source(canonical)
+	if err != nil || source < 0 {
+		return nil
+	}
+
+	// Find the node closest to the value in the source file: the value itself,
+	// or its deepest ancestor if the source set a whole subtree.
+	location := lspLocation{URI: pathToURI(s.files[source])}
+	best := -1
+	for _, candidate := range yamlNodes(st.contents[source]) {
+		path, err := st.merger.CanonicalPath(st.docs[source], candidate.path)
+		if err != nil || !pathWithin(canonical, path) || len(path) <= best {
+			continue
+		}
+		best = len(path)
+		location.Range = candidate.rng
+	}
+	return location
+}
+
+// nodeAt finds the YAML node under the cursor in a stack file and loads the stack.
+// Returns a nil stack if there is no such node or the stack cannot be merged.
+func (s *lspServer) nodeAt(params lspPositionParams) (int, yamlNode, *stack) {
+	file := uriToPath(params.TextDocument.URI)
+	index := -1
+	for i, f := range s.files {
+		if f == file {
+			index = i
+		}
+	}
+	if index < 0 {
+		return -1, yamlNode{}, nil
+	}
+	st, _, err := s.load()
+	if err != nil {
+		return -1, yamlNode{}, nil
+	}
+
+	var found yamlNode
+	ok := false
+	for _, node := range yamlNodes(st.contents[index]) {
+		start := node.rng.Start
+		if start.Line != params.Position.Line || start.Character > params.Position.Character {
+			continue
+		}
+		// Prefer the rightmost node on the line, then the deepest.
+		if !ok || start.Character > found.rng.Start.Character ||
+			(start.Character == found.rng.Start.Character && len(node.path) > len(found.path)) {
+			found, ok = node, true
+		}
+	}
+	if !ok {
+		return -1, yamlNode{}, nil
+	}
+	return index, found, st
+}
+
+// pathWithin reports whether path equals ancestor or addresses a value beneath it.
+func pathWithin(path, ancestor string) bool {
+	if ancestor == "" || path == ancestor {
+		return true
+	}
+	return strings.HasPrefix(path, ancestor) && strings.ContainsRune(".[", rune(path[len(ancestor)]))
+}
+
+// yamlNode is a map entry or list item of a YAML (or JSON) file.
+type yamlNode struct {
+	// path addresses the node by field names and list positions.
+	path string
+	// rng spans the node's key, or the start of a list item.
+	rng lspRange
+}
+
+// yamlNodes returns every map entry and list item of a YAML or JSON document,
+// in document order. Returns nil if the contents cannot be parsed.
+func yamlNodes(contents []byte) []yamlNode {
+	file, err := parser.ParseBytes(contents, 0)
+	if err != nil || len(file.Docs) == 0 {
+		return nil
+	}
+	var nodes []yamlNode
+	collectNodes(file.Docs[0].Body, "", &nodes)
+	return nodes
+}
+
+// findNode returns the node at a position-only path expression.
+func findNode(contents []byte, path string) (yamlNode, bool) {
+	for _, node := range yamlNodes(contents) {
+		if node.path == path {
+			return node, true
+		}
+	}
+	return yamlNode{}, false
+}
+
+func collectNodes(node ast.Node, path string, nodes *[]yamlNode) {
+	switch n := node.(type) {
+	case *ast.AnchorNode:
+		collectNodes(n.Value, path, nodes)
+	case *ast.TagNode:
+		collectNodes(n.Value, path, nodes)
+	case *ast.MappingNode:
+		for _, value := range n.Values {
+			collectNodes(value, path, nodes)
+		}
+	case *ast.MappingValueNode:
+		key := n.Key.GetToken()
+		if key == nil || n.Key.IsMergeKey() {
+			return
+		}
+		child := appendKey(path, key.Value)
+		*nodes = append(*nodes, yamlNode{path: child, rng: tokenRange(key, len(key.Value))})
+		collectNodes(n.Value, child, nodes)
+	case *ast.SequenceNode:
+		for i, value := range n.Values {
+			child := path + "[" + strconv.Itoa(i) + "]"
+			if start := firstToken(value); start != nil {
+				*nodes = append(*nodes, yamlNode{path: child, rng: tokenRange(start, 0)})
+			}
+			collectNodes(value, child, nodes)
+		}
+	}
+}
+
+// appendKey appends a map key to a path expression, quoting it if needed.
+func appendKey(path, key string) string {
+	if key == "" || key == "*" || strings.ContainsAny(key, `.[]"`) {
+		return path + "[" + strconv.Quote(key) + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// firstToken returns the first token of a node, e.g. the first key of a mapping.
+func firstToken(node ast.Node) *token.Token {
+	switch n := node.(type) {
+	case *ast.AnchorNode:
+		return firstToken(n.Value)
+	case *ast.TagNode:
+		return firstToken(n.Value)
+	case *ast.MappingNode:
+		if len(n.Values) > 0 {
+			return firstToken(n.Values[0])
+		}
+	case *ast.MappingValueNode:
+		return n.Key.GetToken()
+	}
+	if node == nil {
+		return nil
+	}
+	return node.GetToken()
+}
+
+// tokenRange converts a token's 1-based position to an LSP range of the given length.
+func tokenRange(tok *token.Token, length int) lspRange {
+	start := lspPosition{Line: tok.Position.Line - 1, Character: tok.Position.Column - 1}
+	end := start
+	end.Character += length
+	return lspRange{Start: start, End: end}
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// lspSession runs the server over a sequence of messages and returns its output messages.
+func lspSession(t *testing.T, files []string, messages ...string) []map[string]any {
+	t.Helper()
+	var in, out bytes.Buffer
+	for _, msg := range messages {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+	server, err := newLSPServer(keymerge.Options{PrimaryKeyNames: []string{"name"}}, files, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.serve(&in); err != nil {
+		t.Fatal(err)
+	}
+
+	var responses []map[string]any
+	reader := textproto.NewReader(bufio.NewReader(&out))
+	for {
+		header, err := reader.ReadMIMEHeader()
+		if err == io.EOF {
+			return responses
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		length, _ := strconv.Atoi(header.Get("Content-Length"))
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader.R, body); err != nil {
+			t.Fatal(err)
+		}
+		var msg map[string]any
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, msg)
+	}
+}
+
+func positionRequest(id int, method, file string, line, character int) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":%q,"params":{"textDocument":{"uri":%q},"position":{"line":%d,"character":%d}}}`,
+		id, method, pathToURI(file), line, character)
+}
+
+func TestLSP_HoverAndDefinition(t *testing.T) {
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", "services:\n  - name: web\n    port: 80\n  - name: api\n    port: 8080\n",
+		"prod.yaml", "services:\n  - name: api\n    port: 9090\n",
+	)
+	base, prod := files[0], files[1]
+
+	responses := lspSession(t, files,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		// The api service's port, at the fourth line of the base.
+		positionRequest(2, "textDocument/hover", base, 4, 6),
+		positionRequest(3, "textDocument/definition", base, 4, 6),
+		// The web service is only set by the base.
+		positionRequest(4, "textDocument/definition", prod, 0, 0),
+		positionRequest(5, "textDocument/hover", base, 1, 20),
+		`{"jsonrpc":"2.0","id":6,"method":"textDocument/formatting","params":{}}`,
+		`{"jsonrpc":"2.0","id":7,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+	if len(responses) != 7 {
+		t.Fatalf("expected 7 responses, got %d: %v", len(responses), responses)
+	}
+
+	capabilities := responses[0]["result"].(map[string]any)["capabilities"].(map[string]any)
+	if capabilities["hoverProvider"] != true || capabilities["definitionProvider"] != true {
+		t.Errorf("unexpected capabilities %v", capabilities)
+	}
+
+	hover := responses[1]["result"].(map[string]any)["contents"].(map[string]any)["value"].(string)
+	for _, want := range []string{"**services[name=api].port**", "9090", "Set by `prod.yaml`"} {
+		if !strings.Contains(hover, want) {
+			t.Errorf("hover %q does not contain %q", hover, want)
+		}
+	}
+
+	location := responses[2]["result"].(map[string]any)
+	start := location["range"].(map[string]any)["start"].(map[string]any)
+	if location["uri"] != pathToURI(prod) || start["line"] != 2.0 || start["character"] != 4.0 {
+		t.Errorf("unexpected definition %v", location)
+	}
+
+	// "services" was last changed by prod.yaml, which defines it at its first line.
+	location = responses[3]["result"].(map[string]any)
+	if location["uri"] != pathToURI(prod) {
+		t.Errorf("unexpected definition %v", location)
+	}
+
+	hover = responses[4]["result"].(map[string]any)["contents"].(map[string]any)["value"].(string)
+	if !strings.Contains(hover, "**services[name=web].name**") || !strings.Contains(hover, "Set by `base.yaml`") {
+		t.Errorf("unexpected hover %q", hover)
+	}
+
+	if code := responses[5]["error"].(map[string]any)["code"]; code != float64(rpcMethodNotFound) {
+		t.Errorf("unexpected error code %v", code)
+	}
+	if result, ok := responses[6]["result"]; !ok || result != nil {
+		t.Errorf("unexpected shutdown response %v", responses[6])
+	}
+}
+
+func TestLSP_Diagnostics(t *testing.T) {
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", "services:\n  - name: web\n",
+		"prod.yaml", "services:\n  - name: api\n",
+	)
+	base, prod := files[0], files[1]
+
+	edited := "services:\n  - name: api\n  - name: api\n"
+	responses := lspSession(t, files,
+		fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":%q,"text":%q}}}`,
+			pathToURI(prod), edited),
+		fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didClose","params":{"textDocument":{"uri":%q}}}`,
+			pathToURI(prod)),
+	)
+	if len(responses) != 4 {
+		t.Fatalf("expected 4 notifications, got %d: %v", len(responses), responses)
+	}
+
+	diagnostics := func(i int) (string, []any) {
+		params := responses[i]["params"].(map[string]any)
+		return params["uri"].(string), params["diagnostics"].([]any)
+	}
+
+	// The duplicate in the unsaved buffer is reported at the second item.
+	uri, diags := diagnostics(0)
+	if uri != pathToURI(base) || len(diags) != 0 {
+		t.Errorf("unexpected diagnostics for %s: %v", uri, diags)
+	}
+	uri, diags = diagnostics(1)
+	if uri != pathToURI(prod) || len(diags) != 1 {
+		t.Fatalf("unexpected diagnostics for %s: %v", uri, diags)
+	}
+	diag := diags[0].(map[string]any)
+	start := diag["range"].(map[string]any)["start"].(map[string]any)
+	if start["line"] != 2.0 || !strings.Contains(diag["message"].(string), "duplicate") {
+		t.Errorf("unexpected diagnostic %v", diag)
+	}
+
+	// Closing the buffer reverts to the file on disk, which merges cleanly.
+	for i := 2; i < 4; i++ {
+		if uri, diags := diagnostics(i); len(diags) != 0 {
+			t.Errorf("unexpected diagnostics for %s: %v", uri, diags)
+		}
+	}
+}
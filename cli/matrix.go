@@ -0,0 +1,282 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// runMatrix implements "cfgmerge matrix", which merges each environment's
+// overlay onto the same base and tabulates the effective values of selected
+// paths in every environment.
+func runMatrix(_ context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("matrix", flag.ContinueOnError)
+	var merge mergeFlags
+	var base, reportPath string
+	var envs, paths pathList
+	var asJSON bool
+	merge.register(fs)
+	fs.StringVar(&base, "base", "", "base `FILE` every environment is merged onto (required)")
+	fs.Var(&envs, "envs", "environment overlays matching the glob `PATTERN` (may be repeated)")
+	fs.Var(&paths, "path", "show the value at `PATH` (may be repeated; default every path an environment changes)")
+	fs.BoolVar(&asJSON, "json", false, "write the matrix as JSON")
+	fs.StringVar(&reportPath, "report", "", "write the matrix as an HTML page to `FILE` instead")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: cfgmerge matrix [flags] -base BASE [-envs PATTERN] [ENV...]\n\n")
+		fmt.Fprintf(out, "Merges each environment overlay onto BASE separately and shows the merged\n")
+		fmt.Fprintf(out, "value of each path in every environment, one row per path, marking the rows\n")
+		fmt.Fprintf(out, "whose values differ. Environments are named after their files.\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if base == "" {
+		return errors.New("-base is required")
+	}
+	if asJSON && reportPath != "" {
+		return errors.New("-json and -report are mutually exclusive")
+	}
+
+	var files []string
+	for _, pattern := range envs {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid -envs pattern %q: %w", pattern, err)
+		}
+		files = append(files, matches...)
+	}
+	files = append(files, fs.Args()...)
+	if len(files) == 0 {
+		return errors.New("no environments to compare")
+	}
+
+	docs, _, err := loadDocuments(append([]string{base}, files...), merge.yaml)
+	if err != nil {
+		return err
+	}
+	m, err := buildMatrix(merge.options(), environmentNames(files), docs, paths)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case asJSON:
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	case reportPath != "":
+		var buf bytes.Buffer
+		if err := m.writeHTML(&buf); err != nil {
+			return err
+		}
+		return writeAtomic(reportPath, buf.Bytes())
+	default:
+		return m.write(stdout)
+	}
+}
+
+// matrix is the result of "cfgmerge matrix".
+type matrix struct {
+	// Environments names the environments in column order, after "base".
+	Environments []string    `json:"environments"`
+	Rows         []matrixRow `json:"rows"`
+}
+
+// matrixRow holds the merged values of one path.
+type matrixRow struct {
+	Path string `json:"path"`
+	// Values maps "base" and each environment with a value at the path to it.
+	Values map[string]any `json:"values"`
+	// Differs is set if the environments don't all have the same value.
+	Differs bool `json:"differs"`
+}
+
+// environmentNames names environments after their files without extensions,
+// or uses the file names as given if that makes two environments, or one and
+// the base column, alike.
+func environmentNames(files []string) []string {
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	sorted := append([]string{"base"}, names...)
+	slices.Sort(sorted)
+	if len(slices.Compact(sorted)) <= len(names) {
+		return slices.Clone(files)
+	}
+	return names
+}
+
+// buildMatrix merges each environment's document, docs[1:], onto the base,
+// docs[0], and looks up paths in the results. Without paths, it shows every
+// path that some environment changes from the base.
+func buildMatrix(opts keymerge.Options, envs []string, docs []any, paths []string) (*matrix, error) {
+	merger, err := keymerge.NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	base, err := merger.MergeUnstructured(docs[0])
+	if err != nil {
+		return nil, fmt.Errorf("merge of base failed: %w", err)
+	}
+	results := make([]any, len(envs))
+	changed := make(map[string]bool)
+	for i, env := range envs {
+		results[i], err = merger.MergeUnstructured(docs[0], docs[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("merge of %s failed: %w", env, err)
+		}
+		if len(paths) > 0 {
+			continue
+		}
+		changes, err := merger.Compare(base, results[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range changes {
+			changed[change.Path] = true
+		}
+	}
+	if len(paths) == 0 {
+		for path := range changed {
+			paths = append(paths, path)
+		}
+		slices.Sort(paths)
+	}
+
+	m := &matrix{Environments: envs, Rows: []matrixRow{}}
+	for _, path := range paths {
+		row := matrixRow{Path: path, Values: make(map[string]any)}
+		value, found, err := keymerge.Lookup(base, path)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			row.Values["base"] = value
+		}
+		var first any
+		for i, env := range envs {
+			value, found, err := keymerge.Lookup(results[i], path)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				value = missingValue{}
+			} else {
+				row.Values[env] = value
+			}
+			if i == 0 {
+				first = value
+				continue
+			}
+			changes, err := merger.Compare(first, value)
+			if err != nil {
+				return nil, err
+			}
+			row.Differs = row.Differs || len(changes) > 0
+		}
+		m.Rows = append(m.Rows, row)
+	}
+	return m, nil
+}
+
+// missingValue stands in for the value of a path an environment doesn't have,
+// so that it differs from every value.
+type missingValue struct{}
+
+// cell formats the value of a row in column name, or "-" if it has none.
+func (r matrixRow) cell(name string) string {
+	value, ok := r.Values[name]
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// write renders the matrix as a text table, marking rows that differ with "*".
+func (m *matrix) write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	header := append([]string{"", "PATH", "base"}, m.Environments...)
+	if _, err := fmt.Fprintln(tw, strings.Join(header, "\t")); err != nil {
+		return err
+	}
+	for _, row := range m.Rows {
+		mark := ""
+		if row.Differs {
+			mark = "*"
+		}
+		cells := []string{mark, row.Path, row.cell("base")}
+		for _, env := range m.Environments {
+			cells = append(cells, row.cell(env))
+		}
+		if _, err := fmt.Fprintln(tw, strings.Join(cells, "\t")); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// matrixPage is the HTML page that "cfgmerge matrix -report" writes.
+var matrixPage = template.Must(template.New("matrix").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Environment matrix</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; font-family: monospace; }
+tr.differs { background: #fff3cd; }
+td.missing { color: #999; }
+</style>
+</head>
+<body>
+<table>
+<tr><th>Path</th><th>base</th>{{range .Environments}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr{{if .Differs}} class="differs"{{end}}><td>{{.Path}}</td>{{range .Cells}}<td{{if .Missing}} class="missing"{{end}}>{{.Text}}</td>{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// writeHTML renders the matrix as an HTML page, highlighting rows that differ.
+func (m *matrix) writeHTML(w io.Writer) error {
+	type cell struct {
+		Text    string
+		Missing bool
+	}
+	type row struct {
+		Path    string
+		Differs bool
+		Cells   []cell
+	}
+	page := struct {
+		Environments []string
+		Rows         []row
+	}{Environments: m.Environments}
+	for _, r := range m.Rows {
+		out := row{Path: r.Path, Differs: r.Differs}
+		for _, name := range append([]string{"base"}, m.Environments...) {
+			_, ok := r.Values[name]
+			out.Cells = append(out.Cells, cell{Text: r.cell(name), Missing: !ok})
+		}
+		page.Rows = append(page.Rows, out)
+	}
+	return matrixPage.Execute(w, page)
+}
@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunMatrix(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "envs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	base := writeFiles(t, dir, "base.yaml", "replicas: 1\nimage: app:1\nservices:\n  - name: web\n    port: 80\n")[0]
+	writeFiles(t, filepath.Join(dir, "envs"),
+		"prod.yaml", "replicas: 3\nservices:\n  - name: web\n    port: 8080\n",
+		"staging.json", `{"image": "app:2", "debug": true}`)
+	envs := filepath.Join(dir, "envs", "*")
+
+	var out bytes.Buffer
+	if err := runMatrix(context.Background(), []string{"-base", base, "-envs", envs}, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := "   PATH                     base   prod   staging\n" +
+		"*  debug                    -      -      true\n" +
+		"*  image                    app:1  app:1  app:2\n" +
+		"*  replicas                 1      3      1\n" +
+		"*  services[name=web].port  80     8080   80\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	// Selected paths are shown whether or not they differ.
+	out.Reset()
+	args := []string{"-base", base, "-envs", envs, "-path", "services[0].name", "-path", "replicas", "-json"}
+	if err := runMatrix(context.Background(), args, &out); err != nil {
+		t.Fatal(err)
+	}
+	var m matrix
+	if err := json.Unmarshal(out.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	expected := matrix{
+		Environments: []string{"prod", "staging"},
+		Rows: []matrixRow{
+			{Path: "services[0].name", Values: map[string]any{"base": "web", "prod": "web", "staging": "web"}},
+			{Path: "replicas", Values: map[string]any{"base": 1.0, "prod": 3.0, "staging": 1.0}, Differs: true},
+		},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("got %+v, want %+v", m, expected)
+	}
+
+	report := filepath.Join(dir, "matrix.html")
+	if err := runMatrix(context.Background(), []string{"-base", base, "-envs", envs, "-report", report}, &out); err != nil {
+		t.Fatal(err)
+	}
+	page, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(page), `<tr class="differs"><td>image</td><td>app:1</td><td>app:1</td><td>app:2</td></tr>`) ||
+		!strings.Contains(string(page), `<td class="missing">-</td>`) {
+		t.Errorf("unexpected report:\n%s", page)
+	}
+
+	if err := runMatrix(context.Background(), []string{"-envs", envs}, &out); err == nil {
+		t.Error("expected error without -base")
+	}
+}
+
+func TestEnvironmentNames(t *testing.T) {
+	if got := environmentNames([]string{"envs/prod.yaml", "envs/staging.yaml"}); !reflect.DeepEqual(got, []string{"prod", "staging"}) {
+		t.Errorf("got %v", got)
+	}
+	files := []string{"prod/values.yaml", "staging/values.yaml"}
+	if got := environmentNames(files); !reflect.DeepEqual(got, files) {
+		t.Errorf("got %v, want the file names", got)
+	}
+	files = []string{"envs/base.yaml"}
+	if got := environmentNames(files); !reflect.DeepEqual(got, files) {
+		t.Errorf("got %v, want the file names", got)
+	}
+}
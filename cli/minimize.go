@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// runMinimize implements "cfgmerge minimize", which rewrites an overlay as the
+// smallest overlay with the same effect on its base.
+func runMinimize(_ context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("minimize", flag.ContinueOnError)
+	var merge mergeFlags
+	var outputFormat format
+	merge.register(fs)
+	fs.Var(&outputFormat, "format", "output format [json, yaml, toml] (default: format of OVERLAY)")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: cfgmerge minimize [flags] BASE... OVERLAY\n\n")
+		fmt.Fprintf(out, "Merges OVERLAY onto the files before it and writes the smallest overlay\n")
+		fmt.Fprintf(out, "that has the same effect: entries identical to the base are removed, and\n")
+		fmt.Fprintf(out, "maps and list items left with nothing to change are dropped.\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	files := fs.Args()
+	if len(files) < 2 {
+		return errors.New("expected BASE... OVERLAY")
+	}
+
+	inputs, err := readInputs(files, merge.yaml)
+	if err != nil {
+		return err
+	}
+	docs := make([]any, len(inputs))
+	for i, in := range inputs {
+		docs[i] = in.doc
+	}
+
+	overlay, err := minimizeOverlay(merge.options(), docs, merge.assertKey)
+	if err != nil {
+		return err
+	}
+	if outputFormat == "" {
+		outputFormat = inputs[len(inputs)-1].format
+	}
+	output, err := outputFormat.Marshal(overlay)
+	if err != nil {
+		return fmt.Errorf("failed to marshal overlay: %w", err)
+	}
+	_, err = stdout.Write(output)
+	return err
+}
+
+// minimizeOverlay returns the smallest overlay that, merged onto the merge of
+// all but the last of docs, produces the same result as the last. Assertions
+// the overlay makes (under assertKey) are kept as they are.
+func minimizeOverlay(opts keymerge.Options, docs []any, assertKey string) (any, error) {
+	merger, err := keymerge.NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	base, err := merger.MergeUnstructured(docs[:len(docs)-1]...)
+	if err != nil {
+		return nil, fmt.Errorf("merge of base failed: %w", err)
+	}
+	merged, err := merger.MergeUnstructured(base, docs[len(docs)-1])
+	if err != nil {
+		return nil, fmt.Errorf("merge of overlay failed: %w", err)
+	}
+
+	// The overlay is known to merge as intended, so conflicts don't matter here
+	opts.ConflictMode = keymerge.ConflictOverride
+	opts.ConflictMarkerKey = ""
+	overlay, err := keymerge.Diff(opts, base, merged)
+	if err != nil {
+		return nil, err
+	}
+
+	original, _ := docs[len(docs)-1].(map[string]any)
+	if assertions, ok := original[assertKey]; ok && assertKey != "" {
+		if minimized, ok := overlay.(map[string]any); ok {
+			minimized[assertKey] = assertions
+		}
+	}
+	return overlay, nil
+}
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestMinimize(t *testing.T) {
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", "log: info\nservices:\n  - name: web\n    port: 80\n    tls:\n      enabled: true\n  - name: debug\n    port: 9000\n",
+		"region.yaml", "zone: a\n",
+		"prod.yaml", strings.Join([]string{
+			"log: warn",
+			"zone: a",
+			"services:",
+			"  - name: web",
+			"    port: 80",
+			"    tls:",
+			"      enabled: true",
+			"  - name: debug",
+			"    _delete: true",
+			"  - name: gone",
+			"    _delete: true",
+			"_assert:",
+			"  path: log",
+			"  equals: warn",
+			"",
+		}, "\n"),
+	)
+
+	var out bytes.Buffer
+	if err := runMinimize(context.Background(), files, &out); err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Join([]string{
+		"_assert:",
+		"  equals: warn",
+		"  path: log",
+		"log: warn",
+		"services:",
+		"- _delete: true",
+		"  name: debug",
+		"",
+	}, "\n")
+	if out.String() != expected {
+		t.Fatalf("got:\n%s\nwant:\n%s", out.String(), expected)
+	}
+
+	out.Reset()
+	if err := runMinimize(context.Background(), append([]string{"-format", "json", "-conflicts", "strict"}, files[1], files[1]), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "{}" {
+		t.Errorf("expected an empty overlay, got %s", out.String())
+	}
+}
+
+func TestMinimize_Errors(t *testing.T) {
+	files := writeFiles(t, t.TempDir(), "base.yaml", "port: 80\n", "overlay.yaml", "port: 81\n")
+	if err := runMinimize(context.Background(), files[:1], &bytes.Buffer{}); err == nil {
+		t.Error("expected error for a single file")
+	}
+	if err := runMinimize(context.Background(), append([]string{"-conflicts", "strict"}, files...), &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "merge of overlay failed") {
+		t.Errorf("expected conflict error, got %v", err)
+	}
+	if err := runMinimize(context.Background(), []string{files[0], "missing.yaml"}, &bytes.Buffer{}); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
@@ -0,0 +1,156 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/goccy/go-yaml/token"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// yamlNumber is an exact number, which marshals to YAML as a plain scalar with
+// its decimal text.
+type yamlNumber json.Number
+
+func (n yamlNumber) MarshalYAML() ([]byte, error) {
+	return []byte(n), nil
+}
+
+// tomlNumber is an exact number, which marshals to TOML as an integer or float
+// if one holds it exactly.
+type tomlNumber json.Number
+
+func (n tomlNumber) MarshalTOML() ([]byte, error) {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return []byte(strconv.FormatInt(i, 10)), nil
+	}
+	exact, _ := new(big.Rat).SetString(string(n))
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err == nil {
+		text := strconv.FormatFloat(f, 'g', -1, 64)
+		if value, _ := new(big.Rat).SetString(text); exact != nil && value.Cmp(exact) == 0 {
+			if !strings.ContainsAny(text, ".e") {
+				text += ".0"
+			}
+			return []byte(text), nil
+		}
+	}
+	return nil, fmt.Errorf("%s cannot be written to TOML exactly", string(n))
+}
+
+// decimalLiteral matches YAML numbers written in decimal, which -exact-numbers
+// keeps exactly. Integers with leading zeros, which YAML versions read
+// differently, and other bases keep the parser's types.
+var decimalLiteral = regexp.MustCompile(`^[-+]?(0|[1-9][0-9]*)(\.[0-9]*)?([eE][-+]?[0-9]+)?$`)
+
+// exactNumberPrefix marks the strings that stand in for exact numbers while a
+// YAML document is decoded. It cannot occur in a plain scalar.
+const exactNumberPrefix = "\x00number:"
+
+// unmarshalExact unmarshals an input again, decoding numbers written in
+// decimal as json.Number so that they keep every digit. TOML numbers are
+// 64-bit integers and floats by definition, so TOML inputs are unchanged.
+func unmarshalExact(in input, version yamlVersion) (any, error) {
+	contents, err := readContents(in.contents)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	switch in.format {
+	case "yaml":
+		file, err := parser.ParseBytes(contents, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(file.Docs) == 0 || file.Docs[0].Body == nil {
+			return nil, nil
+		}
+		body := file.Docs[0].Body
+		if version != "" {
+			body = reinterpretScalars(body, version)
+		}
+		if err := yaml.NodeToValue(markNumbers(body), &doc); err != nil {
+			return nil, err
+		}
+		return restoreNumbers(doc), nil
+	case "json":
+		err := keymerge.UnmarshalJSONNumbers(contents, &doc)
+		return doc, err
+	case "toml":
+		return in.doc, nil
+	default:
+		return nil, fmt.Errorf("invalid format %q", in.format)
+	}
+}
+
+// markNumbers returns node with its plain decimal numbers replaced by strings
+// holding their text after exactNumberPrefix, for restoreNumbers to convert.
+func markNumbers(node ast.Node) ast.Node {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		for _, value := range n.Values {
+			value.Value = markNumbers(value.Value)
+		}
+	case *ast.MappingValueNode:
+		n.Value = markNumbers(n.Value)
+	case *ast.SequenceNode:
+		for i, value := range n.Values {
+			n.Values[i] = markNumbers(value)
+		}
+	case *ast.AnchorNode:
+		n.Value = markNumbers(n.Value)
+	case *ast.IntegerNode:
+		return markNumber(n.BaseNode, n.Token.Value, node)
+	case *ast.FloatNode:
+		return markNumber(n.BaseNode, n.Token.Value, node)
+	case *ast.StringNode:
+		// The parser reads integers too large for 64 bits as strings
+		if n.Token.Type == token.StringType {
+			return markNumber(n.BaseNode, n.Token.Value, node)
+		}
+	}
+	return node
+}
+
+// markNumber returns a marked string node for a number literal, or node if
+// the literal is not written in decimal.
+func markNumber(base *ast.BaseNode, literal string, node ast.Node) ast.Node {
+	if !decimalLiteral.MatchString(literal) {
+		return node
+	}
+	// Write the number as JSON does
+	literal = strings.TrimPrefix(literal, "+")
+	literal = strings.Replace(literal, ".e", "e", 1)
+	literal = strings.Replace(literal, ".E", "E", 1)
+	literal = strings.TrimSuffix(literal, ".")
+	return &ast.StringNode{BaseNode: base, Token: node.GetToken(), Value: exactNumberPrefix + literal}
+}
+
+// restoreNumbers replaces the strings markNumbers marked with json.Numbers.
+func restoreNumbers(doc any) any {
+	switch v := doc.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = restoreNumbers(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = restoreNumbers(value)
+		}
+	case string:
+		if literal, ok := strings.CutPrefix(v, exactNumberPrefix); ok {
+			return json.Number(literal)
+		}
+	}
+	return doc
+}
@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestExactNumbers(t *testing.T) {
+	dir := t.TempDir()
+	files := writeFiles(t, dir,
+		"base.yaml", "rate: 0.10\nquota: 12345678901234567890123\nratio: +1.e3\nmode: 0o17\n",
+		"overlay.json", `{"fee": 1.10, "limit": 9007199254740993}`)
+
+	var stdout, stderr bytes.Buffer
+	config := Config{Args: append([]string{"-exact-numbers"}, files...), Stdout: &stdout, Stderr: &stderr}
+	if err := Invoke(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	want := "fee: 1.10\nlimit: 9007199254740993\nmode: 15\nquota: 12345678901234567890123\nrate: 0.10\nratio: 1e3\n"
+	if stdout.String() != want {
+		t.Errorf("got %q, want %q", stdout.String(), want)
+	}
+
+	stdout.Reset()
+	config.Args = append([]string{"-exact-numbers", "-format", "json"}, files...)
+	if err := Invoke(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), `"quota": 12345678901234567890123`) ||
+		!strings.Contains(stdout.String(), `"rate": 0.10`) {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+
+	// TOML holds only 64-bit numbers, so anything larger is an error.
+	config.Args = append([]string{"-exact-numbers", "-format", "toml"}, files...)
+	if err := Invoke(context.Background(), config); err == nil ||
+		!strings.Contains(err.Error(), "12345678901234567890123 cannot be written to TOML exactly") {
+		t.Errorf("expected TOML error, got %v", err)
+	}
+	stdout.Reset()
+	small := writeFiles(t, dir, "small.yaml", "rate: 0.10\ncount: 3\nwhole: 2.0\n")
+	config.Args = append([]string{"-exact-numbers", "-format", "toml"}, small...)
+	if err := Invoke(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if want := "count = 3\nrate = 0.1\nwhole = 2.0\n"; stdout.String() != want {
+		t.Errorf("got %q, want %q", stdout.String(), want)
+	}
+
+	config.Args = append([]string{"-exact-numbers", "-preserve-order"}, files...)
+	if err := Invoke(context.Background(), config); err == nil {
+		t.Error("expected error combining -exact-numbers and -preserve-order")
+	}
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// errOPADenied indicates the OPA policy rejected the merged result.
+var errOPADenied = errors.New("denied by OPA policy")
+
+// opaClient asks an Open Policy Agent server whether a merged document is allowed.
+type opaClient struct {
+	// url is an OPA data API endpoint, e.g. http://localhost:8181/v1/data/config/deny.
+	url    string
+	client *http.Client
+}
+
+func newOPAClient(url string, timeout time.Duration) *opaClient {
+	return &opaClient{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+// check posts doc as the policy input and returns an error wrapping errOPADenied
+// if the decision denies it.
+//
+// The decision may be a boolean (false denies), a list of deny messages (any
+// message denies), or an object with an "allow" boolean and/or a "deny" list.
+func (o *opaClient) check(ctx context.Context, doc any) error {
+	body, err := json.Marshal(map[string]any{"input": doc})
+	if err != nil {
+		return fmt.Errorf("failed to encode OPA input: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("OPA query failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("OPA query failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("OPA query failed: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var decision struct {
+		Result *any `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return fmt.Errorf("invalid OPA response: %w", err)
+	}
+	if decision.Result == nil {
+		return fmt.Errorf("OPA decision at %s is undefined", o.url)
+	}
+
+	allowed, reasons, err := interpretDecision(*decision.Result)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		if len(reasons) == 0 {
+			return errOPADenied
+		}
+		return fmt.Errorf("%w: %s", errOPADenied, strings.Join(reasons, "; "))
+	}
+	return nil
+}
+
+// interpretDecision converts an OPA decision result into an allowed flag and deny reasons.
+func interpretDecision(result any) (allowed bool, reasons []string, err error) {
+	switch r := result.(type) {
+	case bool:
+		return r, nil, nil
+	case []any:
+		reasons = formatReasons(r)
+		return len(reasons) == 0, reasons, nil
+	case map[string]any:
+		allowed = true
+		if allow, ok := r["allow"]; ok {
+			b, ok := allow.(bool)
+			if !ok {
+				return false, nil, fmt.Errorf("OPA decision field \"allow\" is %T, not a boolean", allow)
+			}
+			allowed = b
+		}
+		if deny, ok := r["deny"]; ok {
+			list, ok := deny.([]any)
+			if !ok {
+				return false, nil, fmt.Errorf("OPA decision field \"deny\" is %T, not a list", deny)
+			}
+			reasons = formatReasons(list)
+		}
+		return allowed && len(reasons) == 0, reasons, nil
+	default:
+		return false, nil, fmt.Errorf("unsupported OPA decision type %T", result)
+	}
+}
+
+// formatReasons renders deny messages, which are usually strings but may be objects.
+func formatReasons(list []any) []string {
+	reasons := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			reasons = append(reasons, s)
+			continue
+		}
+		encoded, _ := json.Marshal(item)
+		reasons = append(reasons, string(encoded))
+	}
+	return reasons
+}
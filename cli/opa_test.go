@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// opaServer starts a fake OPA server that records the input it receives
+// and responds with the given body.
+func opaServer(t *testing.T, status int, body string) (*httptest.Server, *any) {
+	t.Helper()
+	var input any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input any `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		input = req.Input
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &input
+}
+
+func TestOPACheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		denied  bool
+		message string
+	}{
+		{"allow bool", `{"result": true}`, false, ""},
+		{"deny bool", `{"result": false}`, true, "denied by OPA policy"},
+		{"empty deny set", `{"result": []}`, false, ""},
+		{"deny set", `{"result": ["port too low", {"code": 1}]}`, true, `port too low; {"code":1}`},
+		{"allow object", `{"result": {"allow": true, "deny": []}}`, false, ""},
+		{"deny object", `{"result": {"allow": false}}`, true, "denied by OPA policy"},
+		{"deny messages", `{"result": {"deny": ["no debug"]}}`, true, "no debug"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, input := opaServer(t, http.StatusOK, tt.body)
+			doc := map[string]any{"port": 80}
+
+			err := newOPAClient(srv.URL, time.Second).check(context.Background(), doc)
+			if errors.Is(err, errOPADenied) != tt.denied {
+				t.Fatalf("denied = %v, want %v (err: %v)", err != nil, tt.denied, err)
+			}
+			if tt.denied && !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("expected %q in error, got %v", tt.message, err)
+			}
+			if (*input).(map[string]any)["port"] != float64(80) {
+				t.Errorf("unexpected input: %v", *input)
+			}
+		})
+	}
+}
+
+func TestOPACheck_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"server error", http.StatusInternalServerError, "boom"},
+		{"invalid JSON", http.StatusOK, "{"},
+		{"undefined decision", http.StatusOK, `{}`},
+		{"unsupported decision", http.StatusOK, `{"result": "yes"}`},
+		{"non-boolean allow", http.StatusOK, `{"result": {"allow": "yes"}}`},
+		{"non-list deny", http.StatusOK, `{"result": {"deny": "no"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := opaServer(t, tt.status, tt.body)
+			err := newOPAClient(srv.URL, time.Second).check(context.Background(), map[string]any{})
+			if err == nil || errors.Is(err, errOPADenied) {
+				t.Fatalf("expected query error, got %v", err)
+			}
+		})
+	}
+
+	if err := newOPAClient("http://127.0.0.1:0", time.Second).check(context.Background(), nil); err == nil {
+		t.Error("expected connection error")
+	}
+	if err := newOPAClient("http://unused", time.Second).check(context.Background(), func() {}); err == nil {
+		t.Error("expected encoding error")
+	}
+}
+
+func TestOPACheck_Canceled(t *testing.T) {
+	hung := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { <-hung }))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(hung) })
+
+	// Canceling stops the query long before the client's timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := newOPAClient(srv.URL, time.Minute).check(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestRunOPA(t *testing.T) {
+	srv, _ := opaServer(t, http.StatusOK, `{"result": ["denied"]}`)
+	files := writeFiles(t, t.TempDir(), "base.yaml", "a: 1\n")
+
+	var output bytes.Buffer
+	cfg := runConfig{files: files, opa: newOPAClient(srv.URL, time.Second)}
+	if err := cfg.run(context.Background(), &output); !errors.Is(err, errOPADenied) {
+		t.Fatalf("expected OPA denial, got %v", err)
+	}
+	if output.Len() != 0 {
+		t.Errorf("expected no output on denial, got %q", output.String())
+	}
+}
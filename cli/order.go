@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// unmarshalOrdered unmarshals an input again, keeping the order of its keys in
+// keymerge.OrderedMaps.
+func unmarshalOrdered(in input, version yamlVersion) (any, error) {
+	contents, err := readContents(in.contents)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	switch in.format {
+	case "yaml":
+		if err := unmarshalYAML(contents, &doc, version, yaml.UseOrderedMap()); err != nil {
+			return nil, err
+		}
+		return orderedFromYAML(doc), nil
+	case "json":
+		err := keymerge.UnmarshalOrderedJSON(contents, &doc)
+		return doc, err
+	case "toml":
+		var table map[string]any
+		meta, err := toml.Decode(string(contents), &table)
+		if err != nil {
+			return nil, err
+		}
+		order := make(map[string][]string)
+		seen := make(map[string]bool)
+		for _, key := range meta.Keys() {
+			if full := strings.Join(key, "\x00"); !seen[full] {
+				seen[full] = true
+				parent := strings.Join(key[:len(key)-1], "\x00")
+				order[parent] = append(order[parent], key[len(key)-1])
+			}
+		}
+		return orderedFromTOML(table, "", order), nil
+	default:
+		return nil, fmt.Errorf("invalid format %q", in.format)
+	}
+}
+
+// orderedFromYAML converts the yaml.MapSlices of a document to OrderedMaps.
+func orderedFromYAML(doc any) any {
+	switch v := doc.(type) {
+	case yaml.MapSlice:
+		ordered := &keymerge.OrderedMap{Values: make(map[string]any, len(v))}
+		for _, item := range v {
+			ordered.Set(fmt.Sprint(item.Key), orderedFromYAML(item.Value))
+		}
+		return ordered
+	case []any:
+		for i, item := range v {
+			v[i] = orderedFromYAML(item)
+		}
+	}
+	return doc
+}
+
+// orderedFromTOML converts the tables of a document to OrderedMaps, ordering
+// the keys of the table at path by order. The tables of an array share a path.
+// Keys TOML does not report, such as those of inline tables in arrays, are
+// sorted.
+func orderedFromTOML(doc any, path string, order map[string][]string) any {
+	child := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "\x00" + key
+	}
+	switch v := doc.(type) {
+	case map[string]any:
+		ordered := &keymerge.OrderedMap{Values: make(map[string]any, len(v))}
+		for _, key := range order[path] {
+			if value, ok := v[key]; ok {
+				ordered.Set(key, orderedFromTOML(value, child(key), order))
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			if _, ok := ordered.Values[key]; !ok {
+				ordered.Set(key, orderedFromTOML(v[key], child(key), order))
+			}
+		}
+		return ordered
+	case []map[string]any:
+		list := make([]any, len(v))
+		for i, table := range v {
+			list[i] = orderedFromTOML(table, path, order)
+		}
+		return list
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = orderedFromTOML(item, path, order)
+		}
+		return list
+	}
+	return doc
+}
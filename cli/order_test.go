@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestRunPreserveOrder(t *testing.T) {
+	dir := t.TempDir()
+	yamlFiles := writeFiles(t, dir,
+		"base.yaml", "zone: eu\nservices:\n  - name: web\n    replicas: 2\n    image: web:1\napp:\n  version: 1\n  debug: false\n",
+		"overlay.yaml", "app:\n  region: west\n  debug: true\nservices:\n  - name: web\n    limits: {memory: 1Gi}\n    image: web:2\n",
+	)
+	jsonFiles := writeFiles(t, dir,
+		"base.json", `{"zone": "eu", "app": {"version": "1", "debug": false}}`,
+		"overlay.json", `{"app": {"region": "west", "debug": true}}`,
+	)
+	tomlFiles := writeFiles(t, dir,
+		"base.toml", "zone = \"eu\"\n[app]\nversion = 1\ndebug = false\n",
+		"overlay.toml", "[app]\nregion = \"west\"\ndebug = true\n",
+	)
+	tests := []struct {
+		files  []string
+		format string
+		want   string
+	}{
+		{yamlFiles, "yaml", "zone: eu\nservices:\n- name: web\n  replicas: 2\n  image: web:2\n  limits:\n    memory: 1Gi\napp:\n  version: 1\n  debug: true\n  region: west\n"},
+		{yamlFiles, "json", "{\n  \"zone\": \"eu\",\n  \"services\": [\n    {\n      \"name\": \"web\",\n      \"replicas\": 2,\n      \"image\": \"web:2\",\n      \"limits\": {\n        \"memory\": \"1Gi\"\n      }\n    }\n  ],\n  \"app\": {\n    \"version\": 1,\n    \"debug\": true,\n    \"region\": \"west\"\n  }\n}"},
+		{jsonFiles, "yaml", "zone: eu\napp:\n  version: \"1\"\n  debug: true\n  region: west\n"},
+		{tomlFiles, "yaml", "zone: eu\napp:\n  version: 1\n  debug: true\n  region: west\n"},
+		// The TOML encoder sorts keys
+		{tomlFiles, "toml", "zone = \"eu\"\n\n[app]\n  debug = true\n  region = \"west\"\n  version = 1\n"},
+	}
+	for _, tt := range tests {
+		var output bytes.Buffer
+		cfg := runConfig{files: tt.files, preserveOrder: true}
+		cfg.merge.keys = primaryKeys{"name"}
+		if err := cfg.outputFormat.Set(tt.format); err != nil {
+			t.Fatal(err)
+		}
+		if err := cfg.run(context.Background(), &output); err != nil {
+			t.Fatal(err)
+		}
+		if output.String() != tt.want {
+			t.Errorf("%s as %s: got %q, want %q", tt.files[0], tt.format, output.String(), tt.want)
+		}
+	}
+}
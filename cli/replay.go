@@ -0,0 +1,306 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// replayCaseFile is the name of the file describing a corpus case.
+const replayCaseFile = "case.yaml"
+
+// runReplay implements "cfgmerge replay", which merges the recorded cases of a
+// corpus and reports those whose results no longer match.
+func runReplay(_ context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	var asJSON, update bool
+	fs.BoolVar(&asJSON, "json", false, "write the results as JSON")
+	fs.BoolVar(&update, "update", false, "record the current results as the expected ones instead of checking them")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: cfgmerge replay [flags] CORPUS\n\n")
+		fmt.Fprintf(out, "Merges every case in the CORPUS directory and reports the cases whose\n")
+		fmt.Fprintf(out, "results differ from the expected ones, e.g. before upgrading. A case is a\n")
+		fmt.Fprintf(out, "directory holding a %s like:\n\n", replayCaseFile)
+		fmt.Fprintf(out, "  flags: [-keys, name, -scalar, dedup]  # merge flags, as for cfgmerge\n")
+		fmt.Fprintf(out, "  inputs: [base.yaml, prod.yaml]\n")
+		fmt.Fprintf(out, "  expected: expected.yaml               # or error: MESSAGE\n\n")
+		fmt.Fprintf(out, "with paths relative to the case directory. Results are compared like\n")
+		fmt.Fprintf(out, "compare-artifact does, so keyed list items may differ in order.\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected a corpus directory")
+	}
+
+	cases, err := findReplayCases(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if len(cases) == 0 {
+		return fmt.Errorf("no %s files in %s", replayCaseFile, fs.Arg(0))
+	}
+
+	results := make([]replayResult, 0, len(cases))
+	for _, c := range cases {
+		var result replayResult
+		if update {
+			result = c.record()
+		} else {
+			result = c.replay()
+		}
+		results = append(results, result)
+		if !asJSON {
+			if err := result.write(stdout, update); err != nil {
+				return err
+			}
+		}
+	}
+	if asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, result := range results {
+		if !result.Passed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cases failed", failed, len(results))
+	}
+	if !asJSON && !update {
+		_, err := fmt.Fprintf(stdout, "%d cases passed\n", len(results))
+		return err
+	}
+	return nil
+}
+
+// replayCase is a recorded merge: its inputs, merge flags, and expected result
+// or error.
+type replayCase struct {
+	name     string
+	dir      string
+	Flags    []string `yaml:"flags"`
+	Inputs   []string `yaml:"inputs"`
+	Expected string   `yaml:"expected"`
+	Error    string   `yaml:"error"`
+}
+
+// findReplayCases loads the cases under corpus, named by their directories
+// relative to it.
+func findReplayCases(corpus string) ([]*replayCase, error) {
+	var cases []*replayCase
+	err := filepath.WalkDir(corpus, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != replayCaseFile {
+			return nil
+		}
+		c, err := loadReplayCase(path)
+		if err != nil {
+			return err
+		}
+		if c.name, err = filepath.Rel(corpus, c.dir); err != nil {
+			return err
+		}
+		c.name = filepath.ToSlash(c.name)
+		cases = append(cases, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+// loadReplayCase reads a case file, resolving its paths relative to its
+// directory.
+func loadReplayCase(file string) (*replayCase, error) {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	c := &replayCase{dir: filepath.Dir(file)}
+	if err := yaml.UnmarshalWithOptions(contents, c, yaml.Strict()); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	switch {
+	case len(c.Inputs) == 0:
+		return nil, fmt.Errorf("%s: no inputs", file)
+	case (c.Expected == "") == (c.Error == ""):
+		return nil, fmt.Errorf("%s: needs either expected or error", file)
+	}
+	for i, input := range c.Inputs {
+		c.Inputs[i] = filepath.Join(c.dir, input)
+	}
+	if c.Expected != "" {
+		c.Expected = filepath.Join(c.dir, c.Expected)
+	}
+	return c, nil
+}
+
+// replayResult is the outcome of replaying or recording a case.
+type replayResult struct {
+	Case   string `json:"case"`
+	Passed bool   `json:"passed"`
+	// Err is why the case could not be run, or the merge error if it was not
+	// the expected one.
+	Err string `json:"error,omitempty"`
+	// Changes are how the merged result differs from the expected one.
+	Changes *changelog `json:"changes,omitempty"`
+}
+
+// merge merges the case's inputs with its flags.
+func (c *replayCase) merge() (*keymerge.UntypedMerger, any, error) {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var merge mergeFlags
+	merge.register(fs)
+	if err := fs.Parse(c.Flags); err != nil {
+		return nil, nil, fmt.Errorf("invalid flags: %w", err)
+	}
+	if fs.NArg() > 0 {
+		return nil, nil, fmt.Errorf("unexpected flag arguments %v", fs.Args())
+	}
+	docs, _, err := loadDocuments(c.Inputs, merge.yaml)
+	if err != nil {
+		return nil, nil, err
+	}
+	merger, err := keymerge.NewUntypedMerger(merge.options(), nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	merged, mergeErr := merger.MergeUnstructured(docs...)
+	return merger, merged, mergeErr
+}
+
+// replay merges the case and compares the outcome with the expected one.
+func (c *replayCase) replay() replayResult {
+	result := replayResult{Case: c.name}
+	merger, merged, err := c.merge()
+	if merger == nil {
+		result.Err = err.Error()
+		return result
+	}
+	if c.Error != "" {
+		switch {
+		case err == nil:
+			result.Err = fmt.Sprintf("merge succeeded, expected error %q", c.Error)
+		case !strings.Contains(err.Error(), c.Error):
+			result.Err = err.Error()
+		default:
+			result.Passed = true
+		}
+		return result
+	}
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+
+	expected, _, err := loadDocuments([]string{c.Expected}, "")
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+	changes, err := merger.Compare(expected[0], merged)
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+	if len(changes) > 0 {
+		result.Changes = newChangelog(changes)
+		return result
+	}
+	result.Passed = true
+	return result
+}
+
+// record merges the case and writes its result as the expected one, or
+// updates its expected error to the merge error's message.
+func (c *replayCase) record() replayResult {
+	result := replayResult{Case: c.name}
+	merger, merged, err := c.merge()
+	switch {
+	case merger == nil:
+		result.Err = err.Error()
+	case err != nil && c.Error == "":
+		result.Err = fmt.Sprintf("merge failed, expected a result: %v", err)
+	case err == nil && c.Error != "":
+		result.Err = fmt.Sprintf("merge succeeded, expected error %q", c.Error)
+	case err != nil:
+		result.Passed = strings.Contains(err.Error(), c.Error)
+		if !result.Passed {
+			result.Err = err.Error()
+		}
+	default:
+		result.Err = c.writeExpected(merged)
+		result.Passed = result.Err == ""
+	}
+	return result
+}
+
+// writeExpected writes merged to the case's expected file, in the format of
+// its extension, returning why it could not.
+func (c *replayCase) writeExpected(merged any) string {
+	name := strings.TrimPrefix(strings.ToLower(filepath.Ext(c.Expected)), ".")
+	if name == "yml" {
+		name = "yaml"
+	}
+	f, ok := validFormats[name]
+	if !ok || f == "" {
+		return fmt.Sprintf("unsupported file format: %s", filepath.Ext(c.Expected))
+	}
+	data, err := f.Marshal(merged)
+	if err == nil {
+		err = writeAtomic(c.Expected, data)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// write writes a line for the result, followed by the differences from the
+// expected result if there are any.
+func (r replayResult) write(w io.Writer, update bool) error {
+	status := "PASS"
+	if update {
+		status = "RECORDED"
+	}
+	switch {
+	case r.Passed:
+		_, err := fmt.Fprintf(w, "%s %s\n", status, r.Case)
+		return err
+	case r.Err != "":
+		_, err := fmt.Fprintf(w, "FAIL %s: %s\n", r.Case, r.Err)
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "FAIL %s: result differs from expected\n", r.Case); err != nil {
+		return err
+	}
+	return r.Changes.write(w)
+}
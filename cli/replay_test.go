@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunReplay(t *testing.T) {
+	corpus := t.TempDir()
+	for _, sub := range []string{"services", "errors/duplicate", "lists"} {
+		if err := os.MkdirAll(filepath.Join(corpus, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFiles(t, filepath.Join(corpus, "services"),
+		"case.yaml", "flags: [-keys, name]\ninputs: [base.yaml, prod.json]\nexpected: expected.yaml\n",
+		"base.yaml", "services:\n  - name: web\n    port: 80\n  - name: db\n    port: 5432\n",
+		"prod.json", `{"services": [{"name": "web", "port": 8080}, {"name": "db", "_delete": true}]}`,
+		"expected.yaml", "services:\n  - name: web\n    port: 8080\n")
+	writeFiles(t, filepath.Join(corpus, "errors/duplicate"),
+		"case.yaml", "inputs: [base.yaml, overlay.yaml]\nerror: duplicate primary key\n",
+		"base.yaml", "hosts:\n  - name: a\n",
+		"overlay.yaml", "hosts:\n  - name: b\n  - name: b\n")
+	writeFiles(t, filepath.Join(corpus, "lists"),
+		"case.yaml", "flags: [-scalar, dedup]\ninputs: [base.yaml, overlay.yaml]\nexpected: expected.toml\n",
+		"base.yaml", "tags: [a, b]\n",
+		"overlay.yaml", "tags: [b, c]\n")
+
+	// Cases without expected results fail until they are recorded.
+	var out bytes.Buffer
+	if err := runReplay(context.Background(), []string{corpus}, &out); err == nil ||
+		err.Error() != "1 of 3 cases failed" {
+		t.Fatalf("expected the lists case to fail, got %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "FAIL lists: failed to read") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runReplay(context.Background(), []string{"-update", corpus}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "RECORDED errors/duplicate\nRECORDED lists\nRECORDED services\n"; out.String() != want {
+		t.Errorf("got output %q, want %q", out.String(), want)
+	}
+	out.Reset()
+	if err := runReplay(context.Background(), []string{corpus}, &out); err != nil {
+		t.Fatalf("%v\n%s", err, out.String())
+	}
+	if want := "PASS errors/duplicate\nPASS lists\nPASS services\n3 cases passed\n"; out.String() != want {
+		t.Errorf("got output %q, want %q", out.String(), want)
+	}
+
+	// A change in merge semantics is reported by path.
+	writeFiles(t, filepath.Join(corpus, "services"),
+		"case.yaml", "flags: [-keys, id]\ninputs: [base.yaml, prod.json]\nexpected: expected.yaml\n")
+	out.Reset()
+	err := runReplay(context.Background(), []string{"-json", corpus}, &out)
+	if err == nil || err.Error() != "1 of 3 cases failed" {
+		t.Fatalf("expected the services case to fail, got %v", err)
+	}
+	var results []replayResult
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[2].Case != "services" || results[2].Changes == nil {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if len(results[2].Changes.Changed) == 0 {
+		t.Errorf("expected changed paths, got %+v", results[2].Changes)
+	}
+
+	for _, args := range [][]string{{}, {t.TempDir()}} {
+		if err := runReplay(context.Background(), args, &out); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+}
+
+func TestLoadReplayCase(t *testing.T) {
+	dir := t.TempDir()
+	for _, contents := range []string{
+		"expected: out.yaml\n",
+		"inputs: [a.yaml]\n",
+		"inputs: [a.yaml]\nexpected: out.yaml\nerror: boom\n",
+		"inputs: [a.yaml]\nexpected: out.yaml\nunknown: true\n",
+	} {
+		writeFiles(t, dir, "case.yaml", contents)
+		if _, err := loadReplayCase(filepath.Join(dir, "case.yaml")); err == nil {
+			t.Errorf("expected error loading %q", contents)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// runReport implements "cfgmerge report", which lists base values overridden by
+// overlays and overlay values that are redundant because they match what they override.
+func runReport(_ context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	var merge mergeFlags
+	var asJSON bool
+	var paths pathList
+	merge.register(fs)
+	fs.BoolVar(&asJSON, "json", false, "write the report as JSON")
+	fs.Var(&paths, "path", "also show every file that set the value at `PATH`, in order (may be repeated)")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: cfgmerge report [flags] BASE OVERLAY...\n\n")
+		fmt.Fprintf(out, "Merges the files left-to-right and reports every value of BASE that the\n")
+		fmt.Fprintf(out, "merged result overrides or removes, and every overlay value that is\n")
+		fmt.Fprintf(out, "redundant because the files before it already produced the same value.\n")
+		fmt.Fprintf(out, "With -path, it also shows the precedence chain of each path: every file\n")
+		fmt.Fprintf(out, "that set the value, in merge order, with the values they shadowed.\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	files := fs.Args()
+	if len(files) == 0 {
+		return errors.New("no files to merge")
+	}
+
+	docs, _, err := loadDocuments(files, merge.yaml)
+	if err != nil {
+		return err
+	}
+
+	rep, err := buildReport(merge.options(), files, docs, paths)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	return rep.write(stdout)
+}
+
+// report is the result of "cfgmerge report".
+type report struct {
+	Overridden []overriddenValue `json:"overridden"`
+	Redundant  []redundantValue  `json:"redundant"`
+	Precedence []precedenceChain `json:"precedence,omitempty"`
+}
+
+// overriddenValue is a base value that differs in the merged result.
+type overriddenValue struct {
+	Path   string `json:"path"`
+	Kind   string `json:"kind"`
+	Base   any    `json:"base"`
+	Merged any    `json:"merged,omitempty"`
+	File   string `json:"file"`
+}
+
+// redundantValue is an overlay value that did not change the merged result.
+type redundantValue struct {
+	File string `json:"file"`
+	Path string `json:"path"`
+	// Value is the redundant value, as given in the overlay.
+	Value any `json:"value"`
+}
+
+// precedenceChain lists the files that set the value at a path, in merge order.
+type precedenceChain struct {
+	Path string `json:"path"`
+	// Merged is the value in the merged result, if it has one.
+	Merged   any           `json:"merged,omitempty"`
+	Settings []pathSetting `json:"settings"`
+}
+
+// pathSetting is the value a file set at a path.
+type pathSetting struct {
+	File  string `json:"file"`
+	Value any    `json:"value,omitempty"`
+	// Deleted is set if the file deleted the value with a delete marker.
+	Deleted bool `json:"deleted,omitempty"`
+	// Shadowed is set if a later file replaced or deleted the value. Maps and
+	// lists are merged rather than replaced, so only later deletions shadow them.
+	Shadowed bool `json:"shadowed"`
+}
+
+// pathList collects the values of a repeated flag.
+type pathList []string
+
+func (p *pathList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *pathList) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// buildReport traces the merge of docs and compares its result against the
+// base. It includes the precedence chain of each of paths.
+func buildReport(opts keymerge.Options, files []string, docs []any, paths []string) (*report, error) {
+	merger, err := keymerge.NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	trace, err := merger.Trace(docs...)
+	if err != nil {
+		return nil, fmt.Errorf("merge failed: %w", err)
+	}
+	changes, err := merger.Compare(docs[0], trace.Result)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &report{Overridden: []overriddenValue{}, Redundant: []redundantValue{}}
+	for _, change := range changes {
+		if change.Kind == keymerge.ChangeAdded {
+			continue
+		}
+		source, err := trace.Source(change.Path)
+		if err != nil {
+			return nil, err
+		}
+		value := overriddenValue{Path: change.Path, Kind: change.Kind.String(), Base: change.Old, Merged: change.New}
+		if source >= 0 {
+			value.File = files[source]
+		}
+		rep.Overridden = append(rep.Overridden, value)
+	}
+
+	for _, step := range trace.Steps {
+		for _, path := range step.Redundant {
+			value, _, err := keymerge.Lookup(docs[step.DocIndex], path)
+			if err != nil {
+				return nil, err
+			}
+			rep.Redundant = append(rep.Redundant, redundantValue{File: files[step.DocIndex], Path: path, Value: value})
+		}
+	}
+
+	for _, path := range paths {
+		chain, err := buildPrecedence(opts, files, docs, trace.Result, path)
+		if err != nil {
+			return nil, err
+		}
+		rep.Precedence = append(rep.Precedence, *chain)
+	}
+
+	return rep, nil
+}
+
+// buildPrecedence finds every document that sets or deletes the value at path.
+// Files that only set a parent map or list, or delete a parent item, are not
+// included.
+func buildPrecedence(opts keymerge.Options, files []string, docs []any, merged any, path string) (*precedenceChain, error) {
+	chain := &precedenceChain{Path: path, Settings: []pathSetting{}}
+	value, found, err := keymerge.Lookup(merged, path)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		chain.Merged = value
+	}
+
+	for i, doc := range docs {
+		value, found, err := keymerge.Lookup(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		setting := pathSetting{File: files[i], Value: value}
+		if mp, ok := value.(map[string]any); ok && opts.DeleteMarkerKey != "" && mp[opts.DeleteMarkerKey] == true {
+			setting = pathSetting{File: files[i], Deleted: true}
+		}
+		chain.Settings = append(chain.Settings, setting)
+	}
+
+	// A value is shadowed by the next file that replaces or deletes it
+	for i := range chain.Settings {
+		for _, later := range chain.Settings[i+1:] {
+			if later.Deleted || !isContainer(chain.Settings[i].Value) || !isContainer(later.Value) {
+				chain.Settings[i].Shadowed = !chain.Settings[i].Deleted
+				break
+			}
+		}
+	}
+	return chain, nil
+}
+
+// write renders the report as human-readable text.
+func (r *report) write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "Overridden base values (%d):\n", len(r.Overridden)); err != nil {
+		return err
+	}
+	for _, v := range r.Overridden {
+		var err error
+		if v.Kind == keymerge.ChangeRemoved.String() {
+			_, err = fmt.Fprintf(w, "  %s: %v removed by %s\n", v.Path, v.Base, v.File)
+		} else {
+			_, err = fmt.Fprintf(w, "  %s: %v -> %v (%s)\n", v.Path, v.Base, v.Merged, v.File)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "Redundant overlay values (%d):\n", len(r.Redundant)); err != nil {
+		return err
+	}
+	for _, v := range r.Redundant {
+		if _, err := fmt.Fprintf(w, "  %s: %s = %v\n", v.File, v.Path, v.Value); err != nil {
+			return err
+		}
+	}
+
+	for _, chain := range r.Precedence {
+		if err := chain.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write renders the precedence chain as human-readable text.
+func (c *precedenceChain) write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "Precedence of %s (%d):\n", c.Path, len(c.Settings)); err != nil {
+		return err
+	}
+	for _, s := range c.Settings {
+		var err error
+		switch {
+		case s.Deleted:
+			_, err = fmt.Fprintf(w, "  %s: deleted\n", s.File)
+		case s.Shadowed:
+			_, err = fmt.Fprintf(w, "  %s: %v (shadowed)\n", s.File, s.Value)
+		default:
+			_, err = fmt.Fprintf(w, "  %s: %v\n", s.File, s.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if c.Merged != nil {
+		if _, err := fmt.Fprintf(w, "  merged: %v\n", c.Merged); err != nil {
+			return err
+		}
+	}
+	return nil
+}
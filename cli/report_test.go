@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func reportFixture(t *testing.T) []string {
+	t.Helper()
+	return writeFiles(t, t.TempDir(),
+		"base.yaml", "log: info\nservices:\n  - name: web\n    port: 80\n  - name: debug\n    port: 9000\n",
+		"prod.yaml", "log: warn\nservices:\n  - name: web\n    port: 80\n    replicas: 3\n  - name: debug\n    _delete: true\n",
+		"region.json", `{"log": "warn", "zone": "a"}`,
+	)
+}
+
+func TestReport(t *testing.T) {
+	files := reportFixture(t)
+
+	var out bytes.Buffer
+	if err := runReport(context.Background(), files, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		"Overridden base values (2):",
+		"  log: info -> warn (" + files[1] + ")",
+		"  services[name=debug]: map[name:debug port:9000] removed by " + files[1],
+		"Redundant overlay values (2):",
+		"  " + files[1] + ": services[name=web].port = 80",
+		"  " + files[2] + ": log = warn",
+		"",
+	}, "\n")
+	if out.String() != expected {
+		t.Fatalf("unexpected report:\n%s\nwant:\n%s", out.String(), expected)
+	}
+}
+
+func TestReport_JSON(t *testing.T) {
+	files := reportFixture(t)
+
+	var out bytes.Buffer
+	if err := runReport(context.Background(), append([]string{"-json"}, files...), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	var rep report
+	if err := json.Unmarshal(out.Bytes(), &rep); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out.String())
+	}
+	if len(rep.Overridden) != 2 || rep.Overridden[0].Path != "log" || rep.Overridden[0].Kind != "modified" {
+		t.Fatalf("unexpected overridden values: %+v", rep.Overridden)
+	}
+	if rep.Overridden[1].Kind != "removed" || rep.Overridden[1].File != files[1] {
+		t.Fatalf("unexpected removal: %+v", rep.Overridden[1])
+	}
+	if len(rep.Redundant) != 2 || rep.Redundant[1].File != files[2] || rep.Redundant[1].Value != "warn" {
+		t.Fatalf("unexpected redundant values: %+v", rep.Redundant)
+	}
+}
+
+func TestReport_Empty(t *testing.T) {
+	files := writeFiles(t, t.TempDir(), "base.yaml", "a: 1\n", "overlay.yaml", "b: 2\n")
+
+	var out bytes.Buffer
+	if err := runReport(context.Background(), files, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "Overridden base values (0):\nRedundant overlay values (0):\n" {
+		t.Fatalf("unexpected report:\n%s", out.String())
+	}
+}
+
+func TestReport_Errors(t *testing.T) {
+	if err := runReport(context.Background(), nil, &bytes.Buffer{}); err == nil {
+		t.Error("expected error without files")
+	}
+	if err := runReport(context.Background(), []string{"missing.yaml"}, &bytes.Buffer{}); err == nil {
+		t.Error("expected error for missing file")
+	}
+	dupes := writeFiles(t, t.TempDir(), "a.yaml", "items: []\n", "b.yaml", "items:\n  - name: x\n  - name: x\n")
+	if err := runReport(context.Background(), append([]string{"-dupe", "unique"}, dupes...), &bytes.Buffer{}); err == nil {
+		t.Error("expected merge error for duplicate keys")
+	}
+}
+
+func TestReport_Precedence(t *testing.T) {
+	files := reportFixture(t)
+
+	var out bytes.Buffer
+	args := append([]string{"-path", "log", "-path", "services[name=debug]", "-path", "services[name=web]"}, files...)
+	if err := runReport(context.Background(), args, &out); err != nil {
+		t.Fatal(err)
+	}
+	_, chains, _ := strings.Cut(out.String(), "Precedence of ")
+	expected := strings.Join([]string{
+		"log (3):",
+		"  " + files[0] + ": info (shadowed)",
+		"  " + files[1] + ": warn (shadowed)",
+		"  " + files[2] + ": warn",
+		"  merged: warn",
+		"Precedence of services[name=debug] (2):",
+		"  " + files[0] + ": map[name:debug port:9000] (shadowed)",
+		"  " + files[1] + ": deleted",
+		"Precedence of services[name=web] (2):",
+		"  " + files[0] + ": map[name:web port:80]",
+		"  " + files[1] + ": map[name:web port:80 replicas:3]",
+		"  merged: map[name:web port:80 replicas:3]",
+		"",
+	}, "\n")
+	if chains != expected {
+		t.Fatalf("unexpected precedence:\n%s\nwant:\n%s", chains, expected)
+	}
+
+	out.Reset()
+	if err := runReport(context.Background(), append([]string{"-json", "-path", "zone"}, files...), &out); err != nil {
+		t.Fatal(err)
+	}
+	var rep report
+	if err := json.Unmarshal(out.Bytes(), &rep); err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Precedence) != 1 || rep.Precedence[0].Merged != "a" || len(rep.Precedence[0].Settings) != 1 ||
+		rep.Precedence[0].Settings[0].File != files[2] || rep.Precedence[0].Settings[0].Shadowed {
+		t.Fatalf("unexpected precedence: %+v", rep.Precedence)
+	}
+
+	if err := runReport(context.Background(), append([]string{"-path", "services["}, files...), &bytes.Buffer{}); err == nil {
+		t.Error("expected error for invalid path")
+	}
+}
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// checkUntrusted rejects files that could use excessive resources while they are
+// parsed, before they are parsed: files larger than maxBytes once decompressed,
+// and YAML files with aliases, which unmarshaling expands (e.g. "billion laughs"
+// documents).
+func checkUntrusted(files []string, maxBytes int) error {
+	for _, file := range files {
+		if err := checkUntrustedFile(file, maxBytes); err != nil {
+			return fmt.Errorf("refusing to merge %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+func checkUntrustedFile(file string, maxBytes int) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := decompressReader(f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	contents, err := io.ReadAll(io.LimitReader(r, int64(maxBytes)+1))
+	if err != nil {
+		return err
+	}
+	if len(contents) > maxBytes {
+		return fmt.Errorf("file is larger than %d bytes", maxBytes)
+	}
+	if contents, err = decodeText(contents); err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(uncompressedName(file))) {
+	case ".yaml", ".yml":
+		return checkYAMLAliases(contents)
+	}
+	return nil
+}
+
+// checkYAMLAliases rejects YAML documents with aliases.
+func checkYAMLAliases(contents []byte) error {
+	parsed, err := parser.ParseBytes(contents, 0)
+	if err != nil {
+		return err
+	}
+	for _, doc := range parsed.Docs {
+		if aliases := ast.Filter(ast.AliasType, doc); len(aliases) > 0 {
+			return fmt.Errorf("YAML aliases are not allowed in sandbox mode (line %d)",
+				aliases[0].GetToken().Position.Line)
+		}
+	}
+	return nil
+}
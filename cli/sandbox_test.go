@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestRunSandbox(t *testing.T) {
+	dir := t.TempDir()
+	files := writeFiles(t, dir,
+		"base.yaml", "defaults: &defaults\n  replicas: 1\nweb:\n  <<: *defaults\n",
+		"overlay.yaml", "web:\n  replicas: 3\n",
+		"deep.json", strings.Repeat(`{"a":`, 65)+"1"+strings.Repeat("}", 65),
+	)
+
+	var output bytes.Buffer
+	cfg := runConfig{files: files[:2], outputFormat: "yaml"}
+	if err := cfg.run(context.Background(), &output); err != nil {
+		t.Fatalf("aliases are allowed outside sandbox mode: %v", err)
+	}
+
+	cfg.sandbox = true
+	err := cfg.run(context.Background(), &output)
+	if err == nil || !strings.Contains(err.Error(), "YAML aliases are not allowed in sandbox mode (line 4)") {
+		t.Fatalf("expected alias error, got %v", err)
+	}
+
+	output.Reset()
+	cfg.files = files[1:2]
+	if err := cfg.run(context.Background(), &output); err != nil {
+		t.Fatalf("plain overlay should be accepted: %v", err)
+	}
+	if output.String() != "web:\n  replicas: 3\n" {
+		t.Errorf("unexpected output %q", output.String())
+	}
+
+	cfg.files = files[1:]
+	err = cfg.run(context.Background(), &output)
+	if !errors.Is(err, keymerge.ErrLimitExceeded) {
+		t.Fatalf("expected limit error for deep document, got %v", err)
+	}
+}
+
+func TestCheckUntrusted_Size(t *testing.T) {
+	files := writeFiles(t, t.TempDir(), "big.json", `{"key": "value"}`)
+
+	if err := checkUntrusted(files, 16); err != nil {
+		t.Fatalf("file fits the limit: %v", err)
+	}
+	err := checkUntrusted(files, 15)
+	if err == nil || !strings.Contains(err.Error(), "larger than 15 bytes") {
+		t.Fatalf("expected size error, got %v", err)
+	}
+}
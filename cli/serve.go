@@ -0,0 +1,348 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// runServe implements "cfgmerge serve", a web page for previewing the merge of
+// a pasted base and overlay, with permalinks to share previews.
+func runServe(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	var merge mergeFlags
+	var listen, storeDir string
+	var maxBytes int
+	merge.register(flags)
+	flags.StringVar(&listen, "listen", "localhost:8080", "`ADDRESS` to serve the preview page on")
+	flags.StringVar(&storeDir, "store", "", "keep shared previews as files in `DIR` (default in memory, up to 1000)")
+	flags.IntVar(&maxBytes, "max-bytes", 1<<20, "largest preview to accept, in bytes of both documents")
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintf(out, "usage: cfgmerge serve [flags]\n\n")
+		fmt.Fprintf(out, "Serves a page where a base and an overlay can be pasted and merged. The merged\n")
+		fmt.Fprintf(out, "result is shown with each value colored by the document that set it, and each\n")
+		fmt.Fprintf(out, "preview gets a permalink, /p/ID, for discussing proposed overlay changes.\n")
+		fmt.Fprintf(out, "Previews are merged with the merge flags, under sandbox limits.\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return errors.New("expected no arguments")
+	}
+	if maxBytes <= 0 {
+		return errors.New("-max-bytes must be positive")
+	}
+
+	s := &previewServer{opts: merge.options(), yaml: merge.yaml, maxBytes: maxBytes}
+	if storeDir == "" {
+		s.store = newMemoryStore(1000)
+	} else {
+		if err := os.MkdirAll(storeDir, 0o755); err != nil {
+			return err
+		}
+		s.store = fileStore(storeDir)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	_, _ = fmt.Fprintf(stdout, "serving merge previews on http://%s/\n", listener.Addr())
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// preview is a base and overlay as pasted, which a permalink refers to.
+type preview struct {
+	Base    string `json:"base"`
+	Overlay string `json:"overlay"`
+}
+
+// id returns the preview's permalink ID, derived from its contents so that
+// sharing the same documents twice gives the same link.
+func (p preview) id() string {
+	encoded, _ := json.Marshal(p)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:8])
+}
+
+// validPreviewID reports whether id could have been made by preview.id, so
+// that IDs from URLs can name files safely.
+func validPreviewID(id string) bool {
+	if len(id) != 16 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// previewStore keeps shared previews by ID.
+type previewStore interface {
+	put(id string, p preview) error
+	// get returns the preview with the ID, and false if there is none.
+	get(id string) (preview, bool, error)
+}
+
+// memoryStore keeps the most recent previews in memory.
+type memoryStore struct {
+	mu       sync.Mutex
+	previews map[string]preview
+	order    []string // IDs from oldest to newest
+	limit    int
+}
+
+func newMemoryStore(limit int) *memoryStore {
+	return &memoryStore{previews: make(map[string]preview), limit: limit}
+}
+
+func (s *memoryStore) put(id string, p preview) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.previews[id]; ok {
+		return nil
+	}
+	if len(s.order) >= s.limit {
+		delete(s.previews, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.previews[id] = p
+	s.order = append(s.order, id)
+	return nil
+}
+
+func (s *memoryStore) get(id string) (preview, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.previews[id]
+	return p, ok, nil
+}
+
+// fileStore keeps previews as JSON files in a directory, so that links
+// outlive the server.
+type fileStore string
+
+func (s fileStore) put(id string, p preview) error {
+	encoded, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(filepath.Join(string(s), id+".json"), encoded)
+}
+
+func (s fileStore) get(id string) (preview, bool, error) {
+	contents, err := os.ReadFile(filepath.Join(string(s), id+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return preview{}, false, nil
+	}
+	if err != nil {
+		return preview{}, false, err
+	}
+	var p preview
+	if err := json.Unmarshal(contents, &p); err != nil {
+		return preview{}, false, fmt.Errorf("preview %s: %w", id, err)
+	}
+	return p, true, nil
+}
+
+// previewServer serves the preview page.
+type previewServer struct {
+	opts     keymerge.Options
+	yaml     yamlVersion
+	store    previewStore
+	maxBytes int
+}
+
+// handler serves the empty form on /, takes pasted documents on POST /merge,
+// and shows shared previews on /p/ID.
+func (s *previewServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, _ *http.Request) {
+		s.write(w, http.StatusOK, previewPage{})
+	})
+	mux.HandleFunc("POST /merge", func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(s.maxBytes))
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, fmt.Sprintf("preview larger than %d bytes", s.maxBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		p := preview{Base: r.PostForm.Get("base"), Overlay: r.PostForm.Get("overlay")}
+		id := p.id()
+		if err := s.store.put(id, p); err != nil {
+			http.Error(w, "failed to save preview", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/p/"+id, http.StatusSeeOther)
+	})
+	mux.HandleFunc("GET /p/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		var p preview
+		found := false
+		var err error
+		if validPreviewID(id) {
+			p, found, err = s.store.get(id)
+		}
+		switch {
+		case err != nil:
+			http.Error(w, "failed to load preview", http.StatusInternalServerError)
+		case !found:
+			http.Error(w, "no such preview", http.StatusNotFound)
+		default:
+			page, err := s.render(id, p)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			s.write(w, http.StatusOK, page)
+		}
+	})
+	return mux
+}
+
+// previewPage is what the preview page shows.
+type previewPage struct {
+	ID      string
+	Preview preview
+	Error   string
+	Rows    []previewRow
+}
+
+// previewRow is a value of the merged result.
+type previewRow struct {
+	Depth int
+	Label string
+	// Value is the value of a scalar, or "" for maps and lists.
+	Value string
+	// Source is "base" or "overlay", for the document that last set the
+	// value, or "" if neither did.
+	Source string
+}
+
+// render merges a preview's documents into the page that shows it. Problems
+// with the documents are shown on the page; an error means the merge could not
+// be sandboxed, so the page must not be served.
+func (s *previewServer) render(id string, p preview) (previewPage, error) {
+	page := previewPage{ID: id, Preview: p}
+	names := []string{"base", "overlay"}
+	docs := make([]any, len(names))
+	for i, text := range []string{p.Base, p.Overlay} {
+		err := checkYAMLAliases([]byte(text))
+		if err == nil {
+			err = unmarshalYAML([]byte(text), &docs[i], s.yaml)
+		}
+		if err != nil {
+			page.Error = fmt.Sprintf("failed to read %s: %v", names[i], err)
+			return page, nil
+		}
+	}
+
+	merger, err := keymerge.NewUntypedMerger(s.opts, nil, nil)
+	if err != nil {
+		page.Error = err.Error()
+		return page, nil
+	}
+	if err := merger.SetLimits(keymerge.SandboxLimits()); err != nil {
+		return page, fmt.Errorf("failed to limit the merge: %w", err)
+	}
+	merger.SetDocumentNames(names...)
+	trace, err := merger.Trace(docs...)
+	if err != nil {
+		page.Error = fmt.Sprintf("merge failed: %v", err)
+		return page, nil
+	}
+	page.Rows = previewRows(merger, trace, "", 0, names)
+	return page, nil
+}
+
+// previewRows lists the values under path in the merged result, depth levels
+// deep, each with the name of the document that last set it.
+func previewRows(merger *keymerge.UntypedMerger, trace *keymerge.MergeTrace, path string, depth int, names []string) []previewRow {
+	var rows []previewRow
+	for _, c := range childPaths(merger, trace.Result, path) {
+		row := previewRow{Depth: depth, Label: c.label}
+		if index, err := trace.Source(c.path); err == nil && index >= 0 {
+			row.Source = names[index]
+		}
+		if !isContainer(c.value) {
+			row.Value = summarize(c.value)
+		}
+		rows = append(rows, row)
+		if isContainer(c.value) {
+			rows = append(rows, previewRows(merger, trace, c.path, depth+1, names)...)
+		}
+	}
+	return rows
+}
+
+// write renders page with the HTTP status.
+func (s *previewServer) write(w http.ResponseWriter, status int, page previewPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_ = previewTemplate.Execute(w, page)
+}
+
+// previewTemplate is the preview page.
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Merge preview</title>
+<style>
+body { font-family: sans-serif; }
+textarea { width: 100%; height: 12em; font-family: monospace; }
+.columns { display: flex; gap: 1em; }
+.columns > div { flex: 1; }
+.result { font-family: monospace; }
+.base { background: #e8f0fe; }
+.overlay { background: #fff3cd; }
+.error { color: #b00020; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<form method="post" action="/merge">
+<div class="columns">
+<div><label for="base">Base</label><textarea id="base" name="base">{{.Preview.Base}}</textarea></div>
+<div><label for="overlay">Overlay</label><textarea id="overlay" name="overlay">{{.Preview.Overlay}}</textarea></div>
+</div>
+<button type="submit">Merge</button>
+</form>
+{{if .ID}}<p>Permalink: <a href="/p/{{.ID}}">/p/{{.ID}}</a></p>{{end}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if .Rows}}<p>Set by: <span class="base">base</span> <span class="overlay">overlay</span></p>
+<div class="result">
+{{range .Rows}}<div class="{{.Source}}" style="padding-left: {{.Depth}}em">{{.Label}}:{{if .Value}} {{.Value}}{{end}}</div>
+{{end}}</div>{{end}}
+</body>
+</html>
+`))
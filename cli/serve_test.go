@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// postPreview submits a base and overlay and returns the permalink it is
+// redirected to.
+func postPreview(t *testing.T, handler http.Handler, base, overlay string) string {
+	t.Helper()
+	form := url.Values{"base": {base}, "overlay": {overlay}}
+	req := httptest.NewRequest(http.MethodPost, "/merge", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("POST /merge: status %d: %s", rec.Code, rec.Body)
+	}
+	return rec.Header().Get("Location")
+}
+
+func getPage(handler http.Handler, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestServePreview(t *testing.T) {
+	s := &previewServer{
+		opts:     keymerge.Options{PrimaryKeyNames: []string{"name"}},
+		store:    newMemoryStore(10),
+		maxBytes: 1 << 10,
+	}
+	handler := s.handler()
+
+	if rec := getPage(handler, "/"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `action="/merge"`) {
+		t.Fatalf("GET /: status %d: %s", rec.Code, rec.Body)
+	}
+
+	base := "web:\n  port: 80\n  host: example.com\n"
+	overlay := "web:\n  port: 8080\n"
+	link := postPreview(t, handler, base, overlay)
+	if !strings.HasPrefix(link, "/p/") {
+		t.Fatalf("unexpected permalink %q", link)
+	}
+	if again := postPreview(t, handler, base, overlay); again != link {
+		t.Errorf("the same documents got permalinks %q and %q", link, again)
+	}
+
+	rec := getPage(handler, link)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d", link, rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`<div class="overlay" style="padding-left: 1em">port: 8080</div>`,
+		`<div class="base" style="padding-left: 1em">host: example.com</div>`,
+		`href="` + link + `"`,
+		"host: example.com\n</textarea>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page lacks %q:\n%s", want, body)
+		}
+	}
+
+	if rec := getPage(handler, "/p/0123456789abcdef"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown preview: status %d", rec.Code)
+	}
+	if rec := getPage(handler, "/p/..%2fsecret"); rec.Code != http.StatusNotFound {
+		t.Errorf("invalid preview ID: status %d", rec.Code)
+	}
+}
+
+func TestServePreview_Errors(t *testing.T) {
+	s := &previewServer{
+		opts:     keymerge.Options{ConflictMode: keymerge.ConflictStrict},
+		store:    newMemoryStore(10),
+		maxBytes: 1 << 10,
+	}
+	handler := s.handler()
+
+	for overlay, want := range map[string]string{
+		"port: 8080\n":          "merge failed: conflicting value at path port in document 1 (overlay)",
+		"a: &x 1\nb: *x\n":      "failed to read overlay: YAML aliases are not allowed",
+		"port: [unterminated\n": "failed to read overlay",
+	} {
+		body := getPage(handler, postPreview(t, handler, "port: 80\n", overlay)).Body.String()
+		if !strings.Contains(body, want) {
+			t.Errorf("overlay %q: page lacks %q:\n%s", overlay, want, body)
+		}
+	}
+
+	form := url.Values{"base": {strings.Repeat("x", 2<<10)}}
+	req := httptest.NewRequest(http.MethodPost, "/merge", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized preview: status %d", rec.Code)
+	}
+}
+
+func TestServePreview_FileStore(t *testing.T) {
+	dir := t.TempDir()
+	first := (&previewServer{store: fileStore(dir), maxBytes: 1 << 10}).handler()
+	link := postPreview(t, first, "a: 1\n", "b: 2\n")
+
+	// Links keep working after a restart
+	second := (&previewServer{store: fileStore(dir), maxBytes: 1 << 10}).handler()
+	if rec := getPage(second, link); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "b: 2") {
+		t.Errorf("GET %s: status %d: %s", link, rec.Code, rec.Body)
+	}
+}
+
+func TestMemoryStoreLimit(t *testing.T) {
+	store := newMemoryStore(2)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := store.put(id, preview{Base: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, found, _ := store.get("a"); found {
+		t.Error("expected the oldest preview to be evicted")
+	}
+	if p, found, _ := store.get("c"); !found || p.Base != "c" {
+		t.Errorf("got %v, %v", p, found)
+	}
+}
+
+func TestRunServeErrors(t *testing.T) {
+	if err := runServe(context.Background(), []string{"extra"}, nil); err == nil {
+		t.Error("expected error for arguments")
+	}
+	if err := runServe(context.Background(), []string{"-max-bytes", "0"}, nil); err == nil {
+		t.Error("expected error for -max-bytes 0")
+	}
+}
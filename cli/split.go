@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// writeSplit writes each top-level key of merged to its own file in c.splitDir,
+// named after the key with the output's extension (e.g. services.yaml). Each
+// file is a document holding only its key, so merging the files again gives
+// back merged.
+func (c *runConfig) writeSplit(merged any, outputFormat format) error {
+	var keys []string
+	var part func(key string) any
+	switch m := merged.(type) {
+	case map[string]any:
+		for key := range m {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		part = func(key string) any { return map[string]any{key: m[key]} }
+	case *keymerge.OrderedMap:
+		keys = m.Keys
+		part = func(key string) any {
+			return &keymerge.OrderedMap{Keys: []string{key}, Values: map[string]any{key: m.Values[key]}}
+		}
+	default:
+		return fmt.Errorf("cannot split a merged result of type %T by key; it must be a map", merged)
+	}
+	for _, key := range keys {
+		if !validFileName(key) {
+			return fmt.Errorf("cannot split by key: %q is not a valid file name", key)
+		}
+	}
+
+	if err := os.MkdirAll(c.splitDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	for _, key := range keys {
+		marshaled, err := c.encode([]any{part(key)}, outputFormat)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		file := filepath.Join(c.splitDir, key+"."+string(outputFormat)+c.compression.extension())
+		if err := writeAtomic(file, marshaled); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validFileName reports whether name can be used as the name of a file in a
+// directory without referring to another directory.
+func validFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`+"\x00")
+}
+
+// checkSplitFlags checks that -split-by-key and -out-dir are used together,
+// and without the flags for a single output.
+func checkSplitFlags(splitByKey bool, outDir, outputPath, attestPath string) error {
+	switch {
+	case splitByKey && outDir == "":
+		return errors.New("-split-by-key requires -out-dir")
+	case !splitByKey && outDir != "":
+		return errors.New("-out-dir requires -split-by-key")
+	case splitByKey && outputPath != "":
+		return errors.New("-split-by-key and -out are mutually exclusive")
+	case splitByKey && attestPath != "":
+		return errors.New("-attest does not support -split-by-key")
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunSplitByKey(t *testing.T) {
+	dir := t.TempDir()
+	files := writeFiles(t, dir,
+		"base.yaml", "services:\n  - name: web\n    port: 80\nusers: [alice]\n",
+		"overlay.yaml", "services:\n  - name: web\n    port: 8080\nversion: 2\n",
+	)
+	outDir := filepath.Join(dir, "out")
+	var output bytes.Buffer
+	cfg := runConfig{files: files, splitDir: outDir}
+	cfg.merge.keys = primaryKeys{"name"}
+	if err := cfg.run(context.Background(), &output); err != nil {
+		t.Fatal(err)
+	}
+	if output.Len() != 0 {
+		t.Errorf("unexpected output %q", output.String())
+	}
+	for name, want := range map[string]string{
+		"services.yaml": "services:\n- name: web\n  port: 8080\n",
+		"users.yaml":    "users:\n- alice\n",
+		"version.yaml":  "version: 2\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(outDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+
+	// The files merge back to the whole result.
+	parts, err := filepath.Glob(filepath.Join(outDir, "*.yaml"))
+	if err != nil || len(parts) != 3 {
+		t.Fatalf("unexpected files %v, %v", parts, err)
+	}
+	var whole, rejoined bytes.Buffer
+	cfg.splitDir = ""
+	if err := cfg.run(context.Background(), &whole); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&runConfig{files: parts}).run(context.Background(), &rejoined); err != nil {
+		t.Fatal(err)
+	}
+	if whole.String() != rejoined.String() {
+		t.Errorf("got %q, want %q", rejoined.String(), whole.String())
+	}
+}
+
+func TestRunSplitByKey_Errors(t *testing.T) {
+	dir := t.TempDir()
+	for _, contents := range []string{"- a\n- b\n", "../escape: 1\n", "\"\": 1\n"} {
+		files := writeFiles(t, dir, "doc.yaml", contents)
+		cfg := runConfig{files: files, splitDir: filepath.Join(dir, "out")}
+		if err := cfg.run(context.Background(), &bytes.Buffer{}); err == nil {
+			t.Errorf("expected %q to fail", contents)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.yaml")); !os.IsNotExist(err) {
+		t.Error("expected no file outside the output directory")
+	}
+
+	for _, tt := range []struct {
+		split                  bool
+		outDir, output, attest string
+	}{
+		{split: true},
+		{outDir: "out"},
+		{split: true, outDir: "out", output: "config.yaml"},
+		{split: true, outDir: "out", attest: "config.intoto.json"},
+	} {
+		if err := checkSplitFlags(tt.split, tt.outDir, tt.output, tt.attest); err == nil {
+			t.Errorf("expected %+v to fail", tt)
+		}
+	}
+	if err := checkSplitFlags(true, "out", "", ""); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,214 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// runSplit implements "cfgmerge split", which splits one overlay into several
+// files by path, without merging it, so that its delete markers are kept.
+func runSplit(_ context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("split", flag.ContinueOnError)
+	var groups splitGroups
+	var version yamlVersion
+	var outDir, rest string
+	var outputFormat format
+	fs.StringVar(&outDir, "out-dir", "", "directory to write the files to (required)")
+	fs.Var(&groups, "group", "write the values at the comma-separated dotted `NAME=PATH,...` to NAME's file, e.g. networking=ingress,server.tls (repeatable)")
+	fs.StringVar(&rest, "rest", "", "write the top-level keys no group takes to this file instead of one file per key")
+	fs.Var(&outputFormat, "format", "output format [json, yaml, toml] (default: format of OVERLAY)")
+	fs.Var(&version, "yaml-version", `read yes/no/on/off and numbers like 0777 in YAML files as YAML [1.1, 1.2] does (default: yes/no strings, 0777 octal)`)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: cfgmerge split [flags] OVERLAY\n\n")
+		fmt.Fprintf(out, "Splits OVERLAY into files in -out-dir: the values at each group's paths go\n")
+		fmt.Fprintf(out, "to the group's file, and each remaining top-level key to its own file.\n")
+		fmt.Fprintf(out, "Merging the files in any order has the same effect as OVERLAY, delete\n")
+		fmt.Fprintf(out, "markers included. Prints the files written.\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected one OVERLAY")
+	}
+	if outDir == "" {
+		return errors.New("-out-dir is required")
+	}
+
+	inputs, err := readInputs(fs.Args(), version)
+	if err != nil {
+		return err
+	}
+	overlay, ok := inputs[0].doc.(map[string]any)
+	if !ok {
+		return fmt.Errorf("cannot split a document of type %T; it must be a map", inputs[0].doc)
+	}
+	parts, err := splitOverlay(overlay, groups, rest)
+	if err != nil {
+		return err
+	}
+	if outputFormat == "" {
+		outputFormat = inputs[0].format
+	}
+
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	for _, name := range slices.Sorted(maps.Keys(parts)) {
+		marshaled, err := outputFormat.Marshal(parts[name])
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		file := filepath.Join(outDir, name+"."+string(outputFormat))
+		if err := writeAtomic(file, marshaled); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(stdout, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitGroup names the paths whose values go to one file.
+type splitGroup struct {
+	name  string
+	paths [][]string
+}
+
+// splitGroups implements flag.Value for repeated -group flags.
+type splitGroups []splitGroup
+
+func (g *splitGroups) String() string {
+	specs := make([]string, len(*g))
+	for i, group := range *g {
+		paths := make([]string, len(group.paths))
+		for j, path := range group.paths {
+			paths[j] = strings.Join(path, ".")
+		}
+		specs[i] = group.name + "=" + strings.Join(paths, ",")
+	}
+	return strings.Join(specs, " ")
+}
+
+func (g *splitGroups) Set(value string) error {
+	name, list, ok := strings.Cut(value, "=")
+	if !ok || !validFileName(name) || list == "" {
+		return fmt.Errorf("invalid group %q (must be NAME=PATH,...)", value)
+	}
+	group := splitGroup{name: name}
+	for _, path := range strings.Split(list, ",") {
+		fields := strings.Split(path, ".")
+		if slices.Contains(fields, "") {
+			return fmt.Errorf("invalid path %q in group %s", path, name)
+		}
+		group.paths = append(group.paths, fields)
+	}
+	*g = append(*g, group)
+	return nil
+}
+
+// splitOverlay splits overlay into parts by file name. Each group's part holds
+// the values at its paths, nested as they are in overlay; the first group to
+// name a path takes it. The remaining top-level keys each get a part of their
+// own, or all go to the rest part if rest is set. Parts with nothing to hold
+// are omitted. overlay is not modified.
+func splitOverlay(overlay map[string]any, groups []splitGroup, rest string) (map[string]map[string]any, error) {
+	parts := make(map[string]map[string]any)
+	remaining := overlay
+	for i, group := range groups {
+		if slices.ContainsFunc(groups[:i], func(g splitGroup) bool { return g.name == group.name }) {
+			return nil, fmt.Errorf("group %s is named twice", group.name)
+		}
+		part := make(map[string]any)
+		for _, path := range group.paths {
+			value, found, err := lookupField(remaining, path)
+			if err != nil {
+				return nil, fmt.Errorf("cannot split at %s: %w", strings.Join(path, "."), err)
+			}
+			if !found {
+				continue
+			}
+			remaining = withoutField(remaining, path)
+			setField(part, path, value)
+		}
+		if len(part) > 0 {
+			parts[group.name] = part
+		}
+	}
+
+	for key, value := range remaining {
+		name := key
+		if rest != "" {
+			name = rest
+		}
+		if !validFileName(name) {
+			return nil, fmt.Errorf("cannot split by key: %q is not a valid file name", name)
+		}
+		if slices.ContainsFunc(groups, func(g splitGroup) bool { return g.name == name }) {
+			return nil, fmt.Errorf("cannot write key %q to the file of group %s", key, name)
+		}
+		if parts[name] == nil {
+			parts[name] = make(map[string]any)
+		}
+		parts[name][key] = value
+	}
+	return parts, nil
+}
+
+// lookupField returns the value at a path of map keys. Returns an error if a
+// value along the path is not a map.
+func lookupField(doc map[string]any, path []string) (any, bool, error) {
+	value, found := doc[path[0]]
+	if !found || len(path) == 1 {
+		return value, found, nil
+	}
+	child, ok := value.(map[string]any)
+	if !ok {
+		return nil, false, fmt.Errorf("%s is not a map", path[0])
+	}
+	return lookupField(child, path[1:])
+}
+
+// withoutField returns a copy of doc without the value at path, dropping maps
+// left empty. The maps along the path are copied rather than modified.
+func withoutField(doc map[string]any, path []string) map[string]any {
+	result := maps.Clone(doc)
+	if len(path) == 1 {
+		delete(result, path[0])
+		return result
+	}
+	child := withoutField(doc[path[0]].(map[string]any), path[1:])
+	if len(child) == 0 {
+		delete(result, path[0])
+	} else {
+		result[path[0]] = child
+	}
+	return result
+}
+
+// setField sets the value at path in doc, creating the maps along it.
+func setField(doc map[string]any, path []string, value any) {
+	for _, field := range path[:len(path)-1] {
+		child, ok := doc[field].(map[string]any)
+		if !ok {
+			child = make(map[string]any)
+			doc[field] = child
+		}
+		doc = child
+	}
+	doc[path[len(path)-1]] = value
+}
@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const splitFixture = `ingress:
+  host: example.com
+server:
+  port: 8080
+  tls:
+    cert: prod.pem
+auth:
+  _delete: true
+log: warn
+services:
+  - name: debug
+    _delete: true
+`
+
+func TestRunSplit(t *testing.T) {
+	dir := t.TempDir()
+	files := writeFiles(t, dir, "prod.yaml", splitFixture)
+	outDir := filepath.Join(dir, "out")
+
+	var out bytes.Buffer
+	args := []string{"-out-dir", outDir, "-group", "networking=ingress,server.tls", "-group", "auth=auth", files[0]}
+	if err := runSplit(context.Background(), args, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"auth.yaml":       "auth:\n  _delete: true\n",
+		"log.yaml":        "log: warn\n",
+		"networking.yaml": "ingress:\n  host: example.com\nserver:\n  tls:\n    cert: prod.pem\n",
+		"server.yaml":     "server:\n  port: 8080\n",
+		"services.yaml":   "services:\n- _delete: true\n  name: debug\n",
+	}
+	var written []string
+	for name, contents := range want {
+		file := filepath.Join(outDir, name)
+		written = append(written, file)
+		got, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != contents {
+			t.Errorf("%s: got %q, want %q", name, got, contents)
+		}
+	}
+	if lines := strings.Fields(out.String()); len(lines) != len(want) {
+		t.Errorf("expected %d files to be listed, got %q", len(want), out.String())
+	}
+
+	// Merged onto a base, the parts have the same effect as the overlay.
+	base := writeFiles(t, dir, "base.yaml", "auth:\n  mode: basic\nserver:\n  port: 80\nservices:\n  - name: debug\n  - name: web\n")
+	var whole, rejoined bytes.Buffer
+	if err := (&runConfig{files: append(base, files...)}).run(context.Background(), &whole); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&runConfig{files: append(base, written...)}).run(context.Background(), &rejoined); err != nil {
+		t.Fatal(err)
+	}
+	if whole.String() != rejoined.String() {
+		t.Errorf("got %q, want %q", rejoined.String(), whole.String())
+	}
+
+	// -rest collects the remaining keys in one file.
+	restDir := filepath.Join(dir, "rest")
+	out.Reset()
+	if err := runSplit(context.Background(), []string{"-out-dir", restDir, "-group", "networking=ingress,server", "-rest", "other", "-format", "json", files[0]}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != filepath.Join(restDir, "networking.json")+"\n"+filepath.Join(restDir, "other.json")+"\n" {
+		t.Errorf("unexpected files %q", out.String())
+	}
+}
+
+func TestRunSplit_Errors(t *testing.T) {
+	dir := t.TempDir()
+	files := writeFiles(t, dir, "prod.yaml", splitFixture, "list.yaml", "- a\n")
+	outDir := filepath.Join(dir, "out")
+	for _, tc := range []struct {
+		args  []string
+		error string
+	}{
+		{[]string{files[0]}, "-out-dir"},
+		{[]string{"-out-dir", outDir}, "expected one OVERLAY"},
+		{[]string{"-out-dir", outDir, files[1]}, "must be a map"},
+		{[]string{"-out-dir", outDir, "-group", "net=log.level", files[0]}, "cannot split at log.level: log is not a map"},
+		{[]string{"-out-dir", outDir, "-group", "a=ingress", "-group", "a=server", files[0]}, "named twice"},
+		{[]string{"-out-dir", outDir, "-group", "log=ingress", files[0]}, "group log"},
+		{[]string{"-out-dir", outDir, "-group", "net=", files[0]}, "invalid group"},
+		{[]string{"-out-dir", outDir, "-group", "net=a..b", files[0]}, "invalid path"},
+	} {
+		if err := runSplit(context.Background(), tc.args, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), tc.error) {
+			t.Errorf("%v: expected error containing %q, got %v", tc.args, tc.error, err)
+		}
+	}
+}
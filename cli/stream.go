@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// readStreams reads and unmarshals every file as a stream of documents: all
+// documents of a YAML file, or the single document of another file. With
+// ordered set, maps keep their key order as keymerge.OrderedMaps.
+func readStreams(files []string, version yamlVersion, ordered bool) ([]input, [][]any, error) {
+	inputs := make([]input, 0, len(files))
+	streams := make([][]any, 0, len(files))
+	for _, file := range files {
+		in := input{file: file}
+		var docs []any
+		var err error
+		in.contents, err = os.ReadFile(file)
+		if err == nil {
+			docs, in.format, err = unmarshalStream(file, in.contents, version, ordered)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		inputs = append(inputs, in)
+		streams = append(streams, docs)
+	}
+	return inputs, streams, nil
+}
+
+// unmarshalStream unmarshals the documents of a file for readStreams.
+func unmarshalStream(file string, contents []byte, version yamlVersion, ordered bool) ([]any, format, error) {
+	switch strings.ToLower(filepath.Ext(uncompressedName(file))) {
+	case ".yaml", ".yml":
+	default:
+		var doc any
+		f, err := unmarshalBytes(file, contents, &doc, version)
+		if err == nil && ordered {
+			doc, err = unmarshalOrdered(input{file: file, contents: contents, format: f}, version)
+		}
+		return []any{doc}, f, err
+	}
+
+	contents, err := readContents(contents)
+	if err != nil {
+		return nil, "", err
+	}
+	var opts []yaml.DecodeOption
+	if ordered {
+		opts = append(opts, yaml.UseOrderedMap())
+	}
+	docs, err := unmarshalYAMLStream(contents, version, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	if ordered {
+		for i, doc := range docs {
+			docs[i] = orderedFromYAML(doc)
+		}
+	}
+	return docs, validFormats["yaml"], nil
+}
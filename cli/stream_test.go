@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRunIdentity(t *testing.T) {
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", `# manifests
+kind: Deployment
+metadata: {name: web}
+replicas: 1
+---
+kind: Service
+metadata: {name: web}
+port: 80
+---
+# nothing here
+`,
+		"overlay.yaml", `kind: Service
+metadata: {name: web}
+port: 8080
+---
+kind: ConfigMap
+metadata: {name: web}
+data: {a: "1"}
+`,
+		"extra.toml", "kind = \"Deployment\"\nreplicas = 3\n[metadata]\nname = \"web\"\n",
+	)
+	var output bytes.Buffer
+	cfg := runConfig{files: files, identity: primaryKeys{"kind", "metadata.name"}}
+	if err := cfg.run(context.Background(), &output); err != nil {
+		t.Fatal(err)
+	}
+	want := `kind: Deployment
+metadata:
+  name: web
+replicas: 3
+---
+kind: Service
+metadata:
+  name: web
+port: 8080
+---
+data:
+  a: "1"
+kind: ConfigMap
+metadata:
+  name: web
+`
+	if output.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", output.String(), want)
+	}
+
+	// Without -identity, multi-document files are rejected rather than
+	// silently losing all but their first document.
+	cfg.identity = nil
+	err := cfg.run(context.Background(), &output)
+	if err == nil || !strings.Contains(err.Error(), "found 2 YAML documents") {
+		t.Errorf("expected multiple documents to fail, got %v", err)
+	}
+
+	cfg = runConfig{files: files, identity: primaryKeys{"kind"}}
+	if err := cfg.outputFormat.Set("json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.run(context.Background(), &output); err == nil {
+		t.Error("expected -identity with JSON output to fail")
+	}
+}
+
+func TestUnmarshalYAMLStream(t *testing.T) {
+	docs, err := unmarshalYAMLStream([]byte("---\nenabled: on\n---\n~\n---\n- 1\n"), "1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 2 || docs[0].(map[string]any)["enabled"] != true {
+		t.Errorf("unexpected documents %#v", docs)
+	}
+	for contents, want := range map[string]int{
+		"a: 1\n":                   1,
+		"---\na: 1\n---\n# note\n": 1,
+		"a: 1\n---\nb: 2\n":        2,
+		"a: [1\n---\n":             0,
+	} {
+		if got := countYAMLDocuments([]byte(contents)); got != want {
+			t.Errorf("countYAMLDocuments(%q) = %d, want %d", contents, got, want)
+		}
+	}
+}
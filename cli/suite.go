@@ -0,0 +1,327 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// runTest implements "cfgmerge test", which runs suites of merge cases
+// written in YAML and reports them as text, JSON, or JUnit XML.
+func runTest(_ context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var asJSON bool
+	var junitPath string
+	fs.BoolVar(&asJSON, "json", false, "write the results as JSON")
+	fs.StringVar(&junitPath, "junit", "", "also write the results as JUnit XML to `FILE`")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: cfgmerge test [flags] SUITE...\n\n")
+		fmt.Fprintf(out, "Runs the merge cases in each SUITE file and reports those whose results\n")
+		fmt.Fprintf(out, "differ from the expected ones. A suite looks like:\n\n")
+		fmt.Fprintf(out, "  options: {keys: [name]}         # merge flags for every case, as for cfgmerge\n")
+		fmt.Fprintf(out, "  cases:\n")
+		fmt.Fprintf(out, "    - name: prod overrides the port\n")
+		fmt.Fprintf(out, "      base: base.yaml              # a file, or the document itself\n")
+		fmt.Fprintf(out, "      overlays: [prod.yaml, {web: {port: 8443}}]\n")
+		fmt.Fprintf(out, "      options: {scalar: dedup}     # added to the suite's options\n")
+		fmt.Fprintf(out, "      expect: {web: {port: 8443}}  # or error: MESSAGE\n\n")
+		fmt.Fprintf(out, "with paths relative to the suite. Results are compared like\n")
+		fmt.Fprintf(out, "compare-artifact does, so keyed list items may differ in order.\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("expected at least one suite file")
+	}
+
+	suites := make([]*testSuite, 0, fs.NArg())
+	for _, file := range fs.Args() {
+		s, err := loadTestSuite(file)
+		if err != nil {
+			return err
+		}
+		suites = append(suites, s)
+	}
+
+	var results []replayResult
+	reports := make([]junitSuite, 0, len(suites))
+	for _, s := range suites {
+		report := junitSuite{Name: s.file}
+		start := time.Now()
+		for _, c := range s.Cases {
+			caseStart := time.Now()
+			result := s.run(c)
+			if len(suites) > 1 {
+				result.Case = s.file + ": " + result.Case
+			}
+			results = append(results, result)
+			report.add(c.Name, s.file, result, time.Since(caseStart))
+			if !asJSON {
+				if err := result.write(stdout, false); err != nil {
+					return err
+				}
+			}
+		}
+		report.Time = junitSeconds(time.Since(start))
+		reports = append(reports, report)
+	}
+	if asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	}
+	if junitPath != "" {
+		if err := writeJUnit(junitPath, reports); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, result := range results {
+		if !result.Passed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cases failed", failed, len(results))
+	}
+	if !asJSON {
+		_, err := fmt.Fprintf(stdout, "%d cases passed\n", len(results))
+		return err
+	}
+	return nil
+}
+
+// testSuite is a file of merge cases sharing default merge options.
+type testSuite struct {
+	file string
+	dir  string
+	// Options are merge flags, by name without the dash, for every case.
+	Options map[string]any `yaml:"options"`
+	Cases   []*testCase    `yaml:"cases"`
+}
+
+// testCase is a merge of a base and overlays, and its expected result or
+// error. Documents are either file paths or written inline.
+type testCase struct {
+	Name     string         `yaml:"name"`
+	Base     any            `yaml:"base"`
+	Overlays []any          `yaml:"overlays"`
+	Options  map[string]any `yaml:"options"`
+	Expect   any            `yaml:"expect"`
+	Error    string         `yaml:"error"`
+}
+
+// loadTestSuite reads a suite file, naming its unnamed cases by their
+// position.
+func loadTestSuite(file string) (*testSuite, error) {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	s := &testSuite{file: file, dir: filepath.Dir(file)}
+	if err := yaml.UnmarshalWithOptions(contents, s, yaml.Strict()); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(s.Cases) == 0 {
+		return nil, fmt.Errorf("%s: no cases", file)
+	}
+	for i, c := range s.Cases {
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("case %d", i+1)
+		}
+		switch {
+		case c.Base == nil:
+			return nil, fmt.Errorf("%s: %s: no base", file, c.Name)
+		case (c.Expect == nil) == (c.Error == ""):
+			return nil, fmt.Errorf("%s: %s: needs either expect or error", file, c.Name)
+		}
+	}
+	return s, nil
+}
+
+// run merges the case and compares the outcome with the expected one.
+func (s *testSuite) run(c *testCase) replayResult {
+	result := replayResult{Case: c.Name}
+	merger, merged, err := s.merge(c)
+	if merger == nil {
+		result.Err = err.Error()
+		return result
+	}
+	if c.Error != "" {
+		switch {
+		case err == nil:
+			result.Err = fmt.Sprintf("merge succeeded, expected error %q", c.Error)
+		case !strings.Contains(err.Error(), c.Error):
+			result.Err = err.Error()
+		default:
+			result.Passed = true
+		}
+		return result
+	}
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+
+	expected, err := s.document(c.Expect, "")
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+	changes, err := merger.Compare(expected, merged)
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+	if len(changes) > 0 {
+		result.Changes = newChangelog(changes)
+		return result
+	}
+	result.Passed = true
+	return result
+}
+
+// merge merges the case's documents with the suite's and the case's options.
+func (s *testSuite) merge(c *testCase) (*keymerge.UntypedMerger, any, error) {
+	fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var merge mergeFlags
+	merge.register(fs)
+	options := maps.Clone(s.Options)
+	if options == nil {
+		options = make(map[string]any)
+	}
+	maps.Copy(options, c.Options)
+	for _, name := range slices.Sorted(maps.Keys(options)) {
+		if err := fs.Set(name, optionValue(options[name])); err != nil {
+			return nil, nil, fmt.Errorf("invalid option %s: %w", name, err)
+		}
+	}
+
+	docs := make([]any, 0, 1+len(c.Overlays))
+	for _, source := range append([]any{c.Base}, c.Overlays...) {
+		doc, err := s.document(source, merge.yaml)
+		if err != nil {
+			return nil, nil, err
+		}
+		docs = append(docs, doc)
+	}
+	merger, err := keymerge.NewUntypedMerger(merge.options(), nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	merged, mergeErr := merger.MergeUnstructured(docs...)
+	return merger, merged, mergeErr
+}
+
+// document loads doc if it is a file path relative to the suite, and
+// otherwise returns it as written inline.
+func (s *testSuite) document(doc any, version yamlVersion) (any, error) {
+	path, ok := doc.(string)
+	if !ok {
+		return doc, nil
+	}
+	docs, _, err := loadDocuments([]string{filepath.Join(s.dir, path)}, version)
+	if err != nil {
+		return nil, err
+	}
+	return docs[0], nil
+}
+
+// optionValue formats an option as its flag's value, joining lists with
+// commas.
+func optionValue(v any) string {
+	items, ok := v.([]any)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	values := make([]string, len(items))
+	for i, item := range items {
+		values[i] = fmt.Sprint(item)
+	}
+	return strings.Join(values, ",")
+}
+
+// junitSuites is the root of a JUnit XML report.
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+// junitSuite reports the cases of a suite file.
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+// junitCase reports a case, with its failure if it failed.
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+// junitFailure is why a case failed: the error or the differences from the
+// expected result.
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// add reports a case's result.
+func (s *junitSuite) add(name, className string, result replayResult, elapsed time.Duration) {
+	c := junitCase{Name: name, ClassName: className, Time: junitSeconds(elapsed)}
+	if !result.Passed {
+		c.Failure = &junitFailure{Message: result.Err}
+		if result.Changes != nil {
+			c.Failure.Message = "result differs from expected"
+			var text strings.Builder
+			_ = result.Changes.write(&text)
+			c.Failure.Text = text.String()
+		}
+		s.Failures++
+	}
+	s.Tests++
+	s.Cases = append(s.Cases, c)
+}
+
+// junitSeconds formats a duration as JUnit's seconds.
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// writeJUnit writes the suites' reports as JUnit XML to path.
+func writeJUnit(path string, suites []junitSuite) error {
+	data, err := xml.MarshalIndent(junitSuites{Suites: suites}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeAtomic(path, append([]byte(xml.Header), append(data, '\n')...))
+}
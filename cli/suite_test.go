@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSuiteYAML = `options:
+  keys: [name]
+cases:
+  - name: prod overrides the port
+    base: base.yaml
+    overlays:
+      - services:
+          - name: web
+            port: 8080
+          - name: db
+            _delete: true
+    expect:
+      services:
+        - name: web
+          port: 8080
+  - name: tags are deduplicated
+    base: {tags: [a, b]}
+    overlays: [{tags: [b, c]}]
+    options: {scalar: dedup}
+    expect: expected.yaml
+  - base: {hosts: [{name: a}]}
+    overlays: [{hosts: [{name: b}, {name: b}]}]
+    error: duplicate primary key
+`
+
+func TestRunTest(t *testing.T) {
+	dir := t.TempDir()
+	files := writeFiles(t, dir,
+		"suite.yaml", testSuiteYAML,
+		"base.yaml", "services:\n  - name: web\n    port: 80\n  - name: db\n    port: 5432\n",
+		"expected.yaml", "tags: [a, b, c]\n")
+	suite := files[0]
+
+	var out bytes.Buffer
+	junit := filepath.Join(dir, "junit.xml")
+	if err := runTest(context.Background(), []string{"-junit", junit, suite}, &out); err != nil {
+		t.Fatalf("%v\n%s", err, out.String())
+	}
+	want := "PASS prod overrides the port\nPASS tags are deduplicated\nPASS case 3\n3 cases passed\n"
+	if out.String() != want {
+		t.Errorf("got output %q, want %q", out.String(), want)
+	}
+	report := readJUnit(t, junit)
+	if len(report.Suites) != 1 || report.Suites[0].Tests != 3 || report.Suites[0].Failures != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	// A case's options replace the suite's, so web no longer matches by name.
+	writeFiles(t, dir, "expected.yaml", "tags: [a, b, b, c]\n",
+		"suite.yaml", strings.Replace(testSuiteYAML, "expect:\n      services", "options: {keys: [id]}\n    expect:\n      services", 1))
+	out.Reset()
+	err := runTest(context.Background(), []string{"-junit", junit, "-json", suite}, &out)
+	if err == nil || err.Error() != "2 of 3 cases failed" {
+		t.Fatalf("expected two cases to fail, got %v\n%s", err, out.String())
+	}
+	var results []replayResult
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].Changes == nil || results[1].Changes == nil || !results[2].Passed {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	report = readJUnit(t, junit)
+	cases := report.Suites[0].Cases
+	if report.Suites[0].Failures != 2 || cases[1].Failure == nil || cases[2].Failure != nil {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if failure := cases[1].Failure; failure.Message != "result differs from expected" ||
+		!strings.Contains(failure.Text, "~ tags: [a b b c] -> [a b c]") {
+		t.Errorf("unexpected failure %+v", failure)
+	}
+}
+
+func readJUnit(t *testing.T, path string) junitSuites {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report junitSuites
+	if err := xml.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestRunTestErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir,
+		"empty.yaml", "cases: []\n",
+		"nobase.yaml", "cases: [{expect: {}}]\n",
+		"noexpect.yaml", "cases: [{name: x, base: {}}]\n",
+		"unknown.yaml", "cases: [{base: {}, expect: {}, extra: 1}]\n",
+		"option.yaml", "cases: [{base: {}, expect: {}, options: {bogus: 1}}]\n")
+	for name, want := range map[string]string{
+		"empty.yaml":    "no cases",
+		"nobase.yaml":   "case 1: no base",
+		"noexpect.yaml": "x: needs either expect or error",
+		"unknown.yaml":  "unknown field",
+		"option.yaml":   "FAIL case 1: invalid option bogus",
+	} {
+		var out bytes.Buffer
+		err := runTest(context.Background(), []string{filepath.Join(dir, name)}, &out)
+		if err == nil || !strings.Contains(err.Error()+out.String(), want) {
+			t.Errorf("%s: expected %q, got %v\n%s", name, want, err, out.String())
+		}
+	}
+	if err := runTest(context.Background(), nil, &bytes.Buffer{}); err == nil {
+		t.Error("expected error without suites")
+	}
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Byte order marks at the start of text files.
+var (
+	utf8BOM    = []byte{0xef, 0xbb, 0xbf}
+	utf16LEBOM = []byte{0xff, 0xfe}
+	utf16BEBOM = []byte{0xfe, 0xff}
+)
+
+// readContents returns the text of a file's contents for parsing: decompressed
+// as by decompress, then decoded as by decodeText.
+func readContents(contents []byte) ([]byte, error) {
+	contents, err := decompress(contents)
+	if err != nil {
+		return nil, err
+	}
+	return decodeText(contents)
+}
+
+// decodeText returns text as UTF-8 with LF line endings, as files written on
+// Windows may not be: a UTF-8 byte order mark is removed, UTF-16 is converted,
+// and CRLF line endings become LF. UTF-16 is recognized by its byte order mark
+// or, without one, by a NUL byte in the first character, since configuration
+// files start with ASCII.
+func decodeText(text []byte) ([]byte, error) {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(text, utf8BOM):
+		text = text[len(utf8BOM):]
+	case bytes.HasPrefix(text, utf16LEBOM):
+		order, text = binary.LittleEndian, text[len(utf16LEBOM):]
+	case bytes.HasPrefix(text, utf16BEBOM):
+		order, text = binary.BigEndian, text[len(utf16BEBOM):]
+	case len(text) >= 2 && text[0] != 0 && text[1] == 0:
+		order = binary.LittleEndian
+	case len(text) >= 2 && text[0] == 0 && text[1] != 0:
+		order = binary.BigEndian
+	}
+	if order != nil {
+		if len(text)%2 != 0 {
+			return nil, errors.New("invalid UTF-16 text: odd number of bytes")
+		}
+		units := make([]uint16, len(text)/2)
+		for i := range units {
+			units[i] = order.Uint16(text[2*i:])
+		}
+		decoded := make([]byte, 0, len(text))
+		for _, r := range utf16.Decode(units) {
+			decoded = utf8.AppendRune(decoded, r)
+		}
+		text = decoded
+	}
+	return bytes.ReplaceAll(text, []byte("\r\n"), []byte("\n")), nil
+}
+
+// newline is the line ending of the output.
+type newline string
+
+var validNewlines = map[string]newline{
+	"lf":   newline("lf"),
+	"crlf": newline("crlf"),
+}
+
+func (n *newline) String() string {
+	return string(*n)
+}
+
+func (n *newline) Set(value string) error {
+	value = strings.ToLower(value)
+	nl, ok := validNewlines[value]
+	if !ok {
+		return fmt.Errorf("invalid newline %q", value)
+	}
+	*n = nl
+	return nil
+}
+
+// textEncoding is the character encoding of the output.
+type textEncoding string
+
+var validTextEncodings = map[string]textEncoding{
+	"utf-8":     textEncoding("utf-8"),
+	"utf-8-bom": textEncoding("utf-8-bom"),
+	"utf-16le":  textEncoding("utf-16le"),
+	"utf-16be":  textEncoding("utf-16be"),
+}
+
+func (e *textEncoding) String() string {
+	return string(*e)
+}
+
+func (e *textEncoding) Set(value string) error {
+	value = strings.ToLower(value)
+	encoding, ok := validTextEncodings[value]
+	if !ok {
+		return fmt.Errorf("invalid encoding %q", value)
+	}
+	*e = encoding
+	return nil
+}
+
+// encodeText converts UTF-8 text with LF line endings to nl line endings and
+// encoding. UTF-16 output starts with a byte order mark, so that readers can
+// tell its byte order.
+func encodeText(text []byte, nl newline, encoding textEncoding) []byte {
+	if nl == "crlf" {
+		text = bytes.ReplaceAll(text, []byte("\n"), []byte("\r\n"))
+	}
+	var order binary.AppendByteOrder
+	switch encoding {
+	case "utf-8-bom":
+		return append(bytes.Clone(utf8BOM), text...)
+	case "utf-16le":
+		order = binary.LittleEndian
+	case "utf-16be":
+		order = binary.BigEndian
+	default:
+		return text
+	}
+	units := utf16.Encode([]rune(string(text)))
+	encoded := make([]byte, 0, 2*len(units)+2)
+	encoded = order.AppendUint16(encoded, 0xfeff)
+	for _, u := range units {
+		encoded = order.AppendUint16(encoded, u)
+	}
+	return encoded
+}
@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestDecodeText(t *testing.T) {
+	tests := map[string][]byte{
+		"plain":        []byte("a: é\nb: 1\n"),
+		"utf-8 bom":    []byte("\xef\xbb\xbfa: é\nb: 1\n"),
+		"crlf":         []byte("a: é\r\nb: 1\r\n"),
+		"utf-16le bom": encodeText([]byte("a: é\nb: 1\n"), "", "utf-16le"),
+		"utf-16be bom": encodeText([]byte("a: é\r\nb: 1\r\n"), "", "utf-16be"),
+		"utf-16le":     encodeText([]byte("a: é\nb: 1\n"), "", "utf-16le")[2:],
+		"utf-16be":     encodeText([]byte("a: é\nb: 1\n"), "", "utf-16be")[2:],
+	}
+	for name, text := range tests {
+		decoded, err := decodeText(text)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if string(decoded) != "a: é\nb: 1\n" {
+			t.Errorf("%s: decoded to %q", name, decoded)
+		}
+	}
+
+	if _, err := decodeText([]byte("\xff\xfea\x00b")); err == nil {
+		t.Error("expected error for odd-length UTF-16")
+	}
+}
+
+func TestEncodeText(t *testing.T) {
+	text := []byte("a: 😀\nb: 1\n")
+	tests := []struct {
+		newline  newline
+		encoding textEncoding
+		want     []byte
+	}{
+		{"", "", text},
+		{"lf", "utf-8", text},
+		{"crlf", "", []byte("a: 😀\r\nb: 1\r\n")},
+		{"", "utf-8-bom", append([]byte("\xef\xbb\xbf"), text...)},
+		{"", "utf-16be", []byte("\xfe\xff\x00a\x00:\x00 \xd8\x3d\xde\x00\x00\n\x00b\x00:\x00 \x001\x00\n")},
+	}
+	for _, tc := range tests {
+		if got := encodeText(text, tc.newline, tc.encoding); !bytes.Equal(got, tc.want) {
+			t.Errorf("encodeText(%q, %q) = %q, want %q", tc.newline, tc.encoding, got, tc.want)
+		}
+	}
+
+	// Decoding reverses every encoding
+	for encoding := range validTextEncodings {
+		decoded, err := decodeText(encodeText(text, "crlf", textEncoding(encoding)))
+		if err != nil || !bytes.Equal(decoded, text) {
+			t.Errorf("%s: decoded to %q, %v", encoding, decoded, err)
+		}
+	}
+}
+
+func TestRunWindowsFiles(t *testing.T) {
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", "\xef\xbb\xbfserver:\r\n  host: example.com\r\n  port: 80\r\n",
+		"overlay.json", string(encodeText([]byte("{\"server\": {\"host\": \"example.org\"}}\n"), "crlf", "utf-16le")),
+	)
+	var output bytes.Buffer
+	cfg := runConfig{files: files, newline: "crlf"}
+	if err := cfg.run(context.Background(), &output); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "server:\r\n  host: example.org\r\n  port: 80\r\n" {
+		t.Errorf("unexpected output %q", output.String())
+	}
+}
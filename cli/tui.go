@@ -0,0 +1,302 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// runTUI implements "cfgmerge tui", an interactive browser of the merged result.
+func runTUI(_ context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	var merge mergeFlags
+	merge.register(fs)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: cfgmerge tui [flags] BASE OVERLAY...\n\n")
+		fmt.Fprintf(out, "Merges the files and browses the result interactively. Every value is shown\n")
+		fmt.Fprintf(out, "with the file that last set it and whether the overlays added (+), changed (~),\n")
+		fmt.Fprintf(out, "or removed (-) it compared to BASE. Type ? at the prompt for commands.\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("no files to merge")
+	}
+
+	ex, err := newExplorer(merge.options(), merge.yaml, fs.Args())
+	if err != nil {
+		return err
+	}
+	return ex.run(os.Stdin, stdout)
+}
+
+// explorer browses a merge result one node at a time.
+type explorer struct {
+	merger *keymerge.UntypedMerger
+	files  []string
+	base   any
+	trace  *keymerge.MergeTrace
+	// changes lists how the merged result differs from the base.
+	changes []keymerge.Change
+	// path is the canonical path of the current node; parents are the paths above it.
+	path    string
+	parents []string
+}
+
+func newExplorer(opts keymerge.Options, version yamlVersion, files []string) (*explorer, error) {
+	docs, _, err := loadDocuments(files, version)
+	if err != nil {
+		return nil, err
+	}
+	// Load the base again so the comparison is unaffected by the merge.
+	base, _, err := loadDocuments(files[:1], version)
+	if err != nil {
+		return nil, err
+	}
+
+	merger, err := keymerge.NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	trace, err := merger.Trace(docs...)
+	if err != nil {
+		return nil, fmt.Errorf("merge failed: %w", err)
+	}
+	changes, err := merger.Compare(base[0], trace.Result)
+	if err != nil {
+		return nil, err
+	}
+	return &explorer{merger: merger, files: files, base: base[0], trace: trace, changes: changes}, nil
+}
+
+// node is a child of the current node, as listed by the explorer.
+type node struct {
+	label  string
+	path   string
+	value  any
+	marker string
+	source string
+}
+
+// run shows the current node and executes commands read from in until it is
+// exhausted or the user quits.
+func (ex *explorer) run(in io.Reader, out io.Writer) error {
+	ex.show(out)
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+		cmd := strings.TrimSpace(scanner.Text())
+		switch cmd {
+		case "":
+			continue
+		case "q", "quit":
+			return nil
+		case "?", "help":
+			fmt.Fprint(out, "Commands:\n"+
+				"  N or NAME  open a child by number or name\n"+
+				"  ..         go up one level\n"+
+				"  /          go to the top\n"+
+				"  v          show the current value as YAML\n"+
+				"  l          list the current node again\n"+
+				"  q          quit\n")
+		case "..":
+			if len(ex.parents) > 0 {
+				ex.path, ex.parents = ex.parents[len(ex.parents)-1], ex.parents[:len(ex.parents)-1]
+			}
+			ex.show(out)
+		case "/":
+			ex.path, ex.parents = "", nil
+			ex.show(out)
+		case "l":
+			ex.show(out)
+		case "v":
+			value, _, _ := keymerge.Lookup(ex.trace.Result, ex.path)
+			encoded, err := yaml.Marshal(encodeFor(value, "yaml"))
+			if err != nil {
+				fmt.Fprintf(out, "error: %v\n", err)
+				continue
+			}
+			out.Write(encoded)
+		default:
+			ex.open(cmd, out)
+		}
+	}
+}
+
+// open enters the child named or numbered by arg, or prints it if it is a leaf.
+func (ex *explorer) open(arg string, out io.Writer) {
+	children := ex.children()
+	var child *node
+	if i, err := strconv.Atoi(arg); err == nil && i >= 0 && i < len(children) {
+		child = &children[i]
+	}
+	for i := range children {
+		if child == nil && children[i].label == arg {
+			child = &children[i]
+		}
+	}
+	if child == nil {
+		fmt.Fprintf(out, "no child %q; type ? for help\n", arg)
+		return
+	}
+	if child.marker == "-" || !isContainer(child.value) {
+		fmt.Fprintln(out, formatNode(*child, true))
+		return
+	}
+	ex.parents = append(ex.parents, ex.path)
+	ex.path = child.path
+	ex.show(out)
+}
+
+// show prints the current node and its children.
+func (ex *explorer) show(out io.Writer) {
+	title := ex.path
+	if title == "" {
+		title = "(top)"
+	}
+	if source := ex.source(ex.path); ex.path != "" && source != "" {
+		title += "  (set by " + source + ")"
+	}
+	fmt.Fprintln(out, title)
+	children := ex.children()
+	if len(children) == 0 {
+		fmt.Fprintln(out, "  (empty)")
+	}
+	for i, child := range children {
+		fmt.Fprintf(out, "%s %2d  %s\n", child.marker, i, formatNode(child, false))
+	}
+}
+
+// children lists the current node's children in the merged result, followed by
+// children that the base had but the merged result does not.
+func (ex *explorer) children() []node {
+	var nodes []node
+	for _, c := range childPaths(ex.merger, ex.trace.Result, ex.path) {
+		nodes = append(nodes, node{label: c.label, path: c.path, value: c.value,
+			marker: ex.marker(c.path), source: ex.source(c.path)})
+	}
+	for _, c := range childPaths(ex.merger, ex.base, ex.path) {
+		if _, found, _ := keymerge.Lookup(ex.trace.Result, c.path); !found {
+			nodes = append(nodes, node{label: c.label, path: c.path, value: c.value,
+				marker: "-", source: ex.source(c.path)})
+		}
+	}
+	return nodes
+}
+
+type childPath struct {
+	label string
+	path  string
+	value any
+}
+
+// childPaths returns the children of the map or list at path within doc, with
+// keyed list items addressed by their primary keys.
+func childPaths(merger *keymerge.UntypedMerger, doc any, path string) []childPath {
+	value, found, err := keymerge.Lookup(doc, path)
+	if err != nil || !found {
+		return nil
+	}
+	var children []childPath
+	switch v := value.(type) {
+	case map[string]any:
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			child := appendKey(path, k)
+			label := strings.TrimPrefix(child[len(path):], ".")
+			children = append(children, childPath{label: label, path: child, value: v[k]})
+		}
+	case []any:
+		for i, item := range v {
+			child, err := merger.CanonicalPath(doc, path+"["+strconv.Itoa(i)+"]")
+			if err != nil {
+				continue
+			}
+			children = append(children, childPath{label: child[len(path):], path: child, value: item})
+		}
+	}
+	return children
+}
+
+// marker tells how the value at path differs from the base: "+" if the overlays
+// added it, "~" if they changed it or anything beneath it, or " " otherwise.
+func (ex *explorer) marker(path string) string {
+	marker := " "
+	for _, change := range ex.changes {
+		switch {
+		case change.Kind == keymerge.ChangeAdded && pathWithin(path, change.Path):
+			return "+"
+		case pathWithin(change.Path, path):
+			marker = "~"
+		}
+	}
+	return marker
+}
+
+// source returns the name of the file that last set the value at path.
+func (ex *explorer) source(path string) string {
+	index, err := ex.trace.Source(path)
+	if err != nil || index < 0 {
+		return ""
+	}
+	return filepath.Base(ex.files[index])
+}
+
+// formatNode renders a node as "label  value  source". Containers are summarized
+// unless full is set.
+func formatNode(n node, full bool) string {
+	value := summarize(n.value)
+	if full {
+		if encoded, err := yaml.Marshal(encodeFor(n.value, "yaml")); err == nil {
+			value = strings.TrimSuffix(string(encoded), "\n")
+		}
+	}
+	line := fmt.Sprintf("%-20s %-24s", n.label, value)
+	if n.source != "" {
+		line += " " + n.source
+	}
+	return strings.TrimRight(line, " ")
+}
+
+func summarize(value any) string {
+	switch v := value.(type) {
+	case map[string]any:
+		return fmt.Sprintf("{%d keys}", len(v))
+	case []any:
+		return fmt.Sprintf("[%d items]", len(v))
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func isContainer(value any) bool {
+	switch value.(type) {
+	case map[string]any, []any:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestExplorer(t *testing.T) {
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", "log: info\nservices:\n  - name: web\n    port: 80\n  - name: old\n    port: 81\n",
+		"prod.yaml", "log: warn\nregion: us\nservices:\n  - name: web\n    port: 8080\n  - name: old\n    _delete: true\n",
+	)
+	ex, err := newExplorer(keymerge.Options{PrimaryKeyNames: []string{"name"}, DeleteMarkerKey: "_delete"}, "", files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := ex.run(strings.NewReader("services\n[name=web]\nport\n..\n..\n2\nbogus\nq\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"(top)\n~  0  log                  warn                     prod.yaml\n",
+		"+  1  region               us                       prod.yaml\n",
+		"~  2  services             [1 items]                prod.yaml\n",
+		"services  (set by prod.yaml)\n~  0  [name=web]           {2 keys}                 prod.yaml\n",
+		"-  1  [name=old]           {2 keys}                 prod.yaml\n",
+		"services[name=web]  (set by prod.yaml)\n   0  name                 web                      base.yaml\n~  1  port                 8080                     prod.yaml\n",
+		"> port                 8080                     prod.yaml\n",
+		"no child \"bogus\"",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q", want)
+		}
+	}
+}
+
+func TestRunTUI_Errors(t *testing.T) {
+	if err := runTUI(context.Background(), nil, &bytes.Buffer{}); err == nil {
+		t.Error("expected error without files")
+	}
+	files := writeFiles(t, t.TempDir(), "a.yaml", "items: [{name: x}, {name: x}]\n")
+	if err := runTUI(context.Background(), []string{"-dupe", "unique", files[0], files[0]}, &bytes.Buffer{}); err == nil {
+		t.Error("expected merge error")
+	}
+}
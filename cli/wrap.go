@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// wrapSpec wraps the document of file under key, as given by -wrap KEY=FILE.
+type wrapSpec struct {
+	key  string
+	file string
+}
+
+// wrapFlags are the -wrap flags, in the order given.
+type wrapFlags []wrapSpec
+
+func (w *wrapFlags) String() string {
+	specs := make([]string, len(*w))
+	for i, spec := range *w {
+		specs[i] = spec.key + "=" + spec.file
+	}
+	return strings.Join(specs, ",")
+}
+
+func (w *wrapFlags) Set(value string) error {
+	key, file, ok := strings.Cut(value, "=")
+	if !ok || key == "" || file == "" {
+		return fmt.Errorf("invalid wrap %q (must be KEY=FILE)", value)
+	}
+	*w = append(*w, wrapSpec{key: key, file: file})
+	return nil
+}
+
+// rootKind names the kind of a document's root: "map", "list", or "scalar".
+func rootKind(doc any) string {
+	switch doc.(type) {
+	case map[string]any, *keymerge.OrderedMap:
+		return "map"
+	case []any:
+		return "list"
+	default:
+		return "scalar"
+	}
+}
+
+// wrapRoots wraps the documents named by c.wrap under their keys if the roots
+// of docs are not all of the same kind, so that a list can be merged into a
+// map. Documents whose roots already agree are left alone, so the same flags
+// work whether or not the sources happen to match. Returns an error if the
+// roots still differ after wrapping.
+func (c *runConfig) wrapRoots(inputs []input, docs []any) error {
+	if len(c.wrap) == 0 || !mixedRoots(docs) {
+		return nil
+	}
+	for _, spec := range c.wrap {
+		found := false
+		for i, in := range inputs {
+			if filepath.Clean(in.file) != filepath.Clean(spec.file) {
+				continue
+			}
+			found = true
+			if c.preserveOrder {
+				docs[i] = &keymerge.OrderedMap{Keys: []string{spec.key}, Values: map[string]any{spec.key: docs[i]}}
+			} else {
+				docs[i] = map[string]any{spec.key: docs[i]}
+			}
+		}
+		if !found {
+			return fmt.Errorf("-wrap %s=%s: %s is not one of the files to merge", spec.key, spec.file, spec.file)
+		}
+	}
+	if mixedRoots(docs) {
+		kinds := make([]string, len(docs))
+		for i, doc := range docs {
+			kinds[i] = fmt.Sprintf("%s in %s", rootKind(doc), inputs[i].file)
+		}
+		return fmt.Errorf("documents have different root kinds after wrapping (%s); wrap the others with -wrap KEY=FILE",
+			strings.Join(kinds, ", "))
+	}
+	return nil
+}
+
+// mixedRoots reports whether the roots of docs are not all of the same kind.
+func mixedRoots(docs []any) bool {
+	for _, doc := range docs[1:] {
+		if rootKind(doc) != rootKind(docs[0]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRunWrap(t *testing.T) {
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", "items:\n  - name: web\n    port: 80\nversion: 1\n",
+		"list.yaml", "- name: web\n  port: 8080\n- name: db\n  port: 5432\n",
+	)
+	var output bytes.Buffer
+	cfg := runConfig{files: files, wrap: wrapFlags{{key: "items", file: files[1]}}}
+	cfg.merge.keys = primaryKeys{"name"}
+	if err := cfg.run(context.Background(), &output); err != nil {
+		t.Fatal(err)
+	}
+	want := "items:\n- name: web\n  port: 8080\n- name: db\n  port: 5432\nversion: 1\n"
+	if output.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", output.String(), want)
+	}
+
+	// Documents whose roots agree are merged as they are.
+	lists := writeFiles(t, t.TempDir(),
+		"a.yaml", "- name: web\n  port: 80\n",
+		"b.yaml", "- name: web\n  port: 8080\n",
+	)
+	output.Reset()
+	cfg = runConfig{files: lists, wrap: wrapFlags{{key: "items", file: lists[1]}}}
+	cfg.merge.keys = primaryKeys{"name"}
+	if err := cfg.run(context.Background(), &output); err != nil {
+		t.Fatal(err)
+	}
+	if want := "- name: web\n  port: 8080\n"; output.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", output.String(), want)
+	}
+}
+
+func TestRunWrap_Errors(t *testing.T) {
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", "version: 1\n",
+		"list.json", `[1, 2]`,
+		"other.json", `[3]`,
+	)
+	for _, tc := range []struct {
+		name  string
+		cfg   runConfig
+		error string
+	}{
+		{"unknown file", runConfig{files: files[:2], wrap: wrapFlags{{key: "items", file: "missing.json"}}}, "not one of the files"},
+		{"still mixed", runConfig{files: files, wrap: wrapFlags{{key: "items", file: files[1]}}}, "list in " + files[2]},
+		{"identity", runConfig{files: files[:2], wrap: wrapFlags{{key: "items", file: files[1]}}, identity: primaryKeys{"kind"}}, "-identity"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var output bytes.Buffer
+			if err := tc.cfg.run(context.Background(), &output); err == nil || !strings.Contains(err.Error(), tc.error) {
+				t.Errorf("expected error containing %q, got %v", tc.error, err)
+			}
+		})
+	}
+}
+
+func TestWrapFlags(t *testing.T) {
+	var w wrapFlags
+	if err := w.Set("items=list.json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Set("hosts=a=b.yaml"); err != nil || w[1].file != "a=b.yaml" {
+		t.Errorf("unexpected spec %+v", w[1])
+	}
+	for _, invalid := range []string{"items", "=list.json", "items="} {
+		if err := w.Set(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+	if got := w.String(); got != "items=list.json,hosts=a=b.yaml" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/goccy/go-yaml/token"
+)
+
+// yamlVersion selects how plain YAML scalars are interpreted. The empty version
+// keeps the parser's defaults, which treat yes/no/on/off as strings (like YAML
+// 1.2) but 0777 as an octal number (like YAML 1.1).
+type yamlVersion string
+
+func (v *yamlVersion) String() string {
+	return string(*v)
+}
+
+func (v *yamlVersion) Set(value string) error {
+	switch value {
+	case "", "1.1", "1.2":
+		*v = yamlVersion(value)
+		return nil
+	default:
+		return fmt.Errorf("invalid YAML version %q", value)
+	}
+}
+
+// yaml11Bools holds the plain scalars YAML 1.1 reads as booleans.
+var yaml11Bools = map[string]bool{
+	"y": true, "Y": true, "yes": true, "Yes": true, "YES": true,
+	"n": false, "N": false, "no": false, "No": false, "NO": false,
+	"true": true, "True": true, "TRUE": true,
+	"false": false, "False": false, "FALSE": false,
+	"on": true, "On": true, "ON": true,
+	"off": false, "Off": false, "OFF": false,
+}
+
+// leadingZeroInt matches integers that YAML 1.1 reads as octal and YAML 1.2 as decimal.
+var leadingZeroInt = regexp.MustCompile(`^[-+]?0[0-9]+$`)
+
+// unmarshalYAML unmarshals the first document of contents, interpreting plain
+// scalars according to version. Mapping keys are always read as the parser
+// reads them, so keys like "on" stay strings.
+func unmarshalYAML(contents []byte, out any, version yamlVersion, opts ...yaml.DecodeOption) error {
+	if n := countYAMLDocuments(contents); n > 1 {
+		return fmt.Errorf("found %d YAML documents; merge multi-document files with -identity", n)
+	}
+	if version == "" {
+		return yaml.UnmarshalWithOptions(contents, out, opts...)
+	}
+	file, err := parser.ParseBytes(contents, 0)
+	if err != nil {
+		return err
+	}
+	if len(file.Docs) == 0 || file.Docs[0].Body == nil {
+		return nil
+	}
+	return yaml.NodeToValue(reinterpretScalars(file.Docs[0].Body, version), out, opts...)
+}
+
+// unmarshalYAMLStream unmarshals every document of contents like unmarshalYAML,
+// skipping empty documents.
+func unmarshalYAMLStream(contents []byte, version yamlVersion, opts ...yaml.DecodeOption) ([]any, error) {
+	file, err := parser.ParseBytes(contents, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var docs []any
+	for _, doc := range file.Docs {
+		if isEmptyDocument(doc) {
+			continue
+		}
+		body := doc.Body
+		if version != "" {
+			body = reinterpretScalars(body, version)
+		}
+		var value any
+		if err := yaml.NodeToValue(body, &value, opts...); err != nil {
+			return nil, err
+		}
+		if value != nil {
+			docs = append(docs, value)
+		}
+	}
+	return docs, nil
+}
+
+// countYAMLDocuments returns how many documents with content contents holds,
+// or 0 if it cannot be parsed.
+func countYAMLDocuments(contents []byte) int {
+	if !bytes.Contains(contents, []byte("---")) {
+		return 1
+	}
+	file, err := parser.ParseBytes(contents, parser.ParseComments)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, doc := range file.Docs {
+		if !isEmptyDocument(doc) {
+			n++
+		}
+	}
+	return n
+}
+
+// isEmptyDocument reports whether doc holds nothing but comments.
+func isEmptyDocument(doc *ast.DocumentNode) bool {
+	if doc.Body == nil {
+		return true
+	}
+	_, isComment := doc.Body.(*ast.CommentGroupNode)
+	return isComment
+}
+
+// reinterpretScalars returns node with its plain scalar values replaced by
+// their meaning in the given YAML version.
+func reinterpretScalars(node ast.Node, version yamlVersion) ast.Node {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		for _, value := range n.Values {
+			value.Value = reinterpretScalars(value.Value, version)
+		}
+	case *ast.MappingValueNode:
+		n.Value = reinterpretScalars(n.Value, version)
+	case *ast.SequenceNode:
+		for i, value := range n.Values {
+			n.Values[i] = reinterpretScalars(value, version)
+		}
+	case *ast.AnchorNode:
+		n.Value = reinterpretScalars(n.Value, version)
+	case *ast.TagNode:
+		// Tagged values are read as their tags say
+	case *ast.StringNode:
+		if b, ok := yaml11Bools[n.Token.Value]; ok && version == "1.1" && n.Token.Type == token.StringType {
+			return &ast.BoolNode{BaseNode: n.BaseNode, Token: n.Token, Value: b}
+		}
+	case *ast.IntegerNode:
+		literal := n.Token.Value
+		switch {
+		case version == "1.2" && leadingZeroInt.MatchString(literal):
+			// Decimal, as the core schema reads it; keep the parser's types
+			if strings.HasPrefix(literal, "-") {
+				if i, err := strconv.ParseInt(literal, 10, 64); err == nil {
+					n.Value = i
+				}
+			} else if u, err := strconv.ParseUint(strings.TrimPrefix(literal, "+"), 10, 64); err == nil {
+				n.Value = u
+			}
+		case version == "1.1" && strings.HasPrefix(strings.TrimLeft(literal, "-+"), "0o"):
+			// YAML 1.1 has no 0o prefix
+			return &ast.StringNode{BaseNode: n.BaseNode, Token: n.Token, Value: literal}
+		}
+	}
+	return node
+}
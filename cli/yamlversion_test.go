@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshalYAML_Versions(t *testing.T) {
+	contents := []byte(`country: NO
+enabled: on
+quoted: "yes"
+mode: 0777
+newmode: 0o777
+list: [yes, off, 010]
+anchored: &a y
+on: key
+`)
+	tests := []struct {
+		version yamlVersion
+		want    map[string]any
+	}{
+		{"", map[string]any{
+			"country": "NO", "enabled": "on", "quoted": "yes", "mode": uint64(0o777), "newmode": uint64(0o777),
+			"list": []any{"yes", "off", uint64(8)}, "anchored": "y", "on": "key",
+		}},
+		{"1.1", map[string]any{
+			"country": false, "enabled": true, "quoted": "yes", "mode": uint64(0o777), "newmode": "0o777",
+			"list": []any{true, false, uint64(8)}, "anchored": true, "on": "key",
+		}},
+		{"1.2", map[string]any{
+			"country": "NO", "enabled": "on", "quoted": "yes", "mode": uint64(777), "newmode": uint64(0o777),
+			"list": []any{"yes", "off", uint64(10)}, "anchored": "y", "on": "key",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run("version "+string(tt.version), func(t *testing.T) {
+			var doc any
+			if err := unmarshalYAML(contents, &doc, tt.version); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(doc, tt.want) {
+				t.Errorf("got  %#v\nwant %#v", doc, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunYAMLVersion(t *testing.T) {
+	files := writeFiles(t, t.TempDir(),
+		"base.yaml", "country: SE\nenabled: off\n",
+		"overlay.yaml", "country: NO\n",
+	)
+	for version, want := range map[string]string{
+		"1.1": "country: false\nenabled: false\n",
+		"1.2": "country: \"NO\"\nenabled: \"off\"\n",
+	} {
+		var output, stderr bytes.Buffer
+		cfg := runConfig{files: files, stderr: &stderr}
+		if err := cfg.merge.yaml.Set(version); err != nil {
+			t.Fatal(err)
+		}
+		if err := cfg.run(context.Background(), &output); err != nil {
+			t.Fatal(err)
+		}
+		if output.String() != want {
+			t.Errorf("%s: got %q, want %q", version, output.String(), want)
+		}
+	}
+
+	var version yamlVersion
+	if err := version.Set("1.3"); err == nil {
+		t.Error("expected an invalid version to fail")
+	}
+}
@@ -4,8 +4,10 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"path/filepath"
 	"slices"
 	"strconv"
@@ -45,8 +47,44 @@ const (
 
 	// AnnotationDeleteMarker specifies the deletion marker key.
 	AnnotationDeleteMarker = AnnotationBase + "delete-marker"
+
+	// AnnotationIgnoreKeys specifies comma-separated data keys (or glob patterns) that
+	// are copied from the base instead of merged. Read from the base ConfigMap only.
+	// Example: "README.md,notes.txt,*.sh".
+	AnnotationIgnoreKeys = AnnotationBase + "ignore-keys"
+
+	// AnnotationAllowCrossNamespace, when "true" on the base ConfigMap, allows a group
+	// to contain ConfigMaps from different namespaces. The merged ConfigMap is placed
+	// in the base's namespace.
+	AnnotationAllowCrossNamespace = AnnotationBase + "allow-cross-namespace"
 )
 
+// functionConfig data keys.
+const (
+	// ConfigContinueOnError, when "true", keeps processing the remaining groups
+	// after one fails. The failed group's ConfigMaps are passed through unmodified
+	// and the failure is reported as an error result.
+	ConfigContinueOnError = "continue-on-error"
+
+	// ConfigUnknownAnnotations controls how unrecognized config.keymerge.io/*
+	// annotations (usually typos) are reported: "ignore", "warning" (the default,
+	// which adds a warning result), or "error" (which fails the function).
+	ConfigUnknownAnnotations = "unknown-annotations"
+)
+
+// knownAnnotations are the annotations cfgmerge-krm understands.
+var knownAnnotations = []string{
+	AnnotationID,
+	AnnotationOrder,
+	AnnotationFinalName,
+	AnnotationKeys,
+	AnnotationScalarMode,
+	AnnotationDupeMode,
+	AnnotationDeleteMarker,
+	AnnotationIgnoreKeys,
+	AnnotationAllowCrossNamespace,
+}
+
 // TypeMeta describes an individual object in a ResourceList.
 type TypeMeta struct {
 	APIVersion string `yaml:"apiVersion" json:"apiVersion"`
@@ -71,9 +109,32 @@ type ConfigMap struct {
 // ResourceList is the input/output format for KRM functions.
 // See: https://github.com/kubernetes-sigs/kustomize/blob/master/cmd/config/docs/api-conventions/functions-spec.md
 type ResourceList struct {
-	APIVersion string           `yaml:"apiVersion" json:"apiVersion"`
-	Kind       string           `yaml:"kind" json:"kind"`
-	Items      []map[string]any `yaml:"items" json:"items"`
+	APIVersion     string           `yaml:"apiVersion" json:"apiVersion"`
+	Kind           string           `yaml:"kind" json:"kind"`
+	Items          []map[string]any `yaml:"items" json:"items"`
+	FunctionConfig map[string]any   `yaml:"functionConfig,omitempty" json:"functionConfig,omitempty"`
+	Results        []Result         `yaml:"results,omitempty" json:"results,omitempty"`
+}
+
+// Result is a structured message reported by the function in a ResourceList.
+type Result struct {
+	Message     string       `yaml:"message" json:"message"`
+	Severity    string       `yaml:"severity,omitempty" json:"severity,omitempty"`
+	ResourceRef *ResourceRef `yaml:"resourceRef,omitempty" json:"resourceRef,omitempty"`
+}
+
+// ResourceRef identifies the resource a Result is about.
+type ResourceRef struct {
+	APIVersion string `yaml:"apiVersion,omitempty" json:"apiVersion,omitempty"`
+	Kind       string `yaml:"kind" json:"kind"`
+	Name       string `yaml:"name" json:"name"`
+	Namespace  string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+}
+
+// functionOptions holds the settings read from the ResourceList's functionConfig.
+type functionOptions struct {
+	continueOnError    bool
+	unknownAnnotations string // "ignore", "warning", or "error"
 }
 
 // configMapGroup represents a set of ConfigMaps with the same ID that need to be merged.
@@ -81,14 +142,18 @@ type configMapGroup struct {
 	id          string
 	configMaps  []*configMapWithOrder
 	baseOptions keymerge.Options // Options from the base (order=0) ConfigMap
+	items       []map[string]any // Original resources, in input order
+	err         error            // Why the group cannot be merged, if it can't
 }
 
 // configMapWithOrder wraps a ConfigMap with its merge order and per-ConfigMap options.
 type configMapWithOrder struct {
-	order     int
-	configMap ConfigMap
-	options   keymerge.Options // Per-ConfigMap merge options
-	finalName string           // Only set on base (order=0)
+	order      int
+	configMap  ConfigMap
+	options    keymerge.Options // Per-ConfigMap merge options
+	finalName  string           // Only set on base (order=0)
+	ignoreKeys []string         // Data key patterns not to merge; only used on base
+	crossNS    bool             // Whether the group may span namespaces; only used on base
 }
 
 // Run executes the KRM plugin mode, reading a ResourceList from stdin and writing to stdout.
@@ -99,20 +164,67 @@ func Run(in io.Reader, out io.Writer) error {
 		return fmt.Errorf("failed to read ResourceList: %w", err)
 	}
 
+	fnOpts, err := parseFunctionConfig(rl.FunctionConfig)
+	if err != nil {
+		return fmt.Errorf("invalid functionConfig: %w", err)
+	}
+
+	var results []Result
+	if fnOpts.unknownAnnotations != "ignore" {
+		for _, item := range rl.Items {
+			for _, message := range checkAnnotations(item) {
+				if fnOpts.unknownAnnotations == "error" {
+					return errors.New(message)
+				}
+				results = append(results, Result{Message: message, Severity: "warning", ResourceRef: resourceRefOf(item)})
+			}
+		}
+	}
+
 	// Group ConfigMaps by annotation ID
 	groups, passthrough, err := groupConfigMaps(rl)
 	if err != nil {
 		return fmt.Errorf("failed to group ConfigMaps: %w", err)
 	}
 
+	ids := make([]string, 0, len(groups))
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	if !fnOpts.continueOnError {
+		for _, id := range ids {
+			if groups[id].err != nil {
+				return fmt.Errorf("failed to group ConfigMaps: %w", groups[id].err)
+			}
+		}
+	}
+
 	// Merge each group
 	mergedConfigMaps := make([]map[string]any, 0, len(groups))
-	for _, group := range groups {
-		merged, err := mergeConfigMapGroup(group)
-		if err != nil {
-			return fmt.Errorf("failed to merge ConfigMap group %q: %w", group.id, err)
+	for _, id := range ids {
+		group := groups[id]
+		err := group.err
+		if err == nil {
+			var merged map[string]any
+			merged, err = mergeConfigMapGroup(group)
+			if err == nil {
+				mergedConfigMaps = append(mergedConfigMaps, merged)
+				continue
+			}
+			err = fmt.Errorf("failed to merge ConfigMap group %q: %w", group.id, err)
+		}
+		if !fnOpts.continueOnError {
+			return err
 		}
-		mergedConfigMaps = append(mergedConfigMaps, merged)
+		// Leave the group's ConfigMaps as they were and report the failure.
+		passthrough = append(passthrough, group.items...)
+		results = append(results, Result{
+			Message:     err.Error(),
+			Severity:    "error",
+			ResourceRef: resourceRefOf(group.items[0]),
+		})
 	}
 
 	// Construct output ResourceList
@@ -120,6 +232,7 @@ func Run(in io.Reader, out io.Writer) error {
 		APIVersion: "v1",
 		Kind:       "ResourceList",
 		Items:      append(passthrough, mergedConfigMaps...),
+		Results:    results,
 	}
 
 	// Write to stdout
@@ -130,6 +243,97 @@ func Run(in io.Reader, out io.Writer) error {
 	return nil
 }
 
+// parseFunctionConfig reads function options from the data of a ConfigMap functionConfig.
+func parseFunctionConfig(fc map[string]any) (functionOptions, error) {
+	opts := functionOptions{unknownAnnotations: "warning"}
+	data, _ := fc["data"].(map[string]any)
+	if value, ok := data[ConfigUnknownAnnotations]; ok {
+		switch mode := fmt.Sprint(value); mode {
+		case "ignore", "warning", "error":
+			opts.unknownAnnotations = mode
+		default:
+			return opts, fmt.Errorf("invalid %q: %q (must be ignore, warning, or error)", ConfigUnknownAnnotations, mode)
+		}
+	}
+	if value, ok := data[ConfigContinueOnError]; ok {
+		b, err := strconv.ParseBool(fmt.Sprint(value))
+		if err != nil {
+			return opts, fmt.Errorf("invalid %q: %w", ConfigContinueOnError, err)
+		}
+		opts.continueOnError = b
+	}
+	return opts, nil
+}
+
+// checkAnnotations returns a message for every config.keymerge.io/* annotation of
+// a ConfigMap that isn't recognized, suggesting the closest known annotation.
+func checkAnnotations(item map[string]any) []string {
+	if kind, _ := item["kind"].(string); kind != "ConfigMap" {
+		return nil
+	}
+	metadata, _ := item["metadata"].(map[string]any)
+	annotations, _ := metadata["annotations"].(map[string]any)
+	name, _ := metadata["name"].(string)
+
+	var messages []string
+	for _, key := range slices.Sorted(maps.Keys(annotations)) {
+		if !strings.HasPrefix(key, AnnotationBase) || slices.Contains(knownAnnotations, key) {
+			continue
+		}
+		message := fmt.Sprintf("ConfigMap %q: unrecognized annotation %q", name, key)
+		if suggestion := closestAnnotation(key); suggestion != "" {
+			message += fmt.Sprintf(" (did you mean %q?)", suggestion)
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// closestAnnotation returns the known annotation nearest to key by edit distance,
+// or "" if none is close enough to be a likely typo.
+func closestAnnotation(key string) string {
+	name := strings.TrimPrefix(key, AnnotationBase)
+	best, bestDistance := "", 3
+	for _, known := range knownAnnotations {
+		if d := editDistance(name, strings.TrimPrefix(known, AnnotationBase)); d < bestDistance {
+			best, bestDistance = known, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// resourceRefOf returns a reference to a resource for reporting results.
+func resourceRefOf(item map[string]any) *ResourceRef {
+	ref := &ResourceRef{}
+	ref.APIVersion, _ = item["apiVersion"].(string)
+	ref.Kind, _ = item["kind"].(string)
+	metadata, _ := item["metadata"].(map[string]any)
+	ref.Name, _ = metadata["name"].(string)
+	ref.Namespace, _ = metadata["namespace"].(string)
+	return ref
+}
+
 // readResourceList reads and unmarshals a ResourceList from a reader.
 func readResourceList(r io.Reader) (*ResourceList, error) {
 	data, err := io.ReadAll(r)
@@ -160,6 +364,7 @@ func writeResourceList(w io.Writer, rl ResourceList) error {
 }
 
 // groupConfigMaps separates ConfigMaps with keymerge annotations from passthrough resources.
+// Groups that cannot be merged because of invalid annotations have their err set.
 func groupConfigMaps(rl *ResourceList) (map[string]*configMapGroup, []map[string]any, error) {
 	groups := make(map[string]*configMapGroup)
 	var passthrough []map[string]any
@@ -183,12 +388,6 @@ func groupConfigMaps(rl *ResourceList) (map[string]*configMapGroup, []map[string
 			continue
 		}
 
-		// Parse annotations
-		cmWithOrder, err := parseConfigMapAnnotations(cm)
-		if err != nil {
-			return nil, nil, fmt.Errorf("ConfigMap %q: %w", cm.Name, err)
-		}
-
 		// Add to group
 		if groups[id] == nil {
 			groups[id] = &configMapGroup{
@@ -196,13 +395,27 @@ func groupConfigMaps(rl *ResourceList) (map[string]*configMapGroup, []map[string
 				configMaps: make([]*configMapWithOrder, 0),
 			}
 		}
-		groups[id].configMaps = append(groups[id].configMaps, cmWithOrder)
+		group := groups[id]
+		group.items = append(group.items, item)
+
+		// Parse annotations; an invalid ConfigMap fails only its own group
+		cmWithOrder, err := parseConfigMapAnnotations(cm)
+		if err != nil {
+			if group.err == nil {
+				group.err = fmt.Errorf("ConfigMap %q: %w", cm.Name, err)
+			}
+			continue
+		}
+		group.configMaps = append(group.configMaps, cmWithOrder)
 	}
 
 	// Sort each group by order and validate
 	for id, group := range groups {
+		if group.err != nil {
+			continue
+		}
 		if err := prepareGroup(group); err != nil {
-			return nil, nil, fmt.Errorf("ConfigMap group %q: %w", id, err)
+			group.err = fmt.Errorf("ConfigMap group %q: %w", id, err)
 		}
 	}
 
@@ -268,11 +481,37 @@ func parseConfigMapAnnotations(cm ConfigMap) (*configMapWithOrder, error) {
 		return nil, fmt.Errorf("failed to parse merge options: %w", err)
 	}
 
+	// Parse ignored data keys (optional)
+	var ignoreKeys []string
+	if keys, ok := annotations[AnnotationIgnoreKeys]; ok && keys != "" {
+		for _, pattern := range strings.Split(keys, ",") {
+			pattern = strings.TrimSpace(pattern)
+			if pattern == "" {
+				continue
+			}
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid %q annotation: pattern %q: %w", AnnotationIgnoreKeys, pattern, err)
+			}
+			ignoreKeys = append(ignoreKeys, pattern)
+		}
+	}
+
+	// Parse cross-namespace override (optional)
+	var crossNS bool
+	if value, ok := annotations[AnnotationAllowCrossNamespace]; ok && value != "" {
+		crossNS, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %q annotation: %w", AnnotationAllowCrossNamespace, err)
+		}
+	}
+
 	return &configMapWithOrder{
-		order:     order,
-		configMap: cm,
-		options:   opts,
-		finalName: finalName,
+		order:      order,
+		configMap:  cm,
+		options:    opts,
+		finalName:  finalName,
+		ignoreKeys: ignoreKeys,
+		crossNS:    crossNS,
 	}, nil
 }
 
@@ -296,7 +535,7 @@ func parseMergeOptions(annotations map[string]string) (keymerge.Options, error)
 
 	// Parse scalar mode
 	if modeStr, ok := annotations[AnnotationScalarMode]; ok && modeStr != "" {
-		mode, err := parseScalarModeString(modeStr)
+		mode, err := keymerge.ParseScalarMode(strings.TrimSpace(modeStr))
 		if err != nil {
 			return opts, fmt.Errorf("invalid %q annotation: %w", AnnotationScalarMode, err)
 		}
@@ -305,7 +544,7 @@ func parseMergeOptions(annotations map[string]string) (keymerge.Options, error)
 
 	// Parse dupe mode
 	if modeStr, ok := annotations[AnnotationDupeMode]; ok && modeStr != "" {
-		mode, err := parseDupeModeString(modeStr)
+		mode, err := keymerge.ParseDupeMode(strings.TrimSpace(modeStr))
 		if err != nil {
 			return opts, fmt.Errorf("invalid %q annotation: %w", AnnotationDupeMode, err)
 		}
@@ -320,32 +559,6 @@ func parseMergeOptions(annotations map[string]string) (keymerge.Options, error)
 	return opts, nil
 }
 
-// parseScalarModeString converts a string to keymerge.ScalarMode.
-func parseScalarModeString(s string) (keymerge.ScalarMode, error) {
-	switch strings.ToLower(strings.TrimSpace(s)) {
-	case "concat":
-		return keymerge.ScalarConcat, nil
-	case "dedup":
-		return keymerge.ScalarDedup, nil
-	case "replace":
-		return keymerge.ScalarReplace, nil
-	default:
-		return keymerge.ScalarConcat, fmt.Errorf("unknown scalar mode %q (must be concat, dedup, or replace)", s)
-	}
-}
-
-// parseDupeModeString converts a string to keymerge.DupeMode.
-func parseDupeModeString(s string) (keymerge.DupeMode, error) {
-	switch strings.ToLower(strings.TrimSpace(s)) {
-	case "unique":
-		return keymerge.DupeUnique, nil
-	case "consolidate":
-		return keymerge.DupeConsolidate, nil
-	default:
-		return keymerge.DupeUnique, fmt.Errorf("unknown dupe mode %q (must be unique or consolidate)", s)
-	}
-}
-
 // prepareGroup sorts a group by order and validates it.
 func prepareGroup(group *configMapGroup) error {
 	// Sort by order
@@ -367,6 +580,16 @@ func prepareGroup(group *configMapGroup) error {
 		return fmt.Errorf("base ConfigMap %q missing required annotation %q", base.configMap.Name, AnnotationFinalName)
 	}
 
+	// Grouping is by ID alone, so guard against accidentally merging across namespaces
+	if !base.crossNS {
+		for _, cm := range group.configMaps[1:] {
+			if cm.configMap.Namespace != base.configMap.Namespace {
+				return fmt.Errorf("ConfigMap %q is in namespace %q but base ConfigMap %q is in namespace %q (set %q on the base to allow)",
+					cm.configMap.Name, cm.configMap.Namespace, base.configMap.Name, base.configMap.Namespace, AnnotationAllowCrossNamespace)
+			}
+		}
+	}
+
 	// Store base options at group level
 	group.baseOptions = base.options
 
@@ -395,6 +618,12 @@ func mergeConfigMapGroup(group *configMapGroup) (map[string]any, error) {
 	// Merge all data keys
 	mergedData := make(map[string]string)
 	for _, dataKey := range keysToMerge {
+		if isIgnoredKey(base.ignoreKeys, dataKey) {
+			if value := ignoredKeyValue(group, dataKey); value != "" {
+				mergedData[dataKey] = value
+			}
+			continue
+		}
 		merged, err := mergeDataKey(group, dataKey)
 		if err != nil {
 			return nil, fmt.Errorf("failed to merge data key %q: %w", dataKey, err)
@@ -482,6 +711,27 @@ func mergeDataKey(group *configMapGroup, dataKey string) (string, error) {
 	return string(result), nil
 }
 
+// isIgnoredKey reports whether a data key matches any of the ignore patterns.
+func isIgnoredKey(patterns []string, dataKey string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, dataKey); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoredKeyValue returns the value of an ignored data key: the base's value,
+// or if the base doesn't have it, the value from the lowest-order ConfigMap that does.
+func ignoredKeyValue(group *configMapGroup, dataKey string) string {
+	for _, cm := range group.configMaps {
+		if value, ok := cm.configMap.Data[dataKey]; ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
 // detectFormatFromKey detects the format based on the data key name (e.g., "config.yaml" → YAML).
 func detectFormatFromKey(dataKey string) (func([]byte, any) error, string, error) {
 	ext := strings.ToLower(filepath.Ext(dataKey))
@@ -385,6 +385,155 @@ func TestRun_ErrorCases(t *testing.T) {
 	}
 }
 
+func TestRun_ContinueOnError(t *testing.T) {
+	good := newConfigMap("good-base").
+		withAnnotation("config.keymerge.io/id", "good").
+		withAnnotation("config.keymerge.io/order", "0").
+		withAnnotation("config.keymerge.io/final-name", "good").
+		withData("config.yaml", "a: 1")
+	badBase := newConfigMap("bad-base").
+		withAnnotation("config.keymerge.io/id", "bad").
+		withAnnotation("config.keymerge.io/order", "0").
+		withAnnotation("config.keymerge.io/final-name", "bad").
+		withData("config.yaml", "items: []")
+	badOverlay := newConfigMap("bad-overlay").
+		withAnnotation("config.keymerge.io/id", "bad").
+		withAnnotation("config.keymerge.io/order", "1").
+		withData("config.yaml", "items:\n  - name: x\n  - name: x")
+	invalid := newConfigMap("invalid").
+		withAnnotation("config.keymerge.io/id", "invalid").
+		withAnnotation("config.keymerge.io/order", "zero").
+		withData("config.yaml", "a: 1")
+	input := buildResourceList(good, badBase, badOverlay, invalid)
+
+	expectError(t, input, `ConfigMap "invalid"`)
+
+	result := runResourceList(t, withFunctionConfig(input, ConfigContinueOnError, "true"))
+
+	findConfigMapByName(t, result.Items, "good")
+	for _, name := range []string{"bad-base", "bad-overlay", "invalid"} {
+		cm := findConfigMapByName(t, result.Items, name)
+		if cm.Annotations["config.keymerge.io/id"] == "" {
+			t.Errorf("ConfigMap %q should be passed through unmodified", name)
+		}
+	}
+
+	if len(result.Results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", result.Results)
+	}
+	for i, want := range []struct{ name, message string }{
+		{"bad-base", "duplicate primary key"},
+		{"invalid", "config.keymerge.io/order"},
+	} {
+		r := result.Results[i]
+		if r.Severity != "error" || r.ResourceRef == nil || r.ResourceRef.Name != want.name ||
+			r.ResourceRef.Kind != "ConfigMap" || !strings.Contains(r.Message, want.message) {
+			t.Errorf("unexpected result %d: %+v", i, r)
+		}
+	}
+}
+
+func TestRun_InvalidFunctionConfig(t *testing.T) {
+	input := withFunctionConfig(buildMinimalInput(nil), ConfigContinueOnError, "maybe")
+	expectError(t, input, "functionConfig")
+}
+
+func TestRun_IgnoreKeys(t *testing.T) {
+	build := func(ignore string) string {
+		base := newConfigMap("base").
+			withAnnotation("config.keymerge.io/id", "test").
+			withAnnotation("config.keymerge.io/order", "0").
+			withAnnotation("config.keymerge.io/final-name", "final").
+			withData("config.yaml", "a: 1").
+			withData("README.md", "Usage: [see docs")
+		if ignore != "" {
+			base.withAnnotation("config.keymerge.io/ignore-keys", ignore)
+		}
+		overlay := newConfigMap("overlay").
+			withAnnotation("config.keymerge.io/id", "test").
+			withAnnotation("config.keymerge.io/order", "10").
+			withData("config.yaml", "b: 2").
+			withData("README.md", "Overlay: [notes").
+			withData("notes.txt", "only in overlay")
+		return buildResourceList(base, overlay)
+	}
+
+	expectError(t, build(""), "README.md")
+	expectError(t, build("["), "ignore-keys")
+
+	cm := runAndExtractFirst(t, build("README.md, *.txt"))
+	if cm.Data["README.md"] != "Usage: [see docs\n" {
+		t.Errorf("README.md should be taken from base, got %q", cm.Data["README.md"])
+	}
+	if cm.Data["notes.txt"] != "only in overlay\n" {
+		t.Errorf("notes.txt should be taken from overlay, got %q", cm.Data["notes.txt"])
+	}
+	validateMergedKeys(t, parseConfigData(t, cm, "config.yaml"), "a", "b")
+	if _, ok := cm.Annotations["config.keymerge.io/ignore-keys"]; ok {
+		t.Error("ignore-keys annotation should be filtered from output")
+	}
+}
+
+func TestRun_UnknownAnnotations(t *testing.T) {
+	input := buildMinimalInput(map[string]string{
+		"config.keymerge.io/scalarmode": "dedup",
+		"config.keymerge.io/whatever":   "x",
+	})
+
+	result := runResourceList(t, input)
+	expected := []string{
+		`ConfigMap "base": unrecognized annotation "config.keymerge.io/scalarmode" (did you mean "config.keymerge.io/scalar-mode"?)`,
+		`ConfigMap "base": unrecognized annotation "config.keymerge.io/whatever"`,
+	}
+	if len(result.Results) != len(expected) {
+		t.Fatalf("expected %d results, got %+v", len(expected), result.Results)
+	}
+	for i, message := range expected {
+		r := result.Results[i]
+		if r.Message != message || r.Severity != "warning" || r.ResourceRef.Name != "base" {
+			t.Errorf("unexpected result %d: %+v", i, r)
+		}
+	}
+
+	result = runResourceList(t, withFunctionConfig(input, ConfigUnknownAnnotations, "ignore"))
+	if len(result.Results) != 0 {
+		t.Errorf("expected no results when ignoring, got %+v", result.Results)
+	}
+
+	expectError(t, withFunctionConfig(input, ConfigUnknownAnnotations, "error"), "did you mean")
+	expectError(t, withFunctionConfig(input, ConfigUnknownAnnotations, "loud"), "functionConfig")
+}
+
+func TestRun_CrossNamespace(t *testing.T) {
+	build := func(allow string) string {
+		base := newConfigMap("base").
+			withNamespace("team-a").
+			withAnnotation("config.keymerge.io/id", "test").
+			withAnnotation("config.keymerge.io/order", "0").
+			withAnnotation("config.keymerge.io/final-name", "final").
+			withData("config.yaml", "a: 1")
+		if allow != "" {
+			base.withAnnotation("config.keymerge.io/allow-cross-namespace", allow)
+		}
+		overlay := newConfigMap("overlay").
+			withNamespace("team-b").
+			withAnnotation("config.keymerge.io/id", "test").
+			withAnnotation("config.keymerge.io/order", "10").
+			withData("config.yaml", "b: 2")
+		return buildResourceList(base, overlay)
+	}
+
+	expectError(t, build(""), `ConfigMap "overlay" is in namespace "team-b"`)
+	expectError(t, build("false"), "allow-cross-namespace")
+	expectError(t, build("sometimes"), "allow-cross-namespace")
+
+	cm := runAndExtractFirst(t, build("true"))
+	if cm.Namespace != "team-a" {
+		t.Errorf("expected merged ConfigMap in base namespace, got %q", cm.Namespace)
+	}
+	validateMergedKeys(t, parseConfigData(t, cm, "config.yaml"), "a", "b")
+}
+
 func TestRun_ValidModes(t *testing.T) {
 	tests := []struct {
 		annotation string
@@ -428,6 +577,7 @@ func TestRun_ValidModes(t *testing.T) {
 // configMapBuilder builds ConfigMap specs for ResourceList creation.
 type configMapBuilder struct {
 	name        string
+	namespace   string
 	annotations map[string]string
 	data        map[string]string
 }
@@ -447,6 +597,12 @@ func (b *configMapBuilder) withAnnotation(key, value string) *configMapBuilder {
 	return b
 }
 
+// withNamespace sets the ConfigMap's namespace.
+func (b *configMapBuilder) withNamespace(namespace string) *configMapBuilder {
+	b.namespace = namespace
+	return b
+}
+
 // withData adds a data key-value pair to the ConfigMap.
 func (b *configMapBuilder) withData(key, value string) *configMapBuilder {
 	b.data[key] = value
@@ -462,6 +618,9 @@ func buildResourceList(configMaps ...*configMapBuilder) string {
 		items.WriteString("    kind: ConfigMap\n")
 		items.WriteString("    metadata:\n")
 		items.WriteString(fmt.Sprintf("      name: %s\n", cm.name))
+		if cm.namespace != "" {
+			items.WriteString(fmt.Sprintf("      namespace: %s\n", cm.namespace))
+		}
 
 		if len(cm.annotations) > 0 {
 			items.WriteString("      annotations:\n")
@@ -555,6 +714,34 @@ func buildTwoConfigMapInput(ext, baseData, overlayData string) string {
 	return buildResourceList(base, overlay)
 }
 
+// withFunctionConfig adds a ConfigMap functionConfig with one data entry to a ResourceList.
+func withFunctionConfig(input, key, value string) string {
+	return input + fmt.Sprintf(`functionConfig:
+  apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: fn-config
+  data:
+    %s: %q
+`, key, value)
+}
+
+// runResourceList runs the KRM function and returns the output ResourceList.
+func runResourceList(t *testing.T, input string) ResourceList {
+	t.Helper()
+
+	var output bytes.Buffer
+	if err := Run(strings.NewReader(input), &output); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	var result ResourceList
+	if err := yaml.Unmarshal(output.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to unmarshal output: %v", err)
+	}
+	return result
+}
+
 // runAndExtractFirst runs the KRM function and extracts the first ConfigMap.
 func runAndExtractFirst(t *testing.T, input string) ConfigMap {
 	t.Helper()
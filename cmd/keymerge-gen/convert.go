@@ -0,0 +1,569 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/types"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// converter writes the functions that convert values of a struct type and
+// the types of its fields to documents and back, the way keymerge's
+// reflection-based MergeTyped converts them.
+type converter struct {
+	gen     *generator
+	prefix  string         // prefix of the functions' names
+	indexes map[string]int // function indexes by type
+	queue   []types.Type
+	b       bytes.Buffer
+}
+
+// generator holds what the code generated for a package shares.
+type generator struct {
+	pkg     *types.Package
+	imports map[string]string // package names by path
+}
+
+// qualify names the packages of types in generated code.
+func (g *generator) qualify(pkg *types.Package) string {
+	if pkg == g.pkg {
+		return ""
+	}
+	if name, ok := g.imports[pkg.Path()]; ok {
+		return name
+	}
+	name := pkg.Name()
+	for i := 2; g.taken(name); i++ {
+		name = pkg.Name() + strconv.Itoa(i)
+	}
+	g.imports[pkg.Path()] = name
+	return name
+}
+
+func (g *generator) taken(name string) bool {
+	if name == "fmt" || name == "keymerge" || g.pkg.Scope().Lookup(name) != nil {
+		return true
+	}
+	for _, used := range g.imports {
+		if used == name {
+			return true
+		}
+	}
+	return false
+}
+
+// typeString returns the name of t in generated code, or an error if t cannot
+// be named outside the package that declares it.
+func (g *generator) typeString(t types.Type) (string, error) {
+	if err := g.accessible(t); err != nil {
+		return "", err
+	}
+	return types.TypeString(t, g.qualify), nil
+}
+
+func (g *generator) accessible(t types.Type) error {
+	switch t := t.(type) {
+	case *types.Named:
+		if obj := t.Obj(); obj.Pkg() != nil && obj.Pkg() != g.pkg && !obj.Exported() {
+			return fmt.Errorf("type %s is not exported", types.TypeString(t, nil))
+		}
+		for arg := range t.TypeArgs().Types() {
+			if err := g.accessible(arg); err != nil {
+				return err
+			}
+		}
+	case *types.Alias:
+		return g.accessible(types.Unalias(t))
+	case *types.Pointer:
+		return g.accessible(t.Elem())
+	case *types.Slice:
+		return g.accessible(t.Elem())
+	case *types.Array:
+		return g.accessible(t.Elem())
+	case *types.Map:
+		if err := g.accessible(t.Key()); err != nil {
+			return err
+		}
+		return g.accessible(t.Elem())
+	case *types.Struct:
+		for field := range t.Fields() {
+			if !field.Exported() && field.Pkg() != g.pkg {
+				return fmt.Errorf("%s has unexported fields of package %s", t, field.Pkg().Path())
+			}
+			if err := g.accessible(field.Type()); err != nil {
+				return err
+			}
+		}
+	case *types.Basic:
+		if t.Kind() == types.Invalid {
+			return fmt.Errorf("type could not be determined")
+		}
+	}
+	return nil
+}
+
+// errorName returns the name of t in error messages, as reflect names it.
+func errorName(t types.Type) string {
+	return types.TypeString(t, func(pkg *types.Package) string { return pkg.Name() })
+}
+
+// functions returns the names of the functions converting values of type t
+// to documents and back, queuing them to be written.
+func (c *converter) functions(t types.Type) (toDoc, fromDoc string) {
+	key := types.TypeString(t, nil)
+	index, ok := c.indexes[key]
+	if !ok {
+		index = len(c.indexes)
+		c.indexes[key] = index
+		c.queue = append(c.queue, t)
+	}
+	if index == 0 {
+		return c.prefix + "ToDoc", c.prefix + "FromDoc"
+	}
+	return fmt.Sprintf("%sToDoc%d", c.prefix, index), fmt.Sprintf("%sFromDoc%d", c.prefix, index)
+}
+
+// write writes the conversion functions of every queued type.
+func (c *converter) write(mergeFunc string) error {
+	for len(c.queue) > 0 {
+		t := c.queue[0]
+		c.queue = c.queue[1:]
+		name, err := c.gen.typeString(t)
+		if err != nil {
+			return err
+		}
+		toDoc, fromDoc := c.functions(t)
+		fmt.Fprintf(&c.b, "\n// %s converts %s values to documents for %s.\n", toDoc, name, mergeFunc)
+		fmt.Fprintf(&c.b, "func %s(v %s) (any, bool) {\n", toDoc, name)
+		c.writeToDoc(t, name)
+		fmt.Fprintf(&c.b, "}\n\n// %s sets %s values from documents for %s.\n", fromDoc, name, mergeFunc)
+		fmt.Fprintf(&c.b, "func %s(doc any, v *%s) error {\n", fromDoc, name)
+		if err := c.writeFromDoc(t, name); err != nil {
+			return err
+		}
+		c.b.WriteString("}\n")
+	}
+	return nil
+}
+
+// writeToDoc writes the body of a function that converts v to a document,
+// leaving out zero values like keymerge's toUntyped.
+func (c *converter) writeToDoc(t types.Type, name string) {
+	b := &c.b
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		fmt.Fprintf(b, "if %s {\nreturn nil, false\n}\nreturn v, true\n", zeroBasic(u, "v"))
+	case *types.Pointer:
+		b.WriteString("if v == nil {\nreturn nil, false\n}\n")
+		toDoc, fallback, simple := c.item(u.Elem(), "*v")
+		switch {
+		case types.IsInterface(u.Elem()):
+			b.WriteString("return *v, *v != nil\n")
+		case simple:
+			b.WriteString("return *v, true\n")
+		case fallback == "nil":
+			fmt.Fprintf(b, "return %s(*v)\n", toDoc)
+		default:
+			fmt.Fprintf(b, "if doc, ok := %s(*v); ok {\nreturn doc, true\n}\nreturn %s, true\n", toDoc, fallback)
+		}
+	case *types.Struct:
+		c.writeStructToDoc(u, name)
+	case *types.Map:
+		b.WriteString("if v == nil {\nreturn nil, false\n}\n")
+		key := "k"
+		docType := "map[any]any"
+		if basic, ok := u.Key().Underlying().(*types.Basic); ok && basic.Info()&types.IsString != 0 {
+			docType = "map[string]any"
+			if !types.Identical(u.Key(), types.Typ[types.String]) {
+				key = "string(k)"
+			}
+		}
+		fmt.Fprintf(b, "doc := make(%s, len(v))\nfor k, e := range v {\n", docType)
+		c.writeItem("doc["+key+"]", "e", u.Elem())
+		b.WriteString("}\nreturn doc, true\n")
+	case *types.Slice:
+		b.WriteString("if v == nil {\nreturn nil, false\n}\n")
+		c.writeList(u.Elem())
+	case *types.Array:
+		if zero, ok := c.zero(t, "v"); ok {
+			fmt.Fprintf(b, "if %s {\nreturn nil, false\n}\n", zero)
+		}
+		c.writeList(u.Elem())
+	default: // interfaces, channels, and functions
+		b.WriteString("if v == nil {\nreturn nil, false\n}\nreturn v, true\n")
+	}
+}
+
+func (c *converter) writeStructToDoc(st *types.Struct, name string) {
+	b := &c.b
+	zero, zeroOK := fmt.Sprintf("v == (%s{})", name), true
+	if !isStrictlyComparable(st) {
+		zero, zeroOK = c.zero(st, "v")
+	}
+	if zeroOK {
+		fmt.Fprintf(b, "if %s {\nreturn nil, false\n}\n", zero)
+	}
+	if !hasConvertedFields(st) {
+		// Structs without exported fields, such as time.Time, are single values
+		b.WriteString("return v, true\n")
+		return
+	}
+
+	var embedded []*types.Var
+	fmt.Fprintf(b, "doc := make(map[string]any, %d)\n", st.NumFields())
+	for i := range st.NumFields() {
+		field, tag := st.Field(i), reflect.StructTag(st.Tag(i))
+		if inner := inlinedField(field, tag); inner != nil {
+			if hasConvertedFields(inner) {
+				embedded = append(embedded, field)
+			}
+			continue
+		}
+		docName, ok := convertedName(field, tag)
+		if !ok {
+			continue
+		}
+		toDoc, _ := c.functions(field.Type())
+		fmt.Fprintf(b, "if value, ok := %s(v.%s); ok {\ndoc[%q] = value\n}\n", toDoc, field.Name(), docName)
+	}
+	// The struct's own fields take precedence over embedded ones
+	for _, field := range embedded {
+		toDoc, _ := c.functions(field.Type())
+		fmt.Fprintf(b, "if value, ok := %s(v.%s); ok {\n", toDoc, field.Name())
+		b.WriteString("if fields, ok := value.(map[string]any); ok {\nfor name, value := range fields {\n")
+		b.WriteString("if _, exists := doc[name]; !exists {\ndoc[name] = value\n}\n}\n}\n}\n")
+	}
+	if !zeroOK {
+		b.WriteString("if len(doc) == 0 {\nreturn nil, false\n}\n")
+	}
+	b.WriteString("return doc, true\n")
+}
+
+// writeList writes code converting the slice or array v to a list.
+func (c *converter) writeList(elem types.Type) {
+	if basic, ok := elem.Underlying().(*types.Basic); ok && basic.Kind() == types.Uint8 {
+		// Byte slices are single values, as when unmarshaled
+		c.b.WriteString("return v, true\n")
+		return
+	}
+	c.b.WriteString("list := make([]any, len(v))\nfor i, e := range v {\n")
+	c.writeItem("list[i]", "e", elem)
+	c.b.WriteString("}\nreturn list, true\n")
+}
+
+// writeItem writes code setting target to the document of a map value or list
+// item, which is set even when zero, like keymerge's toUntypedItem.
+func (c *converter) writeItem(target, value string, t types.Type) {
+	toDoc, fallback, simple := c.item(t, value)
+	if simple {
+		fmt.Fprintf(&c.b, "%s = %s\n", target, value)
+		return
+	}
+	fmt.Fprintf(&c.b, "if item, ok := %s(%s); ok {\n%s = item\n} else {\n%s = %s\n}\n", toDoc, value, target, target, fallback)
+}
+
+// item returns the function converting a map value or list item of type t
+// and what the item is when that function leaves the value out. It reports
+// whether value is its own document, so that it needs no conversion.
+func (c *converter) item(t types.Type, value string) (toDoc, fallback string, simple bool) {
+	switch u := t.Underlying().(type) {
+	case *types.Basic, *types.Interface, *types.Chan, *types.Signature:
+		return "", "", true
+	case *types.Struct:
+		if !hasConvertedFields(u) {
+			return "", "", true
+		}
+		fallback = "map[string]any{}"
+	case *types.Array:
+		fallback = value
+	default:
+		fallback = "nil"
+	}
+	toDoc, _ = c.functions(t)
+	return toDoc, fallback, false
+}
+
+// writeFromDoc writes the body of a function that sets v from a document,
+// converting numbers and strings to v's type like keymerge's fromUntyped.
+func (c *converter) writeFromDoc(t types.Type, name string) error {
+	b := &c.b
+	fmt.Fprintf(b, "if doc == nil {\n*v = %s\nreturn nil\n}\n", zeroValue(t, name))
+	if basic, ok := t.Underlying().(*types.Basic); ok && basic.Info()&(types.IsInteger|types.IsFloat) != 0 {
+		fmt.Fprintf(b, "value, err := keymerge.ConvertNumber[%s](doc)\nif err != nil {\nreturn err\n}\n*v = value\nreturn nil\n", name)
+		return nil
+	}
+	fmt.Fprintf(b, "if value, ok := doc.(%s); ok {\n*v = value\nreturn nil\n}\n", name)
+
+	cannotUse := fmt.Sprintf("return fmt.Errorf(\"cannot use %%v (type %%T) as %%s\", doc, doc, %q)\n", errorName(t))
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		if u.Info()&types.IsString != 0 && !types.Identical(t, types.Typ[types.String]) {
+			fmt.Fprintf(b, "if s, ok := doc.(string); ok {\n*v = %s(s)\nreturn nil\n}\n", name)
+		} else if u.Info()&types.IsBoolean != 0 && !types.Identical(t, types.Typ[types.Bool]) {
+			fmt.Fprintf(b, "if x, ok := doc.(bool); ok {\n*v = %s(x)\nreturn nil\n}\n", name)
+		}
+	case *types.Pointer:
+		elem, err := c.gen.typeString(u.Elem())
+		if err != nil {
+			return err
+		}
+		_, fromDoc := c.functions(u.Elem())
+		fmt.Fprintf(b, "elem := new(%s)\nif err := %s(doc, elem); err != nil {\nreturn err\n}\n*v = elem\nreturn nil\n", elem, fromDoc)
+		return nil
+	case *types.Struct:
+		c.writeStructFromDoc(u, cannotUse)
+		return nil
+	case *types.Map:
+		return c.writeMapFromDoc(u, name, cannotUse)
+	case *types.Slice:
+		_, fromDoc := c.functions(u.Elem())
+		fmt.Fprintf(b, "list, ok := doc.([]any)\nif !ok {\n%s}\n", cannotUse)
+		fmt.Fprintf(b, "result := make(%s, len(list))\nfor i, item := range list {\n", name)
+		fmt.Fprintf(b, "if err := %s(item, &result[i]); err != nil {\nreturn fmt.Errorf(\"[%%d]: %%w\", i, err)\n}\n}\n", fromDoc)
+		b.WriteString("*v = result\nreturn nil\n")
+		return nil
+	case *types.Array:
+		_, fromDoc := c.functions(u.Elem())
+		fmt.Fprintf(b, "list, ok := doc.([]any)\nif !ok {\n%s}\n", cannotUse)
+		fmt.Fprintf(b, "if len(list) > len(v) {\nreturn fmt.Errorf(\"%%d items do not fit in %%s\", len(list), %q)\n}\n", errorName(t))
+		b.WriteString("for i, item := range list {\n")
+		fmt.Fprintf(b, "if err := %s(item, &v[i]); err != nil {\nreturn fmt.Errorf(\"[%%d]: %%w\", i, err)\n}\n}\n", fromDoc)
+		b.WriteString("return nil\n")
+		return nil
+	}
+	b.WriteString(cannotUse)
+	return nil
+}
+
+func (c *converter) writeStructFromDoc(st *types.Struct, cannotUse string) {
+	b := &c.b
+	var body bytes.Buffer
+	for i := range st.NumFields() {
+		field, tag := st.Field(i), reflect.StructTag(st.Tag(i))
+		if inlinedField(field, tag) != nil {
+			_, fromDoc := c.functions(field.Type())
+			fmt.Fprintf(&body, "if err := %s(doc, &v.%s); err != nil {\nreturn err\n}\n", fromDoc, field.Name())
+			continue
+		}
+		docName, ok := convertedName(field, tag)
+		if !ok {
+			continue
+		}
+		_, fromDoc := c.functions(field.Type())
+		fmt.Fprintf(&body, "if value, exists := mp[%q]; exists {\n", docName)
+		fmt.Fprintf(&body, "if err := %s(value, &v.%s); err != nil {\n", fromDoc, field.Name())
+		fmt.Fprintf(&body, "return fmt.Errorf(%q, err)\n}\n}\n", strings.ReplaceAll(docName, "%", "%%")+": %w")
+	}
+	if bytes.Contains(body.Bytes(), []byte("mp[")) {
+		fmt.Fprintf(b, "mp, ok := doc.(map[string]any)\nif !ok {\n%s}\n", cannotUse)
+	} else {
+		fmt.Fprintf(b, "if _, ok := doc.(map[string]any); !ok {\n%s}\n", cannotUse)
+	}
+	b.Write(body.Bytes())
+	b.WriteString("return nil\n")
+}
+
+func (c *converter) writeMapFromDoc(m *types.Map, name, cannotUse string) error {
+	key, err := c.gen.typeString(m.Key())
+	if err != nil {
+		return err
+	}
+	elem, err := c.gen.typeString(m.Elem())
+	if err != nil {
+		return err
+	}
+	_, keyFromDoc := c.functions(m.Key())
+	_, elemFromDoc := c.functions(m.Elem())
+	b := &c.b
+	b.WriteString("switch mp := doc.(type) {\n")
+	for _, docType := range []string{"map[string]any", "map[any]any"} {
+		fmt.Fprintf(b, "case %s:\nresult := make(%s, len(mp))\nfor k, item := range mp {\n", docType, name)
+		fmt.Fprintf(b, "var key %s\nif err := %s(k, &key); err != nil {\nreturn err\n}\n", key, keyFromDoc)
+		fmt.Fprintf(b, "var value %s\nif err := %s(item, &value); err != nil {\n", elem, elemFromDoc)
+		b.WriteString("return fmt.Errorf(\"%v: %w\", k, err)\n}\nresult[key] = value\n}\n*v = result\nreturn nil\n")
+	}
+	b.WriteString("}\n")
+	b.WriteString(cannotUse)
+	return nil
+}
+
+// zero returns an expression reporting whether x of type t is zero, like
+// reflect.Value.IsZero, or false if generated code cannot tell.
+func (c *converter) zero(t types.Type, x string) (string, bool) {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return zeroBasic(u, x), true
+	case *types.Struct:
+		if isStrictlyComparable(u) {
+			name, err := c.gen.typeString(t)
+			if err != nil {
+				return "", false
+			}
+			return fmt.Sprintf("%s == (%s{})", x, name), true
+		}
+		var conds []string
+		for field := range u.Fields() {
+			if field.Name() == "_" {
+				continue
+			}
+			if !field.Exported() && field.Pkg() != c.gen.pkg {
+				return "", false
+			}
+			cond, ok := c.zero(field.Type(), x+"."+field.Name())
+			if !ok {
+				return "", false
+			}
+			conds = append(conds, cond)
+		}
+		if len(conds) == 0 {
+			return "true", true
+		}
+		return strings.Join(conds, " && "), true
+	case *types.Array:
+		if !isStrictlyComparable(u) {
+			return "", false
+		}
+		name, err := c.gen.typeString(t)
+		if err != nil {
+			return "", false
+		}
+		return fmt.Sprintf("%s == (%s{})", x, name), true
+	default:
+		return x + " == nil", true
+	}
+}
+
+func zeroBasic(t *types.Basic, x string) string {
+	switch {
+	case t.Info()&types.IsBoolean != 0:
+		return "!" + x
+	case t.Info()&types.IsString != 0:
+		return x + ` == ""`
+	case t.Kind() == types.UnsafePointer:
+		return x + " == nil"
+	default:
+		return x + " == 0"
+	}
+}
+
+// zeroValue returns the zero value of t in generated code.
+func zeroValue(t types.Type, name string) string {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			return "false"
+		case u.Info()&types.IsString != 0:
+			return `""`
+		case u.Kind() == types.UnsafePointer:
+			return "nil"
+		}
+		return "0"
+	case *types.Struct, *types.Array:
+		return name + "{}"
+	default:
+		return "nil"
+	}
+}
+
+// isStrictlyComparable reports whether == can compare values of t without
+// panicking, which it can for interfaces only if their dynamic types are.
+func isStrictlyComparable(t types.Type) bool {
+	switch u := t.Underlying().(type) {
+	case *types.Interface:
+		return false
+	case *types.Struct:
+		for field := range u.Fields() {
+			if !isStrictlyComparable(field.Type()) {
+				return false
+			}
+		}
+		return true
+	case *types.Array:
+		return isStrictlyComparable(u.Elem())
+	default:
+		return types.Comparable(t)
+	}
+}
+
+// inlinedField returns the struct whose fields a field contributes to its
+// parent's level, like keymerge's inlinedStruct, or nil.
+func inlinedField(field *types.Var, tag reflect.StructTag) *types.Struct {
+	t := field.Type()
+	if ptr, ok := t.Underlying().(*types.Pointer); ok {
+		if !field.Exported() {
+			return nil // cannot be allocated when decoding
+		}
+		t = ptr.Elem()
+	}
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok || (!field.Exported() && !field.Embedded()) {
+		return nil
+	}
+	for _, part := range strings.Split(tag.Get("km"), ",") {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(part), "field="); ok && name != "" {
+			return nil
+		}
+	}
+	for _, key := range []string{"yaml", "json", "toml"} {
+		value := tag.Get(key)
+		if value == "-" {
+			return nil
+		}
+		if value == "" {
+			continue
+		}
+		name, options, _ := strings.Cut(value, ",")
+		if slices.Contains(strings.Split(options, ","), "inline") {
+			return st
+		}
+		if name != "" {
+			return nil
+		}
+	}
+	if field.Embedded() {
+		return st
+	}
+	return nil
+}
+
+// convertedName returns the name a field has in documents, or false if the
+// field is not converted.
+func convertedName(field *types.Var, tag reflect.StructTag) (string, bool) {
+	if !field.Exported() {
+		return "", false
+	}
+	for _, key := range []string{"yaml", "json", "toml"} {
+		if tag.Get(key) == "-" {
+			return "", false
+		}
+	}
+	name, err := fieldName(field.Name(), tag)
+	if err != nil {
+		return "", false
+	}
+	return name, true
+}
+
+// hasConvertedFields reports whether a struct has fields that are converted
+// to map entries, including those of embedded structs.
+func hasConvertedFields(st *types.Struct) bool {
+	for i := range st.NumFields() {
+		field, tag := st.Field(i), reflect.StructTag(st.Tag(i))
+		if inner := inlinedField(field, tag); inner != nil {
+			if hasConvertedFields(inner) {
+				return true
+			}
+			continue
+		}
+		if _, ok := convertedName(field, tag); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package example holds types whose merger keymerge-gen generates, to test
+// the generated code.
+package example
+
+import "time"
+
+//go:generate go run ../.. -type Config
+
+// Config covers the kinds of fields that generated code converts.
+type Config struct {
+	Log      Level             `yaml:"log" km-doc:"Log level."`
+	Services []Service         `yaml:"services" km:"dupe=consolidate"`
+	Tags     []string          `yaml:"tags,omitempty" km:"mode=dedup"`
+	Admin    *Service          `json:"admin"`
+	Extra    Endpoints         `km:"field=extra"`
+	Limits   map[string]int    `yaml:"limits"`
+	Labels   map[Level]string  `yaml:"labels"`
+	Debug    *bool             `yaml:"debug"`
+	Timeout  time.Duration     `yaml:"timeout"`
+	Started  time.Time         `yaml:"started"`
+	Cert     []byte            `yaml:"cert"`
+	Pair     [2]string         `yaml:"pair"`
+	Meta     map[string]any    `yaml:"meta"`
+	Any      any               `yaml:"any"`
+	Ignored  string            `yaml:"-"`
+	Weights  map[string]Weight `yaml:"weights"`
+	internal string
+	common
+}
+
+type common struct {
+	Log    Level  `yaml:"log" km:"mode=join"`
+	Region string `yaml:"region" km-doc:"Deployment region."`
+}
+
+// Level is a log level.
+type Level string
+
+// Weight is a load balancing weight.
+type Weight float64
+
+// Service is a list item with a primary key.
+type Service struct {
+	Name    string   `yaml:"name" km:"primary"`
+	Port    uint16   `yaml:"port" km:"agg=sum"`
+	Aliases []string `yaml:"aliases"`
+}
+
+// Endpoints is a named list of anonymous structs.
+type Endpoints []struct {
+	URL string `yaml:"url" km:"primary"`
+}
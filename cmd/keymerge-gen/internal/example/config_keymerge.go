@@ -0,0 +1,1059 @@
+// Code generated by keymerge-gen -type Config; DO NOT EDIT.
+
+package example
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// configMergeFields describes the merge directives of Config's fields.
+var configMergeFields = []keymerge.FieldSpec{
+	{Name: "log", Doc: "Log level."},
+	{Name: "services", Tag: "dupe=consolidate", List: true, Fields: []keymerge.FieldSpec{
+		{Name: "name", Tag: "primary"},
+		{Name: "port", Tag: "agg=sum"},
+		{Name: "aliases", List: true},
+	}},
+	{Name: "tags", Tag: "mode=dedup", List: true},
+	{Name: "admin", Fields: []keymerge.FieldSpec{
+		{Name: "name", Tag: "primary"},
+		{Name: "port", Tag: "agg=sum"},
+		{Name: "aliases", List: true},
+	}},
+	{Name: "extra", Tag: "field=extra", List: true, Fields: []keymerge.FieldSpec{
+		{Name: "url", Tag: "primary"},
+	}},
+	{Name: "limits"},
+	{Name: "labels"},
+	{Name: "debug"},
+	{Name: "timeout"},
+	{Name: "started"},
+	{Name: "cert", List: true},
+	{Name: "pair"},
+	{Name: "meta"},
+	{Name: "any"},
+	{Name: "Ignored"},
+	{Name: "weights"},
+	{Name: "region", Doc: "Deployment region."},
+}
+
+// NewConfigMerger creates a keymerge.Merger for Config like keymerge.NewMerger, but
+// with metadata generated from its struct tags instead of built by reflection.
+func NewConfigMerger(opts keymerge.Options,
+	unmarshal func([]byte, any) error,
+	marshal func(any) ([]byte, error),
+) (*keymerge.Merger[Config], error) {
+	metadata, err := keymerge.NewMetadataTree(configMergeFields...)
+	if err != nil {
+		return nil, err
+	}
+	return keymerge.NewMergerFromMetadata[Config](opts, metadata, unmarshal, marshal)
+}
+
+// MergeConfig merges Config values left-to-right like merger.MergeTyped, but
+// converts them to documents and back with generated code instead of reflection.
+func MergeConfig(merger *keymerge.Merger[Config], base Config, overlays ...Config) (Config, error) {
+	docs := make([]any, 0, 1+len(overlays))
+	doc, _ := configToDoc(base)
+	docs = append(docs, doc)
+	for _, overlay := range overlays {
+		doc, _ = configToDoc(overlay)
+		docs = append(docs, doc)
+	}
+	var result Config
+	merged, err := merger.MergeUnstructured(docs...)
+	if err != nil {
+		return result, err
+	}
+	if err := configFromDoc(merged, &result); err != nil {
+		return result, &keymerge.MarshalError{Err: err, Operation: "unmarshal", DocIndex: -1}
+	}
+	return result, nil
+}
+
+// configToDoc converts Config values to documents for MergeConfig.
+func configToDoc(v Config) (any, bool) {
+	if v.Log == "" && v.Services == nil && v.Tags == nil && v.Admin == nil && v.Extra == nil && v.Limits == nil && v.Labels == nil && v.Debug == nil && v.Timeout == 0 && v.Started == (time.Time{}) && v.Cert == nil && v.Pair == ([2]string{}) && v.Meta == nil && v.Any == nil && v.Ignored == "" && v.Weights == nil && v.internal == "" && v.common == (common{}) {
+		return nil, false
+	}
+	doc := make(map[string]any, 18)
+	if value, ok := configToDoc1(v.Log); ok {
+		doc["log"] = value
+	}
+	if value, ok := configToDoc2(v.Services); ok {
+		doc["services"] = value
+	}
+	if value, ok := configToDoc3(v.Tags); ok {
+		doc["tags"] = value
+	}
+	if value, ok := configToDoc4(v.Admin); ok {
+		doc["admin"] = value
+	}
+	if value, ok := configToDoc5(v.Extra); ok {
+		doc["extra"] = value
+	}
+	if value, ok := configToDoc6(v.Limits); ok {
+		doc["limits"] = value
+	}
+	if value, ok := configToDoc7(v.Labels); ok {
+		doc["labels"] = value
+	}
+	if value, ok := configToDoc8(v.Debug); ok {
+		doc["debug"] = value
+	}
+	if value, ok := configToDoc9(v.Timeout); ok {
+		doc["timeout"] = value
+	}
+	if value, ok := configToDoc10(v.Started); ok {
+		doc["started"] = value
+	}
+	if value, ok := configToDoc11(v.Cert); ok {
+		doc["cert"] = value
+	}
+	if value, ok := configToDoc12(v.Pair); ok {
+		doc["pair"] = value
+	}
+	if value, ok := configToDoc13(v.Meta); ok {
+		doc["meta"] = value
+	}
+	if value, ok := configToDoc14(v.Any); ok {
+		doc["any"] = value
+	}
+	if value, ok := configToDoc15(v.Weights); ok {
+		doc["weights"] = value
+	}
+	if value, ok := configToDoc16(v.common); ok {
+		if fields, ok := value.(map[string]any); ok {
+			for name, value := range fields {
+				if _, exists := doc[name]; !exists {
+					doc[name] = value
+				}
+			}
+		}
+	}
+	return doc, true
+}
+
+// configFromDoc sets Config values from documents for MergeConfig.
+func configFromDoc(doc any, v *Config) error {
+	if doc == nil {
+		*v = Config{}
+		return nil
+	}
+	if value, ok := doc.(Config); ok {
+		*v = value
+		return nil
+	}
+	mp, ok := doc.(map[string]any)
+	if !ok {
+		return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "example.Config")
+	}
+	if value, exists := mp["log"]; exists {
+		if err := configFromDoc1(value, &v.Log); err != nil {
+			return fmt.Errorf("log: %w", err)
+		}
+	}
+	if value, exists := mp["services"]; exists {
+		if err := configFromDoc2(value, &v.Services); err != nil {
+			return fmt.Errorf("services: %w", err)
+		}
+	}
+	if value, exists := mp["tags"]; exists {
+		if err := configFromDoc3(value, &v.Tags); err != nil {
+			return fmt.Errorf("tags: %w", err)
+		}
+	}
+	if value, exists := mp["admin"]; exists {
+		if err := configFromDoc4(value, &v.Admin); err != nil {
+			return fmt.Errorf("admin: %w", err)
+		}
+	}
+	if value, exists := mp["extra"]; exists {
+		if err := configFromDoc5(value, &v.Extra); err != nil {
+			return fmt.Errorf("extra: %w", err)
+		}
+	}
+	if value, exists := mp["limits"]; exists {
+		if err := configFromDoc6(value, &v.Limits); err != nil {
+			return fmt.Errorf("limits: %w", err)
+		}
+	}
+	if value, exists := mp["labels"]; exists {
+		if err := configFromDoc7(value, &v.Labels); err != nil {
+			return fmt.Errorf("labels: %w", err)
+		}
+	}
+	if value, exists := mp["debug"]; exists {
+		if err := configFromDoc8(value, &v.Debug); err != nil {
+			return fmt.Errorf("debug: %w", err)
+		}
+	}
+	if value, exists := mp["timeout"]; exists {
+		if err := configFromDoc9(value, &v.Timeout); err != nil {
+			return fmt.Errorf("timeout: %w", err)
+		}
+	}
+	if value, exists := mp["started"]; exists {
+		if err := configFromDoc10(value, &v.Started); err != nil {
+			return fmt.Errorf("started: %w", err)
+		}
+	}
+	if value, exists := mp["cert"]; exists {
+		if err := configFromDoc11(value, &v.Cert); err != nil {
+			return fmt.Errorf("cert: %w", err)
+		}
+	}
+	if value, exists := mp["pair"]; exists {
+		if err := configFromDoc12(value, &v.Pair); err != nil {
+			return fmt.Errorf("pair: %w", err)
+		}
+	}
+	if value, exists := mp["meta"]; exists {
+		if err := configFromDoc13(value, &v.Meta); err != nil {
+			return fmt.Errorf("meta: %w", err)
+		}
+	}
+	if value, exists := mp["any"]; exists {
+		if err := configFromDoc14(value, &v.Any); err != nil {
+			return fmt.Errorf("any: %w", err)
+		}
+	}
+	if value, exists := mp["weights"]; exists {
+		if err := configFromDoc15(value, &v.Weights); err != nil {
+			return fmt.Errorf("weights: %w", err)
+		}
+	}
+	if err := configFromDoc16(doc, &v.common); err != nil {
+		return err
+	}
+	return nil
+}
+
+// configToDoc1 converts Level values to documents for MergeConfig.
+func configToDoc1(v Level) (any, bool) {
+	if v == "" {
+		return nil, false
+	}
+	return v, true
+}
+
+// configFromDoc1 sets Level values from documents for MergeConfig.
+func configFromDoc1(doc any, v *Level) error {
+	if doc == nil {
+		*v = ""
+		return nil
+	}
+	if value, ok := doc.(Level); ok {
+		*v = value
+		return nil
+	}
+	if s, ok := doc.(string); ok {
+		*v = Level(s)
+		return nil
+	}
+	return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "example.Level")
+}
+
+// configToDoc2 converts []Service values to documents for MergeConfig.
+func configToDoc2(v []Service) (any, bool) {
+	if v == nil {
+		return nil, false
+	}
+	list := make([]any, len(v))
+	for i, e := range v {
+		if item, ok := configToDoc17(e); ok {
+			list[i] = item
+		} else {
+			list[i] = map[string]any{}
+		}
+	}
+	return list, true
+}
+
+// configFromDoc2 sets []Service values from documents for MergeConfig.
+func configFromDoc2(doc any, v *[]Service) error {
+	if doc == nil {
+		*v = nil
+		return nil
+	}
+	if value, ok := doc.([]Service); ok {
+		*v = value
+		return nil
+	}
+	list, ok := doc.([]any)
+	if !ok {
+		return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "[]example.Service")
+	}
+	result := make([]Service, len(list))
+	for i, item := range list {
+		if err := configFromDoc17(item, &result[i]); err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+	*v = result
+	return nil
+}
+
+// configToDoc3 converts []string values to documents for MergeConfig.
+func configToDoc3(v []string) (any, bool) {
+	if v == nil {
+		return nil, false
+	}
+	list := make([]any, len(v))
+	for i, e := range v {
+		list[i] = e
+	}
+	return list, true
+}
+
+// configFromDoc3 sets []string values from documents for MergeConfig.
+func configFromDoc3(doc any, v *[]string) error {
+	if doc == nil {
+		*v = nil
+		return nil
+	}
+	if value, ok := doc.([]string); ok {
+		*v = value
+		return nil
+	}
+	list, ok := doc.([]any)
+	if !ok {
+		return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "[]string")
+	}
+	result := make([]string, len(list))
+	for i, item := range list {
+		if err := configFromDoc18(item, &result[i]); err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+	*v = result
+	return nil
+}
+
+// configToDoc4 converts *Service values to documents for MergeConfig.
+func configToDoc4(v *Service) (any, bool) {
+	if v == nil {
+		return nil, false
+	}
+	if doc, ok := configToDoc17(*v); ok {
+		return doc, true
+	}
+	return map[string]any{}, true
+}
+
+// configFromDoc4 sets *Service values from documents for MergeConfig.
+func configFromDoc4(doc any, v **Service) error {
+	if doc == nil {
+		*v = nil
+		return nil
+	}
+	if value, ok := doc.(*Service); ok {
+		*v = value
+		return nil
+	}
+	elem := new(Service)
+	if err := configFromDoc17(doc, elem); err != nil {
+		return err
+	}
+	*v = elem
+	return nil
+}
+
+// configToDoc5 converts Endpoints values to documents for MergeConfig.
+func configToDoc5(v Endpoints) (any, bool) {
+	if v == nil {
+		return nil, false
+	}
+	list := make([]any, len(v))
+	for i, e := range v {
+		if item, ok := configToDoc19(e); ok {
+			list[i] = item
+		} else {
+			list[i] = map[string]any{}
+		}
+	}
+	return list, true
+}
+
+// configFromDoc5 sets Endpoints values from documents for MergeConfig.
+func configFromDoc5(doc any, v *Endpoints) error {
+	if doc == nil {
+		*v = nil
+		return nil
+	}
+	if value, ok := doc.(Endpoints); ok {
+		*v = value
+		return nil
+	}
+	list, ok := doc.([]any)
+	if !ok {
+		return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "example.Endpoints")
+	}
+	result := make(Endpoints, len(list))
+	for i, item := range list {
+		if err := configFromDoc19(item, &result[i]); err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+	*v = result
+	return nil
+}
+
+// configToDoc6 converts map[string]int values to documents for MergeConfig.
+func configToDoc6(v map[string]int) (any, bool) {
+	if v == nil {
+		return nil, false
+	}
+	doc := make(map[string]any, len(v))
+	for k, e := range v {
+		doc[k] = e
+	}
+	return doc, true
+}
+
+// configFromDoc6 sets map[string]int values from documents for MergeConfig.
+func configFromDoc6(doc any, v *map[string]int) error {
+	if doc == nil {
+		*v = nil
+		return nil
+	}
+	if value, ok := doc.(map[string]int); ok {
+		*v = value
+		return nil
+	}
+	switch mp := doc.(type) {
+	case map[string]any:
+		result := make(map[string]int, len(mp))
+		for k, item := range mp {
+			var key string
+			if err := configFromDoc18(k, &key); err != nil {
+				return err
+			}
+			var value int
+			if err := configFromDoc20(item, &value); err != nil {
+				return fmt.Errorf("%v: %w", k, err)
+			}
+			result[key] = value
+		}
+		*v = result
+		return nil
+	case map[any]any:
+		result := make(map[string]int, len(mp))
+		for k, item := range mp {
+			var key string
+			if err := configFromDoc18(k, &key); err != nil {
+				return err
+			}
+			var value int
+			if err := configFromDoc20(item, &value); err != nil {
+				return fmt.Errorf("%v: %w", k, err)
+			}
+			result[key] = value
+		}
+		*v = result
+		return nil
+	}
+	return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "map[string]int")
+}
+
+// configToDoc7 converts map[Level]string values to documents for MergeConfig.
+func configToDoc7(v map[Level]string) (any, bool) {
+	if v == nil {
+		return nil, false
+	}
+	doc := make(map[string]any, len(v))
+	for k, e := range v {
+		doc[string(k)] = e
+	}
+	return doc, true
+}
+
+// configFromDoc7 sets map[Level]string values from documents for MergeConfig.
+func configFromDoc7(doc any, v *map[Level]string) error {
+	if doc == nil {
+		*v = nil
+		return nil
+	}
+	if value, ok := doc.(map[Level]string); ok {
+		*v = value
+		return nil
+	}
+	switch mp := doc.(type) {
+	case map[string]any:
+		result := make(map[Level]string, len(mp))
+		for k, item := range mp {
+			var key Level
+			if err := configFromDoc1(k, &key); err != nil {
+				return err
+			}
+			var value string
+			if err := configFromDoc18(item, &value); err != nil {
+				return fmt.Errorf("%v: %w", k, err)
+			}
+			result[key] = value
+		}
+		*v = result
+		return nil
+	case map[any]any:
+		result := make(map[Level]string, len(mp))
+		for k, item := range mp {
+			var key Level
+			if err := configFromDoc1(k, &key); err != nil {
+				return err
+			}
+			var value string
+			if err := configFromDoc18(item, &value); err != nil {
+				return fmt.Errorf("%v: %w", k, err)
+			}
+			result[key] = value
+		}
+		*v = result
+		return nil
+	}
+	return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "map[example.Level]string")
+}
+
+// configToDoc8 converts *bool values to documents for MergeConfig.
+func configToDoc8(v *bool) (any, bool) {
+	if v == nil {
+		return nil, false
+	}
+	return *v, true
+}
+
+// configFromDoc8 sets *bool values from documents for MergeConfig.
+func configFromDoc8(doc any, v **bool) error {
+	if doc == nil {
+		*v = nil
+		return nil
+	}
+	if value, ok := doc.(*bool); ok {
+		*v = value
+		return nil
+	}
+	elem := new(bool)
+	if err := configFromDoc21(doc, elem); err != nil {
+		return err
+	}
+	*v = elem
+	return nil
+}
+
+// configToDoc9 converts time.Duration values to documents for MergeConfig.
+func configToDoc9(v time.Duration) (any, bool) {
+	if v == 0 {
+		return nil, false
+	}
+	return v, true
+}
+
+// configFromDoc9 sets time.Duration values from documents for MergeConfig.
+func configFromDoc9(doc any, v *time.Duration) error {
+	if doc == nil {
+		*v = 0
+		return nil
+	}
+	value, err := keymerge.ConvertNumber[time.Duration](doc)
+	if err != nil {
+		return err
+	}
+	*v = value
+	return nil
+}
+
+// configToDoc10 converts time.Time values to documents for MergeConfig.
+func configToDoc10(v time.Time) (any, bool) {
+	if v == (time.Time{}) {
+		return nil, false
+	}
+	return v, true
+}
+
+// configFromDoc10 sets time.Time values from documents for MergeConfig.
+func configFromDoc10(doc any, v *time.Time) error {
+	if doc == nil {
+		*v = time.Time{}
+		return nil
+	}
+	if value, ok := doc.(time.Time); ok {
+		*v = value
+		return nil
+	}
+	if _, ok := doc.(map[string]any); !ok {
+		return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "time.Time")
+	}
+	return nil
+}
+
+// configToDoc11 converts []byte values to documents for MergeConfig.
+func configToDoc11(v []byte) (any, bool) {
+	if v == nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// configFromDoc11 sets []byte values from documents for MergeConfig.
+func configFromDoc11(doc any, v *[]byte) error {
+	if doc == nil {
+		*v = nil
+		return nil
+	}
+	if value, ok := doc.([]byte); ok {
+		*v = value
+		return nil
+	}
+	list, ok := doc.([]any)
+	if !ok {
+		return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "[]byte")
+	}
+	result := make([]byte, len(list))
+	for i, item := range list {
+		if err := configFromDoc22(item, &result[i]); err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+	*v = result
+	return nil
+}
+
+// configToDoc12 converts [2]string values to documents for MergeConfig.
+func configToDoc12(v [2]string) (any, bool) {
+	if v == ([2]string{}) {
+		return nil, false
+	}
+	list := make([]any, len(v))
+	for i, e := range v {
+		list[i] = e
+	}
+	return list, true
+}
+
+// configFromDoc12 sets [2]string values from documents for MergeConfig.
+func configFromDoc12(doc any, v *[2]string) error {
+	if doc == nil {
+		*v = [2]string{}
+		return nil
+	}
+	if value, ok := doc.([2]string); ok {
+		*v = value
+		return nil
+	}
+	list, ok := doc.([]any)
+	if !ok {
+		return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "[2]string")
+	}
+	if len(list) > len(v) {
+		return fmt.Errorf("%d items do not fit in %s", len(list), "[2]string")
+	}
+	for i, item := range list {
+		if err := configFromDoc18(item, &v[i]); err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// configToDoc13 converts map[string]any values to documents for MergeConfig.
+func configToDoc13(v map[string]any) (any, bool) {
+	if v == nil {
+		return nil, false
+	}
+	doc := make(map[string]any, len(v))
+	for k, e := range v {
+		doc[k] = e
+	}
+	return doc, true
+}
+
+// configFromDoc13 sets map[string]any values from documents for MergeConfig.
+func configFromDoc13(doc any, v *map[string]any) error {
+	if doc == nil {
+		*v = nil
+		return nil
+	}
+	if value, ok := doc.(map[string]any); ok {
+		*v = value
+		return nil
+	}
+	switch mp := doc.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(mp))
+		for k, item := range mp {
+			var key string
+			if err := configFromDoc18(k, &key); err != nil {
+				return err
+			}
+			var value any
+			if err := configFromDoc14(item, &value); err != nil {
+				return fmt.Errorf("%v: %w", k, err)
+			}
+			result[key] = value
+		}
+		*v = result
+		return nil
+	case map[any]any:
+		result := make(map[string]any, len(mp))
+		for k, item := range mp {
+			var key string
+			if err := configFromDoc18(k, &key); err != nil {
+				return err
+			}
+			var value any
+			if err := configFromDoc14(item, &value); err != nil {
+				return fmt.Errorf("%v: %w", k, err)
+			}
+			result[key] = value
+		}
+		*v = result
+		return nil
+	}
+	return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "map[string]any")
+}
+
+// configToDoc14 converts any values to documents for MergeConfig.
+func configToDoc14(v any) (any, bool) {
+	if v == nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// configFromDoc14 sets any values from documents for MergeConfig.
+func configFromDoc14(doc any, v *any) error {
+	if doc == nil {
+		*v = nil
+		return nil
+	}
+	if value, ok := doc.(any); ok {
+		*v = value
+		return nil
+	}
+	return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "any")
+}
+
+// configToDoc15 converts map[string]Weight values to documents for MergeConfig.
+func configToDoc15(v map[string]Weight) (any, bool) {
+	if v == nil {
+		return nil, false
+	}
+	doc := make(map[string]any, len(v))
+	for k, e := range v {
+		doc[k] = e
+	}
+	return doc, true
+}
+
+// configFromDoc15 sets map[string]Weight values from documents for MergeConfig.
+func configFromDoc15(doc any, v *map[string]Weight) error {
+	if doc == nil {
+		*v = nil
+		return nil
+	}
+	if value, ok := doc.(map[string]Weight); ok {
+		*v = value
+		return nil
+	}
+	switch mp := doc.(type) {
+	case map[string]any:
+		result := make(map[string]Weight, len(mp))
+		for k, item := range mp {
+			var key string
+			if err := configFromDoc18(k, &key); err != nil {
+				return err
+			}
+			var value Weight
+			if err := configFromDoc23(item, &value); err != nil {
+				return fmt.Errorf("%v: %w", k, err)
+			}
+			result[key] = value
+		}
+		*v = result
+		return nil
+	case map[any]any:
+		result := make(map[string]Weight, len(mp))
+		for k, item := range mp {
+			var key string
+			if err := configFromDoc18(k, &key); err != nil {
+				return err
+			}
+			var value Weight
+			if err := configFromDoc23(item, &value); err != nil {
+				return fmt.Errorf("%v: %w", k, err)
+			}
+			result[key] = value
+		}
+		*v = result
+		return nil
+	}
+	return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "map[string]example.Weight")
+}
+
+// configToDoc16 converts common values to documents for MergeConfig.
+func configToDoc16(v common) (any, bool) {
+	if v == (common{}) {
+		return nil, false
+	}
+	doc := make(map[string]any, 2)
+	if value, ok := configToDoc1(v.Log); ok {
+		doc["log"] = value
+	}
+	if value, ok := configToDoc18(v.Region); ok {
+		doc["region"] = value
+	}
+	return doc, true
+}
+
+// configFromDoc16 sets common values from documents for MergeConfig.
+func configFromDoc16(doc any, v *common) error {
+	if doc == nil {
+		*v = common{}
+		return nil
+	}
+	if value, ok := doc.(common); ok {
+		*v = value
+		return nil
+	}
+	mp, ok := doc.(map[string]any)
+	if !ok {
+		return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "example.common")
+	}
+	if value, exists := mp["log"]; exists {
+		if err := configFromDoc1(value, &v.Log); err != nil {
+			return fmt.Errorf("log: %w", err)
+		}
+	}
+	if value, exists := mp["region"]; exists {
+		if err := configFromDoc18(value, &v.Region); err != nil {
+			return fmt.Errorf("region: %w", err)
+		}
+	}
+	return nil
+}
+
+// configToDoc17 converts Service values to documents for MergeConfig.
+func configToDoc17(v Service) (any, bool) {
+	if v.Name == "" && v.Port == 0 && v.Aliases == nil {
+		return nil, false
+	}
+	doc := make(map[string]any, 3)
+	if value, ok := configToDoc18(v.Name); ok {
+		doc["name"] = value
+	}
+	if value, ok := configToDoc24(v.Port); ok {
+		doc["port"] = value
+	}
+	if value, ok := configToDoc3(v.Aliases); ok {
+		doc["aliases"] = value
+	}
+	return doc, true
+}
+
+// configFromDoc17 sets Service values from documents for MergeConfig.
+func configFromDoc17(doc any, v *Service) error {
+	if doc == nil {
+		*v = Service{}
+		return nil
+	}
+	if value, ok := doc.(Service); ok {
+		*v = value
+		return nil
+	}
+	mp, ok := doc.(map[string]any)
+	if !ok {
+		return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "example.Service")
+	}
+	if value, exists := mp["name"]; exists {
+		if err := configFromDoc18(value, &v.Name); err != nil {
+			return fmt.Errorf("name: %w", err)
+		}
+	}
+	if value, exists := mp["port"]; exists {
+		if err := configFromDoc24(value, &v.Port); err != nil {
+			return fmt.Errorf("port: %w", err)
+		}
+	}
+	if value, exists := mp["aliases"]; exists {
+		if err := configFromDoc3(value, &v.Aliases); err != nil {
+			return fmt.Errorf("aliases: %w", err)
+		}
+	}
+	return nil
+}
+
+// configToDoc18 converts string values to documents for MergeConfig.
+func configToDoc18(v string) (any, bool) {
+	if v == "" {
+		return nil, false
+	}
+	return v, true
+}
+
+// configFromDoc18 sets string values from documents for MergeConfig.
+func configFromDoc18(doc any, v *string) error {
+	if doc == nil {
+		*v = ""
+		return nil
+	}
+	if value, ok := doc.(string); ok {
+		*v = value
+		return nil
+	}
+	return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "string")
+}
+
+// configToDoc19 converts struct{URL string "yaml:\"url\" km:\"primary\""} values to documents for MergeConfig.
+func configToDoc19(v struct {
+	URL string "yaml:\"url\" km:\"primary\""
+}) (any, bool) {
+	if v == (struct {
+		URL string "yaml:\"url\" km:\"primary\""
+	}{}) {
+		return nil, false
+	}
+	doc := make(map[string]any, 1)
+	if value, ok := configToDoc18(v.URL); ok {
+		doc["url"] = value
+	}
+	return doc, true
+}
+
+// configFromDoc19 sets struct{URL string "yaml:\"url\" km:\"primary\""} values from documents for MergeConfig.
+func configFromDoc19(doc any, v *struct {
+	URL string "yaml:\"url\" km:\"primary\""
+}) error {
+	if doc == nil {
+		*v = struct {
+			URL string "yaml:\"url\" km:\"primary\""
+		}{}
+		return nil
+	}
+	if value, ok := doc.(struct {
+		URL string "yaml:\"url\" km:\"primary\""
+	}); ok {
+		*v = value
+		return nil
+	}
+	mp, ok := doc.(map[string]any)
+	if !ok {
+		return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "struct{URL string \"yaml:\\\"url\\\" km:\\\"primary\\\"\"}")
+	}
+	if value, exists := mp["url"]; exists {
+		if err := configFromDoc18(value, &v.URL); err != nil {
+			return fmt.Errorf("url: %w", err)
+		}
+	}
+	return nil
+}
+
+// configToDoc20 converts int values to documents for MergeConfig.
+func configToDoc20(v int) (any, bool) {
+	if v == 0 {
+		return nil, false
+	}
+	return v, true
+}
+
+// configFromDoc20 sets int values from documents for MergeConfig.
+func configFromDoc20(doc any, v *int) error {
+	if doc == nil {
+		*v = 0
+		return nil
+	}
+	value, err := keymerge.ConvertNumber[int](doc)
+	if err != nil {
+		return err
+	}
+	*v = value
+	return nil
+}
+
+// configToDoc21 converts bool values to documents for MergeConfig.
+func configToDoc21(v bool) (any, bool) {
+	if !v {
+		return nil, false
+	}
+	return v, true
+}
+
+// configFromDoc21 sets bool values from documents for MergeConfig.
+func configFromDoc21(doc any, v *bool) error {
+	if doc == nil {
+		*v = false
+		return nil
+	}
+	if value, ok := doc.(bool); ok {
+		*v = value
+		return nil
+	}
+	return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, "bool")
+}
+
+// configToDoc22 converts byte values to documents for MergeConfig.
+func configToDoc22(v byte) (any, bool) {
+	if v == 0 {
+		return nil, false
+	}
+	return v, true
+}
+
+// configFromDoc22 sets byte values from documents for MergeConfig.
+func configFromDoc22(doc any, v *byte) error {
+	if doc == nil {
+		*v = 0
+		return nil
+	}
+	value, err := keymerge.ConvertNumber[byte](doc)
+	if err != nil {
+		return err
+	}
+	*v = value
+	return nil
+}
+
+// configToDoc23 converts Weight values to documents for MergeConfig.
+func configToDoc23(v Weight) (any, bool) {
+	if v == 0 {
+		return nil, false
+	}
+	return v, true
+}
+
+// configFromDoc23 sets Weight values from documents for MergeConfig.
+func configFromDoc23(doc any, v *Weight) error {
+	if doc == nil {
+		*v = 0
+		return nil
+	}
+	value, err := keymerge.ConvertNumber[Weight](doc)
+	if err != nil {
+		return err
+	}
+	*v = value
+	return nil
+}
+
+// configToDoc24 converts uint16 values to documents for MergeConfig.
+func configToDoc24(v uint16) (any, bool) {
+	if v == 0 {
+		return nil, false
+	}
+	return v, true
+}
+
+// configFromDoc24 sets uint16 values from documents for MergeConfig.
+func configFromDoc24(doc any, v *uint16) error {
+	if doc == nil {
+		*v = 0
+		return nil
+	}
+	value, err := keymerge.ConvertNumber[uint16](doc)
+	if err != nil {
+		return err
+	}
+	*v = value
+	return nil
+}
@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package example
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestMergeConfig_MatchesMergeTyped(t *testing.T) {
+	merger, err := NewConfigMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	yes, no := true, false
+	started := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	base := Config{
+		Log: "info",
+		Services: []Service{
+			{Name: "api", Port: 80, Aliases: []string{"web"}},
+			{Name: "db", Port: 5432},
+			{},
+		},
+		Tags:    []string{"a", "b"},
+		Admin:   &Service{},
+		Extra:   Endpoints{{URL: "https://a.example.com"}},
+		Limits:  map[string]int{"cpu": 2, "retries": 3},
+		Labels:  map[Level]string{"debug": "verbose"},
+		Debug:   &yes,
+		Timeout: time.Second,
+		Cert:    []byte("cert"),
+		Pair:    [2]string{"x"},
+		Meta:    map[string]any{"owner": "ops", "nested": map[string]any{"a": 1}},
+		Weights: map[string]Weight{"east": 0.5},
+		Ignored: "base",
+		common:  common{Region: "us"},
+	}
+	overlay := Config{
+		Services: []Service{
+			{Name: "api", Port: 1, Aliases: []string{"www"}},
+			{Name: "cache", Port: 6379},
+		},
+		Tags:     []string{"b", "c"},
+		Admin:    &Service{Name: "admin"},
+		Extra:    Endpoints{{URL: "https://b.example.com"}},
+		Limits:   map[string]int{"retries": 0},
+		Debug:    &no,
+		Started:  started,
+		Meta:     map[string]any{"nested": map[string]any{"b": 2}},
+		Any:      []any{"x"},
+		Weights:  map[string]Weight{"west": 0},
+		internal: "overlay",
+		common:   common{Log: "debug"},
+	}
+
+	tests := map[string][]Config{
+		"empty":        {{}},
+		"base":         {base},
+		"base overlay": {base, overlay},
+		"overlay base": {overlay, base},
+		"zero overlay": {base, {}, overlay},
+	}
+	for name, configs := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := MergeConfig(merger, configs[0], configs[1:]...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := merger.MergeTyped(configs[0], configs[1:]...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("MergeConfig returned\n%#v\nMergeTyped returned\n%#v", got, want)
+			}
+		})
+	}
+}
+
+func TestMergeConfig_ErrorsMatchMergeTyped(t *testing.T) {
+	merger, err := NewConfigMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string][]Config{
+		// The primary key of the anonymous struct items must be unique
+		"duplicate": {{Extra: Endpoints{{URL: "a"}}}, {Extra: Endpoints{{URL: "b"}, {URL: "b"}}}},
+		// The summed port overflows uint16
+		"overflow": {
+			{Services: []Service{{Name: "api", Port: 40000}}},
+			{Services: []Service{{Name: "api", Port: 40000}}},
+		},
+	}
+	for name, configs := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, got := MergeConfig(merger, configs[0], configs[1:]...)
+			_, want := merger.MergeTyped(configs[0], configs[1:]...)
+			if got == nil || want == nil || got.Error() != want.Error() {
+				t.Errorf("MergeConfig returned %v, MergeTyped returned %v", got, want)
+			}
+		})
+	}
+}
+
+func benchmarkConfigs() (Config, Config) {
+	base := Config{Log: "info", Tags: []string{"a", "b"}, Limits: map[string]int{"cpu": 2}}
+	overlay := Config{Tags: []string{"c"}, Limits: map[string]int{"memory": 4}}
+	for i := range 20 {
+		name := "svc" + strconv.Itoa(i)
+		base.Services = append(base.Services, Service{Name: name, Port: 80, Aliases: []string{name}})
+		overlay.Services = append(overlay.Services, Service{Name: name, Port: 1})
+	}
+	return base, overlay
+}
+
+func BenchmarkMergeConfig(b *testing.B) {
+	merger, err := NewConfigMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	base, overlay := benchmarkConfigs()
+	for b.Loop() {
+		if _, err := MergeConfig(merger, base, overlay); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMergeTyped(b *testing.B) {
+	merger, err := NewConfigMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	base, overlay := benchmarkConfigs()
+	for b.Loop() {
+		if _, err := merger.MergeTyped(base, overlay); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
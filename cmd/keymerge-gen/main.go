@@ -0,0 +1,532 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Command keymerge-gen generates mergers for struct types that work without
+// reflection.
+//
+// Given a struct type Config in the current package, it writes a file declaring
+//
+//	func NewConfigMerger(opts keymerge.Options, unmarshal, marshal) (*keymerge.Merger[Config], error)
+//	func MergeConfig(merger *keymerge.Merger[Config], base Config, overlays ...Config) (Config, error)
+//
+// NewConfigMerger behaves like keymerge.NewMerger[Config] but builds its
+// metadata from generated field descriptions instead of reflecting on struct
+// tags. MergeConfig merges like merger.MergeTyped but converts the values to
+// documents and back with generated code; values of interface fields are merged
+// as they are. Use it with go generate:
+//
+//	//go:generate keymerge-gen -type Config
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"maps"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func main() {
+	var typeNames, output string
+	flag.StringVar(&typeNames, "type", "", "comma-separated list of struct type names (required)")
+	flag.StringVar(&output, "output", "", "output file name (default TYPE_keymerge.go, lowercased)")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "usage: keymerge-gen -type TYPE[,TYPE...] [flags] [DIR]\n\n")
+		fmt.Fprintf(out, "Generates constructors for keymerge mergers of the struct types declared in\n")
+		fmt.Fprintf(out, "the Go package in DIR (default the current directory), with metadata built\n")
+		fmt.Fprintf(out, "from their struct tags at generation time instead of by reflection, and\n")
+		fmt.Fprintf(out, "functions merging their values without reflection.\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	if err := run(dir, typeNames, output); err != nil {
+		fmt.Fprintln(os.Stderr, "keymerge-gen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, typeNames, output string) error {
+	if typeNames == "" {
+		return errors.New("-type is required")
+	}
+	types := strings.Split(typeNames, ",")
+	if output == "" {
+		output = strings.ToLower(types[0]) + "_keymerge.go"
+	}
+
+	pkg, err := loadPackage(dir)
+	if err != nil {
+		return err
+	}
+	src, err := generate(pkg, types)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, output), src, 0o644)
+}
+
+// pkgInfo holds the type declarations of a package.
+type pkgInfo struct {
+	name  string
+	types map[string]ast.Expr
+	// checked holds the package's type-checked types. Those that could not be
+	// type-checked, e.g. because an import is missing, are invalid.
+	checked *types.Package
+}
+
+// loadPackage parses the non-test Go files in dir.
+func loadPackage(dir string) (*pkgInfo, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	pkg := &pkgInfo{types: map[string]ast.Expr{}}
+	fset := token.NewFileSet()
+	var parsed []*ast.File
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		if pkg.name == "" {
+			pkg.name = f.Name.Name
+		}
+		parsed = append(parsed, f)
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if ts.TypeParams == nil {
+					pkg.types[ts.Name.Name] = ts.Type
+				}
+			}
+		}
+	}
+	if pkg.name == "" {
+		return nil, fmt.Errorf("no Go files in %s", dir)
+	}
+	// Errors are ignored: the generated file may be out of date, and only the
+	// types of the struct fields matter
+	config := types.Config{Importer: importer.ForCompiler(fset, "source", nil), Error: func(error) {}}
+	pkg.checked, _ = config.Check(pkg.name, fset, parsed, nil)
+	return pkg, nil
+}
+
+// generate returns the formatted source declaring constructors and merge
+// functions for types.
+func generate(pkg *pkgInfo, typeNames []string) ([]byte, error) {
+	gen := &generator{pkg: pkg.checked, imports: map[string]string{}}
+	var b bytes.Buffer
+	for _, name := range typeNames {
+		st, ok := pkg.resolve(&ast.Ident{Name: name}).(*ast.StructType)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a struct type declared in package %s", name, pkg.name)
+		}
+		fields, err := pkg.fieldSpecs(st, []string{name})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		// Validate the directives now rather than when the merger is created.
+		if _, err := keymerge.NewMetadataTree(fields...); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		fieldsVar := lowerFirst(name) + "MergeFields"
+		constructor := "New" + upperFirst(name) + "Merger"
+		mergeFunc := "Merge" + upperFirst(name)
+		if !ast.IsExported(name) {
+			constructor = "new" + upperFirst(name) + "Merger"
+			mergeFunc = "merge" + upperFirst(name)
+		}
+		fmt.Fprintf(&b, "\n// %s describes the merge directives of %s's fields.\n", fieldsVar, name)
+		fmt.Fprintf(&b, "var %s = ", fieldsVar)
+		writeSpecs(&b, fields)
+		fmt.Fprintf(&b, "\n\n// %s creates a keymerge.Merger for %s like keymerge.NewMerger, but\n", constructor, name)
+		fmt.Fprintf(&b, "// with metadata generated from its struct tags instead of built by reflection.\n")
+		fmt.Fprintf(&b, "func %s(opts keymerge.Options,\n", constructor)
+		fmt.Fprintf(&b, "\tunmarshal func([]byte, any) error,\n")
+		fmt.Fprintf(&b, "\tmarshal func(any) ([]byte, error),\n")
+		fmt.Fprintf(&b, ") (*keymerge.Merger[%s], error) {\n", name)
+		fmt.Fprintf(&b, "\tmetadata, err := keymerge.NewMetadataTree(%s...)\n", fieldsVar)
+		fmt.Fprintf(&b, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		fmt.Fprintf(&b, "\treturn keymerge.NewMergerFromMetadata[%s](opts, metadata, unmarshal, marshal)\n}\n", name)
+
+		if err := writeMergeFunc(&b, gen, name, mergeFunc); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by keymerge-gen -type %s; DO NOT EDIT.\n\n", strings.Join(typeNames, ","))
+	fmt.Fprintf(&out, "package %s\n\nimport (\n\"fmt\"\n", pkg.name)
+	paths := slices.Sorted(maps.Keys(gen.imports))
+	for _, path := range paths {
+		writeImport(&out, gen.imports[path], path)
+	}
+	out.WriteString("\n")
+	writeImport(&out, "keymerge", "github.com/sam-fredrickson/keymerge")
+	out.WriteString(")\n")
+	out.Write(b.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w", err)
+	}
+	return src, nil
+}
+
+func writeImport(b *bytes.Buffer, name, path string) {
+	if name == pathpkg.Base(path) {
+		fmt.Fprintf(b, "%q\n", path)
+	} else {
+		fmt.Fprintf(b, "%s %q\n", name, path)
+	}
+}
+
+// writeMergeFunc writes a function merging values of the struct type name like
+// Merger.MergeTyped, followed by the functions converting them to documents
+// and back that it uses instead of reflection.
+func writeMergeFunc(b *bytes.Buffer, gen *generator, name, mergeFunc string) error {
+	obj, ok := gen.pkg.Scope().Lookup(name).(*types.TypeName)
+	if !ok {
+		return errors.New("could not determine its type")
+	}
+	conv := &converter{gen: gen, prefix: lowerFirst(name), indexes: map[string]int{}}
+	toDoc, fromDoc := conv.functions(obj.Type())
+	if err := conv.write(mergeFunc); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(b, "\n// %s merges %s values left-to-right like merger.MergeTyped, but\n", mergeFunc, name)
+	fmt.Fprintf(b, "// converts them to documents and back with generated code instead of reflection.\n")
+	fmt.Fprintf(b, "func %s(merger *keymerge.Merger[%s], base %s, overlays ...%s) (%s, error) {\n", mergeFunc, name, name, name, name)
+	fmt.Fprintf(b, "\tdocs := make([]any, 0, 1+len(overlays))\n")
+	fmt.Fprintf(b, "\tdoc, _ := %s(base)\n\tdocs = append(docs, doc)\n", toDoc)
+	fmt.Fprintf(b, "\tfor _, overlay := range overlays {\n\t\tdoc, _ = %s(overlay)\n\t\tdocs = append(docs, doc)\n\t}\n", toDoc)
+	fmt.Fprintf(b, "\tvar result %s\n", name)
+	fmt.Fprintf(b, "\tmerged, err := merger.MergeUnstructured(docs...)\n")
+	fmt.Fprintf(b, "\tif err != nil {\n\t\treturn result, err\n\t}\n")
+	fmt.Fprintf(b, "\tif err := %s(merged, &result); err != nil {\n", fromDoc)
+	fmt.Fprintf(b, "\t\treturn result, &keymerge.MarshalError{Err: err, Operation: \"unmarshal\", DocIndex: -1}\n\t}\n")
+	fmt.Fprintf(b, "\treturn result, nil\n}\n")
+	b.Write(conv.b.Bytes())
+	return nil
+}
+
+// fieldSpecs describes the exported fields of a struct the way keymerge's
+// reflection-based metadata builder sees them. stack holds the names of the
+// struct types being described, to reject recursive types.
+func (p *pkgInfo) fieldSpecs(st *ast.StructType, stack []string) ([]keymerge.FieldSpec, error) {
+	var specs, inlinedSpecs []keymerge.FieldSpec
+	for _, field := range st.Fields.List {
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			unquoted, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(unquoted)
+		}
+
+		if inner, typeName, ok := p.inlined(field, tag); ok {
+			if inner == nil {
+				continue // declared in another package, so its fields are unknown
+			}
+			if slices.Contains(stack, typeName) {
+				return nil, fmt.Errorf("embedded %s: recursive type %s is not supported", typeName, typeName)
+			}
+			fields, err := p.fieldSpecs(inner, append(stack, typeName))
+			if err != nil {
+				return nil, fmt.Errorf("embedded %s: %w", typeName, err)
+			}
+			inlinedSpecs = append(inlinedSpecs, fields...)
+			continue
+		}
+
+		names := make([]string, 0, len(field.Names))
+		for _, ident := range field.Names {
+			names = append(names, ident.Name)
+		}
+		if len(field.Names) == 0 {
+			// Embedded fields are named after their type, like reflect does.
+			names = append(names, embeddedName(field.Type))
+		}
+
+		for _, goName := range names {
+			if !ast.IsExported(goName) {
+				continue
+			}
+			spec, err := p.fieldSpec(goName, tag, field.Type, stack)
+			if err != nil {
+				return nil, err
+			}
+			specs = append(specs, spec)
+		}
+	}
+	// The struct's own fields take precedence over those of embedded structs
+	for _, spec := range inlinedSpecs {
+		if !slices.ContainsFunc(specs, func(s keymerge.FieldSpec) bool { return s.Name == spec.Name }) {
+			specs = append(specs, spec)
+		}
+	}
+	return specs, nil
+}
+
+// inlined reports whether a field contributes its fields to its parent's level
+// like keymerge's reflection-based builder inlines it: a struct tagged
+// ,inline, or an embedded struct whose tags give it no name. It returns the
+// struct and its type name, or a nil struct if the type is declared in
+// another package.
+func (p *pkgInfo) inlined(field *ast.Field, tag reflect.StructTag) (*ast.StructType, string, bool) {
+	embedded := len(field.Names) == 0
+	var goName string
+	if embedded {
+		goName = embeddedName(field.Type)
+	} else if len(field.Names) == 1 {
+		goName = field.Names[0].Name
+	} else {
+		return nil, "", false
+	}
+	typ := field.Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		if !ast.IsExported(goName) {
+			return nil, "", false
+		}
+		typ = star.X
+	}
+	if !ast.IsExported(goName) && !embedded {
+		return nil, "", false
+	}
+	for _, part := range strings.Split(tag.Get("km"), ",") {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(part), "field="); ok && name != "" {
+			return nil, "", false
+		}
+	}
+
+	inline := embedded
+	for _, key := range []string{"yaml", "json", "toml"} {
+		value := tag.Get(key)
+		if value == "-" {
+			return nil, "", false
+		}
+		name, options, _ := strings.Cut(value, ",")
+		if slices.Contains(strings.Split(options, ","), "inline") {
+			inline = true
+			break
+		}
+		if name != "" {
+			return nil, "", false
+		}
+	}
+	if !inline {
+		return nil, "", false
+	}
+	switch t := p.resolve(typ).(type) {
+	case *ast.StructType:
+		return t, typeNameOf(typ), true
+	case *ast.SelectorExpr:
+		return nil, "", true
+	}
+	return nil, "", false
+}
+
+// fieldSpec describes one exported field.
+func (p *pkgInfo) fieldSpec(goName string, tag reflect.StructTag, fieldType ast.Expr, stack []string) (keymerge.FieldSpec, error) {
+	spec := keymerge.FieldSpec{Tag: tag.Get("km"), Doc: tag.Get("km-doc")}
+	name, err := fieldName(goName, tag)
+	if err != nil {
+		return spec, err
+	}
+	spec.Name = name
+
+	if hasDirective(spec.Tag, "primary") && !p.comparable(fieldType) {
+		return spec, fmt.Errorf("field %s: primary key field must be comparable type", goName)
+	}
+
+	// Unwrap pointers and slices like the reflection-based builder does.
+	typ := fieldType
+	for {
+		typ = p.resolve(typ)
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ = star.X
+		} else if arr, ok := typ.(*ast.ArrayType); ok && arr.Len == nil {
+			spec.List = true
+			typ = arr.Elt
+		} else {
+			break
+		}
+	}
+	inner, ok := typ.(*ast.StructType)
+	if !ok {
+		return spec, nil
+	}
+	typeName := typeNameOf(fieldType)
+	if typeName != "" && slices.Contains(stack, typeName) {
+		return spec, fmt.Errorf("field %s: recursive type %s is not supported", goName, typeName)
+	}
+	if spec.Fields, err = p.fieldSpecs(inner, append(stack, typeName)); err != nil {
+		return spec, fmt.Errorf("field %s: %w", goName, err)
+	}
+	return spec, nil
+}
+
+// resolve replaces names of types declared in the package by their definitions.
+// Other types, including those from other packages, are returned unchanged.
+func (p *pkgInfo) resolve(typ ast.Expr) ast.Expr {
+	for range 100 { // bounded in case of invalid cyclic declarations
+		switch t := typ.(type) {
+		case *ast.ParenExpr:
+			typ = t.X
+		case *ast.Ident:
+			def, ok := p.types[t.Name]
+			if !ok {
+				return typ
+			}
+			typ = def
+		default:
+			return typ
+		}
+	}
+	return typ
+}
+
+// comparable reports whether a field type may be comparable. Types from other
+// packages are assumed to be.
+func (p *pkgInfo) comparable(typ ast.Expr) bool {
+	switch t := p.resolve(typ).(type) {
+	case *ast.ArrayType:
+		return t.Len != nil && p.comparable(t.Elt)
+	case *ast.MapType, *ast.FuncType:
+		return false
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if !p.comparable(field.Type) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// typeNameOf returns the name of the struct type a field type refers to, if any.
+func typeNameOf(typ ast.Expr) string {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return typeNameOf(t.X)
+	case *ast.ArrayType:
+		return typeNameOf(t.Elt)
+	case *ast.ParenExpr:
+		return typeNameOf(t.X)
+	}
+	return ""
+}
+
+func embeddedName(typ ast.Expr) string {
+	switch t := typ.(type) {
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.Ident:
+		return t.Name
+	case *ast.IndexExpr:
+		return embeddedName(t.X)
+	case *ast.IndexListExpr:
+		return embeddedName(t.X)
+	}
+	return ""
+}
+
+// fieldName returns the serialized name of a field, with the same priority as
+// keymerge: km:"field=..." > yaml > json > toml > Go field name.
+func fieldName(goName string, tag reflect.StructTag) (string, error) {
+	for _, part := range strings.Split(tag.Get("km"), ",") {
+		part = strings.TrimSpace(part)
+		if name, ok := strings.CutPrefix(part, "field="); ok {
+			if name == "" {
+				return "", fmt.Errorf("field %s: field name cannot be empty", goName)
+			}
+			return name, nil
+		}
+	}
+	for _, key := range []string{"yaml", "json", "toml"} {
+		if value := tag.Get(key); value != "" && value != "-" {
+			name, _, _ := strings.Cut(value, ",")
+			return name, nil
+		}
+	}
+	return goName, nil
+}
+
+func hasDirective(kmTag, directive string) bool {
+	for _, part := range strings.Split(kmTag, ",") {
+		if strings.TrimSpace(part) == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// writeSpecs writes a []keymerge.FieldSpec composite literal.
+func writeSpecs(b *bytes.Buffer, specs []keymerge.FieldSpec) {
+	b.WriteString("[]keymerge.FieldSpec{\n")
+	for _, spec := range specs {
+		fmt.Fprintf(b, "{Name: %q", spec.Name)
+		if spec.Tag != "" {
+			fmt.Fprintf(b, ", Tag: %q", spec.Tag)
+		}
+		if spec.Doc != "" {
+			fmt.Fprintf(b, ", Doc: %q", spec.Doc)
+		}
+		if spec.List {
+			b.WriteString(", List: true")
+		}
+		if len(spec.Fields) > 0 {
+			b.WriteString(", Fields: ")
+			writeSpecs(b, spec.Fields)
+		}
+		b.WriteString("},\n")
+	}
+	b.WriteString("}")
+}
+
+func upperFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+func lowerFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[size:]
+}
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"go/ast"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+const fixture = `package example
+
+type Config struct {
+	Log      string    ` + "`yaml:\"log\" km-doc:\"Log level.\"`" + `
+	Services []Service ` + "`yaml:\"services\" km:\"dupe=consolidate\"`" + `
+	Tags     []string  ` + "`yaml:\"tags,omitempty\" km:\"mode=dedup\"`" + `
+	Admin    *Service  ` + "`json:\"admin\"`" + `
+	Extra    Endpoints ` + "`km:\"field=extra\"`" + `
+	internal string
+	common
+}
+
+type common struct {
+	Log    string ` + "`yaml:\"log\" km:\"mode=join\"`" + `
+	Region string ` + "`yaml:\"region\" km-doc:\"Deployment region.\"`" + `
+}
+
+type Service struct {
+	Name string ` + "`yaml:\"name\" km:\"primary\"`" + `
+	Port int    ` + "`yaml:\"port\"`" + `
+}
+
+type Endpoints []struct {
+	URL string ` + "`yaml:\"url\" km:\"primary\"`" + `
+}
+`
+
+// The fixture's types, to compare the generated metadata with reflection.
+type (
+	fixtureConfig struct {
+		Log      string           `yaml:"log" km-doc:"Log level."`
+		Services []fixtureService `yaml:"services" km:"dupe=consolidate"`
+		Tags     []string         `yaml:"tags,omitempty" km:"mode=dedup"`
+		Admin    *fixtureService  `json:"admin"`
+		Extra    fixtureEndpoints `km:"field=extra"`
+		common
+	}
+	common struct {
+		Log    string `yaml:"log" km:"mode=join"`
+		Region string `yaml:"region" km-doc:"Deployment region."`
+	}
+	fixtureService struct {
+		Name string `yaml:"name" km:"primary"`
+		Port int    `yaml:"port"`
+	}
+	fixtureEndpoints []struct {
+		URL string `yaml:"url" km:"primary"`
+	}
+)
+
+func writePackage(t *testing.T, src string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// TestRun checks that the generated code in internal/example, which its tests
+// compare with MergeTyped, is what the generator writes.
+func TestRun(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("internal", "example", "config.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := writePackage(t, string(src))
+	if err := run(dir, "Config", ""); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "config_keymerge.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join("internal", "example", "config_keymerge.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("generated code differs from internal/example/config_keymerge.go; run go generate there:\n%s", got)
+	}
+}
+
+func TestFieldSpecs_MatchReflection(t *testing.T) {
+	pkg, err := loadPackage(writePackage(t, fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	specs, err := pkg.fieldSpecs(pkg.types["Config"].(*ast.StructType), []string{"Config"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated, err := keymerge.NewMetadataTree(specs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reflected, err := keymerge.MetadataOf[fixtureConfig]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(generated, reflected) {
+		t.Errorf("generated metadata differs from reflection:\n%+v\n%+v", generated, reflected)
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	tests := map[string]struct {
+		src, types, message string
+	}{
+		"no type":        {fixture, "", "-type is required"},
+		"missing type":   {fixture, "Missing", "not a struct type"},
+		"not a struct":   {fixture, "Endpoints", "not a struct type"},
+		"invalid tag":    {"package p\n\ntype T struct {\n\tA []string `km:\"mode=bogus\"`\n}\n", "T", "invalid"},
+		"recursive type": {"package p\n\ntype T struct {\n\tChildren []T\n}\n", "T", "recursive type T"},
+		"non-comparable primary key": {
+			"package p\n\ntype T struct {\n\tA []string `km:\"primary\"`\n}\n", "T", "must be comparable",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := run(writePackage(t, tt.src), tt.types, "")
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("expected error containing %q, got %v", tt.message, err)
+			}
+		})
+	}
+	if err := run(t.TempDir(), "T", ""); err == nil {
+		t.Error("expected error for empty directory")
+	}
+}
@@ -0,0 +1,361 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"slices"
+	"strconv"
+)
+
+// ChangeKind describes how a value differs between two documents.
+type ChangeKind int
+
+const (
+	// ChangeAdded indicates the value exists only in the new document.
+	ChangeAdded ChangeKind = iota
+	// ChangeRemoved indicates the value exists only in the old document.
+	ChangeRemoved
+	// ChangeModified indicates the value exists in both documents but differs.
+	ChangeModified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	default:
+		return fmt.Sprintf("ChangeKind(%d)", k)
+	}
+}
+
+// Change describes a single difference between two documents.
+type Change struct {
+	// Kind tells whether the value was added, removed, or modified.
+	Kind ChangeKind
+	// Path is a path expression (see [Lookup]) addressing the value.
+	// Items of keyed lists are addressed by their primary keys, e.g. "services[name=web]".
+	Path string
+	// Old is the value in the old document (nil for additions).
+	Old any
+	// New is the value in the new document (nil for removals).
+	New any
+}
+
+// Compare reports the differences between two documents. See [UntypedMerger.Compare] for details.
+func Compare(opts Options, oldDoc, newDoc any) ([]Change, error) {
+	m, err := NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return m.Compare(oldDoc, newDoc)
+}
+
+// Compare reports the differences between two documents using the same list
+// item identity rules as merging.
+//
+// Maps are compared key by key. Lists whose items have primary keys are compared
+// item by item, matching items by key regardless of their position; list items
+// without keys are paired up in order. Other lists are compared as a whole.
+// Numbers are compared by value, so an int from YAML equals a float64 from JSON.
+// Delete marker keys are ignored.
+//
+// Changes are reported at the deepest path where the documents differ; an added
+// or removed subtree is reported once at its root. The order is deterministic.
+func (m *UntypedMerger) Compare(oldDoc, newDoc any) ([]Change, error) {
+	m.reset(0)
+	var changes []Change
+	m.compareValues("", oldDoc, newDoc, &changes)
+	return changes, nil
+}
+
+func (m *UntypedMerger) compareValues(path string, oldValue, newValue any, changes *[]Change) {
+	oldMap, oldIsMap := oldValue.(map[string]any)
+	newMap, newIsMap := newValue.(map[string]any)
+	if oldIsMap && newIsMap {
+		m.compareMaps(path, oldMap, newMap, changes)
+		return
+	}
+
+	oldList, oldIsList := asList(oldValue)
+	newList, newIsList := asList(newValue)
+	if oldIsList && newIsList && m.hasKeyedItems(oldList, newList) {
+		m.compareLists(path, oldList, newList, changes)
+		return
+	}
+
+	if !equalValues(oldValue, newValue) {
+		*changes = append(*changes, Change{Kind: ChangeModified, Path: path, Old: oldValue, New: newValue})
+	}
+}
+
+func (m *UntypedMerger) compareMaps(path string, oldMap, newMap map[string]any, changes *[]Change) {
+	keys := make([]string, 0, len(oldMap)+len(newMap))
+	for k := range oldMap {
+		keys = append(keys, k)
+	}
+	for k := range newMap {
+		if _, exists := oldMap[k]; !exists {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		if marker := m.deleteMarkerKey(); marker != "" && k == marker {
+			continue
+		}
+		childPath := appendFieldPath(path, k)
+		oldValue, inOld := oldMap[k]
+		newValue, inNew := newMap[k]
+		switch {
+		case !inOld:
+			*changes = append(*changes, Change{Kind: ChangeAdded, Path: childPath, New: newValue})
+		case !inNew:
+			*changes = append(*changes, Change{Kind: ChangeRemoved, Path: childPath, Old: oldValue})
+		default:
+			m.push(k)
+			m.compareValues(childPath, oldValue, newValue, changes)
+			m.pop()
+		}
+	}
+}
+
+// sortedKeys returns the keys of mp in sorted order.
+func sortedKeys(mp map[string]any) []string {
+	keys := make([]string, 0, len(mp))
+	for k := range mp {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// hasKeyedItems reports whether any item of either list has a usable primary key.
+func (m *UntypedMerger) hasKeyedItems(lists ...[]any) bool {
+	for _, list := range lists {
+		for i, item := range list {
+			m.push(strconv.Itoa(i))
+			key := m.getPrimaryKey(item)
+			m.pop()
+			if key != nil && isKeyComparable(key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compareLists compares two lists whose items are identified by primary key.
+// Items without a usable key are paired up by their order among unkeyed items.
+func (m *UntypedMerger) compareLists(path string, oldList, newList []any, changes *[]Change) {
+	oldIndex := make(map[any]int, len(oldList))
+	var oldUnkeyed []int
+	for i, item := range oldList {
+		m.push(strconv.Itoa(i))
+		key := m.getPrimaryKey(item)
+		m.pop()
+		if key == nil || !isKeyComparable(key) {
+			oldUnkeyed = append(oldUnkeyed, i)
+			continue
+		}
+		if _, exists := oldIndex[toMapKey(key)]; exists {
+			oldUnkeyed = append(oldUnkeyed, i)
+			continue
+		}
+		oldIndex[toMapKey(key)] = i
+	}
+
+	matched := make([]bool, len(oldList))
+	unkeyedSeen := 0
+	for j, item := range newList {
+		m.push(strconv.Itoa(j))
+		oldPos := -1
+		key := m.getPrimaryKey(item)
+		if key != nil && isKeyComparable(key) {
+			if i, exists := oldIndex[toMapKey(key)]; exists && !matched[i] {
+				oldPos = i
+			}
+		} else if unkeyedSeen < len(oldUnkeyed) {
+			oldPos = oldUnkeyed[unkeyedSeen]
+			unkeyedSeen++
+		}
+
+		itemPath := m.itemPath(path, item, j)
+		if oldPos < 0 {
+			*changes = append(*changes, Change{Kind: ChangeAdded, Path: itemPath, New: item})
+		} else {
+			matched[oldPos] = true
+			m.compareValues(itemPath, oldList[oldPos], item, changes)
+		}
+		m.pop()
+	}
+
+	for i, item := range oldList {
+		if matched[i] {
+			continue
+		}
+		m.push(strconv.Itoa(i))
+		*changes = append(*changes, Change{Kind: ChangeRemoved, Path: m.itemPath(path, item, i), Old: item})
+		m.pop()
+	}
+}
+
+// CanonicalPath rewrites a path within doc so that list items are addressed by
+// their primary keys where they have one, the way [Change] paths address them.
+// For example, "services[2].port" becomes "services[name=web].port" if the third
+// service is named web. Steps that do not resolve within doc are kept as written.
+//
+// Returns an error wrapping [ErrInvalidPath] if the path cannot be parsed.
+func (m *UntypedMerger) CanonicalPath(doc any, path string) (string, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return "", err
+	}
+	m.reset(0)
+	return m.canonicalSteps(doc, steps), nil
+}
+
+// canonicalSteps returns the path of steps within doc with list items
+// addressed by their primary keys (see [UntypedMerger.CanonicalPath]). The
+// steps are resolved from the current path, which is restored afterwards.
+func (m *UntypedMerger) canonicalSteps(doc any, steps []pathStep) string {
+	depth := len(m.path)
+	defer func() { m.path = m.path[:depth] }()
+	canonical := ""
+	current, found := doc, true
+	for _, step := range steps {
+		switch step.kind {
+		case stepField:
+			m.push(step.field)
+		default:
+			m.push(strconv.Itoa(step.index))
+		}
+		if list, ok := asList(current); found && ok && step.kind == stepIndex && step.index < len(list) {
+			canonical = m.itemPath(canonical, list[step.index], step.index)
+		} else {
+			canonical = appendStep(canonical, step)
+		}
+		if found {
+			current, found = applyStep(current, step)
+		}
+	}
+	return canonical
+}
+
+// itemPath returns the path of a list item: a key selector when the item has a
+// primary key that can be expressed as field values, otherwise its position.
+// The current path must already include the item's index.
+func (m *UntypedMerger) itemPath(listPath string, item any, index int) string {
+	if match := m.keySelector(item); match != nil {
+		return appendSelectorPath(listPath, match)
+	}
+	return appendIndexPath(listPath, index)
+}
+
+// keySelector returns the primary key fields of item as selector conditions,
+// mirroring the field choice of getPrimaryKey. Returns nil if the item has no
+// primary key or the key cannot be expressed as a selector.
+func (m *UntypedMerger) keySelector(item any) []keyMatch {
+	mp, ok := item.(map[string]any)
+	if !ok || m.keyedByFunc() {
+		return nil
+	}
+
+	var names []string
+	if meta := m.getCurrentMetadata(); meta != nil && len(meta.primaryKeys) > 0 {
+		names = meta.primaryKeys
+	} else {
+		names = m.compositeKeyFields(mp)
+	}
+	if names != nil {
+		match := make([]keyMatch, 0, len(names))
+		for _, name := range names {
+			val, exists := keyFieldValue(mp, name)
+			if !exists || val == nil || !isSelectorName(name) {
+				return nil
+			}
+			match = append(match, keyMatch{name: name, value: fmt.Sprint(val)})
+		}
+		return match
+	}
+
+	for _, name := range m.opts.PrimaryKeyNames {
+		if val, exists := keyFieldValue(mp, name); exists && val != nil {
+			if !isSelectorName(name) {
+				return nil
+			}
+			return []keyMatch{{name: name, value: fmt.Sprint(val)}}
+		}
+	}
+	return nil
+}
+
+// equalValues reports whether two documents are equal, comparing numbers by
+// value regardless of their Go type and treating typed slices like []any.
+func equalValues(a, b any) bool {
+	if aMap, ok := a.(map[string]any); ok {
+		bMap, ok := b.(map[string]any)
+		if !ok || len(aMap) != len(bMap) {
+			return false
+		}
+		for k, av := range aMap {
+			bv, exists := bMap[k]
+			if !exists || !equalValues(av, bv) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if aList, ok := asList(a); ok {
+		bList, ok := asList(b)
+		if !ok || len(aList) != len(bList) {
+			return false
+		}
+		for i := range aList {
+			if !equalValues(aList[i], bList[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if isDecimal(a, b) {
+		an, aOK := toDecimal(a)
+		bn, bOK := toDecimal(b)
+		return aOK && bOK && an.Cmp(bn) == 0
+	}
+	if an, ok := toBigFloat(a); ok {
+		bn, ok := toBigFloat(b)
+		return ok && an.Cmp(bn) == 0
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// toBigFloat converts any Go integer or finite float to an exact big.Float.
+func toBigFloat(v any) (*big.Float, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return new(big.Float).SetInt64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return new(big.Float).SetUint64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) {
+			return nil, false
+		}
+		return big.NewFloat(f), true
+	default:
+		return nil, false
+	}
+}
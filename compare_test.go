@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestCompare(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}, DeleteMarkerKey: "_delete"}
+	oldDoc := map[string]any{
+		"database": map[string]any{"host": "localhost", "port": 5432},
+		"services": []any{
+			map[string]any{"name": "api", "port": 8080},
+			map[string]any{"name": "worker", "port": 9000},
+			map[string]any{"name": "debug"},
+		},
+		"tags":    []any{"a", "b"},
+		"removed": true,
+	}
+	newDoc := map[string]any{
+		"database": map[string]any{"host": "db.example.com", "port": float64(5432)},
+		"services": []any{
+			map[string]any{"name": "worker", "port": uint64(9000), "_delete": false},
+			map[string]any{"name": "api", "port": 8081},
+			map[string]any{"name": "new"},
+		},
+		"tags":  []any{"a", "b", "c"},
+		"added": map[string]any{"x": 1},
+	}
+
+	changes, err := keymerge.Compare(opts, oldDoc, newDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []keymerge.Change{
+		{Kind: keymerge.ChangeAdded, Path: "added", New: map[string]any{"x": 1}},
+		{Kind: keymerge.ChangeModified, Path: "database.host", Old: "localhost", New: "db.example.com"},
+		{Kind: keymerge.ChangeRemoved, Path: "removed", Old: true},
+		{Kind: keymerge.ChangeModified, Path: "services[name=api].port", Old: 8080, New: 8081},
+		{Kind: keymerge.ChangeAdded, Path: "services[name=new]", New: map[string]any{"name": "new"}},
+		{Kind: keymerge.ChangeRemoved, Path: "services[name=debug]", Old: map[string]any{"name": "debug"}},
+		{Kind: keymerge.ChangeModified, Path: "tags", Old: []any{"a", "b"}, New: []any{"a", "b", "c"}},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("unexpected changes:\n got: %+v\nwant: %+v", changes, expected)
+	}
+}
+
+func TestCompare_Equal(t *testing.T) {
+	doc := map[string]any{
+		"items": []map[string]any{{"id": 1, "v": "x"}},
+		"n":     int64(3),
+	}
+	other := map[string]any{
+		"items": []any{map[string]any{"id": 1, "v": "x"}},
+		"n":     3.0,
+	}
+	changes, err := keymerge.Compare(keymerge.Options{PrimaryKeyNames: []string{"id"}}, doc, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("expected no changes, got %+v", changes)
+	}
+}
+
+func TestCompare_UnkeyedItemsInKeyedList(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}}
+	oldDoc := []any{
+		map[string]any{"name": "a"},
+		map[string]any{"value": 1},
+		"scalar",
+	}
+	newDoc := []any{
+		map[string]any{"value": 2},
+		map[string]any{"name": "a"},
+	}
+
+	changes, err := keymerge.Compare(opts, oldDoc, newDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []keymerge.Change{
+		{Kind: keymerge.ChangeModified, Path: "[0].value", Old: 1, New: 2},
+		{Kind: keymerge.ChangeRemoved, Path: "[2]", Old: "scalar"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("unexpected changes:\n got: %+v\nwant: %+v", changes, expected)
+	}
+}
+
+func TestCompare_TypedCompositeKeys(t *testing.T) {
+	type endpoint struct {
+		Region string `yaml:"region" km:"primary"`
+		Name   string `yaml:"name" km:"primary"`
+		URL    string `yaml:"url"`
+	}
+	type config struct {
+		Endpoints []endpoint `yaml:"endpoints"`
+	}
+	merger, err := keymerge.NewMerger[config](keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldDoc := map[string]any{"endpoints": []any{
+		map[string]any{"region": "us", "name": "api", "url": "a"},
+		map[string]any{"region": "eu", "name": "api", "url": "b"},
+	}}
+	newDoc := map[string]any{"endpoints": []any{
+		map[string]any{"region": "eu", "name": "api", "url": "c"},
+		map[string]any{"region": "us", "name": "api", "url": "a"},
+	}}
+
+	changes, err := merger.Compare(oldDoc, newDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change, got %+v", changes)
+	}
+	path := changes[0].Path
+	if path != "endpoints[region=eu,name=api].url" && path != "endpoints[name=api,region=eu].url" {
+		t.Fatalf("unexpected path %q", path)
+	}
+	if _, found, _ := keymerge.Lookup(newDoc, path); !found {
+		t.Fatalf("path %q should resolve in new document", path)
+	}
+}
+
+func TestCompare_QuotedPaths(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}}
+	oldDoc := map[string]any{
+		"data":  map[string]any{"config.yaml": "a"},
+		"items": []any{map[string]any{"name": "x,y", "v": 1}},
+	}
+	newDoc := map[string]any{
+		"data":  map[string]any{"config.yaml": "b"},
+		"items": []any{map[string]any{"name": "x,y", "v": 2}},
+	}
+
+	changes, err := keymerge.Compare(opts, oldDoc, newDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %+v", changes)
+	}
+	for _, change := range changes {
+		value, found, err := keymerge.Lookup(newDoc, change.Path)
+		if err != nil || !found || value != change.New {
+			t.Fatalf("path %q does not round-trip: value=%v found=%v err=%v", change.Path, value, found, err)
+		}
+	}
+}
+
+func TestCompare_InvalidOptions(t *testing.T) {
+	_, err := keymerge.Compare(keymerge.Options{PrimaryKeyNames: []string{""}}, nil, nil)
+	if err == nil {
+		t.Fatal("expected error for invalid options")
+	}
+}
+
+func TestChangeKind_String(t *testing.T) {
+	tests := map[keymerge.ChangeKind]string{
+		keymerge.ChangeAdded:    "added",
+		keymerge.ChangeRemoved:  "removed",
+		keymerge.ChangeModified: "modified",
+		keymerge.ChangeKind(99): "ChangeKind(99)",
+	}
+	for kind, expected := range tests {
+		if kind.String() != expected {
+			t.Errorf("expected %q, got %q", expected, kind.String())
+		}
+	}
+}
+
+func TestCanonicalPath(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{PrimaryKeyNames: []string{"name"}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]any{
+		"services": []any{
+			map[string]any{"name": "web", "ports": []any{80, 443}},
+			map[string]any{"port": 8080},
+		},
+	}
+	tests := map[string]string{
+		"services[0].ports[1]": "services[name=web].ports[1]",
+		"services[1].port":     "services[1].port",
+		"services[5].name":     "services[5].name",
+		"missing[0]":           "missing[0]",
+		"":                     "",
+	}
+	for path, want := range tests {
+		got, err := merger.CanonicalPath(doc, path)
+		if err != nil {
+			t.Fatalf("%q: %v", path, err)
+		}
+		if got != want {
+			t.Errorf("%q: expected %q, got %q", path, want, got)
+		}
+	}
+
+	if _, err := merger.CanonicalPath(doc, "services[x"); !errors.Is(err, keymerge.ErrInvalidPath) {
+		t.Errorf("expected ErrInvalidPath, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import "strconv"
+
+// conflictCandidates returns the candidate values of a conflict marker (see
+// [Options.ConflictMarkerKey]). It returns false if v is not a marker or
+// conflicts are not being marked.
+func (m *UntypedMerger) conflictCandidates(v any) ([]any, bool) {
+	if m.opts.ConflictMode != ConflictMark {
+		return nil, false
+	}
+	mp, ok := v.(map[string]any)
+	if !ok || len(mp) != 1 {
+		return nil, false
+	}
+	return asList(mp[m.opts.ConflictMarkerKey])
+}
+
+// markConflict returns a conflict marker holding candidates followed by the
+// overlay's value, unless a candidate already equals it. An overlay that is
+// itself a marker contributes all its candidates.
+func (m *UntypedMerger) markConflict(candidates []any, overlay any) map[string]any {
+	added, ok := m.conflictCandidates(overlay)
+	if !ok {
+		added = []any{overlay}
+	}
+	result := make([]any, len(candidates), len(candidates)+len(added))
+	copy(result, candidates)
+	for _, candidate := range added {
+		if !containsValue(result, candidate) {
+			result = append(result, candidate)
+		}
+	}
+	return map[string]any{m.opts.ConflictMarkerKey: result}
+}
+
+func containsValue(list []any, v any) bool {
+	for _, item := range list {
+		if equalValues(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnresolvedConflicts returns the paths (see [Lookup]) of the conflict markers in
+// doc, in sorted map key and list order. Merges with [ConflictMark] produce them;
+// check that the result has none before using it.
+//
+// Example:
+//
+//	if paths := merger.UnresolvedConflicts(result); len(paths) > 0 {
+//		return fmt.Errorf("resolve conflicts at %v and merge again", paths)
+//	}
+func (m *UntypedMerger) UnresolvedConflicts(doc any) []string {
+	if m.opts.ConflictMarkerKey == "" {
+		return nil
+	}
+	var paths []string
+	m.reset(0)
+	m.findConflicts("", doc, &paths)
+	return paths
+}
+
+func (m *UntypedMerger) findConflicts(path string, value any, paths *[]string) {
+	if mp, ok := value.(map[string]any); ok {
+		if len(mp) == 1 {
+			if _, isList := asList(mp[m.opts.ConflictMarkerKey]); isList {
+				*paths = append(*paths, path)
+				return
+			}
+		}
+		for _, k := range sortedKeys(mp) {
+			m.push(k)
+			m.findConflicts(appendFieldPath(path, k), mp[k], paths)
+			m.pop()
+		}
+		return
+	}
+	if list, ok := asList(value); ok {
+		for i, item := range list {
+			m.push(strconv.Itoa(i))
+			m.findConflicts(m.itemPath(path, item, i), item, paths)
+			m.pop()
+		}
+	}
+}
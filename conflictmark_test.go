@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestConflictMark(t *testing.T) {
+	opts := keymerge.Options{
+		PrimaryKeyNames:   []string{"name"},
+		ConflictMode:      keymerge.ConflictMark,
+		ConflictMarkerKey: "_conflict",
+	}
+	base := []byte(`
+log: info
+services:
+  - name: api
+    port: 8080
+    host: localhost
+`)
+	staging := []byte(`
+log: debug
+services:
+  - name: api
+    port: 9090
+    host: localhost
+`)
+	prod := []byte(`
+log: info
+services:
+  - name: api
+    port: 443
+    replicas: 3
+`)
+
+	result, err := keymerge.Merge(opts, yaml.Unmarshal, yaml.Marshal, base, staging, prod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `log:
+  _conflict:
+  - info
+  - debug
+services:
+- host: localhost
+  name: api
+  port:
+    _conflict:
+    - 8080
+    - 9090
+    - 443
+  replicas: 3
+`
+	if string(result) != expected {
+		t.Fatalf("unexpected result:\n got:\n%s\nwant:\n%s", result, expected)
+	}
+
+	merger, err := keymerge.NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc any
+	if err := yaml.Unmarshal(result, &doc); err != nil {
+		t.Fatal(err)
+	}
+	paths := merger.UnresolvedConflicts(doc)
+	if !slices.Equal(paths, []string{"log", "services[name=api].port"}) {
+		t.Errorf("unexpected unresolved conflicts %v", paths)
+	}
+
+	// Merging a marked result again keeps collecting candidates.
+	again, err := merger.MergeUnstructured(doc, map[string]any{"log": "warn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log := again.(map[string]any)["log"]; !reflect.DeepEqual(log, map[string]any{"_conflict": []any{"info", "debug", "warn"}}) {
+		t.Errorf("unexpected log marker %v", log)
+	}
+
+	// Resolving every marker leaves nothing to report.
+	resolved := map[string]any{"log": "debug", "services": []any{map[string]any{"name": "api", "port": 443}}}
+	if paths := merger.UnresolvedConflicts(resolved); len(paths) != 0 {
+		t.Errorf("expected no unresolved conflicts, got %v", paths)
+	}
+}
+
+func TestConflictMark_RequiresKey(t *testing.T) {
+	_, err := keymerge.NewUntypedMerger(keymerge.Options{ConflictMode: keymerge.ConflictMark}, nil, nil)
+	if !errors.Is(err, keymerge.ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions, got %v", err)
+	}
+}
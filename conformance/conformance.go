@@ -0,0 +1,278 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package conformance publishes test vectors for keymerge's merge semantics
+// and runs them against an implementation, so that other implementations,
+// such as generated mergers or ports to other languages, can be checked
+// against the reference one.
+//
+// The vectors are JSON files, each holding a list of [Vector]s: the options,
+// the documents to merge left-to-right, and either the expected result or the
+// category of the expected error. They are embedded in this package (see
+// [Vectors]) and can be read by any JSON parser from the vectors directory.
+package conformance
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"reflect"
+	"slices"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+//go:embed vectors/*.json
+var vectorFiles embed.FS
+
+// Error categories of vectors whose merge fails. Each is the message of the
+// keymerge sentinel error it stands for.
+const (
+	CategoryDuplicatePrimaryKey     = "duplicate primary key"
+	CategoryNonComparablePrimaryKey = "non-comparable primary key"
+	CategoryConflict                = "conflicting value"
+	CategoryAmbiguousKey            = "ambiguous primary key"
+	CategoryInvalidMove             = "invalid move"
+)
+
+// categories maps error categories to the sentinel errors of keymerge.
+var categories = map[string]error{
+	CategoryDuplicatePrimaryKey:     keymerge.ErrDuplicatePrimaryKey,
+	CategoryNonComparablePrimaryKey: keymerge.ErrNonComparablePrimaryKey,
+	CategoryConflict:                keymerge.ErrConflict,
+	CategoryAmbiguousKey:            keymerge.ErrAmbiguousKey,
+	CategoryInvalidMove:             keymerge.ErrInvalidMove,
+}
+
+// Vector is a conformance test: merging Documents with Options must produce
+// Expected or, if Error is set, fail with an error of that category.
+type Vector struct {
+	// Name identifies the vector; names are unique within a suite.
+	Name string `json:"name"`
+	// Description says what the vector checks.
+	Description string `json:"description,omitempty"`
+	// Options are the merge options.
+	Options Options `json:"options"`
+	// Documents are merged left-to-right.
+	Documents []any `json:"documents"`
+	// Expected is the merged result.
+	Expected any `json:"expected,omitempty"`
+	// Error is the category of the expected error, e.g. "duplicate primary key".
+	Error string `json:"error,omitempty"`
+}
+
+// Options are the merge options of a vector, as strings that don't depend on
+// Go. Empty fields take keymerge's defaults.
+type Options struct {
+	PrimaryKeyNames []string `json:"primaryKeyNames,omitempty"`
+	DeleteMarkerKey string   `json:"deleteMarkerKey,omitempty"`
+	MoveMarkerKey   string   `json:"moveMarkerKey,omitempty"`
+	// ScalarMode is "concat", "dedup", or "replace".
+	ScalarMode string `json:"scalarMode,omitempty"`
+	// DupeMode is "unique" or "consolidate".
+	DupeMode string `json:"dupeMode,omitempty"`
+	// KeyMatchMode is "first" or "any".
+	KeyMatchMode string `json:"keyMatchMode,omitempty"`
+	// ConflictMode is "override" or "strict".
+	ConflictMode string `json:"conflictMode,omitempty"`
+	// NullMode is "keep" or "delete".
+	NullMode string `json:"nullMode,omitempty"`
+}
+
+// Keymerge returns o as [keymerge.Options].
+func (o Options) Keymerge() (keymerge.Options, error) {
+	opts := keymerge.Options{
+		PrimaryKeyNames: o.PrimaryKeyNames,
+		DeleteMarkerKey: o.DeleteMarkerKey,
+		MoveMarkerKey:   o.MoveMarkerKey,
+	}
+	var err error
+	if opts.ScalarMode, err = keymerge.ParseScalarMode(o.ScalarMode); err != nil {
+		return opts, err
+	}
+	if opts.DupeMode, err = keymerge.ParseDupeMode(o.DupeMode); err != nil {
+		return opts, err
+	}
+	if opts.KeyMatchMode, err = lookup(o.KeyMatchMode, "keyMatchMode", map[string]keymerge.KeyMatchMode{
+		"first": keymerge.KeyMatchFirst, "any": keymerge.KeyMatchAny,
+	}); err != nil {
+		return opts, err
+	}
+	if opts.ConflictMode, err = lookup(o.ConflictMode, "conflictMode", map[string]keymerge.ConflictMode{
+		"override": keymerge.ConflictOverride, "strict": keymerge.ConflictStrict,
+	}); err != nil {
+		return opts, err
+	}
+	if opts.NullMode, err = lookup(o.NullMode, "nullMode", map[string]keymerge.NullMode{
+		"keep": keymerge.NullKeep, "delete": keymerge.NullDelete,
+	}); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// lookup returns the mode named name, or the zero mode if name is empty.
+func lookup[M any](name, field string, modes map[string]M) (M, error) {
+	mode, ok := modes[name]
+	if !ok && name != "" {
+		return mode, fmt.Errorf("invalid %s %q", field, name)
+	}
+	return mode, nil
+}
+
+// Vectors returns the published suite.
+func Vectors() ([]Vector, error) {
+	return Load(vectorFiles, "vectors")
+}
+
+// Load reads the vectors of every .json file in dir of fsys, in file name order.
+func Load(fsys fs.FS, dir string) ([]Vector, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var vectors []Vector
+	names := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		file := path.Join(dir, entry.Name())
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var parsed []Vector
+		if err := json.Unmarshal(data, &parsed); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for _, v := range parsed {
+			if v.Name == "" || names[v.Name] {
+				return nil, fmt.Errorf("%s: vector names must be unique and non-empty, got %q", file, v.Name)
+			}
+			names[v.Name] = true
+		}
+		vectors = append(vectors, parsed...)
+	}
+	return vectors, nil
+}
+
+// Implementation merges the documents of a vector with its options. An error
+// of the vector's category either wraps the keymerge sentinel error for it or
+// is a [*Failure].
+type Implementation func(opts Options, docs []any) (any, error)
+
+// Reference is the reference implementation, [keymerge.MergeUnstructured].
+func Reference(opts Options, docs []any) (any, error) {
+	kmOpts, err := opts.Keymerge()
+	if err != nil {
+		return nil, err
+	}
+	return keymerge.MergeUnstructured(kmOpts, docs...)
+}
+
+// Failure is an error reported by an implementation that does not use
+// keymerge's errors, such as one run by [Exec].
+type Failure struct {
+	// Category is the error's category, e.g. "duplicate primary key".
+	Category string `json:"error"`
+	// Message describes the error.
+	Message string `json:"message,omitempty"`
+}
+
+func (f *Failure) Error() string {
+	if f.Message == "" {
+		return f.Category
+	}
+	return f.Category + ": " + f.Message
+}
+
+// Category returns the category of err, or "" if it has none.
+func Category(err error) string {
+	var failure *Failure
+	if errors.As(err, &failure) {
+		return failure.Category
+	}
+	for category, sentinel := range categories {
+		if errors.Is(err, sentinel) {
+			return category
+		}
+	}
+	return ""
+}
+
+// Result is the outcome of running a vector.
+type Result struct {
+	Vector string `json:"vector"`
+	Passed bool   `json:"passed"`
+	// Got is the result of the implementation, if it succeeded.
+	Got any `json:"got,omitempty"`
+	// Err is the error of the implementation, if it failed.
+	Err string `json:"error,omitempty"`
+}
+
+// Run runs vectors against impl. Results compare as JSON values do, so numbers
+// match whatever their Go type, and maps match regardless of key order.
+func Run(vectors []Vector, impl Implementation) []Result {
+	results := make([]Result, len(vectors))
+	for i, v := range vectors {
+		docs := make([]any, len(v.Documents))
+		for j, doc := range v.Documents {
+			docs[j] = clone(doc)
+		}
+		got, err := impl(v.Options, docs)
+		result := Result{Vector: v.Name}
+		if err != nil {
+			result.Err = err.Error()
+			result.Passed = v.Error != "" && Category(err) == v.Error
+		} else {
+			result.Got = got
+			result.Passed = v.Error == "" && equalJSON(got, v.Expected)
+		}
+		results[i] = result
+	}
+	return results
+}
+
+// Failed returns the results that did not pass.
+func Failed(results []Result) []Result {
+	return slices.DeleteFunc(slices.Clone(results), func(r Result) bool { return r.Passed })
+}
+
+// clone returns a deep copy of a JSON value, so implementations may modify
+// the documents they merge.
+func clone(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for k, val := range v {
+			result[k] = clone(val)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = clone(item)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// equalJSON reports whether a and b encode to the same JSON value.
+func equalJSON(a, b any) bool {
+	normalized := make([]any, 2)
+	for i, value := range []any{a, b} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return false
+		}
+		if err := json.Unmarshal(data, &normalized[i]); err != nil {
+			return false
+		}
+	}
+	return reflect.DeepEqual(normalized[0], normalized[1])
+}
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package conformance_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sam-fredrickson/keymerge/conformance"
+)
+
+func TestVectors_Reference(t *testing.T) {
+	vectors, err := conformance.Vectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) == 0 {
+		t.Fatal("expected a published suite")
+	}
+	for _, result := range conformance.Run(vectors, conformance.Reference) {
+		if !result.Passed {
+			t.Errorf("%s: got %#v, error %q", result.Vector, result.Got, result.Err)
+		}
+	}
+}
+
+func TestRun_Failures(t *testing.T) {
+	vectors := []conformance.Vector{
+		{Name: "ok", Documents: []any{map[string]any{"a": 1}}, Expected: map[string]any{"a": 1.0}},
+		{Name: "wrong", Documents: []any{map[string]any{"a": 1}}, Expected: map[string]any{"a": 2}},
+		{Name: "unexpected error", Documents: []any{map[string]any{}}, Expected: map[string]any{}},
+		{Name: "wrong category", Documents: []any{map[string]any{}}, Error: conformance.CategoryConflict},
+	}
+	calls := 0
+	impl := func(opts conformance.Options, docs []any) (any, error) {
+		calls++
+		switch calls {
+		case 3:
+			return nil, errors.New("boom")
+		case 4:
+			return nil, &conformance.Failure{Category: conformance.CategoryAmbiguousKey}
+		default:
+			return docs[0], nil
+		}
+	}
+	failed := conformance.Failed(conformance.Run(vectors, impl))
+	if len(failed) != 3 || failed[0].Vector != "wrong" || failed[2].Err != conformance.CategoryAmbiguousKey {
+		t.Errorf("unexpected failures %+v", failed)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	for name, fsys := range map[string]fstest.MapFS{
+		"invalid":   {"v/a.json": {Data: []byte(`{}`)}},
+		"unnamed":   {"v/a.json": {Data: []byte(`[{"documents": []}]`)}},
+		"duplicate": {"v/a.json": {Data: []byte(`[{"name": "x"}]`)}, "v/b.json": {Data: []byte(`[{"name": "x"}]`)}},
+		"missing":   {},
+	} {
+		if _, err := conformance.Load(fsys, "v"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestOptions_Keymerge(t *testing.T) {
+	opts, err := conformance.Options{ScalarMode: "dedup", NullMode: "delete"}.Keymerge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.ScalarMode.String() != "ScalarDedup" || opts.NullMode.String() != "NullDelete" {
+		t.Errorf("unexpected options %+v", opts)
+	}
+	for _, invalid := range []conformance.Options{{ScalarMode: "sum"}, {DupeMode: "x"}, {ConflictMode: "mark"}} {
+		if _, err := invalid.Keymerge(); err == nil {
+			t.Errorf("expected %+v to fail", invalid)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+)
+
+// request is what [Exec] writes to the command's standard input.
+type request struct {
+	Options   Options `json:"options"`
+	Documents []any   `json:"documents"`
+}
+
+// response is what [Exec] reads from the command's standard output.
+type response struct {
+	Result any `json:"result"`
+	Failure
+}
+
+// Exec returns an implementation that runs a command for each vector, such as
+// a port of keymerge to another language. The command reads a JSON object with
+// "options" and "documents" from standard input, and writes a JSON object to
+// standard output: {"result": ...} with the merged result, or
+// {"error": CATEGORY, "message": ...} if the merge fails. A command that exits
+// with a non-zero status fails the vector.
+func Exec(name string, args ...string) Implementation {
+	return func(opts Options, docs []any) (any, error) {
+		input, err := json.Marshal(request{Options: opts, Documents: docs})
+		if err != nil {
+			return nil, err
+		}
+		cmd := exec.Command(name, args...)
+		cmd.Stdin = bytes.NewReader(input)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		output, err := cmd.Output()
+		if err != nil {
+			if stderr.Len() > 0 {
+				return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+			}
+			return nil, err
+		}
+		var resp response
+		if err := json.Unmarshal(output, &resp); err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		if resp.Category != "" {
+			return nil, &resp.Failure
+		}
+		return resp.Result, nil
+	}
+}
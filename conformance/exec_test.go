@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package conformance_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge/conformance"
+)
+
+// TestExecHelper is run by TestExec as the command under test: it merges its
+// request with the reference implementation, speaking the Exec protocol.
+func TestExecHelper(t *testing.T) {
+	if os.Getenv("CONFORMANCE_HELPER") == "" {
+		t.Skip("run by TestExec")
+	}
+	var req struct {
+		Options   conformance.Options `json:"options"`
+		Documents []any               `json:"documents"`
+	}
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		os.Exit(2)
+	}
+	var resp any
+	result, err := conformance.Reference(req.Options, req.Documents)
+	if err != nil {
+		resp = map[string]any{"error": conformance.Category(err), "message": err.Error()}
+	} else {
+		resp = map[string]any{"result": result}
+	}
+	_ = json.NewEncoder(os.Stdout).Encode(resp)
+	os.Exit(0)
+}
+
+func TestExec(t *testing.T) {
+	vectors, err := conformance.Vectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFORMANCE_HELPER", "1")
+	impl := conformance.Exec(os.Args[0], "-test.run=^TestExecHelper$")
+	for _, result := range conformance.Run(vectors, impl) {
+		if !result.Passed {
+			t.Errorf("%s: got %#v, error %q", result.Vector, result.Got, result.Err)
+		}
+	}
+
+	failing := conformance.Exec(os.Args[0], "-test.run=^TestExecHelper$", "-test.count=invalid")
+	if _, err := failing(conformance.Options{}, nil); err == nil {
+		t.Error("expected a failing command to fail")
+	}
+}
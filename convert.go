@@ -0,0 +1,375 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// MergeTyped merges Go values of type T left-to-right with the struct tag
+// directives of [Merger.Merge], but without marshaling: values are converted
+// to unstructured documents and back by reflection, so it needs no marshal
+// functions and allocates far less.
+//
+// Unlike Merge, which sees every field a marshal function writes, MergeTyped
+// treats struct fields that are zero as unset, since a Go value cannot leave a
+// field out: a field that is zero in an overlay does not change the result.
+// Use pointer fields, such as *bool or *int, for values that overlays must be
+// able to set to false or 0. Map values and list items are kept even when
+// zero, so an overlay's map[string]int{"retries": 0} does set retries to 0.
+// Field names are those of [Merger]; structs without exported fields, such as
+// time.Time, are merged as single values.
+//
+// Example:
+//
+//	merger, _ := keymerge.NewMerger[Config](keymerge.Options{}, nil, nil)
+//	cfg, err := merger.MergeTyped(defaults, fromFile, fromFlags)
+func (m *Merger[T]) MergeTyped(base T, overlays ...T) (T, error) {
+	var result T
+	docs := make([]any, 0, 1+len(overlays))
+	for _, value := range append([]T{base}, overlays...) {
+		doc, _ := toUntyped(reflect.ValueOf(&value).Elem())
+		docs = append(docs, doc)
+	}
+	merged, err := m.MergeUnstructured(docs...)
+	if err != nil {
+		return result, err
+	}
+	if err := fromUntyped(merged, reflect.ValueOf(&result).Elem()); err != nil {
+		return result, &MarshalError{Err: err, Operation: "unmarshal", DocIndex: -1}
+	}
+	return result, nil
+}
+
+// toUntyped converts a Go value to an unstructured document, leaving out zero
+// values unless a pointer points to them or they are map values or list items.
+// It returns false if v is left out.
+func toUntyped(v reflect.Value) (any, bool) {
+	if !v.IsValid() || v.IsZero() {
+		return nil, false
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		// Pointers set even zero values, such as false
+		doc := toUntypedItem(v.Elem())
+		return doc, doc != nil
+	case reflect.Struct:
+		if !hasExportedFields(v.Type()) {
+			return v.Interface(), true
+		}
+		doc := make(map[string]any, v.NumField())
+		var embedded []map[string]any
+		for i := 0; i < v.NumField(); i++ {
+			if inlined := inlinedStruct(v.Type().Field(i)); inlined != nil {
+				if !hasExportedFields(inlined) {
+					continue
+				}
+				if value, ok := toUntyped(v.Field(i)); ok {
+					if mp, ok := value.(map[string]any); ok {
+						embedded = append(embedded, mp)
+					}
+				}
+				continue
+			}
+			name, ok := convertedFieldName(v.Type().Field(i))
+			if !ok {
+				continue
+			}
+			if value, ok := toUntyped(v.Field(i)); ok {
+				doc[name] = value
+			}
+		}
+		// The struct's own fields take precedence over embedded ones
+		for _, fields := range embedded {
+			for name, value := range fields {
+				if _, exists := doc[name]; !exists {
+					doc[name] = value
+				}
+			}
+		}
+		return doc, true
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			doc := make(map[string]any, v.Len())
+			for iter := v.MapRange(); iter.Next(); {
+				doc[iter.Key().String()] = toUntypedItem(iter.Value())
+			}
+			return doc, true
+		}
+		doc := make(map[any]any, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			doc[iter.Key().Interface()] = toUntypedItem(iter.Value())
+		}
+		return doc, true
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// Byte slices are single values, as when unmarshaled
+			return v.Interface(), true
+		}
+		list := make([]any, v.Len())
+		for i := range list {
+			list[i] = toUntypedItem(v.Index(i))
+		}
+		return list, true
+	default:
+		return v.Interface(), true
+	}
+}
+
+// toUntypedItem converts a value that is set even when zero, such as a map
+// value, a list item, or what a pointer points to. Nil maps, slices, and
+// pointers are converted to nil.
+func toUntypedItem(v reflect.Value) any {
+	if doc, ok := toUntyped(v); ok {
+		return doc
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if hasExportedFields(v.Type()) {
+			return map[string]any{}
+		}
+		return v.Interface()
+	case reflect.Invalid, reflect.Map, reflect.Slice, reflect.Ptr, reflect.Interface:
+		return nil
+	default:
+		return v.Interface()
+	}
+}
+
+// fromUntyped sets v to an unstructured document, converting numbers and
+// strings to v's type where needed.
+func fromUntyped(doc any, v reflect.Value) error {
+	if doc == nil {
+		v.SetZero()
+		return nil
+	}
+	if ordered, ok := doc.(*OrderedMap); ok {
+		doc = Unordered(ordered)
+	}
+	dv := reflect.ValueOf(doc)
+	t := v.Type()
+	if dv.Type().AssignableTo(t) {
+		v.Set(dv)
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(t.Elem())
+		if err := fromUntyped(doc, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	case reflect.Struct:
+		mp, ok := doc.(map[string]any)
+		if !ok {
+			break
+		}
+		return structFromUntyped(mp, v)
+	case reflect.Map:
+		mp, ok := asAnyMapValue(doc)
+		if !ok {
+			break
+		}
+		result := reflect.MakeMapWithSize(t, len(mp))
+		for k, item := range mp {
+			key := reflect.New(t.Key()).Elem()
+			if err := fromUntyped(k, key); err != nil {
+				return err
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err := fromUntyped(item, value); err != nil {
+				return fmt.Errorf("%v: %w", k, err)
+			}
+			result.SetMapIndex(key, value)
+		}
+		v.Set(result)
+		return nil
+	case reflect.Slice, reflect.Array:
+		list, ok := asList(doc)
+		if !ok {
+			break
+		}
+		if t.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, len(list), len(list)))
+		} else if len(list) > v.Len() {
+			return fmt.Errorf("%d items do not fit in %s", len(list), t)
+		}
+		for i, item := range list {
+			if err := fromUntyped(item, v.Index(i)); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+		return nil
+	}
+
+	if convertible(dv, t) {
+		converted := dv.Convert(t)
+		if converted.Convert(dv.Type()).Interface() != doc {
+			return fmt.Errorf("%v does not fit in %s", doc, t)
+		}
+		v.Set(converted)
+		return nil
+	}
+	return fmt.Errorf("cannot use %v (type %T) as %s", doc, doc, t)
+}
+
+// structFromUntyped sets the fields of a struct from a map.
+func structFromUntyped(doc map[string]any, v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		if inlinedStruct(v.Type().Field(i)) != nil {
+			if err := fromUntyped(doc, v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+		name, ok := convertedFieldName(v.Type().Field(i))
+		if !ok {
+			continue
+		}
+		value, exists := doc[name]
+		if !exists {
+			continue
+		}
+		if err := fromUntyped(value, v.Field(i)); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// convertedFieldName returns the name a struct field has in unstructured
+// documents, the way [Merger] names it. It returns false for fields that are
+// not converted.
+func convertedFieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	for _, tagName := range []string{"yaml", "json", "toml"} {
+		if field.Tag.Get(tagName) == "-" {
+			return "", false
+		}
+	}
+	name, err := getFieldName(field)
+	if err != nil {
+		return "", false
+	}
+	return name, true
+}
+
+// hasExportedFields reports whether a struct type has fields that are converted
+// to map entries, including those of embedded structs.
+func hasExportedFields(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if inlined := inlinedStruct(t.Field(i)); inlined != nil {
+			if hasExportedFields(inlined) {
+				return true
+			}
+			continue
+		}
+		if _, ok := convertedFieldName(t.Field(i)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// asAnyMapValue returns the entries of a map with string or other keys.
+func asAnyMapValue(doc any) (map[any]any, bool) {
+	if !isMap(doc) {
+		return nil, false
+	}
+	return asAnyMap(doc), true
+}
+
+// convertible reports whether a scalar can be converted to t without changing
+// its meaning: numbers to numbers, strings to strings, and bools to bools.
+func convertible(v reflect.Value, t reflect.Type) bool {
+	switch {
+	case v.CanInt() || v.CanUint() || v.CanFloat():
+		return t.Kind() >= reflect.Int && t.Kind() <= reflect.Float64
+	case v.Kind() == reflect.String:
+		return t.Kind() == reflect.String
+	case v.Kind() == reflect.Bool:
+		return t.Kind() == reflect.Bool
+	default:
+		return false
+	}
+}
+
+// ConvertNumber converts a number of a merged document to N the way
+// [Merger.MergeTyped] does, but without reflection, for the merge functions
+// that keymerge-gen generates. It returns an error if doc is not a number or
+// does not fit in N.
+func ConvertNumber[N ~int | ~int8 | ~int16 | ~int32 | ~int64 |
+	~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+	~float32 | ~float64](doc any) (N, error) {
+	if n, ok := doc.(N); ok {
+		return n, nil
+	}
+	var n N
+	var fits bool
+	// Numbers of every type widen to one of these without loss
+	if i, ok := widenInt(doc); ok {
+		n = N(i)
+		fits = int64(n) == i
+	} else if u, ok := widenUint(doc); ok {
+		n = N(u)
+		fits = uint64(n) == u
+	} else if f, ok := widenFloat(doc); ok {
+		n = N(f)
+		fits = float64(n) == f
+	} else {
+		return n, fmt.Errorf("cannot use %v (type %T) as %T", doc, doc, n)
+	}
+	if !fits {
+		return 0, fmt.Errorf("%v does not fit in %T", doc, n)
+	}
+	return n, nil
+}
+
+func widenInt(doc any) (int64, bool) {
+	switch x := doc.(type) {
+	case int:
+		return int64(x), true
+	case int8:
+		return int64(x), true
+	case int16:
+		return int64(x), true
+	case int32:
+		return int64(x), true
+	case int64:
+		return x, true
+	}
+	return 0, false
+}
+
+func widenUint(doc any) (uint64, bool) {
+	switch x := doc.(type) {
+	case uint:
+		return uint64(x), true
+	case uint8:
+		return uint64(x), true
+	case uint16:
+		return uint64(x), true
+	case uint32:
+		return uint64(x), true
+	case uint64:
+		return x, true
+	case uintptr:
+		return uint64(x), true
+	}
+	return 0, false
+}
+
+func widenFloat(doc any) (float64, bool) {
+	switch x := doc.(type) {
+	case float32:
+		return float64(x), true
+	case float64:
+		return x, true
+	}
+	return 0, false
+}
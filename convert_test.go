@@ -0,0 +1,205 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+type typedService struct {
+	Name     string            `yaml:"name" km:"primary"`
+	Replicas int               `yaml:"replicas" km:"agg=sum"`
+	Public   *bool             `yaml:"public"`
+	Tags     []string          `yaml:"tags" km:"mode=dedup"`
+	Labels   map[string]string `yaml:"labels"`
+}
+
+type typedConfig struct {
+	Version  string         `yaml:"version"`
+	Timeout  time.Duration  `yaml:"timeout"`
+	Started  time.Time      `yaml:"started"`
+	Cert     []byte         `yaml:"cert"`
+	Services []typedService `yaml:"services"`
+	Extra    map[string]any `yaml:"extra"`
+	Limits   *struct {
+		CPU    float64 `yaml:"cpu"`
+		Memory int64   `yaml:"memory"`
+	} `yaml:"limits"`
+	Ignored string `yaml:"-"`
+	private int
+}
+
+func TestMerger_MergeTyped(t *testing.T) {
+	merger, err := keymerge.NewMerger[typedConfig](keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	yes, no := true, false
+	started := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	base := typedConfig{
+		Version: "1",
+		Timeout: time.Second,
+		Cert:    []byte("cert"),
+		Services: []typedService{
+			{Name: "api", Replicas: 2, Public: &yes, Tags: []string{"a", "b"}, Labels: map[string]string{"tier": "web"}},
+			{Name: "db", Replicas: 1},
+		},
+		Extra:   map[string]any{"debug": true},
+		Ignored: "base",
+		private: 1,
+	}
+	overlay := typedConfig{
+		Started: started,
+		Services: []typedService{
+			{Name: "api", Replicas: 3, Public: &no, Tags: []string{"b", "c"}},
+			{Name: "cache", Replicas: 1},
+		},
+		Extra: map[string]any{"level": "info"},
+		Limits: &struct {
+			CPU    float64 `yaml:"cpu"`
+			Memory int64   `yaml:"memory"`
+		}{CPU: 0.5},
+		Ignored: "overlay",
+	}
+
+	result, err := merger.MergeTyped(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := typedConfig{
+		Version: "1",
+		Timeout: time.Second,
+		Started: started,
+		Cert:    []byte("cert"),
+		Services: []typedService{
+			{Name: "api", Replicas: 5, Public: &no, Tags: []string{"a", "b", "c"}, Labels: map[string]string{"tier": "web"}},
+			{Name: "db", Replicas: 1},
+			{Name: "cache", Replicas: 1},
+		},
+		Extra: map[string]any{"debug": true, "level": "info"},
+		Limits: &struct {
+			CPU    float64 `yaml:"cpu"`
+			Memory int64   `yaml:"memory"`
+		}{CPU: 0.5},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+	if base.Services[0].Replicas != 2 || len(base.Services) != 2 {
+		t.Errorf("base was modified: %+v", base)
+	}
+}
+
+func TestMerger_MergeTypedErrors(t *testing.T) {
+	merger, err := keymerge.NewMerger[[]typedService](keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = merger.MergeTyped([]typedService{{Name: "a"}}, []typedService{{Name: "b"}, {Name: "b"}})
+	if !errors.Is(err, keymerge.ErrDuplicatePrimaryKey) {
+		t.Errorf("expected ErrDuplicatePrimaryKey, got %v", err)
+	}
+
+	// Results that don't fit the type are reported as unmarshal errors
+	type Small struct {
+		Count int8 `yaml:"count" km:"agg=sum"`
+	}
+	small, err := keymerge.NewMerger[Small](keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = small.MergeTyped(Small{Count: 100}, Small{Count: 100})
+	var marshalErr *keymerge.MarshalError
+	if !errors.As(err, &marshalErr) || marshalErr.Operation != "unmarshal" {
+		t.Errorf("expected unmarshal MarshalError, got %v", err)
+	}
+}
+
+func TestMerger_MergeTypedEmbedded(t *testing.T) {
+	type ownership struct {
+		Owner string `json:"owner"`
+	}
+	type Common struct {
+		Tags []string `json:"tags" km:"mode=dedup"`
+	}
+	type Service struct {
+		ownership
+		*Common
+		Name string `json:"name" km:"primary"`
+	}
+	merger, err := keymerge.NewMerger[[]Service](keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := merger.MergeTyped(
+		[]Service{{ownership: ownership{Owner: "alice"}, Common: &Common{Tags: []string{"a", "b"}}, Name: "web"}},
+		[]Service{{Common: &Common{Tags: []string{"b", "c"}}, Name: "web"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Service{{ownership: ownership{Owner: "alice"}, Common: &Common{Tags: []string{"a", "b", "c"}}, Name: "web"}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+}
+
+func TestMerger_MergeTypedZeroValues(t *testing.T) {
+	type config struct {
+		Port    int            `yaml:"port"`
+		Debug   *bool          `yaml:"debug"`
+		Retries map[string]int `yaml:"retries"`
+		Ports   []int          `yaml:"ports"`
+		Names   []string       `yaml:"names"`
+	}
+	merger, err := keymerge.NewMerger[config](keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	yes, no := true, false
+	base := config{Port: 80, Debug: &yes, Retries: map[string]int{"get": 3, "put": 1}, Ports: []int{1}}
+	overlay := config{Debug: &no, Retries: map[string]int{"get": 0}, Ports: []int{0}, Names: []string{"", "a"}}
+
+	result, err := merger.MergeTyped(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The zero port is unset, but zero map values and list items are kept
+	expected := config{
+		Port:    80,
+		Debug:   &no,
+		Retries: map[string]int{"get": 0, "put": 1},
+		Ports:   []int{1, 0},
+		Names:   []string{"", "a"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+}
+
+func TestConvertNumber(t *testing.T) {
+	type port uint16
+	if n, err := keymerge.ConvertNumber[port](int64(8080)); err != nil || n != 8080 {
+		t.Errorf("expected 8080, got %v, %v", n, err)
+	}
+	if n, err := keymerge.ConvertNumber[int](float64(3)); err != nil || n != 3 {
+		t.Errorf("expected 3, got %v, %v", n, err)
+	}
+	if n, err := keymerge.ConvertNumber[time.Duration](time.Second); err != nil || n != time.Second {
+		t.Errorf("expected 1s, got %v, %v", n, err)
+	}
+	for _, doc := range []any{int64(70000), 1.5, uint64(1 << 63)} {
+		if _, err := keymerge.ConvertNumber[port](doc); err == nil || !strings.Contains(err.Error(), "does not fit") {
+			t.Errorf("expected %v not to fit, got %v", doc, err)
+		}
+	}
+	if _, err := keymerge.ConvertNumber[int]("3"); err == nil || !strings.Contains(err.Error(), "cannot use") {
+		t.Errorf("expected error for a string, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ErrCustomMerge indicates a [CustomMerger] could not merge two list items.
+var ErrCustomMerge = errors.New("custom merge failed")
+
+// CustomMerger is implemented by list item types with domain-specific merge
+// logic, such as CIDR sets or version ranges. When a [Merger] matches an item of
+// such a type with an overlay's item, it calls MergeKM on the base item instead
+// of deep merging the two.
+//
+// overlay is the overlay's item, decoded into the same type as the base item
+// (not a pointer to it), and the returned value becomes the merged item. Items
+// are converted with the merger's marshal and unmarshal functions, so the type
+// must round-trip through them, or by reflection if it has none (see
+// [Merger.MergeTyped]).
+//
+// Example:
+//
+//	type Network struct {
+//		Name  string   `yaml:"name" km:"primary"`
+//		CIDRs []string `yaml:"cidrs"`
+//	}
+//
+//	func (n Network) MergeKM(overlay any) (any, error) {
+//		o := overlay.(Network)
+//		n.CIDRs = summarize(append(n.CIDRs, o.CIDRs...))
+//		return n, nil
+//	}
+type CustomMerger interface {
+	MergeKM(overlay any) (any, error)
+}
+
+// CustomMergeError is returned when a [CustomMerger] fails, or when its items
+// cannot be converted to or from its type.
+type CustomMergeError struct {
+	// Path is where in the document the items occurred.
+	Path []string
+	// Type is the list item type implementing [CustomMerger].
+	Type reflect.Type
+	// DocIndex tells which document the error occurred.
+	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *CustomMergeError) Error() string {
+	path := strings.Join(e.Path, ".")
+	if path == "" {
+		path = "(root)"
+	}
+	return fmt.Sprintf("cannot merge %v items at path %s in document %d%s: %v",
+		e.Type, path, e.DocIndex, nameSuffix(e.DocName), e.Err)
+}
+
+func (e *CustomMergeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CustomMergeError) Is(target error) bool {
+	return target == ErrCustomMerge
+}
+
+var customMergerType = reflect.TypeOf((*CustomMerger)(nil)).Elem()
+
+// customMergerOf returns t if t or a pointer to it implements [CustomMerger],
+// or nil otherwise.
+func customMergerOf(t reflect.Type) reflect.Type {
+	if t.Implements(customMergerType) || reflect.PointerTo(t).Implements(customMergerType) {
+		return t
+	}
+	return nil
+}
+
+// customMerger returns the [CustomMerger] type of the list item at the current
+// path, or nil if it has none.
+func (m *UntypedMerger) customMerger() reflect.Type {
+	if len(m.path) == 0 || !isNumeric(m.path[len(m.path)-1].name) {
+		return nil
+	}
+	if meta := m.getCurrentMetadata(); meta != nil {
+		return meta.custom
+	}
+	return nil
+}
+
+// mergeCustom merges two list items of type t with its MergeKM method.
+func (m *UntypedMerger) mergeCustom(t reflect.Type, base, overlay any) (any, error) {
+	merged, err := m.callCustom(t, base, overlay)
+	if err != nil {
+		return nil, &CustomMergeError{
+			Path:     m.pathNames(),
+			Type:     t,
+			DocIndex: m.index,
+			Err:      err,
+		}
+	}
+	return merged, nil
+}
+
+func (m *UntypedMerger) callCustom(t reflect.Type, base, overlay any) (any, error) {
+	receiver, err := m.convert(base, t)
+	if err != nil {
+		return nil, err
+	}
+	other, err := m.convert(overlay, t)
+	if err != nil {
+		return nil, err
+	}
+	merger, ok := receiver.Interface().(CustomMerger)
+	if !ok {
+		merger = receiver.Addr().Interface().(CustomMerger)
+	}
+	merged, err := merger.MergeKM(other.Interface())
+	if err != nil {
+		return nil, err
+	}
+	if m.marshal == nil || m.unmarshal == nil {
+		result, _ := toUntyped(reflect.ValueOf(merged))
+		return result, nil
+	}
+	data, err := m.marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	var result any
+	if err := m.unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// convert decodes an untyped value into a new, addressable value of type t,
+// by reflection if the merger has no marshal functions.
+func (m *UntypedMerger) convert(value any, t reflect.Type) (reflect.Value, error) {
+	if m.marshal == nil || m.unmarshal == nil {
+		v := reflect.New(t).Elem()
+		return v, fromUntyped(value, v)
+	}
+	data, err := m.marshal(value)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	ptr := reflect.New(t)
+	if err := m.unmarshal(data, ptr.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return ptr.Elem(), nil
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+type cidrSet struct {
+	Name  string   `yaml:"name" km:"primary"`
+	CIDRs []string `yaml:"cidrs"`
+	Owner string   `yaml:"owner"`
+}
+
+// MergeKM unions the CIDRs of both sets, keeping them sorted, and keeps the
+// base set's owner.
+func (s cidrSet) MergeKM(overlay any) (any, error) {
+	o, ok := overlay.(cidrSet)
+	if !ok {
+		return nil, errors.New("overlay is not a cidrSet")
+	}
+	if o.Owner == "forbidden" {
+		return nil, errors.New("forbidden owner")
+	}
+	cidrs := slices.Concat(s.CIDRs, o.CIDRs)
+	slices.Sort(cidrs)
+	s.CIDRs = slices.Compact(cidrs)
+	return s, nil
+}
+
+type versionRange struct {
+	Name string `yaml:"name" km:"primary"`
+	Min  int    `yaml:"min"`
+	Max  int    `yaml:"max"`
+}
+
+// MergeKM narrows the range to the intersection of both.
+func (r *versionRange) MergeKM(overlay any) (any, error) {
+	o := overlay.(versionRange)
+	return versionRange{Name: r.Name, Min: max(r.Min, o.Min), Max: min(r.Max, o.Max)}, nil
+}
+
+func TestMerger_CustomMerger(t *testing.T) {
+	type Config struct {
+		Networks []cidrSet       `yaml:"networks"`
+		Versions []*versionRange `yaml:"versions"`
+	}
+	merger, err := keymerge.NewMerger[Config](keymerge.Options{}, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := merger.Merge(
+		[]byte("networks:\n  - name: a\n    cidrs: [10.0.0.0/8, 192.168.0.0/16]\n    owner: ops\nversions:\n  - name: go\n    min: 1\n    max: 9\n"),
+		[]byte("networks:\n  - name: a\n    cidrs: [172.16.0.0/12, 10.0.0.0/8]\n    owner: dev\n  - name: b\n    cidrs: [127.0.0.0/8]\nversions:\n  - name: go\n    min: 3\n    max: 12\n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := yaml.Unmarshal(result, &config); err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{
+		Networks: []cidrSet{
+			{Name: "a", CIDRs: []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}, Owner: "ops"},
+			{Name: "b", CIDRs: []string{"127.0.0.0/8"}},
+		},
+		Versions: []*versionRange{{Name: "go", Min: 3, Max: 9}},
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+
+	_, err = merger.Merge(
+		[]byte("networks:\n  - name: a\n    owner: ops\n"),
+		[]byte("networks:\n  - name: a\n    owner: forbidden\n"),
+	)
+	var customErr *keymerge.CustomMergeError
+	if !errors.Is(err, keymerge.ErrCustomMerge) || !errors.As(err, &customErr) {
+		t.Fatalf("expected CustomMergeError, got %v", err)
+	}
+	if !reflect.DeepEqual(customErr.Path, []string{"networks", "0"}) || customErr.DocIndex != 1 {
+		t.Errorf("unexpected error location %+v", customErr)
+	}
+}
+
+func TestMerger_CustomMergerRootList(t *testing.T) {
+	merger, err := keymerge.NewMerger[[]cidrSet](keymerge.Options{}, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := merger.Merge(
+		[]byte("- name: a\n  cidrs: [10.0.0.0/8]\n"),
+		[]byte("- name: a\n  cidrs: [10.0.0.0/8, 127.0.0.0/8]\n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sets []cidrSet
+	if err := yaml.Unmarshal(result, &sets); err != nil {
+		t.Fatal(err)
+	}
+	expected := []cidrSet{{Name: "a", CIDRs: []string{"10.0.0.0/8", "127.0.0.0/8"}}}
+	if !reflect.DeepEqual(sets, expected) {
+		t.Errorf("expected %+v, got %+v", expected, sets)
+	}
+
+	// Without marshal functions, items are converted by reflection
+	merger, err = keymerge.NewMerger[[]cidrSet](keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err := merger.MergeUnstructured(
+		[]any{map[string]any{"name": "a", "cidrs": []any{"10.0.0.0/8"}}},
+		[]any{map[string]any{"name": "a", "cidrs": []any{"127.0.0.0/8"}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []any{map[string]any{"name": "a", "cidrs": []any{"10.0.0.0/8", "127.0.0.0/8"}}}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("expected %v, got %v", want, merged)
+	}
+	_, err = merger.MergeUnstructured(
+		[]any{map[string]any{"name": "a", "cidrs": "10.0.0.0/8"}},
+		[]any{map[string]any{"name": "a"}},
+	)
+	if !errors.Is(err, keymerge.ErrCustomMerge) {
+		t.Errorf("expected ErrCustomMerge, got %v", err)
+	}
+}
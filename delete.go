@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrDeleteVetoed indicates [Options.OnDelete] blocked a deletion.
+var ErrDeleteVetoed = errors.New("deletion vetoed")
+
+// DeleteError is returned when [Options.OnDelete] returns an error for a
+// value an overlay deletes.
+type DeleteError struct {
+	// Path is where in the merged document the deleted value was.
+	Path []string
+	// DocIndex tells which document deleted the value.
+	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
+	// Err is the error OnDelete returned.
+	Err error
+}
+
+func (e *DeleteError) Error() string {
+	path := strings.Join(e.Path, ".")
+	if path == "" {
+		path = "(root)"
+	}
+	return fmt.Sprintf("deletion of path %s in document %d%s vetoed: %v",
+		path, e.DocIndex, nameSuffix(e.DocName), e.Err)
+}
+
+func (e *DeleteError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DeleteError) Is(target error) bool {
+	return target == ErrDeleteVetoed
+}
+
+// checkDelete calls [Options.OnDelete], if set, for the value at the current
+// path, which the document being merged deletes.
+func (m *UntypedMerger) checkDelete(deleted any) error {
+	if m.opts.OnDelete == nil {
+		return nil
+	}
+	return m.callOnDelete(m.pathNames(), deleted, m.index)
+}
+
+// callOnDelete calls [Options.OnDelete] and wraps its error.
+func (m *UntypedMerger) callOnDelete(path []string, deleted any, docIndex int) error {
+	if err := m.opts.OnDelete(path, deleted, docIndex); err != nil {
+		return &DeleteError{Path: path, DocIndex: docIndex, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+type deletion struct {
+	path    string
+	deleted any
+	doc     int
+}
+
+func TestOnDelete(t *testing.T) {
+	var deletions []deletion
+	opts := keymerge.Options{
+		PrimaryKeyNames: []string{"name"},
+		DeleteMarkerKey: "_delete",
+		NullMode:        keymerge.NullDelete,
+		OnDelete: func(path []string, deleted any, docIndex int) error {
+			deletions = append(deletions, deletion{strings.Join(path, "."), deleted, docIndex})
+			return nil
+		},
+	}
+	base := map[string]any{
+		"debug": true,
+		"services": []any{
+			map[string]any{"name": "web", "port": 80},
+			map[string]any{"name": "db", "port": 5432},
+		},
+	}
+	overlay := map[string]any{
+		"debug":   nil,
+		"missing": nil,
+		"services": []any{
+			map[string]any{"name": "db", "_delete": true},
+			map[string]any{"name": "cache", "_delete": true},
+		},
+	}
+
+	result, err := keymerge.MergeUnstructured(opts, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"services": []any{map[string]any{"name": "web", "port": 80}}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+	// Deleting absent values calls nothing. Map entries are merged in any order.
+	slices.SortFunc(deletions, func(a, b deletion) int { return strings.Compare(a.path, b.path) })
+	wantDeletions := []deletion{
+		{"debug", true, 1},
+		{"services.1", map[string]any{"name": "db", "port": 5432}, 1},
+	}
+	if !reflect.DeepEqual(deletions, wantDeletions) {
+		t.Errorf("got deletions %v, want %v", deletions, wantDeletions)
+	}
+}
+
+func TestOnDelete_Veto(t *testing.T) {
+	errReview := errors.New("needs review")
+	opts := keymerge.Options{
+		PrimaryKeyNames: []string{"name"},
+		DeleteMarkerKey: "_delete",
+		OnDelete: func(path []string, _ any, _ int) error {
+			if path[0] == "services" {
+				return errReview
+			}
+			return nil
+		},
+	}
+	base := map[string]any{"services": []any{map[string]any{"name": "db"}}}
+	overlay := map[string]any{"services": []any{map[string]any{"name": "db", "_delete": true}}}
+
+	_, err := keymerge.MergeUnstructured(opts, base, overlay)
+	var deleteErr *keymerge.DeleteError
+	if !errors.As(err, &deleteErr) {
+		t.Fatalf("expected DeleteError, got %v", err)
+	}
+	if !errors.Is(err, keymerge.ErrDeleteVetoed) || !errors.Is(err, errReview) {
+		t.Errorf("expected ErrDeleteVetoed wrapping the hook's error, got %v", err)
+	}
+	if !reflect.DeepEqual(deleteErr.Path, []string{"services", "0"}) || deleteErr.DocIndex != 1 {
+		t.Errorf("got path %v in document %d", deleteErr.Path, deleteErr.DocIndex)
+	}
+	if want := "deletion of path services.0 in document 1 vetoed: needs review"; err.Error() != want {
+		t.Errorf("got message %q, want %q", err.Error(), want)
+	}
+
+	// Diff's verification merge is not a deletion
+	desired := map[string]any{"services": []any{}}
+	if _, err := keymerge.Diff(opts, base, desired); errors.Is(err, keymerge.ErrDeleteVetoed) {
+		t.Errorf("Diff called OnDelete: %v", err)
+	}
+}
+
+func TestOnDelete_Streams(t *testing.T) {
+	var deletions []deletion
+	opts := keymerge.Options{
+		DeleteMarkerKey: "_delete",
+		OnDelete: func(path []string, deleted any, docIndex int) error {
+			deletions = append(deletions, deletion{strings.Join(path, "."), deleted, docIndex})
+			return nil
+		},
+	}
+	result, err := keymerge.MergeStreams(opts, []string{"name"},
+		[]any{map[string]any{"name": "a", "port": 1}, map[string]any{"name": "b"}},
+		[]any{map[string]any{"name": "a", "port": 2}},
+		[]any{map[string]any{"name": "a", "_delete": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []any{map[string]any{"name": "b"}}; !reflect.DeepEqual(result, want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+	want := []deletion{{"", map[string]any{"name": "a", "port": 2}, 2}}
+	if !reflect.DeepEqual(deletions, want) {
+		t.Errorf("got deletions %v, want %v", deletions, want)
+	}
+}
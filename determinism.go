@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrNondeterministic indicates that merging the same documents twice gave
+// different results. It is only reported when determinism checking is enabled
+// with the KEYMERGE_CHECK_DETERMINISM environment variable.
+var ErrNondeterministic = errors.New("nondeterministic merge")
+
+// determinismEnv names the environment variable that enables determinism
+// checking for mergers created while it is set to a non-empty value. Every
+// merge then runs twice and fails with ErrNondeterministic if the results or
+// errors differ. Go randomizes the order of every range over a map, so the runs
+// visit maps in different orders. It is meant for tests and audits, since it
+// doubles the cost of merging.
+const determinismEnv = "KEYMERGE_CHECK_DETERMINISM"
+
+// checksDeterminism reports whether mergers created now check determinism.
+func checksDeterminism() bool {
+	return os.Getenv(determinismEnv) != ""
+}
+
+// mergeTwice merges docs twice and returns the result if both runs agree. Only
+// the second run reports progress, and [Options.OnDelete] is asked about each
+// deletion once, with the second run reusing the first run's answers.
+func (m *UntypedMerger) mergeTwice(docs []any) (any, error) {
+	if onDelete := m.opts.OnDelete; onDelete != nil {
+		defer func() { m.opts.OnDelete = onDelete }()
+		answers := make(map[string]error)
+		m.opts.OnDelete = func(path []string, deleted any, docIndex int) error {
+			id := deletionID(path, docIndex)
+			if err, ok := answers[id]; ok {
+				return err
+			}
+			err := onDelete(path, deleted, docIndex)
+			answers[id] = err
+			return err
+		}
+	}
+	progress := m.progress
+	m.progress = nil
+	first, firstErr := m.mergeUnstructured(docs...)
+	m.progress = progress
+	second, secondErr := m.mergeUnstructured(docs...)
+
+	switch {
+	case (firstErr == nil) != (secondErr == nil):
+		return nil, fmt.Errorf("%w: only one run failed: %w", ErrNondeterministic, errors.Join(firstErr, secondErr))
+	case firstErr != nil && firstErr.Error() != secondErr.Error():
+		return nil, fmt.Errorf("%w: runs failed with %q and %q", ErrNondeterministic, firstErr, secondErr)
+	case firstErr != nil:
+		return nil, secondErr
+	case !reflect.DeepEqual(first, second):
+		return nil, fmt.Errorf("%w: runs gave %v and %v", ErrNondeterministic, first, second)
+	}
+	return second, nil
+}
+
+// deletionID identifies a deletion by the deleting document and the path.
+func deletionID(path []string, docIndex int) string {
+	return strconv.Itoa(docIndex) + "\x00" + strings.Join(path, "\x00")
+}
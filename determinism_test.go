@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// TestMain runs every merge of the package's tests twice, failing any whose
+// result depends on map iteration order.
+func TestMain(m *testing.M) {
+	if os.Getenv("KEYMERGE_CHECK_DETERMINISM") == "" {
+		os.Setenv("KEYMERGE_CHECK_DETERMINISM", "1")
+	}
+	os.Exit(m.Run())
+}
+
+func TestCheckDeterminism(t *testing.T) {
+	calls := 0
+	opts := keymerge.Options{ScalarStrategies: map[string]keymerge.ScalarStrategy{
+		"count": func(base, overlay any) (any, error) {
+			calls++
+			return calls, nil
+		},
+	}}
+	_, err := keymerge.MergeUnstructured(opts, map[string]any{"count": 1}, map[string]any{"count": 2})
+	if !errors.Is(err, keymerge.ErrNondeterministic) {
+		t.Errorf("expected ErrNondeterministic, got %v", err)
+	}
+
+	t.Setenv("KEYMERGE_CHECK_DETERMINISM", "")
+	if _, err := keymerge.MergeUnstructured(opts, map[string]any{"count": 1}, map[string]any{"count": 2}); err != nil {
+		t.Errorf("expected no check, got %v", err)
+	}
+}
+
+func TestDeterminism_FirstErrorByKey(t *testing.T) {
+	opts := keymerge.Options{ConflictMode: keymerge.ConflictStrict}
+	for range 20 {
+		_, err := keymerge.MergeUnstructured(opts,
+			map[string]any{"c": 1, "a": map[string]any{"y": 1, "x": 1}, "b": 1},
+			map[string]any{"c": 2, "a": map[string]any{"y": 2, "x": 2}, "b": 2},
+		)
+		var conflictErr *keymerge.ConflictError
+		if !errors.As(err, &conflictErr) {
+			t.Fatalf("expected ConflictError, got %v", err)
+		}
+		if !reflect.DeepEqual(conflictErr.Path, []string{"a", "x"}) {
+			t.Fatalf("expected the conflict at a.x, got %v", conflictErr.Path)
+		}
+	}
+}
+
+func TestDeterminism_MovesFromSeveralLists(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}, MoveMarkerKey: "_move_to"}
+	for range 20 {
+		result, err := keymerge.MergeUnstructured(opts,
+			map[string]any{
+				"b":    []any{map[string]any{"name": "y"}},
+				"a":    []any{map[string]any{"name": "x"}, map[string]any{"name": "w"}},
+				"done": []any{},
+			},
+			map[string]any{
+				"b": []any{map[string]any{"name": "y", "_move_to": "done"}},
+				"a": []any{map[string]any{"name": "x", "_move_to": "done"}, map[string]any{"name": "w", "_move_to": "done"}},
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []any{map[string]any{"name": "x"}, map[string]any{"name": "w"}, map[string]any{"name": "y"}}
+		if done := result.(map[string]any)["done"]; !reflect.DeepEqual(done, expected) {
+			t.Fatalf("got %v, want %v", done, expected)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInexpressible indicates a difference between documents that no overlay can express.
+var ErrInexpressible = errors.New("difference cannot be expressed as an overlay")
+
+// DiffError is returned when no overlay merges onto a base to produce the
+// desired document, e.g. because the desired document removes a value and
+// [Options.DeleteMarkerKey] is empty.
+type DiffError struct {
+	// Path is a path expression (see [Lookup]) addressing the value concerned.
+	Path string
+	// Reason describes why the difference cannot be expressed.
+	Reason string
+}
+
+func (e *DiffError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "(root)"
+	}
+	return fmt.Sprintf("difference cannot be expressed as an overlay at %s: %s", path, e.Reason)
+}
+
+func (e *DiffError) Is(target error) bool {
+	return target == ErrInexpressible
+}
+
+// Diff computes the smallest overlay that turns base into desired.
+// See [UntypedMerger.Diff] for details.
+func Diff(opts Options, base, desired any) (any, error) {
+	m, err := NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return m.Diff(base, desired)
+}
+
+// Diff computes the smallest overlay that, merged onto base with this merger's
+// options and metadata, yields desired. It is the inverse of merging: the
+// overlay contains only the values that differ, delete markers for removed map
+// keys and keyed list items, and the items appended to lists without keys.
+// Matched list items only contain their primary key fields and what changed.
+// If the documents are equal, the overlay is an empty map (or nil if base is
+// not a map).
+//
+// Some differences cannot be expressed by any overlay: removing values without
+// a [Options.DeleteMarkerKey], setting values to nil, reordering or removing
+// items of lists without keys, and reordering keyed items. Diff returns a
+// [*DiffError] for these. Every overlay is checked by merging it onto base.
+//
+// Returns an error wrapping [ErrInvalidOptions] if [Options.Prune] is set,
+// since an overlay merged with it must then repeat everything desired keeps:
+// desired itself is the overlay.
+//
+// Example:
+//
+//	overlay, err := keymerge.Diff(opts, base, desired)
+//	if err != nil {
+//		return err
+//	}
+//	out, err := yaml.Marshal(overlay) // keep this file instead of a full copy
+func (m *UntypedMerger) Diff(base, desired any) (any, error) {
+	if m.opts.Prune {
+		return nil, fmt.Errorf("%w: Diff cannot be used with Prune", ErrInvalidOptions)
+	}
+	var err error
+	m.reset(0)
+	if base, err = m.normalizeKeys(base); err != nil {
+		return nil, err
+	}
+	m.reset(1)
+	if desired, err = m.normalizeKeys(desired); err != nil {
+		return nil, err
+	}
+
+	overlay, changed, err := m.diffValues("", base, desired)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		overlay = emptyLike(base)
+		if _, isMap := overlay.(map[string]any); !isMap {
+			overlay = nil
+		}
+	}
+	if err := m.verifyDiff(base, overlay, desired); err != nil {
+		return nil, err
+	}
+	return overlay, nil
+}
+
+// verifyDiff merges overlay onto base and returns a [*DiffError] at the first
+// difference if the result is not desired.
+func (m *UntypedMerger) verifyDiff(base, overlay, desired any) error {
+	verifier := m.clone()
+	verifier.opts.OnDelete = nil // verifying deletes nothing
+	verifier.protected = nil     // nor checks protected paths
+	verifier.reset(1)
+	merged, err := verifier.mergeValues(base, overlay)
+	if err != nil {
+		return err
+	}
+	merged = verifier.stripDeleteMarker(merged)
+	if equalValues(merged, desired) {
+		return nil
+	}
+	return &DiffError{Path: firstDifference("", merged, desired), Reason: "merging cannot produce the desired value"}
+}
+
+// firstDifference returns the path of the first map value that differs between
+// two unequal documents. Lists are not descended into, since their items may
+// differ only in order.
+func firstDifference(path string, a, b any) string {
+	aMap, aIsMap := a.(map[string]any)
+	bMap, bIsMap := b.(map[string]any)
+	if !aIsMap || !bIsMap {
+		return path
+	}
+	union := make(map[string]any, len(aMap)+len(bMap))
+	for _, mp := range []map[string]any{aMap, bMap} {
+		for k := range mp {
+			union[k] = nil
+		}
+	}
+	for _, k := range sortedKeys(union) {
+		av, inA := aMap[k]
+		bv, inB := bMap[k]
+		if inA != inB || !equalValues(av, bv) {
+			return firstDifference(appendFieldPath(path, k), av, bv)
+		}
+	}
+	return path
+}
+
+// diffValues returns the overlay that turns base into desired at path, and
+// whether there is any difference.
+func (m *UntypedMerger) diffValues(path string, base, desired any) (any, bool, error) {
+	if equalValues(base, desired) {
+		return nil, false, nil
+	}
+	if desired == nil {
+		// A nil overlay value keeps the base value
+		return nil, false, &DiffError{Path: path, Reason: "values cannot be set to null"}
+	}
+
+	if m.replacesValue() {
+		return desired, true, nil
+	}
+	baseMap, baseIsMap := base.(map[string]any)
+	desiredMap, desiredIsMap := desired.(map[string]any)
+	if baseIsMap && desiredIsMap && m.replacesMap() {
+		return desired, true, nil
+	}
+	if baseIsMap && desiredIsMap {
+		overlay, err := m.diffMaps(path, baseMap, desiredMap)
+		return overlay, true, err
+	}
+
+	baseList, baseIsList := asList(base)
+	desiredList, desiredIsList := asList(desired)
+	if baseIsList && desiredIsList {
+		overlay, err := m.diffLists(path, baseList, desiredList)
+		return overlay, true, err
+	}
+
+	if m.isMarkedForDeletion(desired) {
+		return nil, false, &DiffError{Path: path, Reason: "value would be read as a delete marker"}
+	}
+	return desired, true, nil
+}
+
+func (m *UntypedMerger) diffMaps(path string, base, desired map[string]any) (map[string]any, error) {
+	overlay := make(map[string]any)
+	for _, k := range sortedKeys(desired) {
+		m.push(k)
+		childPath := appendFieldPath(path, k)
+		if baseVal, exists := base[k]; exists {
+			sub, changed, err := m.diffValues(childPath, baseVal, desired[k])
+			if err != nil {
+				return nil, err
+			}
+			if changed {
+				overlay[k] = sub
+			}
+		} else {
+			if m.isMarkedForDeletion(desired[k]) {
+				return nil, &DiffError{Path: childPath, Reason: "value would be read as a delete marker"}
+			}
+			overlay[k] = desired[k]
+		}
+		m.pop()
+	}
+
+	for _, k := range sortedKeys(base) {
+		if _, exists := desired[k]; exists {
+			continue
+		}
+		m.push(k)
+		marker, err := m.deleteMarker(appendFieldPath(path, k))
+		m.pop()
+		if err != nil {
+			return nil, err
+		}
+		overlay[k] = marker
+	}
+	return overlay, nil
+}
+
+// deleteMarker returns a map that deletes the value it is merged onto, or a
+// [*DiffError] if deletion is disabled.
+func (m *UntypedMerger) deleteMarker(path string) (map[string]any, error) {
+	key := m.deleteMarkerKey()
+	if key == "" {
+		return nil, &DiffError{Path: path, Reason: "removing values requires a delete marker key"}
+	}
+	return map[string]any{key: true}, nil
+}
+
+func (m *UntypedMerger) diffLists(path string, base, desired []any) ([]any, error) {
+	if len(desired) == 0 && m.emptyListReplaces() {
+		// An empty overlay list clears the base list
+		return desired, nil
+	}
+	if meta := m.getCurrentMetadata(); (meta == nil || !meta.opaque) && m.hasKeyedItems(base, desired) {
+		return m.diffKeyedLists(path, base, desired)
+	}
+
+	scalarMode := m.scalarMode()
+	if scalarMode == ScalarReplace {
+		if len(desired) == 0 {
+			// An empty overlay list keeps the base list
+			return nil, &DiffError{Path: path, Reason: "lists cannot be emptied"}
+		}
+		return desired, nil
+	}
+
+	// Other modes append the overlay's items, so desired must extend base.
+	if len(desired) < len(base) || !equalValues(base, desired[:len(base)]) {
+		return nil, &DiffError{Path: path, Reason: "items of lists without primary keys can only be appended"}
+	}
+	return desired[len(base):], nil
+}
+
+// diffKeyedLists returns the overlay items that delete the keyed base items
+// desired lacks, followed by the changed and added items of desired in order.
+func (m *UntypedMerger) diffKeyedLists(path string, base, desired []any) ([]any, error) {
+	baseIndex := make(map[any]int, len(base))
+	var baseUnkeyed []any
+	for i, item := range base {
+		m.push(strconv.Itoa(i))
+		if key := m.getPrimaryKey(item); key != nil && isKeyComparable(key) {
+			baseIndex[toMapKey(key)] = i
+		} else {
+			baseUnkeyed = append(baseUnkeyed, item)
+		}
+		m.pop()
+	}
+
+	var overlay, updates []any
+	kept := make(map[int]bool, len(desired))
+	for j, item := range desired {
+		m.push(strconv.Itoa(j))
+		key := m.getPrimaryKey(item)
+		i, exists := -1, false
+		if key != nil && isKeyComparable(key) {
+			i, exists = baseIndex[toMapKey(key)]
+		}
+		if !exists {
+			// Merging keeps unkeyed base items, so only add new ones
+			if key == nil && len(baseUnkeyed) > 0 && equalValues(baseUnkeyed[0], item) {
+				baseUnkeyed = baseUnkeyed[1:]
+			} else {
+				updates = append(updates, item)
+			}
+			m.pop()
+			continue
+		}
+		kept[i] = true
+		sub, changed, err := m.diffValues(m.itemPath(path, item, j), base[i], item)
+		if err != nil {
+			return nil, err
+		}
+		if subMap, isMap := sub.(map[string]any); isMap {
+			sub = m.withKeyFields(subMap, item)
+		}
+		if changed {
+			updates = append(updates, sub)
+		}
+		m.pop()
+	}
+
+	for i, item := range base {
+		m.push(strconv.Itoa(i))
+		if key := m.getPrimaryKey(item); key != nil && !kept[i] {
+			marker, err := m.deleteMarker(m.itemPath(path, item, i))
+			if err != nil {
+				return nil, err
+			}
+			overlay = append(overlay, m.withKeyFields(marker, item))
+		}
+		m.pop()
+	}
+	return append(overlay, updates...), nil
+}
+
+// withKeyFields adds the fields that make up item's primary key to overlay,
+// so that the overlay item matches item.
+func (m *UntypedMerger) withKeyFields(overlay map[string]any, item any) map[string]any {
+	if m.keyedByFunc() {
+		return m.withFuncKeyFields(overlay, item)
+	}
+	// Only the first key field identifies the item, unless all of them do
+	fields, all := m.opts.PrimaryKeyNames, m.opts.KeyMatchMode == KeyMatchAny
+	if meta := m.getCurrentMetadata(); meta != nil && len(meta.primaryKeys) > 0 {
+		fields, all = meta.primaryKeys, true
+	} else if names := m.compositeKeyFields(item); names != nil {
+		fields, all = names, true
+	}
+	for _, name := range fields {
+		val, exists := keyFieldValue(item, name)
+		if !exists || val == nil {
+			continue
+		}
+		if _, direct := fieldValue(item, name); direct {
+			if _, set := overlay[name]; !set {
+				overlay[name] = val
+			}
+		} else {
+			setNestedKeyField(overlay, strings.Split(name, "."), val)
+		}
+		if !all {
+			break
+		}
+	}
+	return overlay
+}
+
+// withFuncKeyFields adds item's top-level scalar fields to overlay unless the
+// list's identity function or [Options.KeyFunc] already gives overlay the same
+// key as item, since which fields the key is computed from is unknown.
+func (m *UntypedMerger) withFuncKeyFields(overlay map[string]any, item any) map[string]any {
+	key := m.funcKey(item)
+	if key == nil || !isKeyComparable(key) {
+		return overlay
+	}
+	if overlayKey := m.funcKey(overlay); overlayKey != nil && isKeyComparable(overlayKey) &&
+		toMapKey(overlayKey) == toMapKey(key) {
+		return overlay
+	}
+	mp, _ := item.(map[string]any)
+	for name, val := range mp {
+		if _, list := asList(val); list || isMap(val) {
+			continue
+		}
+		if _, set := overlay[name]; !set {
+			overlay[name] = val
+		}
+	}
+	return overlay
+}
+
+// setNestedKeyField sets the value at path in overlay, creating the maps
+// along it, unless the overlay already sets it or replaces one of the maps.
+func setNestedKeyField(overlay map[string]any, path []string, val any) {
+	for _, name := range path[:len(path)-1] {
+		next, exists := overlay[name]
+		if !exists {
+			next = make(map[string]any)
+			overlay[name] = next
+		}
+		mp, ok := next.(map[string]any)
+		if !ok {
+			return
+		}
+		overlay = mp
+	}
+	if _, set := overlay[path[len(path)-1]]; !set {
+		overlay[path[len(path)-1]] = val
+	}
+}
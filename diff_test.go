@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestDiff(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}, DeleteMarkerKey: "_delete"}
+	base := map[string]any{
+		"database": map[string]any{"host": "localhost", "port": 5432, "pool": 10},
+		"services": []any{
+			map[string]any{"name": "api", "port": 8080, "replicas": 1},
+			map[string]any{"name": "worker", "port": 9000},
+			map[string]any{"name": "debug"},
+		},
+		"tags":   []any{"a", "b"},
+		"legacy": true,
+	}
+	desired := map[string]any{
+		"database": map[string]any{"host": "db.example.com", "port": float64(5432), "pool": 10},
+		"services": []any{
+			map[string]any{"name": "api", "port": 8080, "replicas": 3},
+			map[string]any{"name": "worker", "port": 9000},
+			map[string]any{"name": "cache", "port": 6379},
+		},
+		"tags":  []any{"a", "b", "c"},
+		"owner": "platform",
+	}
+
+	overlay, err := keymerge.Diff(opts, base, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]any{
+		"database": map[string]any{"host": "db.example.com"},
+		"services": []any{
+			map[string]any{"name": "debug", "_delete": true},
+			map[string]any{"name": "api", "replicas": 3},
+			map[string]any{"name": "cache", "port": 6379},
+		},
+		"tags":   []any{"c"},
+		"owner":  "platform",
+		"legacy": map[string]any{"_delete": true},
+	}
+	if !reflect.DeepEqual(overlay, expected) {
+		t.Fatalf("unexpected overlay:\n got: %v\nwant: %v", overlay, expected)
+	}
+
+	merged, err := keymerge.MergeUnstructured(opts, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := keymerge.Compare(opts, merged, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("merging the overlay did not produce desired: %v", changes)
+	}
+}
+
+func TestDiff_Equal(t *testing.T) {
+	doc := map[string]any{"a": 1, "items": []any{map[string]any{"id": 1}}}
+	overlay, err := keymerge.Diff(keymerge.Options{PrimaryKeyNames: []string{"id"}}, doc, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(overlay, map[string]any{}) {
+		t.Errorf("expected empty overlay, got %v", overlay)
+	}
+}
+
+func TestDiff_Metadata(t *testing.T) {
+	type Config struct {
+		Hosts []string `json:"hosts" km:"mode=replace"`
+		Ports []int    `json:"ports"`
+	}
+	tree, err := keymerge.MetadataOf[Config]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger.SetMetadata(tree)
+
+	base := map[string]any{"hosts": []any{"a", "b"}, "ports": []any{80}}
+	desired := map[string]any{"hosts": []any{"b"}, "ports": []any{80, 443}}
+	overlay, err := merger.Diff(base, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"hosts": []any{"b"}, "ports": []any{443}}
+	if !reflect.DeepEqual(overlay, expected) {
+		t.Errorf("unexpected overlay:\n got: %v\nwant: %v", overlay, expected)
+	}
+}
+
+func TestDiff_ReplaceMaps(t *testing.T) {
+	opts := keymerge.Options{ReplaceMaps: []string{"selector"}}
+	base := map[string]any{"selector": map[string]any{"app": "web", "tier": "frontend"}, "labels": map[string]any{"a": 1}}
+	desired := map[string]any{"selector": map[string]any{"app": "web"}, "labels": map[string]any{"a": 1, "b": 2}}
+	overlay, err := keymerge.Diff(opts, base, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"selector": map[string]any{"app": "web"}, "labels": map[string]any{"b": 2}}
+	if !reflect.DeepEqual(overlay, expected) {
+		t.Errorf("unexpected overlay:\n got: %v\nwant: %v", overlay, expected)
+	}
+}
+
+func TestDiff_Prune(t *testing.T) {
+	opts := keymerge.Options{Prune: true}
+	_, err := keymerge.Diff(opts, map[string]any{"a": 1, "b": 2}, map[string]any{"a": 1, "b": 3})
+	if !errors.Is(err, keymerge.ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions, got %v", err)
+	}
+}
+
+func TestDiff_Inexpressible(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    keymerge.Options
+		base    any
+		desired any
+		path    string
+	}{
+		{
+			name:    "removal without delete marker",
+			base:    map[string]any{"a": 1, "b": 2},
+			desired: map[string]any{"a": 1},
+			path:    "b",
+		},
+		{
+			name:    "null value",
+			base:    map[string]any{"a": map[string]any{"b": 1}},
+			desired: map[string]any{"a": map[string]any{"b": nil}},
+			path:    "a.b",
+		},
+		{
+			name:    "removed scalar item",
+			base:    map[string]any{"tags": []any{"a", "b"}},
+			desired: map[string]any{"tags": []any{"b"}},
+			path:    "tags",
+		},
+		{
+			name: "reordered keyed items",
+			opts: keymerge.Options{PrimaryKeyNames: []string{"name"}},
+			base: map[string]any{"services": []any{
+				map[string]any{"name": "a"}, map[string]any{"name": "b"},
+			}},
+			desired: map[string]any{"services": []any{
+				map[string]any{"name": "b"}, map[string]any{"name": "a"},
+			}},
+			path: "services",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := keymerge.Diff(tt.opts, tt.base, tt.desired)
+			if !errors.Is(err, keymerge.ErrInexpressible) {
+				t.Fatalf("expected ErrInexpressible, got %v", err)
+			}
+			var diffErr *keymerge.DiffError
+			if !errors.As(err, &diffErr) || diffErr.Path != tt.path {
+				t.Errorf("expected error at %q, got %v", tt.path, err)
+			}
+		})
+	}
+}
+
+func TestDiff_ListMatchers(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := merger.SetListMatchers([]keymerge.ListMatchRule{{Path: "nodes", Matcher: sameHost}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Appending the second node would merge it into the first, which it matches
+	base := map[string]any{"nodes": []any{map[string]any{"host": "a.example.com", "cpu": 2}}}
+	desired := map[string]any{"nodes": []any{
+		map[string]any{"host": "a.example.com", "cpu": 2},
+		map[string]any{"host": "A.EXAMPLE.COM", "cpu": 4},
+	}}
+	if overlay, err := merger.Diff(base, desired); !errors.Is(err, keymerge.ErrInexpressible) {
+		t.Errorf("expected ErrInexpressible, got overlay %v and error %v", overlay, err)
+	}
+}
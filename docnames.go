@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import "fmt"
+
+// SetDocumentNames names the documents of subsequent merges by position, e.g.
+// by their file paths or roles such as "env overlay", so that errors, warnings,
+// duplicate groups, progress reports, and traces can refer to them by name.
+// Each of these keeps its DocIndex and has a DocName field holding the name,
+// which error messages show after the document's position:
+//
+//	duplicate primary key web at path services.1 in document 1 (prod.yaml) at positions [0 1]
+//
+// Documents without a name, or named "", are referred to by position only.
+// [UntypedMerger.MergeStreams] names the documents of each stream by the
+// stream's name. Passing no names removes them.
+func (m *UntypedMerger) SetDocumentNames(names ...string) {
+	if len(names) == 0 {
+		names = nil
+	}
+	m.names = names
+}
+
+// DocumentName returns the name of the document at index i set by
+// [UntypedMerger.SetDocumentNames], or "document i" if it has none.
+func (m *UntypedMerger) DocumentName(i int) string {
+	if name := m.docName(i); name != "" {
+		return name
+	}
+	return fmt.Sprintf("document %d", i)
+}
+
+// docName returns the name of the document at index i, or "" if it has none.
+func (m *UntypedMerger) docName(i int) string {
+	if i < 0 || i >= len(m.names) {
+		return ""
+	}
+	return m.names[i]
+}
+
+// nameSuffix formats a document name for error messages, after the document's
+// position.
+func nameSuffix(name string) string {
+	if name == "" {
+		return ""
+	}
+	return " (" + name + ")"
+}
+
+// nameDocuments sets the DocName fields of the errors in err's tree that refer
+// to documents by index.
+func (m *UntypedMerger) nameDocuments(err error) {
+	if len(m.names) == 0 || err == nil {
+		return
+	}
+	switch e := err.(type) {
+	case *DuplicatePrimaryKeyError:
+		e.DocName = m.docName(e.DocIndex)
+	case *NonComparablePrimaryKeyError:
+		e.DocName = m.docName(e.DocIndex)
+	case *ConflictError:
+		e.DocName = m.docName(e.DocIndex)
+	case *MarshalError:
+		e.DocName = m.docName(e.DocIndex)
+	case *AmbiguousKeyError:
+		e.DocName = m.docName(e.DocIndex)
+	case *CustomMergeError:
+		e.DocName = m.docName(e.DocIndex)
+	case *OverlayDuplicateError:
+		e.DocName = m.docName(e.DocIndex)
+		e.PreviousDocName = m.docName(e.PreviousDocIndex)
+	case *LimitError:
+		e.DocName = m.docName(e.DocIndex)
+	case *MoveError:
+		e.DocName = m.docName(e.DocIndex)
+	case *ScalarStrategyError:
+		e.DocName = m.docName(e.DocIndex)
+	case *UnknownFieldError:
+		e.DocName = m.docName(e.DocIndex)
+	case *DeleteError:
+		e.DocName = m.docName(e.DocIndex)
+	case *ProtectedPathError:
+		e.DocName = m.docName(e.DocIndex)
+	case *ImmutableFieldError:
+		e.DocName = m.docName(e.DocIndex)
+	case *AssertionError:
+		for i := range e.Failures {
+			e.Failures[i].DocName = m.docName(e.Failures[i].DocIndex)
+		}
+	case *GrantError:
+		for i := range e.Violations {
+			e.Violations[i].DocName = m.docName(e.Violations[i].DocIndex)
+		}
+	}
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		m.nameDocuments(u.Unwrap())
+	case interface{ Unwrap() []error }:
+		for _, err := range u.Unwrap() {
+			m.nameDocuments(err)
+		}
+	}
+}
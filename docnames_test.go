@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestSetDocumentNames(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}, ConflictMode: keymerge.ConflictStrict}
+	merger, err := keymerge.NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger.SetDocumentNames("base.yaml", "prod overlay")
+	base := map[string]any{"port": 80}
+	overlay := map[string]any{"port": 8080}
+
+	_, err = merger.MergeUnstructured(base, overlay)
+	var conflict *keymerge.ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected ConflictError, got %v", err)
+	}
+	if conflict.DocIndex != 1 || conflict.DocName != "prod overlay" {
+		t.Errorf("got document %d named %q", conflict.DocIndex, conflict.DocName)
+	}
+	if !strings.Contains(err.Error(), "in document 1 (prod overlay):") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+
+	_, err = merger.Trace(base, overlay)
+	if !errors.As(err, &conflict) || conflict.DocName != "prod overlay" {
+		t.Errorf("expected a named conflict from Trace, got %v", err)
+	}
+
+	dupes := map[string]any{"items": []any{
+		map[string]any{"name": "a"},
+		map[string]any{"name": "a"},
+	}}
+	_, err = merger.MergeUnstructured(map[string]any{"items": []any{}}, dupes)
+	var dupe *keymerge.DuplicatePrimaryKeyError
+	if !errors.As(err, &dupe) || dupe.DocName != "prod overlay" {
+		t.Errorf("expected a named duplicate key error, got %v", err)
+	}
+
+	if got := merger.DocumentName(0); got != "base.yaml" {
+		t.Errorf("DocumentName(0) = %q", got)
+	}
+	if got := merger.DocumentName(2); got != "document 2" {
+		t.Errorf("DocumentName(2) = %q", got)
+	}
+
+	merger.SetDocumentNames()
+	_, err = merger.MergeUnstructured(base, overlay)
+	if !errors.As(err, &conflict) || conflict.DocName != "" || strings.Contains(err.Error(), "(") {
+		t.Errorf("expected an unnamed conflict, got %v", err)
+	}
+}
+
+func TestSetDocumentNames_Reports(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger.SetDocumentNames("base", "overlay")
+	var progress []keymerge.Progress
+	merger.SetProgress(1, func(p keymerge.Progress) { progress = append(progress, p) })
+
+	trace, err := merger.Trace(map[string]any{"a": 1}, map[string]any{"a": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, step := range trace.Steps {
+		if want := []string{"base", "overlay"}[i]; step.DocName != want {
+			t.Errorf("step %d named %q, want %q", i, step.DocName, want)
+		}
+	}
+	if len(progress) == 0 {
+		t.Fatal("expected progress reports")
+	}
+	for _, p := range progress {
+		if want := merger.DocumentName(p.DocIndex); p.DocName != want {
+			t.Errorf("progress in document %d named %q, want %q", p.DocIndex, p.DocName, want)
+		}
+	}
+}
+
+func TestSetDocumentNames_Streams(t *testing.T) {
+	opts := keymerge.Options{ConflictMode: keymerge.ConflictStrict}
+	merger, err := keymerge.NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger.SetDocumentNames("base.yaml", "other.yaml", "prod.yaml")
+	_, err = merger.MergeStreams([]string{"name"},
+		[]any{map[string]any{"name": "a", "port": 1}},
+		[]any{map[string]any{"name": "b"}},
+		[]any{map[string]any{"name": "a", "port": 2}})
+	var conflict *keymerge.ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected ConflictError, got %v", err)
+	}
+	// The stream's name follows its documents into their group's merge
+	if conflict.DocName != "prod.yaml" {
+		t.Errorf("conflict named %q, want prod.yaml", conflict.DocName)
+	}
+}
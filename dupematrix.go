@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DupeMatrix sets how duplicate primary keys are handled depending on where
+// they occur, e.g. to tolerate the duplicates of a messy legacy base file while
+// failing when two overlays change the same item:
+//
+//	opts := keymerge.Options{
+//		PrimaryKeyNames: []string{"name"},
+//		DupeMatrix: &keymerge.DupeMatrix{
+//			Base:    keymerge.DupeConsolidate,
+//			Overlay: keymerge.DupeUnique,
+//			Across:  keymerge.DupeUnique,
+//		},
+//	}
+//
+// Like DupeMode, each setting defaults to [DupeUnique]. km:"dupe=..." tags
+// override Base and Overlay for their fields.
+type DupeMatrix struct {
+	// Base handles duplicate keys within a list of the first document.
+	Base DupeMode
+	// Overlay handles duplicate keys within a list of each later document.
+	Overlay DupeMode
+	// Across handles items with the same key in more than one overlay:
+	// [DupeConsolidate] merges them in order, as merges always do, while
+	// [DupeUnique] fails with an [*OverlayDuplicateError], so that each item
+	// is set or deleted by one overlay at most. Overlays can always change
+	// items of the first document.
+	Across DupeMode
+}
+
+// OverlayDuplicateError is returned when two overlays set or delete list items
+// with the same primary key and [DupeMatrix.Across] is [DupeUnique].
+type OverlayDuplicateError struct {
+	// Key is the primary key value both overlays used.
+	Key any
+	// Path is where in the later overlay the item occurred.
+	Path []string
+	// DocIndex tells which document set the item again.
+	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
+	// PreviousDocIndex tells which earlier overlay set the item first.
+	PreviousDocIndex int
+	// PreviousDocName is the earlier overlay's name, if set.
+	PreviousDocName string
+}
+
+func (e *OverlayDuplicateError) Error() string {
+	path := strings.Join(e.Path, ".")
+	if path == "" {
+		path = "(root)"
+	}
+	return fmt.Sprintf("primary key %v at path %s in document %d%s was already set by document %d%s",
+		e.Key, path, e.DocIndex, nameSuffix(e.DocName), e.PreviousDocIndex, nameSuffix(e.PreviousDocName))
+}
+
+func (e *OverlayDuplicateError) Is(target error) bool {
+	return target == ErrDuplicatePrimaryKey
+}
+
+// listDupeMode returns the [DupeMode] for duplicate keys within the list at the
+// current path, in the first document if first is set or in a later one.
+func (m *UntypedMerger) listDupeMode(first bool) DupeMode {
+	if meta := m.getCurrentMetadata(); meta != nil && meta.dupeMode != nil {
+		return *meta.dupeMode
+	}
+	switch {
+	case m.opts.DupeMatrix == nil:
+		return m.opts.DupeMode
+	case first:
+		return m.opts.DupeMatrix.Base
+	default:
+		return m.opts.DupeMatrix.Overlay
+	}
+}
+
+// itemClaim identifies a keyed list item across documents: the list, by field
+// names and the keys of enclosing items, and the item's key.
+type itemClaim struct {
+	list string
+	key  any
+}
+
+// claimItems records the keyed list items in value, the value at the current
+// path of an overlay, returning an [*OverlayDuplicateError] for the first one
+// an earlier overlay set. list identifies the current path like itemClaim.
+func (m *UntypedMerger) claimItems(value any, list string) error {
+	if mp, ok := value.(map[string]any); ok {
+		for _, key := range sortedKeys(mp) {
+			m.push(key)
+			err := m.claimItems(mp[key], appendFieldPath(list, key))
+			m.pop()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	items, ok := asList(value)
+	if !ok {
+		return nil
+	}
+	if meta := m.getCurrentMetadata(); m.listMatcher() != nil || (meta != nil && meta.opaque) {
+		return nil
+	}
+	for i, item := range items {
+		m.push(strconv.Itoa(i))
+		key := m.getPrimaryKey(item)
+		if key == nil || !isKeyComparable(key) {
+			// Unkeyed items can't be told apart across documents
+			m.pop()
+			continue
+		}
+		claim := itemClaim{list: list, key: toMapKey(key)}
+		if previous, claimed := m.claims[claim]; claimed && previous != m.index {
+			err := &OverlayDuplicateError{Key: keyString(key), Path: m.pathNames(), DocIndex: m.index, PreviousDocIndex: previous}
+			m.pop()
+			return err
+		}
+		m.claims[claim] = m.index
+		err := m.claimItems(item, fmt.Sprintf("%s[%v]", list, keyString(key)))
+		m.pop()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestDupeMatrix(t *testing.T) {
+	legacy := map[string]any{
+		"services": []any{
+			map[string]any{"name": "web", "port": 80},
+			map[string]any{"name": "web", "replicas": 2},
+			map[string]any{"name": "db", "port": 5432},
+		},
+	}
+	matrix := &keymerge.DupeMatrix{
+		Base:    keymerge.DupeConsolidate,
+		Overlay: keymerge.DupeUnique,
+		Across:  keymerge.DupeUnique,
+	}
+	newMerger := func(t *testing.T, matrix *keymerge.DupeMatrix) *keymerge.UntypedMerger {
+		t.Helper()
+		merger, err := keymerge.NewUntypedMerger(keymerge.Options{
+			PrimaryKeyNames: []string{"name"},
+			DupeMatrix:      matrix,
+		}, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return merger
+	}
+
+	t.Run("base duplicates consolidate", func(t *testing.T) {
+		overlay := map[string]any{
+			"services": []any{map[string]any{"name": "web", "port": 8080}},
+		}
+		result, err := newMerger(t, matrix).MergeUnstructured(legacy, overlay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]any{
+			"services": []any{
+				map[string]any{"name": "web", "port": 8080, "replicas": 2},
+				map[string]any{"name": "db", "port": 5432},
+			},
+		}
+		if !reflect.DeepEqual(result, want) {
+			t.Errorf("got %v, want %v", result, want)
+		}
+	})
+
+	t.Run("overlay duplicates fail", func(t *testing.T) {
+		overlay := map[string]any{
+			"services": []any{
+				map[string]any{"name": "db", "port": 5433},
+				map[string]any{"name": "db", "port": 5434},
+			},
+		}
+		_, err := newMerger(t, matrix).MergeUnstructured(legacy, overlay)
+		var dupErr *keymerge.DuplicatePrimaryKeyError
+		if !errors.As(err, &dupErr) {
+			t.Fatalf("expected DuplicatePrimaryKeyError, got %v", err)
+		}
+		if dupErr.DocIndex != 1 {
+			t.Errorf("DocIndex = %d, want 1", dupErr.DocIndex)
+		}
+	})
+
+	t.Run("overlays fighting over an item fail", func(t *testing.T) {
+		first := map[string]any{
+			"services": []any{map[string]any{"name": "db", "port": 5433}},
+		}
+		second := map[string]any{
+			"services": []any{
+				map[string]any{"name": "cache"},
+				map[string]any{"name": "db", "port": 5434},
+			},
+		}
+		_, err := newMerger(t, matrix).MergeUnstructured(legacy, first, second)
+		if !errors.Is(err, keymerge.ErrDuplicatePrimaryKey) {
+			t.Fatalf("expected ErrDuplicatePrimaryKey, got %v", err)
+		}
+		var overlayErr *keymerge.OverlayDuplicateError
+		if !errors.As(err, &overlayErr) {
+			t.Fatalf("expected OverlayDuplicateError, got %v", err)
+		}
+		want := &keymerge.OverlayDuplicateError{
+			Key:              "db",
+			Path:             []string{"services", "1"},
+			DocIndex:         2,
+			PreviousDocIndex: 1,
+		}
+		if !reflect.DeepEqual(overlayErr, want) {
+			t.Errorf("got %+v, want %+v", overlayErr, want)
+		}
+		if _, traceErr := newMerger(t, matrix).Trace(legacy, first, second); traceErr == nil || traceErr.Error() != err.Error() {
+			t.Errorf("expected Trace to fail with %v, got %v", err, traceErr)
+		}
+	})
+
+	t.Run("nested lists are told apart by their parent items", func(t *testing.T) {
+		first := map[string]any{
+			"services": []any{map[string]any{
+				"name": "web", "env": []any{map[string]any{"name": "LOG", "value": "debug"}},
+			}},
+		}
+		second := map[string]any{
+			"services": []any{map[string]any{
+				"name": "db", "env": []any{map[string]any{"name": "LOG", "value": "info"}},
+			}},
+		}
+		if _, err := newMerger(t, matrix).MergeUnstructured(legacy, first, second); err != nil {
+			t.Fatal(err)
+		}
+
+		third := map[string]any{
+			"services": []any{map[string]any{
+				"name": "web", "env": []any{map[string]any{"name": "LOG", "value": "warn"}},
+			}},
+		}
+		_, err := newMerger(t, matrix).MergeUnstructured(legacy, first, third)
+		if !errors.Is(err, keymerge.ErrDuplicatePrimaryKey) {
+			t.Fatalf("expected ErrDuplicatePrimaryKey, got %v", err)
+		}
+	})
+
+	t.Run("across consolidate merges overlays in order", func(t *testing.T) {
+		first := map[string]any{
+			"services": []any{map[string]any{"name": "db", "port": 5433}},
+		}
+		second := map[string]any{
+			"services": []any{map[string]any{"name": "db", "port": 5434}},
+		}
+		result, err := newMerger(t, &keymerge.DupeMatrix{
+			Base:   keymerge.DupeConsolidate,
+			Across: keymerge.DupeConsolidate,
+		}).
+			MergeUnstructured(legacy, first, second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		services := result.(map[string]any)["services"].([]any)
+		if got := services[1].(map[string]any)["port"]; got != 5434 {
+			t.Errorf("db port = %v, want 5434", got)
+		}
+	})
+
+	t.Run("dupe rules override the matrix", func(t *testing.T) {
+		rules := keymerge.NewRuleSet()
+		rules.List("services").Keys("name").Dupe(keymerge.DupeUnique)
+		tree, err := rules.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		merger := newMerger(t, matrix)
+		merger.SetMetadata(tree)
+		_, err = merger.MergeUnstructured(legacy, map[string]any{
+			"services": []any{map[string]any{"name": "db"}},
+		})
+		if !errors.Is(err, keymerge.ErrDuplicatePrimaryKey) {
+			t.Fatalf("expected ErrDuplicatePrimaryKey, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"strconv"
+)
+
+// DuplicateGroup is a set of items of one list in one document that share a
+// primary key, as reported by [UntypedMerger.Duplicates].
+type DuplicateGroup struct {
+	// Path is the path of the list.
+	Path []string
+	// Key is the shared primary key value, formatted as in
+	// [DuplicatePrimaryKeyError].
+	Key any
+	// Positions are the indices of every item with the key, in order.
+	Positions []int
+	// DocIndex tells which document the list is in.
+	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
+	// unique is whether the list's [DupeMode] is [DupeUnique].
+	unique bool
+}
+
+// Duplicates returns every group of items sharing a primary key found by the
+// last merge with [Options.CollectDuplicates] set, ordered by document, then
+// by path and first position. It returns nil if there were none.
+//
+// Example:
+//
+//	merger, _ := keymerge.NewUntypedMerger(keymerge.Options{
+//		PrimaryKeyNames:   []string{"name"},
+//		CollectDuplicates: true,
+//	}, yaml.Unmarshal, yaml.Marshal)
+//	_, err := merger.Merge(legacy...)
+//	for _, group := range merger.Duplicates() {
+//		fmt.Printf("doc %d %s: %v at %v\n", group.DocIndex,
+//			strings.Join(group.Path, "."), group.Key, group.Positions)
+//	}
+func (m *UntypedMerger) Duplicates() []DuplicateGroup {
+	return m.duplicates
+}
+
+// collectDuplicates records the duplicate groups of every list in value, the
+// value at the current path.
+func (m *UntypedMerger) collectDuplicates(value any) {
+	if mp, ok := value.(map[string]any); ok {
+		for _, key := range sortedKeys(mp) {
+			m.push(key)
+			m.collectDuplicates(mp[key])
+			m.pop()
+		}
+		return
+	}
+	list, ok := asList(value)
+	if !ok {
+		return
+	}
+	meta := m.getCurrentMetadata()
+	keyed := m.listMatcher() == nil && (meta == nil || !meta.opaque)
+	objectMode := m.listDupeMode(m.index == 0)
+
+	positions := make(map[any][]int)
+	keys := make(map[any]any)
+	var order []any
+	for i, item := range list {
+		m.push(strconv.Itoa(i))
+		if keyed && !m.isMarkedForDeletion(item) {
+			if key := m.getPrimaryKey(item); key != nil && isKeyComparable(key) {
+				mapKey := toMapKey(key)
+				if _, seen := positions[mapKey]; !seen {
+					order = append(order, mapKey)
+					keys[mapKey] = keyString(key)
+				}
+				positions[mapKey] = append(positions[mapKey], i)
+			}
+		}
+		m.collectDuplicates(item)
+		m.pop()
+	}
+	for _, mapKey := range order {
+		if len(positions[mapKey]) < 2 {
+			continue
+		}
+		m.duplicates = append(m.duplicates, DuplicateGroup{
+			Path:      m.pathNames(),
+			Key:       keys[mapKey],
+			Positions: positions[mapKey],
+			DocIndex:  m.index,
+			DocName:   m.docName(m.index),
+			unique:    objectMode == DupeUnique,
+		})
+	}
+}
+
+// duplicateError returns a [*DuplicatePrimaryKeyError] for the first duplicate
+// group collected in a list whose items must be unique, or nil if there is none.
+func (m *UntypedMerger) duplicateError() error {
+	for _, group := range m.duplicates {
+		if !group.unique {
+			continue
+		}
+		return &DuplicatePrimaryKeyError{
+			Key:       group.Key,
+			Positions: group.Positions,
+			Path:      append(group.Path[:len(group.Path):len(group.Path)], strconv.Itoa(group.Positions[1])),
+			DocIndex:  group.DocIndex,
+			DocName:   group.DocName,
+		}
+	}
+	return nil
+}
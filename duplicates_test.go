@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestCollectDuplicates(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{
+		PrimaryKeyNames:   []string{"name"},
+		DeleteMarkerKey:   "_delete",
+		CollectDuplicates: true,
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := map[string]any{
+		"users": []any{
+			map[string]any{"name": "alice"},
+			map[string]any{"name": "bob"},
+			map[string]any{"name": "alice"},
+			map[string]any{"name": "alice"},
+		},
+		"groups": []any{map[string]any{"name": "admins", "members": []any{
+			map[string]any{"name": "carol"},
+			map[string]any{"name": "carol"},
+		}}},
+	}
+	overlay := map[string]any{
+		"users": []any{
+			map[string]any{"name": "bob"},
+			map[string]any{"name": "bob", "_delete": true},
+			map[string]any{"name": "bob"},
+		},
+	}
+
+	_, err = merger.MergeUnstructured(base, overlay)
+	var dupErr *keymerge.DuplicatePrimaryKeyError
+	if !errors.As(err, &dupErr) {
+		t.Fatalf("expected DuplicatePrimaryKeyError, got %v", err)
+	}
+	if dupErr.DocIndex != 0 || !reflect.DeepEqual(dupErr.Path, []string{"groups", "0", "members", "1"}) {
+		t.Errorf("unexpected error %v", dupErr)
+	}
+	expected := []keymerge.DuplicateGroup{
+		{Path: []string{"groups", "0", "members"}, Key: "carol", Positions: []int{0, 1}, DocIndex: 0},
+		{Path: []string{"users"}, Key: "alice", Positions: []int{0, 2, 3}, DocIndex: 0},
+		{Path: []string{"users"}, Key: "bob", Positions: []int{0, 2}, DocIndex: 1},
+	}
+	if got := merger.Duplicates(); !equalGroups(got, expected) {
+		t.Errorf("unexpected duplicates:\n got: %+v\nwant: %+v", got, expected)
+	}
+
+	// Traces collect and report them too.
+	if _, traceErr := merger.Trace(base, overlay); traceErr == nil || traceErr.Error() != err.Error() {
+		t.Errorf("expected Trace to fail with %v, got %v", err, traceErr)
+	}
+	if got := merger.Duplicates(); !equalGroups(got, expected) {
+		t.Errorf("unexpected duplicates after Trace:\n got: %+v\nwant: %+v", got, expected)
+	}
+
+	// Consolidated lists are merged, and their duplicates still reported.
+	merger, err = keymerge.NewUntypedMerger(keymerge.Options{
+		PrimaryKeyNames:   []string{"name"},
+		DupeMode:          keymerge.DupeConsolidate,
+		CollectDuplicates: true,
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := merger.MergeUnstructured(map[string]any{"users": []any{
+		map[string]any{"name": "alice", "role": "user"},
+		map[string]any{"name": "alice", "team": "web"},
+	}}, map[string]any{"users": []any{map[string]any{"name": "bob"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"users": []any{
+		map[string]any{"name": "alice", "role": "user", "team": "web"},
+		map[string]any{"name": "bob"},
+	}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+	if got := merger.Duplicates(); len(got) != 1 || got[0].Key != "alice" {
+		t.Errorf("unexpected duplicates %+v", got)
+	}
+
+	// Each merge starts a new report.
+	if _, err := merger.MergeUnstructured(want); err != nil {
+		t.Fatal(err)
+	}
+	if got := merger.Duplicates(); got != nil {
+		t.Errorf("expected no duplicates, got %+v", got)
+	}
+}
+
+func TestCollectDuplicatesTyped(t *testing.T) {
+	type Rule struct {
+		Port  int    `yaml:"port" km:"primary"`
+		Proto string `yaml:"proto" km:"primary"`
+	}
+	type Config struct {
+		Rules []Rule `yaml:"rules"`
+		Tags  []Rule `yaml:"tags" km:"dupe=consolidate"`
+	}
+	merger, err := keymerge.NewMerger[Config](keymerge.Options{CollectDuplicates: true}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = merger.MergeUnstructured(map[string]any{
+		"rules": []any{
+			map[string]any{"port": 80, "proto": "tcp"},
+			map[string]any{"port": 80, "proto": "udp"},
+			map[string]any{"port": 80, "proto": "tcp"},
+		},
+		"tags": []any{
+			map[string]any{"port": 1, "proto": "x"},
+			map[string]any{"port": 1, "proto": "x"},
+		},
+	})
+	if !errors.Is(err, keymerge.ErrDuplicatePrimaryKey) {
+		t.Fatalf("expected ErrDuplicatePrimaryKey, got %v", err)
+	}
+	groups := merger.Duplicates()
+	if len(groups) != 2 || !reflect.DeepEqual(groups[0].Positions, []int{0, 2}) || !reflect.DeepEqual(groups[1].Path, []string{"tags"}) {
+		t.Errorf("unexpected duplicates %+v", groups)
+	}
+}
+
+// equalGroups compares duplicate groups by their exported fields.
+func equalGroups(a, b []keymerge.DuplicateGroup) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !reflect.DeepEqual(a[i].Path, b[i].Path) || a[i].Key != b[i].Key ||
+			!reflect.DeepEqual(a[i].Positions, b[i].Positions) || a[i].DocIndex != b[i].DocIndex {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"math/big"
+	"slices"
+)
+
+// ErrUnresolvedFlag indicates a feature flag of a document merged with
+// [PresetFeatureFlags] does not resolve to exactly one state in an environment.
+var ErrUnresolvedFlag = errors.New("unresolved feature flag")
+
+// FeatureFlagError is returned when a feature flag of a document merged with
+// [PresetFeatureFlags] has an environment that sets neither or both of a
+// state and a rollout, or a rollout whose percentages do not total 100.
+type FeatureFlagError struct {
+	// Flag is the flag's name.
+	Flag string
+	// Environment is the environment's name.
+	Environment string
+	// Reason describes why the flag does not resolve.
+	Reason string
+}
+
+func (e *FeatureFlagError) Error() string {
+	return fmt.Sprintf("feature flag %s in environment %s: %s", e.Flag, e.Environment, e.Reason)
+}
+
+func (e *FeatureFlagError) Is(target error) bool {
+	return target == ErrUnresolvedFlag
+}
+
+// checkFeatureFlags checks that every flag of a merged feature flag document
+// resolves to exactly one state in each of its environments (see
+// [PresetFeatureFlags]). Flags and environments are checked in order, and
+// the first that does not resolve is reported.
+func checkFeatureFlags(doc any) error {
+	root, ok := doc.(map[string]any)
+	if !ok {
+		return nil
+	}
+	for flag, f := range namedEntries(root["flags"]) {
+		for env, e := range namedEntries(f["environments"]) {
+			if reason := resolveFlag(e); reason != "" {
+				return &FeatureFlagError{Flag: flag, Environment: env, Reason: reason}
+			}
+		}
+	}
+	return nil
+}
+
+// namedEntries visits the maps of v by name: the items of a list by their
+// "name" fields, or the values of a map by their keys, in key order.
+func namedEntries(v any) iter.Seq2[string, map[string]any] {
+	return func(yield func(string, map[string]any) bool) {
+		switch v := v.(type) {
+		case []any:
+			for _, item := range v {
+				if entry, ok := item.(map[string]any); ok && entry["name"] != nil {
+					if !yield(fmt.Sprint(entry["name"]), entry) {
+						return
+					}
+				}
+			}
+		case map[string]any:
+			for _, name := range slices.Sorted(maps.Keys(v)) {
+				if entry, ok := v[name].(map[string]any); ok {
+					if !yield(name, entry) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// resolveFlag returns why an environment of a flag does not resolve to exactly
+// one state, or "" if it does.
+func resolveFlag(env map[string]any) string {
+	state, rollout := env["state"], env["rollout"]
+	switch {
+	case state == nil && rollout == nil:
+		return "neither state nor rollout is set"
+	case state != nil && rollout != nil:
+		return fmt.Sprintf("both state %v and a rollout are set", state)
+	case rollout == nil:
+		return ""
+	}
+
+	total := new(big.Rat)
+	add := func(v any) string {
+		n, ok := toDecimal(v)
+		if !ok {
+			return fmt.Sprintf("rollout percentage %v is not a number", v)
+		}
+		total.Add(total, n)
+		return ""
+	}
+	switch rollout := rollout.(type) {
+	case map[string]any:
+		for _, variation := range slices.Sorted(maps.Keys(rollout)) {
+			if reason := add(rollout[variation]); reason != "" {
+				return reason
+			}
+		}
+	case []any:
+		for _, item := range rollout {
+			entry, _ := item.(map[string]any)
+			if reason := add(entry["percentage"]); reason != "" {
+				return reason
+			}
+		}
+	default:
+		return fmt.Sprintf("rollout %v is neither a map nor a list", rollout)
+	}
+	if total.Cmp(big.NewRat(100, 1)) != 0 {
+		return fmt.Sprintf("rollout totals %s%%, not 100%%", decimalNumber(total))
+	}
+	return ""
+}
@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestPresetFeatureFlags_Resolution(t *testing.T) {
+	base := `
+flags:
+  - name: new-checkout
+    environments:
+      - {name: staging, state: off}
+      - {name: prod, state: off}
+`
+	tests := []struct {
+		name    string
+		overlay string
+		want    *keymerge.FeatureFlagError // nil if the flag resolves
+	}{
+		{
+			name:    "state replaced",
+			overlay: "flags: [{name: new-checkout, environments: [{name: prod, state: on}]}]",
+		},
+		{
+			name:    "rollout replacing state",
+			overlay: "flags: [{name: new-checkout, environments: [{name: prod, state: null, rollout: {on: 12.5, off: 87.5}}]}]",
+		},
+		{
+			name:    "rollout beside state",
+			overlay: "flags: [{name: new-checkout, environments: [{name: prod, rollout: {on: 10, off: 90}}]}]",
+			want:    &keymerge.FeatureFlagError{Flag: "new-checkout", Environment: "prod", Reason: "both state off and a rollout are set"},
+		},
+		{
+			name:    "rollout short of 100",
+			overlay: "flags: [{name: new-checkout, environments: [{name: staging, state: null, rollout: [{variation: on, percentage: 10}, {variation: off, percentage: 80}]}]}]",
+			want:    &keymerge.FeatureFlagError{Flag: "new-checkout", Environment: "staging", Reason: "rollout totals 90%, not 100%"},
+		},
+		{
+			name:    "new environment without state",
+			overlay: "flags: [{name: new-checkout, environments: [{name: dev}]}]",
+			want:    &keymerge.FeatureFlagError{Flag: "new-checkout", Environment: "dev", Reason: "neither state nor rollout is set"},
+		},
+		{
+			name:    "environments as a map",
+			overlay: "flags: [{name: beta-api, environments: {prod: {rollout: {on: fifty}}}}]",
+			want:    &keymerge.FeatureFlagError{Flag: "beta-api", Environment: "prod", Reason: "rollout percentage fifty is not a number"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var baseDoc, overlayDoc any
+			if err := yaml.Unmarshal([]byte(base), &baseDoc); err != nil {
+				t.Fatal(err)
+			}
+			if err := yaml.Unmarshal([]byte(tt.overlay), &overlayDoc); err != nil {
+				t.Fatal(err)
+			}
+			// Overlays switch environments to rollouts by deleting their states
+			opts := keymerge.Options{Preset: keymerge.PresetFeatureFlags, NullMode: keymerge.NullDelete}
+			_, err := keymerge.MergeUnstructured(opts, baseDoc, overlayDoc)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var flagErr *keymerge.FeatureFlagError
+			if !errors.As(err, &flagErr) || !errors.Is(err, keymerge.ErrUnresolvedFlag) {
+				t.Fatalf("expected FeatureFlagError, got %v", err)
+			}
+			if *flagErr != *tt.want {
+				t.Errorf("got %+v, want %+v", *flagErr, *tt.want)
+			}
+		})
+	}
+}
+
+func TestPresetFeatureFlags_OtherPresets(t *testing.T) {
+	// Only the feature flag preset checks flags
+	doc := map[string]any{"flags": []any{map[string]any{
+		"name":         "x",
+		"environments": []any{map[string]any{"name": "prod"}},
+	}}}
+	if _, err := keymerge.MergeUnstructured(keymerge.Options{}, doc, doc); err != nil {
+		t.Error(err)
+	}
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{Preset: keymerge.PresetFeatureFlags}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := merger.Trace(doc); !errors.Is(err, keymerge.ErrUnresolvedFlag) {
+		t.Errorf("expected Trace to check flags, got %v", err)
+	}
+}
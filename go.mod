@@ -5,3 +5,5 @@ go 1.24
 require github.com/goccy/go-yaml v1.18.0
 
 require github.com/BurntSushi/toml v1.5.0
+
+require github.com/klauspost/compress v1.18.0
@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrNotGranted indicates a document made a change its [Grant] does not allow.
+var ErrNotGranted = errors.New("change not granted")
+
+// Grant describes what a document may change in the documents merged before it,
+// so that e.g. a platform base can give each team a bounded slice of the config.
+//
+// Each field lists path patterns: path expressions (see [Lookup]) that may contain
+// wildcards, where "[*]" matches every list item, "*" as a field name matches
+// every map value, and "**" matches any number of nested keys and items, e.g.
+// "**.annotations". A pattern grants the value it matches and everything beneath it.
+// Selectors in patterns match items by their primary keys, e.g. "services[name=web]".
+type Grant struct {
+	// Add lists where the document may add values the result did not have.
+	Add []string
+	// Override lists where the document may change existing values.
+	Override []string
+	// Delete lists where the document may remove values.
+	Delete []string
+}
+
+// GrantViolation describes a change that a document's [Grant] does not allow.
+type GrantViolation struct {
+	// DocIndex is the index of the document that made the change.
+	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
+	// Kind tells whether the document added, modified, or removed the value.
+	Kind ChangeKind
+	// Path is a path expression addressing the value, as in [Change].
+	Path string
+}
+
+func (v GrantViolation) String() string {
+	verbs := map[ChangeKind]string{ChangeAdded: "add", ChangeModified: "override", ChangeRemoved: "delete"}
+	return fmt.Sprintf("document %d%s may not %s %s", v.DocIndex, nameSuffix(v.DocName), verbs[v.Kind], v.Path)
+}
+
+// GrantError is returned when a document makes changes its [Grant] does not allow.
+type GrantError struct {
+	// Violations lists every change the document was not granted, in the order
+	// [UntypedMerger.Compare] reports them.
+	Violations []GrantViolation
+}
+
+func (e *GrantError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.String()
+	}
+	return fmt.Sprintf("%d change(s) not granted: %s", len(e.Violations), strings.Join(messages, "; "))
+}
+
+func (e *GrantError) Is(target error) bool {
+	return target == ErrNotGranted
+}
+
+// compiledGrant is a [Grant] with parsed patterns.
+type compiledGrant struct {
+	add, override, remove [][]pathStep
+}
+
+// SetGrants restricts what documents may change in subsequent merges: grants[i]
+// applies to the document at index i, and documents with a nil or missing
+// grant may change anything. Passing no grants removes all restrictions.
+//
+// After merging a restricted document, the merger compares the result before and
+// after it (see [UntypedMerger.Compare]) and returns a [*GrantError] if any change
+// is not granted. A value added beneath a new map is checked field by field, so
+// granting "teams.web" allows adding it even if "teams" did not exist yet.
+// Grants are enforced by [UntypedMerger.MergeUnstructured] and [UntypedMerger.Merge].
+//
+// Returns an error wrapping [ErrInvalidPath] if a pattern cannot be parsed.
+//
+// Example:
+//
+//	// The base (document 0) may change anything; the web team's overlay
+//	// (document 1) may only change the web service and add feature flags.
+//	err := merger.SetGrants([]*keymerge.Grant{
+//		nil,
+//		{Add: []string{"services[name=web]", "features"}, Override: []string{"services[name=web]"}},
+//	})
+func (m *UntypedMerger) SetGrants(grants []*Grant) error {
+	compiled := make([]*compiledGrant, len(grants))
+	for i, grant := range grants {
+		if grant == nil {
+			continue
+		}
+		var c compiledGrant
+		var err error
+		if c.add, err = parsePatterns(grant.Add); err != nil {
+			return err
+		}
+		if c.override, err = parsePatterns(grant.Override); err != nil {
+			return err
+		}
+		if c.remove, err = parsePatterns(grant.Delete); err != nil {
+			return err
+		}
+		compiled[i] = &c
+	}
+	m.grants = compiled
+	return nil
+}
+
+func parsePatterns(patterns []string) ([][]pathStep, error) {
+	parsed := make([][]pathStep, len(patterns))
+	for i, pattern := range patterns {
+		steps, err := parsePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		parsed[i] = steps
+	}
+	return parsed, nil
+}
+
+// checkGrant returns a [*GrantError] if merging document i changed the result
+// in ways its grant does not allow. It does nothing if the document is unrestricted.
+func (m *UntypedMerger) checkGrant(i int, before, after any) error {
+	if i >= len(m.grants) || m.grants[i] == nil {
+		return nil
+	}
+	grant := m.grants[i]
+
+	if before == nil {
+		before = emptyLike(after)
+	}
+	changes, err := m.Compare(before, after)
+	if err != nil {
+		return err
+	}
+
+	var violations []GrantViolation
+	for _, change := range changes {
+		violations = grant.check(i, change.Kind, change.Path, change.New, violations)
+	}
+	if len(violations) > 0 {
+		return &GrantError{Violations: violations}
+	}
+	return nil
+}
+
+// check appends a violation for a change unless it is granted. Additions of maps
+// that are not granted as a whole are checked field by field, except for keyed
+// list items, whose fields only exist together.
+func (g *compiledGrant) check(i int, kind ChangeKind, path string, value any, violations []GrantViolation) []GrantViolation {
+	patterns := g.add
+	switch kind {
+	case ChangeModified:
+		patterns = g.override
+	case ChangeRemoved:
+		patterns = g.remove
+	}
+	steps, err := parsePath(path)
+	if err == nil {
+		for _, pattern := range patterns {
+			if patternCovers(pattern, steps) {
+				return violations
+			}
+		}
+	}
+
+	mp, isMap := value.(map[string]any)
+	if isMap && kind == ChangeAdded && len(mp) > 0 && len(steps) > 0 && steps[len(steps)-1].kind == stepField {
+		for _, k := range sortedKeys(mp) {
+			violations = g.check(i, kind, appendFieldPath(path, k), mp[k], violations)
+		}
+		return violations
+	}
+	return append(violations, GrantViolation{DocIndex: i, Kind: kind, Path: path})
+}
+
+// patternCovers reports whether pattern matches a prefix of the concrete path steps.
+func patternCovers(pattern, steps []pathStep) bool {
+	for i, p := range pattern {
+		if p.kind == stepRecursive {
+			for j := i; j <= len(steps); j++ {
+				if patternCovers(pattern[i+1:], steps[j:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if i >= len(steps) {
+			return false
+		}
+		s := steps[i]
+		switch p.kind {
+		case stepWildcard:
+			continue
+		case stepField:
+			if s.kind != stepField || s.field != p.field {
+				return false
+			}
+		case stepIndex:
+			if s.kind != stepIndex || s.index != p.index {
+				return false
+			}
+		case stepSelect:
+			if s.kind != stepSelect || !hasMatches(s.match, p.match) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hasMatches reports whether every condition in want is also in have.
+func hasMatches(have, want []keyMatch) bool {
+	for _, w := range want {
+		if !slices.Contains(have, w) {
+			return false
+		}
+	}
+	return true
+}
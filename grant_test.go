@@ -0,0 +1,163 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestSetGrants(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}, DeleteMarkerKey: "_delete"}
+	base := map[string]any{
+		"log": "info",
+		"services": []any{
+			map[string]any{"name": "web", "replicas": 1},
+			map[string]any{"name": "db", "replicas": 1},
+		},
+	}
+	grants := []*keymerge.Grant{nil, {
+		Add:      []string{"services[name=web]", "teams.web"},
+		Override: []string{"services[name=web].replicas"},
+		Delete:   []string{"services[name=web].debug"},
+	}}
+
+	tests := []struct {
+		name       string
+		overlay    any
+		violations []keymerge.GrantViolation
+	}{
+		{
+			name: "granted",
+			overlay: map[string]any{
+				"services": []any{map[string]any{"name": "web", "replicas": 3, "debug": false}},
+				"teams":    map[string]any{"web": map[string]any{"owner": "alice"}},
+			},
+		},
+		{
+			name: "not granted",
+			overlay: map[string]any{
+				"log": "debug",
+				"services": []any{
+					map[string]any{"name": "db", "_delete": true},
+					map[string]any{"name": "cache"},
+				},
+				"teams": map[string]any{"web": "ok", "db": "nope"},
+			},
+			violations: []keymerge.GrantViolation{
+				{DocIndex: 1, Kind: keymerge.ChangeModified, Path: "log"},
+				{DocIndex: 1, Kind: keymerge.ChangeAdded, Path: "services[name=cache]"},
+				{DocIndex: 1, Kind: keymerge.ChangeRemoved, Path: "services[name=db]"},
+				{DocIndex: 1, Kind: keymerge.ChangeAdded, Path: "teams.db"},
+			},
+		},
+		{
+			name:    "unchanged values are always allowed",
+			overlay: map[string]any{"log": "info", "services": []any{map[string]any{"name": "db", "replicas": 1}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merger, err := keymerge.NewUntypedMerger(opts, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := merger.SetGrants(grants); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = merger.MergeUnstructured(base, tt.overlay)
+			if tt.violations == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var grantErr *keymerge.GrantError
+			if !errors.As(err, &grantErr) || !errors.Is(err, keymerge.ErrNotGranted) {
+				t.Fatalf("expected GrantError, got %v", err)
+			}
+			if !reflect.DeepEqual(grantErr.Violations, tt.violations) {
+				t.Errorf("got %+v, want %+v", grantErr.Violations, tt.violations)
+			}
+		})
+	}
+}
+
+func TestSetGrants_Wildcards(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{PrimaryKeyNames: []string{"name"}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = merger.SetGrants([]*keymerge.Grant{nil, nil, {Override: []string{"services[*].replicas", "limits.*"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := map[string]any{
+		"services": []any{map[string]any{"name": "web", "replicas": 1, "port": 80}},
+		"limits":   map[string]any{"cpu": 1},
+	}
+	second := map[string]any{"limits": map[string]any{"cpu": 2}}
+	third := map[string]any{
+		"services": []any{map[string]any{"name": "web", "replicas": 2, "port": 8080}},
+		"limits":   map[string]any{"cpu": 4},
+	}
+
+	_, err = merger.MergeUnstructured(base, second, third)
+	want := "1 change(s) not granted: document 2 may not override services[name=web].port"
+	if err == nil || err.Error() != want {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := merger.Trace(base, second, third); err == nil || err.Error() != want {
+		t.Fatalf("expected Trace to check grants, got %v", err)
+	}
+
+	third["services"].([]any)[0].(map[string]any)["port"] = 80
+	if _, err := merger.MergeUnstructured(base, second, third); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSetGrants_InvalidPattern(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = merger.SetGrants([]*keymerge.Grant{{Add: []string{"services[name"}}})
+	if !errors.Is(err, keymerge.ErrInvalidPath) {
+		t.Errorf("expected ErrInvalidPath, got %v", err)
+	}
+}
+
+func TestSetGrants_RecursiveWildcard(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{PrimaryKeyNames: []string{"name"}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grant := &keymerge.Grant{Add: []string{"**.annotations"}, Override: []string{"**.annotations"}}
+	if err := merger.SetGrants([]*keymerge.Grant{nil, grant}); err != nil {
+		t.Fatal(err)
+	}
+
+	base := map[string]any{
+		"annotations": map[string]any{"team": "core"},
+		"spec":        map[string]any{"template": map[string]any{"annotations": map[string]any{"a": "1"}, "replicas": 1}},
+	}
+	overlay := map[string]any{
+		"annotations": map[string]any{"team": "web"},
+		"spec":        map[string]any{"template": map[string]any{"annotations": map[string]any{"a": "2", "b": "3"}}},
+	}
+	if _, err := merger.MergeUnstructured(base, overlay); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	overlay["spec"].(map[string]any)["template"].(map[string]any)["replicas"] = 2
+	_, err = merger.MergeUnstructured(base, overlay)
+	if err == nil || err.Error() != "1 change(s) not granted: document 1 may not override spec.template.replicas" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
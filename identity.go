@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// IdentityFunc identifies a list item that lacks a clean primary key field,
+// e.g. by a hash of several fields or the host of a URL. It returns the item's
+// key and whether it has one. Keys must be comparable; use [NewKey] for keys
+// made of several values.
+type IdentityFunc func(item map[string]any) (key any, ok bool)
+
+// IdentityRule applies an [IdentityFunc] to the lists a path pattern addresses.
+type IdentityRule struct {
+	// Path is a path pattern (see [Grant]) addressing the lists whose items to
+	// identify, e.g. "containers[*].volumeMounts" or "**.env". Patterns may not
+	// contain selectors.
+	Path string
+	// Identity returns the key of each map item of the lists.
+	Identity IdentityFunc
+}
+
+// compiledIdentity is an [IdentityRule] with a parsed path pattern.
+type compiledIdentity struct {
+	pattern  []pathStep
+	identity IdentityFunc
+}
+
+// SetIdentityFuncs sets how list items are identified in subsequent merges.
+// For each list, the first rule whose pattern matches the list's path applies,
+// taking the place of [Options.KeyFunc], [Options.PrimaryKeyNames],
+// [Options.CompositeKeys], and km:"primary" tags for that list; lists that
+// match none are keyed as usual. Passing no rules removes all identity
+// functions.
+//
+// Items with equal keys are merged like items with equal primary keys, and
+// [KeyNormalizer]s apply to the keys. Like [Options.KeyFunc], identity
+// functions apply wherever this merger matches list items, including
+// [UntypedMerger.Compare] and [UntypedMerger.Diff], and paths of their items in
+// results use positions rather than selectors.
+//
+// Returns an error wrapping [ErrInvalidPath] if a pattern cannot be parsed or
+// contains a selector.
+//
+// Example:
+//
+//	err := merger.SetIdentityFuncs([]keymerge.IdentityRule{
+//		{Path: "**.volumeMounts", Identity: keymerge.FieldIdentity("mountPath")},
+//		{Path: "mirrors", Identity: keymerge.URLHostIdentity("url")},
+//	})
+func (m *UntypedMerger) SetIdentityFuncs(rules []IdentityRule) error {
+	compiled := make([]compiledIdentity, 0, len(rules))
+	for _, rule := range rules {
+		pattern, err := parsePattern(rule.Path)
+		if err != nil {
+			return err
+		}
+		for _, step := range pattern {
+			if step.kind == stepSelect {
+				return fmt.Errorf("%w %q: identity patterns cannot contain selectors", ErrInvalidPath, rule.Path)
+			}
+		}
+		if rule.Identity == nil {
+			return fmt.Errorf("%w: nil Identity for identity rule %q", ErrInvalidOptions, rule.Path)
+		}
+		compiled = append(compiled, compiledIdentity{pattern: pattern, identity: rule.Identity})
+	}
+	if len(compiled) == 0 {
+		compiled = nil
+	}
+	m.identities = compiled
+	return nil
+}
+
+// identityFor returns the identity function for the list at listPath, or nil
+// if no rule applies.
+func (m *UntypedMerger) identityFor(listPath []pathSegment) IdentityFunc {
+	for _, rule := range m.identities {
+		if matchesSegments(rule.pattern, listPath) {
+			return rule.identity
+		}
+	}
+	return nil
+}
+
+// listIdentity returns the identity function for the list containing the item
+// at the current path, or nil if no rule applies.
+func (m *UntypedMerger) listIdentity() IdentityFunc {
+	if len(m.identities) == 0 || len(m.path) == 0 {
+		return nil
+	}
+	return m.identityFor(m.path[:len(m.path)-1])
+}
+
+// keyedByFunc reports whether the items of the list containing the item at the
+// current path are identified by a function rather than by key fields.
+func (m *UntypedMerger) keyedByFunc() bool {
+	return m.opts.KeyFunc != nil || m.listIdentity() != nil
+}
+
+// FieldIdentity returns an [IdentityFunc] keying items by the given fields,
+// all of which they must have, e.g. volume mounts by "mountPath". Fields may be
+// dotted paths into nested maps, as in [Options.PrimaryKeyNames]. Combine it
+// with a [KeyNormalizer] such as [LowercaseKey] to match values loosely.
+func FieldIdentity(fields ...string) IdentityFunc {
+	return func(item map[string]any) (any, bool) {
+		if len(fields) == 1 {
+			val, exists := keyFieldValue(item, fields[0])
+			return val, exists && val != nil
+		}
+		return KeyOf(item, fields...)
+	}
+}
+
+// URLHostIdentity returns an [IdentityFunc] keying items by the host, with
+// its port if any, of the URL in field, ignoring case, so that
+// "https://Mirror.example.com/v1" and "http://mirror.example.com/v2" match.
+// Items whose field is not a URL with a host have no key.
+func URLHostIdentity(field string) IdentityFunc {
+	return func(item map[string]any) (any, bool) {
+		val, _ := keyFieldValue(item, field)
+		s, ok := val.(string)
+		if !ok {
+			return nil, false
+		}
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			return nil, false
+		}
+		return strings.ToLower(u.Host), true
+	}
+}
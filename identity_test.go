@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestSetIdentityFuncs(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{
+		PrimaryKeyNames: []string{"name"},
+		DeleteMarkerKey: "_delete",
+		KeyMatchMode:    keymerge.KeyMatchAny,
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = merger.SetIdentityFuncs([]keymerge.IdentityRule{
+		{Path: "containers[*].volumeMounts", Identity: keymerge.FieldIdentity("mountPath")},
+		{Path: "**.env", Identity: keymerge.FieldIdentity("name")},
+		{Path: "mirrors", Identity: keymerge.URLHostIdentity("url")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := merger.SetKeyNormalizers([]keymerge.KeyNormalizer{
+		{Path: "**.env", Normalize: keymerge.LowercaseKey},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	base := map[string]any{
+		"containers": []any{map[string]any{
+			"name": "app",
+			"volumeMounts": []any{
+				map[string]any{"name": "data", "mountPath": "/data"},
+				map[string]any{"name": "cache", "mountPath": "/cache"},
+			},
+			"env": []any{map[string]any{"name": "LOG_LEVEL", "value": "info"}},
+		}},
+		"mirrors": []any{
+			map[string]any{"url": "https://Mirror.example.com/v1", "weight": 1},
+			map[string]any{"url": "https://backup.example.com", "weight": 2},
+		},
+	}
+	overlay := map[string]any{
+		"containers": []any{map[string]any{
+			"name": "app",
+			"volumeMounts": []any{
+				map[string]any{"name": "data-v2", "mountPath": "/data"},
+				map[string]any{"mountPath": "/cache", "_delete": true},
+			},
+			"env": []any{map[string]any{"name": "log_level", "value": "debug"}},
+		}},
+		"mirrors": []any{map[string]any{"url": "https://mirror.example.com/v2", "weight": 5}},
+	}
+
+	result, err := merger.MergeUnstructured(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{
+		"containers": []any{map[string]any{
+			"name":         "app",
+			"volumeMounts": []any{map[string]any{"name": "data-v2", "mountPath": "/data"}},
+			"env":          []any{map[string]any{"name": "log_level", "value": "debug"}},
+		}},
+		"mirrors": []any{
+			map[string]any{"url": "https://mirror.example.com/v2", "weight": 5},
+			map[string]any{"url": "https://backup.example.com", "weight": 2},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected result:\n got: %v\nwant: %v", result, expected)
+	}
+
+	// Items with equal identities are duplicates.
+	_, err = merger.MergeUnstructured(base, map[string]any{
+		"mirrors": []any{
+			map[string]any{"url": "https://a.example.com/x"},
+			map[string]any{"url": "https://A.example.com/y"},
+		},
+	})
+	if !errors.Is(err, keymerge.ErrDuplicatePrimaryKey) {
+		t.Errorf("expected ErrDuplicatePrimaryKey, got %v", err)
+	}
+
+	// Diff identifies items the same way.
+	desired := map[string]any{
+		"mirrors": []any{map[string]any{"url": "https://mirror.example.com/v1", "weight": 1}},
+	}
+	diff, err := merger.Diff(map[string]any{"mirrors": base["mirrors"]}, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err := merger.MergeUnstructured(map[string]any{"mirrors": base["mirrors"]}, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(merged, desired) {
+		t.Errorf("diff %v merges to %v, want %v", diff, merged, desired)
+	}
+
+	// Removing the rules restores key matching.
+	if err := merger.SetIdentityFuncs(nil); err != nil {
+		t.Fatal(err)
+	}
+	result, err = merger.MergeUnstructured(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mounts := result.(map[string]any)["containers"].([]any)[0].(map[string]any)["volumeMounts"].([]any)
+	if len(mounts) != 3 {
+		t.Errorf("expected mounts to be matched by name, got %v", mounts)
+	}
+}
+
+func TestSetIdentityFuncsInvalid(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity := keymerge.FieldIdentity("id")
+	for _, rule := range []keymerge.IdentityRule{
+		{Path: "items[name=a]", Identity: identity},
+		{Path: "items[", Identity: identity},
+	} {
+		if err := merger.SetIdentityFuncs([]keymerge.IdentityRule{rule}); !errors.Is(err, keymerge.ErrInvalidPath) {
+			t.Errorf("%q: expected ErrInvalidPath, got %v", rule.Path, err)
+		}
+	}
+	if err := merger.SetIdentityFuncs([]keymerge.IdentityRule{{Path: "items"}}); !errors.Is(err, keymerge.ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions, got %v", err)
+	}
+}
+
+func TestIdentityHelpers(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity keymerge.IdentityFunc
+		item     map[string]any
+		key      any
+		ok       bool
+	}{
+		{"field", keymerge.FieldIdentity("mountPath"), map[string]any{"mountPath": "/data"}, "/data", true},
+		{"nested field", keymerge.FieldIdentity("metadata.name"), map[string]any{"metadata": map[string]any{"name": "web"}}, "web", true},
+		{"missing field", keymerge.FieldIdentity("mountPath"), map[string]any{"name": "data"}, nil, false},
+		{"fields", keymerge.FieldIdentity("host", "port"), map[string]any{"host": "db", "port": 5432}, keymerge.NewKey("db", 5432), true},
+		{"missing one of fields", keymerge.FieldIdentity("host", "port"), map[string]any{"host": "db"}, keymerge.Key{}, false},
+		{"url host", keymerge.URLHostIdentity("url"), map[string]any{"url": "https://Example.COM:8443/path"}, "example.com:8443", true},
+		{"not a url", keymerge.URLHostIdentity("url"), map[string]any{"url": "example.com"}, nil, false},
+		{"not a string", keymerge.URLHostIdentity("url"), map[string]any{"url": 42}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := tt.identity(tt.item)
+			if ok != tt.ok {
+				t.Fatalf("got ok %v, want %v", ok, tt.ok)
+			}
+			if want, isKey := tt.key.(keymerge.Key); isKey {
+				if got, _ := key.(keymerge.Key); ok && !got.Equal(want) {
+					t.Errorf("got key %v, want %v", key, want)
+				}
+				return
+			}
+			if ok && key != tt.key {
+				t.Errorf("got key %v, want %v", key, tt.key)
+			}
+		})
+	}
+}
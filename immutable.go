@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrImmutableField indicates an overlay changed a field tagged km:"immutable".
+var ErrImmutableField = errors.New("immutable field changed")
+
+// ImmutableFieldError is returned when an overlay gives a field tagged
+// km:"immutable" a different value than it already has, or deletes it.
+type ImmutableFieldError struct {
+	// Path is where in the document the field is.
+	Path []string
+	// Base is the field's value before the overlay was merged.
+	Base any
+	// Overlay is the field's value had the overlay been merged, or nil if the
+	// overlay deletes the field.
+	Overlay any
+	// DocIndex tells which document changed the field.
+	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
+}
+
+func (e *ImmutableFieldError) Error() string {
+	path := strings.Join(e.Path, ".")
+	if e.Overlay == nil {
+		return fmt.Sprintf("immutable field at path %s in document %d%s: deleting %v",
+			path, e.DocIndex, nameSuffix(e.DocName), e.Base)
+	}
+	return fmt.Sprintf("immutable field at path %s in document %d%s: %v would replace %v",
+		path, e.DocIndex, nameSuffix(e.DocName), e.Overlay, e.Base)
+}
+
+func (e *ImmutableFieldError) Is(target error) bool {
+	return target == ErrImmutableField
+}
+
+// checkImmutable returns an [*ImmutableFieldError] if the field at the current
+// path is tagged km:"immutable" and merging the current document changes its
+// value from base to merged, where a nil merged value means the document
+// deletes it. Fields without a value yet may be set.
+func (m *UntypedMerger) checkImmutable(base, merged any) error {
+	meta := m.getCurrentMetadata()
+	if meta == nil || !meta.immutable || base == nil || (merged != nil && equalValues(base, merged)) {
+		return nil
+	}
+	return &ImmutableFieldError{Path: m.pathNames(), Base: base, Overlay: merged, DocIndex: m.index}
+}
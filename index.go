@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import "strconv"
+
+// IndexList maps the primary key of each item in list to the item's position,
+// identifying items exactly as the merger does with [Options.PrimaryKeyNames] set
+// to keys: an item's key is the value of the first of keys that the item has.
+// Items that are not maps or have none of the keys are not indexed.
+//
+// Key values are used as map keys directly, so an int 1 and a string "1" are
+// different keys, just as they are when merging.
+//
+// Returns a [*NonComparablePrimaryKeyError] if a key value is not comparable,
+// a [*DuplicatePrimaryKeyError] if two items share a key, or an error wrapping
+// [ErrInvalidOptions] if keys contains an empty name.
+//
+// Example:
+//
+//	index, err := keymerge.IndexList(services, []string{"name"})
+//	if err != nil {
+//		return err
+//	}
+//	web := services[index["web"]]
+func IndexList(list []any, keys []string) (map[any]int, error) {
+	m, err := NewUntypedMerger(Options{PrimaryKeyNames: keys}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	m.reset(0)
+	return m.indexList(list)
+}
+
+// indexList maps the primary key of each keyed item in list to its position,
+// using the key rules for the current path.
+func (m *UntypedMerger) indexList(list []any) (map[any]int, error) {
+	index := make(map[any]int, len(list))
+	for i, item := range list {
+		m.push(strconv.Itoa(i))
+		key := m.getPrimaryKey(item)
+		m.pop()
+		if key == nil {
+			continue
+		}
+
+		if !isKeyComparable(key) {
+			return nil, &NonComparablePrimaryKeyError{
+				Key:      keyString(key),
+				Position: i,
+				Path:     m.pathNames(),
+				DocIndex: m.index,
+			}
+		}
+
+		mapKey := toMapKey(key)
+		if first, exists := index[mapKey]; exists {
+			return nil, &DuplicatePrimaryKeyError{
+				Key:       keyString(key),
+				Positions: []int{first, i},
+				Path:      m.pathNames(),
+				DocIndex:  m.index,
+			}
+		}
+		index[mapKey] = i
+	}
+	return index, nil
+}
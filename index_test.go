@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestIndexList(t *testing.T) {
+	list := []any{
+		map[string]any{"name": "web"},
+		"scalar",
+		map[string]any{"id": 7, "name": "api"},
+		map[string]any{"id": 7.5},
+		map[string]any{"other": true},
+		map[string]any{"name": nil, "id": "1"},
+	}
+
+	index, err := keymerge.IndexList(list, []string{"name", "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[any]int{"web": 0, "api": 2, 7.5: 3, "1": 5}
+	if !reflect.DeepEqual(index, expected) {
+		t.Fatalf("unexpected index: %v", index)
+	}
+}
+
+func TestIndexList_Errors(t *testing.T) {
+	_, err := keymerge.IndexList([]any{
+		map[string]any{"id": 1},
+		map[string]any{"id": 2},
+		map[string]any{"id": 1},
+	}, []string{"id"})
+	var dupErr *keymerge.DuplicatePrimaryKeyError
+	if !errors.As(err, &dupErr) || !reflect.DeepEqual(dupErr.Positions, []int{0, 2}) {
+		t.Fatalf("expected duplicate key error at positions [0 2], got %v", err)
+	}
+
+	_, err = keymerge.IndexList([]any{map[string]any{"id": []any{1}}}, []string{"id"})
+	if !errors.Is(err, keymerge.ErrNonComparablePrimaryKey) {
+		t.Fatalf("expected non-comparable key error, got %v", err)
+	}
+
+	_, err = keymerge.IndexList(nil, []string{""})
+	if !errors.Is(err, keymerge.ErrInvalidOptions) {
+		t.Fatalf("expected invalid options error, got %v", err)
+	}
+}
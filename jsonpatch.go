@@ -0,0 +1,202 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// PatchOperation is an operation of a JSON Patch (RFC 6902).
+type PatchOperation struct {
+	// Op is "add", "remove", or "replace".
+	Op string `json:"op"`
+	// Path is a JSON Pointer (RFC 6901) to the value concerned, e.g. "/services/0/port".
+	Path string `json:"path"`
+	// Value is the value to add or replace with (nil for removals).
+	Value any `json:"value,omitempty"`
+}
+
+// MarshalJSON encodes op as a JSON Patch operation. Unlike with omitempty, a
+// nil Value is written as null unless op is a removal.
+func (op PatchOperation) MarshalJSON() ([]byte, error) {
+	if op.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{op.Op, op.Path})
+	}
+	return json.Marshal(struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}{op.Op, op.Path, op.Value})
+}
+
+// JSONPatch computes a JSON Patch that turns base into merged.
+// See [UntypedMerger.JSONPatch] for details.
+func JSONPatch(opts Options, base, merged any) ([]PatchOperation, error) {
+	m, err := NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return m.JSONPatch(base, merged)
+}
+
+// JSONPatch computes a JSON Patch (RFC 6902) that turns base into merged,
+// typically the result of merging overlays onto base, for systems that accept
+// JSON Patch such as Kubernetes admission webhooks and HTTP PATCH APIs.
+//
+// Maps are compared key by key. Items of lists with primary keys are matched
+// by key like merging matches them, so a changed item is patched in place at
+// its index; operations address indexes as they are after the operations
+// before them, as RFC 6902 requires. Lists without keys that merged only
+// appended to are patched with "add" operations at "/-"; other changed lists,
+// and values whose type changed, are replaced whole. Numbers are compared by
+// value. The operations are in a deterministic order, and nil if the
+// documents are equal.
+//
+// Example:
+//
+//	merged, _ := keymerge.MergeUnstructured(opts, base, overlay)
+//	patch, _ := keymerge.JSONPatch(opts, base, merged)
+//	body, _ := json.Marshal(patch)
+//	// [{"op":"replace","path":"/services/0/replicas","value":3}]
+func (m *UntypedMerger) JSONPatch(base, merged any) ([]PatchOperation, error) {
+	var err error
+	m.reset(0)
+	if base, err = m.normalizeKeys(base); err != nil {
+		return nil, err
+	}
+	m.reset(1)
+	if merged, err = m.normalizeKeys(merged); err != nil {
+		return nil, err
+	}
+	var ops []PatchOperation
+	m.patchValues("", base, merged, &ops)
+	return ops, nil
+}
+
+func (m *UntypedMerger) patchValues(pointer string, base, merged any, ops *[]PatchOperation) {
+	if equalValues(base, merged) {
+		return
+	}
+
+	baseMap, baseIsMap := base.(map[string]any)
+	mergedMap, mergedIsMap := merged.(map[string]any)
+	if baseIsMap && mergedIsMap {
+		m.patchMaps(pointer, baseMap, mergedMap, ops)
+		return
+	}
+
+	baseList, baseIsList := asList(base)
+	mergedList, mergedIsList := asList(merged)
+	if baseIsList && mergedIsList {
+		if meta := m.getCurrentMetadata(); (meta == nil || !meta.opaque) && m.hasKeyedItems(baseList, mergedList) {
+			m.patchKeyedLists(pointer, baseList, mergedList, ops)
+			return
+		}
+		if len(mergedList) > len(baseList) && equalValues(baseList, mergedList[:len(baseList)]) {
+			for _, item := range mergedList[len(baseList):] {
+				*ops = append(*ops, PatchOperation{Op: "add", Path: pointer + "/-", Value: item})
+			}
+			return
+		}
+	}
+
+	*ops = append(*ops, PatchOperation{Op: "replace", Path: pointer, Value: merged})
+}
+
+func (m *UntypedMerger) patchMaps(pointer string, base, merged map[string]any, ops *[]PatchOperation) {
+	for _, k := range sortedKeys(base) {
+		if _, exists := merged[k]; !exists {
+			*ops = append(*ops, PatchOperation{Op: "remove", Path: pointer + "/" + escapePointerToken(k)})
+		}
+	}
+	for _, k := range sortedKeys(merged) {
+		childPointer := pointer + "/" + escapePointerToken(k)
+		baseVal, exists := base[k]
+		if !exists {
+			*ops = append(*ops, PatchOperation{Op: "add", Path: childPointer, Value: merged[k]})
+			continue
+		}
+		m.push(k)
+		m.patchValues(childPointer, baseVal, merged[k], ops)
+		m.pop()
+	}
+}
+
+// patchKeyedLists patches base into merged item by item. Base items whose keys
+// merged lacks are removed first; then each merged item is patched in place if
+// the current item at its index has the same key (or neither has one), moved
+// from a later index if it has, or added otherwise. Remaining items are removed.
+func (m *UntypedMerger) patchKeyedLists(pointer string, base, merged []any, ops *[]PatchOperation) {
+	itemKey := func(list []any, i int) any {
+		m.push(strconv.Itoa(i))
+		defer m.pop()
+		if key := m.getPrimaryKey(list[i]); key != nil && isKeyComparable(key) {
+			return toMapKey(key)
+		}
+		return nil
+	}
+
+	mergedKeys := make(map[any]bool, len(merged))
+	wanted := make([]any, len(merged))
+	for j := range merged {
+		wanted[j] = itemKey(merged, j)
+		if wanted[j] != nil {
+			mergedKeys[wanted[j]] = true
+		}
+	}
+
+	// current mirrors the list as the operations so far leave it
+	current := make([]any, 0, len(base))
+	keys := make([]any, 0, len(base))
+	for i := range base {
+		key := itemKey(base, i)
+		if key != nil && !mergedKeys[key] {
+			continue
+		}
+		current = append(current, base[i])
+		keys = append(keys, key)
+	}
+	for i := len(base) - 1; i >= 0; i-- {
+		if key := itemKey(base, i); key != nil && !mergedKeys[key] {
+			*ops = append(*ops, PatchOperation{Op: "remove", Path: pointer + "/" + strconv.Itoa(i)})
+		}
+	}
+
+	for j, item := range merged {
+		itemPointer := pointer + "/" + strconv.Itoa(j)
+		if j < len(current) && keys[j] == wanted[j] {
+			m.push(strconv.Itoa(j))
+			m.patchValues(itemPointer, current[j], item, ops)
+			m.pop()
+			current[j] = item
+			continue
+		}
+		if wanted[j] != nil {
+			for p := j + 1; p < len(current); p++ {
+				if keys[p] == wanted[j] {
+					*ops = append(*ops, PatchOperation{Op: "remove", Path: pointer + "/" + strconv.Itoa(p)})
+					current = append(current[:p], current[p+1:]...)
+					keys = append(keys[:p], keys[p+1:]...)
+					break
+				}
+			}
+		}
+		*ops = append(*ops, PatchOperation{Op: "add", Path: itemPointer, Value: item})
+		current = append(current[:j], append([]any{item}, current[j:]...)...)
+		keys = append(keys[:j], append([]any{wanted[j]}, keys[j:]...)...)
+	}
+
+	for i := len(current) - 1; i >= len(merged); i-- {
+		*ops = append(*ops, PatchOperation{Op: "remove", Path: pointer + "/" + strconv.Itoa(i)})
+	}
+}
+
+// escapePointerToken escapes a map key for use in a JSON Pointer.
+func escapePointerToken(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
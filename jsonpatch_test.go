@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestJSONPatch(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}, DeleteMarkerKey: "_delete"}
+	base := decodeJSON(t, `{
+		"log": "info",
+		"legacy": true,
+		"tags": ["a"],
+		"services": [
+			{"name": "api", "port": 80},
+			{"name": "old"},
+			{"name": "worker", "replicas": 1}
+		]
+	}`)
+	overlay := decodeJSON(t, `{
+		"log": "debug",
+		"legacy": {"_delete": true},
+		"tags": ["b"],
+		"owner": "platform",
+		"services": [
+			{"name": "old", "_delete": true},
+			{"name": "api", "port": 8080},
+			{"name": "cache", "port": 6379}
+		]
+	}`)
+	merged, err := keymerge.MergeUnstructured(opts, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patch, err := keymerge.JSONPatch(opts, base, merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []keymerge.PatchOperation{
+		{Op: "remove", Path: "/legacy"},
+		{Op: "replace", Path: "/log", Value: "debug"},
+		{Op: "add", Path: "/owner", Value: "platform"},
+		{Op: "remove", Path: "/services/1"},
+		{Op: "replace", Path: "/services/0/port", Value: float64(8080)},
+		{Op: "add", Path: "/services/2", Value: map[string]any{"name": "cache", "port": float64(6379)}},
+		{Op: "add", Path: "/tags/-", Value: "b"},
+	}
+	if !reflect.DeepEqual(patch, expected) {
+		t.Fatalf("unexpected patch:\n got: %v\nwant: %v", patch, expected)
+	}
+	if applied := applyPatch(t, base, patch); !reflect.DeepEqual(applied, merged) {
+		t.Errorf("applying the patch gave %v, want %v", applied, merged)
+	}
+
+	encoded, err := json.Marshal(patch[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `[{"op":"remove","path":"/legacy"},{"op":"replace","path":"/log","value":"debug"}]`; string(encoded) != want {
+		t.Errorf("got %s, want %s", encoded, want)
+	}
+}
+
+func TestJSONPatch_Applies(t *testing.T) {
+	tests := []struct {
+		name, base, merged string
+	}{
+		{"equal", `{"a":[1,2]}`, `{"a":[1,2]}`},
+		{"root replace", `{"a":1}`, `[1]`},
+		{"escaped keys", `{"a/b":1,"c~d":{"e":1}}`, `{"a/b":2,"c~d":{"e":2}}`},
+		{"null value", `{"a":1}`, `{"a":null}`},
+		{"unkeyed list rewritten", `{"tags":["a","b"]}`, `{"tags":["b"]}`},
+		{"keyed reorder", `{"s":[{"name":"a","v":1},{"name":"b"},{"name":"c"}]}`, `{"s":[{"name":"c"},{"name":"a","v":2},{"name":"d"}]}`},
+		{"keyed with unkeyed items", `{"s":[{"x":1},{"name":"a"},{"name":"b"}]}`, `{"s":[{"name":"b","v":1},{"x":2}]}`},
+		{"keyed shrinks", `{"s":[{"name":"a"},{"x":1},{"x":2}]}`, `{"s":[{"name":"a"}]}`},
+	}
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, merged := decodeJSON(t, tt.base), decodeJSON(t, tt.merged)
+			patch, err := keymerge.JSONPatch(opts, base, merged)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if applied := applyPatch(t, base, patch); !reflect.DeepEqual(applied, merged) {
+				t.Errorf("applying %v gave %v, want %v", patch, applied, merged)
+			}
+		})
+	}
+}
+
+// applyPatch applies add, remove, and replace operations to a JSON document.
+func applyPatch(t *testing.T, doc any, patch []keymerge.PatchOperation) any {
+	t.Helper()
+	// Work on a copy so the caller's document is unchanged
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc = decodeJSON(t, string(encoded))
+
+	for _, op := range patch {
+		if op.Path == "" {
+			doc = op.Value
+			continue
+		}
+		tokens := strings.Split(op.Path[1:], "/")
+		for i, token := range tokens {
+			tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		}
+		doc = applyOperation(t, doc, tokens, op)
+	}
+	return doc
+}
+
+func applyOperation(t *testing.T, parent any, tokens []string, op keymerge.PatchOperation) any {
+	t.Helper()
+	token := tokens[0]
+	switch p := parent.(type) {
+	case map[string]any:
+		switch {
+		case len(tokens) > 1:
+			p[token] = applyOperation(t, p[token], tokens[1:], op)
+		case op.Op == "remove":
+			delete(p, token)
+		default:
+			p[token] = op.Value
+		}
+		return p
+	case []any:
+		i := len(p)
+		if token != "-" {
+			var err error
+			if i, err = strconv.Atoi(token); err != nil {
+				t.Fatalf("invalid index in %s", op.Path)
+			}
+		}
+		switch {
+		case len(tokens) > 1:
+			p[i] = applyOperation(t, p[i], tokens[1:], op)
+		case op.Op == "remove":
+			p = append(p[:i], p[i+1:]...)
+		case op.Op == "add":
+			p = append(p[:i], append([]any{op.Value}, p[i:]...)...)
+		default:
+			p[i] = op.Value
+		}
+		return p
+	default:
+		t.Fatalf("cannot apply %v to %v", op, parent)
+		return nil
+	}
+}
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Key is a primary key value identifying a list item, possibly made of several fields.
+//
+// When multiple fields are marked with km:"primary", ALL fields must be present
+// and match for two items to be considered the same. This enables matching on
+// combinations like {region, name} or {namespace, kind, name}.
+//
+// The merger uses single-field keys directly without allocating a Key. Keys
+// built with [NewKey] or [KeyOf] compare with [Key.Equal] exactly as the merger
+// matches items, so custom tooling can identify items consistently.
+//
+// Example:
+//
+//	type Endpoint struct {
+//	    Region string `yaml:"region" km:"primary"`
+//	    Name   string `yaml:"name" km:"primary"`
+//	    URL    string `yaml:"url"`
+//	}
+//
+// Items match only when BOTH region AND name are equal.
+type Key struct {
+	values []any
+}
+
+// NewKey returns a key made of the given field values, in key field order.
+func NewKey(values ...any) Key {
+	return Key{values: slices.Clone(values)}
+}
+
+// KeyOf returns the key of item made of the given fields, in order.
+// Fields may be dotted paths into nested maps, as in [Options.PrimaryKeyNames].
+// The boolean result is false if item is not a map or lacks any of the
+// fields (or has a nil value for one), in which case the merger would treat
+// it as an item without a key.
+func KeyOf(item any, fields ...string) (Key, bool) {
+	mp, ok := item.(map[string]any)
+	if !ok || len(fields) == 0 {
+		return Key{}, false
+	}
+	values := make([]any, 0, len(fields))
+	for _, field := range fields {
+		val, exists := keyFieldValue(mp, field)
+		if !exists || val == nil {
+			return Key{}, false
+		}
+		values = append(values, val)
+	}
+	return Key{values: values}, true
+}
+
+// Values returns the key's field values.
+func (k Key) Values() []any {
+	return slices.Clone(k.values)
+}
+
+// String returns a string representation of the key for messages:
+// the value itself for single-field keys, or the list of values otherwise.
+func (k Key) String() string {
+	if len(k.values) == 1 {
+		return fmt.Sprintf("%v", k.values[0])
+	}
+	return fmt.Sprintf("%v", k.values)
+}
+
+// Equal reports whether two keys identify the same item. Values must have the
+// same types to be equal, so an int 1 and a string "1" differ, as when merging.
+// Keys that are not comparable (see [Key.Comparable]) are never equal.
+func (k Key) Equal(other Key) bool {
+	if !k.isComparable() || !other.isComparable() {
+		return false
+	}
+	return k.mapKey() == other.mapKey()
+}
+
+// Comparable reports whether all of the key's values are comparable, which
+// the merger requires of primary keys (maps and slices are not comparable).
+func (k Key) Comparable() bool {
+	return k.isComparable()
+}
+
+// isComparable checks if all values in the key are comparable.
+func (k *Key) isComparable() bool {
+	for _, v := range k.values {
+		if !isComparable(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// mapKey returns a value usable as a map key that is equal for equal keys.
+// Single values are used directly. Multiple values use a type-preserving
+// string representation (%#v) to avoid collisions between different types.
+func (k *Key) mapKey() any {
+	if len(k.values) == 1 {
+		return k.values[0]
+	}
+	return fmt.Sprintf("%#v", k.values)
+}
+
+// keyFieldValue returns the value of the primary key field name of item. A
+// name that is not a key of item but contains dots is followed as a path
+// through nested maps, so "metadata.name" reads the name in the item's
+// metadata while a literal "app.kubernetes.io/name" key still matches itself.
+func keyFieldValue(item any, name string) (any, bool) {
+	if val, ok := fieldValue(item, name); ok || !strings.Contains(name, ".") {
+		return val, ok
+	}
+	current := item
+	for part := range strings.SplitSeq(name, ".") {
+		var ok bool
+		if current, ok = fieldValue(current, part); !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestKey_Equal(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  keymerge.Key
+		equal bool
+	}{
+		{"same single", keymerge.NewKey("web"), keymerge.NewKey("web"), true},
+		{"different single", keymerge.NewKey("web"), keymerge.NewKey("api"), false},
+		{"type matters", keymerge.NewKey(1), keymerge.NewKey("1"), false},
+		{"same composite", keymerge.NewKey("us", "api"), keymerge.NewKey("us", "api"), true},
+		{"order matters", keymerge.NewKey("us", "api"), keymerge.NewKey("api", "us"), false},
+		{"composite types matter", keymerge.NewKey("us", 1), keymerge.NewKey("us", "1"), false},
+		{"different lengths", keymerge.NewKey("us"), keymerge.NewKey("us", "api"), false},
+		{"non-comparable", keymerge.NewKey([]any{1}), keymerge.NewKey([]any{1}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Equal(tt.b); got != tt.equal {
+				t.Errorf("Equal() = %v, want %v", got, tt.equal)
+			}
+		})
+	}
+}
+
+func TestKeyOf(t *testing.T) {
+	item := map[string]any{"region": "us", "name": "api", "url": "x", "empty": nil}
+
+	key, ok := keymerge.KeyOf(item, "region", "name")
+	if !ok {
+		t.Fatal("expected key")
+	}
+	if !key.Equal(keymerge.NewKey("us", "api")) {
+		t.Errorf("unexpected key %v", key)
+	}
+	if !reflect.DeepEqual(key.Values(), []any{"us", "api"}) {
+		t.Errorf("unexpected values %v", key.Values())
+	}
+	if key.String() != "[us api]" {
+		t.Errorf("unexpected string %q", key.String())
+	}
+
+	single, ok := keymerge.KeyOf(item, "name")
+	if !ok || single.String() != "api" {
+		t.Errorf("unexpected single key %v", single)
+	}
+
+	for _, fields := range [][]string{{"region", "missing"}, {"empty"}, {}} {
+		if _, ok := keymerge.KeyOf(item, fields...); ok {
+			t.Errorf("expected no key for fields %v", fields)
+		}
+	}
+	if _, ok := keymerge.KeyOf("scalar", "name"); ok {
+		t.Error("expected no key for non-map item")
+	}
+}
+
+func TestKey_Comparable(t *testing.T) {
+	if !keymerge.NewKey("a", 1).Comparable() {
+		t.Error("expected comparable key")
+	}
+	if keymerge.NewKey("a", map[string]any{}).Comparable() {
+		t.Error("expected non-comparable key")
+	}
+}
+
+func TestNewKey_CopiesValues(t *testing.T) {
+	values := []any{"a", "b"}
+	key := keymerge.NewKey(values...)
+	values[0] = "changed"
+	key.Values()[1] = "changed"
+	if !key.Equal(keymerge.NewKey("a", "b")) {
+		t.Errorf("key should not alias caller slices, got %v", key)
+	}
+}
+
+func TestKeyOf_NestedFields(t *testing.T) {
+	item := map[string]any{
+		"kind":                   "Pod",
+		"metadata":               map[string]any{"name": "web", "labels": map[string]any{"app": "shop"}},
+		"app.kubernetes.io/name": "literal",
+	}
+	key, ok := keymerge.KeyOf(item, "kind", "metadata.name", "metadata.labels.app")
+	if !ok || !key.Equal(keymerge.NewKey("Pod", "web", "shop")) {
+		t.Errorf("unexpected key %v, %v", key, ok)
+	}
+	// Keys containing dots match themselves first.
+	if key, ok := keymerge.KeyOf(item, "app.kubernetes.io/name"); !ok || key.String() != "literal" {
+		t.Errorf("unexpected key %v, %v", key, ok)
+	}
+	for _, field := range []string{"metadata.missing", "kind.name", "metadata..name"} {
+		if key, ok := keymerge.KeyOf(item, field); ok {
+			t.Errorf("expected no key for %q, got %v", field, key)
+		}
+	}
+}
+
+func TestMerge_NestedPrimaryKeys(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"metadata.name"}, DeleteMarkerKey: "_delete"}
+	base := map[string]any{"containers": []any{
+		map[string]any{"metadata": map[string]any{"name": "web", "labels": map[string]any{"tier": "front"}}, "image": "web:1"},
+		map[string]any{"metadata": map[string]any{"name": "debug"}},
+	}}
+	overlay := map[string]any{"containers": []any{
+		map[string]any{"metadata": map[string]any{"name": "debug"}, "_delete": true},
+		map[string]any{"metadata": map[string]any{"name": "web"}, "image": "web:2"},
+		map[string]any{"metadata": map[string]any{"name": "cache"}, "image": "redis"},
+	}}
+	result, err := keymerge.MergeUnstructured(opts, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"containers": []any{
+		map[string]any{"metadata": map[string]any{"name": "web", "labels": map[string]any{"tier": "front"}}, "image": "web:2"},
+		map[string]any{"metadata": map[string]any{"name": "cache"}, "image": "redis"},
+	}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("got %v, want %v", result, expected)
+	}
+
+	// Diffs repeat the nested key so that their items match.
+	desired := map[string]any{"containers": []any{
+		map[string]any{"metadata": map[string]any{"name": "web", "labels": map[string]any{"tier": "front"}}, "image": "web:3"},
+		map[string]any{"metadata": map[string]any{"name": "cache"}, "image": "redis"},
+	}}
+	diff, err := keymerge.Diff(opts, result, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedDiff := map[string]any{"containers": []any{
+		map[string]any{"metadata": map[string]any{"name": "web"}, "image": "web:3"},
+	}}
+	if !reflect.DeepEqual(diff, expectedDiff) {
+		t.Errorf("got diff %v, want %v", diff, expectedDiff)
+	}
+
+	changes, err := keymerge.Compare(opts, result, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Path != "containers[metadata.name=web].image" {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+}
@@ -0,0 +1,313 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrAmbiguousKey indicates a list item matched several items by different primary keys.
+var ErrAmbiguousKey = errors.New("ambiguous primary key")
+
+// AmbiguousKeyError is returned when [KeyMatchAny] is set and a list item
+// matches more than one existing item, each by a different primary key field,
+// e.g. one by "id" and another by "name".
+type AmbiguousKeyError struct {
+	// Position is the index of the item in its document's list.
+	Position int
+	// Matches maps each matching key field to the position of the item it
+	// matched in the merged list.
+	Matches map[string]int
+	// Path is where in the document the ambiguous item occurred.
+	Path []string
+	// DocIndex tells which document the error occurred.
+	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
+}
+
+func (e *AmbiguousKeyError) Error() string {
+	path := strings.Join(e.Path, ".")
+	if path == "" {
+		path = "(root)"
+	}
+	matches := make([]string, 0, len(e.Matches))
+	for field, pos := range e.Matches {
+		matches = append(matches, fmt.Sprintf("%s matches position %d", field, pos))
+	}
+	slices.Sort(matches)
+	return fmt.Sprintf("ambiguous primary key at path %s in document %d%s at position %d: %s",
+		path, e.DocIndex, nameSuffix(e.DocName), e.Position, strings.Join(matches, ", "))
+}
+
+func (e *AmbiguousKeyError) Is(target error) bool {
+	return target == ErrAmbiguousKey
+}
+
+// keyHit is an item found by one of its primary key fields.
+type keyHit struct {
+	field string
+	value any
+	pos   int
+}
+
+// keyIndex maps each primary key field, and each value it has, to the position
+// of the item with that value. It implements [KeyMatchAny].
+type keyIndex struct {
+	m         *UntypedMerger
+	positions map[string]map[any]int
+}
+
+func newKeyIndex(m *UntypedMerger) *keyIndex {
+	positions := make(map[string]map[any]int, len(m.opts.PrimaryKeyNames))
+	for _, field := range m.opts.PrimaryKeyNames {
+		positions[field] = make(map[any]int)
+	}
+	return &keyIndex{m: m, positions: positions}
+}
+
+// keys returns the primary key fields that item has, with their normalized
+// values (see [KeyNormalizer]). Fields set to nil are ignored. The item's
+// index must be pushed onto the merger's path.
+func (x *keyIndex) keys(item any) []keyHit {
+	if !isMap(item) {
+		return nil
+	}
+	var keys []keyHit
+	for _, field := range x.m.opts.PrimaryKeyNames {
+		val, exists := keyFieldValue(item, field)
+		if exists && val != nil && len(x.m.keyNormalizers) > 0 {
+			val = x.m.normalizeKey(val)
+		}
+		if exists && val != nil {
+			keys = append(keys, keyHit{field: field, value: val})
+		}
+	}
+	return keys
+}
+
+// find returns the indexed items that share a key value with item, one match
+// per distinct position, in the order of the key fields.
+func (x *keyIndex) find(item any) []keyHit {
+	var matches []keyHit
+	for _, key := range x.keys(item) {
+		pos, exists := x.positions[key.field][toMapKey(key.value)]
+		if !exists || containsPosition(matches, pos) {
+			continue
+		}
+		key.pos = pos
+		matches = append(matches, key)
+	}
+	return matches
+}
+
+func containsPosition(matches []keyHit, pos int) bool {
+	for _, match := range matches {
+		if match.pos == pos {
+			return true
+		}
+	}
+	return false
+}
+
+// add indexes item's key values at pos. If a value already belongs to another
+// item, it returns that item's position and the key.
+func (x *keyIndex) add(item any, pos int) (keyHit, bool) {
+	for _, key := range x.keys(item) {
+		mapKey := toMapKey(key.value)
+		if other, exists := x.positions[key.field][mapKey]; exists && other != pos {
+			key.pos = other
+			return key, false
+		}
+		x.positions[key.field][mapKey] = pos
+	}
+	return keyHit{}, true
+}
+
+// remove removes item's key values from the index.
+func (x *keyIndex) remove(item any, pos int) {
+	for _, key := range x.keys(item) {
+		mapKey := toMapKey(key.value)
+		if x.positions[key.field][mapKey] == pos {
+			delete(x.positions[key.field], mapKey)
+		}
+	}
+}
+
+// mergeSlicesAnyKey merges lists of objects like mergeSlices, except that items
+// match if any of the primary key fields match (see [KeyMatchAny]).
+func (m *UntypedMerger) mergeSlicesAnyKey(base, overlay []any, baseMode, objectMode DupeMode) ([]any, error) {
+	index := newKeyIndex(m)
+	result := make([]any, 0, len(base)+len(overlay))
+	deleted := make([]bool, 0, len(base)+len(overlay))
+
+	// mergeInto deep merges item into the result item at pos and reindexes it.
+	mergeInto := func(pos int, item any) error {
+		m.pop()                   // Pop current index before merging
+		m.push(strconv.Itoa(pos)) // Push existing index for merge
+		index.remove(result[pos], pos)
+		merged, err := m.mergeValues(result[pos], item)
+		if err != nil {
+			return err
+		}
+		result[pos] = merged
+		if other, ok := index.add(merged, pos); !ok {
+			return &DuplicatePrimaryKeyError{
+				Key:       keyString(other.value),
+				Positions: []int{other.pos, pos},
+				Path:      m.pathNames(),
+				DocIndex:  m.index,
+			}
+		}
+		return nil
+	}
+
+	// match finds the result item that item matches; its position is -1 if none.
+	match := func(i int, item any) (keyHit, error) {
+		for _, key := range index.keys(item) {
+			if !isKeyComparable(key.value) {
+				return keyHit{}, &NonComparablePrimaryKeyError{
+					Key:      keyString(key.value),
+					Position: i,
+					Path:     m.pathNames(),
+					DocIndex: m.index,
+				}
+			}
+		}
+		matches := index.find(item)
+		switch len(matches) {
+		case 0:
+			return keyHit{pos: -1}, nil
+		case 1:
+			return matches[0], nil
+		}
+		err := &AmbiguousKeyError{
+			Position: i,
+			Matches:  make(map[string]int, len(matches)),
+			Path:     m.pathNames(),
+			DocIndex: m.index,
+		}
+		for _, match := range matches {
+			err.Matches[match.field] = match.pos
+		}
+		return keyHit{}, err
+	}
+
+	appendItem := func(item any) {
+		index.add(item, len(result))
+		result = append(result, item)
+		deleted = append(deleted, false)
+	}
+
+	for i, item := range base {
+		m.push(strconv.Itoa(i))
+		found, err := match(i, item)
+		if err != nil {
+			return nil, err
+		}
+		if found.pos < 0 {
+			appendItem(item)
+			m.pop()
+			continue
+		}
+		if baseMode == DupeUnique {
+			err := &DuplicatePrimaryKeyError{
+				Key:       keyString(found.value),
+				Positions: []int{found.pos, i},
+				Path:      m.pathNames(),
+				DocIndex:  m.index,
+			}
+			m.pop()
+			return nil, err
+		}
+		// DupeConsolidate: merge into first occurrence
+		if err := mergeInto(found.pos, item); err != nil {
+			return nil, err
+		}
+		m.pop()
+	}
+
+	// claimed maps result positions to the overlay item that matched or added
+	// them, to detect duplicates within the overlay.
+	claimed := make(map[int]int, len(overlay))
+	for i, item := range overlay {
+		m.push(strconv.Itoa(i))
+		found, err := match(i, item)
+		if err != nil {
+			return nil, err
+		}
+
+		if m.isMarkedForDeletion(item) {
+			if found.pos >= 0 {
+				m.pop()
+				m.push(strconv.Itoa(found.pos))
+				if err := m.checkDelete(result[found.pos]); err != nil {
+					return nil, err
+				}
+				index.remove(result[found.pos], found.pos)
+				deleted[found.pos] = true
+			}
+			m.pop()
+			continue
+		}
+
+		if to, moved := m.moveDestination(item); moved {
+			if len(index.keys(item)) == 0 {
+				err := &MoveError{To: to, Reason: "moved items need a primary key", Path: m.pathNames(), DocIndex: m.index}
+				m.pop()
+				return nil, err
+			}
+			var existing any
+			if found.pos >= 0 {
+				existing = result[found.pos]
+				index.remove(existing, found.pos)
+				deleted[found.pos] = true
+				m.pop()
+				m.push(strconv.Itoa(found.pos))
+			}
+			err := m.takeMove(existing, item, to)
+			m.pop()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if found.pos < 0 {
+			if len(index.keys(item)) > 0 {
+				claimed[len(result)] = i
+			}
+			appendItem(m.dropNulls(item))
+			m.pop()
+			continue
+		}
+		if first, exists := claimed[found.pos]; exists && objectMode == DupeUnique {
+			err := &DuplicatePrimaryKeyError{
+				Key:       keyString(found.value),
+				Positions: []int{first, i},
+				Path:      m.pathNames(),
+				DocIndex:  m.index,
+			}
+			m.pop()
+			return nil, err
+		}
+		claimed[found.pos] = i
+		if err := mergeInto(found.pos, item); err != nil {
+			return nil, err
+		}
+		m.pop()
+	}
+
+	filtered := make([]any, 0, len(result))
+	for pos, item := range result {
+		if !deleted[pos] {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered, nil
+}
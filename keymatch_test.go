@@ -0,0 +1,183 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestKeyMatchAny(t *testing.T) {
+	opts := keymerge.Options{
+		PrimaryKeyNames: []string{"id", "name"},
+		DeleteMarkerKey: "_delete",
+		KeyMatchMode:    keymerge.KeyMatchAny,
+	}
+	// The base still identifies services by name; the overlay has moved to ids.
+	base := map[string]any{
+		"services": []any{
+			map[string]any{"name": "api", "port": 8080},
+			map[string]any{"name": "worker", "port": 9000},
+			map[string]any{"name": "debug"},
+			"unkeyed",
+		},
+	}
+	overlay := map[string]any{
+		"services": []any{
+			map[string]any{"id": 1, "name": "api", "port": 8081},
+			map[string]any{"id": 2, "name": "worker"},
+			map[string]any{"id": 3, "name": "cache"},
+			map[string]any{"name": "debug", "_delete": true},
+		},
+	}
+	second := map[string]any{
+		"services": []any{
+			map[string]any{"id": 1, "name": "gateway"}, // renamed, matched by id
+		},
+	}
+
+	result, err := keymerge.MergeUnstructured(opts, base, overlay, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]any{
+		"services": []any{
+			map[string]any{"id": 1, "name": "gateway", "port": 8081},
+			map[string]any{"id": 2, "name": "worker", "port": 9000},
+			"unkeyed",
+			map[string]any{"id": 3, "name": "cache"},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected result:\n got: %v\nwant: %v", result, expected)
+	}
+
+	// With the default mode, the overlay items have ids and so match nothing.
+	opts.KeyMatchMode = keymerge.KeyMatchFirst
+	result, err = keymerge.MergeUnstructured(opts, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if services := result.(map[string]any)["services"].([]any); len(services) != 6 {
+		t.Errorf("expected 6 services with KeyMatchFirst, got %v", services)
+	}
+}
+
+func TestKeyMatchAny_Ambiguous(t *testing.T) {
+	opts := keymerge.Options{
+		PrimaryKeyNames: []string{"id", "name"},
+		KeyMatchMode:    keymerge.KeyMatchAny,
+	}
+	base := map[string]any{
+		"services": []any{
+			map[string]any{"id": 1, "name": "api"},
+			map[string]any{"id": 2, "name": "worker"},
+		},
+	}
+	overlay := map[string]any{
+		"services": []any{
+			map[string]any{"id": 1, "name": "worker"},
+		},
+	}
+
+	_, err := keymerge.MergeUnstructured(opts, base, overlay)
+	if !errors.Is(err, keymerge.ErrAmbiguousKey) {
+		t.Fatalf("expected ErrAmbiguousKey, got %v", err)
+	}
+	var ambErr *keymerge.AmbiguousKeyError
+	if !errors.As(err, &ambErr) {
+		t.Fatalf("expected AmbiguousKeyError, got %T: %v", err, err)
+	}
+	if ambErr.Position != 0 || ambErr.DocIndex != 1 {
+		t.Errorf("unexpected position %d or document %d", ambErr.Position, ambErr.DocIndex)
+	}
+	if !reflect.DeepEqual(ambErr.Matches, map[string]int{"id": 0, "name": 1}) {
+		t.Errorf("unexpected matches %v", ambErr.Matches)
+	}
+	if !slices.Equal(ambErr.Path, []string{"services", "0"}) {
+		t.Errorf("unexpected path %v", ambErr.Path)
+	}
+	want := "ambiguous primary key at path services.0 in document 1 at position 0: " +
+		"id matches position 0, name matches position 1"
+	if err.Error() != want {
+		t.Errorf("unexpected message:\n got: %s\nwant: %s", err, want)
+	}
+}
+
+func TestKeyMatchAny_Duplicates(t *testing.T) {
+	opts := keymerge.Options{
+		PrimaryKeyNames: []string{"id", "name"},
+		KeyMatchMode:    keymerge.KeyMatchAny,
+	}
+
+	// Items sharing any key field are duplicates.
+	base := map[string]any{
+		"services": []any{
+			map[string]any{"id": 1, "name": "api"},
+			map[string]any{"name": "api", "port": 8080},
+		},
+	}
+	other := map[string]any{"services": []any{map[string]any{"name": "other"}}}
+	_, err := keymerge.MergeUnstructured(opts, base, other)
+	var dupErr *keymerge.DuplicatePrimaryKeyError
+	if !errors.As(err, &dupErr) || !slices.Equal(dupErr.Positions, []int{0, 1}) {
+		t.Fatalf("expected duplicate key error at positions [0 1], got %v", err)
+	}
+
+	// Overlay items matching the same item are duplicates too.
+	overlay := map[string]any{
+		"services": []any{
+			map[string]any{"id": 1},
+			map[string]any{"name": "api"},
+		},
+	}
+	base = map[string]any{"services": []any{map[string]any{"id": 1, "name": "api"}}}
+	_, err = keymerge.MergeUnstructured(opts, base, overlay)
+	if !errors.As(err, &dupErr) || !slices.Equal(dupErr.Positions, []int{0, 1}) {
+		t.Fatalf("expected duplicate key error at positions [0 1], got %v", err)
+	}
+
+	// DupeConsolidate merges them instead.
+	opts.DupeMode = keymerge.DupeConsolidate
+	base = map[string]any{
+		"services": []any{
+			map[string]any{"id": 1, "name": "api"},
+			map[string]any{"name": "api", "port": 8080},
+		},
+	}
+	result, err := keymerge.MergeUnstructured(opts, base, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{
+		"services": []any{
+			map[string]any{"id": 1, "name": "api", "port": 8080},
+			map[string]any{"name": "other"},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected result:\n got: %v\nwant: %v", result, expected)
+	}
+}
+
+func TestKeyMatchMode_String(t *testing.T) {
+	tests := []struct {
+		mode keymerge.KeyMatchMode
+		want string
+	}{
+		{keymerge.KeyMatchFirst, "KeyMatchFirst"},
+		{keymerge.KeyMatchAny, "KeyMatchAny"},
+		{keymerge.KeyMatchMode(99), "KeyMatchMode(99)"}, // Invalid value
+	}
+
+	for _, tt := range tests {
+		if got := tt.mode.String(); got != tt.want {
+			t.Errorf("%v.String() = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
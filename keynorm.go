@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KeyNormalizer canonicalizes the primary key values of the items of matching
+// lists before they are matched, so that near-identical identifiers from
+// different systems (e.g. "Web" and "web") identify the same item.
+// Items keep their original key values; only matching uses normalized ones.
+type KeyNormalizer struct {
+	// Path is a path pattern (see [Grant]) addressing the lists to normalize,
+	// e.g. "services", "clusters[*].nodes", or "**.hosts". Patterns may not
+	// contain selectors.
+	Path string
+	// Normalize returns the canonical form of a key value. It is called with each
+	// field of a composite key in turn. It must return a comparable value, or nil
+	// to treat the item as having no key.
+	Normalize func(value any) any
+}
+
+// compiledNormalizer is a [KeyNormalizer] with a parsed path pattern.
+type compiledNormalizer struct {
+	pattern   []pathStep
+	normalize func(any) any
+}
+
+// SetKeyNormalizers sets how primary key values are normalized in subsequent
+// merges. For each list, the first normalizer whose pattern matches the list's
+// path applies; lists that match none are compared by their key values as they
+// are. Passing no normalizers removes all normalization.
+//
+// Normalization applies wherever this merger matches list items by primary key,
+// including [UntypedMerger.Compare] and [UntypedMerger.MergeThreeWay], but not to
+// selectors in path expressions, which match the values in the items.
+//
+// Returns an error wrapping [ErrInvalidPath] if a pattern cannot be parsed or
+// contains a selector.
+//
+// Example:
+//
+//	err := merger.SetKeyNormalizers([]keymerge.KeyNormalizer{
+//		{Path: "hosts", Normalize: keymerge.TrimKeySuffix(".example.com")},
+//		{Path: "users", Normalize: keymerge.LowercaseKey},
+//	})
+func (m *UntypedMerger) SetKeyNormalizers(normalizers []KeyNormalizer) error {
+	compiled := make([]compiledNormalizer, 0, len(normalizers))
+	for _, n := range normalizers {
+		pattern, err := parsePattern(n.Path)
+		if err != nil {
+			return err
+		}
+		for _, step := range pattern {
+			if step.kind == stepSelect {
+				return fmt.Errorf("%w %q: key normalizer patterns cannot contain selectors", ErrInvalidPath, n.Path)
+			}
+		}
+		if n.Normalize == nil {
+			return fmt.Errorf("%w: nil Normalize for key normalizer %q", ErrInvalidOptions, n.Path)
+		}
+		compiled = append(compiled, compiledNormalizer{pattern: pattern, normalize: n.Normalize})
+	}
+	if len(compiled) == 0 {
+		compiled = nil
+	}
+	m.keyNormalizers = compiled
+	return nil
+}
+
+// normalizeKey normalizes a primary key of an item in the list at the current
+// path, whose top is the item's index.
+func (m *UntypedMerger) normalizeKey(key any) any {
+	normalize := m.keyNormalizer()
+	if normalize == nil {
+		return key
+	}
+	composite, ok := key.(*Key)
+	if !ok {
+		return normalize(key)
+	}
+	values := make([]any, len(composite.values))
+	for i, value := range composite.values {
+		if values[i] = normalize(value); values[i] == nil {
+			return nil
+		}
+	}
+	return &Key{values: values}
+}
+
+// keyNormalizer returns the normalize function for the list containing the
+// item at the current path, or nil if no normalizer applies.
+func (m *UntypedMerger) keyNormalizer() func(any) any {
+	if len(m.path) == 0 {
+		return nil
+	}
+	listPath := m.path[:len(m.path)-1]
+	for _, n := range m.keyNormalizers {
+		if matchesSegments(n.pattern, listPath) {
+			return n.normalize
+		}
+	}
+	return nil
+}
+
+// matchesSegments reports whether pattern matches exactly the merger path
+// segments, whose names are map keys or list positions.
+func matchesSegments(pattern []pathStep, segments []pathSegment) bool {
+	for i, step := range pattern {
+		if step.kind == stepRecursive {
+			for j := i; j <= len(segments); j++ {
+				if matchesSegments(pattern[i+1:], segments[j:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if i >= len(segments) {
+			return false
+		}
+		switch step.kind {
+		case stepField:
+			if segments[i].name != step.field {
+				return false
+			}
+		case stepIndex:
+			if segments[i].name != strconv.Itoa(step.index) {
+				return false
+			}
+		}
+	}
+	return len(pattern) == len(segments)
+}
+
+// LowercaseKey is a [KeyNormalizer] function that matches string keys
+// regardless of case. Other values are returned unchanged.
+func LowercaseKey(value any) any {
+	if s, ok := value.(string); ok {
+		return strings.ToLower(s)
+	}
+	return value
+}
+
+// TrimKeySuffix returns a [KeyNormalizer] function that removes suffix from
+// string keys, e.g. a domain such as ".example.com", so that "web" and
+// "web.example.com" match. Other values are returned unchanged.
+func TrimKeySuffix(suffix string) func(any) any {
+	return func(value any) any {
+		if s, ok := value.(string); ok {
+			return strings.TrimSuffix(s, suffix)
+		}
+		return value
+	}
+}
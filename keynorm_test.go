@@ -0,0 +1,212 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestSetKeyNormalizers(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{PrimaryKeyNames: []string{"name"}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	majorVersion := func(value any) any {
+		s, _ := value.(string)
+		major, _, _ := strings.Cut(s, ".")
+		return major
+	}
+	err = merger.SetKeyNormalizers([]keymerge.KeyNormalizer{
+		{Path: "hosts", Normalize: keymerge.TrimKeySuffix(".example.com")},
+		{Path: "clusters[*].users", Normalize: keymerge.LowercaseKey},
+		{Path: "apis", Normalize: majorVersion},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := map[string]any{
+		"hosts": []any{map[string]any{"name": "web.example.com", "port": 80}},
+		"clusters": []any{
+			map[string]any{"name": "east", "users": []any{map[string]any{"name": "Alice", "role": "user"}}},
+		},
+		"apis":  []any{map[string]any{"name": "v1.2", "path": "/v1"}},
+		"users": []any{map[string]any{"name": "Bob"}},
+	}
+	overlay := map[string]any{
+		"hosts": []any{map[string]any{"name": "web", "port": 8080}},
+		"clusters": []any{
+			map[string]any{"name": "east", "users": []any{map[string]any{"name": "alice", "role": "admin"}}},
+		},
+		"apis":  []any{map[string]any{"name": "v1.3"}, map[string]any{"name": "v2.0", "path": "/v2"}},
+		"users": []any{map[string]any{"name": "bob"}}, // not normalized
+	}
+
+	result, err := merger.MergeUnstructured(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Matched items keep the overlay's key values, as for any other field.
+	expected := map[string]any{
+		"hosts": []any{map[string]any{"name": "web", "port": 8080}},
+		"clusters": []any{
+			map[string]any{"name": "east", "users": []any{map[string]any{"name": "alice", "role": "admin"}}},
+		},
+		"apis": []any{
+			map[string]any{"name": "v1.3", "path": "/v1"},
+			map[string]any{"name": "v2.0", "path": "/v2"},
+		},
+		"users": []any{map[string]any{"name": "Bob"}, map[string]any{"name": "bob"}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected result:\n got: %v\nwant: %v", result, expected)
+	}
+
+	// Normalized keys can collide.
+	_, err = merger.MergeUnstructured(base, map[string]any{
+		"hosts": []any{map[string]any{"name": "db"}, map[string]any{"name": "db.example.com"}},
+	})
+	if !errors.Is(err, keymerge.ErrDuplicatePrimaryKey) {
+		t.Errorf("expected ErrDuplicatePrimaryKey, got %v", err)
+	}
+
+	// Removing the normalizers restores exact matching.
+	if err := merger.SetKeyNormalizers(nil); err != nil {
+		t.Fatal(err)
+	}
+	result, err = merger.MergeUnstructured(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hosts := result.(map[string]any)["hosts"].([]any); len(hosts) != 2 {
+		t.Errorf("expected unmatched hosts without normalizers, got %v", hosts)
+	}
+}
+
+func TestSetKeyNormalizers_CompositeKeys(t *testing.T) {
+	type Route struct {
+		Host string `json:"host" km:"primary"`
+		Path string `json:"path" km:"primary"`
+		Port int    `json:"port"`
+	}
+	type Config struct {
+		Routes []Route `json:"routes"`
+	}
+
+	tree, err := keymerge.MetadataOf[Config]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger.SetMetadata(tree)
+	if err := merger.SetKeyNormalizers([]keymerge.KeyNormalizer{{Path: "routes", Normalize: keymerge.LowercaseKey}}); err != nil {
+		t.Fatal(err)
+	}
+
+	base := map[string]any{"routes": []any{map[string]any{"host": "Example.com", "path": "/API", "port": 80}}}
+	overlay := map[string]any{"routes": []any{map[string]any{"host": "example.com", "path": "/api", "port": 8080}}}
+	result, err := merger.MergeUnstructured(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"routes": []any{map[string]any{"host": "example.com", "path": "/api", "port": 8080}}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected result:\n got: %v\nwant: %v", result, expected)
+	}
+}
+
+func TestSetKeyNormalizers_KeyMatchAny(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{
+		PrimaryKeyNames: []string{"id", "name"},
+		KeyMatchMode:    keymerge.KeyMatchAny,
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := merger.SetKeyNormalizers([]keymerge.KeyNormalizer{{Path: "services", Normalize: keymerge.LowercaseKey}}); err != nil {
+		t.Fatal(err)
+	}
+
+	base := map[string]any{"services": []any{map[string]any{"name": "API", "port": 80}}}
+	overlay := map[string]any{"services": []any{map[string]any{"id": "svc-1", "name": "api"}}}
+	result, err := merger.MergeUnstructured(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"services": []any{map[string]any{"id": "svc-1", "name": "api", "port": 80}}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected result:\n got: %v\nwant: %v", result, expected)
+	}
+}
+
+func TestSetKeyNormalizers_Invalid(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		normalizer keymerge.KeyNormalizer
+		want       error
+	}{
+		{keymerge.KeyNormalizer{Path: "services[", Normalize: keymerge.LowercaseKey}, keymerge.ErrInvalidPath},
+		{keymerge.KeyNormalizer{Path: "services[name=web].ports", Normalize: keymerge.LowercaseKey}, keymerge.ErrInvalidPath},
+		{keymerge.KeyNormalizer{Path: "services"}, keymerge.ErrInvalidOptions},
+	}
+	for _, tt := range tests {
+		if err := merger.SetKeyNormalizers([]keymerge.KeyNormalizer{tt.normalizer}); !errors.Is(err, tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.normalizer.Path, tt.want, err)
+		}
+	}
+}
+
+func TestSetKeyNormalizers_RecursiveWildcard(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{PrimaryKeyNames: []string{"name"}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = merger.SetKeyNormalizers([]keymerge.KeyNormalizer{{Path: "**.env", Normalize: keymerge.LowercaseKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := map[string]any{
+		"env": []any{map[string]any{"name": "A", "value": "1"}},
+		"spec": map[string]any{"containers": []any{
+			map[string]any{"name": "web", "env": []any{map[string]any{"name": "B", "value": "2"}}},
+		}},
+	}
+	overlay := map[string]any{
+		"env": []any{map[string]any{"name": "a", "value": "10"}},
+		"spec": map[string]any{"containers": []any{
+			map[string]any{"name": "web", "env": []any{map[string]any{"name": "b", "value": "20"}}},
+		}},
+	}
+	result, err := merger.MergeUnstructured(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, overlay) {
+		t.Errorf("expected env lists at every depth to match case-insensitively, got %v", result)
+	}
+
+	// Other lists are not normalized.
+	result, err = merger.MergeUnstructured(
+		map[string]any{"hosts": []any{map[string]any{"name": "A"}}},
+		map[string]any{"hosts": []any{map[string]any{"name": "a"}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hosts := result.(map[string]any)["hosts"].([]any); len(hosts) != 2 {
+		t.Errorf("expected hosts not to be normalized, got %v", hosts)
+	}
+}
@@ -0,0 +1,205 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// KubernetesSchema holds merge rules for the kinds of a Kubernetes OpenAPI
+// document, such as the output of "kubectl get --raw /openapi/v2", so that
+// whole manifests merge like strategic merge patches: list items merge by
+// their patch merge keys (containers and env vars by name, ports by port
+// number), and lists without a merge strategy are replaced.
+//
+// A KubernetesSchema is safe for concurrent use.
+//
+// Example:
+//
+//	f, err := os.Open("swagger.json")
+//	if err != nil {
+//		return err
+//	}
+//	defer f.Close()
+//	schema, err := keymerge.LoadKubernetesSchema(f, json.Unmarshal)
+//	if err != nil {
+//		return err
+//	}
+//	merger, _ := keymerge.NewUntypedMerger(opts, yaml.Unmarshal, yaml.Marshal)
+//	merger.SetStreamMetadata(schema.MetadataFor)
+//	merged, err := merger.MergeStreams([]string{"apiVersion", "kind", "metadata.name"}, base, overlay)
+type KubernetesSchema struct {
+	kinds map[kubernetesKind]MetadataTree
+}
+
+// kubernetesKind identifies the schema of a Kubernetes object.
+type kubernetesKind struct {
+	apiVersion, kind string
+}
+
+// LoadKubernetesSchema reads a Kubernetes OpenAPI v2 or v3 document, decoding it
+// with unmarshal, into a [KubernetesSchema] with rules for every kind it
+// defines, i.e. every definition with "x-kubernetes-group-version-kind".
+//
+// The rules of a list follow its "x-kubernetes-patch-strategy": "merge" with
+// an "x-kubernetes-patch-merge-key" makes the key its primary key, and "merge"
+// without one dedups its values. Lists without a merge strategy follow their
+// "x-kubernetes-list-type": "map" lists are keyed by their
+// "x-kubernetes-list-map-keys", "set" lists are deduped, and other lists are
+// replaced, as strategic merge patches replace them. Objects with
+// "x-kubernetes-map-type: atomic" or the "replace" patch strategy are replaced
+// too. The "retainKeys" strategy is not applied; such objects merge as usual.
+//
+// Returns an error wrapping [ErrInvalidOptions] for documents without
+// definitions or with unresolvable references.
+func LoadKubernetesSchema(r io.Reader, unmarshal func([]byte, any) error) (*KubernetesSchema, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	// OpenAPI v3 documents wrap references to add defaults
+	inlineSingleAllOf(doc)
+
+	prefix := "#/definitions/"
+	definitions, ok := doc["definitions"].(map[string]any)
+	if !ok {
+		components, _ := doc["components"].(map[string]any)
+		if definitions, ok = components["schemas"].(map[string]any); !ok {
+			return nil, fmt.Errorf("%w: no definitions or components.schemas in schema", ErrInvalidOptions)
+		}
+		prefix = "#/components/schemas/"
+	}
+
+	s := &KubernetesSchema{kinds: make(map[kubernetesKind]MetadataTree)}
+	for _, name := range sortedKeys(definitions) {
+		definition, ok := definitions[name].(map[string]any)
+		if !ok {
+			continue
+		}
+		kinds := definitionKinds(definition)
+		if len(kinds) == 0 {
+			continue
+		}
+		ref := prefix + strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+		loader := schemaLoader{
+			root:       doc,
+			rules:      NewRuleSet(),
+			visiting:   map[string]bool{ref: true},
+			directives: kubernetesDirectives,
+		}
+		if err := loader.loadProperties("", definition); err != nil {
+			return nil, fmt.Errorf("definition %s: %w", name, err)
+		}
+		tree, err := loader.rules.Build()
+		if err != nil {
+			return nil, fmt.Errorf("definition %s: %w", name, err)
+		}
+		for _, kind := range kinds {
+			s.kinds[kind] = tree
+		}
+	}
+	return s, nil
+}
+
+// Metadata returns the merge rules of objects of a kind, e.g. "apps/v1" and
+// "Deployment". The boolean result is false if the schema does not define the
+// kind.
+func (s *KubernetesSchema) Metadata(apiVersion, kind string) (MetadataTree, bool) {
+	tree, ok := s.kinds[kubernetesKind{apiVersion: apiVersion, kind: kind}]
+	return tree, ok
+}
+
+// MetadataFor returns the merge rules for a manifest by its "apiVersion" and
+// "kind", or the zero [MetadataTree] if the schema does not define its kind.
+// It suits [UntypedMerger.SetStreamMetadata].
+func (s *KubernetesSchema) MetadataFor(doc any) MetadataTree {
+	fields, _ := Unordered(doc).(map[string]any)
+	apiVersion, _ := fields["apiVersion"].(string)
+	kind, _ := fields["kind"].(string)
+	tree, _ := s.Metadata(apiVersion, kind)
+	return tree
+}
+
+// definitionKinds returns the kinds of a definition's
+// "x-kubernetes-group-version-kind".
+func definitionKinds(definition map[string]any) []kubernetesKind {
+	gvks, _ := definition["x-kubernetes-group-version-kind"].([]any)
+	var kinds []kubernetesKind
+	for _, gvk := range gvks {
+		fields, ok := gvk.(map[string]any)
+		if !ok {
+			continue
+		}
+		group, _ := fields["group"].(string)
+		version, _ := fields["version"].(string)
+		kind, _ := fields["kind"].(string)
+		if version == "" || kind == "" {
+			continue
+		}
+		if group != "" {
+			version = group + "/" + version
+		}
+		kinds = append(kinds, kubernetesKind{apiVersion: version, kind: kind})
+	}
+	return kinds
+}
+
+// kubernetesDirectives returns the merge directives of a property's schema from
+// its Kubernetes patch strategy and list or map type, for schemaLoader.
+func kubernetesDirectives(schema, _ map[string]any) map[string]any {
+	directives := make(map[string]any)
+	strategy, _ := schema["x-kubernetes-patch-strategy"].(string)
+	strategies := strings.Split(strategy, ",")
+	if !isArraySchema(schema) {
+		if slices.Contains(strategies, "replace") || schema["x-kubernetes-map-type"] == "atomic" {
+			directives["replace"] = true
+		}
+		return directives
+	}
+	merge := slices.Contains(strategies, "merge")
+	mergeKey, _ := schema["x-kubernetes-patch-merge-key"].(string)
+	listType, _ := schema["x-kubernetes-list-type"].(string)
+	mapKeys, hasMapKeys := schema["x-kubernetes-list-map-keys"]
+	switch {
+	case merge && mergeKey != "":
+		directives["keys"] = []any{mergeKey}
+	case merge:
+		directives["mode"] = "dedup"
+	case listType == "map" && hasMapKeys:
+		directives["keys"] = mapKeys
+	case listType == "set":
+		directives["mode"] = "dedup"
+	default:
+		// Strategic merge patches replace lists without a merge strategy
+		directives["replace"] = true
+	}
+	return directives
+}
+
+// inlineSingleAllOf replaces "allOf" keywords holding a single reference, as
+// OpenAPI v3 uses to give referenced schemas defaults, with the reference.
+func inlineSingleAllOf(value any) {
+	switch value := value.(type) {
+	case map[string]any:
+		if allOf, ok := value["allOf"].([]any); ok && len(allOf) == 1 && value["$ref"] == nil {
+			if sub, ok := allOf[0].(map[string]any); ok && len(sub) == 1 && sub["$ref"] != nil {
+				value["$ref"] = sub["$ref"]
+				delete(value, "allOf")
+			}
+		}
+		for _, v := range value {
+			inlineSingleAllOf(v)
+		}
+	case []any:
+		for _, v := range value {
+			inlineSingleAllOf(v)
+		}
+	}
+}
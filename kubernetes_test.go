@@ -0,0 +1,280 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// kubernetesSwagger is a trimmed Kubernetes OpenAPI v2 document.
+const kubernetesSwagger = `{
+  "swagger": "2.0",
+  "definitions": {
+    "io.k8s.api.apps.v1.Deployment": {
+      "type": "object",
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "spec": {"$ref": "#/definitions/io.k8s.api.apps.v1.DeploymentSpec"}
+      },
+      "x-kubernetes-group-version-kind": [{"group": "apps", "kind": "Deployment", "version": "v1"}]
+    },
+    "io.k8s.api.apps.v1.DeploymentSpec": {
+      "type": "object",
+      "properties": {
+        "replicas": {"type": "integer"},
+        "template": {
+          "type": "object",
+          "properties": {"spec": {"$ref": "#/definitions/io.k8s.api.core.v1.PodSpec"}}
+        }
+      }
+    },
+    "io.k8s.api.core.v1.PodSpec": {
+      "type": "object",
+      "properties": {
+        "containers": {
+          "type": "array",
+          "items": {"$ref": "#/definitions/io.k8s.api.core.v1.Container"},
+          "x-kubernetes-patch-merge-key": "name",
+          "x-kubernetes-patch-strategy": "merge"
+        },
+        "nodeSelector": {"type": "object", "x-kubernetes-map-type": "atomic"}
+      }
+    },
+    "io.k8s.api.core.v1.Container": {
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "image": {"type": "string"},
+        "args": {"type": "array", "items": {"type": "string"}},
+        "env": {
+          "type": "array",
+          "items": {"$ref": "#/definitions/io.k8s.api.core.v1.EnvVar"},
+          "x-kubernetes-patch-merge-key": "name",
+          "x-kubernetes-patch-strategy": "merge"
+        },
+        "ports": {
+          "type": "array",
+          "items": {"type": "object", "properties": {"containerPort": {"type": "integer"}, "protocol": {"type": "string"}}},
+          "x-kubernetes-list-map-keys": ["containerPort", "protocol"],
+          "x-kubernetes-list-type": "map"
+        }
+      }
+    },
+    "io.k8s.api.core.v1.EnvVar": {
+      "type": "object",
+      "properties": {"name": {"type": "string"}, "value": {"type": "string"}}
+    },
+    "io.k8s.api.core.v1.ConfigMap": {
+      "type": "object",
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "data": {"type": "object", "additionalProperties": {"type": "string"}}
+      },
+      "x-kubernetes-group-version-kind": [{"group": "", "kind": "ConfigMap", "version": "v1"}]
+    },
+    "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "labels": {"type": "object", "additionalProperties": {"type": "string"}},
+        "finalizers": {"type": "array", "items": {"type": "string"}, "x-kubernetes-patch-strategy": "merge"}
+      }
+    }
+  }
+}`
+
+func TestKubernetesSchema(t *testing.T) {
+	schema, err := keymerge.LoadKubernetesSchema(strings.NewReader(kubernetesSwagger), json.Unmarshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := schema.Metadata("apps/v1", "Deployment"); !ok {
+		t.Error("Deployment not found")
+	}
+	if _, ok := schema.Metadata("v1", "ConfigMap"); !ok {
+		t.Error("ConfigMap not found")
+	}
+	if _, ok := schema.Metadata("v1", "PodSpec"); ok {
+		t.Error("definitions without a kind should not be found")
+	}
+
+	base := map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]any{"name": "web", "finalizers": []any{"a"}},
+		"spec": map[string]any{"template": map[string]any{"spec": map[string]any{
+			"nodeSelector": map[string]any{"disk": "ssd", "zone": "a"},
+			"containers": []any{
+				map[string]any{
+					"name": "app", "image": "app:1", "args": []any{"--verbose", "--port=80"},
+					"env":   []any{map[string]any{"name": "LOG", "value": "info"}},
+					"ports": []any{map[string]any{"containerPort": 80, "protocol": "TCP"}},
+				},
+				map[string]any{"name": "sidecar", "image": "proxy:1"},
+			},
+		}}},
+	}
+	overlay := map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]any{"name": "web", "finalizers": []any{"a", "b"}},
+		"spec": map[string]any{"template": map[string]any{"spec": map[string]any{
+			"nodeSelector": map[string]any{"zone": "b"},
+			"containers": []any{
+				map[string]any{
+					"name": "app", "image": "app:2", "args": []any{"--port=8080"},
+					"env": []any{
+						map[string]any{"name": "LOG", "value": "debug"},
+						map[string]any{"name": "MODE", "value": "prod"},
+					},
+					"ports": []any{map[string]any{"containerPort": 80, "protocol": "UDP"}},
+				},
+			},
+		}}},
+	}
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger.SetMetadata(schema.MetadataFor(base))
+	result, err := merger.MergeUnstructured(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]any{"name": "web", "finalizers": []any{"a", "b"}},
+		"spec": map[string]any{"template": map[string]any{"spec": map[string]any{
+			"nodeSelector": map[string]any{"zone": "b"},
+			"containers": []any{
+				map[string]any{
+					"name": "app", "image": "app:2", "args": []any{"--port=8080"},
+					"env": []any{
+						map[string]any{"name": "LOG", "value": "debug"},
+						map[string]any{"name": "MODE", "value": "prod"},
+					},
+					"ports": []any{
+						map[string]any{"containerPort": 80, "protocol": "TCP"},
+						map[string]any{"containerPort": 80, "protocol": "UDP"},
+					},
+				},
+				map[string]any{"name": "sidecar", "image": "proxy:1"},
+			},
+		}}},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("got %v\nwant %v", result, want)
+	}
+}
+
+func TestKubernetesSchema_Streams(t *testing.T) {
+	schema, err := keymerge.LoadKubernetesSchema(strings.NewReader(kubernetesSwagger), json.Unmarshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger.SetStreamMetadata(schema.MetadataFor)
+	deployment := func(image string) map[string]any {
+		return map[string]any{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]any{"name": "web"},
+			"spec": map[string]any{"template": map[string]any{"spec": map[string]any{
+				"containers": []any{map[string]any{"name": "app", "image": image}},
+			}}},
+		}
+	}
+	unknown := func(items ...any) map[string]any {
+		return map[string]any{
+			"apiVersion": "example.com/v1", "kind": "Widget", "metadata": map[string]any{"name": "w"}, "items": items,
+		}
+	}
+	result, err := merger.MergeStreams([]string{"apiVersion", "kind", "metadata.name"},
+		[]any{deployment("app:1"), unknown("a")},
+		[]any{deployment("app:2"), unknown("b")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []any{deployment("app:2"), unknown("a", "b")}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("got %v\nwant %v", result, want)
+	}
+}
+
+func TestLoadKubernetesSchema_OpenAPIv3(t *testing.T) {
+	const doc = `{
+  "openapi": "3.0.0",
+  "components": {"schemas": {
+    "io.k8s.api.core.v1.Pod": {
+      "type": "object",
+      "properties": {"spec": {"allOf": [{"$ref": "#/components/schemas/io.k8s.api.core.v1.PodSpec"}], "default": {}}},
+      "x-kubernetes-group-version-kind": [{"group": "", "kind": "Pod", "version": "v1"}]
+    },
+    "io.k8s.api.core.v1.PodSpec": {
+      "type": "object",
+      "properties": {"volumes": {
+        "type": "array",
+        "items": {"type": "object", "properties": {"name": {"type": "string"}, "path": {"type": "string"}}},
+        "x-kubernetes-patch-merge-key": "name",
+        "x-kubernetes-patch-strategy": "merge,retainKeys"
+      }}
+    }
+  }}
+}`
+	schema, err := keymerge.LoadKubernetesSchema(strings.NewReader(doc), json.Unmarshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, ok := schema.Metadata("v1", "Pod")
+	if !ok {
+		t.Fatal("Pod not found")
+	}
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger.SetMetadata(tree)
+	result, err := merger.MergeUnstructured(
+		map[string]any{"spec": map[string]any{"volumes": []any{map[string]any{"name": "data", "path": "/a"}}}},
+		map[string]any{"spec": map[string]any{"volumes": []any{map[string]any{"name": "data", "path": "/b"}}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"spec": map[string]any{"volumes": []any{map[string]any{"name": "data", "path": "/b"}}}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+}
+
+func TestLoadKubernetesSchema_Errors(t *testing.T) {
+	for name, doc := range map[string]string{
+		"no definitions": `{"swagger": "2.0"}`,
+		"unresolved reference": `{"definitions": {"io.k8s.api.core.v1.Pod": {
+			"properties": {"spec": {"$ref": "#/definitions/missing"}},
+			"x-kubernetes-group-version-kind": [{"group": "", "kind": "Pod", "version": "v1"}]
+		}}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := keymerge.LoadKubernetesSchema(strings.NewReader(doc), json.Unmarshal)
+			if !errors.Is(err, keymerge.ErrInvalidOptions) {
+				t.Errorf("expected ErrInvalidOptions, got %v", err)
+			}
+		})
+	}
+}
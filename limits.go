@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrLimitExceeded indicates a document or merge exceeded one of the merger's [Limits].
+	ErrLimitExceeded = errors.New("limit exceeded")
+	// ErrCyclicDocument indicates a document refers to itself, e.g. a map containing itself.
+	ErrCyclicDocument = errors.New("cyclic document")
+)
+
+// Limits bounds the resources a merge may use, so that documents from untrusted
+// sources (such as customer-supplied overlays) cannot exhaust memory or CPU.
+// A zero field means no limit. See [SandboxLimits] for recommended values.
+type Limits struct {
+	// MaxDepth is the maximum nesting depth of maps and lists in each document.
+	// A document that is a scalar has depth 0; a map of scalars has depth 1.
+	MaxDepth int
+	// MaxValues is the maximum number of values in each document, counting
+	// every map, list, map entry, and list item.
+	MaxValues int
+	// MaxBytes is the maximum size of each byte document passed to [UntypedMerger.Merge].
+	// It is checked before the document is unmarshaled.
+	MaxBytes int
+	// Timeout is the maximum wall-clock time for a merge operation.
+	Timeout time.Duration
+}
+
+// SandboxLimits returns limits suitable for merging untrusted overlays onto
+// trusted bases: 64 levels of nesting, one million values and 16 MiB per
+// document, and 10 seconds per merge.
+func SandboxLimits() Limits {
+	return Limits{
+		MaxDepth:  64,
+		MaxValues: 1_000_000,
+		MaxBytes:  16 << 20,
+		Timeout:   10 * time.Second,
+	}
+}
+
+// LimitError is returned when a document or merge exceeds one of the merger's [Limits].
+type LimitError struct {
+	// Limit names the exceeded limit: "MaxDepth", "MaxValues", "MaxBytes", or "Timeout".
+	Limit string
+	// DocIndex tells which document exceeded the limit.
+	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
+	// Path is where in the document the limit was exceeded (nil for "MaxBytes").
+	Path []string
+}
+
+func (e *LimitError) Error() string {
+	if len(e.Path) == 0 {
+		return fmt.Sprintf("document at position %d%s exceeds %s", e.DocIndex, nameSuffix(e.DocName), e.Limit)
+	}
+	return fmt.Sprintf("document at position %d%s exceeds %s at %s",
+		e.DocIndex, nameSuffix(e.DocName), e.Limit, strings.Join(e.Path, "."))
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// SetLimits bounds the resources used by subsequent merges. Each document is
+// checked against the limits, and for cycles, before it is merged; documents
+// produced by unmarshaling never contain cycles, but documents built in code may.
+// Passing the zero [Limits] removes all limits.
+//
+// The merger never resolves includes, templates, or other references, so limits
+// are all that is needed to merge untrusted documents safely. Note that limits
+// apply after unmarshaling: unmarshal functions that expand YAML aliases may
+// use a great deal of memory for small inputs, so check untrusted YAML for
+// aliases before merging it.
+//
+// Returns an error wrapping [ErrInvalidOptions] if a limit is negative.
+func (m *UntypedMerger) SetLimits(limits Limits) error {
+	if limits.MaxDepth < 0 || limits.MaxValues < 0 || limits.MaxBytes < 0 || limits.Timeout < 0 {
+		return fmt.Errorf("%w: negative limit", ErrInvalidOptions)
+	}
+	m.limits = limits
+	return nil
+}
+
+// Limits returns the resource limits configured for this merger.
+func (m *UntypedMerger) Limits() Limits {
+	return m.limits
+}
+
+// startLimits records the deadline of a merge operation, if it has a timeout.
+func (m *UntypedMerger) startLimits() {
+	m.deadline = time.Time{}
+	if m.limits.Timeout > 0 {
+		m.deadline = time.Now().Add(m.limits.Timeout)
+	}
+}
+
+// deadlineCheckInterval is how many values pass between checks of the merge deadline.
+const deadlineCheckInterval = 1024
+
+// checkDeadline returns a [*LimitError] if the merge has run past its deadline.
+// The clock is read only every [deadlineCheckInterval] values.
+func (m *UntypedMerger) checkDeadline(count int) error {
+	if m.deadline.IsZero() || count%deadlineCheckInterval != 0 || time.Now().Before(m.deadline) {
+		return nil
+	}
+	return &LimitError{Limit: "Timeout", DocIndex: m.index, Path: m.pathNames()}
+}
+
+// checkLimits walks a document before it is merged, checking its depth, size,
+// and references against the merger's limits.
+func (m *UntypedMerger) checkLimits(doc any) error {
+	if m.limits == (Limits{}) {
+		return nil
+	}
+	w := limitWalker{m: m, visiting: map[uintptr]bool{}}
+	return w.walk(doc, 0)
+}
+
+// limitWalker checks a single document for [UntypedMerger.checkLimits].
+type limitWalker struct {
+	m        *UntypedMerger
+	path     []string
+	values   int
+	visiting map[uintptr]bool // containers on the current path, for cycle detection
+}
+
+func (w *limitWalker) walk(value any, depth int) error {
+	w.values++
+	limits := w.m.limits
+	if limits.MaxValues > 0 && w.values > limits.MaxValues {
+		return w.exceeded("MaxValues")
+	}
+	if err := w.m.checkDeadline(w.values); err != nil {
+		return err
+	}
+
+	list, isList := asList(value)
+	ordered, isOrdered := value.(*OrderedMap)
+	if !isList && !isMap(value) && (!isOrdered || ordered == nil) {
+		return nil
+	}
+	if limits.MaxDepth > 0 && depth >= limits.MaxDepth {
+		return w.exceeded("MaxDepth")
+	}
+	ptr := reflect.ValueOf(value).Pointer()
+	if w.visiting[ptr] {
+		return fmt.Errorf("%w: document at position %d refers to itself at %s",
+			ErrCyclicDocument, w.m.index, strings.Join(w.path, "."))
+	}
+	w.visiting[ptr] = true
+	defer delete(w.visiting, ptr)
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, k := range sortedKeys(v) {
+			if err := w.child(k, v[k], depth); err != nil {
+				return err
+			}
+		}
+	case map[any]any:
+		for _, k := range SortedMapKeys(v) {
+			if err := w.child(fmt.Sprint(k), v[k], depth); err != nil {
+				return err
+			}
+		}
+	case *OrderedMap:
+		for _, k := range v.Keys {
+			if err := w.child(k, v.Values[k], depth); err != nil {
+				return err
+			}
+		}
+	default:
+		for i, item := range list {
+			if err := w.child(strconv.Itoa(i), item, depth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// child walks a value nested in a container at the given depth.
+func (w *limitWalker) child(name string, value any, depth int) error {
+	w.path = append(w.path, name)
+	err := w.walk(value, depth+1)
+	w.path = w.path[:len(w.path)-1]
+	return err
+}
+
+func (w *limitWalker) exceeded(limit string) error {
+	return &LimitError{Limit: limit, DocIndex: w.m.index, Path: append([]string(nil), w.path...)}
+}
@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func newLimitedMerger(t *testing.T, limits keymerge.Limits) *keymerge.UntypedMerger {
+	t.Helper()
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, json.Unmarshal, json.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := merger.SetLimits(limits); err != nil {
+		t.Fatal(err)
+	}
+	return merger
+}
+
+func TestLimits_MaxDepth(t *testing.T) {
+	merger := newLimitedMerger(t, keymerge.Limits{MaxDepth: 2})
+	base := map[string]any{"a": map[string]any{"b": 1}}
+	overlay := map[string]any{"a": map[string]any{"b": []any{map[string]any{"c": 1}}}}
+
+	if _, err := merger.MergeUnstructured(base); err != nil {
+		t.Fatalf("base is within limits: %v", err)
+	}
+	_, err := merger.MergeUnstructured(base, overlay)
+	var limitErr *keymerge.LimitError
+	if !errors.As(err, &limitErr) || !errors.Is(err, keymerge.ErrLimitExceeded) {
+		t.Fatalf("expected LimitError, got %v", err)
+	}
+	want := &keymerge.LimitError{Limit: "MaxDepth", DocIndex: 1, Path: []string{"a", "b"}}
+	if !reflect.DeepEqual(limitErr, want) {
+		t.Errorf("got %+v, want %+v", limitErr, want)
+	}
+	if err.Error() != "document at position 1 exceeds MaxDepth at a.b" {
+		t.Errorf("unexpected message %q", err)
+	}
+}
+
+func TestLimits_MaxValues(t *testing.T) {
+	merger := newLimitedMerger(t, keymerge.Limits{MaxValues: 4})
+
+	// root, a, b, c
+	if _, err := merger.MergeUnstructured(map[string]any{"a": 1, "b": 2, "c": 3}); err != nil {
+		t.Fatalf("document is within limits: %v", err)
+	}
+	_, err := merger.MergeUnstructured(map[string]any{"a": []any{1, 2, 3}})
+	var limitErr *keymerge.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "MaxValues" {
+		t.Fatalf("expected MaxValues error, got %v", err)
+	}
+	if !reflect.DeepEqual(limitErr.Path, []string{"a", "2"}) {
+		t.Errorf("unexpected path %v", limitErr.Path)
+	}
+}
+
+func TestLimits_MaxBytes(t *testing.T) {
+	merger := newLimitedMerger(t, keymerge.Limits{MaxBytes: 10})
+
+	if _, err := merger.Merge([]byte(`{"a":1}`), []byte(`{"b":2}`)); err != nil {
+		t.Fatalf("documents are within limits: %v", err)
+	}
+	_, err := merger.Merge([]byte(`{"a":1}`), []byte(`{"b":"long"}`))
+	var limitErr *keymerge.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "MaxBytes" || limitErr.DocIndex != 1 {
+		t.Fatalf("expected MaxBytes error for document 1, got %v", err)
+	}
+}
+
+func TestLimits_Timeout(t *testing.T) {
+	merger := newLimitedMerger(t, keymerge.Limits{Timeout: time.Nanosecond})
+
+	items := make([]any, 5000)
+	for i := range items {
+		items[i] = i
+	}
+	_, err := merger.MergeUnstructured(map[string]any{"items": items})
+	var limitErr *keymerge.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "Timeout" {
+		t.Fatalf("expected Timeout error, got %v", err)
+	}
+}
+
+func TestLimits_Cycle(t *testing.T) {
+	merger := newLimitedMerger(t, keymerge.SandboxLimits())
+
+	doc := map[string]any{"a": map[string]any{}}
+	doc["a"].(map[string]any)["self"] = doc
+	_, err := merger.MergeUnstructured(map[string]any{}, doc)
+	if !errors.Is(err, keymerge.ErrCyclicDocument) {
+		t.Fatalf("expected ErrCyclicDocument, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "at a.self") {
+		t.Errorf("unexpected message %q", err)
+	}
+
+	ordered := &keymerge.OrderedMap{}
+	ordered.Set("next", []any{ordered})
+	if _, err := merger.MergeUnstructured(ordered); !errors.Is(err, keymerge.ErrCyclicDocument) {
+		t.Fatalf("expected ErrCyclicDocument for an ordered map, got %v", err)
+	}
+
+	// Shared, acyclic values are fine.
+	shared := map[string]any{"x": 1}
+	result, err := merger.MergeUnstructured(map[string]any{"a": shared, "b": []any{shared, shared}})
+	if err != nil {
+		t.Fatalf("shared values are not cycles: %v", err)
+	}
+	if !reflect.DeepEqual(result, map[string]any{"a": shared, "b": []any{shared, shared}}) {
+		t.Errorf("unexpected result %v", result)
+	}
+}
+
+func TestSetLimits_Invalid(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := merger.SetLimits(keymerge.Limits{MaxDepth: -1}); !errors.Is(err, keymerge.ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions, got %v", err)
+	}
+	if merger.Limits() != (keymerge.Limits{}) {
+		t.Errorf("invalid limits should not be applied")
+	}
+}
@@ -0,0 +1,210 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// ListMatcher decides which items of a list correspond across documents, for
+// matching strategies beyond primary key equality, such as fuzzy names or
+// comparisons of several fields. Match reports whether overlayItem is the same
+// item as baseItem, an item of the list merged so far.
+type ListMatcher interface {
+	Match(baseItem, overlayItem any) bool
+}
+
+// ListMatcherFunc adapts a function to a [ListMatcher].
+type ListMatcherFunc func(baseItem, overlayItem any) bool
+
+// Match calls f(baseItem, overlayItem).
+func (f ListMatcherFunc) Match(baseItem, overlayItem any) bool {
+	return f(baseItem, overlayItem)
+}
+
+// ListMatchRule applies a [ListMatcher] to the lists a path pattern addresses.
+type ListMatchRule struct {
+	// Path is a path pattern (see [Grant]) addressing the lists to match, e.g.
+	// "services" or "clusters[*].nodes", or "**" for every list. Patterns may not
+	// contain selectors.
+	Path string
+	// Matcher matches the items of the lists.
+	Matcher ListMatcher
+}
+
+// compiledMatcher is a [ListMatchRule] with a parsed path pattern.
+type compiledMatcher struct {
+	pattern []pathStep
+	matcher ListMatcher
+}
+
+// SetListMatchers sets how list items are matched in subsequent merges. For
+// each list, the first rule whose pattern matches the list's path applies;
+// lists that match none are merged by primary key as usual. Passing no rules
+// removes all matchers.
+//
+// Each overlay item is deep merged into the first item of the list merged so
+// far that the matcher matches, which may be one an earlier overlay item
+// added, or appended if it matches none. Items are matched regardless of
+// [Options.ScalarMode], [Options.DupeMode], and primary keys, and duplicates
+// are never an error. Delete and move markers apply to the item matched.
+// Matching compares every pair of items, so it is slower than key matching for
+// long lists. Matchers only affect merging: [UntypedMerger.Compare] and
+// [UntypedMerger.Diff] still identify items by primary key.
+//
+// Returns an error wrapping [ErrInvalidPath] if a pattern cannot be parsed or
+// contains a selector.
+//
+// Example:
+//
+//	err := merger.SetListMatchers([]keymerge.ListMatchRule{{
+//		Path: "hosts",
+//		Matcher: keymerge.ListMatcherFunc(func(base, overlay any) bool {
+//			b, _ := keymerge.KeyOf(base, "name")
+//			o, _ := keymerge.KeyOf(overlay, "name")
+//			return strings.EqualFold(b.String(), o.String())
+//		}),
+//	}})
+func (m *UntypedMerger) SetListMatchers(rules []ListMatchRule) error {
+	compiled := make([]compiledMatcher, 0, len(rules))
+	for _, rule := range rules {
+		pattern, err := parsePattern(rule.Path)
+		if err != nil {
+			return err
+		}
+		for _, step := range pattern {
+			if step.kind == stepSelect {
+				return fmt.Errorf("%w %q: list matcher patterns cannot contain selectors", ErrInvalidPath, rule.Path)
+			}
+		}
+		if rule.Matcher == nil {
+			return fmt.Errorf("%w: nil Matcher for list matcher %q", ErrInvalidOptions, rule.Path)
+		}
+		compiled = append(compiled, compiledMatcher{pattern: pattern, matcher: rule.Matcher})
+	}
+	if len(compiled) == 0 {
+		compiled = nil
+	}
+	m.listMatchers = compiled
+	return nil
+}
+
+// listMatcher returns the matcher for the list at the current path, or nil if
+// no rule applies.
+func (m *UntypedMerger) listMatcher() ListMatcher {
+	for _, rule := range m.listMatchers {
+		if matchesSegments(rule.pattern, m.path) {
+			return rule.matcher
+		}
+	}
+	return nil
+}
+
+// mergeSlicesMatched merges lists whose items are matched by matcher (see
+// [UntypedMerger.SetListMatchers]).
+func (m *UntypedMerger) mergeSlicesMatched(base, overlay []any, matcher ListMatcher) ([]any, error) {
+	result := slices.Clone(base)
+	deleted := make([]bool, len(result), len(result)+len(overlay))
+	for i, item := range overlay {
+		m.push(strconv.Itoa(i))
+		pos := -1
+		for j, candidate := range result {
+			if !deleted[j] && matcher.Match(candidate, item) {
+				pos = j
+				break
+			}
+		}
+
+		if m.isMarkedForDeletion(item) {
+			if pos >= 0 {
+				m.pop()
+				m.push(strconv.Itoa(pos))
+				if err := m.checkDelete(result[pos]); err != nil {
+					return nil, err
+				}
+				deleted[pos] = true
+			}
+			m.pop()
+			continue
+		}
+
+		if to, moved := m.moveDestination(item); moved {
+			var existing any
+			if pos >= 0 {
+				existing = result[pos]
+				deleted[pos] = true
+				m.pop()
+				m.push(strconv.Itoa(pos))
+			}
+			err := m.takeMove(existing, item, to)
+			m.pop()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if pos < 0 {
+			result = append(result, m.dropNulls(item))
+			deleted = append(deleted, false)
+			m.pop()
+			continue
+		}
+
+		m.pop()                   // Pop current index before merging
+		m.push(strconv.Itoa(pos)) // Push matched index for merge
+		merged, err := m.mergeValues(result[pos], item)
+		m.pop()
+		if err != nil {
+			return nil, err
+		}
+		result[pos] = merged
+	}
+
+	filtered := make([]any, 0, len(result))
+	for pos, item := range result {
+		if !deleted[pos] {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered, nil
+}
+
+// PrimaryKeyMatcher returns a [ListMatcher] that matches items by primary key
+// as a merger with opts does: items match if they have equal keys from
+// [Options.PrimaryKeyNames], [Options.CompositeKeys], or [Options.KeyFunc],
+// which is called with an empty path. [KeyMatchAny] is not supported. Custom
+// matchers can use it to fall back to key matching.
+//
+// Like an [UntypedMerger], the matcher is not safe to use concurrently.
+//
+// Returns an error wrapping [ErrInvalidOptions] if opts are invalid.
+func PrimaryKeyMatcher(opts Options) (ListMatcher, error) {
+	if opts.KeyMatchMode == KeyMatchAny {
+		return nil, fmt.Errorf("%w: PrimaryKeyMatcher does not support KeyMatchAny", ErrInvalidOptions)
+	}
+	m, err := NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return primaryKeyMatcher{m: m}, nil
+}
+
+// primaryKeyMatcher implements [PrimaryKeyMatcher].
+type primaryKeyMatcher struct {
+	m *UntypedMerger
+}
+
+func (k primaryKeyMatcher) Match(baseItem, overlayItem any) bool {
+	k.m.reset(0)
+	k.m.push("0")
+	baseKey := k.m.getPrimaryKey(baseItem)
+	overlayKey := k.m.getPrimaryKey(overlayItem)
+	k.m.pop()
+	if baseKey == nil || overlayKey == nil || !isKeyComparable(baseKey) || !isKeyComparable(overlayKey) {
+		return false
+	}
+	return toMapKey(baseKey) == toMapKey(overlayKey)
+}
@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// sameHost matches items whose host fields are equal ignoring case.
+var sameHost = keymerge.ListMatcherFunc(func(base, overlay any) bool {
+	b, _ := base.(map[string]any)["host"].(string)
+	o, _ := overlay.(map[string]any)["host"].(string)
+	return b != "" && strings.EqualFold(b, o)
+})
+
+func TestSetListMatchers(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{
+		PrimaryKeyNames: []string{"name"},
+		DeleteMarkerKey: "_delete",
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := merger.SetListMatchers([]keymerge.ListMatchRule{{Path: "clusters[*].nodes", Matcher: sameHost}}); err != nil {
+		t.Fatal(err)
+	}
+
+	base := map[string]any{
+		"clusters": []any{map[string]any{"name": "east", "nodes": []any{
+			map[string]any{"host": "a.example.com", "cpu": 2},
+			map[string]any{"host": "b.example.com", "cpu": 2},
+		}}},
+		"users": []any{map[string]any{"name": "alice", "host": "x"}},
+	}
+	overlay := map[string]any{
+		"clusters": []any{map[string]any{"name": "east", "nodes": []any{
+			map[string]any{"host": "A.EXAMPLE.COM", "cpu": 4},
+			map[string]any{"host": "b.example.com", "_delete": true},
+			map[string]any{"host": "c.example.com", "cpu": 1},
+		}}},
+		// Other lists still match by primary key
+		"users": []any{map[string]any{"name": "bob", "host": "x"}},
+	}
+	result, err := merger.MergeUnstructured(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{
+		"clusters": []any{map[string]any{"name": "east", "nodes": []any{
+			map[string]any{"host": "A.EXAMPLE.COM", "cpu": 4},
+			map[string]any{"host": "c.example.com", "cpu": 1},
+		}}},
+		"users": []any{
+			map[string]any{"name": "alice", "host": "x"},
+			map[string]any{"name": "bob", "host": "x"},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %v, want %v", result, expected)
+	}
+
+	if err := merger.SetListMatchers(nil); err != nil {
+		t.Fatal(err)
+	}
+	result, err = merger.MergeUnstructured(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nodes := result.(map[string]any)["clusters"].([]any)[0].(map[string]any)["nodes"].([]any); len(nodes) != 5 {
+		t.Errorf("expected unkeyed nodes to be concatenated without matchers, got %v", nodes)
+	}
+}
+
+func TestSetListMatchers_Invalid(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		rule keymerge.ListMatchRule
+		err  error
+	}{
+		"selector":    {keymerge.ListMatchRule{Path: "nodes[name=a]", Matcher: sameHost}, keymerge.ErrInvalidPath},
+		"unparseable": {keymerge.ListMatchRule{Path: "nodes[", Matcher: sameHost}, keymerge.ErrInvalidPath},
+		"nil matcher": {keymerge.ListMatchRule{Path: "nodes"}, keymerge.ErrInvalidOptions},
+	}
+	for name, tc := range tests {
+		if err := merger.SetListMatchers([]keymerge.ListMatchRule{tc.rule}); !errors.Is(err, tc.err) {
+			t.Errorf("%s: expected %v, got %v", name, tc.err, err)
+		}
+	}
+}
+
+func TestPrimaryKeyMatcher(t *testing.T) {
+	matcher, err := keymerge.PrimaryKeyMatcher(keymerge.Options{CompositeKeys: [][]string{{"region", "name"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := map[string]any{"region": "us", "name": "api", "url": "v1"}
+	tests := []struct {
+		other any
+		want  bool
+	}{
+		{map[string]any{"region": "us", "name": "api"}, true},
+		{map[string]any{"region": "eu", "name": "api"}, false},
+		{map[string]any{"name": "api"}, false},
+		{"api", false},
+	}
+	for _, tc := range tests {
+		if got := matcher.Match(a, tc.other); got != tc.want {
+			t.Errorf("Match(%v, %v) = %v, want %v", a, tc.other, got, tc.want)
+		}
+	}
+
+	// Custom matchers can fall back to key matching.
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = merger.SetListMatchers([]keymerge.ListMatchRule{{Path: "**", Matcher: keymerge.ListMatcherFunc(
+		func(base, overlay any) bool { return sameHost(base, overlay) || matcher.Match(base, overlay) },
+	)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := merger.MergeUnstructured(
+		[]any{a, map[string]any{"host": "web", "port": 80}},
+		[]any{map[string]any{"region": "us", "name": "api", "url": "v2"}, map[string]any{"host": "WEB", "port": 8080}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []any{
+		map[string]any{"region": "us", "name": "api", "url": "v2"},
+		map[string]any{"host": "WEB", "port": 8080},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %v, want %v", result, expected)
+	}
+
+	if _, err := keymerge.PrimaryKeyMatcher(keymerge.Options{KeyMatchMode: keymerge.KeyMatchAny}); !errors.Is(err, keymerge.ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions, got %v", err)
+	}
+}
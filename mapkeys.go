@@ -0,0 +1,269 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// normalizeKeys prepares a document for merging according to [MapKeyMode].
+// With [MapKeysStringify], every map[any]any in doc is converted to map[string]any;
+// values without such maps are returned as is, without copying.
+func (m *UntypedMerger) normalizeKeys(doc any) (any, error) {
+	if m.opts.MapKeyMode != MapKeysStringify {
+		return doc, nil
+	}
+	result, _, err := stringifyKeys(doc)
+	if err != nil {
+		return nil, fmt.Errorf("document %d: %w", m.index, err)
+	}
+	return result, nil
+}
+
+// stringifyKeys converts map[any]any values within v to map[string]any.
+// The boolean result reports whether anything was converted; if not, v is returned unchanged.
+// Returns an error wrapping [ErrDuplicateMapKey] if two keys of a map format the same.
+// Keys are converted in [SortedMapKeys] order so that the error is deterministic.
+func stringifyKeys(v any) (any, bool, error) {
+	switch v := v.(type) {
+	case map[any]any:
+		result := make(map[string]any, len(v))
+		for _, k := range SortedMapKeys(v) {
+			val := v[k]
+			key := fmt.Sprint(k)
+			if _, exists := result[key]; exists {
+				return nil, false, fmt.Errorf("%w: more than one key formats as %q", ErrDuplicateMapKey, key)
+			}
+			converted, _, err := stringifyKeys(val)
+			if err != nil {
+				return nil, false, err
+			}
+			result[key] = converted
+		}
+		return result, true, nil
+	case map[string]any:
+		var result map[string]any
+		for k, val := range v {
+			converted, changed, err := stringifyKeys(val)
+			if err != nil {
+				return nil, false, err
+			}
+			if changed {
+				if result == nil {
+					result = maps.Clone(v)
+				}
+				result[k] = converted
+			}
+		}
+		if result == nil {
+			return v, false, nil
+		}
+		return result, true, nil
+	case []any:
+		var result []any
+		for i, item := range v {
+			converted, changed, err := stringifyKeys(item)
+			if err != nil {
+				return nil, false, err
+			}
+			if changed {
+				if result == nil {
+					result = slices.Clone(v)
+				}
+				result[i] = converted
+			}
+		}
+		if result == nil {
+			return v, false, nil
+		}
+		return result, true, nil
+	default:
+		return v, false, nil
+	}
+}
+
+// mergeAnyMaps merges maps with non-string keys, as used by [MapKeysPreserve].
+// Overlay keys are merged in [SortedMapKeys] order, and a key matches a base key
+// with the same identity (see [mapKeyID]), in which case the base key is kept.
+func (m *UntypedMerger) mergeAnyMaps(base, overlay map[any]any) (map[any]any, error) {
+	ids, err := mapKeyIDs(base)
+	if err != nil {
+		return nil, fmt.Errorf("document %d: %w", m.index, err)
+	}
+	if _, err := mapKeyIDs(overlay); err != nil {
+		return nil, fmt.Errorf("document %d: %w", m.index, err)
+	}
+
+	result := maps.Clone(base)
+	for _, k := range SortedMapKeys(overlay) {
+		v := overlay[k]
+		id := mapKeyID(k)
+		baseKey, exists := ids[id]
+		m.push(fmt.Sprint(k))
+
+		if m.isMarkedForDeletion(v) || (v == nil && m.opts.NullMode == NullDelete) {
+			if exists {
+				if err := m.checkDelete(result[baseKey]); err != nil {
+					return nil, err
+				}
+				delete(result, baseKey)
+				delete(ids, id)
+			}
+			m.pop()
+			continue
+		}
+
+		if exists {
+			merged, err := m.mergeValues(result[baseKey], v)
+			if err != nil {
+				return nil, err
+			}
+			result[baseKey] = merged
+		} else {
+			result[k] = m.dropNulls(v)
+			ids[id] = k
+		}
+
+		m.pop()
+	}
+	return result, nil
+}
+
+// numericKey is the identity of a numeric map key.
+type numericKey string
+
+// mapKeyID returns the identity used to match preserved map keys across documents.
+// Numbers equal in value share an identity regardless of their Go type, so that
+// e.g. int 1 from a YAML document matches float64 1 from a JSON document.
+// Other keys are their own identity; in particular, 1 and "1" are different keys.
+func mapKeyID(k any) any {
+	if f, ok := toBigFloat(k); ok {
+		return numericKey(f.Text('g', -1))
+	}
+	return k
+}
+
+// mapKeyIDs maps the identity of each key in mp to the key.
+// Returns an error wrapping [ErrDuplicateMapKey] if two keys share an identity.
+func mapKeyIDs(mp map[any]any) (map[any]any, error) {
+	ids := make(map[any]any, len(mp))
+	for _, k := range SortedMapKeys(mp) {
+		id := mapKeyID(k)
+		if other, exists := ids[id]; exists {
+			return nil, fmt.Errorf("%w: keys %#v and %#v are the same number", ErrDuplicateMapKey, other, k)
+		}
+		ids[id] = k
+	}
+	return ids, nil
+}
+
+// SortedMapKeys returns the keys of a map with non-string keys in a deterministic order:
+// nil first, then booleans (false before true), numbers by value, strings in
+// lexical order, and any other keys by type name and then formatted value.
+// Numbers equal in value (e.g. int 1 and float64 1) are ordered by type name.
+//
+// Marshal functions can use it to write [MapKeysPreserve] results in a stable order.
+func SortedMapKeys(mp map[any]any) []any {
+	keys := make([]any, 0, len(mp))
+	for k := range mp {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, compareMapKeys)
+	return keys
+}
+
+// Ranks of map key kinds in [SortedMapKeys] order.
+const (
+	rankNil = iota
+	rankBool
+	rankNumber
+	rankString
+	rankOther
+)
+
+func mapKeyRank(k any) int {
+	switch k.(type) {
+	case nil:
+		return rankNil
+	case bool:
+		return rankBool
+	case string:
+		return rankString
+	}
+	if _, ok := toBigFloat(k); ok {
+		return rankNumber
+	}
+	return rankOther
+}
+
+// compareMapKeys orders two map keys as described by [SortedMapKeys].
+func compareMapKeys(a, b any) int {
+	rank := mapKeyRank(a)
+	if c := cmp.Compare(rank, mapKeyRank(b)); c != 0 {
+		return c
+	}
+	switch rank {
+	case rankBool:
+		if a == b {
+			return 0
+		}
+		if a == false {
+			return -1
+		}
+		return 1
+	case rankNumber:
+		an, _ := toBigFloat(a)
+		bn, _ := toBigFloat(b)
+		if c := an.Cmp(bn); c != 0 {
+			return c
+		}
+	case rankString:
+		return strings.Compare(a.(string), b.(string))
+	case rankNil:
+		return 0
+	}
+	if c := strings.Compare(fmt.Sprintf("%T", a), fmt.Sprintf("%T", b)); c != 0 {
+		return c
+	}
+	return strings.Compare(fmt.Sprintf("%#v", a), fmt.Sprintf("%#v", b))
+}
+
+// asAnyMap converts a map[string]any or map[any]any (see [isMap]) to a map[any]any.
+func asAnyMap(v any) map[any]any {
+	if mp, ok := v.(map[string]any); ok {
+		result := make(map[any]any, len(mp))
+		for k, val := range mp {
+			result[k] = val
+		}
+		return result
+	}
+	return v.(map[any]any)
+}
+
+// isMap reports whether v is a map[string]any or map[any]any.
+func isMap(v any) bool {
+	switch v.(type) {
+	case map[string]any, map[any]any:
+		return true
+	default:
+		return false
+	}
+}
+
+// fieldValue returns the value of a named field of a map[string]any or map[any]any.
+func fieldValue(v any, name string) (any, bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		val, ok := v[name]
+		return val, ok
+	case map[any]any:
+		val, ok := v[name]
+		return val, ok
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestMapKeysStringify(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}, DeleteMarkerKey: "_delete"}
+	base := map[any]any{
+		"ports": map[any]any{80: "http", 443: "https"},
+		"users": []any{
+			map[any]any{"name": "alice", "role": "user"},
+			map[any]any{"name": "bob", "role": "user"},
+		},
+	}
+	overlay := map[string]any{
+		"ports": map[any]any{443: "tls", 8080: "alt"},
+		"users": []any{
+			map[string]any{"name": "alice", "role": "admin"},
+			map[any]any{"name": "bob", "_delete": true},
+		},
+	}
+
+	result, err := keymerge.MergeUnstructured(opts, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"ports": map[string]any{"80": "http", "443": "tls", "8080": "alt"},
+		"users": []any{
+			map[string]any{"name": "alice", "role": "admin"},
+		},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("got %#v, want %#v", result, want)
+	}
+}
+
+func TestMapKeysStringify_DoesNotModifyInputs(t *testing.T) {
+	inner := map[any]any{1: "one"}
+	doc := map[string]any{"list": []any{inner}}
+
+	if _, err := keymerge.MergeUnstructured(keymerge.Options{}, doc); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doc["list"].([]any)[0].(map[any]any); !ok {
+		t.Error("input document was modified")
+	}
+}
+
+func TestMapKeysStringify_Collision(t *testing.T) {
+	doc := map[any]any{1: "int", "1": "string"}
+
+	_, err := keymerge.MergeUnstructured(keymerge.Options{}, map[string]any{}, doc)
+	if !errors.Is(err, keymerge.ErrDuplicateMapKey) {
+		t.Fatalf("expected ErrDuplicateMapKey, got %v", err)
+	}
+}
+
+func TestMapKeysPreserve(t *testing.T) {
+	opts := keymerge.Options{
+		PrimaryKeyNames: []string{"name"},
+		DeleteMarkerKey: "_delete",
+		MapKeyMode:      keymerge.MapKeysPreserve,
+	}
+	base := map[any]any{
+		"ports": map[any]any{80: "http", 443: "https", true: "yes"},
+		"users": []any{
+			map[any]any{"name": "alice", "role": "user"},
+			map[any]any{"name": "bob", "role": "user"},
+		},
+	}
+	overlay := map[string]any{
+		"ports": map[any]any{443: "tls", "80": "string key", true: map[any]any{"_delete": true}},
+		"users": []any{
+			map[string]any{"name": "alice", "role": "admin"},
+			map[any]any{"name": "bob", "_delete": true},
+		},
+	}
+
+	result, err := keymerge.MergeUnstructured(opts, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[any]any{
+		"ports": map[any]any{80: "http", "80": "string key", 443: "tls"},
+		"users": []any{
+			map[any]any{"name": "alice", "role": "admin"},
+		},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("got %#v, want %#v", result, want)
+	}
+}
+
+func TestMapKeysPreserve_DuplicatePrimaryKey(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}, MapKeyMode: keymerge.MapKeysPreserve}
+	doc := map[any]any{"users": []any{
+		map[any]any{"name": "alice"},
+		map[any]any{"name": "alice"},
+	}}
+
+	_, err := keymerge.MergeUnstructured(opts, map[any]any{"users": []any{}}, doc)
+	if !errors.Is(err, keymerge.ErrDuplicatePrimaryKey) {
+		t.Fatalf("expected ErrDuplicatePrimaryKey, got %v", err)
+	}
+}
+
+func TestMapKeyMode_String(t *testing.T) {
+	for mode, want := range map[keymerge.MapKeyMode]string{
+		keymerge.MapKeysStringify: "MapKeysStringify",
+		keymerge.MapKeysPreserve:  "MapKeysPreserve",
+		keymerge.MapKeyMode(9):    "MapKeyMode(9)",
+	} {
+		if got := mode.String(); got != want {
+			t.Errorf("String() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestMapKeysPreserve_NumericKeys(t *testing.T) {
+	opts := keymerge.Options{MapKeyMode: keymerge.MapKeysPreserve}
+	// A YAML decoder may produce int keys where a JSON decoder produces float64.
+	base := map[any]any{1: "one", 2: "two", "3": "three"}
+	overlay := map[any]any{float64(1): "uno", uint64(2): map[any]any{}, 3: "tres"}
+
+	result, err := keymerge.MergeUnstructured(opts, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[any]any{1: "uno", 2: map[any]any{}, "3": "three", 3: "tres"}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("got %#v, want %#v", result, want)
+	}
+}
+
+func TestMapKeysPreserve_Collision(t *testing.T) {
+	opts := keymerge.Options{MapKeyMode: keymerge.MapKeysPreserve}
+	doc := map[any]any{1: "int", 1.0: "float"}
+
+	_, err := keymerge.MergeUnstructured(opts, map[any]any{}, doc)
+	if !errors.Is(err, keymerge.ErrDuplicateMapKey) {
+		t.Fatalf("expected ErrDuplicateMapKey, got %v", err)
+	}
+	if want := "document 1: duplicate map key: keys 1 and 1 are the same number"; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+}
+
+func TestSortedMapKeys(t *testing.T) {
+	mp := map[any]any{
+		"b": 0, "a": 0, "10": 0,
+		10: 0, 9: 0, 2.5: 0, int8(-1): 0,
+		true: 0, false: 0,
+		nil:                 0,
+		struct{ X int }{2}:  0,
+		struct{ X int }{1}:  0,
+		[2]string{"x", "y"}: 0,
+		float64(9):          0,
+	}
+	want := []any{
+		nil,
+		false, true,
+		int8(-1), 2.5, float64(9), 9, 10,
+		"10", "a", "b",
+		[2]string{"x", "y"}, struct{ X int }{1}, struct{ X int }{2},
+	}
+
+	for range 5 {
+		if got := keymerge.SortedMapKeys(mp); !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %#v, want %#v", got, want)
+		}
+	}
+}
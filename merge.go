@@ -9,9 +9,13 @@ package keymerge
 import (
 	"errors"
 	"fmt"
+	"iter"
+	"maps"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Sentinel errors for simple error checking with [errors.Is].
@@ -27,6 +31,10 @@ var (
 	ErrInvalidOptions = errors.New("invalid options")
 	// ErrInvalidTag indicates a struct tag contained an invalid directive or value.
 	ErrInvalidTag = errors.New("invalid tag")
+	// ErrDuplicateMapKey indicates distinct map keys formatted to the same string key.
+	ErrDuplicateMapKey = errors.New("duplicate map key")
+	// ErrConflict indicates an overlay replaced a scalar value while [ConflictStrict] was set.
+	ErrConflict = errors.New("conflicting value")
 )
 
 // ScalarMode specifies how to merge lists that don't have primary keys.
@@ -75,6 +83,127 @@ func (m DupeMode) String() string {
 	}
 }
 
+// MapKeyMode specifies how to merge maps with non-string keys (map[any]any),
+// which some YAML libraries produce.
+type MapKeyMode int
+
+const (
+	// MapKeysStringify converts map[any]any to map[string]any before merging,
+	// formatting keys with [fmt.Sprint] (default behavior).
+	MapKeysStringify MapKeyMode = iota
+	// MapKeysPreserve merges map[any]any natively, keeping the original key types.
+	// A string key matches the same key in a map[string]any.
+	MapKeysPreserve
+)
+
+func (m MapKeyMode) String() string {
+	switch m {
+	case MapKeysStringify:
+		return "MapKeysStringify"
+	case MapKeysPreserve:
+		return "MapKeysPreserve"
+	default:
+		return fmt.Sprintf("MapKeyMode(%d)", m)
+	}
+}
+
+// ConflictMode specifies what happens when an overlay replaces a scalar value
+// with a different one.
+type ConflictMode int
+
+const (
+	// ConflictOverride lets the overlay's value win silently (default behavior).
+	ConflictOverride ConflictMode = iota
+	// ConflictStrict returns a [*ConflictError] instead, to catch accidental overrides.
+	ConflictStrict
+	// ConflictMark keeps every candidate value under [Options.ConflictMarkerKey]
+	// for a person to resolve, like git's conflict markers.
+	// See [UntypedMerger.UnresolvedConflicts].
+	ConflictMark
+)
+
+func (m ConflictMode) String() string {
+	switch m {
+	case ConflictOverride:
+		return "ConflictOverride"
+	case ConflictStrict:
+		return "ConflictStrict"
+	case ConflictMark:
+		return "ConflictMark"
+	default:
+		return fmt.Sprintf("ConflictMode(%d)", m)
+	}
+}
+
+// KeyMatchMode specifies how list items are matched when several
+// [Options.PrimaryKeyNames] are configured.
+type KeyMatchMode int
+
+const (
+	// KeyMatchFirst identifies each item by the first primary key field it has
+	// (default behavior).
+	KeyMatchFirst KeyMatchMode = iota
+	// KeyMatchAny matches items if any primary key field has the same value in
+	// both, e.g. when migrating list identity from "name" to "id". An item that
+	// matches different items by different fields is an [*AmbiguousKeyError].
+	KeyMatchAny
+)
+
+func (m KeyMatchMode) String() string {
+	switch m {
+	case KeyMatchFirst:
+		return "KeyMatchFirst"
+	case KeyMatchAny:
+		return "KeyMatchAny"
+	default:
+		return fmt.Sprintf("KeyMatchMode(%d)", m)
+	}
+}
+
+// NullMode specifies what a nil (null) overlay value does.
+type NullMode int
+
+const (
+	// NullKeep leaves the base value unchanged (default behavior).
+	NullKeep NullMode = iota
+	// NullDelete removes the map key, like JSON Merge Patch (RFC 7386).
+	// See [MergeJSONMergePatch].
+	NullDelete
+)
+
+func (m NullMode) String() string {
+	switch m {
+	case NullKeep:
+		return "NullKeep"
+	case NullDelete:
+		return "NullDelete"
+	default:
+		return fmt.Sprintf("NullMode(%d)", m)
+	}
+}
+
+// EmptyListMode specifies what an empty overlay list does.
+type EmptyListMode int
+
+const (
+	// EmptyKeep leaves the base list unchanged (default behavior), since
+	// overlays usually leave lists alone by omitting them or by listing nothing.
+	EmptyKeep EmptyListMode = iota
+	// EmptyReplace replaces the base list with the empty list, clearing it.
+	EmptyReplace
+)
+
+func (m EmptyListMode) String() string {
+	switch m {
+	case EmptyKeep:
+		return "EmptyKeep"
+	case EmptyReplace:
+		return "EmptyReplace"
+	default:
+		return fmt.Sprintf("EmptyListMode(%d)", m)
+	}
+}
+
 // DuplicatePrimaryKeyError is returned when duplicate primary keys are found
 // in a list and [DupeMode] is set to [DupeUnique].
 type DuplicatePrimaryKeyError struct {
@@ -86,6 +215,9 @@ type DuplicatePrimaryKeyError struct {
 	Path []string
 	// DocIndex tells which document the error occurred.
 	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
 }
 
 func (e *DuplicatePrimaryKeyError) Error() string {
@@ -93,8 +225,8 @@ func (e *DuplicatePrimaryKeyError) Error() string {
 	if path == "" {
 		path = "(root)"
 	}
-	return fmt.Sprintf("duplicate primary key %v at path %s in document %d at positions %v",
-		e.Key, path, e.DocIndex, e.Positions)
+	return fmt.Sprintf("duplicate primary key %v at path %s in document %d%s at positions %v",
+		e.Key, path, e.DocIndex, nameSuffix(e.DocName), e.Positions)
 }
 
 func (e *DuplicatePrimaryKeyError) Is(target error) bool {
@@ -112,6 +244,9 @@ type NonComparablePrimaryKeyError struct {
 	Path []string
 	// DocIndex tells which document the error occurred.
 	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
 }
 
 func (e *NonComparablePrimaryKeyError) Error() string {
@@ -119,14 +254,43 @@ func (e *NonComparablePrimaryKeyError) Error() string {
 	if path == "" {
 		path = "(root)"
 	}
-	return fmt.Sprintf("non-comparable primary key %v (type %T) at path %s in document %d at position %d",
-		e.Key, e.Key, path, e.DocIndex, e.Position)
+	return fmt.Sprintf("non-comparable primary key %v (type %T) at path %s in document %d%s at position %d",
+		e.Key, e.Key, path, e.DocIndex, nameSuffix(e.DocName), e.Position)
 }
 
 func (e *NonComparablePrimaryKeyError) Is(target error) bool {
 	return target == ErrNonComparablePrimaryKey
 }
 
+// ConflictError is returned when an overlay replaces a non-nil scalar value
+// with a different value and [ConflictMode] is set to [ConflictStrict].
+type ConflictError struct {
+	// Path is where in the document the conflicting value occurred.
+	Path []string
+	// Base is the value before the overlay was merged.
+	Base any
+	// Overlay is the overlay's value.
+	Overlay any
+	// DocIndex tells which document the error occurred.
+	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
+}
+
+func (e *ConflictError) Error() string {
+	path := strings.Join(e.Path, ".")
+	if path == "" {
+		path = "(root)"
+	}
+	return fmt.Sprintf("conflicting value at path %s in document %d%s: %v would replace %v",
+		path, e.DocIndex, nameSuffix(e.DocName), e.Overlay, e.Base)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
 // MarshalError is returned when unmarshaling or marshaling a document fails.
 type MarshalError struct {
 	// Err is the underlying error returned by a marshaling function.
@@ -137,13 +301,16 @@ type MarshalError struct {
 	// For unmarshal errors, this is the index of the input document (0-based).
 	// For marshal errors (serializing the result), this is -1.
 	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
 }
 
 func (e *MarshalError) Error() string {
 	if e.DocIndex < 0 {
 		return fmt.Sprintf("cannot %s result: %v", e.Operation, e.Err)
 	}
-	return fmt.Sprintf("cannot %s document at position %d: %v", e.Operation, e.DocIndex, e.Err)
+	return fmt.Sprintf("cannot %s document at position %d%s: %v", e.Operation, e.DocIndex, nameSuffix(e.DocName), e.Err)
 }
 
 func (e *MarshalError) Unwrap() error {
@@ -161,6 +328,7 @@ func (e *MarshalError) Is(target error) bool {
 //   - [ScalarConcat] mode (lists are concatenated)
 //   - No deletion markers
 //   - [DupeUnique] mode (errors on duplicates, though none detected without primary keys)
+//   - [MapKeysStringify] mode (map[any]any keys are converted to strings)
 type Options struct {
 	// PrimaryKeyNames specifies field names to use as primary keys when merging lists.
 	// The first matching field name identifies corresponding items across documents.
@@ -168,20 +336,190 @@ type Options struct {
 	//
 	// Example: ["name", "id"] tries "name" first, then "id". Items without either field
 	// are treated as having no key and merged according to [ScalarMode].
+	//
+	// A name with dots that is not itself a key of the item is a path into nested
+	// maps, so "metadata.name" identifies Kubernetes-style items by their metadata.
 	PrimaryKeyNames []string
 
+	// CompositeKeys specifies sets of fields that identify list items together,
+	// like multiple km:"primary" tags do for [Merger]. An item's key is made of
+	// the first set whose fields it ALL has, so with [["region", "name"]] items
+	// match only when both region and name are equal. Composite keys are tried
+	// before [Options.PrimaryKeyNames], which then apply to items that have none
+	// of the sets. They cannot be combined with [KeyMatchAny].
+	CompositeKeys [][]string
+
+	// KeyFunc, if set, identifies list items instead of the built-in primary key
+	// discovery: [Options.PrimaryKeyNames], [Options.CompositeKeys], and
+	// km:"primary" tags are ignored when matching. It is called with the path of
+	// the list and each map item, and returns the item's key and whether it has
+	// one, so keys can be computed, e.g. lowercase(name) or host:port. Keys must
+	// be comparable; use [NewKey] for keys made of several values. Items without
+	// a key are merged according to [ScalarMode]. It cannot be combined with
+	// [KeyMatchAny].
+	//
+	// Paths of items in [Compare] and [Lookup] results use positions rather than
+	// selectors, and [Diff] repeats an item's top-level scalar fields in its
+	// overlay item if needed for KeyFunc to identify it.
+	KeyFunc func(path []string, item map[string]any) (key any, ok bool)
+
 	// DeleteMarkerKey specifies a field name that marks items for deletion.
 	// When set, maps with this field set to true are removed from the result.
-	// If empty, deletion semantics are disabled.
+	// If empty, deletion semantics are disabled. A field's km:"delete-marker=..."
+	// tag overrides it for the field and everything under it.
 	DeleteMarkerKey string
 
+	// MoveMarkerKey specifies a field name that moves list items to another list.
+	// An overlay item with this field set to a path (see [Lookup]) of a list,
+	// e.g. {"name": "build", "_move_to": "queues[name=slow].jobs"}, removes the
+	// item it matches by primary key from its list, deep merges the overlay
+	// item's other fields into it, and merges the result into the destination
+	// list by primary key. Destinations are resolved once the whole document is
+	// merged; a missing destination list is created if its parent map exists.
+	// Moved items must have a primary key. Returns a [*MoveError] if an item
+	// cannot be moved. If empty, move markers are disabled.
+	MoveMarkerKey string
+
+	// OnDelete, if set, is called for every value an overlay deletes, with
+	// the value's path in the merged document, the value as merged so far, and
+	// the index of the deleting document, so that deletions can be logged or
+	// held for review. Deletions are made by delete markers (see
+	// [Options.DeleteMarkerKey]) and by nil values with [NullDelete]; deleting
+	// an absent key or item calls nothing. Returning an error blocks the
+	// deletion and fails the merge with a [*DeleteError] wrapping it. If a
+	// merge fails, OnDelete may have been called for deletions that never
+	// took effect.
+	OnDelete func(path []string, deleted any, docIndex int) error
+
+	// ScalarStrategies maps path patterns (see [Grant]) to strategies that
+	// combine scalar values instead of letting the overlay's value win, e.g.
+	// {"deployments[*].replicas": StrategySum} totals replica counts across
+	// documents. A strategy is used when both the base and the overlay value are
+	// non-nil scalars; values set for the first time are taken as they are.
+	// Patterns may not contain selectors. If several patterns match a value, the
+	// one with the most field names and indices applies. They take precedence over km:"agg=..." and km:"mode=join" tags.
+	// Returns a [*ScalarStrategyError] if a strategy fails.
+	ScalarStrategies map[string]ScalarStrategy
+
+	// ReplaceMaps lists path patterns (see [Grant]) of maps that an overlay's map
+	// replaces wholesale instead of being deep merged with, e.g. "**.labels" or
+	// "spec.selector", where a partial merge would be meaningless. Like
+	// km:"map=replace" tags, it only affects maps an overlay replaces with a
+	// map. Patterns may not contain selectors.
+	ReplaceMaps []string
+
 	// ScalarMode specifies how to merge lists without primary keys.
 	// Default is [ScalarConcat].
 	ScalarMode ScalarMode
 
+	// ScalarModes maps path patterns (see [Grant]) of lists to the
+	// [ScalarMode] they merge by instead of ScalarMode, e.g.
+	// {"**.finalizers": ScalarDedup}. If several patterns match a list, the
+	// one with the most field names and indices applies. km:"mode=..." tags
+	// take precedence. Patterns may not contain selectors.
+	ScalarModes map[string]ScalarMode
+
 	// DupeMode specifies how to handle duplicate primary keys in object lists.
 	// Default is [DupeUnique].
 	DupeMode DupeMode
+
+	// DupeMatrix, if set, replaces DupeMode with separate settings for
+	// duplicates within the first document, within later documents, and across
+	// overlays. See [DupeMatrix].
+	DupeMatrix *DupeMatrix
+
+	// Preset adds the options of a [Preset] for a common kind of document,
+	// such as [PresetKubernetes]: its primary key names after
+	// PrimaryKeyNames, its ScalarModes and ReplaceMaps patterns, and its
+	// ScalarMode if ScalarMode is left at [ScalarConcat]. Options set here take
+	// precedence over the preset's, and [UntypedMerger.Options] returns them
+	// with the preset's added.
+	Preset Preset
+
+	// MapKeyMode specifies how to merge maps with non-string keys.
+	// Default is [MapKeysStringify].
+	MapKeyMode MapKeyMode
+
+	// KeyMatchMode specifies how list items are matched by [Options.PrimaryKeyNames].
+	// It does not apply to lists whose keys come from struct tags, and only
+	// affects merging: [Compare], [IndexList], and path selectors always use the
+	// first key field an item has.
+	// Default is [KeyMatchFirst].
+	KeyMatchMode KeyMatchMode
+
+	// ConflictMode specifies what happens when an overlay replaces a scalar value
+	// (anything but a map or list) with a different value. Setting a value to what
+	// it already is, setting a value that was nil or absent, and deleting values
+	// are never conflicts. Values are compared like [UntypedMerger.Compare]
+	// compares them, so numbers match regardless of their Go type.
+	// Default is [ConflictOverride].
+	ConflictMode ConflictMode
+
+	// ConflictMarkerKey specifies the field name of conflict markers, which
+	// [ConflictMark] puts in place of conflicting values. A marker is a map with
+	// only this field, holding the list of candidate values in merge order, e.g.
+	// {"_conflict": [8080, 9090]}. Replace the marker with the chosen value to
+	// resolve the conflict. Required by [ConflictMark].
+	ConflictMarkerKey string
+
+	// NullMode specifies what a nil overlay value does. With [NullDelete], a nil
+	// map value removes the key, nil values inside maps added by an overlay are
+	// dropped, and an empty overlay list replaces the base list, since overlays
+	// leave values alone by omitting them rather than with an empty list.
+	// Default is [NullKeep].
+	NullMode NullMode
+
+	// EmptyLists specifies what an empty overlay list does: keep the base
+	// list, or replace it to clear it. With [NullDelete], empty lists always
+	// replace. A field's km:"empty=..." tag overrides both for the field.
+	// Default is [EmptyKeep].
+	EmptyLists EmptyListMode
+
+	// Prune makes the last document authoritative: map keys and keyed list
+	// items it does not have are removed from the result, wherever it has the
+	// enclosing map or list, so earlier documents only supply defaults for
+	// what it sets. Lists without primary keys merge by their [ScalarMode].
+	// Pruned values are deleted by the last document, so [Options.OnDelete] is
+	// called for them. A merge of one document prunes nothing, and each
+	// identity of [UntypedMerger.MergeStreams] is pruned by its own last
+	// document. [Diff] rejects it, since the last document is then its own
+	// overlay.
+	Prune bool
+
+	// AssertKey specifies a top-level field name that holds a document's assertions
+	// about the merged result. Each assertion is a map with a "path" (see [Lookup])
+	// and optionally "equals" (the expected value), "exists" (false to assert the
+	// value is absent), and "message". The field may hold one assertion or a list.
+	// Assertion fields are removed before merging, and the merge fails with an
+	// [*AssertionError] if the final result violates any assertion.
+	// If empty, assertions are disabled.
+	AssertKey string
+
+	// RejectUnknownFields makes merges fail with an [*UnknownFieldError] if a
+	// document has a map key that the merger's metadata, such as the struct
+	// tags of a [Merger]'s type, has no field for. This catches typos in
+	// overlays, which decoding would otherwise drop silently. Marker keys are
+	// allowed, and maps whose fields the metadata does not describe, such as
+	// map-typed fields, are not checked. It has no effect without metadata.
+	RejectUnknownFields bool
+
+	// ProtectedPaths lists path patterns (see [Grant]) of values that only the
+	// first document may set, e.g. "security.tls" or "users[name=admin]". An
+	// overlay that adds, changes, or deletes a value a pattern matches, or
+	// anything beneath it, fails the merge with a [*ProtectedPathError]. Unlike
+	// grants, they apply to every overlay, and are checked after each one by
+	// comparing the values the patterns match before and after it.
+	ProtectedPaths []string
+
+	// CollectDuplicates makes merges find every group of items sharing a
+	// primary key in each document's lists, rather than stopping at the first,
+	// and report them by [UntypedMerger.Duplicates], e.g. to audit large legacy
+	// files. Items are matched as the merge matches them, so lists matched by a
+	// [ListMatcher] or marked opaque have no duplicates. Lists whose [DupeMode]
+	// is [DupeUnique] still fail the merge, with a [*DuplicatePrimaryKeyError]
+	// for the first group, but only after every document has been checked,
+	// including the first.
+	CollectDuplicates bool
 }
 
 // fieldMetadata contains merge directives for a specific field extracted from struct tags.
@@ -196,12 +534,36 @@ type fieldMetadata struct {
 	dupeMode *DupeMode
 	// children contains metadata for nested struct fields (map key is the serialized field name)
 	children map[string]*fieldMetadata
+	// doc is the field's documentation from its km-doc tag
+	doc string
+	// list is set if the field is a slice, so its children describe list items
+	list bool
+	// opaque is set if the field's list items are compared by content and never deep merged
+	opaque bool
+	// strategy combines the field's scalar values, from its km:"agg=..." tag
+	strategy ScalarStrategy
+	// replaceMap is set if the field's map is replaced by overlays rather than deep merged
+	replaceMap bool
+	// replace is set if overlays replace the field's value outright, whatever its kind
+	replace bool
+	// ignore is set if overlays never change the field, keeping the first document's value
+	ignore bool
+	// immutable is set if overlays that change the field's value fail the merge
+	immutable bool
+	// deleteMarker overrides Options.DeleteMarkerKey for the field and everything under it
+	deleteMarker *string
+	// emptyMode overrides Options.EmptyLists for the field, from its km:"empty=..." tag
+	emptyMode *EmptyListMode
+	// custom is the field's list item type if it implements CustomMerger
+	custom reflect.Type
 }
 
 // pathSegment represents one level in the document path with its associated metadata.
 type pathSegment struct {
 	name string         // field name or array index
 	meta *fieldMetadata // metadata at this path level (nil if no metadata)
+	// deleteMarker is the delete marker key set by this or an enclosing field's tag, if any
+	deleteMarker *string
 }
 
 // UntypedMerger performs document merging with the configured options.
@@ -209,7 +571,9 @@ type pathSegment struct {
 //
 // An UntypedMerger can be safely reused for multiple merge operations.
 //
-// An UntypedMerger is not safe to use concurrently.
+// An UntypedMerger is not safe to use concurrently: merges keep their state in
+// the merger, and one that starts while another is running panics. Use a
+// [MergerPool] to merge from several goroutines.
 type UntypedMerger struct {
 	opts      Options        // merge configuration
 	path      []pathSegment  // current path in document tree for error reporting
@@ -217,6 +581,30 @@ type UntypedMerger struct {
 	metadata  *fieldMetadata // root metadata for Merger (nil for untyped UntypedMerger)
 	unmarshal func([]byte, any) error
 	marshal   func(any) ([]byte, error)
+
+	values           int                  // values merged so far, for progress reporting
+	progress         func(Progress)       // progress callback (nil if none)
+	progressInterval int                  // values between progress callbacks
+	limits           Limits               // resource limits (zero if none)
+	deadline         time.Time            // deadline of the current merge (zero if none)
+	grants           []*compiledGrant     // per-document change restrictions (nil if none)
+	keyNormalizers   []compiledNormalizer // primary key normalizers by list path (nil if none)
+	listMatchers     []compiledMatcher    // custom list item matchers by list path (nil if none)
+	identities       []compiledIdentity   // list item identity functions by list path (nil if none)
+	duplicates       []DuplicateGroup     // duplicate key groups found by the last merge (nil if none)
+	claims           map[itemClaim]int    // overlays that set keyed items, for DupeMatrix.Across
+	moves            []pendingMove        // items taken by move markers in the current document
+	strategies       []compiledStrategy   // scalar strategies by path, most specific first (nil if none)
+	scalarModes      []compiledScalarMode // list modes by path, most specific first (nil if none)
+	replaceMaps      [][]pathStep         // patterns of maps that overlays replace (nil if none)
+	protected        []protectedPath      // patterns of values overlays may not change (nil if none)
+	checkDeterminism bool                 // whether merges run twice to check their results agree
+	busy             uint32               // set while a merge runs, to detect concurrent use
+	names            []string             // document names for errors and reports (nil if none)
+
+	// streamMetadata picks the metadata of MergeStreams groups by their first
+	// document (nil if none)
+	streamMetadata func(any) MetadataTree
 }
 
 // NewUntypedMerger creates a new [UntypedMerger] with the given options.
@@ -230,7 +618,58 @@ func NewUntypedMerger(opts Options,
 			return nil, fmt.Errorf("%w: empty string in PrimaryKeyNames", ErrInvalidOptions)
 		}
 	}
-	return &UntypedMerger{opts: opts, marshal: marshal, unmarshal: unmarshal}, nil
+	for _, names := range opts.CompositeKeys {
+		if len(names) == 0 || slices.Contains(names, "") {
+			return nil, fmt.Errorf("%w: empty key or field name in CompositeKeys", ErrInvalidOptions)
+		}
+	}
+	if len(opts.CompositeKeys) > 0 && opts.KeyMatchMode == KeyMatchAny {
+		return nil, fmt.Errorf("%w: CompositeKeys cannot be used with KeyMatchAny", ErrInvalidOptions)
+	}
+	if opts.KeyFunc != nil && opts.KeyMatchMode == KeyMatchAny {
+		return nil, fmt.Errorf("%w: KeyFunc cannot be used with KeyMatchAny", ErrInvalidOptions)
+	}
+	if opts.ConflictMode == ConflictMark && opts.ConflictMarkerKey == "" {
+		return nil, fmt.Errorf("%w: ConflictMark requires a ConflictMarkerKey", ErrInvalidOptions)
+	}
+	opts, err := withPreset(opts)
+	if err != nil {
+		return nil, err
+	}
+	strategies, err := compileStrategies(opts.ScalarStrategies)
+	if err != nil {
+		return nil, err
+	}
+	scalarModes, err := compileScalarModes(opts.ScalarModes)
+	if err != nil {
+		return nil, err
+	}
+	var replaceMaps [][]pathStep
+	for _, path := range opts.ReplaceMaps {
+		pattern, err := parsePattern(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: ReplaceMaps: %w", ErrInvalidOptions, err)
+		}
+		if slices.ContainsFunc(pattern, func(step pathStep) bool { return step.kind == stepSelect }) {
+			return nil, fmt.Errorf("%w: ReplaceMaps pattern %q cannot contain selectors", ErrInvalidOptions, path)
+		}
+		replaceMaps = append(replaceMaps, pattern)
+	}
+	protected, err := compileProtectedPaths(opts.ProtectedPaths)
+	if err != nil {
+		return nil, err
+	}
+	return &UntypedMerger{
+		opts:        opts,
+		marshal:     marshal,
+		unmarshal:   unmarshal,
+		strategies:  strategies,
+		scalarModes: scalarModes,
+		replaceMaps: replaceMaps,
+		protected:   protected,
+
+		checkDeterminism: checksDeterminism(),
+	}, nil
 }
 
 // Options returns the merge options configured for this [UntypedMerger].
@@ -271,7 +710,10 @@ func Merge(
 //
 // Duplicate items in lists are handled according to [DupeMode].
 //
-// Input documents should be map[string]any, []any, or scalar values.
+// Input documents should be map[string]any, []any, or scalar values. Maps with
+// non-string keys (map[any]any) are merged according to [MapKeyMode], and maps
+// that keep their key order ([OrderedMap]) are merged as plain maps, with the
+// order restored in the result.
 //
 // Example:
 //
@@ -287,17 +729,110 @@ func Merge(
 func (m *UntypedMerger) MergeUnstructured(docs ...any) (any, error) {
 	var result any
 	var err error
+	if m.checkDeterminism {
+		result, err = m.mergeTwice(docs)
+	} else {
+		result, err = m.mergeUnstructured(docs...)
+	}
+	m.nameDocuments(err)
+	return result, err
+}
+
+func (m *UntypedMerger) mergeUnstructured(docs ...any) (any, error) {
+	return m.mergeDocuments(docs, nil)
+}
+
+// mergeDocuments merges docs, calling step (if not nil) after each document
+// has been merged and checked, with the document as it was merged and the
+// accumulated result before and after it. Merges and traces both go through
+// it, so that they check the same things.
+func (m *UntypedMerger) mergeDocuments(docs []any, step func(i int, doc, before, after any)) (any, error) {
+	defer m.acquire()()
+	var result any
+	var err error
+	var assertions []assertion
+	var ordered bool
+	m.values = 0
+	m.duplicates = nil
+	m.claims = nil
+	m.startLimits()
 	for i, doc := range docs {
 		m.reset(i)
-		result, err = m.mergeValues(result, doc)
+		if err := m.checkLimits(doc); err != nil {
+			return nil, err
+		}
+		if plain, changed := unorder(doc); changed {
+			// Merge plain maps, restoring key order from the documents afterwards
+			doc, ordered = plain, true
+		}
+		doc, err = m.normalizeKeys(doc)
+		if err != nil {
+			return nil, err
+		}
+		var docAssertions []assertion
+		doc, docAssertions, err = m.extractAssertions(doc)
+		if err != nil {
+			return nil, err
+		}
+		assertions = append(assertions, docAssertions...)
+		if m.opts.RejectUnknownFields {
+			if err := m.checkUnknownFields(doc); err != nil {
+				return nil, err
+			}
+		}
+		if m.opts.CollectDuplicates {
+			m.collectDuplicates(doc)
+		}
+		if i > 0 && m.opts.DupeMatrix != nil && m.opts.DupeMatrix.Across == DupeUnique {
+			if m.claims == nil {
+				m.claims = make(map[itemClaim]int)
+			}
+			if err := m.claimItems(doc, ""); err != nil {
+				return nil, err
+			}
+		}
+		next, err := m.mergeValues(result, doc)
 		if err != nil {
 			return nil, err
 		}
+		if next, err = m.applyMoves(next); err != nil {
+			return nil, err
+		}
+		if m.opts.Prune && i > 0 && i == len(docs)-1 {
+			if next, err = m.prune(next, doc); err != nil {
+				return nil, err
+			}
+		}
+		if err := m.checkGrant(i, result, next); err != nil {
+			return nil, err
+		}
+		if err := m.checkProtected(i, result, next); err != nil {
+			return nil, err
+		}
+		if step != nil {
+			step(i, doc, result, next)
+		}
+		result = next
+	}
+	if err := m.duplicateError(); err != nil {
+		return nil, err
 	}
 
 	// Strip delete marker keys from the final result
 	result = m.stripDeleteMarker(result)
 
+	if err := checkAssertions(result, assertions); err != nil {
+		return nil, err
+	}
+	if m.opts.Preset == PresetFeatureFlags {
+		if err := checkFeatureFlags(result); err != nil {
+			return nil, err
+		}
+	}
+	if ordered {
+		m.reset(0)
+		result = m.restoreOrder(result, docs)
+	}
 	return result, nil
 }
 
@@ -323,22 +858,9 @@ func (m *UntypedMerger) Merge(
 	if len(docs) == 0 {
 		return []byte{}, nil
 	}
-	if m.unmarshal == nil || m.marshal == nil {
-		return nil, fmt.Errorf("cannot merge unstructured documents without a unmarshal function")
-	}
-
-	// Parse all documents
-	parsedDocs := make([]any, len(docs))
-	for i, doc := range docs {
-		var current any
-		if err := m.unmarshal(doc, &current); err != nil {
-			return nil, &MarshalError{
-				Err:       err,
-				Operation: "unmarshal",
-				DocIndex:  i,
-			}
-		}
-		parsedDocs[i] = current
+	parsedDocs, err := m.unmarshalDocs(docs)
+	if err != nil {
+		return nil, err
 	}
 
 	// MergeUnstructured
@@ -359,6 +881,31 @@ func (m *UntypedMerger) Merge(
 	return marshaled, nil
 }
 
+// unmarshalDocs parses documents with the merger's unmarshal function.
+func (m *UntypedMerger) unmarshalDocs(docs [][]byte) ([]any, error) {
+	if m.unmarshal == nil || m.marshal == nil {
+		return nil, fmt.Errorf("cannot merge unstructured documents without a unmarshal function")
+	}
+
+	parsedDocs := make([]any, len(docs))
+	for i, doc := range docs {
+		if m.limits.MaxBytes > 0 && len(doc) > m.limits.MaxBytes {
+			return nil, &LimitError{Limit: "MaxBytes", DocIndex: i, DocName: m.docName(i)}
+		}
+		var current any
+		if err := m.unmarshal(doc, &current); err != nil {
+			return nil, &MarshalError{
+				Err:       err,
+				Operation: "unmarshal",
+				DocIndex:  i,
+				DocName:   m.docName(i),
+			}
+		}
+		parsedDocs[i] = current
+	}
+	return parsedDocs, nil
+}
+
 func (m *UntypedMerger) reset(i int) {
 	m.path = nil
 	m.index = i
@@ -373,10 +920,12 @@ func (m *UntypedMerger) push(name string) {
 
 	// Get parent metadata (last segment in path, or root if empty)
 	var parentMeta *fieldMetadata
+	var deleteMarker *string
 	if len(m.path) == 0 {
 		parentMeta = m.metadata
 	} else {
 		parentMeta = m.path[len(m.path)-1].meta
+		deleteMarker = m.path[len(m.path)-1].deleteMarker
 	}
 
 	// Determine metadata for this segment
@@ -390,7 +939,11 @@ func (m *UntypedMerger) push(name string) {
 		segmentMeta = parentMeta.children[name]
 	}
 
-	m.path = append(m.path, pathSegment{name: name, meta: segmentMeta})
+	if segmentMeta != nil && segmentMeta.deleteMarker != nil {
+		deleteMarker = segmentMeta.deleteMarker
+	}
+
+	m.path = append(m.path, pathSegment{name: name, meta: segmentMeta, deleteMarker: deleteMarker})
 }
 
 func (m *UntypedMerger) pop() {
@@ -410,6 +963,15 @@ func (m *UntypedMerger) pathNames() []string {
 }
 
 func (m *UntypedMerger) mergeValues(base, overlay any) (any, error) {
+	if err := m.tick(); err != nil {
+		return nil, err
+	}
+
+	// Overlays cannot set fields tagged km:"ignore", wherever they occur
+	if len(m.path) == 0 && m.index > 0 && anyField(m.metadata, isIgnored) {
+		overlay = dropIgnored(overlay, m.metadata)
+	}
+
 	// If overlay is nil, keep base
 	if overlay == nil {
 		return base, nil
@@ -417,15 +979,41 @@ func (m *UntypedMerger) mergeValues(base, overlay any) (any, error) {
 
 	// If base is nil, use overlay
 	if base == nil {
-		return overlay, nil
+		if len(m.path) == 0 {
+			// Nulls of the first document are values, not deletions
+			return overlay, nil
+		}
+		return m.dropNulls(overlay), nil
+	}
+
+	// A marked conflict collects every later value as another candidate
+	if candidates, ok := m.conflictCandidates(base); ok {
+		return m.markConflict(candidates, overlay), nil
+	}
+
+	// A field tagged km:"replace" takes the overlay's value as it is
+	if m.replacesValue() {
+		return m.dropNulls(overlay), nil
+	}
+
+	// List items whose type implements CustomMerger merge themselves
+	if custom := m.customMerger(); custom != nil {
+		return m.mergeCustom(custom, base, overlay)
 	}
 
 	// Handle maps
 	baseMap, baseIsMap := base.(map[string]any)
 	overlayMap, overlayIsMap := overlay.(map[string]any)
+	if isMap(base) && isMap(overlay) && m.replacesMap() {
+		return m.dropNulls(overlay), nil
+	}
 	if baseIsMap && overlayIsMap {
 		return m.mergeMaps(baseMap, overlayMap)
 	}
+	if isMap(base) && isMap(overlay) {
+		// At least one side has non-string keys (see MapKeysPreserve)
+		return m.mergeAnyMaps(asAnyMap(base), asAnyMap(overlay))
+	}
 
 	// Handle slices
 	// Try direct type assertion first (fast path for []any)
@@ -445,11 +1033,117 @@ func (m *UntypedMerger) mergeValues(base, overlay any) (any, error) {
 		return m.mergeSlices(baseSlice, overlaySlice)
 	}
 
+	// Scalar values are combined by a strategy if one applies
+	if !baseIsSlice && !overlayIsSlice && !isMap(base) && !isMap(overlay) {
+		if strategy := m.scalarStrategy(); strategy != nil {
+			return m.combineScalars(strategy, base, overlay)
+		}
+	}
+
 	// For scalar values, overlay wins
-	return overlay, nil
+	if m.opts.ConflictMode != ConflictOverride && !baseIsSlice && !isMap(base) && !equalValues(base, overlay) {
+		if m.opts.ConflictMode == ConflictMark {
+			return m.markConflict([]any{base}, overlay), nil
+		}
+		return nil, &ConflictError{
+			Path:     m.pathNames(),
+			Base:     base,
+			Overlay:  overlay,
+			DocIndex: m.index,
+		}
+	}
+	return m.dropNulls(overlay), nil
+}
+
+// anyField reports whether f is true of any field under meta.
+func anyField(meta *fieldMetadata, f func(*fieldMetadata) bool) bool {
+	if meta == nil {
+		return false
+	}
+	for _, child := range meta.children {
+		if f(child) || anyField(child, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// isIgnored reports whether a field is tagged km:"ignore".
+func isIgnored(meta *fieldMetadata) bool {
+	return meta.ignore
+}
+
+// dropIgnored returns a copy of value without the fields that meta's children
+// tag km:"ignore". The items of lists are described by the list's metadata.
+func dropIgnored(value any, meta *fieldMetadata) any {
+	if !anyField(meta, isIgnored) {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for k, val := range v {
+			child := meta.children[k]
+			if child != nil && child.ignore {
+				continue
+			}
+			result[k] = dropIgnored(val, child)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = dropIgnored(item, meta)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// replacesValue reports whether overlays replace the value at the current path
+// without merging into it, whether it is a map, a list, or a scalar.
+func (m *UntypedMerger) replacesValue() bool {
+	meta := m.getCurrentMetadata()
+	return meta != nil && meta.replace
+}
+
+// replacesMap reports whether overlays replace the map at the current path
+// instead of merging with it (see [Options.ReplaceMaps]).
+func (m *UntypedMerger) replacesMap() bool {
+	if meta := m.getCurrentMetadata(); meta != nil && meta.replaceMap {
+		return true
+	}
+	for _, pattern := range m.replaceMaps {
+		if matchesSegments(pattern, m.path) {
+			return true
+		}
+	}
+	return false
 }
 
 func (m *UntypedMerger) mergeMaps(base, overlay map[string]any) (map[string]any, error) {
+	depth := len(m.path)
+	result, err := m.mergeEntries(base, overlay, maps.All(overlay))
+	if err != nil {
+		// Map iteration order is random, so merge again in key order to report
+		// the first error by key, and fail the same way every time
+		m.path = m.path[:depth]
+		_, err = m.mergeEntries(base, overlay, func(yield func(string, any) bool) {
+			for _, k := range slices.Sorted(maps.Keys(overlay)) {
+				if !yield(k, overlay[k]) {
+					return
+				}
+			}
+		})
+		return nil, err
+	}
+	return result, nil
+}
+
+// mergeEntries merges the entries of overlay into a copy of base, in the order
+// entries visits them.
+func (m *UntypedMerger) mergeEntries(base, overlay map[string]any, entries iter.Seq2[string, any]) (map[string]any, error) {
 	// Pre-allocate for base size since overlay keys may overlap
 	result := make(map[string]any, len(base))
 
@@ -459,12 +1153,21 @@ func (m *UntypedMerger) mergeMaps(base, overlay map[string]any) (map[string]any,
 	}
 
 	// MergeUnstructured overlay
-	for k, v := range overlay {
+	for k, v := range entries {
 		m.push(k)
 
 		// Check if this key is marked for deletion
-		if m.isMarkedForDeletion(v) {
-			delete(result, k)
+		if m.isMarkedForDeletion(v) || (v == nil && m.opts.NullMode == NullDelete) {
+			if baseVal, exists := result[k]; exists {
+				if err := m.checkImmutable(baseVal, nil); err != nil {
+					return nil, err
+				}
+				if err := m.checkDelete(baseVal); err != nil {
+					return nil, err
+				}
+				delete(result, k)
+			}
+			m.pop()
 			continue
 		}
 
@@ -473,9 +1176,12 @@ func (m *UntypedMerger) mergeMaps(base, overlay map[string]any) (map[string]any,
 			if err != nil {
 				return nil, err
 			}
+			if err := m.checkImmutable(baseVal, merged); err != nil {
+				return nil, err
+			}
 			result[k] = merged
 		} else {
-			result[k] = v
+			result[k] = m.dropNulls(v)
 		}
 
 		m.pop()
@@ -487,29 +1193,38 @@ func (m *UntypedMerger) mergeMaps(base, overlay map[string]any) (map[string]any,
 func (m *UntypedMerger) mergeSlices(base, overlay []any) ([]any, error) {
 	// Check if items have primary keys
 	if len(overlay) == 0 {
+		if m.emptyListReplaces() {
+			return overlay, nil
+		}
 		return base, nil
 	}
 
+	if meta := m.getCurrentMetadata(); meta != nil && meta.opaque {
+		return mergeOpaque(base, overlay), nil
+	}
+
+	if len(m.listMatchers) > 0 {
+		if matcher := m.listMatcher(); matcher != nil {
+			return m.mergeSlicesMatched(base, overlay, matcher)
+		}
+	}
+
 	// Try to find primary key by checking overlay items until we find one.
 	// This handles cases where the first item might not have a primary key
 	// but subsequent items do.
 	var hasKeys bool
-	for _, item := range overlay {
-		if m.getPrimaryKey(item) != nil {
-			hasKeys = true
+	for i, item := range overlay {
+		m.push(strconv.Itoa(i))
+		hasKeys = m.getPrimaryKey(item) != nil
+		m.pop()
+		if hasKeys {
 			break
 		}
 	}
 
 	if !hasKeys {
 		// No primary key found in any overlay item, merge according to ScalarMode
-		scalarMode := m.opts.ScalarMode
-		// Check metadata for override
-		if meta := m.getCurrentMetadata(); meta != nil && meta.scalarMode != nil {
-			scalarMode = *meta.scalarMode
-		}
-
-		switch scalarMode {
+		switch m.scalarMode() {
 		case ScalarReplace:
 			return overlay, nil
 		case ScalarDedup:
@@ -522,10 +1237,18 @@ func (m *UntypedMerger) mergeSlices(base, overlay []any) ([]any, error) {
 		}
 	}
 
-	// Get the object list mode for this context
-	objectMode := m.opts.DupeMode
-	if meta := m.getCurrentMetadata(); meta != nil && meta.dupeMode != nil {
-		objectMode = *meta.dupeMode
+	// Get the object list modes for this context. Duplicates in the base list
+	// come from the first document, since later ones are merged into it.
+	baseMode, objectMode := m.listDupeMode(true), m.listDupeMode(false)
+	if m.opts.CollectDuplicates {
+		// Duplicates were collected before merging and fail the merge at the end
+		baseMode, objectMode = DupeConsolidate, DupeConsolidate
+	}
+
+	if m.opts.KeyMatchMode == KeyMatchAny && m.identityFor(m.path) == nil {
+		if meta := m.getCurrentMetadata(); meta == nil || len(meta.primaryKeys) == 0 {
+			return m.mergeSlicesAnyKey(base, overlay, baseMode, objectMode)
+		}
 	}
 
 	// Build index of items by composite primary key
@@ -566,7 +1289,7 @@ func (m *UntypedMerger) mergeSlices(base, overlay []any) ([]any, error) {
 		}
 
 		// Duplicate found!
-		if objectMode == DupeUnique {
+		if baseMode == DupeUnique {
 			err := &DuplicatePrimaryKeyError{
 				Key:       keyString(key),
 				Positions: []int{existingIdx, i},
@@ -643,6 +1366,12 @@ func (m *UntypedMerger) mergeSlices(base, overlay []any) ([]any, error) {
 			if key != nil {
 				mapKey := toMapKey(key)
 				if idx, exists := resultIndex[mapKey]; exists {
+					m.pop()
+					m.push(strconv.Itoa(idx))
+					if err := m.checkDelete(result[idx]); err != nil {
+						m.pop()
+						return nil, err
+					}
 					// Mark for deletion by setting to nil, we'll filter later
 					result[idx] = nil
 					delete(resultIndex, mapKey)
@@ -652,6 +1381,31 @@ func (m *UntypedMerger) mergeSlices(base, overlay []any) ([]any, error) {
 			continue
 		}
 
+		// Take items with a move marker out of the list, to move them later
+		if to, moved := m.moveDestination(overlayItem); moved {
+			key := m.getPrimaryKey(overlayItem)
+			if key == nil || !isKeyComparable(key) {
+				err := &MoveError{To: to, Reason: "moved items need a primary key", Path: m.pathNames(), DocIndex: m.index}
+				m.pop()
+				return nil, err
+			}
+			var existing any
+			mapKey := toMapKey(key)
+			if idx, exists := resultIndex[mapKey]; exists {
+				m.pop()
+				m.push(strconv.Itoa(idx))
+				existing = result[idx]
+				result[idx] = nil
+				delete(resultIndex, mapKey)
+			}
+			err := m.takeMove(existing, overlayItem, to)
+			m.pop()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
 		key := m.getPrimaryKey(overlayItem)
 		if key == nil {
 			// No key, append
@@ -685,14 +1439,14 @@ func (m *UntypedMerger) mergeSlices(base, overlay []any) ([]any, error) {
 			result[idx] = merged
 		} else {
 			// Append new item
-			result = append(result, overlayItem)
+			result = append(result, m.dropNulls(overlayItem))
 			resultIndex[mapKey] = len(result) - 1
 			m.pop()
 		}
 	}
 
 	// Filter out nil items (deleted items or consolidated duplicates)
-	if m.opts.DeleteMarkerKey != "" || objectMode == DupeConsolidate {
+	if m.deleteMarkerKey() != "" || m.opts.MoveMarkerKey != "" || baseMode == DupeConsolidate || objectMode == DupeConsolidate {
 		filtered := make([]any, 0, len(result))
 		for _, item := range result {
 			if item != nil {
@@ -705,18 +1459,36 @@ func (m *UntypedMerger) mergeSlices(base, overlay []any) ([]any, error) {
 	return result, nil
 }
 
-// stripDeleteMarker removes the delete marker key from a value recursively.
+// stripDeleteMarker removes the delete and move marker keys from a value recursively.
 func (m *UntypedMerger) stripDeleteMarker(value any) any {
-	if m.opts.DeleteMarkerKey == "" {
+	if m.opts.DeleteMarkerKey == "" && m.opts.MoveMarkerKey == "" && !anyField(m.metadata, hasDeleteMarker) {
 		return value
 	}
+	return m.stripMarkers(value)
+}
+
+// stripMarkers implements stripDeleteMarker, tracking the path so that the
+// delete marker keys of tagged fields are removed.
+func (m *UntypedMerger) stripMarkers(value any) any {
 	switch v := value.(type) {
 	case map[string]any:
-		// Create new map without the delete marker
+		// Create new map without the markers
 		result := make(map[string]any, len(v))
 		for k, val := range v {
-			if k != m.opts.DeleteMarkerKey {
-				result[k] = m.stripDeleteMarker(val)
+			if !m.isMarkerKey(k) {
+				m.push(k)
+				result[k] = m.stripMarkers(val)
+				m.pop()
+			}
+		}
+		return result
+	case map[any]any:
+		result := make(map[any]any, len(v))
+		for k, val := range v {
+			if name, ok := k.(string); !ok || !m.isMarkerKey(name) {
+				m.push(fmt.Sprint(k))
+				result[k] = m.stripMarkers(val)
+				m.pop()
 			}
 		}
 		return result
@@ -724,7 +1496,9 @@ func (m *UntypedMerger) stripDeleteMarker(value any) any {
 		// Recursively strip from list items
 		result := make([]any, len(v))
 		for i, item := range v {
-			result[i] = m.stripDeleteMarker(item)
+			m.push(strconv.Itoa(i))
+			result[i] = m.stripMarkers(item)
+			m.pop()
 		}
 		return result
 	default:
@@ -732,6 +1506,27 @@ func (m *UntypedMerger) stripDeleteMarker(value any) any {
 	}
 }
 
+// isMarkerKey reports whether a map key is the delete or move marker key of
+// the map at the current path.
+func (m *UntypedMerger) isMarkerKey(key string) bool {
+	return key != "" && (key == m.deleteMarkerKey() || key == m.opts.MoveMarkerKey)
+}
+
+// deleteMarkerKey returns the delete marker key at the current path: the one a
+// km:"delete-marker=..." tag of this or an enclosing field sets, or else
+// [Options.DeleteMarkerKey].
+func (m *UntypedMerger) deleteMarkerKey() string {
+	if len(m.path) > 0 && m.path[len(m.path)-1].deleteMarker != nil {
+		return *m.path[len(m.path)-1].deleteMarker
+	}
+	return m.opts.DeleteMarkerKey
+}
+
+// hasDeleteMarker reports whether a field's tag sets its delete marker key.
+func hasDeleteMarker(meta *fieldMetadata) bool {
+	return meta.deleteMarker != nil
+}
+
 // getCurrentMetadata returns the metadata for the current path in the document tree.
 // Returns nil if no metadata exists (untyped merger or path not in metadata tree).
 // This is O(1) since metadata is cached in the path during push().
@@ -742,6 +1537,15 @@ func (m *UntypedMerger) getCurrentMetadata() *fieldMetadata {
 	return m.path[len(m.path)-1].meta
 }
 
+// emptyListReplaces reports whether an empty overlay list replaces the list at
+// the current path, by its km:"empty=..." tag or the options.
+func (m *UntypedMerger) emptyListReplaces() bool {
+	if meta := m.getCurrentMetadata(); meta != nil && meta.emptyMode != nil {
+		return *meta.emptyMode == EmptyReplace
+	}
+	return m.opts.EmptyLists == EmptyReplace || m.opts.NullMode == NullDelete
+}
+
 // isNumeric checks if a string represents a number (array index).
 func isNumeric(s string) bool {
 	if len(s) == 0 {
@@ -763,7 +1567,8 @@ func isNumeric(s string) bool {
 // []map[string]interface{} rather than []any.
 func toSliceAny(v any) ([]any, bool) {
 	rv := reflect.ValueOf(v)
-	if rv.Kind() != reflect.Slice {
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		// Byte slices such as json.RawMessage are opaque values, not lists
 		return nil, false
 	}
 
@@ -776,43 +1581,36 @@ func toSliceAny(v any) ([]any, bool) {
 	return result, true
 }
 
-// compositeKey represents a composite primary key value for map indexing.
-//
-// When multiple fields are marked with km:"primary", ALL fields must be present
-// and match for two items to be considered the same. This enables matching on
-// combinations like {region, name} or {namespace, kind, name}.
-//
-// Values contains multiple key field values in field declaration order.
-// This type is only used for multi-field composite keys. Single-field keys
-// use the value directly without allocation.
-//
-// Example:
-//
-//	type Endpoint struct {
-//	    Region string `yaml:"region" km:"primary"`
-//	    Name   string `yaml:"name" km:"primary"`
-//	    URL    string `yaml:"url"`
-//	}
-//
-// Items match only when BOTH region AND name are equal.
-type compositeKey struct {
-	values []any
+// getPrimaryKey extracts the primary key value from an item for use as a map key,
+// normalized by the list's [KeyNormalizer] if it has one. The item's index must
+// be pushed onto the path. Returns nil if item is not a map or doesn't have any
+// primary key fields.
+func (m *UntypedMerger) getPrimaryKey(item any) any {
+	key := m.rawPrimaryKey(item)
+	if key == nil || len(m.keyNormalizers) == 0 {
+		return key
+	}
+	return m.normalizeKey(key)
 }
 
-// getPrimaryKey extracts the primary key value from an item for use as a map key.
-// Returns nil if item is not a map or doesn't have any primary key fields.
+// rawPrimaryKey extracts the primary key value from an item as it appears in the item.
 //
 // For single-key cases (most common), returns the key value directly (no allocation).
-// For composite keys (multiple km:"primary" tags), returns a *compositeKey that implements
+// For composite keys (multiple km:"primary" tags), returns a *Key that implements
 // comparable operations and string formatting.
 //
 // For metadata-defined composite keys, ALL key fields must be present.
+// For [Options.CompositeKeys], returns the key of the FIRST set whose fields all exist.
 // For global PrimaryKeyNames (backward compatibility), returns the FIRST key that exists.
-func (m *UntypedMerger) getPrimaryKey(item any) any {
-	mp, ok := item.(map[string]any)
-	if !ok {
+// [Options.KeyFunc], if set, overrides all of these, and an identity function
+// (see [UntypedMerger.SetIdentityFuncs]) overrides it for its lists.
+func (m *UntypedMerger) rawPrimaryKey(item any) any {
+	if !isMap(item) {
 		return nil
 	}
+	if m.keyedByFunc() {
+		return m.funcKey(item)
+	}
 
 	// Get metadata for the current path (which should be a list field)
 	meta := m.getCurrentMetadata()
@@ -820,31 +1618,18 @@ func (m *UntypedMerger) getPrimaryKey(item any) any {
 	// If metadata defines primary keys, this is a composite key - require ALL fields
 	// Note: meta.primaryKeys contains the keys from the item type (inherited during buildMetadata)
 	if meta != nil && len(meta.primaryKeys) > 0 {
-		// Optimize single-key case to avoid allocation
-		if len(meta.primaryKeys) == 1 {
-			val, exists := mp[meta.primaryKeys[0]]
-			if !exists || val == nil {
-				return nil
-			}
-			return val
-		}
+		return compositeKey(item, meta.primaryKeys)
+	}
 
-		// Multi-key case - still need compositeKey wrapper
-		values := make([]any, 0, len(meta.primaryKeys))
-		for _, keyName := range meta.primaryKeys {
-			val, exists := mp[keyName]
-			if !exists || val == nil {
-				// Missing a required key field in composite key
-				return nil
-			}
-			values = append(values, val)
+	for _, names := range m.opts.CompositeKeys {
+		if key := compositeKey(item, names); key != nil {
+			return key
 		}
-		return &compositeKey{values: values}
 	}
 
 	// Fall back to global options - use FIRST matching key (backward compatibility)
 	for _, keyName := range m.opts.PrimaryKeyNames {
-		val, exists := mp[keyName]
+		val, exists := keyFieldValue(item, keyName)
 		if exists && val != nil {
 			return val
 		}
@@ -853,25 +1638,70 @@ func (m *UntypedMerger) getPrimaryKey(item any) any {
 	return nil
 }
 
-// String returns a string representation of the composite key for error messages.
-func (ck *compositeKey) String() string {
-	return fmt.Sprintf("%v", ck.values)
+// funcKey returns the key the list's identity function or [Options.KeyFunc]
+// gives item, or nil if it gives none. The item's index must be pushed onto
+// the path.
+func (m *UntypedMerger) funcKey(item any) any {
+	mp, ok := item.(map[string]any)
+	if !ok || len(m.path) == 0 {
+		return nil
+	}
+	var key any
+	if identity := m.listIdentity(); identity != nil {
+		key, ok = identity(mp)
+	} else {
+		names := m.pathNames()
+		key, ok = m.opts.KeyFunc(names[:len(names)-1], mp)
+	}
+	if !ok {
+		return nil
+	}
+	if composite, ok := key.(Key); ok {
+		// Key holds a slice, so it is only comparable through a pointer
+		return &composite
+	}
+	return key
 }
 
-// isComparable checks if all values in the composite key are comparable.
-func (ck *compositeKey) isComparable() bool {
-	for _, v := range ck.values {
-		if !isComparable(v) {
-			return false
+// compositeKey returns the key of item made of all of the named fields, or nil
+// if item lacks any of them. A single field's value is returned directly to
+// avoid allocation; several are wrapped in a *Key.
+func compositeKey(item any, names []string) any {
+	if len(names) == 1 {
+		val, exists := keyFieldValue(item, names[0])
+		if !exists || val == nil {
+			return nil
 		}
+		return val
 	}
-	return true
+
+	values := make([]any, 0, len(names))
+	for _, keyName := range names {
+		val, exists := keyFieldValue(item, keyName)
+		if !exists || val == nil {
+			// Missing a required key field in composite key
+			return nil
+		}
+		values = append(values, val)
+	}
+	return &Key{values: values}
+}
+
+// compositeKeyFields returns the first of [Options.CompositeKeys] whose fields
+// item all has, or nil if it has none of them.
+func (m *UntypedMerger) compositeKeyFields(item any) []string {
+	for _, names := range m.opts.CompositeKeys {
+		if compositeKey(item, names) != nil {
+			return names
+		}
+	}
+	return nil
 }
 
 // keyString formats a primary key value for error messages.
 // Handles both direct values and composite keys.
 func keyString(key any) string {
-	if ck, ok := key.(*compositeKey); ok {
+	if ck, ok := key.(*Key); ok {
 		return ck.String()
 	}
 	return fmt.Sprintf("%v", key)
@@ -882,8 +1712,8 @@ func keyString(key any) string {
 // For composite keys, returns a type-preserving string representation
 // using %#v to avoid collisions between different types (e.g., int 1 vs string "1").
 func toMapKey(key any) any {
-	if ck, ok := key.(*compositeKey); ok {
-		return fmt.Sprintf("%#v", ck.values)
+	if ck, ok := key.(*Key); ok {
+		return ck.mapKey()
 	}
 	return key
 }
@@ -892,7 +1722,7 @@ func toMapKey(key any) any {
 // For single values, checks if the value type is comparable.
 // For composite keys, checks if all component values are comparable.
 func isKeyComparable(key any) bool {
-	if ck, ok := key.(*compositeKey); ok {
+	if ck, ok := key.(*Key); ok {
 		return ck.isComparable()
 	}
 	return isComparable(key)
@@ -907,18 +1737,43 @@ func isComparable(value any) bool {
 	return reflect.TypeOf(value).Comparable()
 }
 
-// isMarkedForDeletion checks if a value has the delete marker set to true.
-func (m *UntypedMerger) isMarkedForDeletion(value any) bool {
-	if m.opts.DeleteMarkerKey == "" {
-		return false
+// dropNulls returns value without nil map values, recursively, if nil values
+// delete (see [NullDelete]). Lists are values in their own right and are kept
+// as they are.
+func (m *UntypedMerger) dropNulls(value any) any {
+	if m.opts.NullMode != NullDelete {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for k, val := range v {
+			if val != nil {
+				result[k] = m.dropNulls(val)
+			}
+		}
+		return result
+	case map[any]any:
+		result := make(map[any]any, len(v))
+		for k, val := range v {
+			if val != nil {
+				result[k] = m.dropNulls(val)
+			}
+		}
+		return result
+	default:
+		return value
 	}
+}
 
-	mp, ok := value.(map[string]any)
-	if !ok {
+// isMarkedForDeletion checks if a value has the delete marker set to true.
+func (m *UntypedMerger) isMarkedForDeletion(value any) bool {
+	key := m.deleteMarkerKey()
+	if key == "" {
 		return false
 	}
 
-	marker, exists := mp[m.opts.DeleteMarkerKey]
+	marker, exists := fieldValue(value, key)
 	if !exists {
 		return false
 	}
@@ -942,13 +1797,17 @@ func deduplicateList(base, overlay []any) []any {
 	// Add items from base
 	for _, item := range base {
 		switch item.(type) {
-		case map[string]any, []any:
+		case map[string]any, map[any]any, []any:
 			// Maps and slices aren't comparable, always add them
 			result = append(result, item)
 		default:
 			// For scalars, use map to track uniqueness
-			if _, exists := seen[item]; !exists {
-				seen[item] = struct{}{}
+			key := item
+			if _, isBytes := asBytes(item); isBytes {
+				key = canonicalContent(item)
+			}
+			if _, exists := seen[key]; !exists {
+				seen[key] = struct{}{}
 				result = append(result, item)
 			}
 		}
@@ -957,13 +1816,17 @@ func deduplicateList(base, overlay []any) []any {
 	// Add items from overlay
 	for _, item := range overlay {
 		switch item.(type) {
-		case map[string]any, []any:
+		case map[string]any, map[any]any, []any:
 			// Maps and slices aren't comparable, always add them
 			result = append(result, item)
 		default:
 			// For scalars, use map to track uniqueness
-			if _, exists := seen[item]; !exists {
-				seen[item] = struct{}{}
+			key := item
+			if _, isBytes := asBytes(item); isBytes {
+				key = canonicalContent(item)
+			}
+			if _, exists := seen[key]; !exists {
+				seen[key] = struct{}{}
 				result = append(result, item)
 			}
 		}
@@ -5,6 +5,7 @@ package keymerge_test
 import (
 	_ "embed"
 	"errors"
+	"fmt"
 	"reflect"
 	"slices"
 	"strings"
@@ -1279,6 +1280,182 @@ func TestDupeMode_String(t *testing.T) {
 	}
 }
 
+func TestEmptyLists(t *testing.T) {
+	base := map[string]any{
+		"hosts":    []any{"a", "b"},
+		"services": []any{map[string]any{"name": "web"}},
+	}
+	overlay := map[string]any{"hosts": []any{}, "services": []any{}}
+
+	result, err := keymerge.MergeUnstructured(keymerge.Options{PrimaryKeyNames: []string{"name"}}, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, base) {
+		t.Errorf("expected empty lists to keep the base lists, got %v", result)
+	}
+
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}, EmptyLists: keymerge.EmptyReplace}
+	result, err = keymerge.MergeUnstructured(opts, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, overlay) {
+		t.Errorf("expected empty lists to clear the base lists, got %v", result)
+	}
+
+	// Diff clears lists with empty ones, which it can't do otherwise
+	opts.ScalarMode = keymerge.ScalarReplace
+	diff, err := keymerge.Diff(opts, map[string]any{"hosts": []any{"a"}}, map[string]any{"hosts": []any{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]any{"hosts": []any{}}; !reflect.DeepEqual(diff, want) {
+		t.Errorf("got diff %v, want %v", diff, want)
+	}
+}
+
+func TestEmptyListMode_String(t *testing.T) {
+	tests := []struct {
+		mode keymerge.EmptyListMode
+		want string
+	}{
+		{keymerge.EmptyKeep, "EmptyKeep"},
+		{keymerge.EmptyReplace, "EmptyReplace"},
+		{keymerge.EmptyListMode(99), "EmptyListMode(99)"},
+	}
+	for _, tt := range tests {
+		if got := tt.mode.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestConflictMode_String(t *testing.T) {
+	tests := []struct {
+		mode keymerge.ConflictMode
+		want string
+	}{
+		{keymerge.ConflictOverride, "ConflictOverride"},
+		{keymerge.ConflictStrict, "ConflictStrict"},
+		{keymerge.ConflictMark, "ConflictMark"},
+		{keymerge.ConflictMode(99), "ConflictMode(99)"}, // Invalid value
+	}
+
+	for _, tt := range tests {
+		if got := tt.mode.String(); got != tt.want {
+			t.Errorf("%v.String() = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestConflictMode_StrictErrorsOnReplacedScalar(t *testing.T) {
+	base := []byte(`
+services:
+  - name: api
+    port: 8080
+`)
+	overlay := []byte(`
+services:
+  - name: api
+    port: 9090
+`)
+
+	_, err := mergeYAMLWith(keymerge.Options{
+		PrimaryKeyNames: []string{"name"},
+		ConflictMode:    keymerge.ConflictStrict,
+	}, base, overlay)
+	if !errors.Is(err, keymerge.ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+
+	var conflictErr *keymerge.ConflictError
+	if !errors.As(err, &conflictErr) {
+		t.Fatalf("expected ConflictError, got %T: %v", err, err)
+	}
+	if !slices.Equal(conflictErr.Path, []string{"services", "0", "port"}) {
+		t.Errorf("expected conflict path 'services.0.port', got %v", conflictErr.Path)
+	}
+	if conflictErr.DocIndex != 1 {
+		t.Errorf("expected conflict in document 1, got %d", conflictErr.DocIndex)
+	}
+	if conflictErr.Base != uint64(8080) || conflictErr.Overlay != uint64(9090) {
+		t.Errorf("unexpected values: base %v (%T), overlay %v (%T)",
+			conflictErr.Base, conflictErr.Base, conflictErr.Overlay, conflictErr.Overlay)
+	}
+	if !strings.Contains(err.Error(), "services.0.port in document 1: 9090 would replace 8080") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+
+	// The default mode lets the overlay win.
+	result, err := mergeYAMLWith(keymerge.Options{PrimaryKeyNames: []string{"name"}}, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(result), "port: 9090") {
+		t.Errorf("expected overlay to win, got:\n%s", result)
+	}
+}
+
+func TestConflictMode_StrictAllowsNonConflictingChanges(t *testing.T) {
+	base := map[string]any{
+		"port":     8080,
+		"unset":    nil,
+		"tags":     []any{"a"},
+		"database": map[string]any{"host": "localhost"},
+		"debug":    true,
+	}
+	overlay := map[string]any{
+		"port":     float64(8080), // same value
+		"unset":    "now set",
+		"added":    1,
+		"tags":     []any{"b"},
+		"database": map[string]any{"pool": 10},
+		"debug":    map[string]any{"_delete": true},
+	}
+
+	result, err := keymerge.MergeUnstructured(keymerge.Options{
+		DeleteMarkerKey: "_delete",
+		ConflictMode:    keymerge.ConflictStrict,
+	}, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]any{
+		"port":     float64(8080),
+		"unset":    "now set",
+		"added":    1,
+		"tags":     []any{"a", "b"},
+		"database": map[string]any{"host": "localhost", "pool": 10},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected result:\n got: %v\nwant: %v", result, expected)
+	}
+
+	// Replacing a scalar with a map is a conflict too.
+	_, err = keymerge.MergeUnstructured(keymerge.Options{ConflictMode: keymerge.ConflictStrict},
+		map[string]any{"log": "info"}, map[string]any{"log": map[string]any{"level": "debug"}})
+	if !errors.Is(err, keymerge.ErrConflict) {
+		t.Errorf("expected ErrConflict, got %v", err)
+	}
+}
+
+func TestConflictMode_ErrorPathAfterDeletedKeys(t *testing.T) {
+	opts := keymerge.Options{NullMode: keymerge.NullDelete, ConflictMode: keymerge.ConflictStrict}
+	base := map[string]any{"a": 1, "b": 2, "c": 3, "d": 4, "port": 8080}
+	overlay := map[string]any{"a": nil, "b": nil, "c": nil, "d": nil, "port": 9090}
+
+	_, err := keymerge.MergeUnstructured(opts, base, overlay)
+	var conflictErr *keymerge.ConflictError
+	if !errors.As(err, &conflictErr) {
+		t.Fatalf("expected ConflictError, got %v", err)
+	}
+	if !slices.Equal(conflictErr.Path, []string{"port"}) {
+		t.Errorf("expected conflict path 'port', got %v", conflictErr.Path)
+	}
+}
+
 func TestNewMerger_EmptyPrimaryKeyName(t *testing.T) {
 	_, err := keymerge.NewUntypedMerger(keymerge.Options{
 		PrimaryKeyNames: []string{"id", "", "name"},
@@ -1311,6 +1488,156 @@ func TestMerge_EmptyPrimaryKeyName(t *testing.T) {
 	}
 }
 
+func TestCompositeKeys(t *testing.T) {
+	opts := keymerge.Options{
+		CompositeKeys:   [][]string{{"region", "name"}},
+		PrimaryKeyNames: []string{"id"},
+	}
+	base := map[string]any{"endpoints": []any{
+		map[string]any{"region": "us-east", "name": "api", "url": "v1-east"},
+		map[string]any{"region": "us-west", "name": "api", "url": "v1-west"},
+		map[string]any{"id": "legacy", "url": "v1-legacy"},
+	}}
+	overlay := map[string]any{"endpoints": []any{
+		map[string]any{"region": "us-east", "name": "api", "url": "v2-east"},
+		map[string]any{"region": "eu-west", "name": "api", "url": "v2-eu"},
+		map[string]any{"id": "legacy", "url": "v2-legacy"},
+	}}
+
+	result, err := keymerge.MergeUnstructured(opts, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"endpoints": []any{
+		map[string]any{"region": "us-east", "name": "api", "url": "v2-east"},
+		map[string]any{"region": "us-west", "name": "api", "url": "v1-west"},
+		map[string]any{"id": "legacy", "url": "v2-legacy"},
+		map[string]any{"region": "eu-west", "name": "api", "url": "v2-eu"},
+	}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("got %v, want %v", result, expected)
+	}
+
+	// Duplicates need every key field to match.
+	_, err = keymerge.MergeUnstructured(opts, base, map[string]any{"endpoints": []any{
+		map[string]any{"region": "us-west", "name": "api"},
+		map[string]any{"region": "us-west", "name": "api"},
+	}})
+	if !errors.Is(err, keymerge.ErrDuplicatePrimaryKey) {
+		t.Errorf("expected ErrDuplicatePrimaryKey, got %v", err)
+	}
+
+	// Diffs and comparisons identify items by all of their key fields.
+	desired := map[string]any{"endpoints": []any{
+		map[string]any{"region": "us-east", "name": "api", "url": "v3-east"},
+		map[string]any{"region": "us-west", "name": "api", "url": "v1-west"},
+		map[string]any{"id": "legacy", "url": "v2-legacy"},
+		map[string]any{"region": "eu-west", "name": "api", "url": "v2-eu"},
+	}}
+	diff, err := keymerge.Diff(opts, result, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedDiff := map[string]any{"endpoints": []any{
+		map[string]any{"region": "us-east", "name": "api", "url": "v3-east"},
+	}}
+	if !reflect.DeepEqual(diff, expectedDiff) {
+		t.Errorf("got diff %v, want %v", diff, expectedDiff)
+	}
+	changes, err := keymerge.Compare(opts, result, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Path != "endpoints[region=us-east,name=api].url" {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+}
+
+func TestNewMerger_InvalidCompositeKeys(t *testing.T) {
+	for _, opts := range []keymerge.Options{
+		{CompositeKeys: [][]string{{}}},
+		{CompositeKeys: [][]string{{"region", ""}}},
+		{CompositeKeys: [][]string{{"region", "name"}}, KeyMatchMode: keymerge.KeyMatchAny},
+	} {
+		if _, err := keymerge.NewUntypedMerger(opts, nil, nil); !errors.Is(err, keymerge.ErrInvalidOptions) {
+			t.Errorf("%+v: expected ErrInvalidOptions, got %v", opts, err)
+		}
+	}
+}
+
+func TestKeyFunc(t *testing.T) {
+	var paths [][]string
+	opts := keymerge.Options{
+		PrimaryKeyNames: []string{"name"}, // Ignored for matching
+		KeyFunc: func(path []string, item map[string]any) (any, bool) {
+			paths = append(paths, path)
+			host, ok := item["host"].(string)
+			if !ok {
+				return nil, false
+			}
+			return fmt.Sprintf("%s:%v", strings.ToLower(host), item["port"]), true
+		},
+	}
+	base := map[string]any{"backends": []any{
+		map[string]any{"name": "a", "host": "web", "port": 80, "weight": 1},
+		map[string]any{"name": "b", "host": "web", "port": 443, "weight": 1},
+	}}
+	overlay := map[string]any{"backends": []any{
+		map[string]any{"name": "c", "host": "WEB", "port": 443, "weight": 5},
+		map[string]any{"host": "db", "port": 5432},
+	}}
+
+	result, err := keymerge.MergeUnstructured(opts, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"backends": []any{
+		map[string]any{"name": "a", "host": "web", "port": 80, "weight": 1},
+		map[string]any{"name": "c", "host": "WEB", "port": 443, "weight": 5},
+		map[string]any{"host": "db", "port": 5432},
+	}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("got %v, want %v", result, expected)
+	}
+	if len(paths) == 0 || !slices.Equal(paths[0], []string{"backends"}) {
+		t.Errorf("expected KeyFunc to be called with the list path, got %v", paths)
+	}
+
+	// Diffs repeat the fields the key may be computed from.
+	desired := map[string]any{"backends": []any{
+		map[string]any{"name": "a", "host": "web", "port": 80, "weight": 2},
+		map[string]any{"name": "c", "host": "WEB", "port": 443, "weight": 5},
+		map[string]any{"host": "db", "port": 5432},
+	}}
+	diff, err := keymerge.Diff(opts, result, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedDiff := map[string]any{"backends": []any{
+		map[string]any{"name": "a", "host": "web", "port": 80, "weight": 2},
+	}}
+	if !reflect.DeepEqual(diff, expectedDiff) {
+		t.Errorf("got diff %v, want %v", diff, expectedDiff)
+	}
+
+	// Keys made of several values use NewKey.
+	opts.KeyFunc = func(_ []string, item map[string]any) (any, bool) {
+		return keymerge.NewKey(item["host"], item["port"]), true
+	}
+	_, err = keymerge.MergeUnstructured(opts, base, map[string]any{"backends": []any{
+		map[string]any{"host": "db", "port": 5432},
+		map[string]any{"host": "db", "port": 5432},
+	}})
+	if !errors.Is(err, keymerge.ErrDuplicatePrimaryKey) {
+		t.Errorf("expected ErrDuplicatePrimaryKey, got %v", err)
+	}
+
+	opts.KeyMatchMode = keymerge.KeyMatchAny
+	if _, err := keymerge.NewUntypedMerger(opts, nil, nil); !errors.Is(err, keymerge.ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions, got %v", err)
+	}
+}
+
 // TestMergeMixedFormats_TOMLSliceType tests that TOML array-of-tables (which
 // unmarshals to []map[string]any instead of []any) is correctly handled during
 // merge.
@@ -1371,3 +1698,50 @@ func TestMergeMixedFormats_TOMLSliceType(t *testing.T) {
 		t.Errorf("expected service names %v, got %v", expectedNames, serviceNames)
 	}
 }
+
+func TestReplaceMaps(t *testing.T) {
+	opts := keymerge.Options{
+		PrimaryKeyNames: []string{"name"},
+		ReplaceMaps:     []string{"deployments[*].selector", "**.labels"},
+	}
+	base := map[string]any{
+		"deployments": []any{map[string]any{
+			"name":     "web",
+			"selector": map[string]any{"app": "web", "tier": "frontend"},
+			"labels":   map[string]any{"team": "a"},
+			"config":   map[string]any{"debug": false},
+		}},
+		"metadata": map[string]any{"labels": map[string]any{"env": "dev"}},
+	}
+	overlay := map[string]any{
+		"deployments": []any{map[string]any{
+			"name":     "web",
+			"selector": map[string]any{"app": "web-v2"},
+			"labels":   map[string]any{},
+			"config":   map[string]any{"replicas": 2},
+		}},
+		"metadata": map[string]any{"labels": map[string]any{"env": "prod", "region": "us"}},
+	}
+	result, err := keymerge.MergeUnstructured(opts, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{
+		"deployments": []any{map[string]any{
+			"name":     "web",
+			"selector": map[string]any{"app": "web-v2"},
+			"labels":   map[string]any{},
+			"config":   map[string]any{"debug": false, "replicas": 2},
+		}},
+		"metadata": map[string]any{"labels": map[string]any{"env": "prod", "region": "us"}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %v, want %v", result, expected)
+	}
+
+	for _, patterns := range [][]string{{"labels["}, {"items[name=a].labels"}} {
+		if _, err := keymerge.NewUntypedMerger(keymerge.Options{ReplaceMaps: patterns}, nil, nil); !errors.Is(err, keymerge.ErrInvalidOptions) {
+			t.Errorf("%v: expected ErrInvalidOptions, got %v", patterns, err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+// MergeJSONMergePatch applies JSON Merge Patch (RFC 7386) documents left-to-right:
+// maps merge, nil values delete keys, and everything else replaces, including
+// lists. It merges with opts after setting [Options.NullMode] to [NullDelete]
+// and [Options.ScalarMode] to [ScalarReplace], so lists whose items have
+// [Options.PrimaryKeyNames] are still merged by key, and with no primary keys
+// the result is exactly that of RFC 7386. A nil patch replaces the whole
+// document with nil.
+//
+// Example:
+//
+//	target := map[string]any{"title": "Goodbye!", "author": map[string]any{
+//		"givenName": "John", "familyName": "Doe",
+//	}}
+//	patch := map[string]any{"title": "Hello!", "author": map[string]any{
+//		"familyName": nil,
+//	}}
+//	result, _ := MergeJSONMergePatch(Options{}, target, patch)
+//	// Result: {"title": "Hello!", "author": {"givenName": "John"}}
+func MergeJSONMergePatch(opts Options, docs ...any) (any, error) {
+	opts.NullMode = NullDelete
+	opts.ScalarMode = ScalarReplace
+	for i := len(docs) - 1; i > 0; i-- {
+		if docs[i] == nil {
+			if i == len(docs)-1 {
+				return nil, nil
+			}
+			// Later patches apply to an empty document, as RFC 7386 does
+			// for targets that are not objects.
+			docs = append([]any{map[string]any{}}, docs[i+1:]...)
+			break
+		}
+	}
+	return MergeUnstructured(opts, docs...)
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// TestMergeJSONMergePatch checks the examples of RFC 7386, Appendix A.
+func TestMergeJSONMergePatch(t *testing.T) {
+	tests := []struct {
+		target, patch, expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{`{"a":["b"]}`, `{"a":[]}`, `{"a":[]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target+" "+tt.patch, func(t *testing.T) {
+			result, err := keymerge.MergeJSONMergePatch(keymerge.Options{}, decodeJSON(t, tt.target), decodeJSON(t, tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := decodeJSON(t, tt.expected); !reflect.DeepEqual(result, expected) {
+				t.Errorf("got %v, want %v", result, expected)
+			}
+		})
+	}
+}
+
+func TestMergeJSONMergePatch_NullPatchThenPatch(t *testing.T) {
+	result, err := keymerge.MergeJSONMergePatch(keymerge.Options{},
+		decodeJSON(t, `{"a":1}`), nil, decodeJSON(t, `{"b":2,"c":null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, decodeJSON(t, `{"b":2}`)) {
+		t.Errorf("unexpected result %v", result)
+	}
+}
+
+func TestMergeJSONMergePatch_KeyedLists(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}}
+	target := decodeJSON(t, `{"services":[{"name":"api","port":80,"debug":true}],"tags":["a"]}`)
+	patch := decodeJSON(t, `{"services":[{"name":"api","debug":null},{"name":"web","port":8080,"tls":null}],"tags":["b"]}`)
+
+	result, err := keymerge.MergeJSONMergePatch(opts, target, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := decodeJSON(t, `{"services":[{"name":"api","port":80},{"name":"web","port":8080}],"tags":["b"]}`)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %v, want %v", result, expected)
+	}
+}
+
+func TestNullMode_Delete(t *testing.T) {
+	opts := keymerge.Options{NullMode: keymerge.NullDelete, DeleteMarkerKey: "_delete"}
+	base := map[string]any{"a": 1, "b": 2, "c": 3, "tags": []any{"x"}}
+	overlay := map[string]any{"a": nil, "b": map[string]any{"_delete": true}, "tags": []any{"y"}}
+
+	result, err := keymerge.MergeUnstructured(opts, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Other options keep their behavior: scalar lists still concatenate.
+	expected := map[string]any{"c": 3, "tags": []any{"x", "y"}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %v, want %v", result, expected)
+	}
+}
+
+func TestNullMode_String(t *testing.T) {
+	tests := []struct {
+		mode keymerge.NullMode
+		want string
+	}{
+		{keymerge.NullKeep, "NullKeep"},
+		{keymerge.NullDelete, "NullDelete"},
+		{keymerge.NullMode(99), "NullMode(99)"},
+	}
+	for _, tt := range tests {
+		if got := tt.mode.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func decodeJSON(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// MetadataTree holds path-specific merge directives: primary keys, list modes,
+// and field names for each field of a document. [Merger] builds one from struct
+// tags; [UntypedMerger.SetMetadata] applies one to untyped merges.
+//
+// A MetadataTree is immutable and safe to share between mergers. The zero value
+// holds no directives.
+type MetadataTree struct {
+	root *fieldMetadata
+}
+
+// MetadataOf builds a [MetadataTree] from the km struct tags of type T, exactly
+// as [NewMerger] does. See [Merger] for the tag format.
+//
+// Returns an error if the struct tags contain invalid directives.
+//
+// Example:
+//
+//	tree, err := keymerge.MetadataOf[Config]()
+//	if err != nil {
+//		return err
+//	}
+//	merger, _ := keymerge.NewUntypedMerger(opts, yaml.Unmarshal, yaml.Marshal)
+//	merger.SetMetadata(tree)
+func MetadataOf[T any]() (MetadataTree, error) {
+	root, err := buildMetadata(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return MetadataTree{}, err
+	}
+	return MetadataTree{root: root}, nil
+}
+
+// FieldSpec describes the merge directives of one field for [NewMetadataTree],
+// the way struct tags describe them for [MetadataOf].
+type FieldSpec struct {
+	// Name is the serialized field name.
+	Name string
+	// Tag holds the field's km tag directives, e.g. "primary" or "dupe=consolidate".
+	// See [Merger] for the format; field= directives are ignored.
+	Tag string
+	// Doc is the field's documentation, as given by a km-doc tag.
+	Doc string
+	// List is set if the field holds a list, so that Fields describe its items.
+	List bool
+	// Fields describes the fields of the field's struct type, or of its list items.
+	Fields []FieldSpec
+}
+
+// NewMetadataTree builds a [MetadataTree] from field descriptions instead of
+// struct tags, without reflection. The keymerge-gen tool generates the
+// descriptions for a struct type; see [NewMergerFromMetadata].
+//
+// Returns an error if a tag contains invalid directives.
+//
+// Example:
+//
+//	tree, err := keymerge.NewMetadataTree(
+//		keymerge.FieldSpec{Name: "services", Tag: "dupe=consolidate", List: true, Fields: []keymerge.FieldSpec{
+//			{Name: "name", Tag: "primary"},
+//			{Name: "port"},
+//		}},
+//		keymerge.FieldSpec{Name: "tags", Tag: "mode=dedup", List: true},
+//	)
+func NewMetadataTree(fields ...FieldSpec) (MetadataTree, error) {
+	root, err := buildSpecMetadata(fields)
+	if err != nil {
+		return MetadataTree{}, err
+	}
+	return MetadataTree{root: root}, nil
+}
+
+// buildSpecMetadata builds metadata for a struct described by fields, mirroring
+// buildMetadata.
+func buildSpecMetadata(fields []FieldSpec) (*fieldMetadata, error) {
+	root := &fieldMetadata{children: make(map[string]*fieldMetadata, len(fields))}
+	for _, field := range fields {
+		meta := &fieldMetadata{fieldName: field.Name, doc: field.Doc, list: field.List}
+		if field.Tag != "" {
+			if err := parseKMTag(field.Tag, meta); err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.Name, err)
+			}
+		}
+		if slices.Contains(meta.primaryKeys, field.Name) {
+			root.primaryKeys = append(root.primaryKeys, field.Name)
+		}
+		if len(field.Fields) > 0 {
+			children, err := buildSpecMetadata(field.Fields)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			meta.children = children.children
+			if len(children.primaryKeys) > 0 {
+				meta.primaryKeys = children.primaryKeys
+			}
+		}
+		root.children[field.Name] = meta
+	}
+	return root, nil
+}
+
+// IsZero reports whether the tree holds no directives.
+func (t MetadataTree) IsZero() bool {
+	return t.root == nil
+}
+
+// SetMetadata applies path-specific merge directives to subsequent merges, giving
+// the untyped entry points the same per-field behavior as [Merger]. Directives
+// in the tree take precedence over [Options]; paths without directives use the
+// options. Passing the zero [MetadataTree] removes any directives.
+func (m *UntypedMerger) SetMetadata(tree MetadataTree) {
+	m.metadata = tree.root
+}
+
+// Metadata returns the merger's path-specific merge directives.
+// For a [Merger], these are the directives built from its type's struct tags.
+func (m *UntypedMerger) Metadata() MetadataTree {
+	return MetadataTree{root: m.metadata}
+}
+
+// FieldDoc is the documentation of a field, from its km-doc struct tag.
+type FieldDoc struct {
+	// Path is a path pattern (see [Grant]) addressing the field, with "[*]" for
+	// the items of lists, e.g. "services[*].port".
+	Path string
+	// Doc is the text of the field's km-doc tag.
+	Doc string
+}
+
+// Docs returns the documentation of every field with a km-doc struct tag, sorted
+// by path, e.g. to write a sidecar reference for a generated config file or to
+// attach comments to marshaled output.
+//
+// Example:
+//
+//	type Server struct {
+//		Port int `yaml:"port" km-doc:"Port the server listens on."`
+//	}
+//	type Config struct {
+//		Servers []Server `yaml:"servers" km-doc:"Servers to start."`
+//	}
+//
+//	tree, _ := keymerge.MetadataOf[Config]()
+//	for _, d := range tree.Docs() {
+//		fmt.Printf("%s: %s\n", d.Path, d.Doc)
+//	}
+//	// servers: Servers to start.
+//	// servers[*].port: Port the server listens on.
+func (t MetadataTree) Docs() []FieldDoc {
+	var docs []FieldDoc
+	var walk func(prefix string, meta *fieldMetadata)
+	walk = func(prefix string, meta *fieldMetadata) {
+		for name, child := range meta.children {
+			path := appendFieldPath(prefix, name)
+			if child.doc != "" {
+				docs = append(docs, FieldDoc{Path: path, Doc: child.doc})
+			}
+			if child.list {
+				path += "[*]"
+			}
+			walk(path, child)
+		}
+	}
+	if t.root != nil && t.root.list {
+		walk("[*]", t.root)
+	} else if t.root != nil {
+		walk("", t.root)
+	}
+	slices.SortFunc(docs, func(a, b FieldDoc) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return docs
+}
+
+// Doc returns the documentation of the field at a path expression (see [Lookup])
+// addressing a value in a document, e.g. "servers[0].port" or "servers[name=web].port".
+// Returns "" if the field has no km-doc tag or the path does not address a field
+// of the tree's type.
+//
+// Returns an error wrapping [ErrInvalidPath] if the path cannot be parsed.
+func (t MetadataTree) Doc(path string) (string, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return "", err
+	}
+	meta := t.root
+	inList := meta != nil && meta.list // whether the next step must address a list item
+	for _, step := range steps {
+		if meta == nil || (step.kind == stepField) == inList {
+			return "", nil
+		}
+		if step.kind == stepField {
+			meta = meta.children[step.field]
+			inList = meta != nil && meta.list
+		} else {
+			// List items are described by the list field's children.
+			inList = false
+		}
+	}
+	if meta == nil || len(steps) == 0 {
+		return "", nil
+	}
+	return meta.doc, nil
+}
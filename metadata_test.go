@@ -0,0 +1,241 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+type metadataEndpoint struct {
+	Region string `yaml:"region" km:"primary"`
+	Name   string `yaml:"name" km:"primary"`
+	URL    string `yaml:"url"`
+}
+
+type metadataConfig struct {
+	Endpoints []metadataEndpoint `yaml:"endpoints"`
+	Tags      []string           `yaml:"tags" km:"mode=dedup"`
+}
+
+func TestUntypedMerger_SetMetadata(t *testing.T) {
+	tree, err := keymerge.MetadataOf[metadataConfig]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.IsZero() {
+		t.Fatal("expected non-zero tree")
+	}
+
+	base := []byte(`
+endpoints:
+  - region: us
+    name: api
+    url: a
+  - region: eu
+    name: api
+    url: b
+tags: [x, y]
+`)
+	overlay := []byte(`
+endpoints:
+  - region: eu
+    name: api
+    url: c
+tags: [y, z]
+`)
+
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger.SetMetadata(tree)
+
+	result, err := merger.Merge(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got metadataConfig
+	if err := yaml.Unmarshal(result, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := metadataConfig{
+		Endpoints: []metadataEndpoint{
+			{Region: "us", Name: "api", URL: "a"},
+			{Region: "eu", Name: "api", URL: "c"},
+		},
+		Tags: []string{"x", "y", "z"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("unexpected result:\n got: %+v\nwant: %+v", got, expected)
+	}
+
+	typed, err := keymerge.NewMerger[metadataConfig](keymerge.Options{}, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typedResult, err := typed.Merge(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(typedResult) != string(result) {
+		t.Errorf("untyped merge with metadata differs from typed merge:\n%s\n%s", result, typedResult)
+	}
+	if typed.Metadata().IsZero() {
+		t.Error("typed merger should expose its metadata")
+	}
+
+	// Removing the metadata restores plain untyped behavior.
+	merger.SetMetadata(keymerge.MetadataTree{})
+	if !merger.Metadata().IsZero() {
+		t.Fatal("expected metadata to be cleared")
+	}
+	result, err = merger.Merge(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = metadataConfig{}
+	if err := yaml.Unmarshal(result, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Endpoints) != 3 || len(got.Tags) != 4 {
+		t.Errorf("expected concatenated lists without metadata, got %+v", got)
+	}
+}
+
+func TestMetadataOf_InvalidTag(t *testing.T) {
+	type invalid struct {
+		Items []string `yaml:"items" km:"mode=bogus"`
+	}
+	_, err := keymerge.MetadataOf[invalid]()
+	if !errors.Is(err, keymerge.ErrInvalidTag) {
+		t.Fatalf("expected ErrInvalidTag, got %v", err)
+	}
+}
+
+type documentedServer struct {
+	Name string `yaml:"name" km:"primary" km-doc:"Unique server name."`
+	Port int    `yaml:"port" km-doc:"Port the server listens on."`
+}
+
+type documentedConfig struct {
+	Log     string             `yaml:"log" km-doc:"Log level."`
+	Servers []documentedServer `yaml:"servers" km-doc:"Servers to start."`
+	Admin   *documentedServer  `yaml:"admin"`
+	Tags    []string           `yaml:"tags"`
+}
+
+func TestMetadataTree_Docs(t *testing.T) {
+	tree, err := keymerge.MetadataOf[documentedConfig]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []keymerge.FieldDoc{
+		{Path: "admin.name", Doc: "Unique server name."},
+		{Path: "admin.port", Doc: "Port the server listens on."},
+		{Path: "log", Doc: "Log level."},
+		{Path: "servers", Doc: "Servers to start."},
+		{Path: "servers[*].name", Doc: "Unique server name."},
+		{Path: "servers[*].port", Doc: "Port the server listens on."},
+	}
+	if docs := tree.Docs(); !reflect.DeepEqual(docs, expected) {
+		t.Errorf("expected %+v, got %+v", expected, docs)
+	}
+
+	tests := map[string]string{
+		"log":                    "Log level.",
+		"servers[2].port":        "Port the server listens on.",
+		"servers[name=web].name": "Unique server name.",
+		"admin.port":             "Port the server listens on.",
+		"admin[0].port":          "",
+		"servers.port":           "",
+		"tags":                   "",
+		"tags[0]":                "",
+		"missing.field":          "",
+		"":                       "",
+	}
+	for path, want := range tests {
+		got, err := tree.Doc(path)
+		if err != nil {
+			t.Fatalf("%q: %v", path, err)
+		}
+		if got != want {
+			t.Errorf("%q: expected %q, got %q", path, want, got)
+		}
+	}
+	if _, err := tree.Doc("servers["); !errors.Is(err, keymerge.ErrInvalidPath) {
+		t.Errorf("expected ErrInvalidPath, got %v", err)
+	}
+	if docs := (keymerge.MetadataTree{}).Docs(); docs != nil {
+		t.Errorf("expected no docs for zero tree, got %+v", docs)
+	}
+}
+
+func TestMetadataTree_DocsOfRootList(t *testing.T) {
+	tree, err := keymerge.MetadataOf[[]documentedServer]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []keymerge.FieldDoc{
+		{Path: "[*].name", Doc: "Unique server name."},
+		{Path: "[*].port", Doc: "Port the server listens on."},
+	}
+	if docs := tree.Docs(); !reflect.DeepEqual(docs, expected) {
+		t.Errorf("expected %+v, got %+v", expected, docs)
+	}
+	if doc, err := tree.Doc("[name=web].port"); err != nil || doc != "Port the server listens on." {
+		t.Errorf("unexpected doc %q, error %v", doc, err)
+	}
+}
+
+func TestMetadataTree_DocsAsYAMLComments(t *testing.T) {
+	tree, err := keymerge.MetadataOf[documentedConfig]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	comments := yaml.CommentMap{}
+	for _, d := range tree.Docs() {
+		comments["$."+d.Path] = []*yaml.Comment{yaml.HeadComment(" " + d.Doc)}
+	}
+	out, err := yaml.MarshalWithOptions(map[string]any{"log": "info"}, yaml.WithComment(comments))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "# Log level.\nlog: info\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestNewMetadataTree(t *testing.T) {
+	server := []keymerge.FieldSpec{
+		{Name: "name", Tag: "primary", Doc: "Unique server name."},
+		{Name: "port", Doc: "Port the server listens on."},
+	}
+	tree, err := keymerge.NewMetadataTree(
+		keymerge.FieldSpec{Name: "log", Doc: "Log level."},
+		keymerge.FieldSpec{Name: "servers", Doc: "Servers to start.", List: true, Fields: server},
+		keymerge.FieldSpec{Name: "admin", Fields: server},
+		keymerge.FieldSpec{Name: "tags", List: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reflected, err := keymerge.MetadataOf[documentedConfig]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tree, reflected) {
+		t.Errorf("expected the same tree as MetadataOf, got %+v", tree)
+	}
+
+	_, err = keymerge.NewMetadataTree(keymerge.FieldSpec{Name: "tags", Tag: "mode=bogus"})
+	if !errors.Is(err, keymerge.ErrInvalidTag) {
+		t.Fatalf("expected ErrInvalidTag, got %v", err)
+	}
+}
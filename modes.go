@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// scalarModeNames and dupeModeNames are the names of the modes in configuration
+// files and flags, e.g. cfgmerge's -scalar and -dupe.
+var (
+	scalarModeNames = map[ScalarMode]string{ScalarConcat: "concat", ScalarDedup: "dedup", ScalarReplace: "replace"}
+	dupeModeNames   = map[DupeMode]string{DupeUnique: "unique", DupeConsolidate: "consolidate"}
+)
+
+// ParseScalarMode returns the [ScalarMode] named "concat", "dedup", or
+// "replace", ignoring case. The empty string names the default, [ScalarConcat].
+// These are the names cfgmerge and cfgmerge-krm accept.
+//
+// Returns an error wrapping [ErrInvalidOptions] for any other name.
+func ParseScalarMode(name string) (ScalarMode, error) {
+	return parseMode(name, "scalar", scalarModeNames)
+}
+
+// ParseDupeMode returns the [DupeMode] named "unique" or "consolidate",
+// ignoring case. The empty string names the default, [DupeUnique].
+// These are the names cfgmerge and cfgmerge-krm accept.
+//
+// Returns an error wrapping [ErrInvalidOptions] for any other name.
+func ParseDupeMode(name string) (DupeMode, error) {
+	return parseMode(name, "dupe", dupeModeNames)
+}
+
+// MarshalText encodes m by the name [ParseScalarMode] accepts, so that modes
+// can be read from and written to configuration files.
+func (m ScalarMode) MarshalText() ([]byte, error) {
+	return marshalMode(m, scalarModeNames)
+}
+
+// UnmarshalText decodes a name accepted by [ParseScalarMode].
+func (m *ScalarMode) UnmarshalText(text []byte) error {
+	mode, err := ParseScalarMode(string(text))
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+// MarshalText encodes m by the name [ParseDupeMode] accepts.
+func (m DupeMode) MarshalText() ([]byte, error) {
+	return marshalMode(m, dupeModeNames)
+}
+
+// UnmarshalText decodes a name accepted by [ParseDupeMode].
+func (m *DupeMode) UnmarshalText(text []byte) error {
+	mode, err := ParseDupeMode(string(text))
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+// parseMode returns the mode with the given name in names, or the zero mode
+// if name is empty. Modes are numbered from zero, as their constants are.
+func parseMode[M ~int](name, kind string, names map[M]string) (M, error) {
+	if name == "" {
+		return 0, nil
+	}
+	valid := make([]string, len(names))
+	for mode := range M(len(names)) {
+		if strings.EqualFold(name, names[mode]) {
+			return mode, nil
+		}
+		valid[mode] = names[mode]
+	}
+	return 0, fmt.Errorf("%w: unknown %s mode %q (must be %s)", ErrInvalidOptions, kind, name, strings.Join(valid, ", "))
+}
+
+// marshalMode returns the name of mode in names.
+func marshalMode[M interface {
+	~int
+	fmt.Stringer
+}](mode M, names map[M]string) ([]byte, error) {
+	name, ok := names[mode]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown %v", ErrInvalidOptions, mode)
+	}
+	return []byte(name), nil
+}
+
+// ScalarListMode is the name [ScalarMode] had before v0.3.0.
+//
+// Deprecated: Use [ScalarMode].
+type ScalarListMode = ScalarMode
+
+// Names the [ScalarMode] constants had before v0.3.0.
+//
+// Deprecated: Use [ScalarConcat], [ScalarDedup], and [ScalarReplace].
+const (
+	ScalarListConcat  = ScalarConcat
+	ScalarListDedup   = ScalarDedup
+	ScalarListReplace = ScalarReplace
+)
+
+// ObjectListMode is the name [DupeMode] had before v0.3.0.
+//
+// Deprecated: Use [DupeMode].
+type ObjectListMode = DupeMode
+
+// Names the [DupeMode] constants had before v0.3.0.
+//
+// Deprecated: Use [DupeUnique] and [DupeConsolidate].
+const (
+	ObjectListUnique      = DupeUnique
+	ObjectListConsolidate = DupeConsolidate
+)
+
+// compiledScalarMode is an entry of [Options.ScalarModes] with a parsed path
+// pattern.
+type compiledScalarMode struct {
+	path     string
+	pattern  []pathStep
+	literals int // field and index steps, which make a pattern more specific
+	mode     ScalarMode
+}
+
+// compileScalarModes parses the patterns of [Options.ScalarModes], ordered so
+// that patterns with more field names and indices come first.
+func compileScalarModes(modes map[string]ScalarMode) ([]compiledScalarMode, error) {
+	compiled := make([]compiledScalarMode, 0, len(modes))
+	for path, mode := range modes {
+		pattern, err := parsePattern(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: ScalarModes: %w", ErrInvalidOptions, err)
+		}
+		literals := 0
+		for _, step := range pattern {
+			switch step.kind {
+			case stepSelect:
+				return nil, fmt.Errorf("%w: ScalarModes pattern %q cannot contain selectors", ErrInvalidOptions, path)
+			case stepField, stepIndex:
+				literals++
+			}
+		}
+		if _, ok := scalarModeNames[mode]; !ok {
+			return nil, fmt.Errorf("%w: unknown %v for ScalarModes pattern %q", ErrInvalidOptions, mode, path)
+		}
+		compiled = append(compiled, compiledScalarMode{path: path, pattern: pattern, literals: literals, mode: mode})
+	}
+	slices.SortFunc(compiled, func(a, b compiledScalarMode) int {
+		return cmp.Or(cmp.Compare(b.literals, a.literals), strings.Compare(a.path, b.path))
+	})
+	if len(compiled) == 0 {
+		return nil, nil
+	}
+	return compiled, nil
+}
+
+// scalarMode returns the [ScalarMode] of the list at the current path.
+func (m *UntypedMerger) scalarMode() ScalarMode {
+	if meta := m.getCurrentMetadata(); meta != nil && meta.scalarMode != nil {
+		return *meta.scalarMode
+	}
+	for _, s := range m.scalarModes {
+		if matchesSegments(s.pattern, m.path) {
+			return s.mode
+		}
+	}
+	return m.opts.ScalarMode
+}
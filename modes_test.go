@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestParseModes(t *testing.T) {
+	for name, want := range map[string]keymerge.ScalarMode{
+		"": keymerge.ScalarConcat, "concat": keymerge.ScalarConcat, "Dedup": keymerge.ScalarDedup, "replace": keymerge.ScalarReplace,
+	} {
+		if got, err := keymerge.ParseScalarMode(name); err != nil || got != want {
+			t.Errorf("ParseScalarMode(%q) = %v, %v; want %v", name, got, err, want)
+		}
+	}
+	for name, want := range map[string]keymerge.DupeMode{
+		"": keymerge.DupeUnique, "unique": keymerge.DupeUnique, "CONSOLIDATE": keymerge.DupeConsolidate,
+	} {
+		if got, err := keymerge.ParseDupeMode(name); err != nil || got != want {
+			t.Errorf("ParseDupeMode(%q) = %v, %v; want %v", name, got, err, want)
+		}
+	}
+
+	_, err := keymerge.ParseScalarMode("merge")
+	if !errors.Is(err, keymerge.ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions, got %v", err)
+	}
+	if err.Error() != `invalid options: unknown scalar mode "merge" (must be concat, dedup, replace)` {
+		t.Errorf("unexpected error %q", err)
+	}
+	if _, err := keymerge.ParseDupeMode("ScalarConcat"); !errors.Is(err, keymerge.ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions, got %v", err)
+	}
+}
+
+func TestModes_Text(t *testing.T) {
+	type config struct {
+		Scalar keymerge.ScalarMode `json:"scalar"`
+		Dupe   keymerge.DupeMode   `json:"dupe"`
+	}
+	encoded, err := json.Marshal(config{Scalar: keymerge.ScalarReplace, Dupe: keymerge.DupeConsolidate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != `{"scalar":"replace","dupe":"consolidate"}` {
+		t.Errorf("unexpected encoding %s", encoded)
+	}
+	var decoded config
+	if err := json.Unmarshal([]byte(`{"scalar":"dedup","dupe":"unique"}`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Scalar != keymerge.ScalarDedup || decoded.Dupe != keymerge.DupeUnique {
+		t.Errorf("unexpected decoding %+v", decoded)
+	}
+	if err := json.Unmarshal([]byte(`{"scalar":"sum"}`), &decoded); err == nil {
+		t.Error("expected an unknown mode to fail")
+	}
+	if _, err := json.Marshal(config{Scalar: keymerge.ScalarMode(7)}); err == nil {
+		t.Error("expected an unknown mode to fail to encode")
+	}
+}
+
+func TestDeprecatedModeNames(t *testing.T) {
+	var mode keymerge.ScalarListMode = keymerge.ScalarListDedup
+	opts := keymerge.Options{ScalarMode: mode, DupeMode: keymerge.ObjectListConsolidate}
+	if opts.ScalarMode != keymerge.ScalarDedup || opts.DupeMode != keymerge.DupeConsolidate {
+		t.Errorf("unexpected options %+v", opts)
+	}
+}
+
+func TestOptions_ScalarModes(t *testing.T) {
+	opts := keymerge.Options{
+		ScalarMode: keymerge.ScalarReplace,
+		ScalarModes: map[string]keymerge.ScalarMode{
+			"**.finalizers":       keymerge.ScalarDedup,
+			"pods.*.finalizers":   keymerge.ScalarConcat,
+			"pods.*.spec.volumes": keymerge.ScalarDedup,
+		},
+	}
+	base := map[string]any{
+		"finalizers": []any{"a"},
+		"args":       []any{"-v"},
+		"pods":       map[string]any{"web": map[string]any{"finalizers": []any{"a"}}},
+	}
+	overlay := map[string]any{
+		"finalizers": []any{"a", "b"},
+		"args":       []any{"-q"},
+		"pods":       map[string]any{"web": map[string]any{"finalizers": []any{"a"}}},
+	}
+	result, err := keymerge.MergeUnstructured(opts, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"finalizers": []any{"a", "b"},
+		"args":       []any{"-q"},
+		"pods":       map[string]any{"web": map[string]any{"finalizers": []any{"a", "a"}}},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+
+	// Diff verifies its overlay with the same modes
+	desired := map[string]any{"finalizers": []any{"a", "b"}}
+	if _, err := keymerge.Diff(opts, map[string]any{"finalizers": []any{"a"}}, desired); err != nil {
+		t.Errorf("Diff: %v", err)
+	}
+
+	for name, modes := range map[string]map[string]keymerge.ScalarMode{
+		"selector":     {"pods[name=web]": keymerge.ScalarDedup},
+		"invalid path": {"pods..x": keymerge.ScalarDedup},
+		"unknown mode": {"pods": keymerge.ScalarMode(9)},
+	} {
+		_, err := keymerge.NewUntypedMerger(keymerge.Options{ScalarModes: modes}, nil, nil)
+		if !errors.Is(err, keymerge.ErrInvalidOptions) {
+			t.Errorf("%s: expected ErrInvalidOptions, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidMove indicates a list item could not be moved to the list its
+// move marker named.
+var ErrInvalidMove = errors.New("invalid move")
+
+// MoveError is returned when an item's move marker (see [Options.MoveMarkerKey])
+// cannot be carried out, e.g. because its destination is not a list.
+type MoveError struct {
+	// To is the destination path of the move marker.
+	To string
+	// Reason describes why the item could not be moved.
+	Reason string
+	// Path is where in the document the moved item occurred.
+	Path []string
+	// DocIndex tells which document the error occurred.
+	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
+}
+
+func (e *MoveError) Error() string {
+	path := strings.Join(e.Path, ".")
+	if path == "" {
+		path = "(root)"
+	}
+	return fmt.Sprintf("cannot move item at path %s in document %d%s to %q: %s",
+		path, e.DocIndex, nameSuffix(e.DocName), e.To, e.Reason)
+}
+
+func (e *MoveError) Is(target error) bool {
+	return target == ErrInvalidMove
+}
+
+// pendingMove is an item removed from its list by a move marker, to be merged
+// into its destination list once the whole document is merged.
+type pendingMove struct {
+	item any
+	to   string
+	from []string
+}
+
+// moveDestination returns the destination path of value's move marker, if it
+// has one.
+func (m *UntypedMerger) moveDestination(value any) (string, bool) {
+	if m.opts.MoveMarkerKey == "" {
+		return "", false
+	}
+	marker, exists := fieldValue(value, m.opts.MoveMarkerKey)
+	if !exists {
+		return "", false
+	}
+	to, ok := marker.(string)
+	return to, ok
+}
+
+// withoutMoveMarker returns a copy of item without its move marker.
+func (m *UntypedMerger) withoutMoveMarker(item any) any {
+	mp, ok := item.(map[string]any)
+	if !ok {
+		return item
+	}
+	result := maps.Clone(mp)
+	delete(result, m.opts.MoveMarkerKey)
+	return result
+}
+
+// takeMove records item for a move to the list at path to, once merged into
+// existing, the item it matched in its current list (nil if none). The caller
+// removes existing from that list. The item's index must be pushed onto the path.
+func (m *UntypedMerger) takeMove(existing, item any, to string) error {
+	item = m.withoutMoveMarker(item)
+	if existing != nil {
+		merged, err := m.mergeValues(existing, item)
+		if err != nil {
+			return err
+		}
+		item = merged
+	} else {
+		item = m.dropNulls(item)
+	}
+	m.moves = append(m.moves, pendingMove{item: item, to: to, from: m.pathNames()})
+	return nil
+}
+
+// applyMoves merges the items taken by move markers while merging the current
+// document into their destination lists in doc, returning the updated doc.
+// Values along the way are copied rather than modified, since they may belong
+// to the documents being merged.
+func (m *UntypedMerger) applyMoves(doc any) (any, error) {
+	moves := m.moves
+	m.moves = nil
+	// Items are taken as maps are visited, in no particular order, so move them
+	// in the order of the paths they were taken from
+	slices.SortStableFunc(moves, func(a, b pendingMove) int {
+		return comparePathNames(a.from, b.from)
+	})
+	for _, move := range moves {
+		steps, err := parsePath(move.to)
+		if err != nil {
+			return nil, &MoveError{To: move.to, Reason: err.Error(), Path: move.from, DocIndex: m.index}
+		}
+		moved, ok, err := m.moveInto(doc, steps, move.item)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, &MoveError{To: move.to, Reason: "destination is not a list", Path: move.from, DocIndex: m.index}
+		}
+		doc = moved
+	}
+	return doc, nil
+}
+
+// moveInto merges item into the list that steps address in value, by primary
+// key as if an overlay list held it, and returns value with the merged list in
+// place. A missing list is created if its map exists. The boolean result is
+// false if steps do not address a list.
+func (m *UntypedMerger) moveInto(value any, steps []pathStep, item any) (any, bool, error) {
+	if len(steps) == 0 {
+		list, ok := asList(value)
+		if !ok && value != nil {
+			return nil, false, nil
+		}
+		merged, err := m.mergeSlices(list, []any{item})
+		return merged, true, err
+	}
+
+	step := steps[0]
+	if step.kind == stepField {
+		mp, ok := value.(map[string]any)
+		if !ok || (len(steps) > 1 && mp[step.field] == nil) {
+			return nil, false, nil
+		}
+		m.push(step.field)
+		child, ok, err := m.moveInto(mp[step.field], steps[1:], item)
+		m.pop()
+		if !ok || err != nil {
+			return nil, ok, err
+		}
+		result := maps.Clone(mp)
+		result[step.field] = child
+		return result, true, nil
+	}
+
+	list, ok := asList(value)
+	if !ok {
+		return nil, false, nil
+	}
+	index := -1
+	switch step.kind {
+	case stepIndex:
+		if step.index < len(list) {
+			index = step.index
+		}
+	case stepSelect:
+		index = slices.IndexFunc(list, func(v any) bool { return matchesSelector(v, step.match) })
+	}
+	if index < 0 {
+		return nil, false, nil
+	}
+	m.push(strconv.Itoa(index))
+	child, ok, err := m.moveInto(list[index], steps[1:], item)
+	m.pop()
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	result := slices.Clone(list)
+	result[index] = child
+	return result, true, nil
+}
+
+// comparePathNames orders paths of field names and list indices, comparing
+// indices by value.
+func comparePathNames(a, b []string) int {
+	for i := range min(len(a), len(b)) {
+		if a[i] == b[i] {
+			continue
+		}
+		x, xErr := strconv.Atoi(a[i])
+		y, yErr := strconv.Atoi(b[i])
+		if xErr == nil && yErr == nil {
+			return cmp.Compare(x, y)
+		}
+		return strings.Compare(a[i], b[i])
+	}
+	return cmp.Compare(len(a), len(b))
+}
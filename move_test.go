@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func moveBase() map[string]any {
+	return map[string]any{"queues": []any{
+		map[string]any{"name": "fast", "jobs": []any{
+			map[string]any{"name": "build", "cpu": 2},
+			map[string]any{"name": "lint", "cpu": 1},
+		}},
+		map[string]any{"name": "slow", "jobs": []any{
+			map[string]any{"name": "report", "cpu": 1},
+		}},
+		map[string]any{"name": "idle"},
+	}}
+}
+
+func TestMoveMarker(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}, MoveMarkerKey: "_move_to"}
+	base := moveBase()
+	overlay := map[string]any{"queues": []any{
+		map[string]any{"name": "fast", "jobs": []any{
+			map[string]any{"name": "build", "cpu": 8, "_move_to": "queues[name=slow].jobs"},
+			map[string]any{"name": "lint", "_move_to": "queues[name=idle].jobs"},
+			map[string]any{"name": "deploy", "_move_to": "queues[name=slow].jobs"},
+		}},
+	}}
+
+	result, err := keymerge.MergeUnstructured(opts, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"queues": []any{
+		map[string]any{"name": "fast", "jobs": []any{}},
+		map[string]any{"name": "slow", "jobs": []any{
+			map[string]any{"name": "report", "cpu": 1},
+			map[string]any{"name": "build", "cpu": 8},
+			map[string]any{"name": "deploy"},
+		}},
+		map[string]any{"name": "idle", "jobs": []any{
+			map[string]any{"name": "lint", "cpu": 1},
+		}},
+	}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("got %v, want %v", result, expected)
+	}
+	if !reflect.DeepEqual(base, moveBase()) {
+		t.Errorf("base was modified: %v", base)
+	}
+}
+
+func TestMoveMarker_MergesIntoDestinationItem(t *testing.T) {
+	opts := keymerge.Options{
+		PrimaryKeyNames: []string{"name"},
+		MoveMarkerKey:   "_move_to",
+		KeyMatchMode:    keymerge.KeyMatchAny,
+	}
+	base := map[string]any{
+		"active":   []any{map[string]any{"name": "web", "port": 8080}},
+		"disabled": []any{map[string]any{"name": "web", "reason": "old"}},
+	}
+	overlay := map[string]any{
+		"active": []any{map[string]any{"name": "web", "_move_to": "disabled"}},
+	}
+
+	result, err := keymerge.MergeUnstructured(opts, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{
+		"active":   []any{},
+		"disabled": []any{map[string]any{"name": "web", "reason": "old", "port": 8080}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("got %v, want %v", result, expected)
+	}
+}
+
+func TestMoveMarker_Errors(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}, MoveMarkerKey: "_move_to"}
+	tests := map[string]any{
+		"not a list":     map[string]any{"name": "build", "_move_to": "queues[name=slow]"},
+		"missing parent": map[string]any{"name": "build", "_move_to": "queues[name=none].jobs"},
+		"invalid path":   map[string]any{"name": "build", "_move_to": "queues["},
+		"no key":         map[string]any{"id": "build", "_move_to": "queues[name=slow].jobs"},
+	}
+	for name, item := range tests {
+		t.Run(name, func(t *testing.T) {
+			overlay := map[string]any{"queues": []any{
+				map[string]any{"name": "fast", "jobs": []any{map[string]any{"name": "other"}, item}},
+			}}
+			_, err := keymerge.MergeUnstructured(opts, moveBase(), overlay)
+			var moveErr *keymerge.MoveError
+			if !errors.Is(err, keymerge.ErrInvalidMove) || !errors.As(err, &moveErr) {
+				t.Fatalf("expected MoveError, got %v", err)
+			}
+			if moveErr.DocIndex != 1 || len(moveErr.Path) == 0 || moveErr.Path[0] != "queues" {
+				t.Errorf("unexpected error location %+v", moveErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+)
+
+// UnmarshalJSONNumbers is like [json.Unmarshal], but decodes numbers as
+// [json.Number], which keeps their exact decimal text, instead of float64. Use
+// it with [json.Marshal] to merge values like 0.1 or 19-digit quotas without
+// rounding them:
+//
+//	result, err := Merge(opts, UnmarshalJSONNumbers, json.Marshal, base, overlay)
+//
+// Merges carry json.Number values unchanged. [StrategySum] adds them exactly,
+// and [StrategyMin], [StrategyMax], and comparisons such as [Compare] compare
+// them by value, also with other numbers.
+func UnmarshalJSONNumbers(data []byte, out any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(out); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		if err == nil {
+			err = errors.New("keymerge: invalid data after top-level JSON value")
+		}
+		return err
+	}
+	return nil
+}
+
+// isDecimal reports whether either value is a [json.Number], so that numbers
+// are combined as exact decimals.
+func isDecimal(a, b any) bool {
+	_, aOK := a.(json.Number)
+	_, bOK := b.(json.Number)
+	return aOK || bOK
+}
+
+// toDecimal converts a number of any type to an exact [big.Rat] of its decimal
+// value: json.Number by its text, and floats by the shortest decimal that
+// reads back as the same float, so that 0.1 is one tenth.
+func toDecimal(v any) (*big.Rat, bool) {
+	if n, ok := v.(json.Number); ok {
+		return new(big.Rat).SetString(string(n))
+	}
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.CanInt():
+		return new(big.Rat).SetInt64(rv.Int()), true
+	case rv.CanUint():
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(rv.Uint())), true
+	case rv.CanFloat():
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, false
+		}
+		return new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, rv.Type().Bits()))
+	default:
+		return nil, false
+	}
+}
+
+// decimalNumber formats r, which must have a finite decimal expansion, as a
+// json.Number with as many fractional digits as it needs.
+func decimalNumber(r *big.Rat) json.Number {
+	digits := 0
+	ten := big.NewRat(10, 1)
+	for scaled := new(big.Rat).Set(r); !scaled.IsInt(); scaled.Mul(scaled, ten) {
+		digits++
+	}
+	return json.Number(r.FloatString(digits))
+}
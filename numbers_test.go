@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestUnmarshalJSONNumbers(t *testing.T) {
+	opts := keymerge.Options{
+		PrimaryKeyNames: []string{"name"},
+		ScalarStrategies: map[string]keymerge.ScalarStrategy{
+			"budget":        keymerge.StrategySum,
+			"quotas[*].cpu": keymerge.StrategyMin,
+		},
+	}
+	base := []byte(`{"rate": 0.1, "budget": 0.10, "quotas": [{"name": "a", "cpu": 12345678901234567890, "disk": 1.5}]}`)
+	overlay := []byte(`{"budget": 0.2, "quotas": [{"name": "a", "cpu": 12345678901234567891, "disk": 1.50}]}`)
+
+	result, err := keymerge.Merge(opts, keymerge.UnmarshalJSONNumbers, json.Marshal, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"budget":0.3,"quotas":[{"cpu":12345678901234567890,"disk":1.50,"name":"a"}],"rate":0.1}`
+	if string(result) != want {
+		t.Errorf("got %s, want %s", result, want)
+	}
+
+	// Exact numbers compare by value with other numbers.
+	merger, err := keymerge.NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := merger.Compare(
+		map[string]any{"a": json.Number("0.10"), "b": json.Number("2"), "c": 0.1},
+		map[string]any{"a": 0.1, "b": uint64(2), "c": json.Number("0.3")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Path != "c" {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+
+	sum, err := keymerge.StrategySum(json.Number("1e-3"), 2)
+	if err != nil || !reflect.DeepEqual(sum, json.Number("2.001")) {
+		t.Errorf("got %v (%v), want 2.001", sum, err)
+	}
+	if _, err := keymerge.StrategySum(json.Number("1"), "x"); err == nil {
+		t.Error("expected error adding a string")
+	}
+	maximum, err := keymerge.StrategyMax(json.Number("0.30000000000000001"), 0.3)
+	if err != nil || !reflect.DeepEqual(maximum, json.Number("0.30000000000000001")) {
+		t.Errorf("got %v (%v), want the exact number", maximum, err)
+	}
+
+	var doc any
+	if err := keymerge.UnmarshalJSONNumbers([]byte(`{} {}`), &doc); err == nil {
+		t.Error("expected error for trailing data")
+	}
+}
@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// contentKey identifies a value by its canonical content. It is a distinct type
+// so that content keys never collide with scalar list items.
+type contentKey string
+
+// asBytes returns the contents of a byte slice, such as a [json.RawMessage].
+func asBytes(v any) ([]byte, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() != reflect.Uint8 {
+		return nil, false
+	}
+	return rv.Bytes(), true
+}
+
+// canonicalContent returns a key that is equal for values with the same content:
+// byte slices holding JSON (such as [json.RawMessage]) are compared by the value
+// they encode, regardless of formatting and key order, and other values by their
+// JSON encoding. Values that cannot be encoded fall back to their Go syntax.
+func canonicalContent(v any) contentKey {
+	if raw, ok := asBytes(v); ok {
+		var decoded any
+		if err := json.Unmarshal(raw, &decoded); err != nil {
+			return contentKey("bytes:" + string(raw))
+		}
+		v = decoded
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return contentKey(fmt.Sprintf("go:%#v", v))
+	}
+	return contentKey("json:" + string(encoded))
+}
+
+// mergeOpaque merges lists whose items are opaque: items are never deep merged,
+// and an item with the same content as an earlier one replaces it in place, so the
+// last occurrence wins (e.g. keeping the overlay's formatting of a raw message).
+func mergeOpaque(base, overlay []any) []any {
+	result := make([]any, 0, len(base)+len(overlay))
+	index := make(map[contentKey]int, len(base)+len(overlay))
+	for _, list := range [][]any{base, overlay} {
+		for _, item := range list {
+			key := canonicalContent(item)
+			if i, exists := index[key]; exists {
+				result[i] = item
+				continue
+			}
+			index[key] = len(result)
+			result = append(result, item)
+		}
+	}
+	return result
+}
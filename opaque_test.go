@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestOpaqueLists(t *testing.T) {
+	tree, err := keymerge.NewMetadataTree(keymerge.FieldSpec{Name: "events", Tag: "opaque", List: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{PrimaryKeyNames: []string{"name"}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger.SetMetadata(tree)
+
+	base := map[string]any{"events": []any{
+		json.RawMessage(`{"a":1,"b":2}`),
+		json.RawMessage(`{"c":3}`),
+		map[string]any{"name": "x", "v": 1},
+	}}
+	overlay := map[string]any{"events": []any{
+		json.RawMessage(`{ "b": 2, "a": 1.0 }`),
+		json.RawMessage(`not json`),
+		map[string]any{"name": "x", "v": 2},
+		map[string]any{"v": 1, "name": "x"},
+	}}
+	result, err := merger.MergeUnstructured(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Equal content is replaced in place by the last occurrence; items with the
+	// same primary key but different content are kept apart, not deep merged.
+	expected := []any{
+		json.RawMessage(`{ "b": 2, "a": 1.0 }`),
+		json.RawMessage(`{"c":3}`),
+		map[string]any{"v": 1, "name": "x"},
+		json.RawMessage(`not json`),
+		map[string]any{"name": "x", "v": 2},
+	}
+	if got := result.(map[string]any)["events"]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestOpaqueLists_Typed(t *testing.T) {
+	type Config struct {
+		Events []json.RawMessage `json:"events" km:"opaque"`
+	}
+	merger, err := keymerge.NewMerger[Config](keymerge.Options{PrimaryKeyNames: []string{"name"}}, json.Unmarshal, json.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := merger.Merge(
+		[]byte(`{"events": [{"name": "a", "x": 1}]}`),
+		[]byte(`{"events": [{"x": 1, "name": "a"}, {"name": "a", "y": 2}]}`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := json.Unmarshal(result, &config); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Events) != 2 || string(config.Events[1]) != `{"name":"a","y":2}` {
+		t.Errorf("unexpected events %s", result)
+	}
+}
+
+func TestRawMessageValues(t *testing.T) {
+	// Raw messages are scalars: the overlay wins instead of the bytes being concatenated.
+	result, err := keymerge.MergeUnstructured(keymerge.Options{},
+		map[string]any{"payload": json.RawMessage(`{"a":1}`)},
+		map[string]any{"payload": json.RawMessage(`{"b":2}`)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := result.(map[string]any)["payload"]; !reflect.DeepEqual(got, json.RawMessage(`{"b":2}`)) {
+		t.Errorf("expected overlay payload, got %s", got)
+	}
+
+	// Deduplicating raw messages compares their content.
+	result, err = keymerge.MergeUnstructured(keymerge.Options{ScalarMode: keymerge.ScalarDedup},
+		[]any{json.RawMessage(`{"a": 1}`), "a"},
+		[]any{json.RawMessage(`{"a":1}`), json.RawMessage(`"a"`)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []any{json.RawMessage(`{"a": 1}`), "a", json.RawMessage(`"a"`)}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}
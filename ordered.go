@@ -0,0 +1,287 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// OrderedMap is a string-keyed map that remembers the order of its keys.
+// Keys must hold every key of Values exactly once; [OrderedMap.Set] keeps them
+// in step.
+//
+// [UntypedMerger.MergeUnstructured] accepts documents containing OrderedMaps
+// and, if any document does, returns every map of the result as an OrderedMap.
+// A merged map keeps the key order of the first document that has it, followed
+// by the keys later documents add, in the order they add them. Keys no document
+// orders, such as those of plain maps, come last in sorted order.
+//
+// Other functions expect plain maps; [Unordered] converts.
+type OrderedMap struct {
+	Keys   []string
+	Values map[string]any
+}
+
+// Set sets the value of key, appending key to Keys if it is new.
+func (m *OrderedMap) Set(key string, value any) {
+	if m.Values == nil {
+		m.Values = make(map[string]any)
+	}
+	if _, exists := m.Values[key]; !exists {
+		m.Keys = append(m.Keys, key)
+	}
+	m.Values[key] = value
+}
+
+// MarshalJSON encodes m as a JSON object with its keys in order.
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	if m == nil {
+		return []byte("null"), nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.Keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		encodedValue, err := json.Marshal(m.Values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(encodedKey)
+		buf.WriteByte(':')
+		buf.Write(encodedValue)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a JSON object into m, decoding nested objects as
+// *OrderedMap. A key that appears more than once keeps its first position
+// and its last value, as [json.Unmarshal] keeps the last value.
+func (m *OrderedMap) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := UnmarshalOrderedJSON(data, &value); err != nil {
+		return err
+	}
+	decoded, ok := value.(*OrderedMap)
+	if !ok {
+		return fmt.Errorf("keymerge: cannot unmarshal JSON %T into OrderedMap", value)
+	}
+	*m = *decoded
+	return nil
+}
+
+// UnmarshalOrderedJSON is like [json.Unmarshal] into an *any, but decodes JSON
+// objects as *OrderedMap, for merging with [Merge] while keeping key order:
+//
+//	result, err := Merge(opts, UnmarshalOrderedJSON, json.Marshal, base, overlay)
+func UnmarshalOrderedJSON(data []byte, out any) error {
+	target, ok := out.(*any)
+	if !ok {
+		return fmt.Errorf("keymerge: UnmarshalOrderedJSON requires a *any, got %T", out)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	value, err := decodeOrderedJSON(dec)
+	if err != nil {
+		return err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		if err == nil {
+			err = errors.New("keymerge: invalid data after top-level JSON value")
+		}
+		return err
+	}
+	*target = value
+	return nil
+}
+
+// decodeOrderedJSON decodes the next JSON value of dec.
+func decodeOrderedJSON(dec *json.Decoder) (any, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		m := &OrderedMap{Values: make(map[string]any)}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			m.Set(key.(string), value)
+		}
+		_, err = dec.Token()
+		return m, err
+	case json.Delim('['):
+		list := []any{}
+		for dec.More() {
+			value, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err = dec.Token()
+		return list, err
+	default:
+		return token, nil
+	}
+}
+
+// Unordered returns value with every *OrderedMap replaced by a map[string]any.
+// Values without OrderedMaps are returned as they are.
+func Unordered(value any) any {
+	plain, _ := unorder(value)
+	return plain
+}
+
+// unorder implements [Unordered], reporting whether value held OrderedMaps.
+// Maps and lists are only copied if they do.
+func unorder(value any) (any, bool) {
+	switch v := value.(type) {
+	case *OrderedMap:
+		if v == nil {
+			return nil, true
+		}
+		result := make(map[string]any, len(v.Values))
+		for k, val := range v.Values {
+			result[k], _ = unorder(val)
+		}
+		return result, true
+	case map[string]any:
+		var result map[string]any
+		for k, val := range v {
+			if plain, changed := unorder(val); changed {
+				if result == nil {
+					result = maps.Clone(v)
+				}
+				result[k] = plain
+			}
+		}
+		if result == nil {
+			return v, false
+		}
+		return result, true
+	case []any:
+		var result []any
+		for i, item := range v {
+			if plain, changed := unorder(item); changed {
+				if result == nil {
+					result = slices.Clone(v)
+				}
+				result[i] = plain
+			}
+		}
+		if result == nil {
+			return v, false
+		}
+		return result, true
+	default:
+		return value, false
+	}
+}
+
+// restoreOrder returns the merged value with its maps as OrderedMaps, ordered
+// by sources: the values the merged documents have at the current path, in
+// document order. List items are matched with the source items they came
+// from by primary key or, for items without one, by equality.
+func (m *UntypedMerger) restoreOrder(value any, sources []any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		result := &OrderedMap{Keys: make([]string, 0, len(v)), Values: make(map[string]any, len(v))}
+		for _, source := range sources {
+			if source, ok := source.(*OrderedMap); ok && source != nil {
+				for _, k := range source.Keys {
+					if val, exists := v[k]; exists {
+						result.Set(k, val)
+					}
+				}
+			}
+		}
+		for _, k := range sortedKeys(v) {
+			result.Set(k, v[k])
+		}
+		for _, k := range result.Keys {
+			m.push(k)
+			var children []any
+			for _, source := range sources {
+				if child, exists := orderedFieldValue(source, k); exists {
+					children = append(children, child)
+				}
+			}
+			result.Values[k] = m.restoreOrder(v[k], children)
+			m.pop()
+		}
+		return result
+	case []any:
+		type sourceItem struct {
+			item, plain, key any
+		}
+		var items []sourceItem
+		for _, source := range sources {
+			list, ok := asList(source)
+			if !ok {
+				continue
+			}
+			for i, item := range list {
+				plain := Unordered(item)
+				m.push(strconv.Itoa(i))
+				key := m.getPrimaryKey(plain)
+				m.pop()
+				if !isKeyComparable(key) {
+					key = nil
+				}
+				items = append(items, sourceItem{item: item, plain: plain, key: toMapKey(key)})
+			}
+		}
+		result := make([]any, len(v))
+		for i, item := range v {
+			m.push(strconv.Itoa(i))
+			key := m.getPrimaryKey(item)
+			if !isKeyComparable(key) {
+				key = nil
+			}
+			key = toMapKey(key)
+			var matches []any
+			for _, source := range items {
+				if key != nil && source.key == key || key == nil && equalValues(source.plain, item) {
+					matches = append(matches, source.item)
+				}
+			}
+			result[i] = m.restoreOrder(item, matches)
+			m.pop()
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// orderedFieldValue is like fieldValue, but also reads OrderedMaps.
+func orderedFieldValue(v any, name string) (any, bool) {
+	if v, ok := v.(*OrderedMap); ok {
+		if v == nil {
+			return nil, false
+		}
+		val, exists := v.Values[name]
+		return val, exists
+	}
+	return fieldValue(v, name)
+}
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestMerge_PreservesKeyOrder(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}, DeleteMarkerKey: "_delete"}
+	base := []byte(`{
+		"zone": "eu",
+		"services": [
+			{"name": "web", "replicas": 2, "image": "web:1"},
+			{"name": "db", "port": 5432}
+		],
+		"app": {"version": "1", "debug": false, "name": "demo"}
+	}`)
+	overlay := []byte(`{
+		"app": {"region": "west", "debug": true, "env": "prod"},
+		"services": [
+			{"name": "web", "limits": {"memory": "1Gi", "cpu": 2}, "image": "web:2"},
+			{"name": "db", "_delete": true},
+			{"port": 6379, "name": "cache"}
+		],
+		"feature": "on"
+	}`)
+	result, err := keymerge.Merge(opts, keymerge.UnmarshalOrderedJSON, json.Marshal, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"zone":"eu",` +
+		`"services":[{"name":"web","replicas":2,"image":"web:2","limits":{"memory":"1Gi","cpu":2}},{"port":6379,"name":"cache"}],` +
+		`"app":{"version":"1","debug":true,"name":"demo","region":"west","env":"prod"},` +
+		`"feature":"on"}`
+	if string(result) != expected {
+		t.Errorf("got  %s\nwant %s", result, expected)
+	}
+}
+
+func TestMergeUnstructured_MixedOrderedAndPlain(t *testing.T) {
+	base := &keymerge.OrderedMap{}
+	base.Set("b", 1)
+	base.Set("a", 2)
+	overlay := map[string]any{"d": 3, "c": map[string]any{"y": 1, "x": 2}}
+
+	result, err := keymerge.MergeUnstructured(keymerge.Options{}, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keys of plain maps come last, sorted
+	if expected := `{"b":1,"a":2,"c":{"x":2,"y":1},"d":3}`; string(encoded) != expected {
+		t.Errorf("got %s, want %s", encoded, expected)
+	}
+	if _, ok := base.Values["c"]; ok {
+		t.Error("expected the base document to be unchanged")
+	}
+
+	// Plain documents still merge to plain maps.
+	result, err = keymerge.MergeUnstructured(keymerge.Options{}, map[string]any{"a": 1}, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result.(map[string]any); !ok {
+		t.Errorf("expected a plain map, got %T", result)
+	}
+}
+
+func TestTrace_PreservesKeyOrder(t *testing.T) {
+	base := &keymerge.OrderedMap{}
+	base.Set("z", 1)
+	base.Set("a", 2)
+	trace, err := keymerge.Trace(keymerge.Options{}, base, map[string]any{"a": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := json.Marshal(trace.Result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"z":1,"a":3}`; string(encoded) != expected {
+		t.Errorf("got %s, want %s", encoded, expected)
+	}
+	expected := []keymerge.Change{{Kind: keymerge.ChangeModified, Path: "a", Old: 2, New: 3}}
+	if !reflect.DeepEqual(trace.Steps[1].Changes, expected) {
+		t.Errorf("got changes %+v, want %+v", trace.Steps[1].Changes, expected)
+	}
+}
+
+func TestUnmarshalOrderedJSON(t *testing.T) {
+	var doc any
+	if err := keymerge.UnmarshalOrderedJSON([]byte(`{"b": [{"y": 1, "x": null}], "a": 1.5, "b": true}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	m, ok := doc.(*keymerge.OrderedMap)
+	if !ok {
+		t.Fatalf("expected *OrderedMap, got %T", doc)
+	}
+	if !reflect.DeepEqual(m.Keys, []string{"b", "a"}) || m.Values["b"] != true || m.Values["a"] != 1.5 {
+		t.Errorf("unexpected map %+v", m)
+	}
+
+	expected := map[string]any{"b": true, "a": 1.5}
+	if plain := keymerge.Unordered(doc); !reflect.DeepEqual(plain, expected) {
+		t.Errorf("got %#v, want %#v", plain, expected)
+	}
+
+	var decoded keymerge.OrderedMap
+	if err := json.Unmarshal([]byte(`{"z": {"q": 1, "p": 2}, "y": []}`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := json.Marshal(&decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"z":{"q":1,"p":2},"y":[]}`; string(encoded) != expected {
+		t.Errorf("got %s, want %s", encoded, expected)
+	}
+
+	for _, invalid := range []string{`{"a": 1} {}`, `{"a" 1}`, `[1,`} {
+		if err := keymerge.UnmarshalOrderedJSON([]byte(invalid), &doc); err == nil {
+			t.Errorf("expected %q to fail", invalid)
+		}
+	}
+	if err := json.Unmarshal([]byte(`[1]`), &decoded); err == nil {
+		t.Error("expected unmarshaling a list into an OrderedMap to fail")
+	}
+	var notAny map[string]any
+	if err := keymerge.UnmarshalOrderedJSON([]byte(`{}`), &notAny); err == nil {
+		t.Error("expected a non-*any target to fail")
+	}
+}
@@ -0,0 +1,453 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPath indicates a path expression could not be parsed.
+var ErrInvalidPath = errors.New("invalid path")
+
+// stepKind identifies what a pathStep addresses.
+type stepKind int
+
+const (
+	// stepField selects a map key.
+	stepField stepKind = iota
+	// stepIndex selects a list item by position.
+	stepIndex
+	// stepSelect selects a list item by the values of one or more of its fields.
+	stepSelect
+	// stepWildcard selects every map value or list item. Only patterns may contain it.
+	stepWildcard
+	// stepRecursive selects a value and every value beneath it, at any depth.
+	// Only patterns may contain it.
+	stepRecursive
+)
+
+// keyMatch is a single name=value condition of a list item selector.
+type keyMatch struct {
+	name  string
+	value string
+}
+
+// pathStep is one step of a parsed path expression.
+type pathStep struct {
+	kind  stepKind
+	field string     // map key (stepField)
+	index int        // list position (stepIndex)
+	match []keyMatch // field conditions, all of which must hold (stepSelect)
+}
+
+// parsePath parses a path expression into steps. See [Lookup] for the syntax.
+func parsePath(path string) ([]pathStep, error) {
+	p := pathParser{input: path}
+	return p.parse()
+}
+
+// parsePattern parses a path expression that may also contain wildcards:
+// "*" as a field name matches every map value and "[*]" matches every list item,
+// while "**" as a field name matches any number of map keys and list positions,
+// including none, so "**.annotations" matches annotations at any depth.
+func parsePattern(pattern string) ([]pathStep, error) {
+	p := pathParser{input: pattern, wildcards: true}
+	return p.parse()
+}
+
+type pathParser struct {
+	input     string
+	pos       int
+	wildcards bool
+}
+
+func (p *pathParser) parse() ([]pathStep, error) {
+	var steps []pathStep
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		switch {
+		case c == '[':
+			step, err := p.parseBracket()
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, step)
+		case c == '.' && len(steps) > 0:
+			p.pos++
+			if p.pos >= len(p.input) || p.input[p.pos] == '.' || p.input[p.pos] == '[' {
+				return nil, p.errorf("expected field name after '.'")
+			}
+			steps = append(steps, p.fieldStep(p.parseBare(".[")))
+		case len(steps) == 0:
+			field := p.parseBare(".[")
+			if field == "" {
+				return nil, p.errorf("expected field name")
+			}
+			steps = append(steps, p.fieldStep(field))
+		default:
+			return nil, p.errorf("unexpected %q", c)
+		}
+	}
+	return steps, nil
+}
+
+// fieldStep returns the step for a bare field name, which is a wildcard
+// if the name is "*" or "**" and the parser accepts wildcards.
+func (p *pathParser) fieldStep(name string) pathStep {
+	if p.wildcards && name == "*" {
+		return pathStep{kind: stepWildcard}
+	}
+	if p.wildcards && name == "**" {
+		return pathStep{kind: stepRecursive}
+	}
+	return pathStep{kind: stepField, field: name}
+}
+
+// parseBracket parses an index, quoted key, selector, or wildcard enclosed in brackets.
+func (p *pathParser) parseBracket() (pathStep, error) {
+	p.pos++ // consume '['
+	if p.wildcards && strings.HasPrefix(p.input[p.pos:], "*]") {
+		p.pos += 2
+		return pathStep{kind: stepWildcard}, nil
+	}
+	if p.pos < len(p.input) && p.input[p.pos] == '"' {
+		field, err := p.parseQuoted()
+		if err != nil {
+			return pathStep{}, err
+		}
+		if err := p.expect(']'); err != nil {
+			return pathStep{}, err
+		}
+		return pathStep{kind: stepField, field: field}, nil
+	}
+
+	first := p.parseBare("=,]")
+	if p.pos < len(p.input) && p.input[p.pos] == ']' {
+		p.pos++
+		index, err := strconv.Atoi(first)
+		if err != nil || index < 0 {
+			return pathStep{}, p.errorf("invalid list index %q", first)
+		}
+		return pathStep{kind: stepIndex, index: index}, nil
+	}
+
+	step := pathStep{kind: stepSelect}
+	name := first
+	for {
+		if name == "" {
+			return pathStep{}, p.errorf("expected field name in selector")
+		}
+		if err := p.expect('='); err != nil {
+			return pathStep{}, err
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return pathStep{}, err
+		}
+		step.match = append(step.match, keyMatch{name: name, value: value})
+
+		if p.pos >= len(p.input) {
+			return pathStep{}, p.errorf("unterminated selector")
+		}
+		if p.input[p.pos] == ']' {
+			p.pos++
+			return step, nil
+		}
+		p.pos++ // consume ','
+		name = p.parseBare("=,]")
+	}
+}
+
+// parseValue parses a selector value, which is either quoted or runs until ',' or ']'.
+func (p *pathParser) parseValue() (string, error) {
+	if p.pos < len(p.input) && p.input[p.pos] == '"' {
+		return p.parseQuoted()
+	}
+	return p.parseBare(",]"), nil
+}
+
+// parseBare consumes characters up to (not including) any of the stop characters.
+func (p *pathParser) parseBare(stop string) string {
+	start := p.pos
+	for p.pos < len(p.input) && !strings.ContainsRune(stop, rune(p.input[p.pos])) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+// parseQuoted consumes a double-quoted Go string literal.
+func (p *pathParser) parseQuoted() (string, error) {
+	start := p.pos
+	p.pos++ // consume opening quote
+	for p.pos < len(p.input) {
+		switch p.input[p.pos] {
+		case '\\':
+			p.pos += 2
+			continue
+		case '"':
+			p.pos++
+			s, err := strconv.Unquote(p.input[start:p.pos])
+			if err != nil {
+				return "", p.errorf("invalid quoted string %s", p.input[start:p.pos])
+			}
+			return s, nil
+		}
+		p.pos++
+	}
+	return "", p.errorf("unterminated quoted string")
+}
+
+func (p *pathParser) expect(c byte) error {
+	if p.pos >= len(p.input) || p.input[p.pos] != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *pathParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w %q at offset %d: %s", ErrInvalidPath, p.input, p.pos, fmt.Sprintf(format, args...))
+}
+
+// formatPath renders steps as a canonical path expression.
+func formatPath(steps []pathStep) string {
+	path := ""
+	for _, step := range steps {
+		path = appendStep(path, step)
+	}
+	return path
+}
+
+// appendStep appends a single step to a path expression.
+func appendStep(prefix string, step pathStep) string {
+	switch step.kind {
+	case stepField:
+		return appendFieldPath(prefix, step.field)
+	case stepIndex:
+		return appendIndexPath(prefix, step.index)
+	case stepWildcard:
+		return prefix + "[*]"
+	case stepRecursive:
+		if prefix == "" {
+			return "**"
+		}
+		return prefix + ".**"
+	default:
+		return appendSelectorPath(prefix, step.match)
+	}
+}
+
+// appendFieldPath appends a map key step to a path expression,
+// quoting the key if it contains characters with special meaning.
+func appendFieldPath(prefix, name string) string {
+	if name == "" || name == "*" || name == "**" || strings.ContainsAny(name, `.[]"`) {
+		return prefix + "[" + strconv.Quote(name) + "]"
+	}
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// appendIndexPath appends a list position step to a path expression.
+func appendIndexPath(prefix string, index int) string {
+	return prefix + "[" + strconv.Itoa(index) + "]"
+}
+
+// appendSelectorPath appends a list item selector step to a path expression.
+func appendSelectorPath(prefix string, match []keyMatch) string {
+	var b strings.Builder
+	b.WriteString(prefix)
+	b.WriteByte('[')
+	for i, m := range match {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(m.name)
+		b.WriteByte('=')
+		if m.value == "" || strings.ContainsAny(m.value, `,]"`) {
+			b.WriteString(strconv.Quote(m.value))
+		} else {
+			b.WriteString(m.value)
+		}
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// isSelectorName reports whether name can be used as a field name in a selector.
+func isSelectorName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `=,]"`)
+}
+
+// isPathWithin reports whether path equals ancestor or addresses a value beneath it.
+// Both paths must be canonical (see formatPath).
+func isPathWithin(path, ancestor string) bool {
+	if ancestor == "" || path == ancestor {
+		return true
+	}
+	if !strings.HasPrefix(path, ancestor) {
+		return false
+	}
+	next := path[len(ancestor)]
+	return next == '.' || next == '['
+}
+
+// Lookup returns the value at the given path within a merged (or unmerged) document.
+// The boolean result reports whether the path exists.
+//
+// Path expressions address values inside documents:
+//   - "database.host" selects nested map keys
+//   - "services[0]" selects a list item by position
+//   - "services[name=web].port" selects the list item whose name field is "web"
+//   - "endpoints[region=us,name=api]" selects an item matching several fields
+//   - "pods[metadata.name=web]" selects an item by a field of a nested map
+//   - `data["config.yaml"]` selects a map key containing special characters
+//
+// Selector values are compared with the item's field values formatted by
+// [fmt.Sprint], so "port=8080" matches both integer and string values.
+// Keys and values may be double-quoted. The empty path addresses the root.
+//
+// Returns an error wrapping [ErrInvalidPath] if the path cannot be parsed.
+func Lookup(doc any, path string) (any, bool, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := lookupSteps(doc, steps)
+	return value, ok, nil
+}
+
+// lookupSteps walks doc following the parsed steps.
+func lookupSteps(doc any, steps []pathStep) (any, bool) {
+	current := doc
+	for _, step := range steps {
+		next, ok := applyStep(current, step)
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	return current, true
+}
+
+// applyStep resolves a single step against a value.
+func applyStep(value any, step pathStep) (any, bool) {
+	switch step.kind {
+	case stepField:
+		mp, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		v, ok := mp[step.field]
+		return v, ok
+	case stepIndex:
+		list, ok := asList(value)
+		if !ok || step.index >= len(list) {
+			return nil, false
+		}
+		return list[step.index], true
+	case stepWildcard, stepRecursive:
+		return nil, false
+	default: // stepSelect
+		list, ok := asList(value)
+		if !ok {
+			return nil, false
+		}
+		for _, item := range list {
+			if matchesSelector(item, step.match) {
+				return item, true
+			}
+		}
+		return nil, false
+	}
+}
+
+// pathMatch is a value found by expanding a pattern, along with its concrete path.
+type pathMatch struct {
+	path  string
+	value any
+}
+
+// expandSteps returns every value of doc addressed by the pattern steps, in
+// document order (map keys sorted), along with their concrete paths. List items
+// reached by a wildcard are addressed by position.
+func expandSteps(doc any, steps []pathStep) []pathMatch {
+	current := []pathMatch{{value: doc}}
+	for _, step := range steps {
+		var next []pathMatch
+		if step.kind == stepRecursive {
+			seen := make(map[string]bool)
+			for _, m := range current {
+				next = appendDescendants(next, m, seen)
+			}
+			current = next
+			continue
+		}
+		for _, m := range current {
+			if step.kind != stepWildcard {
+				if value, ok := applyStep(m.value, step); ok {
+					next = append(next, pathMatch{path: appendStep(m.path, step), value: value})
+				}
+				continue
+			}
+			if mp, ok := m.value.(map[string]any); ok {
+				for _, k := range sortedKeys(mp) {
+					next = append(next, pathMatch{path: appendFieldPath(m.path, k), value: mp[k]})
+				}
+			} else if list, ok := asList(m.value); ok {
+				for i, item := range list {
+					next = append(next, pathMatch{path: appendIndexPath(m.path, i), value: item})
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// appendDescendants appends m and every value beneath it to matches, in
+// document order, skipping paths already seen.
+func appendDescendants(matches []pathMatch, m pathMatch, seen map[string]bool) []pathMatch {
+	if seen[m.path] {
+		return matches
+	}
+	seen[m.path] = true
+	matches = append(matches, m)
+	if mp, ok := m.value.(map[string]any); ok {
+		for _, k := range sortedKeys(mp) {
+			matches = appendDescendants(matches, pathMatch{path: appendFieldPath(m.path, k), value: mp[k]}, seen)
+		}
+	} else if list, ok := asList(m.value); ok {
+		for i, item := range list {
+			matches = appendDescendants(matches, pathMatch{path: appendIndexPath(m.path, i), value: item}, seen)
+		}
+	}
+	return matches
+}
+
+// matchesSelector reports whether item is a map whose fields satisfy every condition.
+func matchesSelector(item any, match []keyMatch) bool {
+	mp, ok := item.(map[string]any)
+	if !ok {
+		return false
+	}
+	for _, m := range match {
+		v, exists := keyFieldValue(mp, m.name)
+		if !exists || v == nil || fmt.Sprint(v) != m.value {
+			return false
+		}
+	}
+	return true
+}
+
+// asList returns value as []any, converting typed slices when necessary.
+func asList(value any) ([]any, bool) {
+	if list, ok := value.([]any); ok {
+		return list, true
+	}
+	return toSliceAny(value)
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestLookup(t *testing.T) {
+	doc := map[string]any{
+		"database": map[string]any{"host": "localhost", "port": 5432},
+		"services": []any{
+			map[string]any{"name": "api", "port": 8080},
+			map[string]any{"name": "web", "port": 80},
+		},
+		"endpoints": []map[string]any{
+			{"region": "us", "name": "api", "url": "us.example.com"},
+			{"region": "eu", "name": "api", "url": "eu.example.com"},
+		},
+		"data": map[string]any{"config.yaml": "a: 1"},
+		"pods": []any{map[string]any{"metadata": map[string]any{"name": "web"}, "image": "web:1"}},
+	}
+
+	tests := []struct {
+		path     string
+		expected any
+		found    bool
+	}{
+		{"", doc, true},
+		{"database.host", "localhost", true},
+		{"database.missing", nil, false},
+		{"database.host.deeper", nil, false},
+		{"services[1].name", "web", true},
+		{"services[2]", nil, false},
+		{"services[name=web].port", 80, true},
+		{"services[port=8080].name", "api", true},
+		{"services[name=db]", nil, false},
+		{"pods[metadata.name=web].image", "web:1", true},
+		{"endpoints[region=eu,name=api].url", "eu.example.com", true},
+		{`endpoints[region="us",name="api"].url`, "us.example.com", true},
+		{`data["config.yaml"]`, "a: 1", true},
+		{"database[0]", nil, false},
+		{"database[name=x]", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			value, found, err := keymerge.Lookup(doc, tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != tt.found {
+				t.Fatalf("expected found=%v, got %v", tt.found, found)
+			}
+			if !reflect.DeepEqual(value, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, value)
+			}
+		})
+	}
+}
+
+func TestLookup_InvalidPath(t *testing.T) {
+	paths := []string{
+		".a",
+		"a.",
+		"a..b",
+		"a.[0]",
+		"a[",
+		"a[-1]",
+		"a[x]",
+		"a[=x]",
+		"a[x=1",
+		`a["unterminated]`,
+		`a["x"`,
+		`a[x="\q"]`,
+		"a[0]b",
+	}
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			_, _, err := keymerge.Lookup(map[string]any{}, path)
+			if !errors.Is(err, keymerge.ErrInvalidPath) {
+				t.Fatalf("expected ErrInvalidPath, got %v", err)
+			}
+		})
+	}
+}
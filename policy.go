@@ -0,0 +1,346 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidPolicy indicates a policy could not be parsed.
+	ErrInvalidPolicy = errors.New("invalid policy")
+	// ErrPolicyViolation indicates a document violated an error-severity policy rule.
+	ErrPolicyViolation = errors.New("policy violation")
+)
+
+// Severity tells how serious a policy violation is.
+type Severity int
+
+const (
+	// SeverityError violations fail [Policy.Enforce].
+	SeverityError Severity = iota
+	// SeverityWarning violations are reported but don't fail [Policy.Enforce].
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("Severity(%d)", s)
+	}
+}
+
+// Violation describes a value that matched a policy rule.
+type Violation struct {
+	// Rule is the rule's condition as written, e.g. "services[*].port < 1024".
+	Rule string
+	// Path is the concrete path of the offending value, e.g. "services[2].port".
+	Path string
+	// Value is the offending value (nil if the rule reports a missing value).
+	Value any
+	// Severity is the severity of the rule.
+	Severity Severity
+	// Message is the rule's message, or its condition if it has none.
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s at %s: %s", v.Severity, v.Path, v.Message)
+}
+
+// PolicyError is returned by [Policy.Enforce] when a document violates
+// one or more error-severity rules.
+type PolicyError struct {
+	// Violations are the error-severity violations, in rule order.
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.String()
+	}
+	return fmt.Sprintf("%d policy violation(s): %s", len(e.Violations), strings.Join(messages, "; "))
+}
+
+func (e *PolicyError) Is(target error) bool {
+	return target == ErrPolicyViolation
+}
+
+// Policy is a set of rules checked against merged documents.
+type Policy struct {
+	rules []policyRule
+}
+
+// policyRule is a single parsed rule.
+type policyRule struct {
+	condition string
+	steps     []pathStep
+	op        string
+	value     any
+	re        *regexp.Regexp
+	severity  Severity
+	message   string
+}
+
+// policyOps are the comparison operators, longest first so that "<=" is not read as "<".
+var policyOps = []string{"==", "!=", "<=", ">=", "=~", "<", ">"}
+
+// ParsePolicy parses policy rules, one per line. Each rule describes a
+// condition that is a violation when it holds:
+//
+//	PATTERN CONDITION -> SEVERITY[: MESSAGE]
+//
+// PATTERN is a path expression (see [Lookup]) that may contain wildcards:
+// "[*]" matches every list item and "*" as a field name matches every map value.
+// CONDITION is one of:
+//   - "== VALUE", "!= VALUE": the value equals (or differs from) VALUE
+//   - "< VALUE", "<= VALUE", "> VALUE", ">= VALUE": numbers or strings compare so
+//   - "=~ REGEXP": the value, formatted by [fmt.Sprint], matches REGEXP
+//   - "exists": the value is present
+//   - "missing": the value is absent
+//
+// VALUE is a number, true, false, null, a double-quoted string, or a bare word.
+// SEVERITY is "error" or "warning". Blank lines and lines starting with '#' are
+// ignored. Example:
+//
+//	# Privileged ports need a security review.
+//	services[*].port < 1024 -> error: privileged ports are not allowed
+//	services[*].replicas missing -> warning
+//	log.level == debug -> warning: debug logging in production
+//
+// Returns an error wrapping [ErrInvalidPolicy] if a rule cannot be parsed.
+func ParsePolicy(src string) (*Policy, error) {
+	var p Policy
+	for i, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %w", ErrInvalidPolicy, i+1, err)
+		}
+		p.rules = append(p.rules, rule)
+	}
+	return &p, nil
+}
+
+// parseRule parses a single non-empty rule line.
+func parseRule(line string) (policyRule, error) {
+	arrow := strings.Index(line, "->")
+	if arrow < 0 {
+		return policyRule{}, errors.New(`expected "-> SEVERITY"`)
+	}
+	rule := policyRule{condition: strings.TrimSpace(line[:arrow])}
+
+	severity, message, _ := strings.Cut(line[arrow+2:], ":")
+	switch strings.TrimSpace(severity) {
+	case "error":
+		rule.severity = SeverityError
+	case "warning":
+		rule.severity = SeverityWarning
+	default:
+		return policyRule{}, fmt.Errorf("unknown severity %q", strings.TrimSpace(severity))
+	}
+	rule.message = strings.TrimSpace(message)
+	if rule.message == "" {
+		rule.message = rule.condition
+	}
+
+	pattern, condition := splitPattern(rule.condition)
+	steps, err := parsePattern(pattern)
+	if err != nil {
+		return policyRule{}, err
+	}
+	rule.steps = steps
+
+	if condition == "exists" || condition == "missing" {
+		rule.op = condition
+		return rule, nil
+	}
+	for _, op := range policyOps {
+		if operand, ok := strings.CutPrefix(condition, op); ok {
+			rule.op = op
+			operand = strings.TrimSpace(operand)
+			if operand == "" {
+				return policyRule{}, fmt.Errorf("expected value after %q", op)
+			}
+			rule.value, err = parseRuleValue(operand)
+			if err != nil {
+				return policyRule{}, err
+			}
+			if op == "=~" {
+				rule.re, err = regexp.Compile(fmt.Sprint(rule.value))
+				if err != nil {
+					return policyRule{}, err
+				}
+			}
+			return rule, nil
+		}
+	}
+	return policyRule{}, fmt.Errorf("expected condition after pattern, got %q", condition)
+}
+
+// splitPattern splits a condition at the first space outside quotes and brackets.
+func splitPattern(condition string) (pattern, rest string) {
+	depth, quoted := 0, false
+	for i := 0; i < len(condition); i++ {
+		switch c := condition[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == ' ' && depth == 0:
+			return condition[:i], strings.TrimSpace(condition[i:])
+		}
+	}
+	return condition, ""
+}
+
+// parseRuleValue parses a literal rule operand.
+func parseRuleValue(s string) (any, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string %s", s)
+		}
+		return v, nil
+	case s == "true":
+		return true, nil
+	case s == "false":
+		return false, nil
+	case s == "null":
+		return nil, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	return s, nil
+}
+
+// Check returns every violation of the policy's rules in doc, ordered by rule
+// and then by document order.
+func (p *Policy) Check(doc any) []Violation {
+	var violations []Violation
+	for _, rule := range p.rules {
+		violations = rule.check(doc, violations)
+	}
+	return violations
+}
+
+// Enforce checks doc and returns a [*PolicyError] listing the error-severity
+// violations, if any. Warnings are ignored; use [Policy.Check] to report them.
+func (p *Policy) Enforce(doc any) error {
+	var errs []Violation
+	for _, v := range p.Check(doc) {
+		if v.Severity == SeverityError {
+			errs = append(errs, v)
+		}
+	}
+	if len(errs) > 0 {
+		return &PolicyError{Violations: errs}
+	}
+	return nil
+}
+
+// check appends the rule's violations in doc to violations.
+func (r *policyRule) check(doc any, violations []Violation) []Violation {
+	// Expand wildcards up to the last one; the remaining steps are resolved
+	// from each match so that "missing" can report absent values.
+	split := 0
+	for i, step := range r.steps {
+		if step.kind == stepWildcard || step.kind == stepRecursive {
+			split = i + 1
+		}
+	}
+	for _, parent := range expandSteps(doc, r.steps[:split]) {
+		value, found := lookupSteps(parent.value, r.steps[split:])
+		if !r.matches(value, found) {
+			continue
+		}
+		path := parent.path
+		for _, step := range r.steps[split:] {
+			path = appendStep(path, step)
+		}
+		if !found {
+			value = nil
+		}
+		violations = append(violations, Violation{
+			Rule:     r.condition,
+			Path:     path,
+			Value:    value,
+			Severity: r.severity,
+			Message:  r.message,
+		})
+	}
+	return violations
+}
+
+// matches reports whether the rule's condition holds for a value.
+func (r *policyRule) matches(value any, found bool) bool {
+	switch r.op {
+	case "missing":
+		return !found
+	case "exists":
+		return found
+	}
+	if !found {
+		return false
+	}
+
+	switch r.op {
+	case "==":
+		return equalValues(value, r.value)
+	case "!=":
+		return !equalValues(value, r.value)
+	case "=~":
+		return r.re.MatchString(fmt.Sprint(value))
+	}
+
+	cmp, ok := compareOrdered(value, r.value)
+	if !ok {
+		return false
+	}
+	switch r.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default: // ">="
+		return cmp >= 0
+	}
+}
+
+// compareOrdered compares two numbers or two strings. The boolean result is
+// false if the values cannot be ordered.
+func compareOrdered(a, b any) (int, bool) {
+	if an, ok := toBigFloat(a); ok {
+		if bn, ok := toBigFloat(b); ok {
+			return an.Cmp(bn), true
+		}
+		return 0, false
+	}
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if aok && bok {
+		return strings.Compare(as, bs), true
+	}
+	return 0, false
+}
@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	policy, err := keymerge.ParsePolicy(`
+# Ports below 1024 need root.
+services[*].port < 1024 -> error: privileged ports are not allowed
+services[*].replicas missing -> warning
+log.level == debug -> warning: debug logging
+database.host =~ ^localhost -> error
+database.password exists -> error: use a secret reference
+limits.* > 100 -> warning
+data["app.yaml"] != "ok" -> warning
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := map[string]any{
+		"services": []any{
+			map[string]any{"name": "web", "port": 80, "replicas": 2},
+			map[string]any{"name": "api", "port": uint64(8080)},
+			map[string]any{"name": "admin", "port": "443"},
+		},
+		"log":      map[string]any{"level": "debug"},
+		"database": map[string]any{"host": "localhost:5432"},
+		"limits":   map[string]any{"cpu": 200, "memory": 50.5},
+		"data":     map[string]any{"app.yaml": "ok"},
+	}
+
+	expected := []keymerge.Violation{
+		{Rule: "services[*].port < 1024", Path: "services[0].port", Value: 80,
+			Severity: keymerge.SeverityError, Message: "privileged ports are not allowed"},
+		{Rule: "services[*].replicas missing", Path: "services[1].replicas",
+			Severity: keymerge.SeverityWarning, Message: "services[*].replicas missing"},
+		{Rule: "services[*].replicas missing", Path: "services[2].replicas",
+			Severity: keymerge.SeverityWarning, Message: "services[*].replicas missing"},
+		{Rule: "log.level == debug", Path: "log.level", Value: "debug",
+			Severity: keymerge.SeverityWarning, Message: "debug logging"},
+		{Rule: "database.host =~ ^localhost", Path: "database.host", Value: "localhost:5432",
+			Severity: keymerge.SeverityError, Message: "database.host =~ ^localhost"},
+		{Rule: "limits.* > 100", Path: "limits.cpu", Value: 200,
+			Severity: keymerge.SeverityWarning, Message: "limits.* > 100"},
+	}
+	violations := policy.Check(doc)
+	if !reflect.DeepEqual(violations, expected) {
+		t.Fatalf("unexpected violations:\n got: %+v\nwant: %+v", violations, expected)
+	}
+}
+
+func TestPolicy_Enforce(t *testing.T) {
+	policy, err := keymerge.ParsePolicy("port < 1024 -> error: privileged\nport != 8080 -> warning\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := policy.Enforce(map[string]any{"port": 9000}); err != nil {
+		t.Fatalf("warnings should not fail enforcement: %v", err)
+	}
+
+	err = policy.Enforce(map[string]any{"port": 80})
+	if !errors.Is(err, keymerge.ErrPolicyViolation) {
+		t.Fatalf("expected ErrPolicyViolation, got %v", err)
+	}
+	var policyErr *keymerge.PolicyError
+	if !errors.As(err, &policyErr) || len(policyErr.Violations) != 1 {
+		t.Fatalf("expected one error violation, got %v", err)
+	}
+	if err.Error() != "1 policy violation(s): error at port: privileged" {
+		t.Fatalf("unexpected message: %v", err)
+	}
+}
+
+func TestPolicy_Values(t *testing.T) {
+	doc := map[string]any{"enabled": true, "name": "a b", "nothing": nil, "version": "1.10"}
+	tests := []struct {
+		rule      string
+		violation bool
+	}{
+		{`enabled == true -> error`, true},
+		{`enabled != false -> error`, true},
+		{`name == "a b" -> error`, true},
+		{`nothing == null -> error`, true},
+		{`version >= "1.2" -> error`, false},
+		{`version < 2 -> error`, false},
+		{`missing == 1 -> error`, false},
+		{`name missing -> error`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			policy, err := keymerge.ParsePolicy(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(policy.Check(doc)) > 0; got != tt.violation {
+				t.Fatalf("violation = %v, want %v", got, tt.violation)
+			}
+		})
+	}
+}
+
+func TestParsePolicy_Invalid(t *testing.T) {
+	tests := []string{
+		"port < 1024",
+		"port < 1024 -> fatal",
+		"port -> error",
+		"port ~ 1 -> error",
+		"port < -> error",
+		`name == "unterminated -> error`,
+		"name =~ [ -> error",
+		"services[ < 1 -> error",
+	}
+	for _, rule := range tests {
+		t.Run(rule, func(t *testing.T) {
+			_, err := keymerge.ParsePolicy("# header\n" + rule)
+			if !errors.Is(err, keymerge.ErrInvalidPolicy) {
+				t.Fatalf("expected ErrInvalidPolicy, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSeverity_String(t *testing.T) {
+	if keymerge.SeverityError.String() != "error" || keymerge.SeverityWarning.String() != "warning" {
+		t.Fatal("unexpected severity names")
+	}
+	if keymerge.Severity(7).String() != "Severity(7)" {
+		t.Fatal("unexpected name for unknown severity")
+	}
+}
+
+func TestPolicy_RecursiveWildcard(t *testing.T) {
+	policy, err := keymerge.ParsePolicy(`**.image =~ :latest$ -> error: pin image tags`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]any{
+		"image": "base:latest",
+		"spec": map[string]any{
+			"containers": []any{
+				map[string]any{"name": "web", "image": "web:1.2"},
+				map[string]any{"name": "sidecar", "image": "proxy:latest"},
+			},
+		},
+	}
+	var paths []string
+	for _, v := range policy.Check(doc) {
+		paths = append(paths, v.Path)
+	}
+	if expected := []string{"image", "spec.containers[1].image"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("got %v, want %v", paths, expected)
+	}
+}
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MergerPool merges from any number of goroutines at once, such as HTTP
+// handlers, with copies of one configured [Merger]. Each call takes a copy from
+// the pool, so merges never share state, and returns it afterwards.
+//
+// The copies share the prototype's configuration, including its metadata,
+// grants, normalizers, and matchers, none of which merges change. Callbacks,
+// such as a progress function, [KeyFunc], or [ScalarStrategy], are called from
+// every goroutine that merges and must be safe for concurrent use.
+//
+// A MergerPool is safe for concurrent use.
+//
+// Example:
+//
+//	merger, err := keymerge.NewMerger[Config](opts, yaml.Unmarshal, yaml.Marshal)
+//	if err != nil {
+//		return err
+//	}
+//	merger.SetLimits(keymerge.SandboxLimits())
+//	pool := keymerge.NewMergerPool(merger)
+//
+//	http.HandleFunc("/merge", func(w http.ResponseWriter, r *http.Request) {
+//		merged, err := pool.Merge(base, readBody(r))
+//		...
+//	})
+type MergerPool[T any] struct {
+	prototype *UntypedMerger
+	pool      sync.Pool
+}
+
+// NewMergerPool returns a [MergerPool] of copies of prototype, as configured
+// when NewMergerPool is called; configuring prototype afterwards does not
+// change the pool. prototype must not be merging while NewMergerPool runs.
+func NewMergerPool[T any](prototype *Merger[T]) *MergerPool[T] {
+	p := &MergerPool[T]{prototype: prototype.clone()}
+	p.pool.New = func() any {
+		return &Merger[T]{UntypedMerger: p.prototype.clone()}
+	}
+	return p
+}
+
+// Merge merges byte documents like [UntypedMerger.Merge].
+func (p *MergerPool[T]) Merge(docs ...[]byte) ([]byte, error) {
+	var result []byte
+	err := p.With(func(m *Merger[T]) error {
+		var err error
+		result, err = m.Merge(docs...)
+		return err
+	})
+	return result, err
+}
+
+// MergeUnstructured merges documents like [UntypedMerger.MergeUnstructured].
+func (p *MergerPool[T]) MergeUnstructured(docs ...any) (any, error) {
+	var result any
+	err := p.With(func(m *Merger[T]) error {
+		var err error
+		result, err = m.MergeUnstructured(docs...)
+		return err
+	})
+	return result, err
+}
+
+// MergeTyped merges Go values like [Merger.MergeTyped].
+func (p *MergerPool[T]) MergeTyped(base T, overlays ...T) (T, error) {
+	var result T
+	err := p.With(func(m *Merger[T]) error {
+		var err error
+		result, err = m.MergeTyped(base, overlays...)
+		return err
+	})
+	return result, err
+}
+
+// With calls fn with a merger of its own for the duration of the call, for
+// uses the other methods don't cover, such as [UntypedMerger.Trace] or
+// reading [UntypedMerger.Duplicates] after a merge. fn must not keep the
+// merger after it returns.
+func (p *MergerPool[T]) With(fn func(*Merger[T]) error) error {
+	m := p.pool.Get().(*Merger[T])
+	defer p.pool.Put(m)
+	return fn(m)
+}
+
+// clone returns a merger with m's configuration and none of its merge state.
+func (m *UntypedMerger) clone() *UntypedMerger {
+	c := *m
+	c.path, c.moves, c.duplicates, c.claims = nil, nil, nil, nil
+	c.index, c.values, c.busy = 0, 0, 0
+	c.deadline = time.Time{}
+	return &c
+}
+
+// acquire marks m as merging until the returned function is called. It panics
+// if m is merging already, which means it is being used concurrently, since
+// merges don't nest.
+func (m *UntypedMerger) acquire() (release func()) {
+	if !atomic.CompareAndSwapUint32(&m.busy, 0, 1) {
+		panic("keymerge: concurrent use of an UntypedMerger; use a MergerPool or a merger per goroutine")
+	}
+	return func() { atomic.StoreUint32(&m.busy, 0) }
+}
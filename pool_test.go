@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestMergerPool(t *testing.T) {
+	type Service struct {
+		Name string `json:"name" km:"primary"`
+		Port int    `json:"port"`
+	}
+	type Config struct {
+		Services []Service `json:"services"`
+	}
+	merger, err := keymerge.NewMerger[Config](keymerge.Options{}, json.Unmarshal, json.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := merger.SetLimits(keymerge.Limits{MaxDepth: 10}); err != nil {
+		t.Fatal(err)
+	}
+	pool := keymerge.NewMergerPool(merger)
+
+	// Later configuration of the prototype doesn't reach the pool.
+	if err := merger.SetLimits(keymerge.Limits{MaxDepth: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	base := []byte(`{"services": [{"name": "web", "port": 80}]}`)
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				overlay := fmt.Appendf(nil, `{"services": [{"name": "web", "port": %d}, {"name": "db%d"}]}`, i*100+j, i)
+				result, err := pool.Merge(base, overlay)
+				if err != nil {
+					errs <- err
+					return
+				}
+				want := fmt.Sprintf(`{"services":[{"name":"web","port":%d},{"name":"db%d"}]}`, i*100+j, i)
+				if string(result) != want {
+					errs <- fmt.Errorf("got %s, want %s", result, want)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	typed, err := pool.MergeTyped(Config{Services: []Service{{Name: "web", Port: 80}}}, Config{Services: []Service{{Name: "web", Port: 8080}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Config{Services: []Service{{Name: "web", Port: 8080}}}); !reflect.DeepEqual(typed, want) {
+		t.Errorf("got %+v, want %+v", typed, want)
+	}
+	if _, err := pool.MergeUnstructured(map[string]any{"a": 1}, map[string]any{"b": 2}); err != nil {
+		t.Error(err)
+	}
+	err = pool.With(func(m *keymerge.Merger[Config]) error {
+		if limits := m.Limits(); limits.MaxDepth != 10 {
+			t.Errorf("expected the prototype's limits, got %+v", limits)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMergerConcurrentUsePanics(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A merge starting while another runs is concurrent use, whichever
+	// goroutine starts it.
+	var recovered any
+	merger.SetProgress(1, func(keymerge.Progress) {
+		if recovered != nil {
+			return
+		}
+		defer func() { recovered = recover() }()
+		_, _ = merger.MergeUnstructured(map[string]any{"b": 2})
+	})
+	if _, err := merger.MergeUnstructured(map[string]any{"a": 1}, map[string]any{"a": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if recovered == nil {
+		t.Fatal("expected a panic for overlapping merges")
+	}
+
+	// The merger is usable again once the merge returns.
+	merger.SetProgress(1, nil)
+	if _, err := merger.MergeUnstructured(map[string]any{"a": 1}); err != nil {
+		t.Error(err)
+	}
+}
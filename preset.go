@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Preset names a bundle of merge options for a common kind of document, so that
+// merges of such documents work without rediscovering which fields identify
+// their list items and which lists to dedup or replace. See [Options.Preset].
+type Preset int
+
+const (
+	// PresetNone adds no options (default behavior).
+	PresetNone Preset = iota
+	// PresetKubernetes merges Kubernetes manifests like strategic merge
+	// patches do: volume mounts by mountPath, container ports by
+	// containerPort, and containers, env vars, volumes, and service ports by
+	// name (or port). Lists without keys, such as args, are replaced, except
+	// finalizers, which are deduped, and node selectors are replaced whole.
+	PresetKubernetes
+	// PresetDockerCompose merges Docker Compose files like "docker compose -f"
+	// does: lists such as ports, volumes, and depends_on are deduped, with
+	// long-syntax volumes, ports, secrets, and configs keyed by target or
+	// source, while command, entrypoint, and healthcheck tests are replaced.
+	// Environment variables and labels merge by name when written as maps;
+	// lists of "KEY=value" strings are only deduped.
+	PresetDockerCompose
+	// PresetGitHubActions merges GitHub Actions workflows: steps by id or
+	// name, and lists such as branches, paths, and needs deduped, while
+	// runs-on labels and matrix values are replaced.
+	PresetGitHubActions
+	// PresetFeatureFlags merges feature flag documents: flags by name and
+	// their rules by id, with other lists, such as targeted users, deduped.
+	// Rollouts, the percentages of users each variation gets, are replaced
+	// whole, since they must total 100. Each flag's environments, by name,
+	// must set either a state or a rollout once merged, or the merge fails
+	// with a [*FeatureFlagError]:
+	//
+	//	flags:
+	//	  - name: new-checkout
+	//	    rules: [{id: beta, segment: beta-users, state: on}]
+	//	    environments:
+	//	      - {name: staging, state: on}
+	//	      - {name: prod, rollout: {on: 10, off: 90}}
+	PresetFeatureFlags
+)
+
+func (p Preset) String() string {
+	switch p {
+	case PresetNone:
+		return "PresetNone"
+	case PresetKubernetes:
+		return "PresetKubernetes"
+	case PresetDockerCompose:
+		return "PresetDockerCompose"
+	case PresetGitHubActions:
+		return "PresetGitHubActions"
+	case PresetFeatureFlags:
+		return "PresetFeatureFlags"
+	default:
+		return fmt.Sprintf("Preset(%d)", p)
+	}
+}
+
+// presetNames are the names of the presets in configuration files and flags,
+// e.g. cfgmerge's -preset.
+var presetNames = map[Preset]string{
+	PresetNone:          "none",
+	PresetKubernetes:    "kubernetes",
+	PresetDockerCompose: "compose",
+	PresetGitHubActions: "github-actions",
+	PresetFeatureFlags:  "feature-flags",
+}
+
+// ParsePreset returns the [Preset] named "none", "kubernetes", "compose",
+// "github-actions", or "feature-flags", ignoring case. The empty string names the default,
+// [PresetNone]. These are the names cfgmerge accepts.
+//
+// Returns an error wrapping [ErrInvalidOptions] for any other name.
+func ParsePreset(name string) (Preset, error) {
+	return parseMode(name, "preset", presetNames)
+}
+
+// MarshalText encodes p by the name [ParsePreset] accepts.
+func (p Preset) MarshalText() ([]byte, error) {
+	return marshalMode(p, presetNames)
+}
+
+// UnmarshalText decodes a name accepted by [ParsePreset].
+func (p *Preset) UnmarshalText(text []byte) error {
+	preset, err := ParsePreset(string(text))
+	if err != nil {
+		return err
+	}
+	*p = preset
+	return nil
+}
+
+// presets holds the options each preset adds.
+var presets = map[Preset]Options{
+	PresetNone: {},
+	PresetKubernetes: {
+		PrimaryKeyNames: []string{"mountPath", "devicePath", "containerPort", "name", "port"},
+		ScalarMode:      ScalarReplace,
+		ScalarModes:     map[string]ScalarMode{"**.finalizers": ScalarDedup},
+		ReplaceMaps:     []string{"**.nodeSelector"},
+	},
+	PresetDockerCompose: {
+		PrimaryKeyNames: []string{"target", "source"},
+		ScalarMode:      ScalarDedup,
+		ScalarModes: map[string]ScalarMode{
+			"services.*.command":          ScalarReplace,
+			"services.*.entrypoint":       ScalarReplace,
+			"services.*.healthcheck.test": ScalarReplace,
+		},
+	},
+	PresetGitHubActions: {
+		PrimaryKeyNames: []string{"id", "name"},
+		ScalarMode:      ScalarDedup,
+		ScalarModes: map[string]ScalarMode{
+			"jobs.*.runs-on":           ScalarReplace,
+			"jobs.*.strategy.matrix.*": ScalarReplace,
+		},
+	},
+	PresetFeatureFlags: {
+		PrimaryKeyNames: []string{"id", "name"},
+		ScalarMode:      ScalarDedup,
+		ScalarModes:     map[string]ScalarMode{"**.rollout": ScalarReplace},
+		ReplaceMaps:     []string{"**.rollout"},
+	},
+}
+
+// withPreset returns opts with the options of opts.Preset added: its primary
+// key names after those of opts, its list modes and replaced maps for patterns
+// opts doesn't name, and its ScalarMode if opts leaves it at [ScalarConcat].
+// Adding a preset's options again changes nothing.
+func withPreset(opts Options) (Options, error) {
+	preset, ok := presets[opts.Preset]
+	if !ok {
+		return opts, fmt.Errorf("%w: unknown %v", ErrInvalidOptions, opts.Preset)
+	}
+	names := slices.Clone(opts.PrimaryKeyNames)
+	for _, name := range preset.PrimaryKeyNames {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	opts.PrimaryKeyNames = names
+	if opts.ScalarMode == ScalarConcat {
+		opts.ScalarMode = preset.ScalarMode
+	}
+	if len(preset.ScalarModes) > 0 {
+		modes := maps.Clone(preset.ScalarModes)
+		maps.Copy(modes, opts.ScalarModes)
+		opts.ScalarModes = modes
+	}
+	replaceMaps := slices.Clone(opts.ReplaceMaps)
+	for _, pattern := range preset.ReplaceMaps {
+		if !slices.Contains(replaceMaps, pattern) {
+			replaceMaps = append(replaceMaps, pattern)
+		}
+	}
+	opts.ReplaceMaps = replaceMaps
+	return opts, nil
+}
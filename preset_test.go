@@ -0,0 +1,231 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestPresets(t *testing.T) {
+	tests := []struct {
+		name          string
+		preset        keymerge.Preset
+		base, overlay string
+		want          string
+	}{
+		{
+			name:   "kubernetes",
+			preset: keymerge.PresetKubernetes,
+			base: `
+metadata: {name: web, finalizers: [a]}
+spec:
+  nodeSelector: {disk: ssd, zone: a}
+  containers:
+  - name: app
+    args: [-v, -port=80]
+    ports: [{name: http, containerPort: 80}]
+    volumeMounts: [{name: data, mountPath: /a}, {name: data, mountPath: /b, readOnly: true}]
+`,
+			overlay: `
+metadata: {finalizers: [a, b]}
+spec:
+  nodeSelector: {zone: b}
+  containers:
+  - name: app
+    args: [-port=8080]
+    ports: [{name: web, containerPort: 80}]
+    volumeMounts: [{name: data, mountPath: /b, readOnly: false}]
+`,
+			want: `
+metadata: {name: web, finalizers: [a, b]}
+spec:
+  nodeSelector: {zone: b}
+  containers:
+  - name: app
+    args: [-port=8080]
+    ports: [{name: web, containerPort: 80}]
+    volumeMounts: [{name: data, mountPath: /a}, {name: data, mountPath: /b, readOnly: false}]
+`,
+		},
+		{
+			name:   "compose",
+			preset: keymerge.PresetDockerCompose,
+			base: `
+services:
+  web:
+    command: [serve, --debug]
+    ports: ["80:80"]
+    depends_on: [db]
+    volumes: [{type: bind, source: ./a, target: /data}, {type: bind, source: ./logs, target: /logs}]
+`,
+			overlay: `
+services:
+  web:
+    command: [serve]
+    ports: ["80:80", "443:443"]
+    depends_on: [db, cache]
+    volumes: [{type: bind, source: ./b, target: /data}]
+`,
+			want: `
+services:
+  web:
+    command: [serve]
+    ports: ["80:80", "443:443"]
+    depends_on: [db, cache]
+    volumes: [{type: bind, source: ./b, target: /data}, {type: bind, source: ./logs, target: /logs}]
+`,
+		},
+		{
+			name:   "github actions",
+			preset: keymerge.PresetGitHubActions,
+			base: `
+on: {push: {branches: [main]}}
+jobs:
+  test:
+    runs-on: [self-hosted, linux]
+    strategy: {matrix: {go: ["1.23", "1.24"]}}
+    steps: [{uses: actions/checkout@v4}, {id: test, run: go test ./...}]
+`,
+			overlay: `
+on: {push: {branches: [main, release]}}
+jobs:
+  test:
+    runs-on: [ubuntu-latest]
+    strategy: {matrix: {go: ["1.24"]}}
+    steps: [{id: test, run: go test -race ./...}]
+`,
+			want: `
+on: {push: {branches: [main, release]}}
+jobs:
+  test:
+    runs-on: [ubuntu-latest]
+    strategy: {matrix: {go: ["1.24"]}}
+    steps: [{uses: actions/checkout@v4}, {id: test, run: go test -race ./...}]
+`,
+		},
+		{
+			name:   "feature flags",
+			preset: keymerge.PresetFeatureFlags,
+			base: `
+flags:
+  - name: new-checkout
+    targets: [alice, bob]
+    rules: [{id: beta, name: beta users, state: on}, {id: staff, state: on}]
+    environments:
+      - {name: staging, state: on}
+      - {name: prod, rollout: {on: 10, off: 90}}
+`,
+			overlay: `
+flags:
+  - name: new-checkout
+    targets: [bob, carol]
+    rules: [{id: beta, name: beta testers}]
+    environments:
+      - {name: prod, rollout: {on: 50, off: 50}}
+`,
+			want: `
+flags:
+  - name: new-checkout
+    targets: [alice, bob, carol]
+    rules: [{id: beta, name: beta testers, state: on}, {id: staff, state: on}]
+    environments:
+      - {name: staging, state: on}
+      - {name: prod, rollout: {on: 50, off: 50}}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var docs [3]any
+			for i, doc := range []string{tt.base, tt.overlay, tt.want} {
+				if err := yaml.Unmarshal([]byte(doc), &docs[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			base, overlay, want := docs[0], docs[1], docs[2]
+			result, err := keymerge.MergeUnstructured(keymerge.Options{Preset: tt.preset}, base, overlay)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result, want) {
+				t.Errorf("got %v\nwant %v", result, want)
+			}
+		})
+	}
+}
+
+func TestPresets_Options(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{
+		Preset:          keymerge.PresetKubernetes,
+		PrimaryKeyNames: []string{"id", "name"},
+		ScalarMode:      keymerge.ScalarDedup,
+		ScalarModes:     map[string]keymerge.ScalarMode{"**.finalizers": keymerge.ScalarConcat},
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := merger.Options()
+	if want := []string{"id", "name", "mountPath", "devicePath", "containerPort", "port"}; !slices.Equal(opts.PrimaryKeyNames, want) {
+		t.Errorf("PrimaryKeyNames = %v, want %v", opts.PrimaryKeyNames, want)
+	}
+	if opts.ScalarMode != keymerge.ScalarDedup {
+		t.Errorf("ScalarMode = %v, want ScalarDedup", opts.ScalarMode)
+	}
+	if opts.ScalarModes["**.finalizers"] != keymerge.ScalarConcat {
+		t.Errorf("ScalarModes = %v, want the option's finalizers mode", opts.ScalarModes)
+	}
+
+	// Options with the preset added get the same options again.
+	again, err := keymerge.NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again.Options(), opts) {
+		t.Errorf("got %+v, want %+v", again.Options(), opts)
+	}
+
+	_, err = keymerge.NewUntypedMerger(keymerge.Options{Preset: keymerge.Preset(42)}, nil, nil)
+	if !errors.Is(err, keymerge.ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions, got %v", err)
+	}
+}
+
+func TestParsePreset(t *testing.T) {
+	for name, want := range map[string]keymerge.Preset{
+		"":               keymerge.PresetNone,
+		"none":           keymerge.PresetNone,
+		"Kubernetes":     keymerge.PresetKubernetes,
+		"compose":        keymerge.PresetDockerCompose,
+		"github-actions": keymerge.PresetGitHubActions,
+		"feature-flags":  keymerge.PresetFeatureFlags,
+	} {
+		if got, err := keymerge.ParsePreset(name); err != nil || got != want {
+			t.Errorf("ParsePreset(%q) = %v, %v; want %v", name, got, err, want)
+		}
+	}
+	if _, err := keymerge.ParsePreset("helm"); !errors.Is(err, keymerge.ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions, got %v", err)
+	}
+
+	var settings struct {
+		Preset keymerge.Preset `json:"preset"`
+	}
+	if err := json.Unmarshal([]byte(`{"preset": "compose"}`), &settings); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"preset":"compose"}` {
+		t.Errorf("got %s", data)
+	}
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+// DefaultProgressInterval is the progress interval used when
+// [UntypedMerger.SetProgress] is given a non-positive interval.
+const DefaultProgressInterval = 10000
+
+// Progress describes how far a merge has gotten.
+type Progress struct {
+	// DocIndex is the index of the document being merged.
+	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
+	// Values is the number of values merged so far in this operation, across all
+	// documents. Each value a document sets counts once, whether or not the
+	// accumulated result already had it; the contents of new subtrees are not counted.
+	Values int
+	// Path is the path of the value being merged, as field names and list indices.
+	Path []string
+}
+
+// SetProgress registers fn to be called every interval merged values, so that long
+// merges of very large documents can be observed. The count restarts with every
+// call to [UntypedMerger.MergeUnstructured], [UntypedMerger.Merge], or
+// [UntypedMerger.Trace]. Passing a nil fn removes the callback.
+//
+// fn is called synchronously during the merge and must not use the merger.
+//
+// Example:
+//
+//	merger.SetProgress(100000, func(p keymerge.Progress) {
+//		log.Printf("document %d: merged %d values (at %s)",
+//			p.DocIndex, p.Values, strings.Join(p.Path, "."))
+//	})
+func (m *UntypedMerger) SetProgress(interval int, fn func(Progress)) {
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	m.progressInterval = interval
+	m.progress = fn
+}
+
+// tick counts a merged value and reports progress when an interval is reached.
+// Returns an error if the merge has run past its deadline (see [Limits]).
+func (m *UntypedMerger) tick() error {
+	m.values++
+	if m.progress != nil && m.values%m.progressInterval == 0 {
+		m.progress(Progress{DocIndex: m.index, DocName: m.docName(m.index), Values: m.values, Path: m.pathNames()})
+	}
+	return m.checkDeadline(m.values)
+}
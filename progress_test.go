@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestSetProgress(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{PrimaryKeyNames: []string{"name"}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := make([]any, 10)
+	for i := range items {
+		items[i] = map[string]any{"name": strconv.Itoa(i), "value": i}
+	}
+	base := map[string]any{"items": items}
+	overlay := map[string]any{"items": items}
+
+	var reports []keymerge.Progress
+	merger.SetProgress(10, func(p keymerge.Progress) {
+		reports = append(reports, p)
+	})
+
+	// 1 (base) + 1 (overlay root) + 1 (items list) + 10 items * 3 (item, name, value)
+	for range 2 {
+		reports = nil
+		if _, err := merger.MergeUnstructured(base, overlay); err != nil {
+			t.Fatal(err)
+		}
+		if len(reports) != 3 {
+			t.Fatalf("expected 3 progress reports, got %d: %+v", len(reports), reports)
+		}
+	}
+
+	want := keymerge.Progress{DocIndex: 1, Values: 10, Path: []string{"items", "2"}}
+	if !reflect.DeepEqual(reports[0], want) {
+		t.Errorf("got %+v, want %+v", reports[0], want)
+	}
+	for i, p := range reports {
+		if p.Values != (i+1)*10 {
+			t.Errorf("report %d: expected %d values, got %d", i, (i+1)*10, p.Values)
+		}
+	}
+
+	merger.SetProgress(1, nil)
+	if _, err := merger.MergeUnstructured(base, overlay); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetProgress_DefaultInterval(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+	merger.SetProgress(0, func(keymerge.Progress) { calls++ })
+
+	docs := make([]any, keymerge.DefaultProgressInterval)
+	for i := range docs {
+		docs[i] = i
+	}
+	if _, err := merger.MergeUnstructured(docs...); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+}
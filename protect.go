@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrProtectedPath indicates an overlay changed a value under one of
+// [Options.ProtectedPaths].
+var ErrProtectedPath = errors.New("protected path")
+
+// ProtectedPathError is returned when an overlay adds, changes, or deletes a
+// value under one of [Options.ProtectedPaths].
+type ProtectedPathError struct {
+	// Pattern is the protected path pattern, as written in the options.
+	Pattern string
+	// Path is a path expression addressing the protected value that changed,
+	// as the pattern matched it.
+	Path string
+	// Kind tells whether the overlay added, modified, or removed the value.
+	Kind ChangeKind
+	// DocIndex is the index of the overlay that changed the value.
+	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
+}
+
+func (e *ProtectedPathError) Error() string {
+	verbs := map[ChangeKind]string{ChangeAdded: "add", ChangeModified: "change", ChangeRemoved: "delete"}
+	return fmt.Sprintf("document %d%s may not %s protected path %s", e.DocIndex, nameSuffix(e.DocName), verbs[e.Kind], e.Path)
+}
+
+func (e *ProtectedPathError) Is(target error) bool {
+	return target == ErrProtectedPath
+}
+
+// protectedPath is a parsed [Options.ProtectedPaths] pattern.
+type protectedPath struct {
+	pattern string
+	steps   []pathStep
+}
+
+// compileProtectedPaths parses the patterns of [Options.ProtectedPaths].
+func compileProtectedPaths(patterns []string) ([]protectedPath, error) {
+	compiled := make([]protectedPath, 0, len(patterns))
+	for _, pattern := range patterns {
+		steps, err := parsePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: ProtectedPaths: %w", ErrInvalidOptions, err)
+		}
+		compiled = append(compiled, protectedPath{pattern: pattern, steps: steps})
+	}
+	return compiled, nil
+}
+
+// checkProtected returns a [*ProtectedPathError] if merging document i, an
+// overlay, changed a value that a protected path pattern matches before or
+// after it. Matched list items are paired by primary key, so that removing or
+// reordering other items doesn't count as a change. The first pattern with a
+// change is reported, at the first path it matches in document order.
+func (m *UntypedMerger) checkProtected(i int, before, after any) error {
+	if i == 0 {
+		return nil
+	}
+	for _, p := range m.protected {
+		matched := m.expandProtected(before, p.steps)
+		previous := make(map[string]any, len(matched))
+		for _, match := range matched {
+			previous[match.path] = match.value
+		}
+		for _, match := range m.expandProtected(after, p.steps) {
+			old, existed := previous[match.path]
+			delete(previous, match.path)
+			switch {
+			case !existed:
+				return &ProtectedPathError{Pattern: p.pattern, Path: match.path, Kind: ChangeAdded, DocIndex: i}
+			case !equalValues(old, match.value):
+				return &ProtectedPathError{Pattern: p.pattern, Path: match.path, Kind: ChangeModified, DocIndex: i}
+			}
+		}
+		for _, match := range matched {
+			if _, removed := previous[match.path]; removed {
+				return &ProtectedPathError{Pattern: p.pattern, Path: match.path, Kind: ChangeRemoved, DocIndex: i}
+			}
+		}
+	}
+	return nil
+}
+
+// expandProtected returns the values of doc that steps match, like
+// expandSteps, but with keyed list items addressed by key selectors instead of
+// their positions.
+func (m *UntypedMerger) expandProtected(doc any, steps []pathStep) []pathMatch {
+	matched := expandSteps(doc, steps)
+	for j, match := range matched {
+		if concrete, err := parsePath(match.path); err == nil {
+			matched[j].path = m.canonicalSteps(doc, concrete)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestProtectedPaths(t *testing.T) {
+	opts := keymerge.Options{
+		PrimaryKeyNames: []string{"name"},
+		DeleteMarkerKey: "_delete",
+		ProtectedPaths:  []string{"security.tls", "users[name=admin]"},
+	}
+	base := map[string]any{
+		"security": map[string]any{
+			"tls":  map[string]any{"enabled": true, "ciphers": []any{"a"}},
+			"cors": false,
+		},
+		"users": []any{
+			map[string]any{"name": "admin", "role": "root"},
+			map[string]any{"name": "bob", "role": "dev"},
+		},
+	}
+	tests := []struct {
+		name    string
+		overlay map[string]any
+		want    *keymerge.ProtectedPathError // nil if allowed
+	}{
+		{
+			name:    "unprotected sibling",
+			overlay: map[string]any{"security": map[string]any{"cors": true}},
+		},
+		{
+			name:    "unprotected list item",
+			overlay: map[string]any{"users": []any{map[string]any{"name": "bob", "role": "ops"}}},
+		},
+		{
+			name:    "same value",
+			overlay: map[string]any{"security": map[string]any{"tls": map[string]any{"enabled": true}}},
+		},
+		{
+			name:    "change beneath",
+			overlay: map[string]any{"security": map[string]any{"tls": map[string]any{"enabled": false}}},
+			want:    &keymerge.ProtectedPathError{Pattern: "security.tls", Path: "security.tls", Kind: keymerge.ChangeModified, DocIndex: 1},
+		},
+		{
+			name:    "append beneath",
+			overlay: map[string]any{"security": map[string]any{"tls": map[string]any{"ciphers": []any{"b"}}}},
+			want:    &keymerge.ProtectedPathError{Pattern: "security.tls", Path: "security.tls", Kind: keymerge.ChangeModified, DocIndex: 1},
+		},
+		{
+			name:    "delete ancestor",
+			overlay: map[string]any{"security": map[string]any{"_delete": true}},
+			want:    &keymerge.ProtectedPathError{Pattern: "security.tls", Path: "security.tls", Kind: keymerge.ChangeRemoved, DocIndex: 1},
+		},
+		{
+			name:    "delete item",
+			overlay: map[string]any{"users": []any{map[string]any{"name": "admin", "_delete": true}}},
+			want:    &keymerge.ProtectedPathError{Pattern: "users[name=admin]", Path: "users[name=admin]", Kind: keymerge.ChangeRemoved, DocIndex: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := keymerge.MergeUnstructured(opts, base, tt.overlay)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var protected *keymerge.ProtectedPathError
+			if !errors.As(err, &protected) || !errors.Is(err, keymerge.ErrProtectedPath) {
+				t.Fatalf("expected ProtectedPathError, got %v", err)
+			}
+			if *protected != *tt.want {
+				t.Errorf("got %+v, want %+v", *protected, *tt.want)
+			}
+		})
+	}
+}
+
+func TestProtectedPaths_KeyedItems(t *testing.T) {
+	opts := keymerge.Options{
+		PrimaryKeyNames: []string{"name"},
+		DeleteMarkerKey: "_delete",
+		ProtectedPaths:  []string{"svcs[*].image"},
+	}
+	base := map[string]any{"svcs": []any{
+		map[string]any{"name": "a", "port": 1},
+		map[string]any{"name": "b", "image": "x"},
+	}}
+
+	// Deleting or moving other items shifts b, but doesn't change its image
+	for name, overlay := range map[string]map[string]any{
+		"delete other": {"svcs": []any{map[string]any{"name": "a", "_delete": true}}},
+		"reorder":      {"svcs": []any{map[string]any{"name": "b"}, map[string]any{"name": "a"}}},
+	} {
+		if _, err := keymerge.MergeUnstructured(opts, base, overlay); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	overlay := map[string]any{"svcs": []any{
+		map[string]any{"name": "a", "_delete": true},
+		map[string]any{"name": "b", "image": "y"},
+	}}
+	_, err := keymerge.MergeUnstructured(opts, base, overlay)
+	want := "document 1 may not change protected path svcs[name=b].image"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
+
+func TestProtectedPaths_Added(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{ProtectedPaths: []string{"security.tls"}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger.SetDocumentNames("base", "team overlay")
+
+	// The first document sets protected values; overlays may not add them
+	base := map[string]any{"security": map[string]any{"tls": true}}
+	if _, err := merger.MergeUnstructured(base); err != nil {
+		t.Fatal(err)
+	}
+	_, err = merger.MergeUnstructured(map[string]any{}, base)
+	want := "document 1 (team overlay) may not add protected path security.tls"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %q", err, want)
+	}
+	if _, err := merger.Trace(map[string]any{}, base); !errors.Is(err, keymerge.ErrProtectedPath) {
+		t.Errorf("expected Trace to check protected paths, got %v", err)
+	}
+
+	_, err = keymerge.NewUntypedMerger(keymerge.Options{ProtectedPaths: []string{"a[b"}}, nil, nil)
+	if !errors.Is(err, keymerge.ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions, got %v", err)
+	}
+}
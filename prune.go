@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// prune removes the map keys and keyed list items of the merged result that
+// the last document, doc, does not have (see [Options.Prune]).
+func (m *UntypedMerger) prune(result, doc any) (any, error) {
+	switch value := result.(type) {
+	case map[string]any:
+		if docMap, ok := doc.(map[string]any); ok {
+			return m.pruneMap(value, docMap)
+		}
+	case []any:
+		if docList, ok := doc.([]any); ok {
+			return m.pruneList(value, docList)
+		} else if docList, ok := toSliceAny(doc); ok {
+			return m.pruneList(value, docList)
+		}
+	}
+	return result, nil
+}
+
+// pruneMap returns a copy of value without the keys doc lacks, pruning the
+// values of the others. Keys are visited in order so that OnDelete sees
+// deletions the same way every time.
+func (m *UntypedMerger) pruneMap(value, doc map[string]any) (map[string]any, error) {
+	result := make(map[string]any, len(doc))
+	for _, k := range slices.Sorted(maps.Keys(value)) {
+		m.push(k)
+		docValue, kept := doc[k]
+		var err error
+		switch {
+		case kept:
+			result[k], err = m.prune(value[k], docValue)
+		case m.isMarkerKey(k):
+			result[k] = value[k]
+		default:
+			err = m.checkDelete(value[k])
+		}
+		m.pop()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// pruneList returns value without the items whose primary keys no item of doc
+// has, pruning the others by the doc items they match. Items without a key
+// are kept, and lists whose items are matched by a [ListMatcher], compared by
+// content, or not keyed in doc are left as they are.
+func (m *UntypedMerger) pruneList(value, doc []any) ([]any, error) {
+	if meta := m.getCurrentMetadata(); meta != nil && meta.opaque {
+		return value, nil
+	}
+	if len(m.listMatchers) > 0 && m.listMatcher() != nil {
+		return value, nil
+	}
+	docItems := make(map[any]any, len(doc))
+	for i, item := range doc {
+		m.push(strconv.Itoa(i))
+		if key := m.getPrimaryKey(item); key != nil && isKeyComparable(key) && !m.isMarkedForDeletion(item) {
+			docItems[toMapKey(key)] = item
+		}
+		m.pop()
+	}
+	if len(docItems) == 0 {
+		return value, nil
+	}
+
+	result := make([]any, 0, len(value))
+	for i, item := range value {
+		m.push(strconv.Itoa(i))
+		key := m.getPrimaryKey(item)
+		var err error
+		if key == nil || !isKeyComparable(key) {
+			result = append(result, item)
+		} else if docItem, kept := docItems[toMapKey(key)]; kept {
+			item, err = m.prune(item, docItem)
+			result = append(result, item)
+		} else {
+			err = m.checkDelete(item)
+		}
+		m.pop()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
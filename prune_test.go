@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestPrune(t *testing.T) {
+	var deletions []deletion
+	opts := keymerge.Options{
+		PrimaryKeyNames: []string{"name"},
+		Prune:           true,
+		OnDelete: func(path []string, deleted any, docIndex int) error {
+			deletions = append(deletions, deletion{strings.Join(path, "."), deleted, docIndex})
+			return nil
+		},
+	}
+	base := map[string]any{
+		"debug": true,
+		"web": map[string]any{
+			"port":    80,
+			"timeout": 30,
+			"tls":     map[string]any{"enabled": false, "cert": "old.pem"},
+		},
+		"services": []any{
+			map[string]any{"name": "api", "replicas": 1, "image": "api:1"},
+			map[string]any{"name": "worker", "replicas": 1},
+		},
+		"tags": []any{"a", "b"},
+	}
+	defaults := map[string]any{"web": map[string]any{"host": "example.com"}}
+	overlay := map[string]any{
+		"web": map[string]any{
+			"port": 8080,
+			"tls":  map[string]any{"enabled": true},
+		},
+		"services": []any{
+			map[string]any{"name": "api", "replicas": 3},
+		},
+		"tags": []any{"c"},
+	}
+
+	result, err := keymerge.MergeUnstructured(opts, base, defaults, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"web": map[string]any{
+			"port": 8080,
+			"tls":  map[string]any{"enabled": true},
+		},
+		"services": []any{
+			map[string]any{"name": "api", "replicas": 3},
+		},
+		"tags": []any{"a", "b", "c"},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+	// Values are pruned in key order, once each despite determinism checks
+	wantDeletions := []deletion{
+		{"debug", true, 2},
+		{"services.0.image", "api:1", 2},
+		{"services.1", map[string]any{"name": "worker", "replicas": 1}, 2},
+		{"web.host", "example.com", 2},
+		{"web.timeout", 30, 2},
+		{"web.tls.cert", "old.pem", 2},
+	}
+	if !reflect.DeepEqual(deletions, wantDeletions) {
+		t.Errorf("got deletions %v, want %v", deletions, wantDeletions)
+	}
+
+	// A single document is its own desired state
+	deletions = nil
+	if result, err := keymerge.MergeUnstructured(opts, base); err != nil || !reflect.DeepEqual(result, base) {
+		t.Errorf("got %v, %v", result, err)
+	}
+	if len(deletions) > 0 {
+		t.Errorf("unexpected deletions %v", deletions)
+	}
+}
+
+func TestPrune_Veto(t *testing.T) {
+	errReview := errors.New("needs review")
+	opts := keymerge.Options{
+		Prune: true,
+		OnDelete: func([]string, any, int) error {
+			return errReview
+		},
+	}
+	_, err := keymerge.MergeUnstructured(opts,
+		map[string]any{"a": 1, "b": 2},
+		map[string]any{"a": 3})
+	var deleteErr *keymerge.DeleteError
+	if !errors.As(err, &deleteErr) || !errors.Is(err, errReview) {
+		t.Fatalf("expected DeleteError wrapping the hook's error, got %v", err)
+	}
+	if !reflect.DeepEqual(deleteErr.Path, []string{"b"}) || deleteErr.DocIndex != 1 {
+		t.Errorf("got path %v in document %d", deleteErr.Path, deleteErr.DocIndex)
+	}
+}
+
+func TestPrune_Trace(t *testing.T) {
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{Prune: true}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace, err := merger.Trace(map[string]any{"a": 1, "b": 2}, map[string]any{"a": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]any{"a": 3}; !reflect.DeepEqual(trace.Result, want) {
+		t.Errorf("got %v, want %v", trace.Result, want)
+	}
+	changes := trace.Steps[1].Changes
+	if len(changes) != 2 {
+		t.Errorf("expected the overlay to change a and remove b, got %v", changes)
+	}
+}
@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// Warning describes something suspicious about a merge that did not make it fail.
+type Warning struct {
+	// DocIndex is the index of the document the warning is about.
+	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
+	// Path is a path expression (see [Lookup]) addressing the value concerned.
+	Path string
+	// Message describes the problem.
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("document %d%s: %s: %s", w.DocIndex, nameSuffix(w.DocName), w.Path, w.Message)
+}
+
+// Result is the outcome of a typed merge: the merged value together with where
+// each part came from and anything suspicious about the inputs.
+// See [Merger.MergeResult].
+type Result[T any] struct {
+	value    T
+	trace    *MergeTrace
+	warnings []Warning
+}
+
+// Value returns the merged document decoded into T.
+func (r *Result[T]) Value() T {
+	return r.value
+}
+
+// Raw returns the merged document before decoding, or nil if it is not a map.
+func (r *Result[T]) Raw() map[string]any {
+	raw, _ := r.trace.Result.(map[string]any)
+	return raw
+}
+
+// Provenance returns what each document changed; use [MergeTrace.Source] to
+// find which document set a value.
+func (r *Result[T]) Provenance() *MergeTrace {
+	return r.trace
+}
+
+// Warnings returns the merge's warnings, ordered by document:
+//   - fields that T has no field for, which decoding drops (often a typo in an
+//     overlay), reported against the document that last set them, unless
+//     [Options.RejectUnknownFields] made the merge fail instead;
+//   - overlay values that are redundant because earlier documents already set
+//     them to the same value.
+func (r *Result[T]) Warnings() []Warning {
+	return r.warnings
+}
+
+// MergeResult merges documents like [UntypedMerger.Merge] and returns the result
+// decoded into T, with provenance and warnings, so that callers need not
+// unmarshal the merged bytes themselves.
+//
+// It merges the documents the same way as Merge, so it fails wherever Merge
+// does, e.g. for fields [Options.RejectUnknownFields] rejects or changes that
+// grants don't allow, but traces the merge (see [UntypedMerger.Trace]) and is
+// therefore slower. The merged document is decoded by marshaling it and unmarshaling the
+// output into T with the merger's functions.
+//
+// Example:
+//
+//	result, err := merger.MergeResult(base, overlay)
+//	if err != nil {
+//		return err
+//	}
+//	for _, w := range result.Warnings() {
+//		log.Printf("warning: %s", w)
+//	}
+//	cfg := result.Value()
+func (m *Merger[T]) MergeResult(docs ...[]byte) (*Result[T], error) {
+	parsed, err := m.unmarshalDocs(docs)
+	if err != nil {
+		return nil, err
+	}
+	trace, err := m.Trace(parsed...)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Result[T]{trace: trace}
+	marshaled, err := m.marshal(trace.Result)
+	if err != nil {
+		return nil, &MarshalError{Err: err, Operation: "marshal", DocIndex: -1}
+	}
+	if err := m.unmarshal(marshaled, &r.value); err != nil {
+		return nil, &MarshalError{Err: err, Operation: "unmarshal", DocIndex: -1}
+	}
+
+	m.reset(0)
+	m.unknownFields("", trace.Result, trace, &r.warnings)
+	for _, step := range trace.Steps {
+		for _, path := range step.Redundant {
+			r.warnings = append(r.warnings, Warning{DocIndex: step.DocIndex, DocName: step.DocName, Path: path,
+				Message: "value is redundant; earlier documents set the same value"})
+		}
+	}
+	slices.SortStableFunc(r.warnings, func(a, b Warning) int {
+		return cmp.Compare(a.DocIndex, b.DocIndex)
+	})
+	return r, nil
+}
+
+// unknownFields appends a warning for every map key in value that the metadata
+// at the current path has no field for.
+func (m *UntypedMerger) unknownFields(path string, value any, trace *MergeTrace, warnings *[]Warning) {
+	parent := m.metadata
+	if len(m.path) > 0 {
+		parent = m.path[len(m.path)-1].meta
+	}
+	if parent == nil {
+		return
+	}
+
+	if mp, ok := value.(map[string]any); ok {
+		for _, k := range sortedKeys(mp) {
+			childPath := appendFieldPath(path, k)
+			if parent.children != nil && parent.children[k] == nil {
+				source, _ := trace.Source(childPath)
+				*warnings = append(*warnings, Warning{DocIndex: source, DocName: m.docName(source), Path: childPath,
+					Message: "unknown field; it is dropped when decoding"})
+				continue
+			}
+			m.push(k)
+			m.unknownFields(childPath, mp[k], trace, warnings)
+			m.pop()
+		}
+		return
+	}
+
+	if list, ok := asList(value); ok && parent.list {
+		for i, item := range list {
+			m.push(strconv.Itoa(i))
+			m.unknownFields(m.itemPath(path, item, i), item, trace, warnings)
+			m.pop()
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+type resultService struct {
+	Name string `yaml:"name" km:"primary"`
+	Port int    `yaml:"port"`
+}
+
+type resultConfig struct {
+	Log      string            `yaml:"log"`
+	Services []resultService   `yaml:"services"`
+	Labels   map[string]string `yaml:"labels"`
+}
+
+func TestMerger_MergeResult(t *testing.T) {
+	merger, err := keymerge.NewMerger[resultConfig](keymerge.Options{}, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := []byte("log: info\nservices:\n  - name: web\n    port: 80\nlabels:\n  team: a\n")
+	overlay := []byte("log: info\nservices:\n  - name: web\n    port: 8080\n    prot: tcp\nlabels:\n  tier: b\nloglevel: debug\n")
+
+	result, err := merger.MergeResult(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := resultConfig{
+		Log:      "info",
+		Services: []resultService{{Name: "web", Port: 8080}},
+		Labels:   map[string]string{"team": "a", "tier": "b"},
+	}
+	if !reflect.DeepEqual(result.Value(), expected) {
+		t.Errorf("expected %+v, got %+v", expected, result.Value())
+	}
+	if result.Raw()["loglevel"] != "debug" {
+		t.Errorf("expected raw result to keep unknown fields, got %v", result.Raw())
+	}
+	if source, _ := result.Provenance().Source("services[name=web].port"); source != 1 {
+		t.Errorf("expected port to come from document 1, got %d", source)
+	}
+
+	expectedWarnings := []keymerge.Warning{
+		{DocIndex: 1, Path: "loglevel", Message: "unknown field; it is dropped when decoding"},
+		{DocIndex: 1, Path: "services[name=web].prot", Message: "unknown field; it is dropped when decoding"},
+		{DocIndex: 1, Path: "log", Message: "value is redundant; earlier documents set the same value"},
+	}
+	if !reflect.DeepEqual(result.Warnings(), expectedWarnings) {
+		t.Errorf("expected warnings %v, got %v", expectedWarnings, result.Warnings())
+	}
+	if s := expectedWarnings[0].String(); s != "document 1: loglevel: unknown field; it is dropped when decoding" {
+		t.Errorf("unexpected string %q", s)
+	}
+}
+
+func TestMerger_MergeResult_Errors(t *testing.T) {
+	merger, err := keymerge.NewMerger[resultConfig](keymerge.Options{}, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = merger.MergeResult([]byte("log: [unclosed"))
+	var marshalErr *keymerge.MarshalError
+	if !errors.As(err, &marshalErr) || marshalErr.Operation != "unmarshal" || marshalErr.DocIndex != 0 {
+		t.Errorf("expected unmarshal error for document 0, got %v", err)
+	}
+
+	// The merged document does not fit the type.
+	_, err = merger.MergeResult([]byte("services: notalist\n"))
+	if !errors.As(err, &marshalErr) || marshalErr.DocIndex != -1 {
+		t.Errorf("expected decoding error, got %v", err)
+	}
+
+	_, err = merger.MergeResult([]byte("services: []\n"), []byte("services:\n  - name: a\n  - name: a\n"))
+	if !errors.Is(err, keymerge.ErrDuplicatePrimaryKey) {
+		t.Errorf("expected ErrDuplicatePrimaryKey, got %v", err)
+	}
+}
+
+func TestMerger_MergeResult_FailsLikeMerge(t *testing.T) {
+	base := []byte("services:\n  - name: web\n    port: 80\n")
+	tests := []struct {
+		name   string
+		opts   keymerge.Options
+		grants []*keymerge.Grant
+		docs   []string
+	}{
+		{
+			name: "unknown field",
+			opts: keymerge.Options{RejectUnknownFields: true},
+			docs: []string{"services:\n  - name: web\n    prot: tcp\n"},
+		},
+		{
+			name:   "grant",
+			grants: []*keymerge.Grant{nil, {Override: []string{"log"}}},
+			docs:   []string{"services:\n  - name: web\n    port: 8080\n"},
+		},
+		{
+			name: "duplicates across overlays",
+			opts: keymerge.Options{DupeMatrix: &keymerge.DupeMatrix{Across: keymerge.DupeUnique}},
+			docs: []string{"services:\n  - name: db\n", "services:\n  - name: db\n    port: 5432\n"},
+		},
+		{
+			name: "collected duplicates",
+			opts: keymerge.Options{CollectDuplicates: true},
+			docs: []string{"services:\n  - name: db\n  - name: db\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merger, err := keymerge.NewMerger[resultConfig](tt.opts, yaml.Unmarshal, yaml.Marshal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := merger.SetGrants(tt.grants); err != nil {
+				t.Fatal(err)
+			}
+			docs := [][]byte{base}
+			for _, doc := range tt.docs {
+				docs = append(docs, []byte(doc))
+			}
+
+			_, mergeErr := merger.Merge(docs...)
+			_, resultErr := merger.MergeResult(docs...)
+			if mergeErr == nil {
+				t.Fatal("expected Merge to fail")
+			}
+			if resultErr == nil || resultErr.Error() != mergeErr.Error() {
+				t.Errorf("MergeResult returned %v, Merge returned %v", resultErr, mergeErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,472 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"fmt"
+	"io"
+	"slices"
+)
+
+// RuleSet builds a [MetadataTree] in code, giving untyped merges the per-field
+// control that struct tags give [Merger] without a struct to annotate. Each
+// rule addresses a field by a path of field names separated by dots, with "[*]"
+// after lists to address their items, e.g. "endpoints[*].backends". Rules
+// describe only the fields they name, so don't combine a rule set with
+// [Options.RejectUnknownFields] unless it names every field.
+//
+// Errors, such as an invalid path, are reported by [RuleSet.Build].
+//
+// Example:
+//
+//	rules := keymerge.NewRuleSet()
+//	rules.List("endpoints").Keys("region", "name").Dupe(keymerge.DupeConsolidate)
+//	rules.List("endpoints[*].tags").Mode(keymerge.ScalarDedup)
+//	rules.Field("limits.cpu").Strategy(keymerge.StrategyMax)
+//	tree, err := rules.Build()
+//	if err != nil {
+//		return err
+//	}
+//	merger, _ := keymerge.NewUntypedMerger(opts, yaml.Unmarshal, yaml.Marshal)
+//	merger.SetMetadata(tree)
+type RuleSet struct {
+	root *fieldMetadata
+	err  error // first error found while adding rules
+}
+
+// NewRuleSet returns an empty [RuleSet].
+func NewRuleSet() *RuleSet {
+	return &RuleSet{root: &fieldMetadata{children: make(map[string]*fieldMetadata)}}
+}
+
+// Rule holds the merge directives of one field of a [RuleSet]. Its methods
+// set a directive and return the rule, so that they can be chained.
+type Rule struct {
+	set  *RuleSet
+	path string
+	meta *fieldMetadata
+}
+
+// Field returns the rule for the field at path, creating it if needed.
+func (s *RuleSet) Field(path string) *Rule {
+	return &Rule{set: s, path: path, meta: s.field(path)}
+}
+
+// List returns the rule for the list field at path, like [RuleSet.Field], and
+// marks the field as a list, so that its items are merged by the rule's keys
+// and modes.
+func (s *RuleSet) List(path string) *Rule {
+	rule := s.Field(path)
+	rule.meta.list = true
+	return rule
+}
+
+// field returns the metadata of the field at path, creating it and its parents
+// as needed. Invalid paths record an error and return detached metadata, so
+// that chained calls still work.
+func (s *RuleSet) field(path string) *fieldMetadata {
+	steps, err := parsePattern(path)
+	if err == nil && (len(steps) == 0 || steps[len(steps)-1].kind != stepField) {
+		err = fmt.Errorf("%w %q: rule paths must end with a field name", ErrInvalidPath, path)
+	}
+	if err != nil {
+		s.fail(err)
+		return &fieldMetadata{}
+	}
+	meta := s.root
+	for i, step := range steps {
+		switch step.kind {
+		case stepField:
+			if meta.list && (i == 0 || steps[i-1].kind != stepWildcard) {
+				s.fail(fmt.Errorf("%w %q: address the items of a list with [*]", ErrInvalidPath, path))
+				return &fieldMetadata{}
+			}
+			meta = meta.child(step.field)
+		case stepWildcard:
+			// List items are described by the list field's children.
+			if i > 0 && steps[i-1].kind != stepField {
+				s.fail(fmt.Errorf("%w %q: rule paths cannot address nested lists", ErrInvalidPath, path))
+				return &fieldMetadata{}
+			}
+			meta.list = true
+		default:
+			s.fail(fmt.Errorf("%w %q: rule paths can only contain field names and [*]", ErrInvalidPath, path))
+			return &fieldMetadata{}
+		}
+	}
+	return meta
+}
+
+// child returns the metadata of the field named name, creating it if needed.
+func (meta *fieldMetadata) child(name string) *fieldMetadata {
+	if meta.children == nil {
+		meta.children = make(map[string]*fieldMetadata)
+	}
+	child := meta.children[name]
+	if child == nil {
+		child = &fieldMetadata{fieldName: name}
+		meta.children[name] = child
+	}
+	return child
+}
+
+// fail records err unless an earlier error was recorded.
+func (s *RuleSet) fail(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// Keys sets the fields whose values identify the field's list items, in order,
+// as a km:"primary" tag on each of them would. Several names form a composite
+// key.
+func (r *Rule) Keys(names ...string) *Rule {
+	if len(names) == 0 || slices.Contains(names, "") {
+		r.set.fail(fmt.Errorf("%w: empty key list or name for rule %q", ErrInvalidOptions, r.path))
+		return r
+	}
+	// Mark the key fields as primary, as buildMetadata finds them
+	for _, name := range r.meta.primaryKeys {
+		if child := r.meta.children[name]; child != nil {
+			child.primaryKeys = slices.DeleteFunc(child.primaryKeys, func(key string) bool { return key == name })
+		}
+	}
+	for _, name := range names {
+		if child := r.meta.child(name); !slices.Contains(child.primaryKeys, name) {
+			child.primaryKeys = append(child.primaryKeys, name)
+		}
+	}
+	r.meta.primaryKeys = slices.Clone(names)
+	return r
+}
+
+// Mode sets how the field's scalar lists merge, like a km:"mode=..." tag.
+func (r *Rule) Mode(mode ScalarMode) *Rule {
+	r.meta.scalarMode = &mode
+	return r
+}
+
+// Dupe sets how the field's list items with duplicate keys are handled, like
+// a km:"dupe=..." tag.
+func (r *Rule) Dupe(mode DupeMode) *Rule {
+	r.meta.dupeMode = &mode
+	return r
+}
+
+// Strategy sets how the field's scalar values combine, like a km:"agg=..." or
+// km:"mode=join" tag.
+func (r *Rule) Strategy(strategy ScalarStrategy) *Rule {
+	if strategy == nil {
+		r.set.fail(fmt.Errorf("%w: nil strategy for rule %q", ErrInvalidOptions, r.path))
+		return r
+	}
+	r.meta.strategy = strategy
+	return r
+}
+
+// Opaque makes the field's list items compare by content and never deep merge,
+// like a km:"opaque" tag.
+func (r *Rule) Opaque() *Rule {
+	r.meta.opaque = true
+	return r
+}
+
+// Replace makes overlays replace the field's value outright, like a
+// km:"replace" tag.
+func (r *Rule) Replace() *Rule {
+	r.meta.replace = true
+	return r
+}
+
+// ReplaceMap makes overlays replace the field's map instead of deep merging it,
+// like a km:"map=replace" tag.
+func (r *Rule) ReplaceMap() *Rule {
+	r.meta.replaceMap = true
+	return r
+}
+
+// Empty sets what an empty overlay list does to the field's list, like a
+// km:"empty=..." tag.
+func (r *Rule) Empty(mode EmptyListMode) *Rule {
+	r.meta.emptyMode = &mode
+	return r
+}
+
+// Ignore makes overlays leave the field unchanged, like a km:"ignore" tag.
+func (r *Rule) Ignore() *Rule {
+	r.meta.ignore = true
+	return r
+}
+
+// Immutable makes overlays that change the field's value fail the merge, like
+// a km:"immutable" tag.
+func (r *Rule) Immutable() *Rule {
+	r.meta.immutable = true
+	return r
+}
+
+// DeleteMarker sets the delete marker key for the field and everything under
+// it, like a km:"delete-marker=..." tag. An empty key disables deletion.
+func (r *Rule) DeleteMarker(key string) *Rule {
+	r.meta.deleteMarker = &key
+	return r
+}
+
+// Doc sets the field's documentation, like a km-doc tag.
+func (r *Rule) Doc(text string) *Rule {
+	r.meta.doc = text
+	return r
+}
+
+// Build returns a [MetadataTree] holding the rules added so far. The tree is a
+// copy, so adding rules afterwards does not change it.
+//
+// Returns an error wrapping [ErrInvalidPath] or [ErrInvalidOptions] for the
+// first invalid rule, or an [*InvalidTagError] for directives that cannot be
+// combined, as for struct tags.
+func (s *RuleSet) Build() (MetadataTree, error) {
+	if s.err != nil {
+		return MetadataTree{}, s.err
+	}
+	root := s.root.clone()
+	if err := root.checkRules(); err != nil {
+		return MetadataTree{}, err
+	}
+	return MetadataTree{root: root}, nil
+}
+
+// clone returns a deep copy of meta.
+func (meta *fieldMetadata) clone() *fieldMetadata {
+	c := *meta
+	c.primaryKeys = slices.Clone(meta.primaryKeys)
+	if meta.children != nil {
+		c.children = make(map[string]*fieldMetadata, len(meta.children))
+		for name, child := range meta.children {
+			c.children[name] = child.clone()
+		}
+	}
+	return &c
+}
+
+// checkRules validates the combined directives of the metadata built by a
+// [RuleSet], as parseKMTag does for struct tags.
+func (meta *fieldMetadata) checkRules() error {
+	for _, child := range meta.children {
+		if child.ignore && slices.Contains(child.primaryKeys, child.fieldName) {
+			return &InvalidTagError{
+				Kind:      PrimaryTag,
+				FieldName: child.fieldName,
+				Value:     "ignore",
+				Message:   "primary key fields cannot be ignored",
+			}
+		}
+		if child.replace && child.strategy != nil {
+			return &InvalidTagError{
+				Kind:      UnknownTag,
+				FieldName: child.fieldName,
+				Value:     "replace",
+				Message:   "cannot be combined with a strategy",
+			}
+		}
+		if err := child.checkRules(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadRules reads a rules document, such as a YAML or JSON file kept under
+// version control, into a [RuleSet], decoding it with unmarshal. The document
+// maps rule paths to their directives, named like the km tag directives:
+//
+//	endpoints:
+//	  keys: [region, name]  # composite key, see Rule.Keys
+//	  dupe: consolidate     # unique, consolidate
+//	endpoints[*].tags:
+//	  mode: dedup           # concat, dedup, replace, join
+//	  empty: replace        # keep, replace
+//	endpoints[*].aliases:
+//	  mode: join
+//	  sep: ";"              # separator for mode join (default ",")
+//	limits.cpu:
+//	  agg: max              # sum, min, max
+//	settings:
+//	  map: replace          # merge, replace
+//	  delete-marker: _remove
+//	  doc: Feature settings, replaced as a whole.
+//
+// The directives opaque, replace, ignore, and immutable take booleans, and
+// list: true marks a list without other list directives. Rules with keys, dupe, opaque,
+// empty, or a list mode other than join are lists.
+//
+// Returns an error wrapping [ErrInvalidOptions] or [ErrInvalidPath] for
+// malformed rules, or an [*InvalidTagError] for invalid directive values.
+//
+// Example:
+//
+//	f, err := os.Open("rules.yaml")
+//	if err != nil {
+//		return err
+//	}
+//	defer f.Close()
+//	rules, err := keymerge.LoadRules(f, yaml.Unmarshal)
+//	if err != nil {
+//		return err
+//	}
+//	tree, err := rules.Build()
+func LoadRules(r io.Reader, unmarshal func([]byte, any) error) (*RuleSet, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+	rules := NewRuleSet()
+	for _, path := range sortedKeys(doc) {
+		directives, ok := doc[path].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%w: rule %q must be a map of directives", ErrInvalidOptions, path)
+		}
+		if err := loadRule(rules.Field(path), directives); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", path, err)
+		}
+	}
+	if _, err := rules.Build(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// loadRule applies the directives of a rules document entry to rule.
+func loadRule(rule *Rule, directives map[string]any) error {
+	var join bool
+	var sep *string
+	for _, name := range sortedKeys(directives) {
+		value := directives[name]
+		switch name {
+		case "list", "opaque", "replace", "ignore", "immutable":
+			set, ok := value.(bool)
+			if !ok {
+				return fmt.Errorf("%w: %s must be a boolean", ErrInvalidOptions, name)
+			}
+			if !set {
+				continue
+			}
+			switch name {
+			case "list":
+				rule.meta.list = true
+			case "opaque":
+				rule.Opaque()
+				rule.meta.list = true
+			case "replace":
+				rule.Replace()
+			case "ignore":
+				rule.Ignore()
+			case "immutable":
+				rule.Immutable()
+			}
+		case "keys":
+			keys, ok := stringList(value)
+			if !ok {
+				return fmt.Errorf("%w: keys must be a list of strings", ErrInvalidOptions)
+			}
+			rule.Keys(keys...)
+			rule.meta.list = true
+		case "mode", "dupe", "agg", "map", "empty", "sep", "delete-marker", "doc":
+			text, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%w: %s must be a string", ErrInvalidOptions, name)
+			}
+			if err := loadDirective(rule, name, text, &join, &sep); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: unknown directive %q", ErrInvalidOptions, name)
+		}
+	}
+	switch {
+	case join && rule.meta.strategy != nil:
+		return &InvalidTagError{Kind: ModeTag, FieldName: rule.path, Value: "join", Message: "cannot be combined with agg"}
+	case join && sep != nil:
+		rule.Strategy(StrategyJoin(*sep))
+	case join:
+		rule.Strategy(StrategyJoin(defaultJoinSeparator))
+	case sep != nil:
+		return &InvalidTagError{Kind: SepTag, FieldName: rule.path, Value: *sep, Message: "sep requires mode=join"}
+	}
+	return nil
+}
+
+// loadDirective applies a directive with a string value to rule. Join modes
+// and separators are recorded in join and sep, for loadRule to combine.
+func loadDirective(rule *Rule, name, value string, join *bool, sep **string) error {
+	switch name {
+	case "mode":
+		if value == "join" {
+			*join = true
+			return nil
+		}
+		mode, err := parseScalarMode(value, rule.path)
+		if err != nil {
+			return err
+		}
+		rule.Mode(mode)
+		rule.meta.list = true
+	case "dupe":
+		mode, err := parseDupeMode(value, rule.path)
+		if err != nil {
+			return err
+		}
+		rule.Dupe(mode)
+		rule.meta.list = true
+	case "agg":
+		strategy, ok := scalarStrategies[value]
+		if !ok {
+			return &InvalidTagError{Kind: AggTag, FieldName: rule.path, Value: value, Message: "valid: sum, min, max"}
+		}
+		rule.Strategy(strategy)
+	case "map":
+		switch value {
+		case "merge":
+			rule.meta.replaceMap = false
+		case "replace":
+			rule.ReplaceMap()
+		default:
+			return &InvalidTagError{Kind: MapTag, FieldName: rule.path, Value: value, Message: "valid: merge, replace"}
+		}
+	case "empty":
+		mode, err := parseEmptyListMode(value, rule.path)
+		if err != nil {
+			return err
+		}
+		rule.Empty(mode)
+		rule.meta.list = true
+	case "sep":
+		*sep = &value
+	case "delete-marker":
+		rule.DeleteMarker(value)
+	case "doc":
+		rule.Doc(value)
+	}
+	return nil
+}
+
+// stringList converts a decoded list of strings to a []string.
+func stringList(value any) ([]string, bool) {
+	if strs, ok := value.([]string); ok {
+		return strs, true
+	}
+	list, ok := asList(value)
+	if !ok {
+		return nil, false
+	}
+	strs := make([]string, len(list))
+	for i, item := range list {
+		if strs[i], ok = item.(string); !ok {
+			return nil, false
+		}
+	}
+	return strs, true
+}
@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestRuleSet(t *testing.T) {
+	rules := keymerge.NewRuleSet()
+	rules.List("endpoints").Keys("region", "name").Dupe(keymerge.DupeConsolidate).Doc("Service endpoints.")
+	rules.List("endpoints[*].tags").Mode(keymerge.ScalarDedup)
+	rules.Field("limits.cpu").Strategy(keymerge.StrategyMax)
+	rules.Field("owner").Ignore()
+	tree, err := rules.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger.SetMetadata(tree)
+	result, err := merger.MergeUnstructured(
+		map[string]any{
+			"owner":  "platform",
+			"limits": map[string]any{"cpu": 4},
+			"endpoints": []any{
+				map[string]any{"region": "us", "name": "api", "tags": []any{"a"}},
+				map[string]any{"region": "eu", "name": "api", "tags": []any{"b"}},
+				map[string]any{"region": "us", "name": "api", "port": 80},
+			},
+		},
+		map[string]any{
+			"owner":  "someone",
+			"limits": map[string]any{"cpu": 2},
+			"endpoints": []any{
+				map[string]any{"region": "eu", "name": "api", "tags": []any{"b", "c"}},
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"owner":  "platform",
+		"limits": map[string]any{"cpu": 4},
+		"endpoints": []any{
+			map[string]any{"region": "us", "name": "api", "tags": []any{"a"}, "port": 80},
+			map[string]any{"region": "eu", "name": "api", "tags": []any{"b", "c"}},
+		},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+	if docs := tree.Docs(); len(docs) != 1 || docs[0].Path != "endpoints" {
+		t.Errorf("unexpected docs %+v", docs)
+	}
+
+	// Built trees don't change with later rules.
+	rules.Field("limits.cpu").Replace()
+	if _, err := rules.Build(); !errors.Is(err, keymerge.ErrInvalidTag) {
+		t.Errorf("expected ErrInvalidTag combining replace and a strategy, got %v", err)
+	}
+	if _, err := merger.MergeUnstructured(want, map[string]any{"limits": map[string]any{"cpu": 8}}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRuleSetTopLevelList(t *testing.T) {
+	rules := keymerge.NewRuleSet()
+	rules.Field("[*].id").Doc("Identifier.")
+	tree, err := rules.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc, _ := tree.Doc("[0].id"); doc != "Identifier." {
+		t.Errorf("got doc %q", doc)
+	}
+}
+
+func TestRuleSetErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(*keymerge.RuleSet)
+		want  error
+	}{
+		{"selector", func(r *keymerge.RuleSet) { r.Field("hosts[name=a].port") }, keymerge.ErrInvalidPath},
+		{"trailing wildcard", func(r *keymerge.RuleSet) { r.List("hosts[*]") }, keymerge.ErrInvalidPath},
+		{"list item without wildcard", func(r *keymerge.RuleSet) {
+			r.List("hosts").Keys("name")
+			r.Field("hosts.port").Ignore()
+		}, keymerge.ErrInvalidPath},
+		{"no keys", func(r *keymerge.RuleSet) { r.List("hosts").Keys() }, keymerge.ErrInvalidOptions},
+		{"nil strategy", func(r *keymerge.RuleSet) { r.Field("count").Strategy(nil) }, keymerge.ErrInvalidOptions},
+		{"ignored key", func(r *keymerge.RuleSet) {
+			r.List("hosts").Keys("name")
+			r.Field("hosts[*].name").Ignore()
+		}, keymerge.ErrInvalidTag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := keymerge.NewRuleSet()
+			tt.build(rules)
+			if _, err := rules.Build(); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	rules, err := keymerge.LoadRules(strings.NewReader(`
+endpoints:
+  keys: [region, name]
+  dupe: consolidate
+endpoints[*].tags:
+  mode: dedup
+endpoints[*].aliases:
+  mode: join
+  sep: ";"
+limits.cpu:
+  agg: max
+settings:
+  map: replace
+  doc: Replaced as a whole.
+hosts:
+  empty: replace
+region:
+  immutable: true
+`), yaml.Unmarshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := rules.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger.SetMetadata(tree)
+	result, err := merger.MergeUnstructured(
+		map[string]any{
+			"limits":   map[string]any{"cpu": 4},
+			"settings": map[string]any{"a": 1},
+			"hosts":    []any{"a"},
+			"region":   "us",
+			"endpoints": []any{
+				map[string]any{"region": "us", "name": "api", "tags": []any{"a"}, "aliases": "x"},
+				map[string]any{"region": "us", "name": "api", "tags": []any{"b"}},
+			},
+		},
+		map[string]any{
+			"limits":    map[string]any{"cpu": 2},
+			"settings":  map[string]any{"b": 2},
+			"hosts":     []any{},
+			"region":    "us",
+			"endpoints": []any{map[string]any{"region": "us", "name": "api", "tags": []any{"a", "c"}, "aliases": "y"}},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"limits":    map[string]any{"cpu": 4},
+		"settings":  map[string]any{"b": 2},
+		"hosts":     []any{},
+		"region":    "us",
+		"endpoints": []any{map[string]any{"region": "us", "name": "api", "tags": []any{"a", "b", "c"}, "aliases": "x;y"}},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+	_, err = merger.MergeUnstructured(map[string]any{"region": "us"}, map[string]any{"region": "eu"})
+	if !errors.Is(err, keymerge.ErrImmutableField) {
+		t.Errorf("expected ErrImmutableField, got %v", err)
+	}
+	if doc, _ := tree.Doc("settings"); doc != "Replaced as a whole." {
+		t.Errorf("got doc %q", doc)
+	}
+}
+
+func TestLoadRulesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		want  error
+	}{
+		{"not a map", "hosts: [name]", keymerge.ErrInvalidOptions},
+		{"unknown directive", "hosts: {primary: true}", keymerge.ErrInvalidOptions},
+		{"keys type", "hosts: {keys: name}", keymerge.ErrInvalidOptions},
+		{"boolean type", "hosts: {opaque: yes please}", keymerge.ErrInvalidOptions},
+		{"invalid mode", "hosts: {mode: merge}", keymerge.ErrInvalidTag},
+		{"sep without join", "hosts: {sep: ;}", keymerge.ErrInvalidTag},
+		{"join and agg", "count: {mode: join, agg: sum}", keymerge.ErrInvalidTag},
+		{"invalid path", "hosts[name=a]: {ignore: true}", keymerge.ErrInvalidPath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := keymerge.LoadRules(strings.NewReader(tt.rules), yaml.Unmarshal); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
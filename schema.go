@@ -0,0 +1,251 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// schemaExtensionPrefix starts the names of the JSON Schema keywords that
+// [LoadSchemaRules] reads as merge directives.
+const schemaExtensionPrefix = "x-keymerge-"
+
+// LoadSchemaRules reads a JSON Schema, decoding it with unmarshal, into a
+// [RuleSet] with a rule for every property it describes, so that published
+// schemas can drive merges without Go structs. Merge directives are given by
+// "x-keymerge-" keywords named like the directives of [LoadRules], e.g.
+// "x-keymerge-keys" and "x-keymerge-mode", and descriptions become field
+// documentation:
+//
+//	{
+//	  "type": "object",
+//	  "properties": {
+//	    "endpoints": {
+//	      "type": "array",
+//	      "x-keymerge-keys": ["region", "name"],
+//	      "x-keymerge-dupe": "consolidate",
+//	      "items": {"$ref": "#/$defs/endpoint"}
+//	    }
+//	  },
+//	  "$defs": {
+//	    "endpoint": {
+//	      "type": "object",
+//	      "properties": {
+//	        "region": {"type": "string"},
+//	        "name": {"type": "string", "description": "Endpoint name."},
+//	        "tags": {"type": "array", "x-keymerge-mode": "dedup"}
+//	      }
+//	    }
+//	  }
+//	}
+//
+// Arrays are lists; the directives of their items schemas apply to them too.
+// Properties of objects and of array items are followed, as are local "$ref"
+// references. Other keywords, such as "allOf" and "additionalProperties", are
+// ignored. Since every property gets a rule, the rules know every field the
+// schema does, for [Options.RejectUnknownFields].
+//
+// Returns an error wrapping [ErrInvalidOptions] or [ErrInvalidPath] for
+// malformed schemas or directives, or an [*InvalidTagError] for invalid
+// directive values.
+func LoadSchemaRules(r io.Reader, unmarshal func([]byte, any) error) (*RuleSet, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var schema map[string]any
+	if err := unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	loader := schemaLoader{root: schema, rules: NewRuleSet(), visiting: make(map[string]bool), directives: extensionDirectives}
+	schema, err = loader.resolve(schema)
+	if err != nil {
+		return nil, err
+	}
+	for keyword := range schema {
+		if strings.HasPrefix(keyword, schemaExtensionPrefix) {
+			return nil, fmt.Errorf("%w: the root schema cannot have merge directives", ErrInvalidOptions)
+		}
+	}
+	prefix := ""
+	if isArraySchema(schema) {
+		// Top-level lists describe their items' fields
+		items, ok := schema["items"].(map[string]any)
+		if !ok {
+			return loader.rules, nil
+		}
+		if schema, err = loader.resolve(items); err != nil {
+			return nil, err
+		}
+		prefix = "[*]"
+	}
+	if err := loader.loadProperties(prefix, schema); err != nil {
+		return nil, err
+	}
+	if _, err := loader.rules.Build(); err != nil {
+		return nil, err
+	}
+	return loader.rules, nil
+}
+
+// schemaLoader builds a [RuleSet] from a JSON Schema.
+type schemaLoader struct {
+	root  map[string]any
+	rules *RuleSet
+	// visiting holds the references being loaded, so that recursive schemas
+	// stop at the first repetition.
+	visiting map[string]bool
+	// directives returns the merge directives of a property's schema, given
+	// the schema of its items if it describes arrays.
+	directives func(schema, items map[string]any) map[string]any
+}
+
+// loadProperties adds rules for the properties of an object schema, whose
+// fields are at prefix.
+func (l *schemaLoader) loadProperties(prefix string, schema map[string]any) error {
+	properties, ok := schema["properties"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	for _, name := range sortedKeys(properties) {
+		property, ok := properties[name].(map[string]any)
+		if !ok {
+			continue
+		}
+		if err := l.loadProperty(appendFieldPath(prefix, name), property); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadProperty adds the rule for the property at path and its own properties.
+func (l *schemaLoader) loadProperty(path string, schema map[string]any) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		if l.visiting[ref] {
+			return nil
+		}
+		l.visiting[ref] = true
+		defer delete(l.visiting, ref)
+	}
+	schema, err := l.resolve(schema)
+	if err != nil {
+		return err
+	}
+
+	list := isArraySchema(schema)
+	var items map[string]any
+	if list {
+		if items, _ = schema["items"].(map[string]any); items != nil {
+			if ref, ok := items["$ref"].(string); ok {
+				if l.visiting[ref] {
+					items = nil
+				} else {
+					l.visiting[ref] = true
+					defer delete(l.visiting, ref)
+				}
+			}
+		}
+		if items != nil {
+			if items, err = l.resolve(items); err != nil {
+				return err
+			}
+		}
+	}
+
+	directives := l.directives(schema, items)
+	if description, ok := schema["description"].(string); ok && directives["doc"] == nil {
+		directives["doc"] = description
+	}
+	rule := l.rules.Field(path)
+	if list {
+		rule.meta.list = true
+	}
+	if err := loadRule(rule, directives); err != nil {
+		return fmt.Errorf("schema of %q: %w", path, err)
+	}
+
+	switch {
+	case items != nil && !isArraySchema(items):
+		return l.loadProperties(path+"[*]", items)
+	case !list:
+		return l.loadProperties(path, schema)
+	}
+	// Lists of lists can't be described
+	return nil
+}
+
+// resolve returns schema with a local "$ref" replaced by the schema it refers
+// to, overridden by the keywords next to it.
+func (l *schemaLoader) resolve(schema map[string]any) (map[string]any, error) {
+	for range 32 {
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return schema, nil
+		}
+		pointer, ok := strings.CutPrefix(ref, "#")
+		if !ok {
+			return nil, fmt.Errorf("%w: unsupported schema reference %q", ErrInvalidOptions, ref)
+		}
+		var target any = l.root
+		for _, token := range strings.Split(pointer, "/")[1:] {
+			token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+			mp, ok := target.(map[string]any)
+			if !ok {
+				target = nil
+				break
+			}
+			target = mp[token]
+		}
+		resolved, ok := target.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%w: unresolved schema reference %q", ErrInvalidOptions, ref)
+		}
+		merged := maps.Clone(resolved)
+		for keyword, value := range schema {
+			if keyword != "$ref" {
+				merged[keyword] = value
+			}
+		}
+		schema = merged
+	}
+	return nil, fmt.Errorf("%w: schema references nest too deeply", ErrInvalidOptions)
+}
+
+// extensionDirectives returns the merge directives of the "x-keymerge-"
+// keywords of a property's schema and its items' schema. The array's own
+// directives take precedence over its items'.
+func extensionDirectives(schema, items map[string]any) map[string]any {
+	directives := schemaDirectives(items)
+	maps.Copy(directives, schemaDirectives(schema))
+	return directives
+}
+
+// schemaDirectives returns the merge directives of a schema's "x-keymerge-"
+// keywords, by directive name.
+func schemaDirectives(schema map[string]any) map[string]any {
+	directives := make(map[string]any)
+	for keyword, value := range schema {
+		if name, ok := strings.CutPrefix(keyword, schemaExtensionPrefix); ok {
+			directives[name] = value
+		}
+	}
+	return directives
+}
+
+// isArraySchema reports whether a schema describes arrays, by its "type" or
+// its "items".
+func isArraySchema(schema map[string]any) bool {
+	switch t := schema["type"].(type) {
+	case string:
+		return t == "array"
+	case []any:
+		return slices.Contains(t, any("array"))
+	}
+	_, ok := schema["items"]
+	return ok
+}
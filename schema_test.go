@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+const endpointSchema = `{
+  "type": "object",
+  "properties": {
+    "endpoints": {
+      "type": "array",
+      "x-keymerge-keys": ["region", "name"],
+      "items": {"$ref": "#/$defs/endpoint"}
+    },
+    "limits": {
+      "type": "object",
+      "properties": {"cpu": {"type": "integer", "x-keymerge-agg": "max"}}
+    },
+    "tree": {"$ref": "#/$defs/node"}
+  },
+  "$defs": {
+    "endpoint": {
+      "type": "object",
+      "x-keymerge-dupe": "consolidate",
+      "properties": {
+        "region": {"type": "string"},
+        "name": {"type": "string", "description": "Endpoint name."},
+        "tags": {"type": ["array", "null"], "x-keymerge-mode": "dedup"}
+      }
+    },
+    "node": {
+      "type": "object",
+      "properties": {"children": {"type": "array", "items": {"$ref": "#/$defs/node"}}}
+    }
+  }
+}`
+
+func TestLoadSchemaRules(t *testing.T) {
+	rules, err := keymerge.LoadSchemaRules(strings.NewReader(endpointSchema), json.Unmarshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := rules.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{RejectUnknownFields: true}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger.SetMetadata(tree)
+	result, err := merger.MergeUnstructured(
+		map[string]any{
+			"limits": map[string]any{"cpu": 4},
+			"endpoints": []any{
+				map[string]any{"region": "us", "name": "api", "tags": []any{"a"}},
+				map[string]any{"region": "us", "name": "api", "tags": []any{"b"}},
+			},
+		},
+		map[string]any{
+			"limits":    map[string]any{"cpu": 2},
+			"endpoints": []any{map[string]any{"region": "us", "name": "api", "tags": []any{"a", "c"}}},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"limits":    map[string]any{"cpu": 4},
+		"endpoints": []any{map[string]any{"region": "us", "name": "api", "tags": []any{"a", "b", "c"}}},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+	if doc, _ := tree.Doc("endpoints[0].name"); doc != "Endpoint name." {
+		t.Errorf("got doc %q", doc)
+	}
+
+	// The schema's properties are the only known fields.
+	_, err = merger.MergeUnstructured(map[string]any{"endpoints": []any{map[string]any{"region": "us", "port": 80}}})
+	if !errors.Is(err, keymerge.ErrUnknownField) {
+		t.Errorf("expected ErrUnknownField, got %v", err)
+	}
+}
+
+func TestLoadSchemaRulesTopLevelList(t *testing.T) {
+	schema := `{"type": "array", "items": {"properties": {"tags": {"type": "array", "x-keymerge-mode": "replace"}}}}`
+	rules, err := keymerge.LoadSchemaRules(strings.NewReader(schema), json.Unmarshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := rules.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger, err := keymerge.NewUntypedMerger(keymerge.Options{PrimaryKeyNames: []string{"name"}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger.SetMetadata(tree)
+	result, err := merger.MergeUnstructured(
+		[]any{map[string]any{"name": "a", "tags": []any{"x"}}},
+		[]any{map[string]any{"name": "a", "tags": []any{"y"}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []any{map[string]any{"name": "a", "tags": []any{"y"}}}; !reflect.DeepEqual(result, want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+}
+
+func TestLoadSchemaRulesErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   error
+	}{
+		{"remote reference", `{"properties": {"a": {"$ref": "other.json#/a"}}}`, keymerge.ErrInvalidOptions},
+		{"unresolved reference", `{"properties": {"a": {"$ref": "#/$defs/missing"}}}`, keymerge.ErrInvalidOptions},
+		{"root directive", `{"x-keymerge-keys": ["name"]}`, keymerge.ErrInvalidOptions},
+		{"invalid mode", `{"properties": {"a": {"x-keymerge-mode": "merge"}}}`, keymerge.ErrInvalidTag},
+		{"unknown directive", `{"properties": {"a": {"x-keymerge-primary": true}}}`, keymerge.ErrInvalidOptions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := keymerge.LoadSchemaRules(strings.NewReader(tt.schema), json.Unmarshal); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ErrScalarStrategy indicates a [ScalarStrategy] could not combine two values.
+var ErrScalarStrategy = errors.New("scalar strategy failed")
+
+// ScalarStrategy combines a scalar value with the value an overlay sets in its
+// place, instead of letting the overlay's value win. It is only called when
+// both values are non-nil, and not for maps or lists, so base is the result of
+// merging the earlier documents. See [Options.ScalarStrategies].
+type ScalarStrategy func(base, overlay any) (any, error)
+
+// ScalarStrategyError is returned when a [ScalarStrategy] fails, e.g. because
+// [StrategySum] was given a string.
+type ScalarStrategyError struct {
+	// Path is where in the document the values occurred.
+	Path []string
+	// Base is the value before the overlay was merged.
+	Base any
+	// Overlay is the overlay's value.
+	Overlay any
+	// DocIndex tells which document the error occurred.
+	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
+	// Err is the error the strategy returned.
+	Err error
+}
+
+func (e *ScalarStrategyError) Error() string {
+	path := strings.Join(e.Path, ".")
+	if path == "" {
+		path = "(root)"
+	}
+	return fmt.Sprintf("cannot combine %v with %v at path %s in document %d%s: %v",
+		e.Base, e.Overlay, path, e.DocIndex, nameSuffix(e.DocName), e.Err)
+}
+
+func (e *ScalarStrategyError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ScalarStrategyError) Is(target error) bool {
+	return target == ErrScalarStrategy
+}
+
+// scalarStrategies are the strategies named by km:"agg=..." tags.
+var scalarStrategies = map[string]ScalarStrategy{
+	"sum": StrategySum,
+	"min": StrategyMin,
+	"max": StrategyMax,
+}
+
+// StrategySum is a [ScalarStrategy] that adds numbers, e.g. to total replica
+// counts. Integers are added exactly and keep their type if both values have
+// the same type; otherwise the sum is an int64 or uint64, or a float64 if
+// either value is a float. If either value is a [encoding/json.Number] (see
+// [UnmarshalJSONNumbers]), the sum is an exact json.Number.
+func StrategySum(base, overlay any) (any, error) {
+	a, aOK := toBigInt(base)
+	b, bOK := toBigInt(overlay)
+	if aOK && bOK {
+		sum := new(big.Int).Add(a, b)
+		if reflect.TypeOf(base) == reflect.TypeOf(overlay) {
+			rv := reflect.New(reflect.TypeOf(base)).Elem()
+			switch {
+			case rv.CanInt() && sum.IsInt64() && !rv.OverflowInt(sum.Int64()):
+				rv.SetInt(sum.Int64())
+				return rv.Interface(), nil
+			case rv.CanUint() && sum.IsUint64() && !rv.OverflowUint(sum.Uint64()):
+				rv.SetUint(sum.Uint64())
+				return rv.Interface(), nil
+			}
+		}
+		switch {
+		case sum.IsInt64():
+			return sum.Int64(), nil
+		case sum.IsUint64():
+			return sum.Uint64(), nil
+		}
+		return nil, fmt.Errorf("sum %v overflows 64 bits", sum)
+	}
+
+	if isDecimal(base, overlay) {
+		x, ok := toDecimal(base)
+		if !ok {
+			return nil, fmt.Errorf("%v (type %T) is not a number", base, base)
+		}
+		y, ok := toDecimal(overlay)
+		if !ok {
+			return nil, fmt.Errorf("%v (type %T) is not a number", overlay, overlay)
+		}
+		return decimalNumber(new(big.Rat).Add(x, y)), nil
+	}
+
+	x, err := toNumber(base)
+	if err != nil {
+		return nil, err
+	}
+	y, err := toNumber(overlay)
+	if err != nil {
+		return nil, err
+	}
+	sum, _ := new(big.Float).Add(x, y).Float64()
+	return sum, nil
+}
+
+// StrategyMin is a [ScalarStrategy] that keeps the smaller of two numbers, e.g.
+// the strictest rate limit. The value is kept as it is, and the overlay's
+// value is kept if they are equal.
+func StrategyMin(base, overlay any) (any, error) {
+	c, err := compareNumbers(base, overlay)
+	if err != nil {
+		return nil, err
+	}
+	if c < 0 {
+		return base, nil
+	}
+	return overlay, nil
+}
+
+// StrategyMax is a [ScalarStrategy] that keeps the larger of two numbers, e.g.
+// the longest timeout. The value is kept as it is, and the overlay's value is
+// kept if they are equal.
+func StrategyMax(base, overlay any) (any, error) {
+	c, err := compareNumbers(base, overlay)
+	if err != nil {
+		return nil, err
+	}
+	if c > 0 {
+		return base, nil
+	}
+	return overlay, nil
+}
+
+// StrategyJoin returns a [ScalarStrategy] that joins strings with sep instead
+// of replacing them, e.g. to accumulate JAVA_OPTS with " " or an allowlist with
+// ",". An empty string adds nothing to the other. Values that are not strings
+// are an error.
+func StrategyJoin(sep string) ScalarStrategy {
+	return func(base, overlay any) (any, error) {
+		b, ok := base.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v (type %T) is not a string", base, base)
+		}
+		o, ok := overlay.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v (type %T) is not a string", overlay, overlay)
+		}
+		switch {
+		case b == "":
+			return o, nil
+		case o == "":
+			return b, nil
+		default:
+			return b + sep + o, nil
+		}
+	}
+}
+
+// defaultJoinSeparator joins strings for km:"mode=join" tags without sep=.
+const defaultJoinSeparator = ","
+
+// toBigInt converts an integer of any type to a [big.Int].
+func toBigInt(v any) (*big.Int, bool) {
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.CanInt():
+		return big.NewInt(rv.Int()), true
+	case rv.CanUint():
+		return new(big.Int).SetUint64(rv.Uint()), true
+	default:
+		return nil, false
+	}
+}
+
+// toNumber converts a number of any type to a [big.Float], or returns an error
+// if v is not a number.
+func toNumber(v any) (*big.Float, error) {
+	if rv := reflect.ValueOf(v); rv.CanFloat() && math.IsInf(rv.Float(), 0) {
+		return nil, fmt.Errorf("%v is not a finite number", v)
+	}
+	n, ok := toBigFloat(v)
+	if !ok {
+		return nil, fmt.Errorf("%v (type %T) is not a number", v, v)
+	}
+	return n, nil
+}
+
+// compareNumbers compares two numbers of any type by value.
+func compareNumbers(a, b any) (int, error) {
+	if isDecimal(a, b) {
+		x, xOK := toDecimal(a)
+		y, yOK := toDecimal(b)
+		if !xOK || !yOK {
+			return 0, fmt.Errorf("cannot compare %v (type %T) and %v (type %T) as numbers", a, a, b, b)
+		}
+		return x.Cmp(y), nil
+	}
+	x, err := toNumber(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := toNumber(b)
+	if err != nil {
+		return 0, err
+	}
+	return x.Cmp(y), nil
+}
+
+// compiledStrategy is an entry of [Options.ScalarStrategies] with a parsed
+// path pattern.
+type compiledStrategy struct {
+	path     string
+	pattern  []pathStep
+	literals int // field and index steps, which make a pattern more specific
+	strategy ScalarStrategy
+}
+
+// compileStrategies parses the patterns of [Options.ScalarStrategies], ordered
+// so that patterns with more field names and indices come first.
+func compileStrategies(strategies map[string]ScalarStrategy) ([]compiledStrategy, error) {
+	compiled := make([]compiledStrategy, 0, len(strategies))
+	for path, strategy := range strategies {
+		pattern, err := parsePattern(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: ScalarStrategies: %w", ErrInvalidOptions, err)
+		}
+		literals := 0
+		for _, step := range pattern {
+			switch step.kind {
+			case stepSelect:
+				return nil, fmt.Errorf("%w: ScalarStrategies pattern %q cannot contain selectors", ErrInvalidOptions, path)
+			case stepField, stepIndex:
+				literals++
+			}
+		}
+		if strategy == nil {
+			return nil, fmt.Errorf("%w: nil ScalarStrategies entry for %q", ErrInvalidOptions, path)
+		}
+		compiled = append(compiled, compiledStrategy{path: path, pattern: pattern, literals: literals, strategy: strategy})
+	}
+	slices.SortFunc(compiled, func(a, b compiledStrategy) int {
+		return cmp.Or(cmp.Compare(b.literals, a.literals), strings.Compare(a.path, b.path))
+	})
+	if len(compiled) == 0 {
+		return nil, nil
+	}
+	return compiled, nil
+}
+
+// scalarStrategy returns the strategy for the value at the current path, or
+// nil if overlay values replace it.
+func (m *UntypedMerger) scalarStrategy() ScalarStrategy {
+	for _, s := range m.strategies {
+		if matchesSegments(s.pattern, m.path) {
+			return s.strategy
+		}
+	}
+	if meta := m.getCurrentMetadata(); meta != nil {
+		return meta.strategy
+	}
+	return nil
+}
+
+// combineScalars combines base and overlay with strategy.
+func (m *UntypedMerger) combineScalars(strategy ScalarStrategy, base, overlay any) (any, error) {
+	combined, err := strategy(base, overlay)
+	if err != nil {
+		return nil, &ScalarStrategyError{
+			Path:     m.pathNames(),
+			Base:     base,
+			Overlay:  overlay,
+			DocIndex: m.index,
+			Err:      err,
+		}
+	}
+	return combined, nil
+}
@@ -0,0 +1,225 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestScalarStrategies(t *testing.T) {
+	opts := keymerge.Options{
+		PrimaryKeyNames: []string{"name"},
+		ScalarStrategies: map[string]keymerge.ScalarStrategy{
+			"deployments[*].replicas": keymerge.StrategySum,
+			"**.timeout":              keymerge.StrategyMax,
+			"limits.rate":             keymerge.StrategyMin,
+			"limits.timeout":          keymerge.StrategyMin, // More specific than **.timeout
+		},
+	}
+	base := map[string]any{
+		"deployments": []any{map[string]any{"name": "web", "replicas": 2, "timeout": 30}},
+		"limits":      map[string]any{"rate": 100, "timeout": 10},
+		"version":     1,
+	}
+	overlay := map[string]any{
+		"deployments": []any{
+			map[string]any{"name": "web", "replicas": 3, "timeout": 20},
+			map[string]any{"name": "db", "replicas": 1},
+		},
+		"limits":  map[string]any{"rate": 50.5, "timeout": 60},
+		"version": 2,
+	}
+	result, err := keymerge.MergeUnstructured(opts, base, overlay, map[string]any{
+		"deployments": []any{map[string]any{"name": "db", "replicas": 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{
+		"deployments": []any{
+			map[string]any{"name": "web", "replicas": 5, "timeout": 30},
+			map[string]any{"name": "db", "replicas": 3},
+		},
+		"limits":  map[string]any{"rate": 50.5, "timeout": 10},
+		"version": 2,
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %v, want %v", result, expected)
+	}
+}
+
+func TestScalarStrategies_Errors(t *testing.T) {
+	opts := keymerge.Options{ScalarStrategies: map[string]keymerge.ScalarStrategy{"replicas": keymerge.StrategySum}}
+	_, err := keymerge.MergeUnstructured(opts, map[string]any{"replicas": 2}, map[string]any{"replicas": "three"})
+	var strategyErr *keymerge.ScalarStrategyError
+	if !errors.Is(err, keymerge.ErrScalarStrategy) || !errors.As(err, &strategyErr) {
+		t.Fatalf("expected ScalarStrategyError, got %v", err)
+	}
+	if !reflect.DeepEqual(strategyErr.Path, []string{"replicas"}) || strategyErr.DocIndex != 1 {
+		t.Errorf("unexpected error location %+v", strategyErr)
+	}
+
+	for name, strategies := range map[string]map[string]keymerge.ScalarStrategy{
+		"invalid pattern": {"replicas[": keymerge.StrategySum},
+		"selector":        {"items[name=a].count": keymerge.StrategySum},
+		"nil strategy":    {"replicas": nil},
+	} {
+		if _, err := keymerge.NewUntypedMerger(keymerge.Options{ScalarStrategies: strategies}, nil, nil); !errors.Is(err, keymerge.ErrInvalidOptions) {
+			t.Errorf("%s: expected ErrInvalidOptions, got %v", name, err)
+		}
+	}
+}
+
+func TestStrategySum(t *testing.T) {
+	tests := []struct {
+		base, overlay, want any
+	}{
+		{2, 3, 5},
+		{int32(2), int32(-3), int32(-1)},
+		{uint64(2), int64(-3), int64(-1)},
+		{int8(100), int8(100), int64(200)},
+		{uint64(1 << 63), uint64(1 << 62), uint64(3 << 62)},
+		{1, 0.5, 1.5},
+	}
+	for _, tc := range tests {
+		got, err := keymerge.StrategySum(tc.base, tc.overlay)
+		if err != nil || got != tc.want {
+			t.Errorf("StrategySum(%v, %v) = %v (%T), %v; want %v (%T)", tc.base, tc.overlay, got, got, err, tc.want, tc.want)
+		}
+	}
+	if _, err := keymerge.StrategySum(uint64(1<<63), uint64(1<<63)); err == nil {
+		t.Error("expected overflow error")
+	}
+	if _, err := keymerge.StrategySum(true, 1); err == nil {
+		t.Error("expected error for non-number")
+	}
+}
+
+func TestStrategyMinMax(t *testing.T) {
+	if got, _ := keymerge.StrategyMin(uint64(10), 2.5); got != 2.5 {
+		t.Errorf("StrategyMin = %v", got)
+	}
+	if got, _ := keymerge.StrategyMin(int64(-1), uint64(3)); got != int64(-1) {
+		t.Errorf("StrategyMin = %v", got)
+	}
+	if got, _ := keymerge.StrategyMax(uint64(10), 2.5); got != uint64(10) {
+		t.Errorf("StrategyMax = %v", got)
+	}
+	if _, err := keymerge.StrategyMax("a", 1); err == nil {
+		t.Error("expected error for non-number")
+	}
+}
+
+func TestMerger_AggTag(t *testing.T) {
+	type Pool struct {
+		Name     string  `yaml:"name" km:"primary"`
+		Replicas int     `yaml:"replicas" km:"agg=sum"`
+		Timeout  float64 `yaml:"timeout" km:"agg=max"`
+		Image    string  `yaml:"image"`
+	}
+	type Config struct {
+		Pools     []Pool `yaml:"pools"`
+		RateLimit int    `yaml:"rateLimit" km:"agg=min"`
+	}
+	merger, err := keymerge.NewMerger[Config](keymerge.Options{}, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := merger.Merge(
+		[]byte("pools:\n  - name: a\n    replicas: 2\n    timeout: 1.5\n    image: v1\nrateLimit: 100\n"),
+		[]byte("pools:\n  - name: a\n    replicas: 3\n    timeout: 0.5\n    image: v2\nrateLimit: 40\n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := yaml.Unmarshal(result, &config); err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{Pools: []Pool{{Name: "a", Replicas: 5, Timeout: 1.5, Image: "v2"}}, RateLimit: 40}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+
+	type Invalid struct {
+		Count int `yaml:"count" km:"agg=avg"`
+	}
+	_, err = keymerge.NewMerger[Invalid](keymerge.Options{}, nil, nil)
+	var tagErr *keymerge.InvalidTagError
+	if !errors.As(err, &tagErr) || tagErr.Kind != keymerge.AggTag || tagErr.Value != "avg" {
+		t.Errorf("expected agg InvalidTagError, got %v", err)
+	}
+}
+
+func TestStrategyJoin(t *testing.T) {
+	opts := keymerge.Options{ScalarStrategies: map[string]keymerge.ScalarStrategy{
+		"env.JAVA_OPTS": keymerge.StrategyJoin(" "),
+		"allowlist":     keymerge.StrategyJoin(","),
+	}}
+	result, err := keymerge.MergeUnstructured(opts,
+		map[string]any{"env": map[string]any{"JAVA_OPTS": "-Xmx1g"}, "allowlist": ""},
+		map[string]any{"env": map[string]any{"JAVA_OPTS": "-Dprod=true"}, "allowlist": "10.0.0.1"},
+		map[string]any{"env": map[string]any{"JAVA_OPTS": ""}, "allowlist": "10.0.0.2"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"env": map[string]any{"JAVA_OPTS": "-Xmx1g -Dprod=true"}, "allowlist": "10.0.0.1,10.0.0.2"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %v, want %v", result, expected)
+	}
+
+	_, err = keymerge.MergeUnstructured(opts, map[string]any{"allowlist": "a"}, map[string]any{"allowlist": 1})
+	if !errors.Is(err, keymerge.ErrScalarStrategy) {
+		t.Errorf("expected ErrScalarStrategy, got %v", err)
+	}
+}
+
+func TestMerger_JoinTag(t *testing.T) {
+	type Config struct {
+		Opts   string `yaml:"opts" km:"mode=join,sep= "`
+		Hosts  string `yaml:"hosts" km:"mode=join,sep=,"`
+		Paths  string `yaml:"paths" km:"mode=join"`
+		Labels string `yaml:"labels" km:"mode=join, sep=, "`
+	}
+	merger, err := keymerge.NewMerger[Config](keymerge.Options{}, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := merger.Merge(
+		[]byte("opts: -Xmx1g\nhosts: a\npaths: /bin\nlabels: x\n"),
+		[]byte("opts: -Xss1m\nhosts: b\npaths: /usr/bin\nlabels: y\n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := yaml.Unmarshal(result, &config); err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{Opts: "-Xmx1g -Xss1m", Hosts: "a,b", Paths: "/bin,/usr/bin", Labels: "x, y"}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+
+	tests := map[string]struct {
+		tag  string
+		kind keymerge.TagKind
+	}{
+		"sep without join": {"sep=;", keymerge.SepTag},
+		"join with agg":    {"mode=join,agg=sum", keymerge.ModeTag},
+	}
+	for name, tc := range tests {
+		_, err := keymerge.NewMetadataTree(keymerge.FieldSpec{Name: "value", Tag: tc.tag})
+		var tagErr *keymerge.InvalidTagError
+		if !errors.As(err, &tagErr) || tagErr.Kind != tc.kind {
+			t.Errorf("%s: expected %v InvalidTagError, got %v", name, tc.kind, err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import "fmt"
+
+// MergeStreams merges streams of documents. See [UntypedMerger.MergeStreams] for details.
+func MergeStreams(opts Options, identity []string, streams ...[]any) ([]any, error) {
+	m, err := NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return m.MergeStreams(identity, streams...)
+}
+
+// MergeStreams merges streams of documents, such as the documents of
+// multi-document YAML files, the way lists of keyed items merge.
+//
+// A document's identity is made of the values at the identity paths (see
+// [Lookup]), such as "kind" and "metadata.name" for Kubernetes manifests.
+// Documents with the same identity are merged left-to-right with
+// [UntypedMerger.MergeUnstructured], in the position of the first one.
+// Documents of later streams with new identities, and documents missing any
+// identity value, are appended. A document marked for deletion (see
+// [Options.DeleteMarkerKey]) removes the documents with its identity, and
+// [Options.OnDelete] is called with the root path, their merged document, and
+// the index of the deleting document's stream.
+//
+// Two documents of one stream with the same identity are handled according to
+// [DupeMode], reported as a [DuplicatePrimaryKeyError] with the stream's index
+// as DocIndex. Errors merging documents are wrapped with their identity.
+//
+// Example:
+//
+//	identity := []string{"kind", "metadata.name"}
+//	result, err := MergeStreams(opts, identity, baseDocs, overlayDocs)
+func (m *UntypedMerger) MergeStreams(identity []string, streams ...[]any) ([]any, error) {
+	paths := make([][]pathStep, len(identity))
+	for i, path := range identity {
+		steps, err := parsePath(path)
+		if err != nil {
+			return nil, err
+		}
+		paths[i] = steps
+	}
+
+	type group struct {
+		key     *Key  // nil for documents without an identity
+		docs    []any // documents to merge, nil once deleted
+		streams []int // the index of each document's stream
+	}
+	var groups []*group
+	index := make(map[any]*group)
+	for i, stream := range streams {
+		seen := make(map[any]int, len(stream))
+		for j, doc := range stream {
+			key, ok := documentIdentity(Unordered(doc), paths)
+			if !ok {
+				groups = append(groups, &group{docs: []any{doc}, streams: []int{i}})
+				continue
+			}
+			if !key.isComparable() {
+				return nil, &NonComparablePrimaryKeyError{Key: key.String(), Position: j, DocIndex: i, DocName: m.docName(i)}
+			}
+			mapKey := key.mapKey()
+			if first, exists := seen[mapKey]; exists && m.opts.DupeMode == DupeUnique {
+				return nil, &DuplicatePrimaryKeyError{
+					Key: key.String(), Positions: []int{first, j}, DocIndex: i, DocName: m.docName(i),
+				}
+			}
+			seen[mapKey] = j
+
+			g, exists := index[mapKey]
+			if m.isMarkedForDeletion(Unordered(doc)) {
+				if exists {
+					if err := m.checkDeleteGroup(g.docs, g.streams, i); err != nil {
+						return nil, fmt.Errorf("document %s: %w", key, err)
+					}
+					g.docs, g.streams = nil, nil
+					delete(index, mapKey)
+				}
+				continue
+			}
+			if !exists {
+				g = &group{key: key}
+				index[mapKey] = g
+				groups = append(groups, g)
+			}
+			g.docs = append(g.docs, doc)
+			g.streams = append(g.streams, i)
+		}
+	}
+
+	result := make([]any, 0, len(groups))
+	for _, g := range groups {
+		if g.docs == nil {
+			continue
+		}
+		merged, err := m.mergeGroup(g.docs, g.streams)
+		if err != nil {
+			if g.key != nil {
+				return nil, fmt.Errorf("document %s: %w", g.key, err)
+			}
+			return nil, err
+		}
+		result = append(result, merged)
+	}
+	return result, nil
+}
+
+// mergeGroup merges the documents of one identity, with the metadata the
+// function set by [UntypedMerger.SetStreamMetadata] picks for them, if any,
+// naming each document after its stream.
+func (m *UntypedMerger) mergeGroup(docs []any, streams []int) (any, error) {
+	if m.names != nil {
+		names := make([]string, len(streams))
+		for i, stream := range streams {
+			names[i] = m.docName(stream)
+		}
+		defer func(saved []string) { m.names = saved }(m.names)
+		m.names = names
+	}
+	if m.streamMetadata != nil {
+		if tree := m.streamMetadata(docs[0]); !tree.IsZero() {
+			defer func(saved *fieldMetadata) { m.metadata = saved }(m.metadata)
+			m.metadata = tree.root
+		}
+	}
+	return m.MergeUnstructured(docs...)
+}
+
+// checkDeleteGroup calls [Options.OnDelete], if set, for the merged documents
+// of a group that a document of stream index docIndex deletes.
+func (m *UntypedMerger) checkDeleteGroup(docs []any, streams []int, docIndex int) error {
+	if m.opts.OnDelete == nil {
+		return nil
+	}
+	deleted, err := m.mergeGroup(docs, streams)
+	if err != nil {
+		return err
+	}
+	err = m.callOnDelete([]string{}, deleted, docIndex)
+	m.nameDocuments(err)
+	return err
+}
+
+// SetStreamMetadata sets a function that picks the metadata for each group of
+// documents [UntypedMerger.MergeStreams] merges, given the group's first
+// document, so that documents of different kinds merge by different rules
+// (see [KubernetesSchema.MetadataFor]). Groups for which fn returns the zero
+// [MetadataTree] use the merger's own metadata. Passing nil removes fn.
+func (m *UntypedMerger) SetStreamMetadata(fn func(doc any) MetadataTree) {
+	m.streamMetadata = fn
+}
+
+// documentIdentity returns the values of doc at the identity paths. The
+// boolean result is false if doc lacks any of them or one is nil.
+func documentIdentity(doc any, paths [][]pathStep) (*Key, bool) {
+	if len(paths) == 0 {
+		return nil, false
+	}
+	values := make([]any, len(paths))
+	for i, steps := range paths {
+		value, ok := lookupSteps(doc, steps)
+		if !ok || value == nil {
+			return nil, false
+		}
+		values[i] = value
+	}
+	return &Key{values: values}, true
+}
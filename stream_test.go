@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func manifest(kind, name string, fields map[string]any) map[string]any {
+	doc := map[string]any{"kind": kind, "metadata": map[string]any{"name": name}}
+	for k, v := range fields {
+		doc[k] = v
+	}
+	return doc
+}
+
+func TestMergeStreams(t *testing.T) {
+	opts := keymerge.Options{DeleteMarkerKey: "_delete"}
+	identity := []string{"kind", "metadata.name"}
+	base := []any{
+		manifest("Deployment", "web", map[string]any{"replicas": 1}),
+		manifest("Service", "web", map[string]any{"port": 80}),
+		manifest("ConfigMap", "old", nil),
+		map[string]any{"comment": "no identity"},
+	}
+	overlay := []any{
+		manifest("Service", "web", map[string]any{"port": 8080}),
+		manifest("ConfigMap", "old", map[string]any{"_delete": true}),
+		manifest("Deployment", "worker", map[string]any{"replicas": 3}),
+	}
+	result, err := keymerge.MergeStreams(opts, identity, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []any{
+		manifest("Deployment", "web", map[string]any{"replicas": 1}),
+		manifest("Service", "web", map[string]any{"port": 8080}),
+		map[string]any{"comment": "no identity"},
+		manifest("Deployment", "worker", map[string]any{"replicas": 3}),
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got  %v\nwant %v", result, expected)
+	}
+}
+
+func TestMergeStreams_Duplicates(t *testing.T) {
+	identity := []string{"kind", "metadata.name"}
+	stream := []any{
+		manifest("Service", "web", map[string]any{"port": 80}),
+		manifest("Service", "web", map[string]any{"protocol": "TCP"}),
+	}
+	_, err := keymerge.MergeStreams(keymerge.Options{}, identity, []any{}, stream)
+	var dupErr *keymerge.DuplicatePrimaryKeyError
+	if !errors.As(err, &dupErr) || dupErr.DocIndex != 1 || !reflect.DeepEqual(dupErr.Positions, []int{0, 1}) {
+		t.Fatalf("expected a duplicate error in stream 1, got %v", err)
+	}
+
+	result, err := keymerge.MergeStreams(keymerge.Options{DupeMode: keymerge.DupeConsolidate}, identity, stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []any{manifest("Service", "web", map[string]any{"port": 80, "protocol": "TCP"})}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %v, want %v", result, expected)
+	}
+}
+
+func TestMergeStreams_Errors(t *testing.T) {
+	if _, err := keymerge.MergeStreams(keymerge.Options{}, []string{"a["}); !errors.Is(err, keymerge.ErrInvalidPath) {
+		t.Errorf("expected ErrInvalidPath, got %v", err)
+	}
+
+	opts := keymerge.Options{ConflictMode: keymerge.ConflictStrict}
+	_, err := keymerge.MergeStreams(opts, []string{"name"},
+		[]any{map[string]any{"name": "a", "port": 1}},
+		[]any{map[string]any{"name": "a", "port": 2}})
+	if !errors.Is(err, keymerge.ErrConflict) || !strings.Contains(err.Error(), "document a:") {
+		t.Errorf("expected a conflict in document a, got %v", err)
+	}
+
+	_, err = keymerge.MergeStreams(keymerge.Options{}, []string{"name"}, []any{map[string]any{"name": []any{1}}})
+	if !errors.Is(err, keymerge.ErrNonComparablePrimaryKey) {
+		t.Errorf("expected ErrNonComparablePrimaryKey, got %v", err)
+	}
+}
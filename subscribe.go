@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Subscriptions notifies callbacks when specific paths of a merged document
+// change between successive merge results.
+//
+// Services that re-merge their configuration on reload pass each new result
+// to [Subscriptions.Update]; only subscribers whose path changed are called,
+// so callers don't need to diff whole documents themselves.
+//
+// The zero value is ready to use. Subscriptions is safe for concurrent use.
+type Subscriptions struct {
+	mu      sync.Mutex
+	current any
+	nextID  int
+	subs    []*subscription
+}
+
+// subscription is a single registered callback.
+type subscription struct {
+	id    int
+	steps []pathStep
+	fn    func(oldValue, newValue any)
+}
+
+// Subscribe registers fn to be called whenever the value at path differs
+// between the previous and the next document passed to [Subscriptions.Update].
+// A missing value is reported as nil.
+//
+// The path uses the syntax described in [Lookup]. Returns an error wrapping
+// [ErrInvalidPath] if the path cannot be parsed. The returned function removes
+// the subscription.
+//
+// Example:
+//
+//	var subs keymerge.Subscriptions
+//	cancel, err := subs.Subscribe("services[name=web].port", func(oldPort, newPort any) {
+//		log.Printf("web port changed from %v to %v", oldPort, newPort)
+//	})
+func (s *Subscriptions) Subscribe(path string, fn func(oldValue, newValue any)) (func(), error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	sub := &subscription{id: s.nextID, steps: steps, fn: fn}
+	s.subs = append(s.subs, sub)
+
+	return func() { s.unsubscribe(sub.id) }, nil
+}
+
+func (s *Subscriptions) unsubscribe(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, sub := range s.subs {
+		if sub.id == id {
+			s.subs = append(s.subs[:i:i], s.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// Update records merged as the current document and synchronously calls every
+// subscriber whose path changed, in subscription order. The first call compares
+// against an empty document, so subscribers observe the initial values.
+//
+// Callbacks run after the internal lock is released, so they may subscribe,
+// unsubscribe, or inspect [Subscriptions.Current].
+func (s *Subscriptions) Update(merged any) {
+	type notification struct {
+		fn                 func(oldValue, newValue any)
+		oldValue, newValue any
+	}
+
+	s.mu.Lock()
+	previous := s.current
+	s.current = merged
+	var pending []notification
+	for _, sub := range s.subs {
+		oldValue, _ := lookupSteps(previous, sub.steps)
+		newValue, _ := lookupSteps(merged, sub.steps)
+		if !reflect.DeepEqual(oldValue, newValue) {
+			pending = append(pending, notification{fn: sub.fn, oldValue: oldValue, newValue: newValue})
+		}
+	}
+	s.mu.Unlock()
+
+	for _, n := range pending {
+		n.fn(n.oldValue, n.newValue)
+	}
+}
+
+// Current returns the document most recently passed to [Subscriptions.Update].
+func (s *Subscriptions) Current() any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+type change struct {
+	old, new any
+}
+
+func TestSubscriptions_NotifiesOnlyChangedPaths(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}}
+	base := map[string]any{
+		"log": map[string]any{"level": "info"},
+		"services": []any{
+			map[string]any{"name": "web", "port": 80},
+		},
+	}
+
+	var subs keymerge.Subscriptions
+	var portChanges, levelChanges []change
+	if _, err := subs.Subscribe("services[name=web].port", func(o, n any) {
+		portChanges = append(portChanges, change{o, n})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := subs.Subscribe("log.level", func(o, n any) {
+		levelChanges = append(levelChanges, change{o, n})
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Initial load reports initial values
+	merged, err := keymerge.MergeUnstructured(opts, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subs.Update(merged)
+	if len(portChanges) != 1 || portChanges[0] != (change{nil, 80}) {
+		t.Fatalf("unexpected port changes after initial load: %v", portChanges)
+	}
+	if len(levelChanges) != 1 || levelChanges[0] != (change{nil, "info"}) {
+		t.Fatalf("unexpected level changes after initial load: %v", levelChanges)
+	}
+
+	// Reload with an overlay that only touches the port
+	overlay := map[string]any{
+		"services": []any{map[string]any{"name": "web", "port": 8080}},
+	}
+	merged, err = keymerge.MergeUnstructured(opts, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subs.Update(merged)
+	if len(portChanges) != 2 || portChanges[1] != (change{80, 8080}) {
+		t.Fatalf("unexpected port changes after reload: %v", portChanges)
+	}
+	if len(levelChanges) != 1 {
+		t.Fatalf("level subscriber should not be notified, got %v", levelChanges)
+	}
+
+	if subs.Current() == nil {
+		t.Fatal("expected current document to be recorded")
+	}
+}
+
+func TestSubscriptions_Cancel(t *testing.T) {
+	var subs keymerge.Subscriptions
+	calls := 0
+	cancel, err := subs.Subscribe("a", func(_, _ any) { calls++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := 0
+	if _, err := subs.Subscribe("a", func(_, _ any) { other++ }); err != nil {
+		t.Fatal(err)
+	}
+
+	subs.Update(map[string]any{"a": 1})
+	cancel()
+	cancel() // idempotent
+	subs.Update(map[string]any{"a": 2})
+
+	if calls != 1 {
+		t.Fatalf("expected 1 call before cancel, got %d", calls)
+	}
+	if other != 2 {
+		t.Fatalf("expected remaining subscriber to be called twice, got %d", other)
+	}
+}
+
+func TestSubscriptions_RemovedValue(t *testing.T) {
+	var subs keymerge.Subscriptions
+	var got []change
+	if _, err := subs.Subscribe("feature.enabled", func(o, n any) {
+		got = append(got, change{o, n})
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	subs.Update(map[string]any{"feature": map[string]any{"enabled": true}})
+	subs.Update(map[string]any{})
+	if len(got) != 2 || got[1] != (change{true, nil}) {
+		t.Fatalf("expected removal notification, got %v", got)
+	}
+}
+
+func TestSubscriptions_InvalidPath(t *testing.T) {
+	var subs keymerge.Subscriptions
+	_, err := subs.Subscribe("a[", func(_, _ any) {})
+	if !errors.Is(err, keymerge.ErrInvalidPath) {
+		t.Fatalf("expected ErrInvalidPath, got %v", err)
+	}
+}
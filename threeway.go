@@ -0,0 +1,216 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// Conflict describes a value that both sides of a three-way merge changed
+// differently from their common ancestor.
+type Conflict struct {
+	// Path is a path expression (see [Lookup]) addressing the value, as in [Change].
+	Path string
+	// Ancestor, Ours, and Theirs are the value in each document, or nil if the
+	// document does not have it.
+	Ancestor, Ours, Theirs any
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s: ancestor %v, ours %v, theirs %v",
+		c.Path, describeValue(c.Ancestor), describeValue(c.Ours), describeValue(c.Theirs))
+}
+
+// describeValue formats a conflicting value, showing absent values as such.
+func describeValue(v any) string {
+	if v == nil {
+		return "(none)"
+	}
+	return fmt.Sprint(v)
+}
+
+// MergeThreeWay merges two documents derived from a common ancestor.
+// See [UntypedMerger.MergeThreeWay] for details.
+func MergeThreeWay(opts Options, ancestor, ours, theirs any) (any, []Conflict, error) {
+	m, err := NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m.MergeThreeWay(ancestor, ours, theirs)
+}
+
+// MergeThreeWay performs a git-style merge of two documents derived from a common
+// ancestor: every change that theirs made relative to the ancestor is applied to
+// ours, including removals, unless ours changed the same value differently.
+//
+// Such values are returned as conflicts, and the result keeps ours for them.
+// Maps are merged key by key and lists whose items all have primary keys item by
+// item, matching items by key as [UntypedMerger.Compare] does; other lists and
+// scalars conflict as a whole. Items that only theirs added are appended after
+// ours. Values are compared like [UntypedMerger.Compare] compares them.
+//
+// Returns an error if a document has maps whose keys cannot be converted
+// (see [Options.MapKeyMode]).
+//
+// Example:
+//
+//	result, conflicts, err := keymerge.MergeThreeWay(opts, lastApplied, local, upstream)
+//	if err != nil {
+//		return err
+//	}
+//	for _, c := range conflicts {
+//		log.Printf("conflict at %s: keeping %v", c.Path, c.Ours)
+//	}
+func (m *UntypedMerger) MergeThreeWay(ancestor, ours, theirs any) (any, []Conflict, error) {
+	docs := []any{ancestor, ours, theirs}
+	for i, doc := range docs {
+		m.reset(i)
+		normalized, err := m.normalizeKeys(doc)
+		if err != nil {
+			return nil, nil, err
+		}
+		docs[i] = normalized
+	}
+
+	m.reset(0)
+	var conflicts []Conflict
+	result, _ := m.mergeThree("", side{docs[0], true}, side{docs[1], true}, side{docs[2], true}, &conflicts)
+	return result, conflicts, nil
+}
+
+// side is a value in one document of a three-way merge, which may be absent.
+type side struct {
+	value   any
+	present bool
+}
+
+func (s side) equal(other side) bool {
+	return s.present == other.present && (!s.present || equalValues(s.value, other.value))
+}
+
+// mergeThree merges the values at path and reports whether the result has a value.
+func (m *UntypedMerger) mergeThree(path string, base, ours, theirs side, conflicts *[]Conflict) (any, bool) {
+	switch {
+	case ours.equal(theirs), base.equal(theirs):
+		return ours.value, ours.present
+	case base.equal(ours):
+		return theirs.value, theirs.present
+	}
+
+	// Both sides changed the value; merge containers if both still have them.
+	if ours.present && theirs.present {
+		oursMap, oursIsMap := ours.value.(map[string]any)
+		theirsMap, theirsIsMap := theirs.value.(map[string]any)
+		if oursIsMap && theirsIsMap {
+			baseMap, _ := base.value.(map[string]any)
+			return m.mergeThreeMaps(path, baseMap, oursMap, theirsMap, conflicts), true
+		}
+
+		oursList, oursIsList := asList(ours.value)
+		theirsList, theirsIsList := asList(theirs.value)
+		if oursIsList && theirsIsList {
+			baseList, _ := asList(base.value)
+			if merged, ok := m.mergeThreeLists(path, baseList, oursList, theirsList, conflicts); ok {
+				return merged, true
+			}
+		}
+	}
+
+	*conflicts = append(*conflicts, Conflict{Path: path, Ancestor: base.value, Ours: ours.value, Theirs: theirs.value})
+	return ours.value, ours.present
+}
+
+func (m *UntypedMerger) mergeThreeMaps(path string, base, ours, theirs map[string]any, conflicts *[]Conflict) map[string]any {
+	union := make(map[string]any, len(ours))
+	for _, mp := range []map[string]any{base, ours, theirs} {
+		for k := range mp {
+			union[k] = nil
+		}
+	}
+
+	result := make(map[string]any, len(ours))
+	for _, k := range sortedKeys(union) {
+		b, inBase := base[k]
+		o, inOurs := ours[k]
+		t, inTheirs := theirs[k]
+		m.push(k)
+		merged, present := m.mergeThree(appendFieldPath(path, k),
+			side{b, inBase}, side{o, inOurs}, side{t, inTheirs}, conflicts)
+		m.pop()
+		if present {
+			result[k] = merged
+		}
+	}
+	return result
+}
+
+// mergeThreeLists merges lists item by item when every item of every list has a
+// unique, comparable primary key. Returns false if they do not.
+func (m *UntypedMerger) mergeThreeLists(path string, base, ours, theirs []any, conflicts *[]Conflict) ([]any, bool) {
+	baseIndex, ok := m.indexByKey(base)
+	if !ok {
+		return nil, false
+	}
+	oursIndex, ok := m.indexByKey(ours)
+	if !ok {
+		return nil, false
+	}
+	theirsIndex, ok := m.indexByKey(theirs)
+	if !ok {
+		return nil, false
+	}
+
+	item := func(list []any, index map[any]int, key any) side {
+		if i, exists := index[key]; exists {
+			return side{list[i], true}
+		}
+		return side{}
+	}
+
+	result := make([]any, 0, len(ours))
+	var added []int // positions of items only theirs has
+	merge := func(i int, value any) {
+		m.push(strconv.Itoa(i))
+		key := toMapKey(m.getPrimaryKey(value))
+		merged, present := m.mergeThree(m.itemPath(path, value, i),
+			item(base, baseIndex, key), item(ours, oursIndex, key), item(theirs, theirsIndex, key), conflicts)
+		m.pop()
+		if present {
+			result = append(result, merged)
+		}
+	}
+	for i, value := range ours {
+		merge(i, value)
+	}
+	for key, i := range theirsIndex {
+		if _, inOurs := oursIndex[key]; !inOurs {
+			added = append(added, i)
+		}
+	}
+	slices.Sort(added)
+	for _, i := range added {
+		merge(i, theirs[i])
+	}
+	return result, true
+}
+
+// indexByKey maps the primary keys of list items to their positions. Returns
+// false if an item has no usable key or a key is repeated.
+func (m *UntypedMerger) indexByKey(list []any) (map[any]int, bool) {
+	index := make(map[any]int, len(list))
+	for i, item := range list {
+		m.push(strconv.Itoa(i))
+		key := m.getPrimaryKey(item)
+		m.pop()
+		if key == nil || !isKeyComparable(key) {
+			return nil, false
+		}
+		if _, exists := index[toMapKey(key)]; exists {
+			return nil, false
+		}
+		index[toMapKey(key)] = i
+	}
+	return index, true
+}
@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestMergeThreeWay(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}}
+	ancestor := map[string]any{
+		"database": map[string]any{"host": "localhost", "port": 5432, "pool": 10},
+		"services": []any{
+			map[string]any{"name": "api", "port": 8080, "replicas": 1},
+			map[string]any{"name": "worker", "port": 9000},
+			map[string]any{"name": "debug"},
+		},
+		"tags":    []any{"a"},
+		"legacy":  true,
+		"version": 1,
+	}
+	ours := map[string]any{
+		"database": map[string]any{"host": "db.local", "port": 5432, "pool": 10},
+		"services": []any{
+			map[string]any{"name": "api", "port": 8080, "replicas": 2},
+			map[string]any{"name": "worker", "port": 9000},
+			map[string]any{"name": "debug"},
+			map[string]any{"name": "metrics"},
+		},
+		"tags":    []any{"a", "ours"},
+		"legacy":  true,
+		"version": 2,
+	}
+	theirs := map[string]any{
+		"database": map[string]any{"host": "db.local", "port": 6543, "pool": 10},
+		"services": []any{
+			map[string]any{"name": "worker", "port": 9001},
+			map[string]any{"name": "api", "port": 8081, "replicas": 1},
+			map[string]any{"name": "cache"},
+		},
+		"tags":    []any{"a", "theirs"},
+		"version": 3,
+		"owner":   "platform",
+	}
+
+	result, conflicts, err := keymerge.MergeThreeWay(opts, ancestor, ours, theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]any{
+		"database": map[string]any{"host": "db.local", "port": 6543, "pool": 10},
+		"services": []any{
+			map[string]any{"name": "api", "port": 8081, "replicas": 2},
+			map[string]any{"name": "worker", "port": 9001},
+			map[string]any{"name": "metrics"},
+			map[string]any{"name": "cache"},
+		},
+		"tags":    []any{"a", "ours"},
+		"version": 2,
+		"owner":   "platform",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("unexpected result:\n got: %v\nwant: %v", result, expected)
+	}
+
+	expectedConflicts := []keymerge.Conflict{
+		{Path: "tags", Ancestor: []any{"a"}, Ours: []any{"a", "ours"}, Theirs: []any{"a", "theirs"}},
+		{Path: "version", Ancestor: 1, Ours: 2, Theirs: 3},
+	}
+	if !reflect.DeepEqual(conflicts, expectedConflicts) {
+		t.Fatalf("unexpected conflicts:\n got: %+v\nwant: %+v", conflicts, expectedConflicts)
+	}
+}
+
+func TestMergeThreeWay_DeleteVersusModify(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}}
+	ancestor := map[string]any{
+		"timeout":  30,
+		"services": []any{map[string]any{"name": "api", "port": 8080}},
+	}
+	ours := map[string]any{
+		"services": []any{map[string]any{"name": "api", "port": 8081}},
+	}
+	theirs := map[string]any{
+		"timeout":  60,
+		"services": []any{},
+	}
+
+	result, conflicts, err := keymerge.MergeThreeWay(opts, ancestor, ours, theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both conflicts keep ours: the removed timeout stays removed and the
+	// modified service stays.
+	expected := map[string]any{
+		"services": []any{map[string]any{"name": "api", "port": 8081}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("unexpected result:\n got: %v\nwant: %v", result, expected)
+	}
+	expectedConflicts := []keymerge.Conflict{
+		{
+			Path:     "services[name=api]",
+			Ancestor: map[string]any{"name": "api", "port": 8080},
+			Ours:     map[string]any{"name": "api", "port": 8081},
+		},
+		{Path: "timeout", Ancestor: 30, Theirs: 60},
+	}
+	if !reflect.DeepEqual(conflicts, expectedConflicts) {
+		t.Fatalf("unexpected conflicts:\n got: %+v\nwant: %+v", conflicts, expectedConflicts)
+	}
+	if got := conflicts[1].String(); got != "timeout: ancestor 30, ours (none), theirs 60" {
+		t.Errorf("unexpected String: %q", got)
+	}
+}
+
+func TestMergeThreeWay_NoConflicts(t *testing.T) {
+	ancestor := map[string]any{"a": 1, "b": map[string]any{"c": 2}}
+	ours := map[string]any{"a": 1, "b": map[string]any{"c": 2}, "x": "ours"}
+	theirs := map[string]any{"a": 5, "b": map[string]any{"c": 2}}
+
+	result, conflicts, err := keymerge.MergeThreeWay(keymerge.Options{}, ancestor, ours, theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("unexpected conflicts: %v", conflicts)
+	}
+	expected := map[string]any{"a": 5, "b": map[string]any{"c": 2}, "x": "ours"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected result:\n got: %v\nwant: %v", result, expected)
+	}
+}
+
+func TestMergeThreeWay_InvalidOptions(t *testing.T) {
+	_, _, err := keymerge.MergeThreeWay(keymerge.Options{PrimaryKeyNames: []string{""}}, nil, nil, nil)
+	if !errors.Is(err, keymerge.ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions, got %v", err)
+	}
+}
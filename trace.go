@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"strconv"
+)
+
+// MergeTrace describes how each document contributed to a merge result.
+type MergeTrace struct {
+	// Result is the merged document, as returned by [UntypedMerger.MergeUnstructured].
+	Result any
+	// Steps has one entry per input document, in merge order.
+	Steps []TraceStep
+}
+
+// TraceStep describes the effect of merging one document onto the accumulated result.
+type TraceStep struct {
+	// DocIndex is the index of the merged document.
+	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
+	// Changes lists what this document changed in the accumulated result.
+	// For the first document, every top-level value is reported as added.
+	Changes []Change
+	// Redundant lists the paths of values this document set to the value they
+	// already had, i.e. overlay entries that could be removed without effect.
+	Redundant []string
+}
+
+// Trace merges documents like [MergeUnstructured] while recording the effect of each document.
+// See [UntypedMerger.Trace] for details.
+func Trace(opts Options, docs ...any) (*MergeTrace, error) {
+	m, err := NewUntypedMerger(opts, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return m.Trace(docs...)
+}
+
+// Trace merges documents like [UntypedMerger.MergeUnstructured] while recording
+// which values each document changed (see [UntypedMerger.Compare]) and which of
+// its values were redundant because the accumulated result already had them.
+//
+// Tracing compares the accumulated result before and after every document, so it
+// is considerably slower than merging. It is intended for diagnostics and reports.
+func (m *UntypedMerger) Trace(docs ...any) (*MergeTrace, error) {
+	trace, err := m.trace(docs)
+	m.nameDocuments(err)
+	return trace, err
+}
+
+func (m *UntypedMerger) trace(docs []any) (*MergeTrace, error) {
+	trace := &MergeTrace{Steps: make([]TraceStep, 0, len(docs))}
+	result, err := m.mergeDocuments(docs, func(i int, doc, before, after any) {
+		step := TraceStep{DocIndex: i, DocName: m.docName(i)}
+		previous := before
+		if previous == nil {
+			previous = emptyLike(after)
+		}
+		step.Changes, _ = m.Compare(previous, after)
+		if i > 0 {
+			step.Redundant = m.redundantPaths(doc, before, after)
+		}
+		trace.Steps = append(trace.Steps, step)
+	})
+	if err != nil {
+		return nil, err
+	}
+	trace.Result = result
+	return trace, nil
+}
+
+// Source returns the index of the last document that changed the value at path,
+// one of its ancestors, or anything beneath it. Returns -1 if no document did.
+// Returns an error wrapping [ErrInvalidPath] if the path cannot be parsed.
+func (t *MergeTrace) Source(path string) (int, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return -1, err
+	}
+	canonical := formatPath(steps)
+	for i := len(t.Steps) - 1; i >= 0; i-- {
+		for _, change := range t.Steps[i].Changes {
+			if isPathWithin(canonical, change.Path) || isPathWithin(change.Path, canonical) {
+				return t.Steps[i].DocIndex, nil
+			}
+		}
+	}
+	return -1, nil
+}
+
+// emptyLike returns an empty container of the same kind as v, so that the first
+// document of a trace is reported as a set of additions.
+func emptyLike(v any) any {
+	if _, ok := v.(map[string]any); ok {
+		return map[string]any{}
+	}
+	if _, ok := asList(v); ok {
+		return []any{}
+	}
+	return nil
+}
+
+// redundantPaths returns the leaf paths of overlay whose value was the same in
+// the accumulated result before and after merging overlay.
+func (m *UntypedMerger) redundantPaths(overlay, before, after any) []string {
+	var redundant []string
+	m.reset(0)
+	m.walkLeaves("", overlay, func(path string) {
+		steps, err := parsePath(path)
+		if err != nil {
+			return
+		}
+		old, inBefore := lookupSteps(before, steps)
+		updated, inAfter := lookupSteps(after, steps)
+		if inBefore && inAfter && equalValues(old, updated) {
+			redundant = append(redundant, path)
+		}
+	})
+	return redundant
+}
+
+// walkLeaves calls fn with the path of every leaf value an overlay sets: scalars,
+// lists without primary keys, and empty maps. Items of keyed lists are addressed
+// by key and their key fields are skipped, since they only identify the item.
+// Unkeyed items of keyed lists and deletion markers are skipped because they
+// always change the result.
+func (m *UntypedMerger) walkLeaves(path string, value any, fn func(path string)) {
+	if m.isMarkedForDeletion(value) {
+		return
+	}
+
+	if mp, ok := value.(map[string]any); ok && len(mp) > 0 {
+		m.walkMapLeaves(path, mp, nil, fn)
+		return
+	}
+
+	if list, ok := asList(value); ok && m.hasKeyedItems(list) {
+		for i, item := range list {
+			m.push(strconv.Itoa(i))
+			match := m.keySelector(item)
+			if match != nil && !m.isMarkedForDeletion(item) {
+				m.walkMapLeaves(appendSelectorPath(path, match), item.(map[string]any), match, fn)
+			}
+			m.pop()
+		}
+		return
+	}
+
+	fn(path)
+}
+
+// walkMapLeaves walks the leaves of each map entry except delete markers and
+// the given key fields.
+func (m *UntypedMerger) walkMapLeaves(path string, mp map[string]any, keys []keyMatch, fn func(path string)) {
+	for _, k := range sortedKeys(mp) {
+		if marker := m.deleteMarkerKey(); (marker != "" && k == marker) || isKeyField(keys, k) {
+			continue
+		}
+		m.push(k)
+		m.walkLeaves(appendFieldPath(path, k), mp[k], fn)
+		m.pop()
+	}
+}
+
+// isKeyField reports whether name is one of the selector's field names.
+func isKeyField(keys []keyMatch, name string) bool {
+	for _, key := range keys {
+		if key.name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestTrace(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"name"}, DeleteMarkerKey: "_delete"}
+	base := map[string]any{
+		"log": "info",
+		"services": []any{
+			map[string]any{"name": "api", "port": 8080},
+			map[string]any{"name": "debug", "port": 9000},
+		},
+	}
+	prod := map[string]any{
+		"log": "warn",
+		"services": []any{
+			map[string]any{"name": "api", "port": 8080, "replicas": 3},
+			map[string]any{"name": "debug", "_delete": true},
+		},
+	}
+	region := map[string]any{
+		"log":  "warn",
+		"zone": "us-east-1a",
+	}
+
+	trace, err := keymerge.Trace(opts, base, prod, region)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedResult, err := keymerge.MergeUnstructured(opts, base, prod, region)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(trace.Result, expectedResult) {
+		t.Fatalf("trace result differs from merge result:\n got: %v\nwant: %v", trace.Result, expectedResult)
+	}
+
+	if len(trace.Steps) != 3 {
+		t.Fatalf("expected 3 steps, got %d", len(trace.Steps))
+	}
+	if len(trace.Steps[0].Changes) != 2 || trace.Steps[0].Changes[0].Kind != keymerge.ChangeAdded {
+		t.Fatalf("expected base values to be added, got %+v", trace.Steps[0].Changes)
+	}
+
+	if !reflect.DeepEqual(trace.Steps[1].Redundant, []string{"services[name=api].port"}) {
+		t.Fatalf("unexpected redundant paths for prod: %v", trace.Steps[1].Redundant)
+	}
+	if !reflect.DeepEqual(trace.Steps[2].Redundant, []string{"log"}) {
+		t.Fatalf("unexpected redundant paths for region: %v", trace.Steps[2].Redundant)
+	}
+
+	sources := map[string]int{
+		"log":                         1,
+		"zone":                        2,
+		"services[name=api].port":     0,
+		"services[name=api].replicas": 1,
+		`services[name="api"]`:        1,
+		"services[name=debug]":        1,
+		"missing":                     -1,
+	}
+	for path, expected := range sources {
+		source, err := trace.Source(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if source != expected {
+			t.Errorf("Source(%q) = %d, want %d", path, source, expected)
+		}
+	}
+
+	if _, err := trace.Source("["); err == nil {
+		t.Error("expected error for invalid path")
+	}
+}
+
+func TestTrace_Errors(t *testing.T) {
+	if _, err := keymerge.Trace(keymerge.Options{PrimaryKeyNames: []string{""}}); err == nil {
+		t.Fatal("expected error for invalid options")
+	}
+
+	opts := keymerge.Options{PrimaryKeyNames: []string{"id"}}
+	dupes := []any{map[string]any{"id": 1}, map[string]any{"id": 1}}
+	if _, err := keymerge.Trace(opts, []any{}, dupes); err == nil {
+		t.Fatal("expected duplicate key error")
+	}
+}
+
+func TestTrace_ListRoot(t *testing.T) {
+	opts := keymerge.Options{PrimaryKeyNames: []string{"id"}}
+	trace, err := keymerge.Trace(opts,
+		[]any{map[string]any{"id": 1, "v": "a"}},
+		[]any{map[string]any{"id": 1, "v": "a"}, map[string]any{"id": 2}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trace.Steps[0].Changes) != 1 || trace.Steps[0].Changes[0].Path != "[id=1]" {
+		t.Fatalf("unexpected base changes: %+v", trace.Steps[0].Changes)
+	}
+	if !reflect.DeepEqual(trace.Steps[1].Redundant, []string{"[id=1].v"}) {
+		t.Fatalf("unexpected redundant paths: %v", trace.Steps[1].Redundant)
+	}
+}
@@ -1,8 +1,10 @@
 package keymerge
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 )
 
@@ -20,6 +22,14 @@ const (
 	DupeTag
 	// FieldTag indicates an error with km:"field=..." directive.
 	FieldTag
+	// AggTag indicates an error with km:"agg=..." directive.
+	AggTag
+	// SepTag indicates an error with km:"sep=..." directive.
+	SepTag
+	// MapTag indicates an error with km:"map=..." directive.
+	MapTag
+	// EmptyTag indicates an error with km:"empty=..." directive.
+	EmptyTag
 )
 
 func (k TagKind) String() string {
@@ -34,6 +44,14 @@ func (k TagKind) String() string {
 		return "dupe"
 	case FieldTag:
 		return "field"
+	case AggTag:
+		return "agg"
+	case SepTag:
+		return "sep"
+	case MapTag:
+		return "map"
+	case EmptyTag:
+		return "empty"
 	default:
 		return fmt.Sprintf("TagKind(%d)", k)
 	}
@@ -74,17 +92,29 @@ func (e *InvalidTagError) Is(target error) bool {
 // Struct tag format:
 //   - km:"primary" - marks a field as part of the composite primary key (only affects list item matching)
 //   - km:"mode=concat|dedup|replace" - sets scalar list merge mode for this field
+//   - km:"mode=join,sep=..." - joins the field's string values with the separator (default ",")
+//     instead of replacing them; sep= must come last, since its value is the rest of the tag
 //   - km:"dupe=unique|consolidate" - sets object list mode for this field
 //   - km:"field=name" - overrides field name detection (for non-standard serialization)
+//   - km:"opaque" - treats list items as opaque values, compared by content and never deep merged
+//   - km:"map=merge|replace" - replaces the field's map wholesale with an overlay's instead of deep merging
+//   - km:"agg=sum|min|max" - combines the field's values across documents (see [Options.ScalarStrategies])
+//   - km:"immutable" - fails the merge with an [*ImmutableFieldError] if an overlay changes or deletes the field's value
 //
 // Multiple directives can be combined: km:"field=wtfs,dupe=consolidate"
 //
+// A separate km-doc tag documents a field, e.g. km-doc:"Port the server listens on."
+// See [MetadataTree.Docs].
+//
 // Field names are automatically detected from yaml, json, and toml struct tags.
 //
 // Note: The km:"primary" tag only affects merging when the struct type is used as a list item type.
 // For example, if Service has km:"primary" tags, they're used when merging []Service lists.
 // Primary key tags on root-level fields or non-list fields have no effect.
 //
+// List items whose type implements [CustomMerger] are merged by its MergeKM
+// method instead of field by field.
+//
 // Example:
 //
 //	type Config struct {
@@ -120,21 +150,88 @@ func NewMerger[T any](opts Options,
 	}
 
 	// Build metadata tree from T's reflection
-	metadata, err := buildMetadata(reflect.TypeOf((*T)(nil)).Elem())
+	metadata, err := MetadataOf[T]()
 	if err != nil {
 		return nil, err
 	}
 
-	merger.metadata = metadata
+	merger.SetMetadata(metadata)
+
+	return &Merger[T]{UntypedMerger: merger}, nil
+}
 
+// NewMergerFromMetadata creates a new [Merger] that uses the given metadata
+// instead of building it from type T's struct tags, so no reflection is needed.
+// The keymerge-gen tool generates constructors that call it with metadata built
+// by [NewMetadataTree].
+//
+// Returns an error if the options are invalid.
+func NewMergerFromMetadata[T any](opts Options,
+	metadata MetadataTree,
+	unmarshal func([]byte, any) error,
+	marshal func(any) ([]byte, error),
+) (*Merger[T], error) {
+	merger, err := NewUntypedMerger(opts, unmarshal, marshal)
+	if err != nil {
+		return nil, err
+	}
+	merger.SetMetadata(metadata)
 	return &Merger[T]{UntypedMerger: merger}, nil
 }
 
+// MergeInto merges overlays onto the current contents of dst and decodes the
+// result back into dst, as config loaders that start from defaults need. dst
+// is marshaled with the merger's functions and merged as document 0, so
+// errors about the overlays have DocIndex 1 and up. dst is only changed if
+// the merge succeeds; fields the overlays delete are reset to their zero value.
+//
+// Example:
+//
+//	cfg := Config{Port: 8080}
+//	if err := merger.MergeInto(&cfg, fromFile, fromEnv); err != nil {
+//		return err
+//	}
+func (m *Merger[T]) MergeInto(dst *T, overlays ...[]byte) error {
+	if dst == nil {
+		return errors.New("cannot merge into a nil destination")
+	}
+	if m.unmarshal == nil || m.marshal == nil {
+		return errors.New("cannot merge into a destination without marshal and unmarshal functions")
+	}
+	base, err := m.marshal(*dst)
+	if err != nil {
+		return &MarshalError{Err: err, Operation: "marshal", DocIndex: 0}
+	}
+	merged, err := m.Merge(append([][]byte{base}, overlays...)...)
+	if err != nil {
+		return err
+	}
+	var value T
+	if err := m.unmarshal(merged, &value); err != nil {
+		return &MarshalError{Err: err, Operation: "unmarshal", DocIndex: -1}
+	}
+	*dst = value
+	return nil
+}
+
 // buildMetadata recursively builds a metadata tree from a type's struct tags.
 func buildMetadata(t reflect.Type) (*fieldMetadata, error) {
-	// Non-struct types have no metadata
+	// Non-struct types have no metadata, except lists of structs such as the
+	// []Rule of a Merger[[]Rule], whose items are described as a list field's are
 	if t.Kind() != reflect.Struct {
-		return &fieldMetadata{}, nil
+		list := false
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+			list = list || t.Kind() == reflect.Slice
+			t = t.Elem()
+		}
+		if !list || t.Kind() != reflect.Struct {
+			return &fieldMetadata{}, nil
+		}
+		items, err := buildMetadata(t)
+		if err != nil {
+			return nil, err
+		}
+		return &fieldMetadata{children: items.children, primaryKeys: items.primaryKeys, list: true, custom: customMergerOf(t)}, nil
 	}
 
 	root := &fieldMetadata{
@@ -145,6 +242,21 @@ func buildMetadata(t reflect.Type) (*fieldMetadata, error) {
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
 
+		// Embedded structs contribute their fields to this level, but the
+		// struct's own fields take precedence
+		if inlined := inlinedStruct(field); inlined != nil {
+			children, err := buildMetadata(inlined)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			for name, child := range children.children {
+				if _, exists := root.children[name]; !exists {
+					root.children[name] = child
+				}
+			}
+			continue
+		}
+
 		// Skip unexported fields
 		if !field.IsExported() {
 			continue
@@ -159,6 +271,7 @@ func buildMetadata(t reflect.Type) (*fieldMetadata, error) {
 		// Parse km tag directives
 		meta := &fieldMetadata{
 			fieldName: fieldName,
+			doc:       field.Tag.Get("km-doc"),
 		}
 
 		kmTag := field.Tag.Get("km")
@@ -186,8 +299,14 @@ func buildMetadata(t reflect.Type) (*fieldMetadata, error) {
 		fieldType := field.Type
 		// Unwrap pointer and slice types to get to the underlying type
 		for fieldType.Kind() == reflect.Ptr || fieldType.Kind() == reflect.Slice {
+			if fieldType.Kind() == reflect.Slice {
+				meta.list = true
+			}
 			fieldType = fieldType.Elem()
 		}
+		if meta.list {
+			meta.custom = customMergerOf(fieldType)
+		}
 
 		if fieldType.Kind() == reflect.Struct {
 			children, err := buildMetadata(fieldType)
@@ -222,6 +341,47 @@ func buildMetadata(t reflect.Type) (*fieldMetadata, error) {
 	return root, nil
 }
 
+// inlinedStruct returns the struct type whose fields a field contributes to
+// its parent's level, or nil if it is a field of its own: a struct tagged
+// ,inline, or an embedded struct whose tags give it no name, as encoding/json
+// and TOML inline them. Embedded structs may be unexported; their exported
+// fields are promoted.
+func inlinedStruct(field reflect.StructField) reflect.Type {
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		if !field.IsExported() {
+			return nil // cannot be allocated when decoding
+		}
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || (!field.IsExported() && !field.Anonymous) {
+		return nil
+	}
+	if name, _ := extractFieldDirective(field.Tag.Get("km")); name != "" {
+		return nil
+	}
+	for _, tagName := range []string{"yaml", "json", "toml"} {
+		tag := field.Tag.Get(tagName)
+		if tag == "-" {
+			return nil
+		}
+		if tag == "" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if slices.Contains(strings.Split(options, ","), "inline") {
+			return t
+		}
+		if name != "" {
+			return nil
+		}
+	}
+	if field.Anonymous {
+		return t
+	}
+	return nil
+}
+
 // getFieldName extracts the serialized field name from struct tags.
 // Priority: km:field override > yaml > json > toml > struct field name.
 func getFieldName(field reflect.StructField) (string, error) {
@@ -274,7 +434,19 @@ func extractFieldDirective(kmTag string) (string, error) {
 
 // parseKMTag parses the km struct tag and populates the fieldMetadata.
 func parseKMTag(tag string, meta *fieldMetadata) error {
-	parts := strings.Split(tag, ",")
+	// sep= takes the rest of the tag, so that separators can be commas or spaces
+	var sep *string
+	if i := sepDirective(tag); i >= 0 {
+		value := tag[i+len("sep="):]
+		sep = &value
+		tag = strings.TrimSuffix(strings.TrimRight(tag[:i], " "), ",")
+	}
+
+	join := false
+	var parts []string
+	if tag != "" {
+		parts = strings.Split(tag, ",")
+	}
 	for _, part := range parts {
 		part = strings.TrimSpace(part)
 
@@ -285,6 +457,36 @@ func parseKMTag(tag string, meta *fieldMetadata) error {
 			continue
 		}
 
+		// Handle opaque list marker
+		if part == "opaque" {
+			meta.opaque = true
+			continue
+		}
+
+		// Handle whole-value replacement marker
+		if part == "replace" {
+			meta.replace = true
+			continue
+		}
+
+		// Handle read-only field marker
+		if part == "ignore" {
+			meta.ignore = true
+			continue
+		}
+
+		// Handle fixed-value field marker
+		if part == "immutable" {
+			meta.immutable = true
+			continue
+		}
+
+		// Handle the string join mode, which applies to scalars rather than lists
+		if part == "mode=join" {
+			join = true
+			continue
+		}
+
 		// Handle mode=value directives
 		if strings.HasPrefix(part, "mode=") {
 			modeStr := strings.TrimPrefix(part, "mode=")
@@ -307,6 +509,57 @@ func parseKMTag(tag string, meta *fieldMetadata) error {
 			continue
 		}
 
+		// Handle map=value directives
+		if strings.HasPrefix(part, "map=") {
+			switch mapStr := strings.TrimPrefix(part, "map="); mapStr {
+			case "merge":
+				meta.replaceMap = false
+			case "replace":
+				meta.replaceMap = true
+			default:
+				return &InvalidTagError{
+					Kind:      MapTag,
+					FieldName: meta.fieldName,
+					Value:     mapStr,
+					Message:   "valid: merge, replace",
+				}
+			}
+			continue
+		}
+
+		// Handle empty=value directives
+		if strings.HasPrefix(part, "empty=") {
+			mode, err := parseEmptyListMode(strings.TrimPrefix(part, "empty="), meta.fieldName)
+			if err != nil {
+				return err
+			}
+			meta.emptyMode = &mode
+			continue
+		}
+
+		// Handle agg=value directives
+		if strings.HasPrefix(part, "agg=") {
+			aggStr := strings.TrimPrefix(part, "agg=")
+			strategy, ok := scalarStrategies[aggStr]
+			if !ok {
+				return &InvalidTagError{
+					Kind:      AggTag,
+					FieldName: meta.fieldName,
+					Value:     aggStr,
+					Message:   "valid: sum, min, max",
+				}
+			}
+			meta.strategy = strategy
+			continue
+		}
+
+		// Handle delete-marker=key directives, where an empty key disables deletion
+		if strings.HasPrefix(part, "delete-marker=") {
+			key := strings.TrimPrefix(part, "delete-marker=")
+			meta.deleteMarker = &key
+			continue
+		}
+
 		// field= is handled separately in getFieldName, skip it here
 		if strings.HasPrefix(part, "field=") {
 			continue
@@ -321,10 +574,79 @@ func parseKMTag(tag string, meta *fieldMetadata) error {
 		}
 	}
 
+	switch {
+	case join && meta.strategy != nil:
+		return &InvalidTagError{
+			Kind:      ModeTag,
+			FieldName: meta.fieldName,
+			Value:     "join",
+			Message:   "cannot be combined with agg",
+		}
+	case join && sep != nil:
+		meta.strategy = StrategyJoin(*sep)
+	case join:
+		meta.strategy = StrategyJoin(defaultJoinSeparator)
+	case sep != nil:
+		return &InvalidTagError{
+			Kind:      SepTag,
+			FieldName: meta.fieldName,
+			Value:     *sep,
+			Message:   "sep requires mode=join",
+		}
+	}
+	if meta.ignore && slices.Contains(meta.primaryKeys, meta.fieldName) {
+		return &InvalidTagError{
+			Kind:      PrimaryTag,
+			FieldName: meta.fieldName,
+			Value:     "ignore",
+			Message:   "primary key fields cannot be ignored",
+		}
+	}
+	if meta.replace && meta.strategy != nil {
+		return &InvalidTagError{
+			Kind:      UnknownTag,
+			FieldName: meta.fieldName,
+			Value:     "replace",
+			Message:   "cannot be combined with agg or mode=join",
+		}
+	}
 	return nil
 }
 
+// sepDirective returns the position of a sep= directive in a km tag, or -1 if
+// it has none.
+func sepDirective(tag string) int {
+	for offset := 0; ; {
+		i := strings.Index(tag[offset:], "sep=")
+		if i < 0 {
+			return -1
+		}
+		i += offset
+		before := strings.TrimRight(tag[:i], " ")
+		if before == "" || strings.HasSuffix(before, ",") {
+			return i
+		}
+		offset = i + 1
+	}
+}
+
 // parseScalarMode converts a string to ScalarMode.
+func parseEmptyListMode(s string, fieldName string) (EmptyListMode, error) {
+	switch s {
+	case "keep":
+		return EmptyKeep, nil
+	case "replace":
+		return EmptyReplace, nil
+	default:
+		return 0, &InvalidTagError{
+			Kind:      EmptyTag,
+			FieldName: fieldName,
+			Value:     s,
+			Message:   "valid: keep, replace",
+		}
+	}
+}
+
 func parseScalarMode(s string, fieldName string) (ScalarMode, error) {
 	switch s {
 	case "concat":
@@ -338,7 +660,7 @@ func parseScalarMode(s string, fieldName string) (ScalarMode, error) {
 			Kind:      ModeTag,
 			FieldName: fieldName,
 			Value:     s,
-			Message:   "valid: concat, dedup, replace",
+			Message:   "valid: concat, dedup, replace, join",
 		}
 	}
 }
@@ -879,6 +879,48 @@ endpoints:
 	}
 }
 
+func TestMerger_RootList(t *testing.T) {
+	type Rule struct {
+		ID    string `yaml:"id" km:"primary"`
+		Allow bool   `yaml:"allow"`
+	}
+
+	merger, err := keymerge.NewMerger[[]Rule](keymerge.Options{
+		DeleteMarkerKey: "_delete",
+	}, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := []byte(`
+- id: ssh
+  allow: true
+- id: telnet
+  allow: true
+`)
+	overlay := []byte(`
+- id: telnet
+  _delete: true
+- id: ssh
+  allow: false
+- id: https
+  allow: true
+`)
+
+	result, err := merger.Merge(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rules []Rule
+	if err := yaml.Unmarshal(result, &rules); err != nil {
+		t.Fatal(err)
+	}
+	expected := []Rule{{ID: "ssh", Allow: false}, {ID: "https", Allow: true}}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("expected %+v, got %+v", expected, rules)
+	}
+}
+
 // Test Merger with non-comparable composite key types is rejected at construction.
 func TestMerger_CompositePrimaryKey_NonComparable(t *testing.T) {
 	type Endpoint struct {
@@ -1224,6 +1266,10 @@ func TestTagKind_String(t *testing.T) {
 		{keymerge.ModeTag, "mode"},
 		{keymerge.DupeTag, "dupe"},
 		{keymerge.FieldTag, "field"},
+		{keymerge.AggTag, "agg"},
+		{keymerge.SepTag, "sep"},
+		{keymerge.MapTag, "map"},
+		{keymerge.EmptyTag, "empty"},
 	}
 
 	for _, tc := range tests {
@@ -1625,3 +1671,463 @@ items:
 		t.Errorf("expected both integer and string items preserved, got: %+v", config.Items)
 	}
 }
+
+func TestNewMergerFromMetadata(t *testing.T) {
+	type Endpoint struct {
+		Name string `yaml:"name"`
+		URL  string `yaml:"url"`
+	}
+	type Config struct {
+		Endpoints []Endpoint `yaml:"endpoints"`
+		Tags      []string   `yaml:"tags"`
+	}
+
+	// The options don't name a primary key; the metadata does.
+	tree, err := keymerge.NewMetadataTree(
+		keymerge.FieldSpec{Name: "endpoints", List: true, Fields: []keymerge.FieldSpec{{Name: "name", Tag: "primary"}}},
+		keymerge.FieldSpec{Name: "tags", Tag: "mode=dedup", List: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger, err := keymerge.NewMergerFromMetadata[Config](keymerge.Options{PrimaryKeyNames: []string{"id"}}, tree, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := merger.Merge(
+		[]byte("endpoints:\n  - name: api\n    url: a\ntags: [x, y]\n"),
+		[]byte("endpoints:\n  - name: api\n    url: b\ntags: [y, z]\n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := yaml.Unmarshal(result, &config); err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{Endpoints: []Endpoint{{Name: "api", URL: "b"}}, Tags: []string{"x", "y", "z"}}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+
+	_, err = keymerge.NewMergerFromMetadata[Config](keymerge.Options{PrimaryKeyNames: []string{""}}, tree, nil, nil)
+	if !errors.Is(err, keymerge.ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions, got %v", err)
+	}
+}
+
+func TestMerger_EmbeddedStructs(t *testing.T) {
+	type Common struct {
+		Tags  []string `yaml:"tags" km:"mode=dedup"`
+		Owner string   `yaml:"owner"`
+	}
+	type Service struct {
+		Common `yaml:",inline"`
+		Name   string `yaml:"name" km:"primary"`
+	}
+	type Config struct {
+		Common   `yaml:",inline"`
+		Services []Service `yaml:"services"`
+		Tags     []string  `yaml:"tags" km:"mode=replace"` // takes precedence over Common's
+	}
+	merger, err := keymerge.NewMerger[Config](keymerge.Options{}, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := merger.Merge(
+		[]byte("tags: [a, b]\nservices:\n  - name: web\n    tags: [x, y]\n    owner: alice\n"),
+		[]byte("tags: [b, c]\nservices:\n  - name: web\n    tags: [y, z]\n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := yaml.Unmarshal(result, &config); err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{
+		Services: []Service{{Common: Common{Tags: []string{"x", "y", "z"}, Owner: "alice"}, Name: "web"}},
+		Tags:     []string{"b", "c"},
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+
+	// Untagged embedded structs are inlined too, as encoding/json does, and
+	// unexported ones contribute their exported fields.
+	type common struct {
+		ID string `json:"id" km:"primary"`
+	}
+	type Item struct {
+		common
+		*Common
+	}
+	type Items struct {
+		Items []Item `json:"items"`
+	}
+	tree, err := keymerge.MetadataOf[Items]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := keymerge.NewMetadataTree(keymerge.FieldSpec{Name: "items", List: true, Fields: []keymerge.FieldSpec{
+		{Name: "id", Tag: "primary"},
+		{Name: "tags", Tag: "mode=dedup", List: true},
+		{Name: "owner"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tree, want) {
+		t.Errorf("expected %+v, got %+v", want, tree)
+	}
+}
+
+func TestMerger_MergeInto(t *testing.T) {
+	type Service struct {
+		Name     string `yaml:"name" km:"primary"`
+		Replicas int    `yaml:"replicas"`
+	}
+	type Config struct {
+		Name     string    `yaml:"name"`
+		Port     int       `yaml:"port"`
+		Services []Service `yaml:"services"`
+	}
+	merger, err := keymerge.NewMerger[Config](keymerge.Options{DeleteMarkerKey: "_delete"}, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := Config{Name: "app", Port: 8080, Services: []Service{{Name: "web", Replicas: 1}}}
+	err = merger.MergeInto(&config,
+		[]byte("port: 9090\nservices:\n  - name: web\n    replicas: 3\n  - name: db\n    replicas: 1\n"),
+		[]byte("name:\n  _delete: true\n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{Port: 9090, Services: []Service{{Name: "web", Replicas: 3}, {Name: "db", Replicas: 1}}}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+
+	// A failed merge leaves dst as it was.
+	err = merger.MergeInto(&config, []byte("port: 1\n"), []byte("port: [\n"))
+	var marshalErr *keymerge.MarshalError
+	if !errors.As(err, &marshalErr) || marshalErr.DocIndex != 2 {
+		t.Errorf("expected MarshalError for document 2, got %v", err)
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v to be unchanged, got %+v", expected, config)
+	}
+
+	if err := merger.MergeInto(nil); err == nil {
+		t.Error("expected error for nil destination")
+	}
+	noMarshal, _ := keymerge.NewMerger[Config](keymerge.Options{}, nil, nil)
+	if err := noMarshal.MergeInto(&config); err == nil {
+		t.Error("expected error without marshal functions")
+	}
+}
+
+func TestMerger_MapReplaceTag(t *testing.T) {
+	type Config struct {
+		Selector map[string]string `yaml:"selector" km:"map=replace"`
+		Labels   map[string]string `yaml:"labels" km:"map=merge"`
+	}
+	merger, err := keymerge.NewMerger[Config](keymerge.Options{}, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := merger.Merge(
+		[]byte("selector: {app: web, tier: frontend}\nlabels: {team: a}\n"),
+		[]byte("selector: {app: api}\nlabels: {env: prod}\n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := yaml.Unmarshal(result, &config); err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{Selector: map[string]string{"app": "api"}, Labels: map[string]string{"team": "a", "env": "prod"}}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+
+	type Invalid struct {
+		Labels map[string]string `yaml:"labels" km:"map=overwrite"`
+	}
+	_, err = keymerge.NewMerger[Invalid](keymerge.Options{}, nil, nil)
+	var tagErr *keymerge.InvalidTagError
+	if !errors.As(err, &tagErr) || tagErr.Kind != keymerge.MapTag {
+		t.Errorf("expected map InvalidTagError, got %v", err)
+	}
+}
+
+func TestMerger_EmptyTag(t *testing.T) {
+	type Config struct {
+		Hosts []string `yaml:"hosts" km:"empty=replace"`
+		Tags  []string `yaml:"tags"`
+		Zones []string `yaml:"zones" km:"empty=keep"`
+	}
+	merger, err := keymerge.NewMerger[Config](keymerge.Options{}, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := merger.MergeTyped(
+		Config{Hosts: []string{"a"}, Tags: []string{"x"}, Zones: []string{"z"}},
+		Config{Hosts: []string{}, Tags: []string{}, Zones: []string{}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{Hosts: []string{}, Tags: []string{"x"}, Zones: []string{"z"}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+
+	// The tag takes precedence over the options
+	merger, err = keymerge.NewMerger[Config](keymerge.Options{EmptyLists: keymerge.EmptyReplace}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = merger.MergeTyped(Config{Tags: []string{"x"}, Zones: []string{"z"}}, Config{Tags: []string{}, Zones: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (Config{Tags: []string{}, Zones: []string{"z"}}); !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+
+	type Invalid struct {
+		Hosts []string `yaml:"hosts" km:"empty=clear"`
+	}
+	_, err = keymerge.NewMerger[Invalid](keymerge.Options{}, nil, nil)
+	var tagErr *keymerge.InvalidTagError
+	if !errors.As(err, &tagErr) || tagErr.Kind != keymerge.EmptyTag {
+		t.Errorf("expected empty InvalidTagError, got %v", err)
+	}
+}
+
+func TestMerger_IgnoreTag(t *testing.T) {
+	type Node struct {
+		Name   string `yaml:"name" km:"primary"`
+		Size   int    `yaml:"size"`
+		Status string `yaml:"status,omitempty" km:"ignore"`
+	}
+	type Config struct {
+		Nodes      []Node `yaml:"nodes"`
+		Generation int    `yaml:"generation" km:"ignore"`
+		Region     string `yaml:"region"`
+	}
+	merger, err := keymerge.NewMerger[Config](keymerge.Options{}, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := merger.Merge(
+		[]byte("nodes: [{name: a, size: 1, status: ready}]\ngeneration: 7\nregion: us\n"),
+		[]byte("nodes: [{name: a, size: 2, status: failed}, {name: b, size: 1, status: ready}]\ngeneration: 1\n"),
+		[]byte("region: eu\ngeneration: null\n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := yaml.Unmarshal(result, &config); err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{
+		Nodes:      []Node{{Name: "a", Size: 2, Status: "ready"}, {Name: "b", Size: 1}},
+		Generation: 7,
+		Region:     "eu",
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+
+	_, err = keymerge.NewMetadataTree(keymerge.FieldSpec{Name: "id", Tag: "primary,ignore"})
+	var tagErr *keymerge.InvalidTagError
+	if !errors.As(err, &tagErr) || tagErr.Kind != keymerge.PrimaryTag {
+		t.Errorf("expected primary InvalidTagError, got %v", err)
+	}
+}
+
+func TestMerger_ImmutableTag(t *testing.T) {
+	type Volume struct {
+		Name string `yaml:"name" km:"primary"`
+		Size int    `yaml:"size" km:"immutable"`
+	}
+	type Config struct {
+		ClusterID string   `yaml:"cluster_id" km:"immutable"`
+		Volumes   []Volume `yaml:"volumes"`
+		Zones     []string `yaml:"zones" km:"immutable,mode=dedup"`
+		Region    string   `yaml:"region"`
+	}
+	merger, err := keymerge.NewMerger[Config](keymerge.Options{DeleteMarkerKey: "_delete", NullMode: keymerge.NullDelete}, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger.SetDocumentNames("base", "prod")
+	base := []byte("cluster_id: abc\nvolumes: [{name: data, size: 10}]\nzones: [a]\n")
+
+	// Repeating values, setting new ones, and deleting items holding them are allowed
+	result, err := merger.Merge(base,
+		[]byte("cluster_id: abc\nvolumes: [{name: data, size: 10}, {name: logs, size: 5}]\nzones: [a]\nregion: eu\n"),
+		[]byte("volumes: [{name: logs, _delete: true}]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := yaml.Unmarshal(result, &config); err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{ClusterID: "abc", Volumes: []Volume{{Name: "data", Size: 10}}, Zones: []string{"a"}, Region: "eu"}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+
+	for overlay, want := range map[string]string{
+		"cluster_id: xyz\n":                 "immutable field at path cluster_id in document 1 (prod): xyz would replace abc",
+		"volumes: [{name: data, size: 20}]": "immutable field at path volumes.0.size in document 1 (prod): 20 would replace 10",
+		"zones: [b]\n":                      "immutable field at path zones in document 1 (prod): [a b] would replace [a]",
+		"cluster_id: null\n":                "immutable field at path cluster_id in document 1 (prod): deleting abc",
+	} {
+		_, err := merger.Merge(base, []byte(overlay))
+		var immutableErr *keymerge.ImmutableFieldError
+		if !errors.As(err, &immutableErr) || !errors.Is(err, keymerge.ErrImmutableField) {
+			t.Errorf("overlay %q: expected ImmutableFieldError, got %v", overlay, err)
+			continue
+		}
+		if err.Error() != want {
+			t.Errorf("overlay %q: got %q, want %q", overlay, err.Error(), want)
+		}
+	}
+}
+
+func TestMerger_DeleteMarkerTag(t *testing.T) {
+	type Route struct {
+		Path    string `yaml:"path" km:"primary"`
+		Backend string `yaml:"backend"`
+	}
+	type Service struct {
+		Name string `yaml:"name" km:"primary"`
+	}
+	type Config struct {
+		Routes   []Route        `yaml:"routes" km:"delete-marker=remove"`
+		Flags    map[string]any `yaml:"flags" km:"delete-marker="`
+		Services []Service      `yaml:"services"`
+	}
+	merger, err := keymerge.NewMerger[Config](keymerge.Options{DeleteMarkerKey: "_delete"}, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := merger.Merge(
+		[]byte("routes: [{path: /a, backend: x}, {path: /b, backend: y}]\nflags: {_delete: true, a: 1}\nservices: [{name: s1}, {name: s2}]\n"),
+		[]byte("routes: [{path: /a, remove: true}]\nflags: {_delete: false, b: 2}\nservices: [{name: s2, _delete: true}]\n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := yaml.Unmarshal(result, &config); err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{
+		Routes:   []Route{{Path: "/b", Backend: "y"}},
+		Flags:    map[string]any{"_delete": false, "a": uint64(1), "b": uint64(2)},
+		Services: []Service{{Name: "s1"}},
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+
+	// Diff writes each field's own marker
+	tree, err := keymerge.NewMetadataTree(keymerge.FieldSpec{Name: "env", Tag: "delete-marker=remove"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	untyped, err := keymerge.NewUntypedMerger(keymerge.Options{DeleteMarkerKey: "_delete"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	untyped.SetMetadata(tree)
+	overlay, err := untyped.Diff(
+		map[string]any{"env": map[string]any{"a": 1, "b": 2}, "other": map[string]any{"x": 1, "y": 2}},
+		map[string]any{"env": map[string]any{"a": 1}, "other": map[string]any{"y": 2}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"env":   map[string]any{"b": map[string]any{"remove": true}},
+		"other": map[string]any{"x": map[string]any{"_delete": true}},
+	}
+	if !reflect.DeepEqual(overlay, want) {
+		t.Errorf("expected overlay %v, got %v", want, overlay)
+	}
+}
+
+func TestMerger_ReplaceTag(t *testing.T) {
+	type Probe struct {
+		Path    string `yaml:"path"`
+		Timeout int    `yaml:"timeout"`
+	}
+	type Config struct {
+		Probe    Probe             `yaml:"probe" km:"replace"`
+		Args     []string          `yaml:"args" km:"replace"`
+		Env      map[string]string `yaml:"env" km:"replace"`
+		Defaults Probe             `yaml:"defaults"`
+	}
+	merger, err := keymerge.NewMerger[Config](keymerge.Options{}, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := merger.Merge(
+		[]byte("probe: {path: /health, timeout: 5}\nargs: [a, b]\nenv: {A: '1'}\ndefaults: {path: /, timeout: 5}\n"),
+		[]byte("probe: {path: /ready}\nargs: [c]\nenv: {B: '2'}\ndefaults: {path: /ready}\n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := yaml.Unmarshal(result, &config); err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{
+		Probe:    Probe{Path: "/ready"},
+		Args:     []string{"c"},
+		Env:      map[string]string{"B": "2"},
+		Defaults: Probe{Path: "/ready", Timeout: 5},
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+
+	// Diff writes the whole desired value
+	tree, err := keymerge.NewMetadataTree(keymerge.FieldSpec{Name: "probe", Tag: "replace"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	untyped, err := keymerge.NewUntypedMerger(keymerge.Options{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	untyped.SetMetadata(tree)
+	overlay, err := untyped.Diff(
+		map[string]any{"probe": map[string]any{"path": "/health", "timeout": 5}},
+		map[string]any{"probe": map[string]any{"path": "/ready", "timeout": 5}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]any{"probe": map[string]any{"path": "/ready", "timeout": 5}}; !reflect.DeepEqual(overlay, want) {
+		t.Errorf("expected overlay %v, got %v", want, overlay)
+	}
+
+	_, err = keymerge.NewMetadataTree(keymerge.FieldSpec{Name: "count", Tag: "replace,agg=sum"})
+	var tagErr *keymerge.InvalidTagError
+	if !errors.As(err, &tagErr) || tagErr.Value != "replace" {
+		t.Errorf("expected replace InvalidTagError, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownField indicates a document has a field that the merger's metadata
+// does not describe. See [Options.RejectUnknownFields].
+var ErrUnknownField = errors.New("unknown field")
+
+// UnknownFieldError is returned when [Options.RejectUnknownFields] is set and a
+// document has a map key that the merger's metadata has no field for, e.g. a
+// typo in an overlay.
+type UnknownFieldError struct {
+	// Path is the path of the unknown field, ending with its name.
+	Path []string
+	// DocIndex tells which document the field occurred in.
+	DocIndex int
+	// DocName is the document's name, if set with
+	// [UntypedMerger.SetDocumentNames].
+	DocName string
+}
+
+func (e *UnknownFieldError) Error() string {
+	return fmt.Sprintf("unknown field %s in document %d%s", strings.Join(e.Path, "."), e.DocIndex, nameSuffix(e.DocName))
+}
+
+func (e *UnknownFieldError) Is(target error) bool {
+	return target == ErrUnknownField
+}
+
+// checkUnknownFields returns an [*UnknownFieldError] for the first map key in
+// value, in key order, that the metadata at the current path has no field for.
+func (m *UntypedMerger) checkUnknownFields(value any) error {
+	parent := m.metadata
+	if len(m.path) > 0 {
+		parent = m.path[len(m.path)-1].meta
+	}
+	if parent == nil {
+		return nil
+	}
+
+	if mp, ok := value.(map[string]any); ok && parent.children != nil {
+		for _, k := range sortedKeys(mp) {
+			if m.isMarkerKey(k) || (k == m.opts.ConflictMarkerKey && k != "") {
+				continue
+			}
+			if !knowsField(parent, k) {
+				return &UnknownFieldError{Path: append(m.pathNames(), k), DocIndex: m.index}
+			}
+			m.push(k)
+			err := m.checkUnknownFields(mp[k])
+			m.pop()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if list, ok := asList(value); ok && parent.list {
+		for i, item := range list {
+			m.push(strconv.Itoa(i))
+			err := m.checkUnknownFields(item)
+			m.pop()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// knowsField reports whether meta has a field named name. An inlined map,
+// whose field has an empty name, takes any name.
+func knowsField(meta *fieldMetadata, name string) bool {
+	return meta.children[name] != nil || meta.children[""] != nil
+}
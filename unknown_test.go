@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package keymerge_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+func TestMerger_RejectUnknownFields(t *testing.T) {
+	type Service struct {
+		Name string `yaml:"name" km:"primary"`
+		Port int    `yaml:"port"`
+	}
+	type Common struct {
+		Region string `yaml:"region"`
+	}
+	type Config struct {
+		Common   `yaml:",inline"`
+		Services []Service         `yaml:"services"`
+		Labels   map[string]string `yaml:"labels"`
+		Extra    any               `yaml:"extra"`
+	}
+	opts := keymerge.Options{DeleteMarkerKey: "_delete", MoveMarkerKey: "_move_to", RejectUnknownFields: true}
+	merger, err := keymerge.NewMerger[Config](opts, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := []byte("region: eu\nservices:\n  - name: web\n    port: 80\n  - name: db\n    port: 5432\n")
+	result, err := merger.Merge(base,
+		[]byte("labels: {team: web}\nextra: {anything: [goes]}\nservices:\n  - name: db\n    _delete: true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := yaml.Unmarshal(result, &config); err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{
+		Common:   Common{Region: "eu"},
+		Services: []Service{{Name: "web", Port: 80}},
+		Labels:   map[string]string{"team": "web"},
+		Extra:    map[string]any{"anything": []any{"goes"}},
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+
+	tests := map[string]struct {
+		overlay string
+		path    []string
+	}{
+		"top level":    {"servces: []\n", []string{"servces"}},
+		"list item":    {"services:\n  - name: web\n    prot: 8080\n", []string{"services", "0", "prot"}},
+		"first by key": {"zone: a\nservices:\n  - name: web\n    prot: 8080\n", []string{"services", "0", "prot"}},
+	}
+	for name, tc := range tests {
+		_, err := merger.Merge(base, []byte(tc.overlay))
+		var unknownErr *keymerge.UnknownFieldError
+		if !errors.Is(err, keymerge.ErrUnknownField) || !errors.As(err, &unknownErr) {
+			t.Errorf("%s: expected UnknownFieldError, got %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(unknownErr.Path, tc.path) || unknownErr.DocIndex != 1 {
+			t.Errorf("%s: unexpected error location %+v", name, unknownErr)
+		}
+	}
+
+	// Traces reject them too, as the reports built on them do.
+	var baseDoc, overlayDoc any
+	if err := yaml.Unmarshal(base, &baseDoc); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal([]byte(tests["list item"].overlay), &overlayDoc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := merger.Trace(baseDoc, overlayDoc); !errors.Is(err, keymerge.ErrUnknownField) {
+		t.Errorf("expected Trace to fail with ErrUnknownField, got %v", err)
+	}
+
+	// Without the option, unknown fields are merged and dropped when decoding.
+	opts.RejectUnknownFields = false
+	lenient, err := keymerge.NewMerger[Config](opts, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lenient.Merge(base, []byte("servces: []\n")); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
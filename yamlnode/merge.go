@@ -0,0 +1,397 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package yamlnode merges YAML documents by editing the base document's syntax
+// tree (see [github.com/goccy/go-yaml/ast]) rather than re-encoding the merged
+// value, so the comments, anchors, key order, and quoting style of the base
+// file survive wherever the merge leaves its values unchanged.
+//
+// The merge itself is [keymerge.MergeUnstructured], so results have exactly the
+// same values as merging unstructured documents with the same options. This
+// package lives apart from keymerge so that keymerge itself stays free of
+// dependencies.
+package yamlnode
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+// ErrLayout indicates that the merged syntax tree does not read back as the
+// merged value. It should not happen; merge with [keymerge.Merge] instead,
+// which loses comments but not values.
+var ErrLayout = errors.New("merged YAML tree does not match the merged value")
+
+// Merge merges YAML documents left-to-right like [keymerge.Merge] with
+// yaml.Unmarshal and yaml.Marshal, keeping the base document's layout. Only the
+// first document of each input is merged.
+//
+// Example:
+//
+//	out, err := yamlnode.Merge(keymerge.Options{PrimaryKeyNames: []string{"name"}}, base, prod)
+//	// out keeps base's comments and anchors, with prod's changes applied.
+func Merge(opts keymerge.Options, docs ...[]byte) ([]byte, error) {
+	if len(docs) == 0 {
+		return []byte{}, nil
+	}
+	nodes := make([]ast.Node, len(docs))
+	for i, doc := range docs {
+		file, err := parser.ParseBytes(doc, parser.ParseComments)
+		if err != nil {
+			return nil, &keymerge.MarshalError{Err: err, Operation: "unmarshal", DocIndex: i}
+		}
+		if len(file.Docs) > 0 {
+			nodes[i] = file.Docs[0].Body
+		}
+	}
+
+	merged, err := MergeYAMLNodes(opts, nodes[0], nodes[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	if merged == nil {
+		return []byte{}, nil
+	}
+	out := []byte(merged.String() + "\n")
+
+	// Check the printed tree, since printing depends on node positions
+	var want, got any
+	if err := yaml.NodeToValue(merged, &want); err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(out, &got); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLayout, err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		return nil, ErrLayout
+	}
+	return out, nil
+}
+
+// MergeYAMLNodes merges the values of YAML nodes, typically document bodies,
+// left-to-right like [keymerge.MergeUnstructured] and returns base edited to
+// hold the result. Base's nodes are kept where their values are unchanged, and
+// map keys and list items are kept in base's order; changed and new values are
+// encoded afresh, so they lose the overlays' formatting. Base is modified in
+// place and is returned unless the result needs a node of a different kind.
+//
+// An alias in base is kept only while its anchor still holds the alias's
+// merged value; otherwise the value is written out in full. Maps using merge
+// keys (<<) are rewritten in full if their value changes.
+func MergeYAMLNodes(opts keymerge.Options, base ast.Node, overlays ...ast.Node) (ast.Node, error) {
+	if doc, ok := base.(*ast.DocumentNode); ok {
+		base = doc.Body
+	}
+	values := make([]any, 1+len(overlays))
+	for i, node := range append([]ast.Node{base}, overlays...) {
+		if doc, ok := node.(*ast.DocumentNode); ok {
+			node = doc.Body
+		}
+		if node == nil {
+			continue
+		}
+		if err := yaml.NodeToValue(node, &values[i]); err != nil {
+			return nil, &keymerge.MarshalError{Err: err, Operation: "unmarshal", DocIndex: i}
+		}
+	}
+	merged, err := keymerge.MergeUnstructured(opts, values...)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &editor{opts: opts, anchors: map[string]any{}, changed: map[string]bool{}}
+	result := base
+	if base == nil || !e.edit(base, values[0], merged) {
+		if merged == nil {
+			return nil, nil
+		}
+		if result, err = encodeNode(merged, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	var check any
+	if err := yaml.NodeToValue(result, &check); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLayout, err)
+	}
+	changes, err := keymerge.Compare(opts, merged, check)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 {
+		return nil, fmt.Errorf("%w at %s", ErrLayout, changes[0].Path)
+	}
+	return result, nil
+}
+
+// editor edits a base tree in place to hold a merged value.
+type editor struct {
+	opts keymerge.Options
+	// anchors maps the names of the anchors kept so far, in document order,
+	// to their merged values.
+	anchors map[string]any
+	// changed holds the names of anchors whose values the merge changed.
+	changed map[string]bool
+}
+
+// edit changes node, whose value is base, to hold merged. It returns false if
+// node cannot hold merged, in which case the caller must replace node.
+func (e *editor) edit(node ast.Node, base, merged any) bool {
+	switch n := node.(type) {
+	case *ast.AnchorNode:
+		if !e.edit(n.Value, base, merged) {
+			return false
+		}
+		e.anchors[n.Name.String()] = merged
+		e.changed[n.Name.String()] = !reflect.DeepEqual(base, merged)
+		return true
+	case *ast.AliasNode:
+		value, kept := e.anchors[n.Value.String()]
+		return kept && reflect.DeepEqual(value, merged)
+	}
+
+	if reflect.DeepEqual(base, merged) && e.aliasesIntact(node) {
+		e.recordAnchors(node, merged)
+		return true
+	}
+
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		baseMap, baseIsMap := base.(map[string]any)
+		mergedMap, mergedIsMap := merged.(map[string]any)
+		if !baseIsMap || !mergedIsMap || len(mergedMap) == 0 || n.IsFlowStyle || hasMergeKey(n) {
+			return false
+		}
+		return e.editMapping(n, baseMap, mergedMap)
+	case *ast.SequenceNode:
+		baseList, baseIsList := base.([]any)
+		mergedList, mergedIsList := merged.([]any)
+		if !baseIsList || !mergedIsList || len(mergedList) == 0 || n.IsFlowStyle {
+			return false
+		}
+		return e.editSequence(n, baseList, mergedList)
+	default:
+		return false
+	}
+}
+
+// aliasesIntact reports whether every alias within node refers to an anchor
+// that still holds the value it held in base.
+func (e *editor) aliasesIntact(node ast.Node) bool {
+	for _, alias := range ast.Filter(ast.AliasType, node) {
+		name := alias.(*ast.AliasNode).Value.String()
+		if _, kept := e.anchors[name]; !kept || e.changed[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// recordAnchors records the anchors within an unchanged node.
+func (e *editor) recordAnchors(node ast.Node, value any) {
+	for _, found := range ast.Filter(ast.AnchorType, node) {
+		anchor := found.(*ast.AnchorNode)
+		var anchored any
+		if anchor == node {
+			anchored = value
+		} else if err := yaml.NodeToValue(anchor.Value, &anchored); err != nil {
+			continue // e.g. it holds an alias itself; later aliases are rewritten
+		}
+		e.anchors[anchor.Name.String()] = anchored
+	}
+}
+
+func (e *editor) editMapping(n *ast.MappingNode, base, merged map[string]any) bool {
+	column := n.Values[0].Key.GetToken().Position.Column
+	values := make([]*ast.MappingValueNode, 0, len(merged))
+	seen := make(map[string]bool, len(n.Values))
+	for _, mv := range n.Values {
+		var decoded any
+		if err := yaml.NodeToValue(mv.Key, &decoded); err != nil {
+			return false
+		}
+		key := fmt.Sprint(decoded)
+		seen[key] = true
+		value, kept := merged[key]
+		if !kept {
+			continue
+		}
+		if !e.edit(mv.Value, base[key], value) {
+			replacement, err := encodeMappingValue(key, value, column)
+			if err != nil {
+				return false
+			}
+			if isScalar(mv.Value) && isScalar(replacement.Value) {
+				// Keep the key's formatting and the value's line comment
+				_ = replacement.Value.SetComment(mv.Value.GetComment())
+				mv.Value = replacement.Value
+			} else {
+				_ = replacement.SetComment(mv.GetComment())
+				replacement.FootComment = mv.FootComment
+				mv = replacement
+			}
+		}
+		values = append(values, mv)
+	}
+	for _, key := range sortedKeys(merged) {
+		if seen[key] {
+			continue
+		}
+		added, err := encodeMappingValue(key, merged[key], column)
+		if err != nil {
+			return false
+		}
+		values = append(values, added)
+	}
+	n.Values = values
+	return true
+}
+
+func (e *editor) editSequence(n *ast.SequenceNode, base, merged []any) bool {
+	column := n.Start.Position.Column
+	values := make([]ast.Node, 0, len(merged))
+	var comments []*ast.CommentGroupNode
+	used := make([]bool, len(base))
+	for _, item := range merged {
+		i := e.matchItem(base, used, item)
+		if i >= 0 {
+			used[i] = true
+			if e.edit(n.Values[i], base[i], item) {
+				values = append(values, n.Values[i])
+				comments = append(comments, headComment(n, i))
+				continue
+			}
+		}
+		encoded, err := encodeSequenceItem(item, column)
+		if err != nil {
+			return false
+		}
+		values = append(values, encoded)
+		comments = append(comments, nil)
+	}
+	n.Values = values
+	n.ValueHeadComments = comments
+	n.Entries = nil
+	return true
+}
+
+// matchItem returns the index of the unused base item that merged item
+// corresponds to: the one with the same primary key, or else an equal item
+// without one. It returns -1 if there is none.
+func (e *editor) matchItem(base []any, used []bool, item any) int {
+	field, key, keyed := e.itemKey(item)
+	for i, candidate := range base {
+		if used[i] {
+			continue
+		}
+		candidateField, candidateKey, candidateKeyed := e.itemKey(candidate)
+		if keyed && candidateKeyed && field == candidateField && key.Equal(candidateKey) {
+			return i
+		}
+		if !keyed && !candidateKeyed && reflect.DeepEqual(candidate, item) {
+			return i
+		}
+	}
+	return -1
+}
+
+// itemKey returns the first primary key field item has and its key.
+func (e *editor) itemKey(item any) (string, keymerge.Key, bool) {
+	for _, field := range e.opts.PrimaryKeyNames {
+		if key, ok := keymerge.KeyOf(item, field); ok {
+			return field, key, true
+		}
+	}
+	return "", keymerge.Key{}, false
+}
+
+func headComment(n *ast.SequenceNode, i int) *ast.CommentGroupNode {
+	if len(n.ValueHeadComments) == len(n.Values) {
+		return n.ValueHeadComments[i]
+	}
+	return nil
+}
+
+func hasMergeKey(n *ast.MappingNode) bool {
+	for _, mv := range n.Values {
+		if mv.Key.Type() == ast.MergeKeyType {
+			return true
+		}
+	}
+	return false
+}
+
+func isScalar(node ast.Node) bool {
+	_, ok := node.(ast.ScalarNode)
+	return ok && node.Type() != ast.AliasType
+}
+
+// encodeMappingValue encodes key and value as a mapping entry whose key is at column.
+func encodeMappingValue(key string, value any, column int) (*ast.MappingValueNode, error) {
+	node, err := encodeNode(map[string]any{key: value}, column)
+	if err != nil {
+		return nil, err
+	}
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		return n.Values[0], nil
+	case *ast.MappingValueNode:
+		return n, nil
+	default:
+		return nil, fmt.Errorf("unexpected %s encoding a mapping", node.Type())
+	}
+}
+
+// encodeSequenceItem encodes item as a sequence entry whose "-" is at column.
+func encodeSequenceItem(item any, column int) (ast.Node, error) {
+	node, err := encodeNode([]any{item}, column)
+	if err != nil {
+		return nil, err
+	}
+	seq, ok := node.(*ast.SequenceNode)
+	if !ok || len(seq.Values) != 1 {
+		return nil, fmt.Errorf("unexpected %s encoding a sequence", node.Type())
+	}
+	return seq.Values[0], nil
+}
+
+// encodeNode encodes value as a block-style node starting at column, so that
+// it prints correctly in place of a node there.
+func encodeNode(value any, column int) (ast.Node, error) {
+	encoded, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if column > 1 {
+		indent := strings.Repeat(" ", column-1)
+		lines := strings.Split(strings.TrimSuffix(string(encoded), "\n"), "\n")
+		for i, line := range lines {
+			if line != "" {
+				lines[i] = indent + line
+			}
+		}
+		encoded = []byte(strings.Join(lines, "\n") + "\n")
+	}
+	file, err := parser.ParseBytes(encoded, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	return file.Docs[0].Body, nil
+}
+
+func sortedKeys(mp map[string]any) []string {
+	keys := make([]string, 0, len(mp))
+	for k := range mp {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
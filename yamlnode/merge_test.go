@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package yamlnode_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+
+	"github.com/sam-fredrickson/keymerge"
+	"github.com/sam-fredrickson/keymerge/yamlnode"
+)
+
+var opts = keymerge.Options{PrimaryKeyNames: []string{"name"}, DeleteMarkerKey: "_delete"}
+
+func TestMerge_KeepsBaseLayout(t *testing.T) {
+	base := `# Application config
+app:
+  name: myapp # the name
+  country: "NO"
+  version: '1.0.0'
+defaults: &defaults
+  timeout: 30
+services:
+  # the API
+  - name: api
+    port: 8080 # public
+    settings: *defaults
+  - name: old
+`
+	overlay := `app:
+  version: 1.1.0
+services:
+  - name: api
+    port: 9090
+  - name: old
+    _delete: true
+  - name: cache
+    port: 6379
+`
+	out, err := yamlnode.Merge(opts, []byte(base), []byte(overlay))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# Application config
+app:
+  name: myapp # the name
+  country: "NO"
+  version: 1.1.0
+defaults: &defaults
+  timeout: 30
+services:
+  # the API
+  - name: api
+    port: 9090 # public
+    settings: *defaults
+  - name: cache
+    port: 6379
+`
+	if string(out) != expected {
+		t.Errorf("unexpected result:\n got:\n%s\nwant:\n%s", out, expected)
+	}
+}
+
+func TestMerge_RewritesAliasesOfChangedAnchors(t *testing.T) {
+	base := `defaults: &defaults
+  timeout: 30
+first: *defaults
+second: *defaults
+`
+	overlay := `defaults:
+  timeout: 60
+second:
+  timeout: 60
+`
+	out, err := yamlnode.Merge(opts, []byte(base), []byte(overlay))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// first keeps the old value, so it can no longer use the anchor
+	expected := `defaults: &defaults
+  timeout: 60
+first:
+  timeout: 30
+second: *defaults
+`
+	if string(out) != expected {
+		t.Errorf("unexpected result:\n got:\n%s\nwant:\n%s", out, expected)
+	}
+}
+
+// TestMerge_MatchesUnstructuredMerge checks that results have the same values
+// as merging unstructured documents.
+func TestMerge_MatchesUnstructuredMerge(t *testing.T) {
+	for _, files := range [][]string{
+		{"foo-base.yaml", "foo-o1.yaml", "foo-o2.yaml"},
+		{"foo-base.yaml", "foo-z.yaml"},
+		{"test-simple-base.yaml", "test-simple-overlay.yaml"},
+	} {
+		var docs [][]byte
+		for _, file := range files {
+			doc, err := os.ReadFile("../testfiles/" + file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			docs = append(docs, doc)
+		}
+		out, err := yamlnode.Merge(opts, docs...)
+		if err != nil {
+			t.Fatalf("%v: %v", files, err)
+		}
+		expected, err := keymerge.Merge(opts, yaml.Unmarshal, yaml.Marshal, docs...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got, want any
+		if err := yaml.Unmarshal(out, &got); err != nil {
+			t.Fatal(err)
+		}
+		if err := yaml.Unmarshal(expected, &want); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got\n%s\nwant\n%s", files, out, expected)
+		}
+	}
+}
+
+func TestMergeYAMLNodes(t *testing.T) {
+	parse := func(src string) *ast.File {
+		t.Helper()
+		file, err := parser.ParseBytes([]byte(src), parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	base := parse("# ports\nports: [80]\nhost: example.com # public\n")
+	overlay := parse("ports: [443]\n")
+
+	merged, err := yamlnode.MergeYAMLNodes(opts, base.Docs[0], overlay.Docs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged != base.Docs[0].Body {
+		t.Error("expected the base node to be edited in place")
+	}
+	if got := merged.String(); got != "# ports\nports:\n- 80\n- 443\nhost: example.com # public" {
+		t.Errorf("unexpected result %q", got)
+	}
+
+	// A result of a different kind replaces the base node.
+	merged, err = yamlnode.MergeYAMLNodes(opts, parse("a: 1\n").Docs[0], parse("[1, 2]\n").Docs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := merged.String(); got != "- 1\n- 2" {
+		t.Errorf("unexpected result %q", got)
+	}
+
+	// Merge errors are those of keymerge.
+	_, err = yamlnode.MergeYAMLNodes(opts, parse("s: [{name: a}]\n").Docs[0], parse("s: [{name: b}, {name: b}]\n").Docs[0])
+	if err == nil {
+		t.Error("expected duplicate primary key error")
+	}
+}
@@ -0,0 +1,319 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package yamlnode
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+
+	"github.com/sam-fredrickson/keymerge"
+)
+
+var astNodeType = reflect.TypeOf((*ast.Node)(nil)).Elem()
+
+// Merger merges YAML documents with the km struct tags of T like a
+// [keymerge.Merger], except that fields of T typed as [ast.Node] are merged at
+// node level with [MergeYAMLNodes], keeping the base document's comments,
+// anchors, and formatting within them. The rest of the result is encoded
+// afresh, as [keymerge.Merge] would.
+//
+// Only fields reached through struct fields, not list items, are merged at node
+// level. A field whose node-level merge would disagree with the typed merge,
+// e.g. because its km tag replaces the value, is encoded afresh too.
+//
+// Example:
+//
+//	type Config struct {
+//		Replicas int      `yaml:"replicas" km:"agg=sum"`
+//		Extra    ast.Node `yaml:"extra"` // keeps its comments
+//	}
+//
+//	merger, err := yamlnode.NewMerger[Config](keymerge.Options{})
+//	out, err := merger.Merge(base, overlay)
+type Merger[T any] struct {
+	merger *keymerge.Merger[T]
+	// nodes holds the paths of T's fields typed as ast.Node.
+	nodes [][]string
+}
+
+// NewMerger creates a [Merger] for T with the given options. Returns an error
+// if the options are invalid or T's struct tags contain invalid directives.
+func NewMerger[T any](opts keymerge.Options) (*Merger[T], error) {
+	merger, err := keymerge.NewMerger[T](opts, yaml.Unmarshal, yaml.Marshal)
+	if err != nil {
+		return nil, err
+	}
+	return &Merger[T]{
+		merger: merger,
+		nodes:  nodeFields(reflect.TypeOf((*T)(nil)).Elem(), nil),
+	}, nil
+}
+
+// Merge merges YAML documents left-to-right and returns the result. Only the
+// first document of each input is merged.
+func (m *Merger[T]) Merge(docs ...[]byte) ([]byte, error) {
+	if len(docs) == 0 {
+		return []byte{}, nil
+	}
+	nodes := make([]ast.Node, len(docs))
+	values := make([]any, len(docs))
+	for i, doc := range docs {
+		file, err := parser.ParseBytes(doc, parser.ParseComments)
+		if err != nil {
+			return nil, &keymerge.MarshalError{Err: err, Operation: "unmarshal", DocIndex: i}
+		}
+		if len(file.Docs) == 0 || file.Docs[0].Body == nil {
+			continue
+		}
+		nodes[i] = file.Docs[0].Body
+		if err := yaml.NodeToValue(nodes[i], &values[i]); err != nil {
+			return nil, &keymerge.MarshalError{Err: err, Operation: "unmarshal", DocIndex: i}
+		}
+	}
+	merged, err := m.merger.MergeUnstructured(values...)
+	if err != nil {
+		return nil, err
+	}
+	if merged == nil {
+		return []byte{}, nil
+	}
+
+	result, err := encodeNode(merged, 0)
+	if err != nil {
+		return nil, &keymerge.MarshalError{Err: err, Operation: "marshal", DocIndex: -1}
+	}
+	for _, path := range m.nodes {
+		if err := m.mergeNodeField(result, nodes, merged, path); err != nil {
+			return nil, err
+		}
+	}
+	out := []byte(result.String() + "\n")
+
+	var got any
+	if err := yaml.Unmarshal(out, &got); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLayout, err)
+	}
+	changes, err := keymerge.Compare(m.merger.Options(), merged, got)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 {
+		return nil, fmt.Errorf("%w at %s", ErrLayout, changes[0].Path)
+	}
+	return out, nil
+}
+
+// MergeValue merges YAML documents like [Merger.Merge] and decodes the result
+// into a T, whose [ast.Node] fields hold the merged nodes with their comments.
+func (m *Merger[T]) MergeValue(docs ...[]byte) (T, error) {
+	var value T
+	out, err := m.Merge(docs...)
+	if err != nil {
+		return value, err
+	}
+	file, err := parser.ParseBytes(out, parser.ParseComments)
+	if err != nil {
+		return value, &keymerge.MarshalError{Err: err, Operation: "unmarshal", DocIndex: -1}
+	}
+	if len(file.Docs) == 0 || file.Docs[0].Body == nil {
+		return value, nil
+	}
+	if err := yaml.NodeToValue(file.Docs[0].Body, &value); err != nil {
+		return value, &keymerge.MarshalError{Err: err, Operation: "unmarshal", DocIndex: -1}
+	}
+	return value, nil
+}
+
+// mergeNodeField replaces the value at path in result, a freshly encoded tree
+// of merged, with the node-level merge of the documents' values there.
+func (m *Merger[T]) mergeNodeField(result ast.Node, docs []ast.Node, merged any, path []string) error {
+	target := lookupNode(result, path)
+	want, ok := lookupValue(merged, path)
+	if target == nil || !ok {
+		return nil
+	}
+	var base ast.Node
+	overlays := make([]ast.Node, 0, len(docs))
+	for i, doc := range docs {
+		var node ast.Node
+		if mv := lookupNode(doc, path); mv != nil {
+			node = mv.Value
+		}
+		if i == 0 {
+			base = node
+		} else {
+			overlays = append(overlays, node)
+		}
+	}
+	if base == nil {
+		return nil // nothing to keep
+	}
+
+	node, err := MergeYAMLNodes(m.merger.Options(), base, overlays...)
+	if err != nil {
+		return err
+	}
+	var got any
+	if node == nil || yaml.NodeToValue(node, &got) != nil {
+		return nil
+	}
+	if changes, err := keymerge.Compare(m.merger.Options(), want, got); err != nil || len(changes) > 0 {
+		return nil // the field's directives merge differently; keep the fresh encoding
+	}
+	if delta := nodeColumn(target.Value) - nodeColumn(node); delta != 0 {
+		node.AddColumn(delta)
+	}
+	target.Value = node
+	return nil
+}
+
+// nodeFields returns the paths of the fields of t typed as [ast.Node], through
+// nested structs and pointers to them.
+func nodeFields(t reflect.Type, prefix []string) [][]string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var paths [][]string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if inlined := inlinedStruct(field); inlined != nil {
+			paths = append(paths, nodeFields(inlined, prefix)...)
+			continue
+		}
+		name, ok := fieldName(field)
+		if !field.IsExported() || !ok {
+			continue
+		}
+		path := append(prefix[:len(prefix):len(prefix)], name)
+		if field.Type == astNodeType {
+			paths = append(paths, path)
+			continue
+		}
+		paths = append(paths, nodeFields(field.Type, path)...)
+	}
+	return paths
+}
+
+// fieldName returns a field's serialized name the way keymerge detects it:
+// from a km field= directive, then yaml, json, and toml tags. It returns false
+// for fields that are not serialized.
+func fieldName(field reflect.StructField) (string, bool) {
+	for _, part := range strings.Split(field.Tag.Get("km"), ",") {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(part), "field="); ok && name != "" {
+			return name, true
+		}
+	}
+	for _, tagName := range []string{"yaml", "json", "toml"} {
+		tag := field.Tag.Get(tagName)
+		if tag == "-" {
+			return "", false
+		}
+		if name, _, _ := strings.Cut(tag, ","); name != "" {
+			return name, true
+		}
+	}
+	return field.Name, true
+}
+
+// inlinedStruct returns the struct type of a field whose fields keymerge merges
+// at its parent's level, the way it detects them: a struct tagged ,inline, or
+// an embedded struct whose tags give it no name. It returns nil otherwise.
+func inlinedStruct(field reflect.StructField) reflect.Type {
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		if !field.IsExported() {
+			return nil
+		}
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || (!field.IsExported() && !field.Anonymous) {
+		return nil
+	}
+	for _, part := range strings.Split(field.Tag.Get("km"), ",") {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(part), "field="); ok && name != "" {
+			return nil
+		}
+	}
+	for _, tagName := range []string{"yaml", "json", "toml"} {
+		tag := field.Tag.Get(tagName)
+		if tag == "-" {
+			return nil
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if slices.Contains(strings.Split(options, ","), "inline") {
+			return t
+		}
+		if name != "" {
+			return nil
+		}
+	}
+	if field.Anonymous {
+		return t
+	}
+	return nil
+}
+
+// lookupNode returns the mapping entry at path in node, or nil if there is none.
+func lookupNode(node ast.Node, path []string) *ast.MappingValueNode {
+	var found *ast.MappingValueNode
+	for _, key := range path {
+		if found != nil {
+			node = found.Value
+		}
+		if anchor, ok := node.(*ast.AnchorNode); ok {
+			node = anchor.Value
+		}
+		mapping, ok := node.(*ast.MappingNode)
+		if !ok {
+			return nil
+		}
+		found = nil
+		for _, mv := range mapping.Values {
+			var decoded any
+			if yaml.NodeToValue(mv.Key, &decoded) == nil && fmt.Sprint(decoded) == key {
+				found = mv
+				break
+			}
+		}
+		if found == nil {
+			return nil
+		}
+	}
+	return found
+}
+
+// lookupValue returns the value at path in an unstructured document.
+func lookupValue(value any, path []string) (any, bool) {
+	for _, key := range path {
+		mp, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = mp[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// nodeColumn returns the column a node's block starts at.
+func nodeColumn(node ast.Node) int {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		if len(n.Values) > 0 {
+			return n.Values[0].Key.GetToken().Position.Column
+		}
+	case *ast.SequenceNode:
+		return n.Start.Position.Column
+	}
+	return node.GetToken().Position.Column
+}
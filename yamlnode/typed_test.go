@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package yamlnode_test
+
+import (
+	"testing"
+
+	"github.com/goccy/go-yaml/ast"
+
+	"github.com/sam-fredrickson/keymerge"
+	"github.com/sam-fredrickson/keymerge/yamlnode"
+)
+
+type plugin struct {
+	Name    string   `yaml:"name" km:"primary"`
+	Enabled bool     `yaml:"enabled"`
+	Config  ast.Node `yaml:"config"`
+}
+
+type typedConfig struct {
+	Replicas int      `yaml:"replicas" km:"agg=sum"`
+	Extra    ast.Node `yaml:"extra"`
+	Server   struct {
+		Host  string   `yaml:"host"`
+		Tuned ast.Node `yaml:"tuned"`
+	} `yaml:"server"`
+	Plugins []plugin `yaml:"plugins"`
+}
+
+func TestMerger_NodeFields(t *testing.T) {
+	merger, err := yamlnode.NewMerger[typedConfig](opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := `# replicas across zones
+replicas: 2
+extra:
+  # kept
+  level: debug # verbose
+  sinks: [stdout]
+server:
+    host: a # dropped
+    tuned:
+        # also kept
+        workers: 4
+plugins:
+  - name: auth
+    config:
+      # not kept: list items are merged afresh
+      ttl: 60
+`
+	overlay := `replicas: 3
+extra:
+  sinks: [file]
+server:
+  tuned:
+    queue: 16
+plugins:
+  - name: auth
+    enabled: true
+`
+	out, err := merger.Merge([]byte(base), []byte(overlay))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `extra:
+  # kept
+  level: debug # verbose
+  sinks:
+  - stdout
+  - file
+plugins:
+- config:
+    ttl: 60
+  enabled: true
+  name: auth
+replicas: 5
+server:
+  host: a
+  tuned:
+    # also kept
+    workers: 4
+    queue: 16
+`
+	if string(out) != expected {
+		t.Errorf("unexpected result:\n got:\n%s\nwant:\n%s", out, expected)
+	}
+
+	config, err := merger.MergeValue([]byte(base), []byte(overlay))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Replicas != 5 || config.Extra == nil || config.Server.Tuned == nil {
+		t.Fatalf("unexpected value %+v", config)
+	}
+	if got := config.Server.Tuned.String(); got != "    # also kept\n    workers: 4\n    queue: 16" {
+		t.Errorf("unexpected node %q", got)
+	}
+}
+
+func TestMerger_NodeFieldDirectives(t *testing.T) {
+	type Config struct {
+		Limits ast.Node `yaml:"limits" km:"replace"`
+	}
+	merger, err := yamlnode.NewMerger[Config](keymerge.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := merger.Merge([]byte("limits:\n  # cpu\n  cpu: 1\n  memory: 2\n"), []byte("limits:\n  cpu: 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "limits:\n  cpu: 2\n" {
+		t.Errorf("unexpected result %q", out)
+	}
+
+	type Invalid struct {
+		Extra ast.Node `yaml:"extra" km:"dupe=sometimes"`
+	}
+	if _, err := yamlnode.NewMerger[Invalid](keymerge.Options{}); err == nil {
+		t.Error("expected invalid tag error")
+	}
+}
+
+func TestMerger_EmbeddedNodeFields(t *testing.T) {
+	type Common struct {
+		Extra ast.Node `yaml:"extra"`
+	}
+	type Config struct {
+		Common `yaml:",inline"`
+		Name   string `yaml:"name"`
+	}
+	merger, err := yamlnode.NewMerger[Config](keymerge.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := merger.Merge([]byte("name: a\nextra:\n  # kept\n  level: debug\n"), []byte("extra:\n  sinks: [file]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "extra:\n  # kept\n  level: debug\n  sinks:\n  - file\nname: a\n"; string(out) != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+}